@@ -18,6 +18,7 @@ type Account struct {
 	Key                    *jose.JSONWebKey `json:"-"`
 	Contact                []string         `json:"contact,omitempty"`
 	Status                 Status           `json:"status"`
+	TermsOfServiceAgreed   bool             `json:"termsOfServiceAgreed,omitempty"`
 	OrdersURL              string           `json:"orders"`
 	ExternalAccountBinding interface{}      `json:"externalAccountBinding,omitempty"`
 	LocationPrefix         string           `json:"-"`
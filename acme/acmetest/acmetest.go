@@ -0,0 +1,118 @@
+// Package acmetest implements in-process fake responders for the http-01,
+// dns-01 and tls-alpn-01 ACME challenges, and an acme.Client that sends the
+// validations to them, so the challenge flows can be tested without external
+// services.
+//
+// A typical test starts the responders it needs, configures the response of
+// the challenge, and validates it with the client in the context:
+//
+//	srv := acmetest.NewHTTP01Server()
+//	defer srv.Close()
+//	srv.SetKeyAuthorization(ch.Token, keyAuth)
+//	ctx = acme.NewClientContext(ctx, &acmetest.Client{HTTP01: srv})
+//	err := ch.Validate(ctx, db, jwk, nil)
+package acmetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+// Client is an implementation of acme.Client that connects to the fake
+// responders instead of the addresses of the challenges. The http-01 requests
+// are sent to HTTP01, the tls-alpn-01 connections to TLSALPN01 and the DNS
+// queries to DNS. The validations of a challenge without its responder fail
+// with a connection error.
+type Client struct {
+	HTTP01    *HTTP01Server
+	TLSALPN01 *TLSALPN01Server
+	DNS       *DNSServer
+}
+
+var errNoResponder = errors.New("acmetest: responder is not configured")
+
+// Get issues an HTTP GET to the http-01 responder. The request keeps the host
+// of the given URL, and the redirects are followed as the CA does.
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	if c.HTTP01 == nil {
+		return nil, errNoResponder
+	}
+	addr := c.HTTP01.Listener.Addr().String()
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return acme.NewClient(acme.WithHTTPClient(&http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	})).Get(ctx, url)
+}
+
+// LookupTxt returns the TXT records of the given name in the DNS responder.
+func (c *Client) LookupTxt(ctx context.Context, name string) ([]string, error) {
+	return c.LookupTxtOn(ctx, "", name)
+}
+
+// LookupNS returns the address of the DNS responder, the authoritative
+// nameserver of all the zones.
+func (c *Client) LookupNS(_ context.Context, _ string) ([]string, error) {
+	if c.DNS == nil {
+		return nil, errNoResponder
+	}
+	return []string{c.DNS.Addr()}, nil
+}
+
+// LookupTxtOn returns the TXT records of the given name in the DNS responder,
+// the server is ignored.
+func (c *Client) LookupTxtOn(ctx context.Context, _, name string) ([]string, error) {
+	if c.DNS == nil {
+		return nil, errNoResponder
+	}
+	return c.DNS.resolver().LookupTXT(ctx, name)
+}
+
+// LookupCAA returns an empty list, the fake responders do not have CAA records.
+func (c *Client) LookupCAA(_ context.Context, _ string) ([]acme.CAARecord, error) {
+	return nil, nil
+}
+
+// TLSDial connects to the tls-alpn-01 responder and initiates a TLS handshake
+// with the given configuration.
+func (c *Client) TLSDial(ctx context.Context, network, _ string, config *tls.Config) (*tls.Conn, error) {
+	if c.TLSALPN01 == nil {
+		return nil, errNoResponder
+	}
+	d := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 5 * time.Second},
+		Config:    config,
+	}
+	conn, err := d.DialContext(ctx, network, c.TLSALPN01.Listener.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*tls.Conn), nil
+}
+
+// KeyAuthorization returns the key authorization of the given token and
+// account key, the body of the http-01 responses.
+func KeyAuthorization(token string, jwk *jose.JSONWebKey) (string, error) {
+	return acme.KeyAuthorization(token, jwk)
+}
+
+// DNS01Value returns the value of the dns-01 TXT record for the given key
+// authorization.
+func DNS01Value(keyAuth string) string {
+	h := sha256.Sum256([]byte(keyAuth))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
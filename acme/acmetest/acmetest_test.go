@@ -0,0 +1,125 @@
+package acmetest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+func mustValidate(t *testing.T, ctx context.Context, ch *acme.Challenge, jwk *jose.JSONWebKey) *acme.Challenge {
+	t.Helper()
+	db := &acme.MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *acme.Challenge) error { return nil },
+	}
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	return ch
+}
+
+func newChallenge(typ acme.ChallengeType) *acme.Challenge {
+	return &acme.Challenge{
+		ID:     "chID",
+		Type:   typ,
+		Status: acme.StatusPending,
+		Token:  "token",
+		Value:  "example.com",
+	}
+}
+
+func TestClient_http01(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+
+	srv := NewHTTP01Server()
+	defer srv.Close()
+	ctx := acme.NewClientContext(context.Background(), &Client{HTTP01: srv})
+
+	srv.SetKeyAuthorization("token", keyAuth)
+	ch := mustValidate(t, ctx, newChallenge(acme.HTTP01), jwk)
+	assert.Equal(t, acme.StatusValid, ch.Status)
+
+	srv.SetResponse("token", HTTP01Response{StatusCode: http.StatusForbidden})
+	ch = mustValidate(t, ctx, newChallenge(acme.HTTP01), jwk)
+	assert.Equal(t, acme.StatusPending, ch.Status)
+	if assert.NotNil(t, ch.Error) {
+		assert.Contains(t, ch.Error.Err.Error(), "with status code 403")
+	}
+
+	srv.Remove("token")
+	ch = mustValidate(t, ctx, newChallenge(acme.HTTP01), jwk)
+	if assert.NotNil(t, ch.Error) {
+		assert.Contains(t, ch.Error.Err.Error(), "with status code 404")
+	}
+
+	ch = mustValidate(t, acme.NewClientContext(context.Background(), &Client{}), newChallenge(acme.HTTP01), jwk)
+	if assert.NotNil(t, ch.Error) {
+		assert.Contains(t, ch.Error.Err.Error(), errNoResponder.Error())
+	}
+}
+
+func TestClient_dns01(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+
+	srv, err := NewDNSServer()
+	require.NoError(t, err)
+	defer srv.Close()
+	ctx := acme.NewClientContext(context.Background(), &Client{DNS: srv})
+
+	srv.SetKeyAuthorization("*.example.com", keyAuth)
+	ch := mustValidate(t, ctx, newChallenge(acme.DNS01), jwk)
+	assert.Equal(t, acme.StatusValid, ch.Status)
+
+	srv.SetTXT("_acme-challenge.example.com", "foo", "bar")
+	ch = mustValidate(t, ctx, newChallenge(acme.DNS01), jwk)
+	assert.Equal(t, acme.StatusPending, ch.Status)
+	if assert.NotNil(t, ch.Error) {
+		assert.Contains(t, ch.Error.Err.Error(), "but got [foo bar]")
+	}
+
+	srv.SetTXT("_acme-challenge.example.com")
+	ch = mustValidate(t, ctx, newChallenge(acme.DNS01), jwk)
+	if assert.NotNil(t, ch.Error) {
+		assert.Contains(t, ch.Error.Err.Error(), "error looking up TXT records for domain example.com")
+	}
+
+	ns, err := (&Client{DNS: srv}).LookupNS(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{srv.Addr()}, ns)
+}
+
+func TestClient_tlsalpn01(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+
+	srv := NewTLSALPN01Server()
+	defer srv.Close()
+	ctx := acme.NewClientContext(context.Background(), &Client{TLSALPN01: srv})
+
+	cert, err := NewTLSALPN01Certificate("token", jwk, "example.com")
+	require.NoError(t, err)
+	srv.SetCertificate("example.com", cert)
+	ch := mustValidate(t, ctx, newChallenge(acme.TLSALPN01), jwk)
+	assert.Equal(t, acme.StatusValid, ch.Status)
+
+	require.NoError(t, srv.SetKeyAuthorization("example.com", "foo"))
+	ch = mustValidate(t, ctx, newChallenge(acme.TLSALPN01), jwk)
+	assert.Equal(t, acme.StatusInvalid, ch.Status)
+	if assert.NotNil(t, ch.Error) {
+		assert.Contains(t, ch.Error.Err.Error(), "expected acmeValidationV1 extension value")
+	}
+
+	ch = newChallenge(acme.TLSALPN01)
+	ch.Value = "other.example.com"
+	ch = mustValidate(t, ctx, ch, jwk)
+	assert.Equal(t, acme.StatusInvalid, ch.Status)
+}
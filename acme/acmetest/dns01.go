@@ -0,0 +1,140 @@
+package acmetest
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxTXTStringSize is the maximum length of a character-string in a TXT
+// record.
+const maxTXTStringSize = 255
+
+// DNSServer is a fake UDP nameserver. It responds to the TXT queries with the
+// records configured for the name, and with NXDOMAIN to the names without
+// records. Other types of queries get an empty answer.
+type DNSServer struct {
+	conn net.PacketConn
+	mu   sync.RWMutex
+	txt  map[string][]string
+}
+
+// NewDNSServer starts and returns a new nameserver listening on a local port.
+// The caller should call Close when finished, to shut it down.
+func NewDNSServer() (*DNSServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &DNSServer{
+		conn: conn,
+		txt:  make(map[string][]string),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address, as host:port, of the nameserver.
+func (s *DNSServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close shuts down the nameserver.
+func (s *DNSServer) Close() error {
+	return s.conn.Close()
+}
+
+// SetTXT replaces the TXT records of the given name. An empty list of values
+// removes the name.
+func (s *DNSServer) SetTXT(name string, values ...string) {
+	name = canonicalName(name)
+	s.mu.Lock()
+	if len(values) == 0 {
+		delete(s.txt, name)
+	} else {
+		s.txt[name] = append([]string(nil), values...)
+	}
+	s.mu.Unlock()
+}
+
+// SetKeyAuthorization sets the dns-01 TXT record of the given domain, in the
+// default _acme-challenge name, for the given key authorization.
+func (s *DNSServer) SetKeyAuthorization(domain, keyAuth string) {
+	s.SetTXT("_acme-challenge."+strings.TrimPrefix(domain, "*."), DNS01Value(keyAuth))
+}
+
+// resolver returns a resolver that sends all the queries to the nameserver.
+func (s *DNSServer) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.Addr())
+		},
+	}
+}
+
+func (s *DNSServer) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp, err := s.respond(buf[:n]); err == nil {
+			s.conn.WriteTo(resp, addr) //nolint:errcheck // the client will retry
+		}
+	}
+}
+
+func (s *DNSServer) respond(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	records, ok := s.txt[canonicalName(q.Name.String())]
+	s.mu.RUnlock()
+
+	rcode := dnsmessage.RCodeSuccess
+	if !ok {
+		rcode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RCode: rcode})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if q.Type == dnsmessage.TypeTXT {
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET}
+		for _, r := range records {
+			// Values longer than a character-string are split.
+			var parts []string
+			for len(r) > maxTXTStringSize {
+				parts, r = append(parts, r[:maxTXTStringSize]), r[maxTXTStringSize:]
+			}
+			if err := b.TXTResource(rh, dnsmessage.TXTResource{TXT: append(parts, r)}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,73 @@
+package acmetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const http01PathPrefix = "/.well-known/acme-challenge/"
+
+// HTTP01Response is the response of the http-01 responder for a token. A zero
+// StatusCode responds with 200 OK.
+type HTTP01Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// HTTP01Server is a fake http-01 responder. It serves the responses configured
+// for the tokens under /.well-known/acme-challenge/ and responds with 404 Not
+// Found to any other request.
+type HTTP01Server struct {
+	*httptest.Server
+	mu        sync.RWMutex
+	responses map[string]HTTP01Response
+}
+
+// NewHTTP01Server starts and returns a new http-01 responder. The caller
+// should call Close when finished, to shut it down.
+func NewHTTP01Server() *HTTP01Server {
+	s := &HTTP01Server{
+		responses: make(map[string]HTTP01Response),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// SetKeyAuthorization responds to the given token with the key authorization.
+func (s *HTTP01Server) SetKeyAuthorization(token, keyAuth string) {
+	s.SetResponse(token, HTTP01Response{Body: keyAuth})
+}
+
+// SetResponse responds to the given token with the given response.
+func (s *HTTP01Server) SetResponse(token string, resp HTTP01Response) {
+	s.mu.Lock()
+	s.responses[token] = resp
+	s.mu.Unlock()
+}
+
+// Remove deletes the response of the given token.
+func (s *HTTP01Server) Remove(token string) {
+	s.mu.Lock()
+	delete(s.responses, token)
+	s.mu.Unlock()
+}
+
+func (s *HTTP01Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	resp, ok := s.responses[strings.TrimPrefix(r.URL.Path, http01PathPrefix)]
+	s.mu.RUnlock()
+	if !ok || !strings.HasPrefix(r.URL.Path, http01PathPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	if resp.StatusCode != 0 {
+		w.WriteHeader(resp.StatusCode)
+	}
+	w.Write([]byte(resp.Body)) //nolint:errcheck // the client may be gone
+}
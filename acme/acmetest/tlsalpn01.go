@@ -0,0 +1,81 @@
+package acmetest
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+// tlsalpn01Protocol is the ALPN protocol of the tls-alpn-01 challenge.
+const tlsalpn01Protocol = "acme-tls/1"
+
+// TLSALPN01Server is a fake tls-alpn-01 responder. It negotiates the
+// acme-tls/1 protocol and presents the certificate configured for the server
+// name of the handshake. Handshakes for other names present the default
+// certificate of httptest, which the validation rejects.
+type TLSALPN01Server struct {
+	*httptest.Server
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+}
+
+// NewTLSALPN01Server starts and returns a new tls-alpn-01 responder. The
+// caller should call Close when finished, to shut it down.
+func NewTLSALPN01Server() *TLSALPN01Server {
+	s := &TLSALPN01Server{
+		certs: make(map[string]*tls.Certificate),
+	}
+	s.Server = httptest.NewUnstartedServer(http.NotFoundHandler())
+	s.Server.Config.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){
+		// The validation closes the connection after the handshake.
+		tlsalpn01Protocol: func(*http.Server, *tls.Conn, http.Handler) {},
+	}
+	s.Server.TLS = &tls.Config{
+		NextProtos:     []string{tlsalpn01Protocol},
+		GetCertificate: s.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	s.Server.StartTLS()
+	return s
+}
+
+// SetCertificate presents the given certificate on the handshakes for the
+// given server name. For IP identifiers the server name is the reverse DNS
+// name of the address, e.g. 1.0.0.127.in-addr.arpa.
+func (s *TLSALPN01Server) SetCertificate(serverName string, cert *tls.Certificate) {
+	s.mu.Lock()
+	s.certs[serverName] = cert
+	s.mu.Unlock()
+}
+
+// SetKeyAuthorization presents a valid tls-alpn-01 certificate for the given
+// DNS name and key authorization.
+func (s *TLSALPN01Server) SetKeyAuthorization(name, keyAuth string) error {
+	cert, err := acme.NewTLSALPNCertificate(keyAuth, name)
+	if err != nil {
+		return err
+	}
+	s.SetCertificate(name, cert)
+	return nil
+}
+
+func (s *TLSALPN01Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.certs[hello.ServerName], nil
+}
+
+// NewTLSALPN01Certificate returns the tls-alpn-01 validation certificate for
+// the given token, account key and DNS name.
+func NewTLSALPN01Certificate(token string, jwk *jose.JSONWebKey, name string) (*tls.Certificate, error) {
+	keyAuth, err := acme.KeyAuthorization(token, jwk)
+	if err != nil {
+		return nil, err
+	}
+	return acme.NewTLSALPNCertificate(keyAuth, name)
+}
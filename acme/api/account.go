@@ -7,9 +7,11 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"go.step.sm/crypto/jose"
 
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/logging"
 )
 
@@ -30,6 +32,18 @@ func validateContacts(cs []string) error {
 	return nil
 }
 
+// authorizeContacts verifies the contacts are allowed by the contact policy of
+// the provisioner.
+func authorizeContacts(ctx context.Context, prov *provisioner.ACME, contacts []string) error {
+	if err := prov.AuthorizeContacts(ctx, contacts); err != nil {
+		if errors.Is(err, provisioner.ErrACMEContactNotAllowed) {
+			return acme.WrapDetailedError(acme.ErrorInvalidContactType, err, "contact is not allowed")
+		}
+		return acme.WrapErrorISE(err, "error validating contacts")
+	}
+	return nil
+}
+
 // Validate validates a new-account request body.
 func (n *NewAccountRequest) Validate() error {
 	if n.OnlyReturnExisting && len(n.Contact) > 0 {
@@ -40,8 +54,9 @@ func (n *NewAccountRequest) Validate() error {
 
 // UpdateAccountRequest represents an update-account request.
 type UpdateAccountRequest struct {
-	Contact []string    `json:"contact"`
-	Status  acme.Status `json:"status"`
+	Contact              []string    `json:"contact"`
+	Status               acme.Status `json:"status"`
+	TermsOfServiceAgreed bool        `json:"termsOfServiceAgreed"`
 }
 
 // Validate validates a update-account request body.
@@ -119,6 +134,18 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if prov.RequireTermsOfServiceAgreement && !nar.TermsOfServiceAgreed {
+			w.Header().Add("Link", link(prov.TermsOfService, "terms-of-service"))
+			render.Error(w, acme.NewDetailedError(acme.ErrorUserActionRequiredType,
+				"the terms of service at %s must be agreed", prov.TermsOfService))
+			return
+		}
+
+		if err := authorizeContacts(ctx, prov, nar.Contact); err != nil {
+			render.Error(w, err)
+			return
+		}
+
 		jwk, err := jwkFromContext(ctx)
 		if err != nil {
 			render.Error(w, err)
@@ -132,11 +159,12 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 		}
 
 		acc = &acme.Account{
-			Key:             jwk,
-			Contact:         nar.Contact,
-			Status:          acme.StatusValid,
-			LocationPrefix:  getAccountLocationPath(ctx, linker, ""),
-			ProvisionerName: prov.GetName(),
+			Key:                  jwk,
+			Contact:              nar.Contact,
+			Status:               acme.StatusValid,
+			TermsOfServiceAgreed: nar.TermsOfServiceAgreed,
+			LocationPrefix:       getAccountLocationPath(ctx, linker, ""),
+			ProvisionerName:      prov.GetName(),
 		}
 		if err := db.CreateAccount(ctx, acc); err != nil {
 			render.Error(w, acme.WrapErrorISE(err, "error creating account"))
@@ -195,12 +223,30 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 			render.Error(w, err)
 			return
 		}
-		if len(uar.Status) > 0 || len(uar.Contact) > 0 {
+		if len(uar.Status) == 0 && len(uar.Contact) > 0 {
+			prov, err := acmeProvisionerFromContext(ctx)
+			if err != nil {
+				render.Error(w, err)
+				return
+			}
+			if err := authorizeContacts(ctx, prov, uar.Contact); err != nil {
+				render.Error(w, err)
+				return
+			}
+		}
+
+		// Accounts created before the terms of service were required can
+		// agree to them on an update.
+		agree := uar.TermsOfServiceAgreed && !acc.TermsOfServiceAgreed
+		if len(uar.Status) > 0 || len(uar.Contact) > 0 || agree {
 			if len(uar.Status) > 0 {
 				acc.Status = uar.Status
 			} else if len(uar.Contact) > 0 {
 				acc.Contact = uar.Contact
 			}
+			if agree {
+				acc.TermsOfServiceAgreed = true
+			}
 
 			if err := db.UpdateAccount(ctx, acc); err != nil {
 				render.Error(w, acme.WrapErrorISE(err, "error updating account"))
@@ -215,6 +261,140 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, acc)
 }
 
+// KeyChangeRequest represents the payload of the inner JWS of a key-change
+// request.
+type KeyChangeRequest struct {
+	Account string           `json:"account"`
+	OldKey  *jose.JSONWebKey `json:"oldKey"`
+}
+
+// KeyChange is the api for rolling over the key of an ACME account, as defined
+// in RFC 8555 section 7.3.5. The outer JWS is signed with the current account
+// key, and its payload is a JWS signed with the new key.
+func KeyChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	outer, err := jwsFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	inner, err := jose.ParseJWS(string(payload.value))
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "failed to parse inner jws"))
+		return
+	}
+	if len(inner.Signatures) != 1 {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "inner jws must contain exactly one signature"))
+		return
+	}
+	hdr := inner.Signatures[0].Protected
+	newKey := hdr.JSONWebKey
+	switch {
+	case newKey == nil:
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "jwk expected in inner jws protected header"))
+		return
+	case hdr.KeyID != "":
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "kid must not be used in inner jws protected header"))
+		return
+	case hdr.Nonce != "":
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "nonce must not be used in inner jws protected header"))
+		return
+	case !newKey.Valid():
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "invalid jwk in inner jws protected header"))
+		return
+	}
+	if err := validateJWSAlgorithm(hdr); err != nil {
+		render.Error(w, err)
+		return
+	}
+	outerHdr := outer.Signatures[0].Protected
+	if innerURL, ok := hdr.ExtraHeaders["url"].(string); !ok || innerURL != outerHdr.ExtraHeaders["url"] {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "url header in inner jws does not match outer jws"))
+		return
+	}
+
+	body, err := inner.Verify(newKey)
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "error verifying inner jws"))
+		return
+	}
+	var kcr KeyChangeRequest
+	if err := json.Unmarshal(body, &kcr); err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal key-change request payload"))
+		return
+	}
+	if kcr.Account != outerHdr.KeyID {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType,
+			"account in key-change request (%s) does not match kid (%s)", kcr.Account, outerHdr.KeyID))
+		return
+	}
+	if kcr.OldKey == nil {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty"))
+		return
+	}
+
+	oldKeyID, err := acme.KeyToID(kcr.OldKey)
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "invalid oldKey"))
+		return
+	}
+	accKeyID, err := acme.KeyToID(acc.Key)
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error getting KeyID from account key"))
+		return
+	}
+	if oldKeyID != accKeyID {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType, "oldKey does not match the account key"))
+		return
+	}
+	if newKey.KeyID, err = acme.KeyToID(newKey); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error getting KeyID from JWK"))
+		return
+	}
+
+	// The new key cannot be used by another account.
+	existing, err := db.GetAccountByKeyID(ctx, newKey.KeyID)
+	switch {
+	case acme.IsErrNotFound(err):
+		break
+	case err != nil:
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving account by key"))
+		return
+	default:
+		acmeErr := acme.NewError(acme.ErrorMalformedType, "new key is already in use by another account")
+		acmeErr.Status = http.StatusConflict
+		w.Header().Set("Location", getAccountLocationPath(ctx, linker, existing.ID))
+		render.Error(w, acmeErr)
+		return
+	}
+
+	acc.Key = newKey
+	if err := db.UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error updating account key"))
+		return
+	}
+
+	linker.LinkAccount(ctx, acc)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, acc.ID))
+	render.JSON(w, acc)
+}
+
 func logOrdersByAccount(w http.ResponseWriter, oids []string) {
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		m := map[string]interface{}{
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
@@ -38,6 +39,9 @@ type fakeProvisioner struct{}
 func (*fakeProvisioner) AuthorizeOrderIdentifier(context.Context, provisioner.ACMEIdentifier) error {
 	return nil
 }
+func (*fakeProvisioner) AuthorizeCSRKey(context.Context, crypto.PublicKey) error {
+	return nil
+}
 func (*fakeProvisioner) AuthorizeSign(context.Context, string) ([]provisioner.SignOption, error) {
 	return nil, nil
 }
@@ -52,7 +56,36 @@ func (*fakeProvisioner) AuthorizeRevoke(context.Context, string) error { return
 func (*fakeProvisioner) GetID() string                                 { return "" }
 func (*fakeProvisioner) GetName() string                               { return "" }
 func (*fakeProvisioner) DefaultTLSCertDuration() time.Duration         { return 0 }
-func (*fakeProvisioner) GetOptions() *provisioner.Options              { return nil }
+func (*fakeProvisioner) MinTLSCertDuration() time.Duration             { return 0 }
+func (*fakeProvisioner) MaxTLSCertDuration() time.Duration             { return 0 }
+func (*fakeProvisioner) GetClockSkew() time.Duration                   { return 0 }
+func (*fakeProvisioner) GetDNSPropagationWait() time.Duration          { return 0 }
+func (*fakeProvisioner) GetChallengeTokenLength() int                  { return 0 }
+func (*fakeProvisioner) GetDNSChallengePrefix() string                 { return "" }
+func (*fakeProvisioner) GetDNSChallengeName(string, string) (string, error) {
+	return "", nil
+}
+func (*fakeProvisioner) GetCAACheckIdentities() []string            { return nil }
+func (*fakeProvisioner) GetHTTP01MaxBodySize() int64                { return 0 }
+func (*fakeProvisioner) GetHTTP01ExactMatch() bool                  { return false }
+func (*fakeProvisioner) GetHTTP01Port() int                         { return 0 }
+func (*fakeProvisioner) GetTLSALPN01Protocol() string               { return "" }
+func (*fakeProvisioner) GetValidationNetwork() string               { return "" }
+func (*fakeProvisioner) GetRateLimits() *provisioner.ACMERateLimits { return nil }
+func (*fakeProvisioner) GetCompressRecords() bool                   { return false }
+func (*fakeProvisioner) GetOptions() *provisioner.Options           { return nil }
+func (*fakeProvisioner) GetDNSChallengeQuorum() provisioner.ACMEDNSQuorum {
+	return ""
+}
+func (*fakeProvisioner) GetProfile(string) (*provisioner.ACMEProfile, bool) {
+	return nil, false
+}
+func (*fakeProvisioner) GetValidationConcurrency() *provisioner.ACMEValidationConcurrency {
+	return nil
+}
+func (*fakeProvisioner) GetDNSLookupRetry() *provisioner.ACMEDNSLookupRetry {
+	return nil
+}
 
 func newProv() acme.Provisioner {
 	// Initialize provisioners
@@ -1038,3 +1071,342 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_NewAccount_termsOfService(t *testing.T) {
+	prov := newACMEProv(t)
+	prov.TermsOfService = "https://ca.smallstep.com/terms"
+	prov.RequireTermsOfServiceAgreement = true
+
+	newAccount := func(t *testing.T, nar *NewAccountRequest, db acme.DB) *http.Response {
+		b, err := json.Marshal(nar)
+		assert.FatalError(t, err)
+		jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+		assert.FatalError(t, err)
+		ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+		ctx = context.WithValue(ctx, jwkContextKey, jwk)
+		ctx = acme.NewProvisionerContext(ctx, prov)
+		ctx = acme.NewContext(ctx, db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+		req := httptest.NewRequest("POST", "/foo/bar", http.NoBody).WithContext(ctx)
+		w := httptest.NewRecorder()
+		NewAccount(w, req)
+		return w.Result()
+	}
+
+	t.Run("fail/not-agreed", func(t *testing.T) {
+		res := newAccount(t, &NewAccountRequest{Contact: []string{"foo"}}, &acme.MockDB{
+			MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+				t.Error("account should not be created")
+				return nil
+			},
+		})
+		defer res.Body.Close()
+		assert.Equals(t, 400, res.StatusCode)
+		assert.Equals(t, []string{`<https://ca.smallstep.com/terms>;rel="terms-of-service"`}, res.Header["Link"])
+		var ae acme.Error
+		assert.FatalError(t, json.NewDecoder(res.Body).Decode(&ae))
+		assert.Equals(t, "urn:ietf:params:acme:error:userActionRequired", ae.Type)
+		assert.HasSuffix(t, ae.Detail, "the terms of service at https://ca.smallstep.com/terms must be agreed")
+	})
+
+	t.Run("ok/agreed", func(t *testing.T) {
+		var created *acme.Account
+		res := newAccount(t, &NewAccountRequest{Contact: []string{"foo"}, TermsOfServiceAgreed: true}, &acme.MockDB{
+			MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+				acc.ID = "accountID"
+				created = acc
+				return nil
+			},
+		})
+		defer res.Body.Close()
+		assert.Equals(t, 201, res.StatusCode)
+		if assert.NotNil(t, created) {
+			assert.True(t, created.TermsOfServiceAgreed)
+		}
+		var acc acme.Account
+		assert.FatalError(t, json.NewDecoder(res.Body).Decode(&acc))
+		assert.True(t, acc.TermsOfServiceAgreed)
+	})
+}
+
+func TestHandler_GetOrUpdateAccount_termsOfService(t *testing.T) {
+	prov := newProv()
+	for name, agreed := range map[string]bool{"ok/agree": false, "ok/already-agreed": true} {
+		t.Run(name, func(t *testing.T) {
+			b, err := json.Marshal(&UpdateAccountRequest{TermsOfServiceAgreed: true})
+			assert.FatalError(t, err)
+			acc := &acme.Account{ID: "accountID", Status: acme.StatusValid, TermsOfServiceAgreed: agreed}
+			var updated bool
+			db := &acme.MockDB{
+				MockUpdateAccount: func(ctx context.Context, upd *acme.Account) error {
+					updated = true
+					assert.True(t, upd.TermsOfServiceAgreed)
+					return nil
+				},
+			}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			ctx = acme.NewContext(ctx, db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+			req := httptest.NewRequest("POST", "/foo/bar", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetOrUpdateAccount(w, req)
+
+			assert.Equals(t, 200, w.Code)
+			assert.Equals(t, !agreed, updated)
+			assert.True(t, acc.TermsOfServiceAgreed)
+		})
+	}
+}
+
+func TestHandler_NewAccount_contactPolicy(t *testing.T) {
+	prov := newACMEProv(t)
+	prov.ContactPolicy = &provisioner.ACMEContactPolicy{
+		Allow:      []string{`mailto:[^@]+@example\.com`},
+		MailtoOnly: true,
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	tests := []struct {
+		name       string
+		contact    []string
+		statusCode int
+		detail     string
+	}{
+		{"ok", []string{"mailto:admin@example.com", "mailto:ops@example.com"}, 201, ""},
+		{"fail/domain", []string{"mailto:admin@example.com", "mailto:admin@example.org"}, 400,
+			`contact is not allowed: acme contact is not allowed: "mailto:admin@example.org"`},
+		{"fail/scheme", []string{"tel:+12025550100"}, 400,
+			`contact is not allowed: acme contact is not allowed: "tel:+12025550100" is not a mailto contact`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(&NewAccountRequest{Contact: tt.contact})
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			db := &acme.MockDB{
+				MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+					acc.ID = "accountID"
+					assert.Equals(t, tt.contact, acc.Contact)
+					return nil
+				},
+			}
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = acme.NewContext(ctx, db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+			req := httptest.NewRequest("POST", "/foo/bar", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			NewAccount(w, req)
+
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.statusCode >= 400 {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &ae))
+				assert.Equals(t, "urn:ietf:params:acme:error:invalidContact", ae.Type)
+				assert.HasSuffix(t, ae.Detail, tt.detail)
+			}
+		})
+	}
+
+	t.Run("fail/update", func(t *testing.T) {
+		b, err := json.Marshal(&UpdateAccountRequest{Contact: []string{"mailto:admin@example.org"}})
+		assert.FatalError(t, err)
+		acc := &acme.Account{ID: "accountID", Status: acme.StatusValid, Contact: []string{"mailto:admin@example.com"}}
+		db := &acme.MockDB{
+			MockUpdateAccount: func(ctx context.Context, upd *acme.Account) error {
+				t.Error("account should not be updated")
+				return nil
+			},
+		}
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+		ctx = acme.NewContext(ctx, db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+		req := httptest.NewRequest("POST", "/foo/bar", http.NoBody).WithContext(ctx)
+		w := httptest.NewRecorder()
+		GetOrUpdateAccount(w, req)
+
+		assert.Equals(t, 400, w.Code)
+		assert.Equals(t, []string{"mailto:admin@example.com"}, acc.Contact)
+	})
+}
+
+func TestHandler_KeyChange(t *testing.T) {
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	keyChangeURL := fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), escProvName)
+	kid := fmt.Sprintf("%s/acme/%s/account/accountID", baseURL.String(), escProvName)
+
+	oldJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	otherJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	oldPub := oldJWK.Public()
+	newKeyID, err := acme.KeyToID(newJWK)
+	assert.FatalError(t, err)
+
+	// sign creates the inner JWS, signed with the new key.
+	sign := func(t *testing.T, jwk *jose.JSONWebKey, u string, v interface{}) []byte {
+		t.Helper()
+		payload, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		so := new(jose.SignerOptions)
+		so.EmbedJWK = true
+		so.WithHeader("url", u)
+		signer, err := jose.NewSigner(jose.SigningKey{
+			Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
+			Key:       jwk.Key,
+		}, so)
+		assert.FatalError(t, err)
+		jws, err := signer.Sign(payload)
+		assert.FatalError(t, err)
+		return []byte(jws.FullSerialize())
+	}
+	outer := &jose.JSONWebSignature{Signatures: []jose.Signature{{
+		Protected: jose.Header{
+			KeyID:        kid,
+			ExtraHeaders: map[jose.HeaderKey]interface{}{"url": keyChangeURL},
+		},
+	}}}
+	newContext := func(payload []byte) context.Context {
+		acc := &acme.Account{ID: "accountID", Status: acme.StatusValid, Key: &oldPub}
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		ctx = context.WithValue(ctx, jwsContextKey, outer)
+		return context.WithValue(ctx, payloadContextKey, &payloadInfo{value: payload})
+	}
+	notFoundDB := &acme.MockDB{
+		MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+			assert.Equals(t, newKeyID, kid)
+			return nil, acme.ErrNotFound
+		},
+	}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		location   string
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/parse-inner-jws": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext([]byte("foo")),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to parse inner jws"),
+			}
+		},
+		"fail/url-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(sign(t, newJWK, "https://foo.com", KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "url header in inner jws does not match outer jws"),
+			}
+		},
+		"fail/account-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(sign(t, newJWK, keyChangeURL, KeyChangeRequest{Account: "foo", OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "account in key-change request (foo) does not match kid (%s)", kid),
+			}
+		},
+		"fail/old-key-mismatch": func(t *testing.T) test {
+			otherPub := otherJWK.Public()
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(sign(t, newJWK, keyChangeURL, KeyChangeRequest{Account: kid, OldKey: &otherPub})),
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "oldKey does not match the account key"),
+			}
+		},
+		"fail/key-in-use": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return &acme.Account{ID: "otherID"}, nil
+					},
+				},
+				ctx:        newContext(sign(t, newJWK, keyChangeURL, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 409,
+				location:   fmt.Sprintf("%s/acme/%s/account/otherID", baseURL.String(), escProvName),
+				err:        acme.NewError(acme.ErrorMalformedType, "new key is already in use by another account"),
+			}
+		},
+		"fail/db.UpdateAccount-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: notFoundDB.MockGetAccountByKeyID,
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        newContext(sign(t, newJWK, keyChangeURL, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error updating account key: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: notFoundDB.MockGetAccountByKeyID,
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, "accountID", acc.ID)
+						assert.Equals(t, newKeyID, acc.Key.KeyID)
+						assert.Equals(t, newJWK.Public().Key, acc.Key.Key)
+						return nil
+					},
+				},
+				ctx:        newContext(sign(t, newJWK, keyChangeURL, KeyChangeRequest{Account: kid, OldKey: &oldPub})),
+				statusCode: 200,
+				location:   kid,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := acme.NewContext(tc.ctx, tc.db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+			req := httptest.NewRequest("POST", "/foo/bar", http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			KeyChange(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.location != "" {
+				assert.Equals(t, res.Header["Location"], []string{tc.location})
+			}
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// NewAuthzRequest represents the body for a newAuthz request.
+type NewAuthzRequest struct {
+	Identifier acme.Identifier `json:"identifier"`
+}
+
+// Validate validates a newAuthz request body.
+func (n *NewAuthzRequest) Validate() error {
+	// The identifier of a pre-authorization is the exact identifier of the
+	// authorization, so it cannot be used for wildcard domain names, see RFC
+	// 8555 section 7.4.1.
+	if strings.HasPrefix(n.Identifier.Value, "*.") {
+		return acme.NewError(acme.ErrorMalformedType, "pre-authorization cannot be used for wildcard identifiers")
+	}
+	nor := NewOrderRequest{Identifiers: []acme.Identifier{n.Identifier}}
+	return nor.Validate()
+}
+
+// NewAuthz ACME api for creating an authorization before an order, also known
+// as pre-authorization. Orders created later by the same account reuse the
+// authorization once it's valid.
+func NewAuthz(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ca := mustAuthority(ctx)
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if !acmeProv.EnablePreAuthorization {
+		render.Error(w, acme.NewError(acme.ErrorNotImplementedType,
+			"pre-authorization is not enabled for provisioner %s", acmeProv.GetName()))
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	var nar NewAuthzRequest
+	if err := json.Unmarshal(payload.value, &nar); err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal new-authz request payload"))
+		return
+	}
+	if err := nar.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	acmePolicy, err := accountPolicyEngine(ctx, db, acmeProv, acc)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if err := authorizeIdentifiers(ctx, ca, prov, acmePolicy, []acme.Identifier{nar.Identifier}); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	// The pending authorizations of an account are limited by the maximum
+	// number of identifiers of an order, so pre-authorizations cannot be used
+	// to create more authorizations than an order.
+	azs, err := db.GetAuthorizationsByAccountID(ctx, acc.ID)
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving authorizations"))
+		return
+	}
+	var pending int
+	for _, az := range azs {
+		if az.Status == acme.StatusPending {
+			pending++
+		}
+	}
+	if limit := acmeProv.GetMaxIdentifiers(); pending >= limit {
+		render.Error(w, acme.NewDetailedError(acme.ErrorRateLimitedType,
+			"account has %d pending authorizations, the maximum number of identifiers is %d", pending, limit))
+		return
+	}
+
+	// A pre-authorization counts as an order of its identifier.
+	if err := acme.CheckOrderRateLimits(ctx, prov, []acme.Identifier{nar.Identifier}); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	az := &acme.Authorization{
+		AccountID:  acc.ID,
+		Identifier: nar.Identifier,
+		ExpiresAt:  clock.Now().Add(acmeProv.GetAuthzExpiry()),
+		Status:     acme.StatusPending,
+	}
+	if err := newAuthorization(ctx, az); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	linker.LinkAuthorization(ctx, az)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+	render.JSONStatus(w, az, http.StatusCreated)
+}
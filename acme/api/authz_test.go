@@ -0,0 +1,423 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestNewAuthzRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier acme.Identifier
+		err        *acme.Error
+	}{
+		{"ok/dns", acme.Identifier{Type: "dns", Value: "example.com"}, nil},
+		{"ok/ip", acme.Identifier{Type: "ip", Value: "10.0.0.1"}, nil},
+		{"fail/wildcard", acme.Identifier{Type: "dns", Value: "*.example.com"},
+			acme.NewError(acme.ErrorMalformedType, "pre-authorization cannot be used for wildcard identifiers")},
+		{"fail/ip", acme.Identifier{Type: "ip", Value: "10.0.0"},
+			acme.NewError(acme.ErrorMalformedType, "invalid IP address: 10.0.0")},
+		{"fail/type", acme.Identifier{Type: "foo", Value: "example.com"},
+			acme.NewError(acme.ErrorMalformedType, "identifier type unsupported: foo")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nar := &NewAuthzRequest{Identifier: tt.identifier}
+			err := nar.Validate()
+			if tt.err == nil {
+				assert.FatalError(t, err)
+				return
+			}
+			var ae *acme.Error
+			if assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, ae.Type, tt.err.Type)
+				assert.Equals(t, ae.Detail, tt.err.Detail)
+			}
+		})
+	}
+}
+
+func TestHandler_NewAuthz(t *testing.T) {
+	prov := newACMEProv(t)
+	prov.EnablePreAuthorization = true
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	acc := &acme.Account{ID: "accID"}
+
+	newPayload := func(t *testing.T, id acme.Identifier) *payloadInfo {
+		b, err := json.Marshal(&NewAuthzRequest{Identifier: id})
+		assert.FatalError(t, err)
+		return &payloadInfo{value: b}
+	}
+
+	type test struct {
+		prov       *provisioner.ACME
+		ca         acme.CertificateAuthority
+		db         acme.DB
+		payload    *payloadInfo
+		statusCode int
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-enabled": func(t *testing.T) test {
+			return test{
+				prov:       newACMEProv(t),
+				db:         &acme.MockDB{},
+				payload:    newPayload(t, acme.Identifier{Type: "dns", Value: "example.com"}),
+				statusCode: 501,
+				err: acme.NewError(acme.ErrorNotImplementedType,
+					"pre-authorization is not enabled for provisioner test@acme-<test>provisioner.com"),
+			}
+		},
+		"fail/unmarshal": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				payload:    &payloadInfo{value: []byte("{")},
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to unmarshal new-authz request payload: unexpected end of JSON input"),
+			}
+		},
+		"fail/wildcard": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				payload:    newPayload(t, acme.Identifier{Type: "dns", Value: "*.example.com"}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "pre-authorization cannot be used for wildcard identifiers"),
+			}
+		},
+		"fail/not-authorized": func(t *testing.T) test {
+			return test{
+				ca: &mockCA{
+					MockAreSANsallowed: func(ctx context.Context, sans []string) error {
+						return errors.New("force")
+					},
+				},
+				db:         &acme.MockDB{},
+				payload:    newPayload(t, acme.Identifier{Type: "dns", Value: "example.com"}),
+				statusCode: 400,
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized: force").
+					AddSubproblems(acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "dns", Value: "example.com"}, "dns example.com is not authorized")),
+			}
+		},
+		"fail/db.GetAuthorizationsByAccountID-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						return nil, errors.New("force")
+					},
+				},
+				payload:    newPayload(t, acme.Identifier{Type: "dns", Value: "example.com"}),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving authorizations: force"),
+			}
+		},
+		"fail/max-identifiers": func(t *testing.T) test {
+			p := newACMEProv(t)
+			p.EnablePreAuthorization = true
+			p.MaxIdentifiers = 2
+			return test{
+				prov: p,
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, "accID", accountID)
+						return []*acme.Authorization{
+							{ID: "az1", Status: acme.StatusPending},
+							{ID: "az2", Status: acme.StatusValid},
+							{ID: "az3", Status: acme.StatusPending},
+						}, nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.FatalError(t, errors.New("authorization should not be created"))
+						return nil
+					},
+				},
+				payload:    newPayload(t, acme.Identifier{Type: "dns", Value: "example.com"}),
+				statusCode: 400,
+				err:        acme.NewDetailedError(acme.ErrorRateLimitedType, "account has 2 pending authorizations, the maximum number of identifiers is 2"),
+			}
+		},
+		"fail/db.CreateAuthorization-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = "chID"
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						return errors.New("force")
+					},
+				},
+				payload:    newPayload(t, acme.Identifier{Type: "dns", Value: "example.com"}),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error creating authorization: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			count := 0
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						return []*acme.Authorization{{ID: "az1", Status: acme.StatusPending}}, nil
+					},
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						assert.Equals(t, ch.AccountID, "accID")
+						assert.Equals(t, ch.Value, "example.com")
+						assert.Equals(t, ch.Status, acme.StatusPending)
+						count++
+						ch.ID = fmt.Sprintf("ch%d", count)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.Equals(t, az.AccountID, "accID")
+						assert.Equals(t, az.Identifier, acme.Identifier{Type: "dns", Value: "example.com"})
+						assert.Equals(t, az.Status, acme.StatusPending)
+						assert.False(t, az.Wildcard)
+						assert.Equals(t, len(az.Challenges), 3)
+						assert.True(t, az.ExpiresAt.After(clock.Now().Add(provisioner.DefaultACMEAuthzExpiry-time.Minute)))
+						az.ID = "azID"
+						return nil
+					},
+				},
+				payload:    newPayload(t, acme.Identifier{Type: "dns", Value: "example.com"}),
+				statusCode: 201,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			p := prov
+			if tc.prov != nil {
+				p = tc.prov
+			}
+			ca := tc.ca
+			if ca == nil {
+				ca = &mockCA{}
+			}
+			mockMustAuthority(t, ca)
+			ctx := acme.NewProvisionerContext(context.Background(), p)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, tc.payload)
+			ctx = newBaseContext(ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/new-authz", http.NoBody)
+			w := httptest.NewRecorder()
+			NewAuthz(w, req.WithContext(ctx))
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, ae.Subproblems, tc.err.Subproblems)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				az := new(acme.Authorization)
+				assert.FatalError(t, json.Unmarshal(body, az))
+				assert.Equals(t, az.Status, acme.StatusPending)
+				assert.Equals(t, len(az.Challenges), 3)
+				for i, ch := range az.Challenges {
+					assert.Equals(t, ch.URL, fmt.Sprintf("%s/acme/%s/challenge/azID/ch%d", baseURL, escProvName, i+1))
+				}
+				assert.Equals(t, res.Header["Location"], []string{fmt.Sprintf("%s/acme/%s/authz/azID", baseURL, escProvName)})
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
+
+func TestHandler_NewAuthz_rateLimited(t *testing.T) {
+	prov := newACMEProv(t)
+	prov.EnablePreAuthorization = true
+	prov.RateLimits = &provisioner.ACMERateLimits{OrdersPerIdentifier: 1}
+
+	db := &acme.MockDB{
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			ch.ID = "chID"
+			return nil
+		},
+		MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			az.ID = "azID"
+			return nil
+		},
+		MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+			o.ID = "ordID"
+			return nil
+		},
+	}
+	now := time.Now()
+	limiter := acme.NewRateLimiter(rateLimitStore{}, func() time.Time { return now })
+
+	do := func(h http.HandlerFunc, payload any) *http.Response {
+		b, err := json.Marshal(payload)
+		assert.FatalError(t, err)
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+		ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+		mockMustAuthority(t, &mockCA{})
+		ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+		ctx = acme.NewRateLimiterContext(ctx, limiter)
+		req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/new-authz", http.NoBody)
+		w := httptest.NewRecorder()
+		h(w, req.WithContext(ctx))
+		return w.Result()
+	}
+	identifier := acme.Identifier{Type: "dns", Value: "example.com"}
+
+	res := do(NewAuthz, &NewAuthzRequest{Identifier: identifier})
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+
+	// The pre-authorization counts as an order of the identifier.
+	assertRateLimited := func(res *http.Response) {
+		t.Helper()
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.FatalError(t, err)
+		assert.Equals(t, 400, res.StatusCode)
+		var ae acme.Error
+		assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+		assert.Equals(t, acme.NewError(acme.ErrorRateLimitedType, "").Type, ae.Type)
+	}
+	assertRateLimited(do(NewAuthz, &NewAuthzRequest{Identifier: identifier}))
+	assertRateLimited(do(NewOrder, &NewOrderRequest{Identifiers: []acme.Identifier{identifier}}))
+
+	// The limit resets after the window.
+	now = now.Add(time.Hour)
+	res = do(NewAuthz, &NewAuthzRequest{Identifier: identifier})
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+}
+
+func TestHandler_NewOrder_preAuthorized(t *testing.T) {
+	// The global claims must be complete to sign the certificate.
+	disableSmallstepExtensions := false
+	claims := globalProvisionerClaims
+	claims.DisableSmallstepExtensions = &disableSmallstepExtensions
+	prov := &provisioner.ACME{Type: "ACME", Name: "acme", EnablePreAuthorization: true}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: claims}))
+
+	now := clock.Now()
+	preAuthz := &acme.Authorization{
+		ID:         "preAzID",
+		AccountID:  "accID",
+		Identifier: acme.Identifier{Type: "dns", Value: "example.acme.com"},
+		Status:     acme.StatusValid,
+		ExpiresAt:  now.Add(time.Hour),
+	}
+
+	var stored *acme.Order
+	db := &acme.MockDB{
+		MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+			assert.Equals(t, accountID, "accID")
+			return []*acme.Authorization{
+				{ID: "pendingID", Identifier: preAuthz.Identifier, Status: acme.StatusPending, ExpiresAt: now.Add(2 * time.Hour)},
+				{ID: "expiredID", Identifier: preAuthz.Identifier, Status: acme.StatusValid, ExpiresAt: now.Add(-time.Hour)},
+				{ID: "wildcardID", Identifier: preAuthz.Identifier, Status: acme.StatusValid, Wildcard: true, ExpiresAt: now.Add(2 * time.Hour)},
+				preAuthz,
+			}, nil
+		},
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			return errors.New("unexpected challenge")
+		},
+		MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			return errors.New("unexpected authorization")
+		},
+		MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+			o.ID = "ordID"
+			stored = o
+			return nil
+		},
+		MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+			assert.Equals(t, id, "ordID")
+			return stored, nil
+		},
+		MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+			assert.Equals(t, id, "preAzID")
+			return preAuthz, nil
+		},
+		MockUpdateOrder: func(ctx context.Context, o *acme.Order) error {
+			return nil
+		},
+		MockCreateCertificate: func(ctx context.Context, cert *acme.Certificate) error {
+			cert.ID = "certID"
+			return nil
+		},
+	}
+
+	// The order reuses the pre-authorization.
+	b, err := json.Marshal(&NewOrderRequest{Identifiers: []acme.Identifier{preAuthz.Identifier}})
+	assert.FatalError(t, err)
+	mockMustAuthority(t, &mockCA{})
+	ctx := acme.NewProvisionerContext(context.Background(), prov)
+	ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+	ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+	req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/new-order", http.NoBody)
+	w := httptest.NewRecorder()
+	NewOrder(w, req.WithContext(context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})))
+	res := w.Result()
+	res.Body.Close()
+	assert.Equals(t, res.StatusCode, 201)
+	if assert.NotNil(t, stored) {
+		assert.Equals(t, stored.AuthorizationIDs, []string{"preAzID"})
+		assert.Equals(t, stored.ExpiresAt, preAuthz.ExpiresAt)
+		assert.Equals(t, stored.Status, acme.StatusPending)
+	}
+
+	// The order can be finalized without validating a new authorization.
+	_csr, err := pemutil.Read("../../authority/testdata/certs/foo.csr")
+	assert.FatalError(t, err)
+	csr, ok := _csr.(*x509.CertificateRequest)
+	assert.Fatal(t, ok)
+	b, err = json.Marshal(&FinalizeRequest{CSR: base64.RawURLEncoding.EncodeToString(csr.Raw)})
+	assert.FatalError(t, err)
+
+	mockMustAuthority(t, &mockCA{
+		MockSignWithContext: func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			assert.Equals(t, cr.DNSNames, []string{"example.acme.com"})
+			return []*x509.Certificate{{DNSNames: cr.DNSNames}}, nil
+		},
+	})
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("ordID", "ordID")
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+	req = httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/order/ordID/finalize", http.NoBody)
+	w = httptest.NewRecorder()
+	FinalizeOrder(w, req.WithContext(context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})))
+	res = w.Result()
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, res.StatusCode, 200)
+
+	o := new(acme.Order)
+	assert.FatalError(t, json.Unmarshal(body, o))
+	assert.Equals(t, o.Status, acme.StatusValid)
+	assert.Equals(t, o.CertificateURL, "https://test.ca.smallstep.com/acme/acme/certificate/certID")
+}
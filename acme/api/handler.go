@@ -2,11 +2,16 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -162,9 +167,11 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 	r.MethodFunc("POST", getPath(acme.AccountLinkType, "{provisionerID}", "{accID}"),
 		extractPayloadByKid(GetOrUpdateAccount))
 	r.MethodFunc("POST", getPath(acme.KeyChangeLinkType, "{provisionerID}", "{accID}"),
-		extractPayloadByKid(NotImplemented))
+		extractPayloadByKid(KeyChange))
 	r.MethodFunc("POST", getPath(acme.NewOrderLinkType, "{provisionerID}"),
 		extractPayloadByKid(NewOrder))
+	r.MethodFunc("POST", getPath(acme.NewAuthzLinkType, "{provisionerID}"),
+		extractPayloadByKid(NewAuthz))
 	r.MethodFunc("POST", getPath(acme.OrderLinkType, "{provisionerID}", "{ordID}"),
 		extractPayloadByKid(isPostAsGet(GetOrder)))
 	r.MethodFunc("POST", getPath(acme.OrdersByAccountLinkType, "{provisionerID}", "{accID}"),
@@ -177,6 +184,8 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 		extractPayloadByKid(GetChallenge))
 	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}"),
 		extractPayloadByKid(isPostAsGet(GetCertificate)))
+	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}")+"/{chain}",
+		extractPayloadByKid(isPostAsGet(GetCertificate)))
 	r.MethodFunc("POST", getPath(acme.RevokeCertLinkType, "{provisionerID}"),
 		extractPayloadByKidOrJWK(RevokeCert))
 }
@@ -192,10 +201,11 @@ func GetNonce(w http.ResponseWriter, r *http.Request) {
 }
 
 type Meta struct {
-	TermsOfService          string   `json:"termsOfService,omitempty"`
-	Website                 string   `json:"website,omitempty"`
-	CaaIdentities           []string `json:"caaIdentities,omitempty"`
-	ExternalAccountRequired bool     `json:"externalAccountRequired,omitempty"`
+	TermsOfService          string            `json:"termsOfService,omitempty"`
+	Website                 string            `json:"website,omitempty"`
+	CaaIdentities           []string          `json:"caaIdentities,omitempty"`
+	ExternalAccountRequired bool              `json:"externalAccountRequired,omitempty"`
+	Profiles                map[string]string `json:"profiles,omitempty"`
 }
 
 // Directory represents an ACME directory for configuring clients.
@@ -203,6 +213,7 @@ type Directory struct {
 	NewNonce   string `json:"newNonce"`
 	NewAccount string `json:"newAccount"`
 	NewOrder   string `json:"newOrder"`
+	NewAuthz   string `json:"newAuthz,omitempty"`
 	RevokeCert string `json:"revokeCert"`
 	KeyChange  string `json:"keyChange"`
 	Meta       *Meta  `json:"meta,omitempty"`
@@ -229,14 +240,68 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 
 	linker := acme.MustLinkerFromContext(ctx)
 
-	render.JSON(w, &Directory{
+	dir := &Directory{
 		NewNonce:   linker.GetLink(ctx, acme.NewNonceLinkType),
 		NewAccount: linker.GetLink(ctx, acme.NewAccountLinkType),
 		NewOrder:   linker.GetLink(ctx, acme.NewOrderLinkType),
 		RevokeCert: linker.GetLink(ctx, acme.RevokeCertLinkType),
 		KeyChange:  linker.GetLink(ctx, acme.KeyChangeLinkType),
 		Meta:       createMetaObject(acmeProv),
-	})
+	}
+	// The newAuthz resource is only advertised if pre-authorization is
+	// enabled, see RFC 8555 section 7.4.1.
+	if acmeProv.EnablePreAuthorization {
+		dir.NewAuthz = linker.GetLink(ctx, acme.NewAuthzLinkType)
+	}
+
+	// Clients can revalidate the directory with If-None-Match.
+	etag, err := directoryETag(dir, acmeProv)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	render.JSON(w, dir)
+}
+
+// directoryETag returns a strong ETag for the directory. Besides the contents
+// of the directory, it covers the challenges and attestation formats enabled in
+// the provisioner, so clients fetch it again when the capabilities change. The
+// JSON encoding sorts the maps, so the ETag is the same for the same
+// configuration.
+func directoryETag(dir *Directory, p *provisioner.ACME) (string, error) {
+	challenges := slices.Clone(p.Challenges)
+	slices.Sort(challenges)
+	attestationFormats := slices.Clone(p.AttestationFormats)
+	slices.Sort(attestationFormats)
+
+	b, err := json.Marshal(struct {
+		Directory          *Directory                          `json:"directory"`
+		Challenges         []provisioner.ACMEChallenge         `json:"challenges"`
+		AttestationFormats []provisioner.ACMEAttestationFormat `json:"attestationFormats"`
+	}{dir, challenges, attestationFormats})
+	if err != nil {
+		return "", acme.WrapErrorISE(err, "error marshaling directory")
+	}
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches returns true if the If-None-Match header matches the ETag. It
+// uses the weak comparison, see RFC 9110 section 13.1.2.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // createMetaObject creates a Meta object if the ACME provisioner
@@ -244,11 +309,19 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 // It returns nil if none of the properties are set.
 func createMetaObject(p *provisioner.ACME) *Meta {
 	if shouldAddMetaObject(p) {
+		var profiles map[string]string
+		if len(p.Profiles) > 0 {
+			profiles = make(map[string]string, len(p.Profiles))
+			for _, profile := range p.Profiles {
+				profiles[profile.Name] = profile.Description
+			}
+		}
 		return &Meta{
 			TermsOfService:          p.TermsOfService,
 			Website:                 p.Website,
 			CaaIdentities:           p.CaaIdentities,
 			ExternalAccountRequired: p.RequireEAB,
+			Profiles:                profiles,
 		}
 	}
 	return nil
@@ -266,6 +339,8 @@ func shouldAddMetaObject(p *provisioner.ACME) bool {
 		return true
 	case p.RequireEAB:
 		return true
+	case len(p.Profiles) > 0:
+		return true
 	default:
 		return false
 	}
@@ -357,6 +432,8 @@ func GetChallenge(w http.ResponseWriter, r *http.Request) {
 
 	linker.LinkChallenge(ctx, ch, azID)
 
+	// Clients should poll processing challenges.
+	render.SetRetryAfter(w, ch.RetryAfter(ctx))
 	w.Header().Add("Link", link(linker.GetLink(ctx, acme.AuthzLinkType, azID), "up"))
 	w.Header().Set("Location", linker.GetLink(ctx, acme.ChallengeLinkType, azID, ch.ID))
 	render.JSON(w, ch)
@@ -385,8 +462,34 @@ func GetCertificate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The provisioner may offer alternate chains, available appending their
+	// index to the certificate URL.
+	chains := [][]*x509.Certificate{append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...)}
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err == nil {
+		chains = acmeProv.GetCertificateChains(cert.Leaf, cert.Intermediates)
+		setRenewAfter(w, acmeProv, cert.Leaf)
+	}
+	index := 0
+	if s := chi.URLParam(r, "chain"); s != "" {
+		if index, err = strconv.Atoi(s); err != nil || index < 1 || index >= len(chains) {
+			render.Error(w, acme.NewError(acme.ErrorMalformedType,
+				"certificate '%s' does not have an alternate chain %s", certID, s))
+			return
+		}
+	}
+
+	if len(chains) > 1 {
+		linker := acme.MustLinkerFromContext(ctx)
+		for i := range chains {
+			if i != index {
+				w.Header().Add("Link", link(certificateChainLink(ctx, linker, certID, i), "alternate"))
+			}
+		}
+	}
+
 	var certBytes []byte
-	for _, c := range append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...) {
+	for _, c := range chains[index] {
 		certBytes = append(certBytes, pem.EncodeToMemory(&pem.Block{
 			Type:  "CERTIFICATE",
 			Bytes: c.Raw,
@@ -397,3 +500,22 @@ func GetCertificate(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/pem-certificate-chain")
 	w.Write(certBytes)
 }
+
+// certificateChainLink returns the URL of the chain of a certificate with the
+// given index, the primary chain has the index 0.
+func certificateChainLink(ctx context.Context, linker acme.Linker, certID string, index int) string {
+	u := linker.GetLink(ctx, acme.CertificateLinkType, certID)
+	if index > 0 {
+		u += "/" + strconv.Itoa(index)
+	}
+	return u
+}
+
+// setRenewAfter sets the Renew-After header with the time after which the
+// certificate should be renewed, if the provisioner has a renewal hint. The
+// header is not Retry-After, which is used by ACME to poll for resources.
+func setRenewAfter(w http.ResponseWriter, p *provisioner.ACME, cert *x509.Certificate) {
+	if t, ok := p.GetRenewAfter(cert); ok {
+		w.Header().Set("Renew-After", t.UTC().Format(http.TimeFormat))
+	}
+}
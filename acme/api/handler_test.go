@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,6 +21,7 @@ import (
 	"github.com/pkg/errors"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
 
 	"github.com/smallstep/assert"
@@ -28,14 +30,28 @@ import (
 )
 
 type mockClient struct {
-	get       func(url string) (*http.Response, error)
-	lookupTxt func(name string) ([]string, error)
-	tlsDial   func(network, addr string, config *tls.Config) (*tls.Conn, error)
+	get         func(url string) (*http.Response, error)
+	lookupTxt   func(name string) ([]string, error)
+	lookupCAA   func(name string) ([]acme.CAARecord, error)
+	lookupNS    func(name string) ([]string, error)
+	lookupTxtOn func(server, name string) ([]string, error)
+	tlsDial     func(network, addr string, config *tls.Config) (*tls.Conn, error)
 }
 
-func (m *mockClient) Get(u string) (*http.Response, error)    { return m.get(u) }
-func (m *mockClient) LookupTxt(name string) ([]string, error) { return m.lookupTxt(name) }
-func (m *mockClient) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
+func (m *mockClient) Get(_ context.Context, u string) (*http.Response, error) { return m.get(u) }
+func (m *mockClient) LookupTxt(_ context.Context, name string) ([]string, error) {
+	return m.lookupTxt(name)
+}
+func (m *mockClient) LookupCAA(_ context.Context, name string) ([]acme.CAARecord, error) {
+	return m.lookupCAA(name)
+}
+func (m *mockClient) LookupNS(_ context.Context, name string) ([]string, error) {
+	return m.lookupNS(name)
+}
+func (m *mockClient) LookupTxtOn(_ context.Context, server, name string) ([]string, error) {
+	return m.lookupTxtOn(server, name)
+}
+func (m *mockClient) TLSDial(_ context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 	return m.tlsDial(network, addr, config)
 }
 
@@ -142,6 +158,26 @@ func TestHandler_GetDirectory(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/pre-authorization": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.EnablePreAuthorization = true
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				NewAuthz:   fmt.Sprintf("%s/acme/%s/new-authz", baseURL.String(), provName),
+				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
 		"ok/full-meta": func(t *testing.T) test {
 			prov := newACMEProv(t)
 			prov.TermsOfService = "https://terms.ca.local/"
@@ -170,6 +206,34 @@ func TestHandler_GetDirectory(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/profiles": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.Profiles = []*provisioner.ACMEProfile{
+				{Name: "mtls", Description: "Short-lived mTLS certificates"},
+				{Name: "server"},
+			}
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				Meta: &Meta{
+					Profiles: map[string]string{
+						"mtls":   "Short-lived mTLS certificates",
+						"server": "",
+					},
+				},
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -207,6 +271,58 @@ func TestHandler_GetDirectory(t *testing.T) {
 	}
 }
 
+func TestHandler_GetDirectory_etag(t *testing.T) {
+	getDirectory := func(t *testing.T, prov *provisioner.ACME, ifNoneMatch string) *http.Response {
+		t.Helper()
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = acme.NewLinkerContext(ctx, acme.NewLinker("test.ca.smallstep.com", "acme"))
+		req := httptest.NewRequest("GET", "/foo/bar", http.NoBody)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		GetDirectory(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	res := getDirectory(t, newACMEProv(t), "")
+	assert.Equals(t, http.StatusOK, res.StatusCode)
+	etag := res.Header.Get("ETag")
+	assert.True(t, len(etag) > 2 && strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`))
+
+	// The same configuration returns the same ETag.
+	assert.Equals(t, etag, getDirectory(t, newACMEProv(t), "").Header.Get("ETag"))
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		res := getDirectory(t, newACMEProv(t), ifNoneMatch)
+		assert.Equals(t, http.StatusNotModified, res.StatusCode)
+		assert.Equals(t, etag, res.Header.Get("ETag"))
+		body, err := io.ReadAll(res.Body)
+		assert.FatalError(t, err)
+		assert.Len(t, 0, body)
+	}
+	assert.Equals(t, http.StatusOK, getDirectory(t, newACMEProv(t), `"other"`).StatusCode)
+
+	// The ETag changes with the advertised capabilities.
+	eab := newACMEProv(t)
+	eab.RequireEAB = true
+	challenges := newACMEProv(t)
+	challenges.Challenges = []provisioner.ACMEChallenge{provisioner.DNS_01}
+	attestation := newACMEProv(t)
+	attestation.AttestationFormats = []provisioner.ACMEAttestationFormat{provisioner.APPLE}
+	for _, prov := range []*provisioner.ACME{eab, challenges, attestation} {
+		res := getDirectory(t, prov, etag)
+		assert.Equals(t, http.StatusOK, res.StatusCode)
+		assert.NotEquals(t, etag, res.Header.Get("ETag"))
+	}
+
+	// The order of the challenges does not change the ETag.
+	p1, p2 := newACMEProv(t), newACMEProv(t)
+	p1.Challenges = []provisioner.ACMEChallenge{provisioner.HTTP_01, provisioner.DNS_01}
+	p2.Challenges = []provisioner.ACMEChallenge{provisioner.DNS_01, provisioner.HTTP_01}
+	assert.Equals(t, getDirectory(t, p1, "").Header.Get("ETag"), getDirectory(t, p2, "").Header.Get("ETag"))
+}
+
 func TestHandler_GetAuthorization(t *testing.T) {
 	expiry := time.Now().UTC().Add(6 * time.Hour)
 	az := acme.Authorization{
@@ -517,6 +633,135 @@ func TestHandler_GetCertificate(t *testing.T) {
 	}
 }
 
+func TestHandler_GetCertificate_renewalHint(t *testing.T) {
+	leaf, err := pemutil.ReadCertificate("../../authority/testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("certID", "certID")
+	db := &acme.MockDB{
+		MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+			return &acme.Certificate{ID: id, AccountID: "accID", Leaf: leaf}, nil
+		},
+	}
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+
+	for name, tc := range map[string]struct {
+		hint float64
+		want string
+	}{
+		"disabled": {0, ""},
+		"half":     {0.5, leaf.NotBefore.Add(lifetime / 2).UTC().Format(http.TimeFormat)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			prov := &provisioner.ACME{Type: "ACME", Name: "acme", RenewalHint: tc.hint}
+			assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewDatabaseContext(ctx, db)
+
+			req := httptest.NewRequest("GET", "https://test.ca.smallstep.com/acme/acme/certificate/certID", http.NoBody)
+			w := httptest.NewRecorder()
+			GetCertificate(w, req.WithContext(ctx))
+			res := w.Result()
+			res.Body.Close()
+
+			assert.Equals(t, 200, res.StatusCode)
+			assert.Equals(t, tc.want, res.Header.Get("Renew-After"))
+		})
+	}
+}
+
+func TestHandler_GetCertificate_alternateChains(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	other, err := minica.New()
+	assert.FatalError(t, err)
+
+	// The intermediate cross-signed by the other CA.
+	cross, err := other.Sign(&x509.Certificate{
+		Subject:               ca.Intermediate.Subject,
+		PublicKey:             ca.Intermediate.PublicKey,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+	assert.FatalError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{DNSNames: []string{"example.com"}, PublicKey: ca.Signer.Public()})
+	assert.FatalError(t, err)
+
+	encode := func(certs ...*x509.Certificate) []byte {
+		var b []byte
+		for _, c := range certs {
+			b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+		return b
+	}
+
+	prov := &provisioner.ACME{
+		Type:            "ACME",
+		Name:            "acme",
+		AlternateChains: [][]byte{encode(cross, other.Intermediate)},
+		IncludeRoot:     true,
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{
+		Claims:              globalProvisionerClaims,
+		X509IssuerPublicKey: ca.Intermediate.PublicKey,
+		X509Roots:           []*x509.Certificate{ca.Root},
+	}))
+	db := &acme.MockDB{
+		MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+			return &acme.Certificate{ID: id, AccountID: "accID", Leaf: leaf, Intermediates: []*x509.Certificate{ca.Intermediate}}, nil
+		},
+	}
+	linker := acme.NewLinker("test.ca.smallstep.com", "acme")
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	primaryURL := fmt.Sprintf("%s/acme/%s/certificate/certID", baseURL, prov.GetName())
+
+	getCertificate := func(chain string) *http.Response {
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("certID", "certID")
+		if chain != "" {
+			chiCtx.URLParams.Add("chain", chain)
+		}
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+		ctx = acme.NewDatabaseContext(ctx, db)
+		ctx = acme.NewLinkerContext(ctx, linker)
+		req := httptest.NewRequest("GET", primaryURL, http.NoBody)
+		w := httptest.NewRecorder()
+		GetCertificate(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	// The primary chain includes the root and links to the alternate one.
+	res := getCertificate("")
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, 200, res.StatusCode)
+	assert.Equals(t, encode(leaf, ca.Intermediate, ca.Root), body)
+	assert.Equals(t, []string{fmt.Sprintf("<%s/1>;rel=\"alternate\"", primaryURL)}, res.Header["Link"])
+
+	// The alternate chain is issued by another root, and links to the primary
+	// one.
+	res = getCertificate("1")
+	body, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, 200, res.StatusCode)
+	assert.Equals(t, encode(leaf, cross, other.Intermediate), body)
+	assert.Equals(t, []string{fmt.Sprintf("<%s>;rel=\"alternate\"", primaryURL)}, res.Header["Link"])
+
+	for _, chain := range []string{"0", "2", "foo"} {
+		res = getCertificate(chain)
+		res.Body.Close()
+		assert.Equals(t, 400, res.StatusCode)
+	}
+}
+
 func TestHandler_GetChallenge(t *testing.T) {
 	chiCtx := chi.NewRouteContext()
 	chiCtx.URLParams.Add("chID", "chID")
@@ -30,11 +30,28 @@ func logNonce(w http.ResponseWriter, nonce string) {
 	}
 }
 
+// newNonce creates a nonce using the nonce store in the context, or the
+// database if there is none.
+func newNonce(ctx context.Context) (acme.Nonce, error) {
+	if s, ok := acme.NonceStoreFromContext(ctx); ok {
+		return s.New(ctx)
+	}
+	return acme.MustDatabaseFromContext(ctx).CreateNonce(ctx)
+}
+
+// consumeNonce consumes a nonce using the nonce store in the context, or the
+// database if there is none.
+func consumeNonce(ctx context.Context, nonce acme.Nonce) error {
+	if s, ok := acme.NonceStoreFromContext(ctx); ok {
+		return s.Consume(ctx, nonce)
+	}
+	return acme.MustDatabaseFromContext(ctx).DeleteNonce(ctx, nonce)
+}
+
 // addNonce is a middleware that adds a nonce to the response header.
 func addNonce(next nextHTTP) nextHTTP {
 	return func(w http.ResponseWriter, r *http.Request) {
-		db := acme.MustDatabaseFromContext(r.Context())
-		nonce, err := db.CreateNonce(r.Context())
+		nonce, err := newNonce(r.Context())
 		if err != nil {
 			render.Error(w, err)
 			return
@@ -129,7 +146,6 @@ func parseJWS(next nextHTTP) nextHTTP {
 func validateJWS(next nextHTTP) nextHTTP {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
-		db := acme.MustDatabaseFromContext(ctx)
 
 		jws, err := jwsFromContext(ctx)
 		if err != nil {
@@ -156,32 +172,13 @@ func validateJWS(next nextHTTP) nextHTTP {
 			return
 		}
 		hdr := sig.Protected
-		switch hdr.Algorithm {
-		case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
-			if hdr.JSONWebKey != nil {
-				switch k := hdr.JSONWebKey.Key.(type) {
-				case *rsa.PublicKey:
-					if k.Size() < keyutil.MinRSAKeyBytes {
-						render.Error(w, acme.NewError(acme.ErrorMalformedType,
-							"rsa keys must be at least %d bits (%d bytes) in size",
-							8*keyutil.MinRSAKeyBytes, keyutil.MinRSAKeyBytes))
-						return
-					}
-				default:
-					render.Error(w, acme.NewError(acme.ErrorMalformedType,
-						"jws key type and algorithm do not match"))
-					return
-				}
-			}
-		case jose.ES256, jose.ES384, jose.ES512, jose.EdDSA:
-			// we good
-		default:
-			render.Error(w, acme.NewError(acme.ErrorBadSignatureAlgorithmType, "unsuitable algorithm: %s", hdr.Algorithm))
+		if err := validateJWSAlgorithm(hdr); err != nil {
+			render.Error(w, err)
 			return
 		}
 
 		// Check the validity/freshness of the Nonce.
-		if err := db.DeleteNonce(ctx, acme.Nonce(hdr.Nonce)); err != nil {
+		if err := consumeNonce(ctx, acme.Nonce(hdr.Nonce)); err != nil {
 			render.Error(w, err)
 			return
 		}
@@ -211,6 +208,32 @@ func validateJWS(next nextHTTP) nextHTTP {
 	}
 }
 
+// validateJWSAlgorithm checks that the algorithm in the JWS header is
+// supported, and that it matches the JWK in the header, if any.
+func validateJWSAlgorithm(hdr jose.Header) error {
+	switch hdr.Algorithm {
+	case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
+		if hdr.JSONWebKey != nil {
+			switch k := hdr.JSONWebKey.Key.(type) {
+			case *rsa.PublicKey:
+				if k.Size() < keyutil.MinRSAKeyBytes {
+					return acme.NewError(acme.ErrorMalformedType,
+						"rsa keys must be at least %d bits (%d bytes) in size",
+						8*keyutil.MinRSAKeyBytes, keyutil.MinRSAKeyBytes)
+				}
+			default:
+				return acme.NewError(acme.ErrorMalformedType,
+					"jws key type and algorithm do not match")
+			}
+		}
+	case jose.ES256, jose.ES384, jose.ES512, jose.EdDSA:
+		// we good
+	default:
+		return acme.NewError(acme.ErrorBadSignatureAlgorithmType, "unsuitable algorithm: %s", hdr.Algorithm)
+	}
+	return nil
+}
+
 // extractJWK is a middleware that extracts the JWK from the JWS and saves it
 // in the context. Make sure to parse and validate the JWS before running this
 // middleware.
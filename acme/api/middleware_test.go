@@ -105,6 +105,35 @@ func TestHandler_addNonce(t *testing.T) {
 	}
 }
 
+func TestHandler_nonceStore(t *testing.T) {
+	// The database is not used if there is a nonce store.
+	db := &acme.MockDB{
+		MockCreateNonce: func(ctx context.Context) (acme.Nonce, error) {
+			return "", acme.NewErrorISE("force")
+		},
+		MockDeleteNonce: func(ctx context.Context, nonce acme.Nonce) error {
+			return acme.NewErrorISE("force")
+		},
+	}
+	store := acme.NewMemoryNonceStore(0, 0, nil)
+	ctx := acme.NewNonceStoreContext(newBaseContext(context.Background(), db), store)
+
+	req := httptest.NewRequest("GET", "https://ca.smallstep.com/acme/new-nonce", http.NoBody).WithContext(ctx)
+	w := httptest.NewRecorder()
+	addNonce(testNext)(w, req)
+	res := w.Result()
+	res.Body.Close()
+	assert.Equals(t, res.StatusCode, 200)
+	nonce := res.Header.Get("Replay-Nonce")
+	assert.Equals(t, store.Len(), 1)
+
+	assert.FatalError(t, consumeNonce(ctx, acme.Nonce(nonce)))
+	var ae *acme.Error
+	if err := consumeNonce(ctx, acme.Nonce(nonce)); assert.True(t, errors.As(err, &ae)) {
+		assert.Equals(t, ae.Type, acme.NewError(acme.ErrorBadNonceType, "").Type)
+	}
+}
+
 func TestHandler_addDirLink(t *testing.T) {
 	prov := newProv()
 	provName := url.PathEscape(prov.GetName())
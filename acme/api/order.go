@@ -12,7 +12,6 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
-	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/acme"
@@ -26,6 +25,7 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	Profile     string            `json:"profile,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -87,7 +87,6 @@ func (f *FinalizeRequest) Validate() error {
 	return nil
 }
 
-var defaultOrderExpiry = time.Hour * 24
 var defaultOrderBackdate = time.Minute
 
 // NewOrder ACME api for creating a new order.
@@ -134,37 +133,37 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var eak *acme.ExternalAccountKey
-	if acmeProv.RequireEAB {
-		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID); err != nil {
-			render.Error(w, acme.WrapErrorISE(err, "error retrieving external account binding key"))
-			return
-		}
+	if n, limit := len(nor.Identifiers), acmeProv.GetMaxIdentifiers(); n > limit {
+		render.Error(w, acme.NewDetailedError(acme.ErrorMalformedType,
+			"order has %d identifiers, the maximum number of identifiers is %d", n, limit))
+		return
 	}
 
-	acmePolicy, err := newACMEPolicyEngine(eak)
+	acmePolicy, err := accountPolicyEngine(ctx, db, acmeProv, acc)
 	if err != nil {
-		render.Error(w, acme.WrapErrorISE(err, "error creating ACME policy engine"))
+		render.Error(w, err)
 		return
 	}
 
-	for _, identifier := range nor.Identifiers {
-		// evaluate the ACME account level policy
-		if err = isIdentifierAllowed(acmePolicy, identifier); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
-		}
-		// evaluate the provisioner level policy
-		orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
-		if err = prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
-		}
-		// evaluate the authority level policy
-		if err = ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
+	if err := authorizeIdentifiers(ctx, ca, prov, acmePolicy, nor.Identifiers); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	if err := acme.CheckOrderRateLimits(ctx, prov, nor.Identifiers); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	// The durations of the profile are used if one is requested.
+	defaultDuration, minDuration, maxDuration := prov.DefaultTLSCertDuration(), prov.MinTLSCertDuration(), prov.MaxTLSCertDuration()
+	if nor.Profile != "" {
+		profile, ok := prov.GetProfile(nor.Profile)
+		if !ok {
+			render.Error(w, acme.NewDetailedError(acme.ErrorMalformedType, "profile %s is not supported", nor.Profile))
 			return
 		}
+		defaultDuration, minDuration, maxDuration = profile.DefaultTLSCertDuration(), profile.MinTLSCertDuration(), profile.MaxTLSCertDuration()
 	}
 
 	now := clock.Now()
@@ -174,17 +173,66 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		ProvisionerID:    prov.GetID(),
 		Status:           acme.StatusPending,
 		Identifiers:      nor.Identifiers,
-		ExpiresAt:        now.Add(defaultOrderExpiry),
+		ExpiresAt:        now.Add(acmeProv.GetOrderExpiry()),
 		AuthorizationIDs: make([]string, len(nor.Identifiers)),
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
+		Profile:          nor.Profile,
+	}
+
+	if o.NotBefore.IsZero() {
+		o.NotBefore = now
+	}
+	if o.NotAfter.IsZero() {
+		o.NotAfter = o.NotBefore.Add(defaultDuration)
+	}
+	if !o.NotAfter.After(o.NotBefore) {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType,
+			"notAfter must be after notBefore; notBefore=%s, notAfter=%s",
+			o.NotBefore.Format(time.RFC3339), o.NotAfter.Format(time.RFC3339)))
+		return
+	}
+	// Clamp the requested validity to the durations allowed by the
+	// provisioner, so the order can always be finalized.
+	if d := o.NotAfter.Sub(o.NotBefore); d > maxDuration {
+		o.NotAfter = o.NotBefore.Add(maxDuration)
+	} else if d < minDuration {
+		o.NotAfter = o.NotBefore.Add(minDuration)
+	}
+	// If request NotBefore was empty then backdate the order.NotBefore (now)
+	// to avoid timing issues.
+	if nor.NotBefore.IsZero() {
+		o.NotBefore = o.NotBefore.Add(-defaultOrderBackdate)
+	}
+
+	// With pre-authorization enabled, the valid authorizations of the account
+	// are reused.
+	var preAuthorized map[acme.Identifier]*acme.Authorization
+	if acmeProv.EnablePreAuthorization {
+		if preAuthorized, err = validAuthorizations(ctx, db, acc.ID); err != nil {
+			render.Error(w, err)
+			return
+		}
 	}
 
+	// The order expires at the latest with its first authorization, either
+	// reused or new.
+	azExpiresAt := now.Add(acmeProv.GetAuthzExpiry())
 	for i, identifier := range o.Identifiers {
+		if az, ok := preAuthorized[identifier]; ok {
+			o.AuthorizationIDs[i] = az.ID
+			if az.ExpiresAt.Before(o.ExpiresAt) {
+				o.ExpiresAt = az.ExpiresAt
+			}
+			continue
+		}
+		if azExpiresAt.Before(o.ExpiresAt) {
+			o.ExpiresAt = azExpiresAt
+		}
 		az := &acme.Authorization{
 			AccountID:  acc.ID,
 			Identifier: identifier,
-			ExpiresAt:  o.ExpiresAt,
+			ExpiresAt:  azExpiresAt,
 			Status:     acme.StatusPending,
 		}
 		if err := newAuthorization(ctx, az); err != nil {
@@ -194,18 +242,6 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		o.AuthorizationIDs[i] = az.ID
 	}
 
-	if o.NotBefore.IsZero() {
-		o.NotBefore = now
-	}
-	if o.NotAfter.IsZero() {
-		o.NotAfter = o.NotBefore.Add(prov.DefaultTLSCertDuration())
-	}
-	// If request NotBefore was empty then backdate the order.NotBefore (now)
-	// to avoid timing issues.
-	if nor.NotBefore.IsZero() {
-		o.NotBefore = o.NotBefore.Add(-defaultOrderBackdate)
-	}
-
 	if err := db.CreateOrder(ctx, o); err != nil {
 		render.Error(w, acme.WrapErrorISE(err, "error creating order"))
 		return
@@ -217,6 +253,82 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 	render.JSONStatus(w, o, http.StatusCreated)
 }
 
+// authorizeIdentifiers evaluates the ACME account, provisioner and authority
+// policies for each identifier. If some identifiers are not allowed, it
+// returns a rejectedIdentifier error with a subproblem for each one of them.
+func authorizeIdentifiers(ctx context.Context, ca acme.CertificateAuthority, prov acme.Provisioner, acmePolicy policy.X509Policy, identifiers []acme.Identifier) error {
+	var (
+		reasons     []string
+		subproblems []acme.Subproblem
+	)
+	for _, identifier := range identifiers {
+		// evaluate the ACME account level policy
+		err := isIdentifierAllowed(acmePolicy, identifier)
+		if err == nil {
+			// evaluate the provisioner level policy
+			orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
+			err = prov.AuthorizeOrderIdentifier(ctx, orderIdentifier)
+		}
+		if err == nil {
+			// evaluate the authority level policy
+			err = ca.AreSANsAllowed(ctx, []string{identifier.Value})
+		}
+		if err != nil {
+			reasons = append(reasons, err.Error())
+			subproblems = append(subproblems, acme.NewSubproblemWithIdentifier(
+				acme.ErrorRejectedIdentifierType, identifier, "%s %s is not authorized", identifier.Type, identifier.Value))
+		}
+	}
+	if len(subproblems) == 0 {
+		return nil
+	}
+	return acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized: %s", strings.Join(reasons, "; ")).
+		AddSubproblems(subproblems...)
+}
+
+// accountPolicyEngine returns the policy engine of the external account key
+// bound to the account. It returns nil if the provisioner does not require
+// external account binding.
+func accountPolicyEngine(ctx context.Context, db acme.DB, acmeProv *provisioner.ACME, acc *acme.Account) (policy.X509Policy, error) {
+	if !acmeProv.RequireEAB {
+		return nil, nil
+	}
+	eak, err := db.GetExternalAccountKeyByAccountID(ctx, acmeProv.GetID(), acc.ID)
+	if err != nil {
+		return nil, acme.WrapErrorISE(err, "error retrieving external account binding key")
+	}
+	acmePolicy, err := newACMEPolicyEngine(eak)
+	if err != nil {
+		return nil, acme.WrapErrorISE(err, "error creating ACME policy engine")
+	}
+	return acmePolicy, nil
+}
+
+// validAuthorizations returns the valid and unexpired authorizations of an
+// account by the identifier they authorize. Wildcard authorizations use the
+// wildcard identifier of the order.
+func validAuthorizations(ctx context.Context, db acme.DB, accID string) (map[acme.Identifier]*acme.Authorization, error) {
+	azs, err := db.GetAuthorizationsByAccountID(ctx, accID)
+	if err != nil {
+		return nil, acme.WrapErrorISE(err, "error retrieving authorizations")
+	}
+	now := clock.Now()
+	valid := make(map[acme.Identifier]*acme.Authorization)
+	for _, az := range azs {
+		if az.Status != acme.StatusValid || !az.ExpiresAt.After(now) {
+			continue
+		}
+		identifier := az.Identifier
+		if az.Wildcard {
+			identifier.Value = "*." + identifier.Value
+		}
+		if v, ok := valid[identifier]; !ok || az.ExpiresAt.After(v.ExpiresAt) {
+			valid[identifier] = az
+		}
+	}
+	return valid, nil
+}
+
 func isIdentifierAllowed(acmePolicy policy.X509Policy, identifier acme.Identifier) error {
 	if acmePolicy == nil {
 		return nil
@@ -239,29 +351,38 @@ func trimIfWildcard(value string) (string, bool) {
 }
 
 func newAuthorization(ctx context.Context, az *acme.Authorization) error {
-	value, isWildcard := trimIfWildcard(az.Identifier.Value)
+	identifier := az.Identifier.Value
+	value, isWildcard := trimIfWildcard(identifier)
 	az.Wildcard = isWildcard
 	az.Identifier = acme.Identifier{
 		Value: value,
 		Type:  az.Identifier.Type,
 	}
 
-	chTypes := challengeTypes(az)
+	// Only the challenges enabled in the provisioner are offered. Wildcard
+	// identifiers can only use DNS-01, so they are rejected if it's not
+	// enabled.
+	db := acme.MustDatabaseFromContext(ctx)
+	prov := acme.MustProvisionerFromContext(ctx)
+	var chTypes []acme.ChallengeType
+	for _, typ := range challengeTypes(az) {
+		if prov.IsChallengeEnabled(ctx, provisioner.ACMEChallenge(typ)) {
+			chTypes = append(chTypes, typ)
+		}
+	}
+	if len(chTypes) == 0 {
+		return acme.NewDetailedError(acme.ErrorUnsupportedIdentifierType,
+			"identifier %s cannot be validated with the challenges enabled in the provisioner", identifier)
+	}
 
 	var err error
-	az.Token, err = randutil.Alphanumeric(32)
+	az.Token, err = acme.NewChallengeToken(ctx)
 	if err != nil {
-		return acme.WrapErrorISE(err, "error generating random alphanumeric ID")
+		return acme.WrapErrorISE(err, "error generating challenge token")
 	}
 
-	db := acme.MustDatabaseFromContext(ctx)
-	prov := acme.MustProvisionerFromContext(ctx)
 	az.Challenges = make([]*acme.Challenge, 0, len(chTypes))
 	for _, typ := range chTypes {
-		if !prov.IsChallengeEnabled(ctx, provisioner.ACMEChallenge(typ)) {
-			continue
-		}
-
 		ch := &acme.Challenge{
 			AccountID: az.AccountID,
 			Value:     az.Identifier.Value,
@@ -377,6 +498,15 @@ func FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if acmeProv, err := acmeProvisionerFromContext(ctx); err == nil && acmeProv.RenewalHint > 0 && o.CertificateID != "" {
+		cert, err := db.GetCertificate(ctx, o.CertificateID)
+		if err != nil {
+			render.Error(w, acme.WrapErrorISE(err, "error retrieving certificate"))
+			return
+		}
+		setRenewAfter(w, acmeProv, cert.Leaf)
+	}
+
 	linker.LinkOrder(ctx, o)
 
 	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
@@ -684,7 +684,7 @@ func TestHandler_newAuthorization(t *testing.T) {
 				az: az,
 			}
 		},
-		"ok/permanent-identifier-disabled": func(t *testing.T) test {
+		"fail/permanent-identifier-disabled": func(t *testing.T) test {
 			az := &acme.Authorization{
 				AccountID: "accID",
 				Identifier: acme.Identifier{
@@ -702,12 +702,66 @@ func TestHandler_newAuthorization(t *testing.T) {
 						return nil
 					},
 					MockCreateAuthorization: func(ctx context.Context, _az *acme.Authorization) error {
-						assert.Equals(t, _az.AccountID, az.AccountID)
-						assert.Equals(t, _az.Token, az.Token)
-						assert.Equals(t, _az.Status, acme.StatusPending)
-						assert.Equals(t, _az.Identifier, az.Identifier)
-						assert.Equals(t, _az.ExpiresAt, az.ExpiresAt)
-						assert.Equals(t, _az.Challenges, []*acme.Challenge{})
+						t.Errorf("createAuthorization should not be called")
+						return nil
+					},
+				},
+				az:  az,
+				err: acme.NewDetailedError(acme.ErrorUnsupportedIdentifierType, "identifier 7b53aa19-26f7-4fac-824f-7a781de0dab0 cannot be validated with the challenges enabled in the provisioner"),
+			}
+		},
+		"fail/wildcard-dns-disabled": func(t *testing.T) test {
+			az := &acme.Authorization{
+				AccountID: "accID",
+				Identifier: acme.Identifier{
+					Type:  "dns",
+					Value: "*.zap.internal",
+				},
+				Status:    acme.StatusPending,
+				ExpiresAt: clock.Now(),
+			}
+			httpProv := newProv()
+			httpProv.(*provisioner.ACME).Challenges = []provisioner.ACMEChallenge{provisioner.HTTP_01, provisioner.TLS_ALPN_01}
+			return test{
+				prov: httpProv,
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						t.Errorf("createChallenge should not be called")
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, _az *acme.Authorization) error {
+						t.Errorf("createAuthorization should not be called")
+						return nil
+					},
+				},
+				az:  az,
+				err: acme.NewDetailedError(acme.ErrorUnsupportedIdentifierType, "identifier *.zap.internal cannot be validated with the challenges enabled in the provisioner"),
+			}
+		},
+		"ok/dns-only": func(t *testing.T) test {
+			az := &acme.Authorization{
+				AccountID: "accID",
+				Identifier: acme.Identifier{
+					Type:  "dns",
+					Value: "zap.internal",
+				},
+				Status:    acme.StatusPending,
+				ExpiresAt: clock.Now(),
+			}
+			var ch1 *acme.Challenge
+			dnsProv := newProv()
+			dnsProv.(*provisioner.ACME).Challenges = []provisioner.ACMEChallenge{provisioner.DNS_01}
+			return test{
+				prov: dnsProv,
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = "dns"
+						assert.Equals(t, ch.Type, acme.DNS01)
+						ch1 = ch
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, _az *acme.Authorization) error {
+						assert.Equals(t, _az.Challenges, []*acme.Challenge{ch1})
 						assert.Equals(t, _az.Wildcard, false)
 						return nil
 					},
@@ -1015,7 +1069,9 @@ func TestHandler_NewOrder(t *testing.T) {
 						}, nil
 					},
 				},
-				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType, acme.Identifier{Type: "dns", Value: "zap.internal"}, "dns zap.internal is not authorized"),
+				),
 			}
 		},
 		"fail/prov.AuthorizeOrderIdentifier-error": func(t *testing.T) test {
@@ -1058,7 +1114,9 @@ func TestHandler_NewOrder(t *testing.T) {
 						}, nil
 					},
 				},
-				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType, acme.Identifier{Type: "dns", Value: "zap.internal"}, "dns zap.internal is not authorized"),
+				),
 			}
 		},
 		"fail/ca.AreSANsAllowed-error": func(t *testing.T) test {
@@ -1105,7 +1163,9 @@ func TestHandler_NewOrder(t *testing.T) {
 						}, nil
 					},
 				},
-				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType, acme.Identifier{Type: "dns", Value: "zap.internal"}, "dns zap.internal is not authorized"),
+				),
 			}
 		},
 		"fail/error-h.newAuthorization": func(t *testing.T) test {
@@ -1318,7 +1378,7 @@ func TestHandler_NewOrder(t *testing.T) {
 				vr: func(t *testing.T, o *acme.Order) {
 					now := clock.Now()
 					testBufferDur := 5 * time.Second
-					orderExpiry := now.Add(defaultOrderExpiry)
+					orderExpiry := now.Add(provisioner.DefaultACMEOrderExpiry)
 					expNbf := now.Add(-defaultOrderBackdate)
 					expNaf := now.Add(prov.DefaultTLSCertDuration())
 
@@ -1415,7 +1475,7 @@ func TestHandler_NewOrder(t *testing.T) {
 				vr: func(t *testing.T, o *acme.Order) {
 					now := clock.Now()
 					testBufferDur := 5 * time.Second
-					orderExpiry := now.Add(defaultOrderExpiry)
+					orderExpiry := now.Add(provisioner.DefaultACMEOrderExpiry)
 					expNbf := now.Add(-defaultOrderBackdate)
 					expNaf := now.Add(prov.DefaultTLSCertDuration())
 
@@ -1512,7 +1572,7 @@ func TestHandler_NewOrder(t *testing.T) {
 				vr: func(t *testing.T, o *acme.Order) {
 					now := clock.Now()
 					testBufferDur := 5 * time.Second
-					orderExpiry := now.Add(defaultOrderExpiry)
+					orderExpiry := now.Add(provisioner.DefaultACMEOrderExpiry)
 					expNaf := expNbf.Add(prov.DefaultTLSCertDuration())
 
 					assert.Equals(t, o.ID, "ordID")
@@ -1607,7 +1667,7 @@ func TestHandler_NewOrder(t *testing.T) {
 				},
 				vr: func(t *testing.T, o *acme.Order) {
 					testBufferDur := 5 * time.Second
-					orderExpiry := now.Add(defaultOrderExpiry)
+					orderExpiry := now.Add(provisioner.DefaultACMEOrderExpiry)
 					expNbf := now.Add(-defaultOrderBackdate)
 
 					assert.Equals(t, o.ID, "ordID")
@@ -1704,7 +1764,7 @@ func TestHandler_NewOrder(t *testing.T) {
 				},
 				vr: func(t *testing.T, o *acme.Order) {
 					testBufferDur := 5 * time.Second
-					orderExpiry := now.Add(defaultOrderExpiry)
+					orderExpiry := now.Add(provisioner.DefaultACMEOrderExpiry)
 
 					assert.Equals(t, o.ID, "ordID")
 					assert.Equals(t, o.Status, acme.StatusPending)
@@ -1719,6 +1779,86 @@ func TestHandler_NewOrder(t *testing.T) {
 				},
 			}
 		},
+		"ok/naf-nbf-clamped": func(t *testing.T) test {
+			now := clock.Now()
+			expNbf := now.Add(5 * time.Minute)
+			expNaf := expNbf.Add(24 * time.Hour)
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+				NotBefore: expNbf,
+				NotAfter:  expNbf.Add(7 * 24 * time.Hour),
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = string(ch.Type)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "az1ID"
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.NotBefore, nor.NotBefore)
+						assert.Equals(t, o.NotAfter, nor.NotBefore.Add(prov.MaxTLSCertDuration()))
+						return nil
+					},
+					MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+						return nil, nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					testBufferDur := 5 * time.Second
+
+					assert.Equals(t, o.ID, "ordID")
+					assert.True(t, o.NotBefore.Add(-testBufferDur).Before(expNbf))
+					assert.True(t, o.NotBefore.Add(testBufferDur).After(expNbf))
+					assert.True(t, o.NotAfter.Add(-testBufferDur).Before(expNaf))
+					assert.True(t, o.NotAfter.Add(testBufferDur).After(expNaf))
+				},
+			}
+		},
+		"fail/naf-before-nbf": func(t *testing.T) test {
+			now := clock.Now()
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+				NotBefore: now.Add(time.Hour),
+				NotAfter:  now.Add(time.Hour),
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+						return nil, nil
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "notAfter must be after notBefore; notBefore=%s, notAfter=%s",
+					nor.NotBefore.Format(time.RFC3339), nor.NotAfter.Format(time.RFC3339)),
+			}
+		},
 		"ok/default-naf-nbf-with-policy": func(t *testing.T) test {
 			options := &provisioner.Options{
 				X509: &provisioner.X509Options{
@@ -1805,7 +1945,7 @@ func TestHandler_NewOrder(t *testing.T) {
 				vr: func(t *testing.T, o *acme.Order) {
 					now := clock.Now()
 					testBufferDur := 5 * time.Second
-					orderExpiry := now.Add(defaultOrderExpiry)
+					orderExpiry := now.Add(provisioner.DefaultACMEOrderExpiry)
 					expNbf := now.Add(-defaultOrderBackdate)
 					expNaf := now.Add(prov.DefaultTLSCertDuration())
 
@@ -1862,6 +2002,433 @@ func TestHandler_NewOrder(t *testing.T) {
 	}
 }
 
+func TestHandler_NewOrder_provisionerPolicy(t *testing.T) {
+	newProv := func(ipRanges ...string) *provisioner.ACME {
+		return newACMEProvWithOptions(t, &provisioner.Options{
+			X509: &provisioner.X509Options{
+				AllowedNames: &policy.X509NameOptions{
+					DNSDomains: []string{"*.dev.example.com"},
+					IPRanges:   ipRanges,
+				},
+				AllowWildcardNames: true,
+			},
+		})
+	}
+	db := &acme.MockDB{
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			ch.ID = "chID"
+			return nil
+		},
+		MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			az.ID = "azID"
+			return nil
+		},
+		MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+			o.ID = "ordID"
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name        string
+		prov        *provisioner.ACME
+		identifiers []acme.Identifier
+		statusCode  int
+	}{
+		{"ok/wildcard", newProv(), []acme.Identifier{{Type: "dns", Value: "*.dev.example.com"}}, 201},
+		{"ok/subdomain", newProv(), []acme.Identifier{{Type: "dns", Value: "foo.dev.example.com"}}, 201},
+		{"ok/ip-allowed", newProv("10.0.0.0/8"), []acme.Identifier{{Type: "dns", Value: "*.dev.example.com"}, {Type: "ip", Value: "10.0.0.1"}}, 201},
+		{"fail/apex", newProv(), []acme.Identifier{{Type: "dns", Value: "dev.example.com"}}, 400},
+		{"fail/other-domain", newProv(), []acme.Identifier{{Type: "dns", Value: "foo.example.com"}}, 400},
+		{"fail/ip-not-allowed", newProv(), []acme.Identifier{{Type: "dns", Value: "*.dev.example.com"}, {Type: "ip", Value: "10.0.0.1"}}, 400},
+		{"fail/ip-out-of-range", newProv("10.0.0.0/8"), []acme.Identifier{{Type: "ip", Value: "192.168.0.1"}}, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(&NewOrderRequest{Identifiers: tt.identifiers})
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), tt.prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			mockMustAuthority(t, &mockCA{})
+			ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("GET", "https://test.ca.smallstep.com/acme/order/ordID", http.NoBody)
+			w := httptest.NewRecorder()
+			NewOrder(w, req.WithContext(ctx))
+			res := w.Result()
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			assert.Equals(t, res.StatusCode, tt.statusCode)
+			if tt.statusCode >= 400 {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equals(t, ae.Type, acme.NewError(acme.ErrorRejectedIdentifierType, "").Type)
+			}
+		})
+	}
+}
+
+func TestHandler_NewOrder_subproblems(t *testing.T) {
+	prov := newACMEProvWithOptions(t, &provisioner.Options{
+		X509: &provisioner.X509Options{
+			AllowedNames: &policy.X509NameOptions{
+				DNSDomains: []string{"*.internal"},
+			},
+		},
+	})
+	b, err := json.Marshal(&NewOrderRequest{Identifiers: []acme.Identifier{
+		{Type: "dns", Value: "zap.internal"},
+		{Type: "dns", Value: "zap.example.com"},
+		{Type: "ip", Value: "10.0.0.1"},
+	}})
+	assert.FatalError(t, err)
+	ctx := acme.NewProvisionerContext(context.Background(), prov)
+	ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+	ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+	mockMustAuthority(t, &mockCA{})
+	ctx = newBaseContext(ctx, &acme.MockDB{}, acme.NewLinker("test.ca.smallstep.com", "acme"))
+	req := httptest.NewRequest("GET", "https://test.ca.smallstep.com/acme/order/ordID", http.NoBody)
+	w := httptest.NewRecorder()
+	NewOrder(w, req.WithContext(ctx))
+	res := w.Result()
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, res.StatusCode, 400)
+
+	// Only the rejected identifiers are included in the subproblems.
+	ae, err := acme.ParseError(bytes.TrimSpace(body))
+	assert.FatalError(t, err)
+	assert.Equals(t, ae.Type, "urn:ietf:params:acme:error:rejectedIdentifier")
+	assert.Equals(t, ae.Status, 400)
+	assert.Equals(t, ae.Subproblems, []acme.Subproblem{
+		{
+			Type:       "urn:ietf:params:acme:error:rejectedIdentifier",
+			Detail:     "dns zap.example.com is not authorized",
+			Identifier: &acme.Identifier{Type: "dns", Value: "zap.example.com"},
+		},
+		{
+			Type:       "urn:ietf:params:acme:error:rejectedIdentifier",
+			Detail:     "ip 10.0.0.1 is not authorized",
+			Identifier: &acme.Identifier{Type: "ip", Value: "10.0.0.1"},
+		},
+	})
+}
+
+func TestHandler_NewOrder_profile(t *testing.T) {
+	prov := &provisioner.ACME{
+		Type: "ACME",
+		Name: "acme",
+		Profiles: []*provisioner.ACMEProfile{
+			{Name: "mtls", Claims: &provisioner.Claims{DefaultTLSDur: &provisioner.Duration{Duration: 5 * time.Minute}}},
+			{Name: "server", Claims: &provisioner.Claims{
+				DefaultTLSDur: &provisioner.Duration{Duration: 90 * 24 * time.Hour},
+				MaxTLSDur:     &provisioner.Duration{Duration: 90 * 24 * time.Hour},
+			}},
+		},
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	var stored *acme.Order
+	db := &acme.MockDB{
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			ch.ID = "chID"
+			return nil
+		},
+		MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			az.ID = "azID"
+			return nil
+		},
+		MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+			o.ID = "ordID"
+			stored = o
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		profile    string
+		duration   time.Duration
+		statusCode int
+	}{
+		{"ok/default", "", 24 * time.Hour, 201},
+		{"ok/mtls", "mtls", 5 * time.Minute, 201},
+		{"ok/server", "server", 90 * 24 * time.Hour, 201},
+		{"fail/unknown", "unknown", 0, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored = nil
+			b, err := json.Marshal(&NewOrderRequest{
+				Identifiers: []acme.Identifier{{Type: "dns", Value: "example.com"}},
+				Profile:     tt.profile,
+			})
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			mockMustAuthority(t, &mockCA{})
+			ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("GET", "https://test.ca.smallstep.com/acme/order/ordID", http.NoBody)
+			w := httptest.NewRecorder()
+			NewOrder(w, req.WithContext(ctx))
+			res := w.Result()
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			assert.Equals(t, res.StatusCode, tt.statusCode)
+			if tt.statusCode >= 400 {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				assert.Equals(t, ae.Type, acme.NewError(acme.ErrorMalformedType, "").Type)
+				assert.Equals(t, ae.Detail, "The request message was malformed: profile unknown is not supported")
+				assert.Nil(t, stored)
+				return
+			}
+			var o acme.Order
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &o))
+			assert.Equals(t, tt.profile, o.Profile)
+			assert.Equals(t, tt.profile, stored.Profile)
+			// The order is backdated, the validity starts at request time.
+			assert.Equals(t, tt.duration, o.NotAfter.Sub(o.NotBefore.Add(defaultOrderBackdate)))
+		})
+	}
+}
+
+// rateLimitStore is an in-memory implementation of acme.RateLimitStore.
+type rateLimitStore map[string]acme.RateLimitCounter
+
+func (s rateLimitStore) GetRateLimitCounter(_ context.Context, key string) (*acme.RateLimitCounter, error) {
+	if c, ok := s[key]; ok {
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (s rateLimitStore) UpdateRateLimitCounter(_ context.Context, key string, _, nu *acme.RateLimitCounter) (bool, error) {
+	s[key] = *nu
+	return true, nil
+}
+
+func TestHandler_NewOrder_rateLimited(t *testing.T) {
+	prov := &provisioner.ACME{
+		Type:       "ACME",
+		Name:       "acme",
+		RateLimits: &provisioner.ACMERateLimits{OrdersPerIdentifier: 1},
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	db := &acme.MockDB{
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			ch.ID = "chID"
+			return nil
+		},
+		MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			az.ID = "azID"
+			return nil
+		},
+		MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+			o.ID = "ordID"
+			return nil
+		},
+	}
+	now := time.Now()
+	limiter := acme.NewRateLimiter(rateLimitStore{}, func() time.Time { return now })
+
+	newOrder := func() *http.Response {
+		b, err := json.Marshal(&NewOrderRequest{
+			Identifiers: []acme.Identifier{{Type: "dns", Value: "example.com"}},
+		})
+		assert.FatalError(t, err)
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+		ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+		mockMustAuthority(t, &mockCA{})
+		ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+		ctx = acme.NewRateLimiterContext(ctx, limiter)
+		req := httptest.NewRequest("GET", "https://test.ca.smallstep.com/acme/order/ordID", http.NoBody)
+		w := httptest.NewRecorder()
+		NewOrder(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	res := newOrder()
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+
+	res = newOrder()
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, 400, res.StatusCode)
+	assert.Equals(t, "3600", res.Header.Get("Retry-After"))
+	var ae acme.Error
+	assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+	assert.Equals(t, acme.NewError(acme.ErrorRateLimitedType, "").Type, ae.Type)
+
+	// The limit resets after the window.
+	now = now.Add(time.Hour)
+	res = newOrder()
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+}
+
+func TestHandler_NewOrder_maxIdentifiers(t *testing.T) {
+	prov := &provisioner.ACME{
+		Type:           "ACME",
+		Name:           "acme",
+		MaxIdentifiers: 3,
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	var authzs int
+	db := &acme.MockDB{
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			ch.ID = "chID"
+			return nil
+		},
+		MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+			authzs++
+			az.ID = fmt.Sprintf("azID%d", authzs)
+			return nil
+		},
+		MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+			o.ID = "ordID"
+			return nil
+		},
+	}
+
+	newOrder := func(n int) *http.Response {
+		nor := &NewOrderRequest{}
+		for i := 0; i < n; i++ {
+			nor.Identifiers = append(nor.Identifiers, acme.Identifier{Type: "dns", Value: fmt.Sprintf("host%d.example.com", i)})
+		}
+		b, err := json.Marshal(nor)
+		assert.FatalError(t, err)
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+		ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+		mockMustAuthority(t, &mockCA{})
+		ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+		req := httptest.NewRequest("GET", "https://test.ca.smallstep.com/acme/order/ordID", http.NoBody)
+		w := httptest.NewRecorder()
+		NewOrder(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	// An order with exactly the maximum number of identifiers is created.
+	res := newOrder(3)
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+	assert.Equals(t, 3, authzs)
+
+	// One more identifier is rejected before creating the authorizations.
+	authzs = 0
+	res = newOrder(4)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, 400, res.StatusCode)
+	assert.Equals(t, 0, authzs)
+	var ae acme.Error
+	assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+	assert.Equals(t, acme.NewError(acme.ErrorMalformedType, "").Type, ae.Type)
+	assert.Equals(t, "The request message was malformed: order has 4 identifiers, the maximum number of identifiers is 3", ae.Detail)
+
+	// The default maximum.
+	prov = &provisioner.ACME{Type: "ACME", Name: "acme"}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+	res = newOrder(provisioner.DefaultACMEMaxIdentifiers + 1)
+	res.Body.Close()
+	assert.Equals(t, 400, res.StatusCode)
+}
+
+func TestHandler_NewOrder_expiry(t *testing.T) {
+	prov := &provisioner.ACME{
+		Type:        "ACME",
+		Name:        "acme",
+		OrderExpiry: &provisioner.Duration{Duration: 8 * time.Hour},
+		AuthzExpiry: &provisioner.Duration{Duration: 4 * time.Hour},
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	var az *acme.Authorization
+	var o *acme.Order
+	db := &acme.MockDB{
+		MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			ch.ID = "chID"
+			return nil
+		},
+		MockCreateAuthorization: func(ctx context.Context, _az *acme.Authorization) error {
+			_az.ID = "azID"
+			az = _az
+			return nil
+		},
+		MockCreateOrder: func(ctx context.Context, _o *acme.Order) error {
+			_o.ID = "ordID"
+			o = _o
+			return nil
+		},
+	}
+
+	newOrder := func() *http.Response {
+		b, err := json.Marshal(&NewOrderRequest{
+			Identifiers: []acme.Identifier{{Type: "dns", Value: "example.com"}},
+		})
+		assert.FatalError(t, err)
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+		ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+		mockMustAuthority(t, &mockCA{})
+		ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+		req := httptest.NewRequest("GET", "https://test.ca.smallstep.com/acme/order/ordID", http.NoBody)
+		w := httptest.NewRecorder()
+		NewOrder(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	// The order expires with its authorization.
+	now := clock.Now()
+	res := newOrder()
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+	assert.True(t, az.ExpiresAt.Sub(now.Add(4*time.Hour)).Abs() < time.Minute)
+	assert.Equals(t, az.ExpiresAt, o.ExpiresAt)
+
+	// The order expiry is used if it's shorter.
+	prov.OrderExpiry = &provisioner.Duration{Duration: time.Hour}
+	res = newOrder()
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+	assert.True(t, az.ExpiresAt.Sub(now.Add(4*time.Hour)).Abs() < time.Minute)
+	assert.True(t, o.ExpiresAt.Sub(now.Add(time.Hour)).Abs() < time.Minute)
+
+	// The order expires with a reused authorization.
+	prov.OrderExpiry = &provisioner.Duration{Duration: 8 * time.Hour}
+	prov.EnablePreAuthorization = true
+	preAuthz := &acme.Authorization{
+		ID:         "preAzID",
+		AccountID:  "accID",
+		Identifier: acme.Identifier{Type: "dns", Value: "example.com"},
+		Status:     acme.StatusValid,
+		ExpiresAt:  now.Add(2 * time.Hour),
+	}
+	db.MockGetAuthorizationsByAccountID = func(ctx context.Context, accID string) ([]*acme.Authorization, error) {
+		return []*acme.Authorization{preAuthz}, nil
+	}
+	az = nil
+	res = newOrder()
+	res.Body.Close()
+	assert.Equals(t, 201, res.StatusCode)
+	assert.Nil(t, az)
+	assert.Equals(t, []string{"preAzID"}, o.AuthorizationIDs)
+	assert.Equals(t, preAuthz.ExpiresAt, o.ExpiresAt)
+}
+
 func TestHandler_FinalizeOrder(t *testing.T) {
 	mockMustAuthority(t, &mockCA{})
 	prov := newProv()
@@ -2160,6 +2727,57 @@ func TestHandler_FinalizeOrder(t *testing.T) {
 	}
 }
 
+func TestHandler_FinalizeOrder_renewalHint(t *testing.T) {
+	mockMustAuthority(t, &mockCA{})
+	prov := &provisioner.ACME{Type: "ACME", Name: "acme", RenewalHint: 0.75}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	nbf := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	leaf := &x509.Certificate{NotBefore: nbf, NotAfter: nbf.Add(24 * time.Hour)}
+
+	_csr, err := pemutil.Read("../../authority/testdata/certs/foo.csr")
+	assert.FatalError(t, err)
+	csr, ok := _csr.(*x509.CertificateRequest)
+	assert.Fatal(t, ok)
+	payloadBytes, err := json.Marshal(&FinalizeRequest{
+		CSR: base64.RawURLEncoding.EncodeToString(csr.Raw),
+	})
+	assert.FatalError(t, err)
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("ordID", "orderID")
+	ctx := acme.NewProvisionerContext(context.Background(), prov)
+	ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accountID"})
+	ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: payloadBytes})
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+	ctx = newBaseContext(ctx, &acme.MockDB{
+		MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+			return &acme.Order{
+				ID:            "orderID",
+				AccountID:     "accountID",
+				ProvisionerID: prov.GetID(),
+				Status:        acme.StatusValid,
+				ExpiresAt:     nbf.Add(24 * time.Hour),
+				CertificateID: "certID",
+			}, nil
+		},
+		MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+			assert.Equals(t, "certID", id)
+			return &acme.Certificate{ID: id, AccountID: "accountID", Leaf: leaf}, nil
+		},
+	}, acme.NewLinker("test.ca.smallstep.com", "acme"))
+
+	req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/acme/order/orderID/finalize", http.NoBody)
+	w := httptest.NewRecorder()
+	FinalizeOrder(w, req.WithContext(ctx))
+	res := w.Result()
+	res.Body.Close()
+
+	assert.Equals(t, 200, res.StatusCode)
+	assert.Equals(t, "Mon, 01 Jan 2024 18:00:00 GMT", res.Header.Get("Renew-After"))
+	assert.Equals(t, "", res.Header.Get("Retry-After"))
+}
+
 func TestHandler_challengeTypes(t *testing.T) {
 	type args struct {
 		az *acme.Authorization
@@ -276,12 +276,16 @@ func jwsFinal(_ crypto.Hash, sig []byte, phead, payload string) ([]byte, error)
 }
 
 type mockCA struct {
-	MockIsRevoked      func(sn string) (bool, error)
-	MockRevoke         func(ctx context.Context, opts *authority.RevokeOptions) error
-	MockAreSANsallowed func(ctx context.Context, sans []string) error
+	MockIsRevoked       func(sn string) (bool, error)
+	MockRevoke          func(ctx context.Context, opts *authority.RevokeOptions) error
+	MockAreSANsallowed  func(ctx context.Context, sans []string) error
+	MockSignWithContext func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 }
 
-func (m *mockCA) SignWithContext(context.Context, *x509.CertificateRequest, provisioner.SignOptions, ...provisioner.SignOption) ([]*x509.Certificate, error) {
+func (m *mockCA) SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if m.MockSignWithContext != nil {
+		return m.MockSignWithContext(ctx, cr, opts, extraOpts...)
+	}
 	return nil, nil
 }
 
@@ -39,22 +39,26 @@ func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
 		return nil
 	case StatusValid:
 		return nil
+	case StatusDeactivated, StatusRevoked:
+		return nil
 	case StatusPending:
-		// check expiry
-		if now.After(az.ExpiresAt) {
-			az.Status = StatusInvalid
-			break
-		}
-
-		var isValid = false
+		var validChallenge *Challenge
 		for _, ch := range az.Challenges {
 			if ch.Status == StatusValid {
-				isValid = true
+				validChallenge = ch
 				break
 			}
 		}
 
-		if !isValid {
+		// check expiry, a challenge validated before the authorization
+		// expired keeps it valid.
+		expiresAt := az.ExpiresAt.Add(clockSkewFromContext(ctx))
+		if now.After(expiresAt) && !validChallenge.validatedBefore(expiresAt) {
+			az.Status = StatusInvalid
+			break
+		}
+
+		if validChallenge == nil {
 			return nil
 		}
 		az.Status = StatusValid
@@ -68,3 +72,38 @@ func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
 	}
 	return nil
 }
+
+// Deactivate sets the status of the authorization and its challenges to the
+// given status, that must be StatusDeactivated or StatusRevoked. Orders using
+// the authorization cannot be finalized afterwards. Setting the status the
+// authorization already has is a no-op.
+func (az *Authorization) Deactivate(ctx context.Context, db DB, status Status) error {
+	switch status {
+	case StatusDeactivated, StatusRevoked:
+	default:
+		return NewError(ErrorMalformedType, "cannot set authorization status to %s", status)
+	}
+	if az.Status == status {
+		return nil
+	}
+
+	var changed []*Challenge
+	for _, ch := range az.Challenges {
+		if ch.Status == status {
+			continue
+		}
+		ch.Status = status
+		changed = append(changed, ch)
+	}
+	if len(changed) > 0 {
+		if err := db.UpdateChallenges(ctx, changed); err != nil {
+			return WrapErrorISE(err, "error updating challenges")
+		}
+	}
+
+	az.Status = status
+	if err := db.UpdateAuthorization(ctx, az); err != nil {
+		return WrapErrorISE(err, "error updating authorization")
+	}
+	return nil
+}
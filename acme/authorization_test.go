@@ -62,6 +62,63 @@ func TestAuthorization_UpdateStatus(t *testing.T) {
 				},
 			}
 		},
+		"ok/expired-within-clock-skew": func(t *testing.T) test {
+			now := clock.Now()
+			az := &Authorization{
+				ID:        "azID",
+				AccountID: "accID",
+				Status:    StatusPending,
+				ExpiresAt: now.Add(-defaultClockSkew / 2),
+				Challenges: []*Challenge{
+					{Status: StatusPending},
+				},
+			}
+			return test{
+				az: az,
+			}
+		},
+		"ok/expired-validated-before-expiry": func(t *testing.T) test {
+			now := clock.Now()
+			az := &Authorization{
+				ID:        "azID",
+				AccountID: "accID",
+				Status:    StatusPending,
+				ExpiresAt: now.Add(-5 * time.Minute),
+				Challenges: []*Challenge{
+					{Status: StatusPending}, {Status: StatusValid, ValidatedAt: now.Add(-6 * time.Minute).Format(time.RFC3339)},
+				},
+			}
+			return test{
+				az: az,
+				db: &MockDB{
+					MockUpdateAuthorization: func(ctx context.Context, updaz *Authorization) error {
+						assert.Equals(t, updaz.Status, StatusValid)
+						return nil
+					},
+				},
+			}
+		},
+		"ok/expired-validated-after-expiry": func(t *testing.T) test {
+			now := clock.Now()
+			az := &Authorization{
+				ID:        "azID",
+				AccountID: "accID",
+				Status:    StatusPending,
+				ExpiresAt: now.Add(-5 * time.Minute),
+				Challenges: []*Challenge{
+					{Status: StatusValid, ValidatedAt: now.Add(-2 * time.Minute).Format(time.RFC3339)},
+				},
+			}
+			return test{
+				az: az,
+				db: &MockDB{
+					MockUpdateAuthorization: func(ctx context.Context, updaz *Authorization) error {
+						assert.Equals(t, updaz.Status, StatusInvalid)
+						return nil
+					},
+				},
+			}
+		},
 		"fail/db.UpdateAuthorization-error": func(t *testing.T) test {
 			now := clock.Now()
 			az := &Authorization{
@@ -148,3 +205,113 @@ func TestAuthorization_UpdateStatus(t *testing.T) {
 
 	}
 }
+
+func TestAuthorization_UpdateStatus_clockSkew(t *testing.T) {
+	now := clock.Now()
+	newAuthz := func() *Authorization {
+		return &Authorization{
+			ID:         "azID",
+			Status:     StatusPending,
+			ExpiresAt:  now.Add(-5 * time.Minute),
+			Challenges: []*Challenge{{Status: StatusPending}},
+		}
+	}
+	db := &MockDB{
+		MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+			return nil
+		},
+	}
+
+	// The default skew does not cover the expiration.
+	az := newAuthz()
+	assert.FatalError(t, az.UpdateStatus(context.Background(), db))
+	assert.Equals(t, az.Status, StatusInvalid)
+
+	// The provisioner skew does.
+	ctx := NewProvisionerContext(context.Background(), &MockProvisioner{
+		MgetClockSkew: func() time.Duration { return 10 * time.Minute },
+	})
+	az = newAuthz()
+	assert.FatalError(t, az.UpdateStatus(ctx, db))
+	assert.Equals(t, az.Status, StatusPending)
+
+	// A skew of 0 disables the tolerance.
+	ctx = NewProvisionerContext(context.Background(), &MockProvisioner{
+		MgetClockSkew: func() time.Duration { return 0 },
+	})
+	az = newAuthz()
+	az.ExpiresAt = now.Add(-time.Second)
+	assert.FatalError(t, az.UpdateStatus(ctx, db))
+	assert.Equals(t, az.Status, StatusInvalid)
+
+	// Without a provisioner, the package default is used.
+	tmp := defaultClockSkew
+	t.Cleanup(func() { defaultClockSkew = tmp })
+	defaultClockSkew = 10 * time.Minute
+	az = newAuthz()
+	assert.FatalError(t, az.UpdateStatus(context.Background(), db))
+	assert.Equals(t, az.Status, StatusPending)
+}
+
+func TestAuthorization_Deactivate(t *testing.T) {
+	var updatedChallenges, updatedAuthzs int
+	db := &MockDB{
+		MockUpdateChallenges: func(ctx context.Context, chs []*Challenge) error {
+			updatedChallenges += len(chs)
+			return nil
+		},
+		MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+			updatedAuthzs++
+			return nil
+		},
+	}
+	az := &Authorization{
+		ID:     "azID",
+		Status: StatusValid,
+		Challenges: []*Challenge{
+			{ID: "ch1", Status: StatusPending},
+			{ID: "ch2", Status: StatusValid},
+		},
+	}
+
+	assert.FatalError(t, az.Deactivate(context.Background(), db, StatusDeactivated))
+	assert.Equals(t, StatusDeactivated, az.Status)
+	assert.Equals(t, StatusDeactivated, az.Challenges[0].Status)
+	assert.Equals(t, StatusDeactivated, az.Challenges[1].Status)
+	assert.Equals(t, 2, updatedChallenges)
+	assert.Equals(t, 1, updatedAuthzs)
+
+	// The transition is idempotent.
+	assert.FatalError(t, az.Deactivate(context.Background(), db, StatusDeactivated))
+	assert.Equals(t, 2, updatedChallenges)
+	assert.Equals(t, 1, updatedAuthzs)
+
+	// A deactivated authorization can be revoked.
+	assert.FatalError(t, az.Deactivate(context.Background(), db, StatusRevoked))
+	assert.Equals(t, StatusRevoked, az.Status)
+	assert.Equals(t, StatusRevoked, az.Challenges[0].Status)
+	assert.Equals(t, 4, updatedChallenges)
+	assert.Equals(t, 2, updatedAuthzs)
+
+	// And its status is not changed by UpdateStatus.
+	assert.FatalError(t, az.UpdateStatus(context.Background(), db))
+	assert.Equals(t, StatusRevoked, az.Status)
+	assert.Equals(t, 2, updatedAuthzs)
+
+	err := az.Deactivate(context.Background(), db, StatusValid)
+	var k *Error
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, NewError(ErrorMalformedType, "").Type, k.Type)
+		assert.Equals(t, "cannot set authorization status to valid", k.Err.Error())
+	}
+
+	db.MockUpdateAuthorization = func(ctx context.Context, az *Authorization) error {
+		return errors.New("force")
+	}
+	az = &Authorization{ID: "azID", Status: StatusValid}
+	err = az.Deactivate(context.Background(), db, StatusDeactivated)
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, NewErrorISE("").Type, k.Type)
+		assert.Equals(t, "error updating authorization: force", k.Err.Error())
+	}
+}
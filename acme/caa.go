@@ -0,0 +1,324 @@
+package acme
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// typeCAA is the DNS type of the CAA records defined in RFC 8659.
+const typeCAA dnsmessage.Type = 257
+
+// caaCriticalFlag is the issuer critical flag of a CAA record.
+const caaCriticalFlag = 128
+
+// CAARecord is a DNS CAA record as defined in RFC 8659.
+type CAARecord struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+// Critical returns true if the issuer critical flag is set.
+func (r CAARecord) Critical() bool {
+	return r.Flag&caaCriticalFlag != 0
+}
+
+// LookupCAA queries the CAA records of the given name using the nameservers in
+// /etc/resolv.conf. If the client uses a validation proxy, the query is done
+// over TCP through the proxy.
+func (c *client) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	servers := c.nameservers
+	if len(servers) == 0 {
+		servers = systemNameservers()
+	}
+	var err error
+	for _, server := range servers {
+		var records []CAARecord
+		if records, err = c.queryCAA(ctx, server, name); err == nil {
+			return records, nil
+		}
+	}
+	return nil, err
+}
+
+// systemNameservers returns the nameservers in /etc/resolv.conf, or the local
+// one if the file cannot be read.
+func systemNameservers() []string {
+	var servers []string
+	if f, err := os.Open("/etc/resolv.conf"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				servers = append(servers, net.JoinHostPort(fields[1], "53"))
+			}
+		}
+	}
+	if len(servers) == 0 {
+		servers = []string{"127.0.0.1:53"}
+	}
+	return servers
+}
+
+// queryCAA sends a CAA query to the given server.
+func (c *client) queryCAA(ctx context.Context, server, name string) ([]CAARecord, error) {
+	resp, id, err := c.query(ctx, server, name, typeCAA)
+	if err != nil {
+		return nil, err
+	}
+	return parseCAAResponse(resp, id)
+}
+
+// query sends a DNS query of the given type to the given server and returns
+// the response and the id of the query. The query is sent over UDP and
+// repeated over TCP if the response is truncated.
+func (c *client) query(ctx context.Context, server, name string, typ dnsmessage.Type) ([]byte, uint16, error) {
+	if c.dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialer.Timeout)
+		defer cancel()
+	}
+
+	fqdn, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.Intn(1 << 16)) //nolint:gosec // DNS message id
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: fqdn, Type: typ, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, 0, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, 0, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, 0, err
+	}
+	query, err := b.Finish()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var resp []byte
+	if c.dial == nil {
+		resp, err = c.exchange(ctx, "udp", server, query)
+		if err == nil && len(resp) > 2 && resp[2]&0x02 != 0 {
+			// Truncated response
+			resp, err = c.exchange(ctx, "tcp", server, query)
+		}
+	} else {
+		resp, err = c.exchange(ctx, "tcp", server, query)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp, id, nil
+}
+
+// dialerFor returns the dialer for the given network. The local address set
+// by WithLocalAddr is a TCP address, so the UDP connections use a copy of the
+// dialer bound to the same IP.
+func (c *client) dialerFor(network string) *net.Dialer {
+	if a, ok := c.dialer.LocalAddr.(*net.TCPAddr); ok && strings.HasPrefix(network, "udp") {
+		d := *c.dialer
+		d.LocalAddr = &net.UDPAddr{IP: a.IP, Zone: a.Zone}
+		return &d
+	}
+	return c.dialer
+}
+
+// exchange sends the DNS query and returns the response.
+func (c *client) exchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	dial := c.dialerFor(network).DialContext
+	if c.dial != nil {
+		dial = c.dial
+	}
+	conn, err := dial(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// parseCAAResponse returns the CAA records in the answer section of a DNS
+// response. Answers of other types, like the CNAME records followed by the
+// resolver, are ignored.
+func parseCAAResponse(resp []byte, id uint16) ([]CAARecord, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case h.ID != id:
+		return nil, errors.New("unexpected DNS response id")
+	case h.RCode == dnsmessage.RCodeNameError:
+		return nil, nil
+	case h.RCode != dnsmessage.RCodeSuccess:
+		return nil, fmt.Errorf("unexpected DNS response code %s", h.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+
+	var records []CAARecord
+	for {
+		ah, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ah.Type != typeCAA {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r, err := p.UnknownResource()
+		if err != nil {
+			return nil, err
+		}
+		record, err := parseCAARecord(r.Data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// parseCAARecord parses the data of a CAA record. It's encoded as the flags
+// byte, the tag length, the tag and the value.
+func parseCAARecord(data []byte) (CAARecord, error) {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return CAARecord{}, errors.New("malformed CAA record")
+	}
+	n := 2 + int(data[1])
+	return CAARecord{
+		Flag:  data[0],
+		Tag:   string(data[2:n]),
+		Value: string(data[n:]),
+	}, nil
+}
+
+// checkCAA verifies that the CAA records of the DNS identifier allow the
+// issuance by one of the given identities. The relevant records are found
+// using the tree-climbing algorithm defined in RFC 8659: the records of the
+// closest name, starting at the identifier, that has any.
+func checkCAA(ctx context.Context, vc Client, identifier string, identities []string) error {
+	name := strings.TrimSuffix(identifier, ".")
+	wildcard := strings.HasPrefix(name, "*.")
+	if wildcard {
+		name = name[2:]
+	}
+
+	var records []CAARecord
+	for domain := name; domain != ""; {
+		var err error
+		if records, err = vc.LookupCAA(ctx, domain); err != nil {
+			return WrapError(ErrorCaaType, err, "error looking up CAA records for %s", domain)
+		}
+		if len(records) > 0 {
+			break
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+
+	if !caaAllowed(records, wildcard, identities) {
+		return NewError(ErrorCaaType, "CAA records for %s do not authorize the issuance", identifier)
+	}
+	return nil
+}
+
+// caaAllowed returns true if the CAA records allow the issuance by one of the
+// identities. Wildcards use the issuewild records if there are any, and the
+// issue records otherwise. Issuance is allowed if there are no relevant
+// records, and it's never allowed if a critical record has an unknown tag.
+func caaAllowed(records []CAARecord, wildcard bool, identities []string) bool {
+	var issue, issueWild []CAARecord
+	for _, r := range records {
+		switch strings.ToLower(r.Tag) {
+		case "issue":
+			issue = append(issue, r)
+		case "issuewild":
+			issueWild = append(issueWild, r)
+		case "iodef", "issuemail", "contactemail", "contactphone":
+		default:
+			if r.Critical() {
+				return false
+			}
+		}
+	}
+
+	relevant := issue
+	if wildcard && len(issueWild) > 0 {
+		relevant = issueWild
+	}
+	if len(relevant) == 0 {
+		return true
+	}
+	for _, r := range relevant {
+		domain, _, _ := strings.Cut(r.Value, ";")
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+		for _, id := range identities {
+			if strings.EqualFold(domain, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
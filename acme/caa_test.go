@@ -0,0 +1,253 @@
+package acme
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func caa(tag, value string) CAARecord {
+	return CAARecord{Tag: tag, Value: value}
+}
+
+func Test_caaAllowed(t *testing.T) {
+	identities := []string{"ca.example.com", "ca.example.net"}
+	tests := []struct {
+		name     string
+		records  []CAARecord
+		wildcard bool
+		want     bool
+	}{
+		{"ok/no-records", nil, false, true},
+		{"ok/issue", []CAARecord{caa("issue", "ca.example.com")}, false, true},
+		{"ok/issue-parameters", []CAARecord{caa("issue", " CA.example.net ; account=1234")}, false, true},
+		{"ok/any-issue", []CAARecord{caa("issue", "letsencrypt.org"), caa("issue", "ca.example.com")}, false, true},
+		{"ok/only-iodef", []CAARecord{caa("iodef", "mailto:security@example.com")}, false, true},
+		{"ok/issuewild-not-relevant", []CAARecord{caa("issuewild", ";")}, false, true},
+		{"ok/wildcard-issuewild", []CAARecord{caa("issue", ";"), caa("issuewild", "ca.example.com")}, true, true},
+		{"ok/wildcard-issue", []CAARecord{caa("issue", "ca.example.com")}, true, true},
+		{"ok/unknown-not-critical", []CAARecord{caa("issue", "ca.example.com"), caa("foo", "bar")}, false, true},
+		{"fail/issue", []CAARecord{caa("issue", "letsencrypt.org")}, false, false},
+		{"fail/empty-issue", []CAARecord{caa("issue", ";")}, false, false},
+		{"fail/wildcard-issuewild", []CAARecord{caa("issue", "ca.example.com"), caa("issuewild", "letsencrypt.org")}, true, false},
+		{"fail/wildcard-issue", []CAARecord{caa("issue", "letsencrypt.org"), caa("iodef", "mailto:security@example.com")}, true, false},
+		{"fail/unknown-critical", []CAARecord{caa("issue", "ca.example.com"), {Flag: 128, Tag: "foo", Value: "bar"}}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, caaAllowed(tt.records, tt.wildcard, identities))
+		})
+	}
+}
+
+func Test_checkCAA(t *testing.T) {
+	zone := map[string][]CAARecord{
+		"example.com":           {caa("issue", "ca.example.com"), caa("issuewild", ";")},
+		"other.example.com":     {caa("issue", "letsencrypt.org")},
+		"wild.example.com":      {caa("issue", "letsencrypt.org"), caa("issuewild", "ca.example.com")},
+		"broken.example.com":    nil,
+		"forbidden.example.org": {caa("issue", ";")},
+	}
+	vc := &mockClient{lookupCAA: func(name string) ([]CAARecord, error) {
+		if name == "broken.example.com" {
+			return nil, errors.New("force")
+		}
+		return zone[name], nil
+	}}
+
+	tests := []struct {
+		name       string
+		identifier string
+		wantErr    string
+	}{
+		{"ok/exact", "example.com", ""},
+		{"ok/tree-climbing", "foo.bar.example.com", ""},
+		{"ok/no-records", "foo.example.net", ""},
+		{"ok/wildcard-issuewild", "*.wild.example.com", ""},
+		{"ok/trailing-dot", "foo.example.com.", ""},
+		{"fail/tree-climbing", "foo.other.example.com", "CAA records for foo.other.example.com do not authorize the issuance"},
+		{"fail/wildcard", "*.example.com", "CAA records for *.example.com do not authorize the issuance"},
+		{"fail/wildcard-issue", "*.foo.other.example.com", "CAA records for *.foo.other.example.com do not authorize the issuance"},
+		{"fail/lookup", "foo.broken.example.com", "error looking up CAA records for broken.example.com"},
+		{"fail/forbidden", "forbidden.example.org", "CAA records for forbidden.example.org do not authorize the issuance"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCAA(context.Background(), vc, tt.identifier, []string{"ca.example.com"})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var acmeErr *Error
+			if assert.True(t, errors.As(err, &acmeErr)) {
+				assert.Equal(t, "urn:ietf:params:acme:error:caa", acmeErr.Type)
+				assert.Contains(t, acmeErr.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+// caaResponse returns the DNS response to a CAA query. The names in the zone
+// have CAA records, the ones in cnames are aliases of other names, and the
+// rest don't exist.
+func caaResponse(t *testing.T, query []byte, zone map[string][]CAARecord, cnames map[string]string) []byte {
+	t.Helper()
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	require.NoError(t, err)
+	q, err := p.Question()
+	require.NoError(t, err)
+	require.Equal(t, typeCAA, q.Type)
+
+	name := strings.TrimSuffix(q.Name.String(), ".")
+	target, isAlias := cnames[name]
+	records, ok := zone[name]
+	if isAlias {
+		records, ok = zone[target]
+	}
+	rcode := dnsmessage.RCodeSuccess
+	if !ok {
+		rcode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, RCode: rcode})
+	require.NoError(t, b.StartQuestions())
+	require.NoError(t, b.Question(q))
+	require.NoError(t, b.StartAnswers())
+	owner := q.Name
+	if isAlias {
+		target := dnsmessage.MustNewName(target + ".")
+		require.NoError(t, b.CNAMEResource(dnsmessage.ResourceHeader{Name: owner, Class: dnsmessage.ClassINET}, dnsmessage.CNAMEResource{CNAME: target}))
+		owner = target
+	}
+	for _, r := range records {
+		data := append([]byte{r.Flag, byte(len(r.Tag))}, r.Tag...)
+		data = append(data, r.Value...)
+		require.NoError(t, b.UnknownResource(dnsmessage.ResourceHeader{Name: owner, Type: typeCAA, Class: dnsmessage.ClassINET}, dnsmessage.UnknownResource{Type: typeCAA, Data: data}))
+	}
+	resp, err := b.Finish()
+	require.NoError(t, err)
+	return resp
+}
+
+func TestClient_LookupCAA(t *testing.T) {
+	zone := map[string][]CAARecord{
+		"example.com":       {caa("issue", "ca.example.com"), {Flag: 128, Tag: "issuewild", Value: ";"}},
+		"empty.example.com": {},
+	}
+	cnames := map[string]string{"alias.example.org": "example.com"}
+	want := []CAARecord{caa("issue", "ca.example.com"), {Flag: 128, Tag: "issuewild", Value: ";"}}
+
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pc.Close()
+		go func() {
+			buf := make([]byte, 4096)
+			for {
+				n, addr, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				pc.WriteTo(caaResponse(t, buf[:n], zone, cnames), addr)
+			}
+		}()
+
+		c := NewClient().(*client)
+		c.nameservers = []string{pc.LocalAddr().String()}
+		records, err := c.LookupCAA(context.Background(), "example.com")
+		require.NoError(t, err)
+		assert.Equal(t, want, records)
+		assert.True(t, records[1].Critical())
+
+		records, err = c.LookupCAA(context.Background(), "alias.example.org")
+		require.NoError(t, err)
+		assert.Equal(t, want, records)
+
+		records, err = c.LookupCAA(context.Background(), "empty.example.com")
+		require.NoError(t, err)
+		assert.Empty(t, records)
+
+		records, err = c.LookupCAA(context.Background(), "missing.example.com")
+		require.NoError(t, err)
+		assert.Empty(t, records)
+
+		// The UDP queries are bound to the local address of the client.
+		c = NewClient(WithLocalAddr(net.ParseIP("127.0.0.1"))).(*client)
+		c.nameservers = []string{pc.LocalAddr().String()}
+		records, err = c.LookupCAA(context.Background(), "example.com")
+		require.NoError(t, err)
+		assert.Equal(t, want, records)
+		assert.Equal(t, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}, c.dialerFor("udp").LocalAddr)
+		assert.Equal(t, &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}, c.dialerFor("tcp").LocalAddr)
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err == nil {
+					query := make([]byte, binary.BigEndian.Uint16(size[:]))
+					if _, err := io.ReadFull(conn, query); err == nil {
+						resp := caaResponse(t, query, zone, cnames)
+						binary.BigEndian.PutUint16(size[:], uint16(len(resp)))
+						conn.Write(append(size[:], resp...))
+					}
+				}
+				conn.Close()
+			}
+		}()
+
+		// With a validation proxy the queries are sent over TCP.
+		c := NewClient().(*client)
+		c.nameservers = []string{l.Addr().String()}
+		c.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			assert.Equal(t, "tcp", network)
+			return c.dialer.DialContext(ctx, network, addr)
+		}
+		records, err := c.LookupCAA(context.Background(), "example.com.")
+		require.NoError(t, err)
+		assert.Equal(t, want, records)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := l.Addr().String()
+		l.Close()
+
+		c := NewClient().(*client)
+		c.nameservers = []string{addr}
+		c.dial = c.dialer.DialContext
+		_, err = c.LookupCAA(context.Background(), "example.com")
+		assert.Error(t, err)
+	})
+}
+
+func Test_parseCAAResponse(t *testing.T) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1, Response: true, RCode: dnsmessage.RCodeServerFailure})
+	resp, err := b.Finish()
+	require.NoError(t, err)
+	_, err = parseCAAResponse(resp, 1)
+	assert.EqualError(t, err, "unexpected DNS response code RCodeServerFailure")
+	_, err = parseCAAResponse(resp, 2)
+	assert.EqualError(t, err, "unexpected DNS response id")
+
+	_, err = parseCAARecord([]byte{0, 5, 'i'})
+	assert.EqualError(t, err, "malformed CAA record")
+}
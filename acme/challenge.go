@@ -1,16 +1,19 @@
 package acme
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
@@ -18,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"net/url"
 	"reflect"
@@ -76,6 +80,67 @@ type Challenge struct {
 	ValidatedAt     string        `json:"validated,omitempty"`
 	URL             string        `json:"url"`
 	Error           *Error        `json:"error,omitempty"`
+	// Attempts is the history of the validation attempts of the challenge.
+	// It's not part of the ACME representation of the challenge, but it can
+	// be retrieved using the admin API.
+	Attempts []*ChallengeAttempt `json:"-"`
+	// ProcessingAt is the time the challenge started processing, if it waits
+	// before the validation.
+	ProcessingAt time.Time `json:"-"`
+	observed     *ChallengeAttempt
+}
+
+// maxObservedBodySize is the maximum number of bytes of an http-01 response
+// body stored in a challenge attempt.
+const maxObservedBodySize = 256
+
+// ChallengeAttempt is the record of a challenge validation attempt. It
+// contains the values observed by the CA, the TXT records on dns-01 or the
+// status code and the beginning of the response body on http-01, and the
+// error, if the attempt failed. The error contains the internal error message
+// instead of the one returned to the ACME client.
+type ChallengeAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Values     []string  `json:"values,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// observe sets the values observed during the current validation attempt.
+func (ch *Challenge) observe(statusCode int, values ...string) {
+	ch.observed = &ChallengeAttempt{
+		StatusCode: statusCode,
+		Values:     values,
+	}
+}
+
+// recordAttempt adds the current validation attempt, with the observed values
+// and the current challenge error, to the challenge history.
+func (ch *Challenge) recordAttempt() {
+	attempt := ch.observed
+	if attempt == nil {
+		attempt = new(ChallengeAttempt)
+	}
+	attempt.Time = clock.Now()
+	if ch.Error != nil {
+		attempt.Error = ch.Error.Error()
+	}
+	ch.Attempts = append(ch.Attempts, attempt)
+	ch.observed = nil
+}
+
+// validatedBefore returns true if the challenge was validated before the given
+// time. It returns false if the challenge is nil or the validation time is not
+// known.
+func (ch *Challenge) validatedBefore(t time.Time) bool {
+	if ch == nil || ch.ValidatedAt == "" {
+		return false
+	}
+	validatedAt, err := time.Parse(time.RFC3339, ch.ValidatedAt)
+	if err != nil {
+		return false
+	}
+	return !validatedAt.After(t)
 }
 
 // ToLog enables response logging.
@@ -92,9 +157,144 @@ func (ch *Challenge) ToLog() (interface{}, error) {
 // 'validated' attributes are updated.
 func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) error {
 	// If already valid or invalid then return without performing validation.
-	if ch.Status != StatusPending {
+	if ch.Status != StatusPending && ch.Status != StatusProcessing {
 		return nil
 	}
+
+	// Give the dns-01 records time to propagate before the first lookup.
+	if waiting, err := ch.waitPropagation(ctx, db, jwk, payload); waiting || err != nil {
+		return err
+	}
+
+	// Track the validation so it can be drained on shutdown.
+	if c, ok := ValidationCoordinatorFromContext(ctx); ok {
+		var done func()
+		var err error
+		if ctx, done, err = c.start(ctx); err != nil {
+			return err
+		}
+		defer done()
+	}
+
+	// Accounts that reached the limit of failed validations cannot validate
+	// challenges until the window resets.
+	l, key, limits, limited := failedValidationRateLimit(ctx, ch)
+	if limited {
+		if err := l.Check(ctx, key, limits.FailedValidationsPerAccount, limits.GetWindow()); err != nil {
+			return err
+		}
+	}
+
+	// Wait until the validation does not exceed the concurrency limits of the
+	// provisioner.
+	release, err := acquireValidationSlots(ctx, ch)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	old := *ch
+	start := time.Now()
+	err = ch.validate(ctx, db, jwk, payload)
+
+	var outcome ValidationOutcome
+	switch {
+	case err != nil:
+		outcome = ValidationError
+	case ch.Status == StatusValid:
+		outcome = ValidationValid
+	default:
+		outcome = ValidationInvalid
+	}
+	d := time.Since(start)
+	MustMeterFromContext(ctx).ACMEChallengeValidated(ch.Type, outcome, d)
+	logChallengeValidated(ctx, ch, outcome, err, d)
+
+	// The status has only been saved if there was no error.
+	if err == nil {
+		notifyChallengeTransition(ctx, &old, ch)
+	}
+
+	if limited && outcome == ValidationInvalid {
+		if err := l.Increment(ctx, key, limits.GetWindow()); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// propagationWait returns the wait before the first TXT lookup of a dns-01
+// challenge configured in the provisioner.
+func (ch *Challenge) propagationWait(ctx context.Context) time.Duration {
+	if ch.Type != DNS01 {
+		return 0
+	}
+	if p, ok := ProvisionerFromContext(ctx); ok {
+		return p.GetDNSPropagationWait()
+	}
+	return 0
+}
+
+// waitPropagation moves a pending dns-01 challenge to processing if the
+// provisioner configures a propagation wait, and returns true until the wait
+// is over. The validation is scheduled to run when the wait is over.
+func (ch *Challenge) waitPropagation(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) (bool, error) {
+	wait := ch.propagationWait(ctx)
+	if wait <= 0 {
+		return false, nil
+	}
+	now := clock.Now()
+	if ch.Status == StatusPending {
+		ch.Status = StatusProcessing
+		ch.ProcessingAt = now
+		if err := db.UpdateChallenge(ctx, ch); err != nil {
+			return false, WrapErrorISE(err, "error updating challenge")
+		}
+		scheduleValidation(ctx, db, ch.ID, ch.AuthorizationID, jwk, payload, wait)
+	}
+	return now.Before(ch.ProcessingAt.Add(wait)), nil
+}
+
+// afterFunc runs the scheduled validations, tests can replace it.
+var afterFunc = func(d time.Duration, f func()) { time.AfterFunc(d, f) }
+
+// scheduleValidation validates a processing challenge when the propagation
+// wait is over, so clients that poll the authorization instead of posting the
+// challenge again see the result. The validation runs with the values of the
+// request context, but it's not canceled with the request. Challenges that
+// are no longer processing, because the client posted the challenge again,
+// are skipped.
+func scheduleValidation(ctx context.Context, db DB, id, azID string, jwk *jose.JSONWebKey, payload []byte, wait time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+	afterFunc(wait, func() {
+		ch, err := db.GetChallenge(ctx, id, azID)
+		if err != nil {
+			MustLoggerFromContext(ctx).Log(LogLevelError, "error loading scheduled challenge validation",
+				"challenge-id", id, "authorization-id", azID, "error", err.Error())
+			return
+		}
+		if ch.Status != StatusProcessing {
+			return
+		}
+		// The validation logs its own errors.
+		_ = ch.Validate(ctx, db, jwk, payload)
+	})
+}
+
+// RetryAfter returns the time left before the CA validates a processing
+// challenge, or 0 if the challenge is not waiting.
+func (ch *Challenge) RetryAfter(ctx context.Context) time.Duration {
+	if ch.Status != StatusProcessing {
+		return 0
+	}
+	if d := ch.ProcessingAt.Add(ch.propagationWait(ctx)).Sub(clock.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (ch *Challenge) validate(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) error {
 	switch ch.Type {
 	case HTTP01:
 		return http01Validate(ctx, ch, db, jwk)
@@ -109,47 +309,106 @@ func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey,
 	}
 }
 
+// ValidationTarget returns the target the CA will use to validate the
+// challenge without performing the validation. For http-01 and tls-alpn-01
+// challenges it returns the network, "tcp" by default, and the host:port the
+// CA will dial, for dns-01 challenges it returns the "dns" network and the
+// name of the TXT records. The context must contain the provisioner of the
+// challenge, as it may configure the network, the ports and the dns-01
+// prefix.
+func (ch *Challenge) ValidationTarget(ctx context.Context) (network, addr string, err error) {
+	switch ch.Type {
+	case HTTP01:
+		return validationNetwork(ctx), net.JoinHostPort(ch.Value, strconv.Itoa(http01Port(ctx))), nil
+	case TLSALPN01:
+		return validationNetwork(ctx), tlsalpn01Target(ch), nil
+	case DNS01:
+		_, name, err := dns01Target(ctx, ch)
+		if err != nil {
+			return "", "", WrapErrorISE(err, "error computing the dns-01 record name")
+		}
+		return "dns", name, nil
+	default:
+		return "", "", NewErrorISE("challenge type '%s' does not have a validation target", ch.Type)
+	}
+}
+
+// DefaultHTTP01MaxBodySize is the maximum number of bytes read from an http-01
+// response if the provisioner does not configure one.
+const DefaultHTTP01MaxBodySize = 64 << 10
+
 func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey) error {
 	u := &url.URL{Scheme: "http", Host: http01ChallengeHost(ch.Value), Path: fmt.Sprintf("/.well-known/acme-challenge/%s", ch.Token)}
 
-	// Append insecure port if set.
-	// Only used for testing purposes.
-	if InsecurePortHTTP01 != 0 {
-		u.Host += ":" + strconv.Itoa(InsecurePortHTTP01)
+	// Append the port configured in the provisioner, or the insecure port
+	// used for testing purposes.
+	if port := http01Port(ctx); port != 80 {
+		u.Host += ":" + strconv.Itoa(port)
 	}
 
 	vc := MustClientFromContext(ctx)
-	resp, err := vc.Get(u.String())
+	resp, err := vc.Get(ctx, u.String())
 	if err != nil {
+		finalURL := http01FinalURL(u.String(), err)
 		return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
-			"error doing http GET for url %s", u))
+			"error doing http GET for url %s on port %s over %s", finalURL, urlPort(finalURL), validationNetwork(ctx)))
 	}
 	defer resp.Body.Close()
+
+	// Use the final url after following redirects on error messages.
+	finalURL := u.String()
+	if resp.Request != nil && resp.Request.URL != nil {
+		finalURL = resp.Request.URL.String()
+	}
 	if resp.StatusCode >= 400 {
+		ch.observe(resp.StatusCode)
 		return storeError(ctx, db, ch, false, NewError(ErrorConnectionType,
-			"error doing http GET for url %s with status code %d", u, resp.StatusCode))
+			"error doing http GET for url %s on port %s with status code %d", finalURL, urlPort(finalURL), resp.StatusCode))
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	maxBodySize := int64(DefaultHTTP01MaxBodySize)
+	if p, ok := ProvisionerFromContext(ctx); ok && p.GetHTTP01MaxBodySize() > 0 {
+		maxBodySize = p.GetHTTP01MaxBodySize()
+	}
+	// Read one extra byte to detect larger responses.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
 	if err != nil {
 		return WrapErrorISE(err, "error reading "+
-			"response body for url %s", u)
+			"response body for url %s", finalURL)
+	}
+	if len(body) > maxObservedBodySize {
+		ch.observe(resp.StatusCode, string(body[:maxObservedBodySize]))
+	} else {
+		ch.observe(resp.StatusCode, string(body))
+	}
+	if int64(len(body)) > maxBodySize {
+		return storeError(ctx, db, ch, true, NewError(ErrorIncorrectResponseType,
+			"response body for url %s exceeds the maximum size of %d bytes", finalURL, maxBodySize))
 	}
-	keyAuth := strings.TrimSpace(string(body))
-
 	expected, err := KeyAuthorization(ch.Token, jwk)
 	if err != nil {
 		return err
 	}
+
+	// Some proxies add whitespace to the response, so leading and trailing
+	// whitespace is ignored unless the provisioner requires an exact match.
+	keyAuth := string(body)
+	if p, ok := ProvisionerFromContext(ctx); !ok || !p.GetHTTP01ExactMatch() {
+		keyAuth = strings.TrimSpace(keyAuth)
+	}
 	if keyAuth != expected {
+		if len(body) > maxObservedBodySize {
+			body = body[:maxObservedBodySize]
+		}
 		return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
-			"keyAuthorization does not match; expected %s, but got %s", expected, keyAuth))
+			"keyAuthorization does not match; expected %s, but got %q", expected, body))
 	}
 
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
 	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.recordAttempt()
 
 	if err = db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "error updating challenge")
@@ -157,6 +416,96 @@ func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWeb
 	return nil
 }
 
+// http01FinalURL returns the url that failed on an http GET. If the error
+// happened after following one or more redirects, the url of the last request
+// is returned.
+func http01FinalURL(u string, err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.URL != "" {
+		return urlErr.URL
+	}
+	return u
+}
+
+// http01Port returns the port used to validate http-01 challenges, the one
+// configured in the provisioner, InsecurePortHTTP01, or 80.
+func http01Port(ctx context.Context) int {
+	if p, ok := ProvisionerFromContext(ctx); ok && p.GetHTTP01Port() > 0 {
+		return p.GetHTTP01Port()
+	}
+	if InsecurePortHTTP01 != 0 {
+		return InsecurePortHTTP01
+	}
+	return 80
+}
+
+// validationNetwork returns the network used to connect to the clients on the
+// http-01 and tls-alpn-01 challenges, the one configured in the provisioner or
+// "tcp".
+func validationNetwork(ctx context.Context) string {
+	if p, ok := ProvisionerFromContext(ctx); ok && p.GetValidationNetwork() != "" {
+		return p.GetValidationNetwork()
+	}
+	return "tcp"
+}
+
+// tlsalpn01Protocol returns the ALPN protocol used to validate a tls-alpn-01
+// challenge.
+func tlsalpn01Protocol(ctx context.Context) string {
+	if p, ok := ProvisionerFromContext(ctx); ok && p.GetTLSALPN01Protocol() != "" {
+		return p.GetTLSALPN01Protocol()
+	}
+	return defaultTLSALPN01Protocol
+}
+
+// tlsalpn01Target returns the address used to validate a tls-alpn-01
+// challenge.
+func tlsalpn01Target(ch *Challenge) string {
+	// Allow to change TLS port for testing purposes.
+	if port := InsecurePortTLSALPN01; port != 0 {
+		return net.JoinHostPort(ch.Value, strconv.Itoa(port))
+	}
+	return net.JoinHostPort(ch.Value, "443")
+}
+
+// dns01Target returns the domain of a dns-01 challenge and the name of the
+// TXT records used to validate it. The name is "<prefix>.<domain>" unless the
+// provisioner computes it.
+func dns01Target(ctx context.Context, ch *Challenge) (domain, name string, err error) {
+	// Normalize domain for wildcard DNS names
+	// This is done to avoid making TXT lookups for domains like
+	// _acme-challenge.*.example.com
+	// Instead perform txt lookup for _acme-challenge.example.com
+	domain = strings.TrimPrefix(ch.Value, "*.")
+
+	prefix := defaultDNSChallengePrefix
+	p, ok := ProvisionerFromContext(ctx)
+	if ok && p.GetDNSChallengePrefix() != "" {
+		prefix = p.GetDNSChallengePrefix()
+	}
+	if ok {
+		if name, err = p.GetDNSChallengeName(domain, prefix); err != nil || name != "" {
+			return domain, name, err
+		}
+	}
+	return domain, prefix + "." + domain, nil
+}
+
+// urlPort returns the port used to connect to the given url.
+func urlPort(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	switch {
+	case err != nil:
+		return ""
+	case u.Port() != "":
+		return u.Port()
+	case u.Scheme == "https":
+		return "443"
+	default:
+		return "80"
+	}
+}
+
 // http01ChallengeHost checks if a Challenge value is an IPv6 address
 // and adds square brackets if that's the case, so that it can be used
 // as a hostname. Returns the original Challenge value as the host to
@@ -179,9 +528,14 @@ func tlsAlert(err error) uint8 {
 	return 0
 }
 
+// defaultTLSALPN01Protocol is the ALPN protocol of the tls-alpn-01 challenges
+// if the provisioner does not configure one, see RFC 8737 section 6.2.
+const defaultTLSALPN01Protocol = "acme-tls/1"
+
 func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey) error {
+	protocol := tlsalpn01Protocol(ctx)
 	config := &tls.Config{
-		NextProtos: []string{"acme-tls/1"},
+		NextProtos: []string{protocol},
 		// https://tools.ietf.org/html/rfc8737#section-4
 		// ACME servers that implement "acme-tls/1" MUST only negotiate TLS 1.2
 		// [RFC5246] or higher when connecting to clients for validation.
@@ -190,28 +544,38 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 		InsecureSkipVerify: true, //nolint:gosec // we expect a self-signed challenge certificate
 	}
 
-	var hostPort string
-
-	// Allow to change TLS port for testing purposes.
-	if port := InsecurePortTLSALPN01; port == 0 {
-		hostPort = net.JoinHostPort(ch.Value, "443")
-	} else {
-		hostPort = net.JoinHostPort(ch.Value, strconv.Itoa(port))
-	}
-
+	hostPort := tlsalpn01Target(ch)
 	vc := MustClientFromContext(ctx)
-	conn, err := vc.TLSDial("tcp", hostPort, config)
+	network := validationNetwork(ctx)
+	conn, err := vc.TLSDial(ctx, network, hostPort, config)
 	if err != nil {
 		// With Go 1.17+ tls.Dial fails if there's no overlap between configured
 		// client and server protocols. When this happens the connection is
 		// closed with the error no_application_protocol(120) as required by
 		// RFC7301. See https://golang.org/doc/go1.17#ALPN
 		if tlsAlert(err) == 120 {
-			return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
-				"cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge"))
+			return storeError(ctx, db, ch, true, NewError(ErrorTLSType,
+				"cannot negotiate ALPN %s protocol for tls-alpn-01 challenge: server has no protocol in common", protocol))
+		}
+		// The first record of a plain text server is not a TLS one, e.g. an
+		// HTTP server responds with its status line.
+		var rhErr tls.RecordHeaderError
+		if errors.As(err, &rhErr) {
+			_, port, _ := net.SplitHostPort(hostPort)
+			if bytes.HasPrefix(rhErr.RecordHeader[:], []byte("HTTP/")) {
+				return storeError(ctx, db, ch, true, WrapError(ErrorTLSType, err,
+					"target %s did not speak TLS on port %s; is it an HTTP server?", ch.Value, port))
+			}
+			return storeError(ctx, db, ch, true, WrapError(ErrorTLSType, err,
+				"target %s did not speak TLS on port %s", ch.Value, port))
+		}
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
+				"timeout doing TLS dial for %s over %s", hostPort, network))
 		}
 		return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
-			"error doing TLS dial for %s", hostPort))
+			"error doing TLS dial for %s over %s", hostPort, network))
 	}
 	defer conn.Close()
 
@@ -223,27 +587,43 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 			"%s challenge for %s resulted in no certificates", ch.Type, ch.Value))
 	}
 
-	if cs.NegotiatedProtocol != "acme-tls/1" {
+	// Fail before looking at the certificate if the server did not select
+	// the protocol, servers without ALPN support complete the handshake
+	// without negotiating any protocol.
+	switch cs.NegotiatedProtocol {
+	case protocol:
+	case "":
+		return storeError(ctx, db, ch, true, NewError(ErrorTLSType,
+			"cannot negotiate ALPN %s protocol for tls-alpn-01 challenge: server did not negotiate any protocol", protocol))
+	default:
+		return storeError(ctx, db, ch, true, NewError(ErrorTLSType,
+			"cannot negotiate ALPN %s protocol for tls-alpn-01 challenge: server negotiated %q", protocol, cs.NegotiatedProtocol))
+	}
+
+	// The handshake proves that the server has the key of the first
+	// certificate. RFC 8737 requires a single self-signed certificate, so more
+	// certificates mean the server is presenting a chain.
+	if len(certs) > 1 {
 		return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
-			"cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge"))
+			"incorrect certificate for tls-alpn-01 challenge: server presented %d certificates instead of a single self-signed certificate", len(certs)))
 	}
 
 	leafCert := certs[0]
 
-	// if no DNS names present, look for IP address and verify that exactly one exists
-	if len(leafCert.DNSNames) == 0 {
-		if len(leafCert.IPAddresses) != 1 || !leafCert.IPAddresses[0].Equal(net.ParseIP(ch.Value)) {
-			return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
-				"incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address or DNS name, %v", ch.Value))
-		}
-	} else {
-		if len(leafCert.DNSNames) != 1 || !strings.EqualFold(leafCert.DNSNames[0], ch.Value) {
+	// An IP identifier must be the only name in the certificate as an
+	// iPAddress SAN, see RFC 8738 section 6. A DNS identifier must be the only
+	// DNS name.
+	if ip := net.ParseIP(ch.Value); ip != nil {
+		if len(leafCert.DNSNames) > 0 || len(leafCert.IPAddresses) != 1 || !leafCert.IPAddresses[0].Equal(ip) {
 			return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
-				"incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address or DNS name, %v", ch.Value))
+				"incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address, %v", ch.Value))
 		}
+	} else if len(leafCert.DNSNames) != 1 || !strings.EqualFold(leafCert.DNSNames[0], ch.Value) {
+		return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
+			"incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address or DNS name, %v", ch.Value))
 	}
 
-	idPeAcmeIdentifier := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+	idPeAcmeIdentifier := OIDACMEIdentifier
 	idPeAcmeIdentifierV1Obsolete := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 30, 1}
 	foundIDPeAcmeIdentifierV1Obsolete := false
 
@@ -278,6 +658,7 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 			ch.Status = StatusValid
 			ch.Error = nil
 			ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+			ch.recordAttempt()
 
 			if err = db.UpdateChallenge(ctx, ch); err != nil {
 				return WrapErrorISE(err, "tlsalpn01ValidateChallenge - error updating challenge")
@@ -299,42 +680,134 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 		"incorrect certificate for tls-alpn-01 challenge: missing acmeValidationV1 extension"))
 }
 
+// defaultDNSChallengePrefix is the prefix of the dns-01 challenge records if
+// the provisioner does not configure one.
+const defaultDNSChallengePrefix = "_acme-challenge"
+
 func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey) error {
-	// Normalize domain for wildcard DNS names
-	// This is done to avoid making TXT lookups for domains like
-	// _acme-challenge.*.example.com
-	// Instead perform txt lookup for _acme-challenge.example.com
-	domain := strings.TrimPrefix(ch.Value, "*.")
+	domain, name, err := dns01Target(ctx, ch)
+	if err != nil {
+		return WrapErrorISE(err, "error computing the dns-01 record name")
+	}
 
 	vc := MustClientFromContext(ctx)
-	txtRecords, err := vc.LookupTxt("_acme-challenge." + domain)
+	if p, ok := ProvisionerFromContext(ctx); ok && p.GetDNSChallengeQuorum() != "" {
+		return dns01ValidateQuorum(ctx, ch, db, jwk, domain, name, p.GetDNSChallengeQuorum())
+	}
+	txtRecords, err := lookupTxtWithRetry(ctx, vc, name)
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
 			"error looking up TXT records for domain %s", domain))
 	}
 
+	ch.observe(0, txtRecords...)
+
 	expectedKeyAuth, err := KeyAuthorization(ch.Token, jwk)
 	if err != nil {
 		return err
 	}
-	h := sha256.Sum256([]byte(expectedKeyAuth))
-	expected := base64.RawURLEncoding.EncodeToString(h[:])
-	var found bool
-	for _, r := range txtRecords {
-		if r == expected {
-			found = true
-			break
+	if !containsTXTRecord(txtRecords, dns01Digest(expectedKeyAuth)) {
+		return storeError(ctx, db, ch, false, NewError(ErrorRejectedIdentifierType,
+			"keyAuthorization does not match; expected %s, but got %s", expectedKeyAuth, txtRecords))
+	}
+
+	// Update and store the challenge.
+	ch.Status = StatusValid
+	ch.Error = nil
+	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.recordAttempt()
+
+	if err = db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	return nil
+}
+
+// dnsLookupBackoff returns the wait before the given retry of a TXT lookup,
+// starting at 1. It's a variable so tests can avoid the waits.
+var dnsLookupBackoff = func(retry int, backoff, maxBackoff time.Duration) time.Duration {
+	d := backoff
+	for i := 1; i < retry && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// lookupTxtWithRetry looks up the TXT records of the given name, retrying the
+// failed lookups as configured in the provisioner. It returns the error of the
+// last lookup once all the attempts fail.
+func lookupTxtWithRetry(ctx context.Context, vc Client, name string) ([]string, error) {
+	var retry *provisioner.ACMEDNSLookupRetry
+	if p, ok := ProvisionerFromContext(ctx); ok {
+		retry = p.GetDNSLookupRetry()
+	}
+	if retry == nil {
+		return vc.LookupTxt(ctx, name)
+	}
+
+	for attempt := 1; ; attempt++ {
+		txtRecords, err := lookupTxtWithTimeout(ctx, vc, name, retry.GetTimeout())
+		if err == nil || attempt >= retry.Attempts {
+			return txtRecords, err
+		}
+		t := time.NewTimer(dnsLookupBackoff(attempt, retry.GetBackoff(), retry.GetMaxBackoff()))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
 		}
 	}
-	if !found {
+}
+
+// lookupTxtWithTimeout looks up the TXT records of the given name, canceling
+// the lookup if it does not finish before the timeout.
+func lookupTxtWithTimeout(ctx context.Context, vc Client, name string, timeout time.Duration) ([]string, error) {
+	lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	txtRecords, err := vc.LookupTxt(lookupCtx, name)
+	if err != nil && ctx.Err() == nil && errors.Is(lookupCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("lookup %s: timed out after %s", name, timeout)
+	}
+	return txtRecords, err
+}
+
+// dns01ValidateQuorum validates a dns-01 challenge querying the TXT records on
+// each authoritative nameserver of the zone. The challenge is valid if the
+// number of nameservers that serve the expected record reaches the quorum.
+func dns01ValidateQuorum(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey, domain, name string, quorum provisioner.ACMEDNSQuorum) error {
+	vc := MustClientFromContext(ctx)
+	servers, err := vc.LookupNS(ctx, name)
+	if err != nil {
+		return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
+			"error looking up nameservers for domain %s", domain))
+	}
+
+	expectedKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+	if err != nil {
+		return err
+	}
+	expected := dns01Digest(expectedKeyAuth)
+
+	txtRecords, disagreed := lookupTxtOnNameservers(ctx, vc, servers, name, expected)
+	ch.observe(0, txtRecords...)
+
+	agreed := len(servers) - len(disagreed)
+	if required := quorum.Required(len(servers)); agreed < required {
 		return storeError(ctx, db, ch, false, NewError(ErrorRejectedIdentifierType,
-			"keyAuthorization does not match; expected %s, but got %s", expectedKeyAuth, txtRecords))
+			"keyAuthorization %s found on %d of %d nameservers, %d required; disagreeing nameservers: %s",
+			expectedKeyAuth, agreed, len(servers), required, strings.Join(disagreed, ", ")))
 	}
 
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
 	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.recordAttempt()
 
 	if err = db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "error updating challenge")
@@ -342,6 +815,67 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	return nil
 }
 
+// lookupTxtOnNameservers queries the TXT records of the given name on each
+// nameserver. It returns all the records found and the nameservers that do
+// not serve the expected value, with the error if the query failed.
+func lookupTxtOnNameservers(ctx context.Context, vc Client, servers []string, name, expected string) (txtRecords, disagreed []string) {
+	for _, server := range servers {
+		records, err := vc.LookupTxtOn(ctx, server, name)
+		switch {
+		case err != nil:
+			disagreed = append(disagreed, fmt.Sprintf("%s (%v)", server, err))
+		case !containsTXTRecord(records, expected):
+			disagreed = append(disagreed, server)
+		}
+		txtRecords = append(txtRecords, records...)
+	}
+	return txtRecords, disagreed
+}
+
+// dns01Digest returns the value of the TXT record of a dns-01 challenge, the
+// base64url encoding of the SHA-256 digest of the key authorization.
+func dns01Digest(keyAuth string) string {
+	h := sha256.Sum256([]byte(keyAuth))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// containsTXTRecord returns true if one of the records matches the expected
+// value once normalized.
+func containsTXTRecord(records []string, expected string) bool {
+	for _, r := range records {
+		if normalizeTXTRecord(r) == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTXTRecord normalizes the value of a TXT record returned by some DNS
+// providers in its presentation format. Surrounding whitespace is trimmed and,
+// if the value is a list of quoted character-strings, the quotes are removed
+// and the strings are concatenated as described in RFC 1035 and RFC 8555,
+// Section 8.4.
+func normalizeTXTRecord(r string) string {
+	r = strings.TrimSpace(r)
+	if len(r) < 2 || r[0] != '"' || r[len(r)-1] != '"' {
+		return r
+	}
+
+	var sb strings.Builder
+	for rest := r; rest != ""; rest = strings.TrimLeft(rest, " \t") {
+		if rest[0] != '"' {
+			return strings.TrimSpace(strings.Trim(r, `"`))
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return strings.TrimSpace(strings.Trim(r, `"`))
+		}
+		sb.WriteString(rest[1 : end+1])
+		rest = rest[end+2:]
+	}
+	return strings.TrimSpace(sb.String())
+}
+
 type payloadType struct {
 	AttObj string `json:"attObj"`
 	Error  string `json:"error"`
@@ -494,6 +1028,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 	ch.Status = StatusValid
 	ch.Error = nil
 	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.recordAttempt()
 
 	// Store the fingerprint in the authorization.
 	//
@@ -1112,9 +1647,79 @@ func uitoa(val uint) string {
 
 const hexit = "0123456789abcdef"
 
+// OIDACMEIdentifier is the id-pe-acmeIdentifier object identifier of the
+// acmeValidationV1 extension used in tls-alpn-01 challenges, as defined in
+// RFC 8737.
+var OIDACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// NewTLSALPNCertificate creates the self-signed certificate that a server must
+// present to validate a tls-alpn-01 challenge using the given key
+// authorization. The certificate contains the single DNS name or IP address
+// being validated, and the critical acmeValidationV1 extension with the
+// SHA-256 hash of the key authorization.
+func NewTLSALPNCertificate(keyAuth string, names ...string) (*tls.Certificate, error) {
+	if len(names) != 1 {
+		return nil, fmt.Errorf("tls-alpn-01 certificate requires exactly one name, got %d", len(names))
+	}
+
+	hashedKeyAuth := sha256.Sum256([]byte(keyAuth))
+	extValue, err := asn1.Marshal(hashedKeyAuth[:])
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling acmeValidationV1 extension: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: names[0]},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{{
+			Id:       OIDACMEIdentifier,
+			Critical: true,
+			Value:    extValue,
+		}},
+	}
+	if ip := net.ParseIP(names[0]); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = names
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %w", err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
 // KeyAuthorization creates the ACME key authorization value from a token
-// and a jwk.
+// and a jwk. The supported account keys are RSA, EC P-256, P-384 and P-521, and
+// Ed25519 keys.
 func KeyAuthorization(token string, jwk *jose.JSONWebKey) (string, error) {
+	if err := validateAccountKey(jwk); err != nil {
+		return "", err
+	}
 	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
 	if err != nil {
 		return "", WrapErrorISE(err, "error generating JWK thumbprint")
@@ -1123,12 +1728,48 @@ func KeyAuthorization(token string, jwk *jose.JSONWebKey) (string, error) {
 	return fmt.Sprintf("%s.%s", token, encPrint), nil
 }
 
+// validateAccountKey returns an error if the type of the account key is not
+// supported to generate the key authorization.
+func validateAccountKey(jwk *jose.JSONWebKey) error {
+	if jwk == nil || jwk.Key == nil {
+		return NewErrorISE("error generating JWK thumbprint: account key is missing")
+	}
+	var curve elliptic.Curve
+	switch k := jwk.Key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey, ed25519.PublicKey, ed25519.PrivateKey:
+		return nil
+	case *ecdsa.PublicKey:
+		curve = k.Curve
+	case *ecdsa.PrivateKey:
+		curve = k.Curve
+	default:
+		return NewErrorISE("error generating JWK thumbprint: unsupported account key type %T", jwk.Key)
+	}
+	switch curve {
+	case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		return nil
+	default:
+		name := "unknown"
+		if curve != nil {
+			name = curve.Params().Name
+		}
+		return NewErrorISE("error generating JWK thumbprint: unsupported account key curve %s", name)
+	}
+}
+
 // storeError the given error to an ACME error and saves using the DB interface.
+// The challenge is kept as pending if the validation was canceled by a drain, so
+// the client can retry it.
 func storeError(ctx context.Context, db DB, ch *Challenge, markInvalid bool, err *Error) error {
 	ch.Error = err
-	if markInvalid {
+	switch {
+	case isDrained(ctx):
+		// Keep the challenge pending, and make sure the error is stored.
+		ctx = context.WithoutCancel(ctx)
+	case markInvalid:
 		ch.Status = StatusInvalid
 	}
+	ch.recordAttempt()
 	if err := db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "failure saving error to acme challenge")
 	}
@@ -24,15 +24,18 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/middleware/requestid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/jose"
@@ -42,14 +45,28 @@ import (
 )
 
 type mockClient struct {
-	get       func(url string) (*http.Response, error)
-	lookupTxt func(name string) ([]string, error)
-	tlsDial   func(network, addr string, config *tls.Config) (*tls.Conn, error)
+	get         func(url string) (*http.Response, error)
+	lookupTxt   func(name string) ([]string, error)
+	lookupCAA   func(name string) ([]CAARecord, error)
+	lookupNS    func(name string) ([]string, error)
+	lookupTxtOn func(server, name string) ([]string, error)
+	tlsDial     func(network, addr string, config *tls.Config) (*tls.Conn, error)
 }
 
-func (m *mockClient) Get(url string) (*http.Response, error)  { return m.get(url) }
-func (m *mockClient) LookupTxt(name string) ([]string, error) { return m.lookupTxt(name) }
-func (m *mockClient) TLSDial(network, addr string, tlsConfig *tls.Config) (*tls.Conn, error) {
+func (m *mockClient) Get(_ context.Context, url string) (*http.Response, error) { return m.get(url) }
+func (m *mockClient) LookupTxt(_ context.Context, name string) ([]string, error) {
+	return m.lookupTxt(name)
+}
+func (m *mockClient) LookupCAA(_ context.Context, name string) ([]CAARecord, error) {
+	return m.lookupCAA(name)
+}
+func (m *mockClient) LookupNS(_ context.Context, name string) ([]string, error) {
+	return m.lookupNS(name)
+}
+func (m *mockClient) LookupTxtOn(_ context.Context, server, name string) ([]string, error) {
+	return m.lookupTxtOn(server, name)
+}
+func (m *mockClient) TLSDial(_ context.Context, network, addr string, tlsConfig *tls.Config) (*tls.Conn, error) {
 	return m.tlsDial(network, addr, tlsConfig)
 }
 
@@ -339,6 +356,70 @@ func Test_storeError(t *testing.T) {
 	}
 }
 
+func TestChallenge_attempts(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	expKeyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(expKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	var updates int
+	db := &MockDB{
+		MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+			updates++
+			return nil
+		},
+	}
+
+	ch := &Challenge{
+		ID:     "chID",
+		Token:  "token",
+		Value:  "zap.internal",
+		Type:   DNS01,
+		Status: StatusPending,
+	}
+
+	txtRecords := []string{"foo", "bar"}
+	ctx := NewClientContext(context.Background(), &mockClient{
+		lookupTxt: func(name string) ([]string, error) {
+			return txtRecords, nil
+		},
+		get: func(url string) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(strings.Repeat("a", 300))),
+			}, nil
+		},
+	})
+
+	// First attempt fails
+	require.NoError(t, dns01Validate(ctx, ch, db, jwk))
+	require.Len(t, ch.Attempts, 1)
+	assert.Equal(t, []string{"foo", "bar"}, ch.Attempts[0].Values)
+	assert.Equal(t, 0, ch.Attempts[0].StatusCode)
+	assert.Contains(t, ch.Attempts[0].Error, "keyAuthorization does not match")
+	assert.False(t, ch.Attempts[0].Time.IsZero())
+
+	// Second attempt succeeds
+	txtRecords = []string{expected}
+	require.NoError(t, dns01Validate(ctx, ch, db, jwk))
+	require.Len(t, ch.Attempts, 2)
+	assert.Equal(t, []string{expected}, ch.Attempts[1].Values)
+	assert.Empty(t, ch.Attempts[1].Error)
+	assert.Equal(t, StatusValid, ch.Status)
+
+	// http-01 stores the status code and the body prefix
+	ch.Type = HTTP01
+	ch.Status = StatusPending
+	require.NoError(t, http01Validate(ctx, ch, db, jwk))
+	require.Len(t, ch.Attempts, 3)
+	assert.Equal(t, http.StatusOK, ch.Attempts[2].StatusCode)
+	assert.Equal(t, []string{strings.Repeat("a", maxObservedBodySize)}, ch.Attempts[2].Values)
+	assert.Contains(t, ch.Attempts[2].Error, "keyAuthorization does not match")
+	assert.Equal(t, 3, updates)
+}
+
 func TestKeyAuthorization(t *testing.T) {
 	type test struct {
 		token string
@@ -354,7 +435,7 @@ func TestKeyAuthorization(t *testing.T) {
 			return test{
 				token: "1234",
 				jwk:   jwk,
-				err:   NewErrorISE("error generating JWK thumbprint: go-jose/go-jose: unknown key type 'string'"),
+				err:   NewErrorISE("error generating JWK thumbprint: unsupported account key type string"),
 			}
 		},
 		"ok": func(t *testing.T) test {
@@ -395,6 +476,90 @@ func TestKeyAuthorization(t *testing.T) {
 	}
 }
 
+func TestKeyAuthorization_keyTypes(t *testing.T) {
+	ecKey := func(crv string) *jose.JSONWebKey {
+		jwk, err := jose.GenerateJWK("EC", crv, "", "sig", "", 0)
+		require.NoError(t, err)
+		return jwk
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := jose.GenerateJWK("RSA", "", "RS256", "sig", "", 2048)
+	require.NoError(t, err)
+	edKey, err := jose.GenerateJWK("OKP", "Ed25519", "EdDSA", "sig", "", 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		jwk     *jose.JSONWebKey
+		wantErr string
+	}{
+		{"ok/rsa", rsaKey, ""},
+		{"ok/rsa-public", &jose.JSONWebKey{Key: rsaKey.Public().Key}, ""},
+		{"ok/p256", ecKey("P-256"), ""},
+		{"ok/p384", ecKey("P-384"), ""},
+		{"ok/p521", ecKey("P-521"), ""},
+		{"ok/p256-public", &jose.JSONWebKey{Key: ecKey("P-256").Public().Key}, ""},
+		{"ok/ed25519", edKey, ""},
+		{"ok/ed25519-public", &jose.JSONWebKey{Key: edKey.Public().Key}, ""},
+		{"fail/p224", &jose.JSONWebKey{Key: p224.Public()}, "error generating JWK thumbprint: unsupported account key curve P-224"},
+		{"fail/symmetric", &jose.JSONWebKey{Key: []byte("secret")}, "error generating JWK thumbprint: unsupported account key type []uint8"},
+		{"fail/nil", nil, "error generating JWK thumbprint: account key is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyAuth, err := KeyAuthorization("token", tt.jwk)
+			if tt.wantErr != "" {
+				var k *Error
+				require.True(t, errors.As(err, &k))
+				assert.Equal(t, NewErrorISE("").Type, k.Type)
+				assert.EqualError(t, k.Err, tt.wantErr)
+				assert.Empty(t, keyAuth)
+				return
+			}
+			require.NoError(t, err)
+			thumbprint, err := tt.jwk.Thumbprint(crypto.SHA256)
+			require.NoError(t, err)
+			require.Equal(t, "token."+base64.RawURLEncoding.EncodeToString(thumbprint), keyAuth)
+
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+
+			// http-01
+			ch := &Challenge{ID: "chID", Token: "token", Type: HTTP01, Status: StatusPending, Value: "zap.internal"}
+			ctx := NewClientContext(context.Background(), &mockClient{
+				get: func(string) (*http.Response, error) {
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(keyAuth))}, nil
+				},
+			})
+			require.NoError(t, http01Validate(ctx, ch, db, tt.jwk))
+			assert.Equal(t, StatusValid, ch.Status)
+
+			// dns-01
+			h := sha256.Sum256([]byte(keyAuth))
+			ch = &Challenge{ID: "chID", Token: "token", Type: DNS01, Status: StatusPending, Value: "zap.internal"}
+			ctx = NewClientContext(context.Background(), &mockClient{
+				lookupTxt: func(string) ([]string, error) {
+					return []string{base64.RawURLEncoding.EncodeToString(h[:])}, nil
+				},
+			})
+			require.NoError(t, dns01Validate(ctx, ch, db, tt.jwk))
+			assert.Equal(t, StatusValid, ch.Status)
+
+			// tls-alpn-01
+			cert, err := NewTLSALPNCertificate(keyAuth, "zap.internal")
+			require.NoError(t, err)
+			srv, tlsDial := newTestTLSALPNServer(cert)
+			srv.Start()
+			defer srv.Close()
+			ch = &Challenge{ID: "chID", Token: "token", Type: TLSALPN01, Status: StatusPending, Value: "zap.internal"}
+			ctx = NewClientContext(context.Background(), &mockClient{tlsDial: tlsDial})
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, tt.jwk))
+			assert.Equal(t, StatusValid, ch.Status)
+			assert.Nil(t, ch.Error)
+		})
+	}
+}
+
 func TestChallenge_Validate(t *testing.T) {
 	type test struct {
 		ch      *Challenge
@@ -457,7 +622,7 @@ func TestChallenge_Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s: force", ch.Token)
+						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s on port 80 over tcp: force", ch.Token)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -494,7 +659,7 @@ func TestChallenge_Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s: force", ch.Token)
+						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s on port 80 over tcp: force", ch.Token)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -536,7 +701,7 @@ func TestChallenge_Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal:8080/.well-known/acme-challenge/%s: force", ch.Token)
+						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal:8080/.well-known/acme-challenge/%s on port 8080 over tcp: force", ch.Token)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -646,7 +811,7 @@ func TestChallenge_Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing TLS dial for %v:443: force", ch.Value)
+						err := NewError(ErrorConnectionType, "error doing TLS dial for %v:443 over tcp: force", ch.Value)
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
@@ -886,6 +1051,323 @@ func TestChallenge_Validate(t *testing.T) {
 	}
 }
 
+type mockMeter struct {
+	calls []mockMeterCall
+}
+
+type mockMeterCall struct {
+	typ     ChallengeType
+	outcome ValidationOutcome
+}
+
+func (m *mockMeter) ACMEChallengeValidated(typ ChallengeType, outcome ValidationOutcome, d time.Duration) {
+	m.calls = append(m.calls, mockMeterCall{typ, outcome})
+}
+
+func TestChallenge_Validate_meter(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	record := base64.RawURLEncoding.EncodeToString(h[:])
+
+	newChallenge := func(status Status) *Challenge {
+		return &Challenge{ID: "chID", Type: DNS01, Token: "token", Value: "zap.internal", Status: status}
+	}
+	lookup := func(records []string, err error) Client {
+		return &mockClient{lookupTxt: func(string) ([]string, error) { return records, err }}
+	}
+	okDB := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return nil }}
+	failDB := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return errors.New("force") }}
+
+	tests := []struct {
+		name    string
+		ch      *Challenge
+		vc      Client
+		db      DB
+		want    []mockMeterCall
+		wantErr bool
+	}{
+		{"valid", newChallenge(StatusPending), lookup([]string{record}, nil), okDB, []mockMeterCall{{DNS01, ValidationValid}}, false},
+		{"invalid", newChallenge(StatusPending), lookup(nil, errors.New("force")), okDB, []mockMeterCall{{DNS01, ValidationInvalid}}, false},
+		{"error", newChallenge(StatusPending), lookup([]string{record}, nil), failDB, []mockMeterCall{{DNS01, ValidationError}}, true},
+		{"already-valid", newChallenge(StatusValid), nil, nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockMeter{}
+			ctx := NewMeterContext(NewClientContext(context.Background(), tt.vc), m)
+			err := tt.ch.Validate(ctx, tt.db, jwk, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, m.calls)
+		})
+	}
+
+	// A noop meter is used if none is set.
+	assert.Equal(t, noopMeter{}, MustMeterFromContext(context.Background()))
+}
+
+type mockLogger struct {
+	level LogLevel
+	msg   string
+	kv    map[string]any
+	panic bool
+}
+
+func (m *mockLogger) Log(level LogLevel, msg string, kv ...any) {
+	if m.panic {
+		panic("logger failure")
+	}
+	m.level, m.msg = level, msg
+	m.kv = make(map[string]any)
+	for i := 0; i+1 < len(kv); i += 2 {
+		m.kv[kv[i].(string)] = kv[i+1]
+	}
+}
+
+func TestChallenge_Validate_logger(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	record := base64.RawURLEncoding.EncodeToString(h[:])
+
+	newChallenge := func() *Challenge {
+		return &Challenge{ID: "chID", AccountID: "accID", AuthorizationID: "azID", Type: DNS01, Token: "token", Value: "zap.internal", Status: StatusPending}
+	}
+	lookup := func(records []string, err error) Client {
+		return &mockClient{lookupTxt: func(string) ([]string, error) { return records, err }}
+	}
+	okDB := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return nil }}
+	failDB := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return errors.New("force") }}
+
+	tests := []struct {
+		name          string
+		vc            Client
+		db            DB
+		wantLevel     LogLevel
+		wantOutcome   ValidationOutcome
+		wantErrorType any
+		wantErr       bool
+	}{
+		{"valid", lookup([]string{record}, nil), okDB, LogLevelInfo, ValidationValid, nil, false},
+		{"invalid", lookup(nil, errors.New("force")), okDB, LogLevelWarn, ValidationInvalid, "urn:ietf:params:acme:error:dns", false},
+		{"error", lookup([]string{record}, nil), failDB, LogLevelError, ValidationError, "urn:ietf:params:acme:error:serverInternal", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &mockLogger{}
+			ctx := NewLoggerContext(NewClientContext(requestid.NewContext(context.Background(), "reqID"), tt.vc), l)
+			err := newChallenge().Validate(ctx, tt.db, jwk, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantLevel, l.level)
+			assert.Equal(t, "acme challenge validated", l.msg)
+			assert.Equal(t, "accID", l.kv["account-id"])
+			assert.Equal(t, "azID", l.kv["authorization-id"])
+			assert.Equal(t, "dns-01", l.kv["challenge-type"])
+			assert.Equal(t, "zap.internal", l.kv["target"])
+			assert.Equal(t, string(tt.wantOutcome), l.kv["outcome"])
+			assert.Equal(t, "reqID", l.kv["request-id"])
+			assert.Equal(t, tt.wantErrorType, l.kv["error-type"])
+			assert.IsType(t, time.Duration(0), l.kv["duration"])
+		})
+	}
+
+	// A failing logger does not break the validation.
+	ch := newChallenge()
+	ctx := NewLoggerContext(NewClientContext(context.Background(), lookup([]string{record}, nil)), &mockLogger{panic: true})
+	assert.NoError(t, ch.Validate(ctx, okDB, jwk, nil))
+	assert.Equal(t, StatusValid, ch.Status)
+
+	// A noop logger is used if none is set.
+	assert.Equal(t, noopLogger{}, MustLoggerFromContext(context.Background()))
+}
+
+type chanLogger chan string
+
+func (l chanLogger) Log(level LogLevel, msg string, kv ...any) {
+	l <- msg
+}
+
+func TestChallenge_Validate_transition(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	record := base64.RawURLEncoding.EncodeToString(h[:])
+
+	newChallenge := func(status Status) *Challenge {
+		return &Challenge{ID: "chID", Type: DNS01, Token: "token", Value: "zap.internal", Status: status}
+	}
+	lookup := func(records []string, err error) Client {
+		return &mockClient{lookupTxt: func(string) ([]string, error) { return records, err }}
+	}
+	okDB := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return nil }}
+	failDB := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return errors.New("force") }}
+
+	tests := []struct {
+		name    string
+		ch      *Challenge
+		vc      Client
+		db      DB
+		want    Status
+		wantErr bool
+	}{
+		{"valid", newChallenge(StatusPending), lookup([]string{record}, nil), okDB, StatusValid, false},
+		{"invalid", &Challenge{ID: "chID", Type: HTTP01, Token: "token", Value: "zap.internal", Status: StatusPending}, &mockClient{get: func(string) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(strings.Repeat("a", DefaultHTTP01MaxBodySize+1)))}, nil
+		}}, okDB, StatusInvalid, false},
+		{"still-pending", newChallenge(StatusPending), lookup(nil, errors.New("force")), okDB, "", false},
+		{"error", newChallenge(StatusPending), lookup([]string{record}, nil), failDB, "", true},
+		{"already-valid", newChallenge(StatusValid), nil, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type transition struct{ old, new Challenge }
+			ch := make(chan transition, 1)
+			ctx := NewChallengeTransitionContext(NewClientContext(context.Background(), tt.vc), func(old, new Challenge) {
+				ch <- transition{old, new}
+			})
+			err := tt.ch.Validate(ctx, tt.db, jwk, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.want == "" {
+				select {
+				case tr := <-ch:
+					t.Errorf("unexpected transition from %s to %s", tr.old.Status, tr.new.Status)
+				case <-time.After(50 * time.Millisecond):
+				}
+				return
+			}
+			select {
+			case tr := <-ch:
+				assert.Equal(t, StatusPending, tr.old.Status)
+				assert.Equal(t, tt.want, tr.new.Status)
+				assert.Equal(t, "chID", tr.new.ID)
+			case <-time.After(5 * time.Second):
+				t.Fatal("transition callback was not called")
+			}
+		})
+	}
+
+	// A panicking callback does not break the validation.
+	l := make(chanLogger, 2)
+	ctx := NewLoggerContext(NewClientContext(context.Background(), lookup([]string{record}, nil)), l)
+	ctx = NewChallengeTransitionContext(ctx, func(old, new Challenge) {
+		panic("callback failure")
+	})
+	c := newChallenge(StatusPending)
+	assert.NoError(t, c.Validate(ctx, okDB, jwk, nil))
+	assert.Equal(t, StatusValid, c.Status)
+	assert.Equal(t, "acme challenge validated", <-l)
+	select {
+	case msg := <-l:
+		assert.Equal(t, "acme challenge transition callback panicked", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic was not logged")
+	}
+}
+
+func TestChallenge_Validate_dnsPropagationWait(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	record := base64.RawURLEncoding.EncodeToString(h[:])
+
+	clk := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	defer func(c interface{ Now() time.Time }) { clock = c }(clock)
+	clock = clk
+
+	var lookups int
+	vc := &mockClient{lookupTxt: func(string) ([]string, error) {
+		lookups++
+		return []string{record}, nil
+	}}
+	var updates []Status
+	var stored *Challenge
+	db := &MockDB{
+		MockUpdateChallenge: func(_ context.Context, ch *Challenge) error {
+			updates = append(updates, ch.Status)
+			c := *ch
+			stored = &c
+			return nil
+		},
+		MockGetChallenge: func(_ context.Context, id, azID string) (*Challenge, error) {
+			assert.Equal(t, "chID", id)
+			assert.Equal(t, "azID", azID)
+			c := *stored
+			return &c, nil
+		},
+	}
+	var scheduled []func()
+	defer func(fn func(time.Duration, func())) { afterFunc = fn }(afterFunc)
+	afterFunc = func(d time.Duration, f func()) {
+		assert.Equal(t, time.Minute, d)
+		scheduled = append(scheduled, f)
+	}
+	prov := &MockProvisioner{MgetDNSPropagationWait: func() time.Duration { return time.Minute }}
+	ctx := NewProvisionerContext(NewClientContext(context.Background(), vc), prov)
+
+	// The first attempt only starts the wait.
+	ch := &Challenge{ID: "chID", AuthorizationID: "azID", Type: DNS01, Token: "token", Value: "zap.internal", Status: StatusPending}
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	assert.Len(t, scheduled, 1)
+	assert.Equal(t, StatusProcessing, ch.Status)
+	assert.Equal(t, clk.Now(), ch.ProcessingAt)
+	assert.Equal(t, time.Minute, ch.RetryAfter(ctx))
+	assert.Equal(t, []Status{StatusProcessing}, updates)
+	assert.Zero(t, lookups)
+
+	clk.Add(40 * time.Second)
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	assert.Equal(t, StatusProcessing, ch.Status)
+	assert.Equal(t, 20*time.Second, ch.RetryAfter(ctx))
+	assert.Zero(t, lookups)
+
+	// After the wait the TXT record is looked up.
+	clk.Add(20 * time.Second)
+	assert.Zero(t, ch.RetryAfter(ctx))
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	assert.Equal(t, StatusValid, ch.Status)
+	assert.Equal(t, 1, lookups)
+	assert.Zero(t, ch.RetryAfter(ctx))
+
+	// The scheduled validation skips the validated challenge.
+	scheduled[0]()
+	assert.Equal(t, 1, lookups)
+
+	// Without a new post, the scheduled validation validates the challenge.
+	clk.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduled = nil
+	ch = &Challenge{ID: "chID", AuthorizationID: "azID", Type: DNS01, Token: "token", Value: "zap.internal", Status: StatusPending}
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	require.Len(t, scheduled, 1)
+	clk.Add(time.Minute)
+	scheduled[0]()
+	assert.Equal(t, 2, lookups)
+	assert.Equal(t, StatusValid, stored.Status)
+
+	// Other challenges do not wait.
+	ch = &Challenge{ID: "chID", Type: HTTP01, Token: "token", Value: "zap.internal", Status: StatusPending}
+	assert.Zero(t, ch.propagationWait(ctx))
+}
+
 type errReader int
 
 func (errReader) Read([]byte) (int, error) {
@@ -895,6 +1377,101 @@ func (errReader) Close() error {
 	return nil
 }
 
+func TestHTTP01Validate_body(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       string
+		maxSize    int64
+		exactMatch bool
+		wantStatus Status
+		wantErr    *Error
+	}{
+		{"ok/trailing-newline", keyAuth + "\n", 0, false, StatusValid, nil},
+		{"ok/leading-space", " " + keyAuth, 0, false, StatusValid, nil},
+		{"ok/surrounding-whitespace", " \t" + keyAuth + "\r\n", 0, false, StatusValid, nil},
+		{"ok/max-size", keyAuth, int64(len(keyAuth)), false, StatusValid, nil},
+		{"ok/exact-match", keyAuth, 0, true, StatusValid, nil},
+		{"fail/exact-match-trailing-newline", keyAuth + "\n", 0, true, StatusInvalid,
+			NewError(ErrorRejectedIdentifierType, "keyAuthorization does not match; expected %s, but got %q", keyAuth, keyAuth+"\n")},
+		{"fail/exact-match-leading-space", " " + keyAuth, 0, true, StatusInvalid,
+			NewError(ErrorRejectedIdentifierType, "keyAuthorization does not match; expected %s, but got %q", keyAuth, " "+keyAuth)},
+		{"fail/mismatch-truncated", strings.Repeat("a", 1000), 0, false, StatusInvalid,
+			NewError(ErrorRejectedIdentifierType, "keyAuthorization does not match; expected %s, but got %q", keyAuth, strings.Repeat("a", maxObservedBodySize))},
+		{"fail/oversized", keyAuth + strings.Repeat(" ", DefaultHTTP01MaxBodySize), 0, false, StatusInvalid,
+			NewError(ErrorIncorrectResponseType, "response body for url http://zap.internal/.well-known/acme-challenge/token exceeds the maximum size of 65536 bytes")},
+		{"fail/oversized-configured", keyAuth + "\n", int64(len(keyAuth)), false, StatusInvalid,
+			NewError(ErrorIncorrectResponseType, "response body for url http://zap.internal/.well-known/acme-challenge/token exceeds the maximum size of %d bytes", len(keyAuth))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &Challenge{ID: "chID", Token: "token", Type: HTTP01, Value: "zap.internal", Status: StatusPending}
+			vc := &mockClient{get: func(string) (*http.Response, error) {
+				return &http.Response{Body: io.NopCloser(strings.NewReader(tt.body))}, nil
+			}}
+			db := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return nil }}
+			prov := &MockProvisioner{
+				MgetHTTP01MaxBodySize: func() int64 { return tt.maxSize },
+				MgetHTTP01ExactMatch:  func() bool { return tt.exactMatch },
+			}
+			ctx := NewProvisionerContext(NewClientContext(context.Background(), vc), prov)
+
+			require.NoError(t, http01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, tt.wantStatus, ch.Status)
+			if tt.wantErr == nil {
+				assert.Nil(t, ch.Error)
+				return
+			}
+			if assert.NotNil(t, ch.Error) {
+				assert.Equal(t, tt.wantErr.Type, ch.Error.Type)
+				assert.EqualError(t, ch.Error.Err, tt.wantErr.Err.Error())
+			}
+		})
+	}
+}
+
+func TestHTTP01Validate_port(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		value   string
+		port    int
+		wantURL string
+	}{
+		{"default", "zap.internal", 0, "http://zap.internal/.well-known/acme-challenge/token"},
+		{"port-80", "zap.internal", 80, "http://zap.internal/.well-known/acme-challenge/token"},
+		{"port-8080", "zap.internal", 8080, "http://zap.internal:8080/.well-known/acme-challenge/token"},
+		{"ipv6-port-8080", "::1", 8080, "http://[::1]:8080/.well-known/acme-challenge/token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &Challenge{ID: "chID", Token: "token", Type: HTTP01, Value: tt.value, Status: StatusPending}
+			vc := &mockClient{get: func(u string) (*http.Response, error) {
+				assert.Equal(t, tt.wantURL, u)
+				return nil, errors.New("force")
+			}}
+			db := &MockDB{MockUpdateChallenge: func(context.Context, *Challenge) error { return nil }}
+			prov := &MockProvisioner{MgetHTTP01Port: func() int { return tt.port }}
+			ctx := NewProvisionerContext(NewClientContext(context.Background(), vc), prov)
+
+			require.NoError(t, http01Validate(ctx, ch, db, jwk))
+			if assert.NotNil(t, ch.Error) {
+				wantPort := strconv.Itoa(tt.port)
+				if tt.port == 0 {
+					wantPort = "80"
+				}
+				assert.EqualError(t, ch.Error.Err, "error doing http GET for url "+tt.wantURL+" on port "+wantPort+" over tcp: force")
+			}
+		})
+	}
+}
+
 func TestHTTP01Validate(t *testing.T) {
 	type test struct {
 		vc  Client
@@ -926,7 +1503,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s: force", ch.Token)
+						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s on port 80 over tcp: force", ch.Token)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -961,7 +1538,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s: force", ch.Token)
+						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s on port 80 over tcp: force", ch.Token)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -998,7 +1575,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s with status code 400", ch.Token)
+						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s on port 80 with status code 400", ch.Token)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -1036,7 +1613,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, "zap.internal", updch.Value)
 						assert.Equal(t, StatusPending, updch.Status)
 
-						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s with status code 400", ch.Token)
+						err := NewError(ErrorConnectionType, "error doing http GET for url http://zap.internal/.well-known/acme-challenge/%s on port 80 with status code 400", ch.Token)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -1048,6 +1625,64 @@ func TestHTTP01Validate(t *testing.T) {
 				},
 			}
 		},
+		"ok/http-get->=400-after-redirect": func(t *testing.T) test {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  "zap.internal",
+				Status: StatusPending,
+			}
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					get: func(u string) (*http.Response, error) {
+						return &http.Response{
+							StatusCode: http.StatusNotFound,
+							Body:       errReader(0),
+							Request: &http.Request{
+								URL: &url.URL{Scheme: "https", Host: "zap.internal", Path: "/.well-known/acme-challenge/token"},
+							},
+						}, nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusPending, updch.Status)
+
+						err := NewError(ErrorConnectionType, "error doing http GET for url https://zap.internal/.well-known/acme-challenge/%s on port 443 with status code 404", ch.Token)
+						assert.EqualError(t, updch.Error.Err, err.Err.Error())
+						assert.Equal(t, err.Type, updch.Error.Type)
+						return nil
+					},
+				},
+			}
+		},
+		"ok/http-get-redirect-error": func(t *testing.T) test {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  "zap.internal",
+				Status: StatusPending,
+			}
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					get: func(u string) (*http.Response, error) {
+						return nil, &url.Error{Op: "Get", URL: "https://zap.internal:8443/.well-known/acme-challenge/token", Err: errors.New("redirect to unsupported port 8443")}
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusPending, updch.Status)
+						assert.Equal(t, NewError(ErrorConnectionType, "").Type, updch.Error.Type)
+						assert.Contains(t, updch.Error.Err.Error(), "error doing http GET for url https://zap.internal:8443/.well-known/acme-challenge/token")
+						return nil
+					},
+				},
+			}
+		},
 		"fail/read-body": func(t *testing.T) test {
 			ch := &Challenge{
 				ID:     "chID",
@@ -1089,7 +1724,7 @@ func TestHTTP01Validate(t *testing.T) {
 					},
 				},
 				jwk: jwk,
-				err: NewErrorISE("error generating JWK thumbprint: go-jose/go-jose: unknown key type 'string'"),
+				err: NewErrorISE("error generating JWK thumbprint: unsupported account key type string"),
 			}
 		},
 		"ok/key-auth-mismatch": func(t *testing.T) test {
@@ -1123,7 +1758,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, StatusInvalid, updch.Status)
 
 						err := NewError(ErrorRejectedIdentifierType,
-							"keyAuthorization does not match; expected %s, but got foo", expKeyAuth)
+							"keyAuthorization does not match; expected %s, but got \"foo\"", expKeyAuth)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -1166,7 +1801,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, StatusInvalid, updch.Status)
 
 						err := NewError(ErrorRejectedIdentifierType,
-							"keyAuthorization does not match; expected %s, but got foo", expKeyAuth)
+							"keyAuthorization does not match; expected %s, but got \"foo\"", expKeyAuth)
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
@@ -1389,7 +2024,7 @@ func TestDNS01Validate(t *testing.T) {
 					},
 				},
 				jwk: jwk,
-				err: NewErrorISE("error generating JWK thumbprint: go-jose/go-jose: unknown key type 'string'"),
+				err: NewErrorISE("error generating JWK thumbprint: unsupported account key type string"),
 			}
 		},
 		"fail/key-auth-mismatch-store-error": func(t *testing.T) test {
@@ -1564,31 +2199,461 @@ func TestDNS01Validate(t *testing.T) {
 				jwk: jwk,
 			}
 		},
-	}
-	for name, run := range tests {
-		t.Run(name, func(t *testing.T) {
-			tc := run(t)
-			ctx := NewClientContext(context.Background(), tc.vc)
-			if err := dns01Validate(ctx, tc.ch, tc.db, tc.jwk); err != nil {
-				if assert.Error(t, tc.err) {
-					var k *Error
-					if errors.As(err, &k) {
-						assert.Equal(t, tc.err.Type, k.Type)
-						assert.Equal(t, tc.err.Detail, k.Detail)
-						assert.Equal(t, tc.err.Status, k.Status)
-						assert.Equal(t, tc.err.Err.Error(), k.Err.Error())
-					} else {
-						assert.Fail(t, "unexpected error type")
-					}
-				}
-			} else {
-				assert.Nil(t, tc.err)
+		"ok/quoted": func(t *testing.T) test {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  fulldomain,
+				Status: StatusPending,
 			}
-		})
-	}
-}
 
-type tlsDialer func(network, addr string, config *tls.Config) (conn *tls.Conn, err error)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			require.NoError(t, err)
+
+			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+			require.NoError(t, err)
+			h := sha256.Sum256([]byte(expKeyAuth))
+			expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					lookupTxt: func(url string) ([]string, error) {
+						return []string{"foo", `"` + expected + `"`}, nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, "chID", updch.ID)
+						assert.Equal(t, "token", updch.Token)
+						assert.Equal(t, fulldomain, updch.Value)
+						assert.Equal(t, StatusValid, updch.Status)
+						assert.Nil(t, updch.Error)
+
+						va, err := time.Parse(time.RFC3339, updch.ValidatedAt)
+						require.NoError(t, err)
+						now := clock.Now()
+						assert.True(t, va.Add(-time.Minute).Before(now))
+						assert.True(t, va.Add(time.Minute).After(now))
+
+						return nil
+					},
+				},
+				jwk: jwk,
+			}
+		},
+		"ok/whitespace": func(t *testing.T) test {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  fulldomain,
+				Status: StatusPending,
+			}
+
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			require.NoError(t, err)
+
+			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+			require.NoError(t, err)
+			h := sha256.Sum256([]byte(expKeyAuth))
+			expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					lookupTxt: func(url string) ([]string, error) {
+						return []string{"foo", " " + expected + "\t\n"}, nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, "chID", updch.ID)
+						assert.Equal(t, "token", updch.Token)
+						assert.Equal(t, fulldomain, updch.Value)
+						assert.Equal(t, StatusValid, updch.Status)
+						assert.Nil(t, updch.Error)
+
+						va, err := time.Parse(time.RFC3339, updch.ValidatedAt)
+						require.NoError(t, err)
+						now := clock.Now()
+						assert.True(t, va.Add(-time.Minute).Before(now))
+						assert.True(t, va.Add(time.Minute).After(now))
+
+						return nil
+					},
+				},
+				jwk: jwk,
+			}
+		},
+		"ok/chunked": func(t *testing.T) test {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  fulldomain,
+				Status: StatusPending,
+			}
+
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			require.NoError(t, err)
+
+			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+			require.NoError(t, err)
+			h := sha256.Sum256([]byte(expKeyAuth))
+			expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					lookupTxt: func(url string) ([]string, error) {
+						return []string{"foo", `"` + expected[:20] + `" "` + expected[20:] + `"`}, nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, "chID", updch.ID)
+						assert.Equal(t, "token", updch.Token)
+						assert.Equal(t, fulldomain, updch.Value)
+						assert.Equal(t, StatusValid, updch.Status)
+						assert.Nil(t, updch.Error)
+
+						va, err := time.Parse(time.RFC3339, updch.ValidatedAt)
+						require.NoError(t, err)
+						now := clock.Now()
+						assert.True(t, va.Add(-time.Minute).Before(now))
+						assert.True(t, va.Add(time.Minute).After(now))
+
+						return nil
+					},
+				},
+				jwk: jwk,
+			}
+		},
+	}
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := run(t)
+			ctx := NewClientContext(context.Background(), tc.vc)
+			if err := dns01Validate(ctx, tc.ch, tc.db, tc.jwk); err != nil {
+				if assert.Error(t, tc.err) {
+					var k *Error
+					if errors.As(err, &k) {
+						assert.Equal(t, tc.err.Type, k.Type)
+						assert.Equal(t, tc.err.Detail, k.Detail)
+						assert.Equal(t, tc.err.Status, k.Status)
+						assert.Equal(t, tc.err.Err.Error(), k.Err.Error())
+					} else {
+						assert.Fail(t, "unexpected error type")
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
+
+func Test_dns01Validate_prefix(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	expKeyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(expKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	tests := []struct {
+		name   string
+		prefix string
+		value  string
+		want   string
+	}{
+		{"default", "", "zap.internal", "_acme-challenge.zap.internal"},
+		{"default/wildcard", "", "*.zap.internal", "_acme-challenge.zap.internal"},
+		{"prefix", "_acme-challenge.tenant1", "zap.internal", "_acme-challenge.tenant1.zap.internal"},
+		{"prefix/wildcard", "_acme-challenge.tenant1", "*.zap.internal", "_acme-challenge.tenant1.zap.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			ctx := NewClientContext(context.Background(), &mockClient{
+				lookupTxt: func(name string) ([]string, error) {
+					names = append(names, name)
+					return []string{expected}, nil
+				},
+			})
+			ctx = NewProvisionerContext(ctx, &MockProvisioner{
+				MgetDNSChallengePrefix: func() string { return tt.prefix },
+			})
+			ch := &Challenge{ID: "chID", Token: "token", Value: tt.value, Type: DNS01, Status: StatusPending}
+			db := &MockDB{
+				MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+					return nil
+				},
+			}
+			require.NoError(t, dns01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, StatusValid, ch.Status)
+			assert.Equal(t, []string{tt.want}, names)
+		})
+	}
+}
+
+func Test_dns01Validate_name(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	expKeyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(expKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	// Challenges of team1.example.com subdomains are published on the
+	// delegated team1.example.com zone.
+	prov := &provisioner.ACME{
+		Type:               "ACME",
+		Name:               "acme",
+		DNSChallengePrefix: "_acme-challenge",
+		DNSChallengeName:   `{{ .Prefix }}.{{ if hasSuffix ".team1.example.com" .Domain }}{{ .Domain | trimSuffix ".team1.example.com" | replace "." "-" }}.team1.example.com{{ else }}{{ .Domain }}{{ end }}`,
+	}
+	require.NoError(t, prov.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"default", "example.com", "_acme-challenge.example.com"},
+		{"delegated", "www.team1.example.com", "_acme-challenge.www.team1.example.com"},
+		{"delegated/nested", "api.eu.team1.example.com", "_acme-challenge.api-eu.team1.example.com"},
+		{"delegated/wildcard", "*.eu.team1.example.com", "_acme-challenge.eu.team1.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			ctx := NewClientContext(context.Background(), &mockClient{
+				lookupTxt: func(name string) ([]string, error) {
+					names = append(names, name)
+					return []string{expected}, nil
+				},
+			})
+			ctx = NewProvisionerContext(ctx, prov)
+			ch := &Challenge{ID: "chID", Token: "token", Value: tt.value, Type: DNS01, Status: StatusPending}
+			db := &MockDB{
+				MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+					return nil
+				},
+			}
+			require.NoError(t, dns01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, StatusValid, ch.Status)
+			assert.Equal(t, []string{tt.want}, names)
+
+			network, addr, err := ch.ValidationTarget(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, "dns", network)
+			assert.Equal(t, tt.want, addr)
+		})
+	}
+
+	// A failing template is an internal error.
+	ctx := NewProvisionerContext(context.Background(), &MockProvisioner{
+		MgetDNSChallengeName: func(string, string) (string, error) { return "", errors.New("force") },
+	})
+	ch := &Challenge{ID: "chID", Token: "token", Value: "example.com", Type: DNS01, Status: StatusPending}
+	err = dns01Validate(ctx, ch, &MockDB{}, jwk)
+	assert.EqualError(t, err, "error computing the dns-01 record name: force")
+	assert.Equal(t, StatusPending, ch.Status)
+}
+
+// contextTxtClient is a mockClient that passes the context to the TXT
+// lookups.
+type contextTxtClient struct {
+	mockClient
+	lookupTxtContext func(ctx context.Context, name string) ([]string, error)
+}
+
+func (m *contextTxtClient) LookupTxt(ctx context.Context, name string) ([]string, error) {
+	return m.lookupTxtContext(ctx, name)
+}
+
+func Test_dns01Validate_lookupRetry(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	expKeyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(expKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	var backoffs []time.Duration
+	defer func(fn func(int, time.Duration, time.Duration) time.Duration) {
+		dnsLookupBackoff = fn
+	}(dnsLookupBackoff)
+	backoff := dnsLookupBackoff
+	dnsLookupBackoff = func(retry int, initial, maxBackoff time.Duration) time.Duration {
+		backoffs = append(backoffs, backoff(retry, initial, maxBackoff))
+		return 0
+	}
+
+	retry := &provisioner.ACMEDNSLookupRetry{
+		Attempts:   3,
+		Timeout:    &provisioner.Duration{Duration: 50 * time.Millisecond},
+		Backoff:    &provisioner.Duration{Duration: time.Second},
+		MaxBackoff: &provisioner.Duration{Duration: 3 * time.Second},
+	}
+	tests := []struct {
+		name         string
+		lookups      []func(context.Context) ([]string, error)
+		wantStatus   Status
+		wantErr      string
+		wantBackoffs []time.Duration
+	}{
+		{"ok/transient-error", []func(context.Context) ([]string, error){
+			func(context.Context) ([]string, error) { return nil, errors.New("i/o timeout") },
+			func(context.Context) ([]string, error) { return []string{expected}, nil },
+		}, StatusValid, "", []time.Duration{time.Second}},
+		{"ok/slow-lookup", []func(context.Context) ([]string, error){
+			func(ctx context.Context) ([]string, error) { <-ctx.Done(); return nil, ctx.Err() },
+			func(context.Context) ([]string, error) { return []string{expected}, nil },
+		}, StatusValid, "", []time.Duration{time.Second}},
+		{"fail/slow-lookups", []func(context.Context) ([]string, error){
+			func(ctx context.Context) ([]string, error) { <-ctx.Done(); return nil, ctx.Err() },
+			func(ctx context.Context) ([]string, error) { <-ctx.Done(); return nil, ctx.Err() },
+			func(ctx context.Context) ([]string, error) { <-ctx.Done(); return nil, ctx.Err() },
+		}, StatusPending, "lookup _acme-challenge.zap.internal: timed out after 50ms", []time.Duration{time.Second, 2 * time.Second}},
+		{"fail/exhausted", []func(context.Context) ([]string, error){
+			func(context.Context) ([]string, error) { return nil, errors.New("first") },
+			func(context.Context) ([]string, error) { return nil, errors.New("second") },
+			func(context.Context) ([]string, error) { return nil, errors.New("third") },
+		}, StatusPending, "error looking up TXT records for domain zap.internal: third", []time.Duration{time.Second, 2 * time.Second}},
+		{"fail/mismatch-not-retried", []func(context.Context) ([]string, error){
+			func(context.Context) ([]string, error) { return []string{"foo"}, nil },
+		}, StatusPending, "keyAuthorization does not match", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backoffs = nil
+			var lookups atomic.Int32
+			ctx := NewClientContext(context.Background(), &contextTxtClient{
+				lookupTxtContext: func(ctx context.Context, name string) ([]string, error) {
+					assert.Equal(t, "_acme-challenge.zap.internal", name)
+					return tt.lookups[lookups.Add(1)-1](ctx)
+				},
+			})
+			ctx = NewProvisionerContext(ctx, &MockProvisioner{
+				MgetDNSLookupRetry: func() *provisioner.ACMEDNSLookupRetry { return retry },
+			})
+			ch := &Challenge{ID: "chID", Token: "token", Value: "zap.internal", Type: DNS01, Status: StatusPending}
+			db := &MockDB{
+				MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+					return nil
+				},
+			}
+			require.NoError(t, dns01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, len(tt.lookups), int(lookups.Load()))
+			assert.Equal(t, tt.wantBackoffs, backoffs)
+			assert.Equal(t, tt.wantStatus, ch.Status)
+			if tt.wantErr != "" {
+				require.NotNil(t, ch.Error)
+				assert.ErrorContains(t, ch.Error.Err, tt.wantErr)
+			} else {
+				assert.Nil(t, ch.Error)
+			}
+		})
+	}
+}
+
+func Test_dnsLookupBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, dnsLookupBackoff(1, time.Second, 10*time.Second))
+	assert.Equal(t, 2*time.Second, dnsLookupBackoff(2, time.Second, 10*time.Second))
+	assert.Equal(t, 8*time.Second, dnsLookupBackoff(4, time.Second, 10*time.Second))
+	assert.Equal(t, 10*time.Second, dnsLookupBackoff(5, time.Second, 10*time.Second))
+	assert.Equal(t, 10*time.Second, dnsLookupBackoff(100, time.Second, 10*time.Second))
+}
+
+func Test_dns01Validate_quorum(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	expKeyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(expKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	servers := []string{"ns1.zap.internal:53", "ns2.zap.internal:53", "ns3.zap.internal:53"}
+	tests := []struct {
+		name       string
+		quorum     provisioner.ACMEDNSQuorum
+		lookupNS   func(name string) ([]string, error)
+		records    map[string][]string
+		wantStatus Status
+		wantErr    *Error
+	}{
+		{"ok/all", provisioner.DNSQuorumAll, nil, map[string][]string{
+			"ns1.zap.internal:53": {expected}, "ns2.zap.internal:53": {"other", expected}, "ns3.zap.internal:53": {`"` + expected + `"`},
+		}, StatusValid, nil},
+		{"ok/majority", provisioner.DNSQuorumMajority, nil, map[string][]string{
+			"ns1.zap.internal:53": {expected}, "ns3.zap.internal:53": {expected},
+		}, StatusValid, nil},
+		{"ok/majority-with-error", provisioner.DNSQuorumMajority, nil, map[string][]string{
+			"ns1.zap.internal:53": {expected}, "ns2.zap.internal:53": {expected}, "ns3.zap.internal:53": nil,
+		}, StatusValid, nil},
+		{"fail/all", provisioner.DNSQuorumAll, nil, map[string][]string{
+			"ns1.zap.internal:53": {expected}, "ns2.zap.internal:53": {expected}, "ns3.zap.internal:53": {"stale"},
+		}, StatusPending, NewError(ErrorRejectedIdentifierType,
+			"keyAuthorization %s found on 2 of 3 nameservers, 3 required; disagreeing nameservers: ns3.zap.internal:53", expKeyAuth)},
+		{"fail/majority", provisioner.DNSQuorumMajority, nil, map[string][]string{
+			"ns1.zap.internal:53": {expected}, "ns2.zap.internal:53": {"stale"}, "ns3.zap.internal:53": nil,
+		}, StatusPending, NewError(ErrorRejectedIdentifierType,
+			"keyAuthorization %s found on 1 of 3 nameservers, 2 required; disagreeing nameservers: ns2.zap.internal:53, ns3.zap.internal:53 (force)", expKeyAuth)},
+		{"fail/lookupNS", provisioner.DNSQuorumAll, func(name string) ([]string, error) {
+			return nil, errors.New("force")
+		}, nil, StatusPending, NewError(ErrorDNSType, "error looking up nameservers for domain zap.internal: force")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupNS := tt.lookupNS
+			if lookupNS == nil {
+				lookupNS = func(name string) ([]string, error) {
+					assert.Equal(t, "_acme-challenge.zap.internal", name)
+					return servers, nil
+				}
+			}
+			ctx := NewClientContext(context.Background(), &mockClient{
+				lookupTxt: func(name string) ([]string, error) {
+					t.Fatal("unexpected call to LookupTxt")
+					return nil, nil
+				},
+				lookupNS: lookupNS,
+				lookupTxtOn: func(server, name string) ([]string, error) {
+					assert.Equal(t, "_acme-challenge.zap.internal", name)
+					records, ok := tt.records[server]
+					switch {
+					case ok && records == nil:
+						return nil, errors.New("force")
+					default:
+						return records, nil
+					}
+				},
+			})
+			ctx = NewProvisionerContext(ctx, &MockProvisioner{
+				MgetDNSChallengeQuorum: func() provisioner.ACMEDNSQuorum { return tt.quorum },
+			})
+			ch := &Challenge{ID: "chID", Token: "token", Value: "zap.internal", Type: DNS01, Status: StatusPending}
+			db := &MockDB{
+				MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+					return nil
+				},
+			}
+			require.NoError(t, dns01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, tt.wantStatus, ch.Status)
+			if tt.wantErr == nil {
+				assert.Nil(t, ch.Error)
+				return
+			}
+			if assert.NotNil(t, ch.Error) {
+				assert.Equal(t, tt.wantErr.Type, ch.Error.Type)
+				assert.EqualError(t, ch.Error.Err, tt.wantErr.Err.Error())
+			}
+		})
+	}
+}
+
+type tlsDialer func(network, addr string, config *tls.Config) (conn *tls.Conn, err error)
 
 func newTestTLSALPNServer(validationCert *tls.Certificate, opts ...func(*httptest.Server)) (*httptest.Server, tlsDialer) {
 	srv := httptest.NewUnstartedServer(http.NewServeMux())
@@ -1660,7 +2725,7 @@ func newTLSALPNValidationCert(keyAuthHash []byte, obsoleteOID, critical bool, na
 	}
 
 	if keyAuthHash != nil {
-		oid := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+		oid := OIDACMEIdentifier
 		if obsoleteOID {
 			oid = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 30, 1}
 		}
@@ -1687,6 +2752,46 @@ func newTLSALPNValidationCert(keyAuthHash []byte, obsoleteOID, critical bool, na
 	}, nil
 }
 
+func TestNewTLSALPNCertificate(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+
+	for _, name := range []string{"zap.internal", "127.0.0.1"} {
+		t.Run(name, func(t *testing.T) {
+			cert, err := NewTLSALPNCertificate(keyAuth, name)
+			require.NoError(t, err)
+			var found bool
+			for _, ext := range cert.Leaf.Extensions {
+				if ext.Id.Equal(OIDACMEIdentifier) {
+					found = true
+					assert.True(t, ext.Critical)
+				}
+			}
+			assert.True(t, found)
+
+			srv, tlsDial := newTestTLSALPNServer(cert)
+			srv.Start()
+			defer srv.Close()
+
+			ch := &Challenge{ID: "chID", Token: "token", Type: "tls-alpn-01", Status: StatusPending, Value: name}
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+				assert.Nil(t, updch.Error)
+				return nil
+			}}
+			ctx := NewClientContext(context.Background(), &mockClient{tlsDial: tlsDial})
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, StatusValid, ch.Status)
+		})
+	}
+
+	_, err = NewTLSALPNCertificate(keyAuth)
+	assert.EqualError(t, err, "tls-alpn-01 certificate requires exactly one name, got 0")
+	_, err = NewTLSALPNCertificate(keyAuth, "foo.internal", "bar.internal")
+	assert.EqualError(t, err, "tls-alpn-01 certificate requires exactly one name, got 2")
+}
+
 func TestTLSALPN01Validate(t *testing.T) {
 	makeTLSCh := func() *Challenge {
 		return &Challenge{
@@ -1723,7 +2828,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
 						assert.Equal(t, "zap.internal", updch.Value)
 
-						err := NewError(ErrorConnectionType, "error doing TLS dial for %v:443: force", ch.Value)
+						err := NewError(ErrorConnectionType, "error doing TLS dial for %v:443 over tcp: force", ch.Value)
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
@@ -1754,7 +2859,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
 						assert.Equal(t, "zap.internal", updch.Value)
 
-						err := NewError(ErrorConnectionType, "error doing TLS dial for %v:443: force", ch.Value)
+						err := NewError(ErrorConnectionType, "error doing TLS dial for %v:443 over tcp: force", ch.Value)
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
@@ -1786,7 +2891,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
 						assert.Equal(t, "zap.internal", updch.Value)
 
-						err := NewError(ErrorConnectionType, "error doing TLS dial for %v:443: context deadline exceeded", ch.Value)
+						err := NewError(ErrorConnectionType, "timeout doing TLS dial for %v:443 over tcp: context deadline exceeded", ch.Value)
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
@@ -1807,7 +2912,75 @@ func TestTLSALPN01Validate(t *testing.T) {
 				ch: ch,
 				vc: &mockClient{
 					tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
-						return tls.Client(&noopConn{}, config), nil
+						return tls.Client(&noopConn{}, config), nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, "chID", updch.ID)
+						assert.Equal(t, "token", updch.Token)
+						assert.Equal(t, StatusInvalid, updch.Status)
+						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
+						assert.Equal(t, "zap.internal", updch.Value)
+
+						err := NewError(ErrorRejectedIdentifierType, "tls-alpn-01 challenge for %v resulted in no certificates", ch.Value)
+
+						assert.EqualError(t, updch.Error.Err, err.Err.Error())
+						assert.Equal(t, err.Type, updch.Error.Type)
+						assert.Equal(t, err.Detail, updch.Error.Detail)
+						assert.Equal(t, err.Status, updch.Error.Status)
+						assert.Equal(t, err.Subproblems, updch.Error.Subproblems)
+
+						return nil
+					},
+				},
+			}
+		},
+		"fail/no-certificates-store-error": func(t *testing.T) test {
+			ch := makeTLSCh()
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+						return tls.Client(&noopConn{}, config), nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, "chID", updch.ID)
+						assert.Equal(t, "token", updch.Token)
+						assert.Equal(t, StatusInvalid, updch.Status)
+						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
+						assert.Equal(t, "zap.internal", updch.Value)
+
+						err := NewError(ErrorRejectedIdentifierType, "tls-alpn-01 challenge for %v resulted in no certificates", ch.Value)
+
+						assert.EqualError(t, updch.Error.Err, err.Err.Error())
+						assert.Equal(t, err.Type, updch.Error.Type)
+						assert.Equal(t, err.Detail, updch.Error.Detail)
+						assert.Equal(t, err.Status, updch.Error.Status)
+						assert.Equal(t, err.Subproblems, updch.Error.Subproblems)
+
+						return errors.New("force")
+					},
+				},
+				err: NewErrorISE("failure saving error to acme challenge: force"),
+			}
+		},
+		"ok/error-no-protocol": func(t *testing.T) test {
+			ch := makeTLSCh()
+
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			require.NoError(t, err)
+
+			srv := httptest.NewTLSServer(nil)
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+						return tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", srv.Listener.Addr().String(), config)
 					},
 				},
 				db: &MockDB{
@@ -1818,7 +2991,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
 						assert.Equal(t, "zap.internal", updch.Value)
 
-						err := NewError(ErrorRejectedIdentifierType, "tls-alpn-01 challenge for %v resulted in no certificates", ch.Value)
+						err := NewError(ErrorTLSType, "cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge: server has no protocol in common")
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
@@ -1829,16 +3002,23 @@ func TestTLSALPN01Validate(t *testing.T) {
 						return nil
 					},
 				},
+				srv: srv,
+				jwk: jwk,
 			}
 		},
-		"fail/no-certificates-store-error": func(t *testing.T) test {
+		"fail/no-protocol-store-error": func(t *testing.T) test {
 			ch := makeTLSCh()
 
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			require.NoError(t, err)
+
+			srv := httptest.NewTLSServer(nil)
+
 			return test{
 				ch: ch,
 				vc: &mockClient{
 					tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
-						return tls.Client(&noopConn{}, config), nil
+						return tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", srv.Listener.Addr().String(), config)
 					},
 				},
 				db: &MockDB{
@@ -1849,7 +3029,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
 						assert.Equal(t, "zap.internal", updch.Value)
 
-						err := NewError(ErrorRejectedIdentifierType, "tls-alpn-01 challenge for %v resulted in no certificates", ch.Value)
+						err := NewError(ErrorTLSType, "cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge: server has no protocol in common")
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
@@ -1860,39 +3040,44 @@ func TestTLSALPN01Validate(t *testing.T) {
 						return errors.New("force")
 					},
 				},
+				srv: srv,
+				jwk: jwk,
 				err: NewErrorISE("failure saving error to acme challenge: force"),
 			}
 		},
-		"ok/error-no-protocol": func(t *testing.T) test {
+		"ok/only-http11-error": func(t *testing.T) test {
 			ch := makeTLSCh()
 
 			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
 			require.NoError(t, err)
 
-			srv := httptest.NewTLSServer(nil)
+			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+			require.NoError(t, err)
+			expKeyAuthHash := sha256.Sum256([]byte(expKeyAuth))
+
+			cert, err := newTLSALPNValidationCert(expKeyAuthHash[:], false, true, ch.Value)
+			require.NoError(t, err)
+
+			srv, tlsDial := newTestTLSALPNServer(cert, func(srv *httptest.Server) {
+				srv.TLS.NextProtos = []string{"http/1.1"}
+			})
+			srv.Start()
 
 			return test{
 				ch: ch,
 				vc: &mockClient{
-					tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
-						return tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", srv.Listener.Addr().String(), config)
-					},
+					tlsDial: tlsDial,
 				},
 				db: &MockDB{
 					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
-						assert.Equal(t, "chID", updch.ID)
-						assert.Equal(t, "token", updch.Token)
 						assert.Equal(t, StatusInvalid, updch.Status)
-						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
-						assert.Equal(t, "zap.internal", updch.Value)
 
-						err := NewError(ErrorRejectedIdentifierType, "cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge")
+						err := NewError(ErrorTLSType, "cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge: server has no protocol in common")
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
 						assert.Equal(t, err.Status, updch.Error.Status)
-						assert.Equal(t, err.Subproblems, updch.Error.Subproblems)
 
 						return nil
 					},
@@ -1901,43 +3086,45 @@ func TestTLSALPN01Validate(t *testing.T) {
 				jwk: jwk,
 			}
 		},
-		"fail/no-protocol-store-error": func(t *testing.T) test {
+		"ok/no-alpn-error": func(t *testing.T) test {
 			ch := makeTLSCh()
 
 			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
 			require.NoError(t, err)
 
-			srv := httptest.NewTLSServer(nil)
+			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+			require.NoError(t, err)
+			expKeyAuthHash := sha256.Sum256([]byte(expKeyAuth))
+
+			cert, err := newTLSALPNValidationCert(expKeyAuthHash[:], false, true, ch.Value)
+			require.NoError(t, err)
+
+			srv, tlsDial := newTestTLSALPNServer(cert, func(srv *httptest.Server) {
+				srv.TLS.NextProtos = nil
+			})
+			srv.Start()
 
 			return test{
 				ch: ch,
 				vc: &mockClient{
-					tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
-						return tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", srv.Listener.Addr().String(), config)
-					},
+					tlsDial: tlsDial,
 				},
 				db: &MockDB{
 					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
-						assert.Equal(t, "chID", updch.ID)
-						assert.Equal(t, "token", updch.Token)
 						assert.Equal(t, StatusInvalid, updch.Status)
-						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
-						assert.Equal(t, "zap.internal", updch.Value)
 
-						err := NewError(ErrorRejectedIdentifierType, "cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge")
+						err := NewError(ErrorTLSType, "cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge: server did not negotiate any protocol")
 
 						assert.EqualError(t, updch.Error.Err, err.Err.Error())
 						assert.Equal(t, err.Type, updch.Error.Type)
 						assert.Equal(t, err.Detail, updch.Error.Detail)
 						assert.Equal(t, err.Status, updch.Error.Status)
-						assert.Equal(t, err.Subproblems, updch.Error.Subproblems)
 
-						return errors.New("force")
+						return nil
 					},
 				},
 				srv: srv,
 				jwk: jwk,
-				err: NewErrorISE("failure saving error to acme challenge: force"),
 			}
 		},
 		"ok/no-names-nor-ips-error": func(t *testing.T) test {
@@ -2141,7 +3328,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 				},
 				srv: srv,
 				jwk: jwk,
-				err: NewErrorISE("error generating JWK thumbprint: go-jose/go-jose: unknown key type 'string'"),
+				err: NewErrorISE("error generating JWK thumbprint: unsupported account key type string"),
 			}
 		},
 		"ok/error-no-extension": func(t *testing.T) test {
@@ -2618,44 +3805,6 @@ func TestTLSALPN01Validate(t *testing.T) {
 				jwk: jwk,
 			}
 		},
-		"ok/ip": func(t *testing.T) test {
-			ch := makeTLSCh()
-			ch.Value = "127.0.0.1"
-
-			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
-			require.NoError(t, err)
-
-			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
-			require.NoError(t, err)
-			expKeyAuthHash := sha256.Sum256([]byte(expKeyAuth))
-
-			cert, err := newTLSALPNValidationCert(expKeyAuthHash[:], false, true, ch.Value)
-			require.NoError(t, err)
-
-			srv, tlsDial := newTestTLSALPNServer(cert)
-			srv.Start()
-
-			return test{
-				ch: ch,
-				vc: &mockClient{
-					tlsDial: tlsDial,
-				},
-				db: &MockDB{
-					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
-						assert.Equal(t, "chID", updch.ID)
-						assert.Equal(t, "token", updch.Token)
-						assert.Equal(t, StatusValid, updch.Status)
-						assert.Equal(t, ChallengeType("tls-alpn-01"), updch.Type)
-						assert.Equal(t, "127.0.0.1", updch.Value)
-						assert.Nil(t, updch.Error)
-
-						return nil
-					},
-				},
-				srv: srv,
-				jwk: jwk,
-			}
-		},
 	}
 	for name, run := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -2686,6 +3835,329 @@ func TestTLSALPN01Validate(t *testing.T) {
 	}
 }
 
+func TestTLSALPN01Validate_ip(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	keyAuthHash := sha256.Sum256([]byte(keyAuth))
+
+	newCert := func(names ...string) *tls.Certificate {
+		cert, err := NewTLSALPNCertificate(keyAuth, names...)
+		require.NoError(t, err)
+		return cert
+	}
+	// newDNSCert returns a certificate with the names as DNS names, even if
+	// they are IP addresses.
+	newDNSCert := func(names ...string) *tls.Certificate {
+		cert, err := newTLSALPNValidationCert(keyAuthHash[:], false, true, names...)
+		require.NoError(t, err)
+		return cert
+	}
+	ipError := func(value string) error {
+		return fmt.Errorf("incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address, %s", value)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		cert    *tls.Certificate
+		wantErr error
+	}{
+		{"ok/ipv4", "127.0.0.1", newCert("127.0.0.1"), nil},
+		{"ok/ipv6", "::1", newCert("::1"), nil},
+		{"ok/ipv6-expanded", "0:0:0:0:0:0:0:1", newCert("::1"), nil},
+		{"fail/ipv4-as-dns-name", "127.0.0.1", newDNSCert("127.0.0.1"), ipError("127.0.0.1")},
+		{"fail/ipv6-as-dns-name", "::1", newDNSCert("::1"), ipError("::1")},
+		{"fail/wrong-ip", "127.0.0.1", newCert("127.0.0.2"), ipError("127.0.0.1")},
+		{"fail/ipv4-with-ipv6", "127.0.0.1", newCert("::1"), ipError("127.0.0.1")},
+		{"fail/dns-expects-dns-name", "zap.internal", newCert("127.0.0.1"),
+			errors.New("incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address or DNS name, zap.internal")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, tlsDial := newTestTLSALPNServer(tt.cert)
+			srv.Start()
+			defer srv.Close()
+
+			ch := &Challenge{ID: "chID", Token: "token", Type: TLSALPN01, Status: StatusPending, Value: tt.value}
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+			ctx := NewClientContext(context.Background(), &mockClient{tlsDial: tlsDial})
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, jwk))
+
+			if tt.wantErr == nil {
+				assert.Equal(t, StatusValid, ch.Status)
+				assert.Nil(t, ch.Error)
+				return
+			}
+			assert.Equal(t, StatusInvalid, ch.Status)
+			if assert.NotNil(t, ch.Error) {
+				assert.Equal(t, NewError(ErrorRejectedIdentifierType, "").Type, ch.Error.Type)
+				assert.EqualError(t, ch.Error.Err, tt.wantErr.Error())
+			}
+		})
+	}
+}
+
+func TestTLSALPN01Validate_protocol(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	cert, err := NewTLSALPNCertificate(keyAuth, "zap.internal")
+	require.NoError(t, err)
+
+	// withProtocol makes the test server negotiate the given protocol instead
+	// of acme-tls/1.
+	withProtocol := func(protocol string) func(*httptest.Server) {
+		return func(srv *httptest.Server) {
+			srv.Config.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){
+				protocol: func(*http.Server, *tls.Conn, http.Handler) {},
+			}
+			srv.TLS.NextProtos = []string{protocol}
+			srv.TLS.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == protocol {
+					return cert, nil
+				}
+				return nil, nil
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		server   []func(*httptest.Server)
+		protocol string
+		wantErr  error
+	}{
+		{"ok/default", nil, "", nil},
+		{"ok/custom", []func(*httptest.Server){withProtocol("acme-tls/draft")}, "acme-tls/draft", nil},
+		{"fail/default", []func(*httptest.Server){withProtocol("acme-tls/draft")}, "",
+			errors.New("cannot negotiate ALPN acme-tls/1 protocol for tls-alpn-01 challenge: server has no protocol in common")},
+		{"fail/custom", nil, "acme-tls/draft",
+			errors.New("cannot negotiate ALPN acme-tls/draft protocol for tls-alpn-01 challenge: server has no protocol in common")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, tlsDial := newTestTLSALPNServer(cert, tt.server...)
+			srv.Start()
+			defer srv.Close()
+
+			ch := &Challenge{ID: "chID", Token: "token", Type: TLSALPN01, Status: StatusPending, Value: "zap.internal"}
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+			ctx := NewClientContext(context.Background(), &mockClient{
+				tlsDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					want := tt.protocol
+					if want == "" {
+						want = "acme-tls/1"
+					}
+					assert.Equal(t, []string{want}, config.NextProtos)
+					return tlsDial(network, addr, config)
+				},
+			})
+			ctx = NewProvisionerContext(ctx, &MockProvisioner{
+				MgetTLSALPN01Protocol: func() string { return tt.protocol },
+			})
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, jwk))
+
+			if tt.wantErr == nil {
+				assert.Equal(t, StatusValid, ch.Status)
+				assert.Nil(t, ch.Error)
+				return
+			}
+			assert.Equal(t, StatusInvalid, ch.Status)
+			if assert.NotNil(t, ch.Error) {
+				assert.Equal(t, NewError(ErrorTLSType, "").Type, ch.Error.Type)
+				assert.EqualError(t, ch.Error.Err, tt.wantErr.Error())
+			}
+		})
+	}
+}
+
+func TestTLSALPN01Validate_notTLS(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+
+	// listen starts a plain text server that writes the given response to
+	// the connections, or just keeps them open if it's empty.
+	listen := func(t *testing.T, response string) string {
+		t.Helper()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				if response != "" {
+					conn.Write([]byte(response)) //nolint:errcheck // test server
+				}
+				t.Cleanup(func() { conn.Close() })
+			}
+		}()
+		return l.Addr().String()
+	}
+
+	httpSrv := httptest.NewServer(http.NotFoundHandler())
+	defer httpSrv.Close()
+	// A port without a listener.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	tests := []struct {
+		name        string
+		addr        string
+		timeout     time.Duration
+		wantType    ProblemType
+		wantInvalid bool
+		wantErr     string
+	}{
+		{"http", httpSrv.Listener.Addr().String(), 0, ErrorTLSType, true, "did not speak TLS on port %s; is it an HTTP server?"},
+		{"ssh", listen(t, "SSH-2.0-OpenSSH_9.6\r\n"), 0, ErrorTLSType, true, "did not speak TLS on port %s: tls: first record does not look like a TLS handshake"},
+		{"timeout", listen(t, ""), 100 * time.Millisecond, ErrorConnectionType, false, "timeout doing TLS dial for zap.internal:%s over tcp"},
+		{"dial", closed, 0, ErrorConnectionType, false, "error doing TLS dial for zap.internal:%s over tcp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, port, err := net.SplitHostPort(tt.addr)
+			require.NoError(t, err)
+			ctx := NewClientContext(context.Background(), &mockClient{
+				tlsDial: func(network, _ string, config *tls.Config) (*tls.Conn, error) {
+					ctx := context.Background()
+					if tt.timeout > 0 {
+						var cancel context.CancelFunc
+						ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+						defer cancel()
+					}
+					return NewClient().TLSDial(ctx, network, tt.addr, config)
+				},
+			})
+			InsecurePortTLSALPN01, _ = strconv.Atoi(port)
+			defer func() { InsecurePortTLSALPN01 = 0 }()
+
+			ch := &Challenge{ID: "chID", Token: "token", Type: TLSALPN01, Status: StatusPending, Value: "zap.internal"}
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, tt.wantInvalid, ch.Status == StatusInvalid)
+			if assert.NotNil(t, ch.Error) {
+				assert.Equal(t, NewError(tt.wantType, "").Type, ch.Error.Type)
+				assert.ErrorContains(t, ch.Error.Err, fmt.Sprintf(tt.wantErr, port))
+			}
+		})
+	}
+}
+
+func TestTLSALPN01Validate_chain(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	cert, err := NewTLSALPNCertificate(keyAuth, "zap.internal")
+	require.NoError(t, err)
+	other, err := NewTLSALPNCertificate(keyAuth, "zap.internal")
+	require.NoError(t, err)
+
+	chain := *cert
+	chain.Certificate = [][]byte{cert.Certificate[0], other.Certificate[0]}
+
+	tests := []struct {
+		name    string
+		cert    *tls.Certificate
+		wantErr error
+	}{
+		{"ok", cert, nil},
+		{"fail/chain", &chain, errors.New("incorrect certificate for tls-alpn-01 challenge: server presented 2 certificates instead of a single self-signed certificate")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, tlsDial := newTestTLSALPNServer(tt.cert)
+			srv.Start()
+			defer srv.Close()
+
+			ch := &Challenge{ID: "chID", Token: "token", Type: TLSALPN01, Status: StatusPending, Value: "zap.internal"}
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+			ctx := NewClientContext(context.Background(), &mockClient{tlsDial: tlsDial})
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, jwk))
+
+			if tt.wantErr == nil {
+				assert.Equal(t, StatusValid, ch.Status)
+				assert.Nil(t, ch.Error)
+				return
+			}
+			assert.Equal(t, StatusInvalid, ch.Status)
+			if assert.NotNil(t, ch.Error) {
+				assert.Equal(t, NewError(ErrorRejectedIdentifierType, "").Type, ch.Error.Type)
+				assert.EqualError(t, ch.Error.Err, tt.wantErr.Error())
+			}
+		})
+	}
+}
+
+func TestTLSALPN01Validate_network(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	cert, err := NewTLSALPNCertificate(keyAuth, "zap.internal")
+	require.NoError(t, err)
+	srv, tlsDial := newTestTLSALPNServer(cert)
+	srv.Start()
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		network string
+		want    string
+	}{
+		{"default", "", "tcp"},
+		{"tcp4", "tcp4", "tcp4"},
+		{"tcp6", "tcp6", "tcp6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var network string
+			ctx := NewClientContext(context.Background(), &mockClient{
+				tlsDial: func(n, addr string, config *tls.Config) (*tls.Conn, error) {
+					network = n
+					return tlsDial("tcp", addr, config)
+				},
+			})
+			ctx = NewProvisionerContext(ctx, &MockProvisioner{
+				MgetValidationNetwork: func() string { return tt.network },
+			})
+			ch := &Challenge{ID: "chID", Token: "token", Type: TLSALPN01, Status: StatusPending, Value: "zap.internal"}
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+			require.NoError(t, tlsalpn01Validate(ctx, ch, db, jwk))
+			assert.Equal(t, tt.want, network)
+			assert.Equal(t, StatusValid, ch.Status)
+
+			got, _, err := ch.ValidationTarget(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// The network is in the connection errors.
+	ctx := NewClientContext(context.Background(), &mockClient{
+		tlsDial: func(string, string, *tls.Config) (*tls.Conn, error) {
+			return nil, errors.New("force")
+		},
+	})
+	ctx = NewProvisionerContext(ctx, &MockProvisioner{
+		MgetValidationNetwork: func() string { return "tcp4" },
+	})
+	ch := &Challenge{ID: "chID", Token: "token", Type: TLSALPN01, Status: StatusPending, Value: "zap.internal"}
+	db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+	require.NoError(t, tlsalpn01Validate(ctx, ch, db, jwk))
+	if assert.NotNil(t, ch.Error) {
+		assert.EqualError(t, ch.Error.Err, "error doing TLS dial for zap.internal:443 over tcp4: force")
+	}
+}
+
 func Test_reverseAddr(t *testing.T) {
 	type args struct {
 		ip net.IP
@@ -4301,3 +5773,70 @@ func createSubjectAltNameExtension(dnsNames, emailAddresses x509util.MultiString
 		Value:    rawBytes,
 	}, nil
 }
+
+func Test_normalizeTXTRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		r    string
+		want string
+	}{
+		{"ok", "foo", "foo"},
+		{"ok/empty", "", ""},
+		{"ok/spaces", "  foo \t", "foo"},
+		{"ok/quoted", `"foo"`, "foo"},
+		{"ok/quoted-spaces", ` " foo " `, "foo"},
+		{"ok/chunks", `"foo" "bar"`, "foobar"},
+		{"ok/chunks-tabs", "\"foo\"\t\"bar\"  \"zar\"", "foobarzar"},
+		{"ok/quote", `"`, `"`},
+		{"ok/unbalanced", `"foo" bar "zar"`, `foo" bar "zar`},
+		{"ok/inner-quote", `foo"bar`, `foo"bar`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeTXTRecord(tt.r))
+		})
+	}
+}
+
+func TestChallenge_ValidationTarget(t *testing.T) {
+	prov := &MockProvisioner{
+		MgetHTTP01Port:         func() int { return 8080 },
+		MgetDNSChallengePrefix: func() string { return "_acme-challenge.tenant1" },
+	}
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		ch          *Challenge
+		wantNetwork string
+		wantAddr    string
+		wantErr     string
+	}{
+		{"http-01", context.Background(), &Challenge{Type: HTTP01, Value: "zap.internal"}, "tcp", "zap.internal:80", ""},
+		{"http-01/ipv6", context.Background(), &Challenge{Type: HTTP01, Value: "::1"}, "tcp", "[::1]:80", ""},
+		{"http-01/provisioner-port", NewProvisionerContext(context.Background(), prov), &Challenge{Type: HTTP01, Value: "zap.internal"}, "tcp", "zap.internal:8080", ""},
+		{"tls-alpn-01", context.Background(), &Challenge{Type: TLSALPN01, Value: "zap.internal"}, "tcp", "zap.internal:443", ""},
+		{"tls-alpn-01/ip", context.Background(), &Challenge{Type: TLSALPN01, Value: "127.0.0.1"}, "tcp", "127.0.0.1:443", ""},
+		{"dns-01", context.Background(), &Challenge{Type: DNS01, Value: "*.zap.internal"}, "dns", "_acme-challenge.zap.internal", ""},
+		{"dns-01/provisioner-prefix", NewProvisionerContext(context.Background(), prov), &Challenge{Type: DNS01, Value: "zap.internal"}, "dns", "_acme-challenge.tenant1.zap.internal", ""},
+		{"fail/device-attest-01", context.Background(), &Challenge{Type: DEVICEATTEST01, Value: "12345678"}, "", "", "challenge type 'device-attest-01' does not have a validation target"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, addr, err := tt.ch.ValidationTarget(tt.ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNetwork, network)
+			assert.Equal(t, tt.wantAddr, addr)
+		})
+	}
+
+	// The target follows the insecure ports used for testing purposes.
+	InsecurePortTLSALPN01 = 8443
+	t.Cleanup(func() { InsecurePortTLSALPN01 = 0 })
+	_, addr, err := (&Challenge{Type: TLSALPN01, Value: "zap.internal"}).ValidationTarget(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "zap.internal:8443", addr)
+}
@@ -1,24 +1,56 @@
 package acme
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/net/proxy"
 )
 
+// maxHTTP01Redirects is the maximum number of redirects that will be followed
+// when validating an http-01 challenge.
+const maxHTTP01Redirects = 10
+
 // Client is the interface used to verify ACME challenges.
 type Client interface {
-	// Get issues an HTTP GET to the specified URL.
-	Get(url string) (*http.Response, error)
+	// Get issues an HTTP GET to the specified URL. The request is canceled if
+	// the context is done.
+	Get(ctx context.Context, url string) (*http.Response, error)
+
+	// LookupTXT returns the DNS TXT records for the given domain name. The
+	// lookup is canceled if the context is done.
+	LookupTxt(ctx context.Context, name string) ([]string, error)
 
-	// LookupTXT returns the DNS TXT records for the given domain name.
-	LookupTxt(name string) ([]string, error)
+	// LookupNS returns the addresses, as host:port, of the authoritative
+	// nameservers of the zone of the given domain name.
+	LookupNS(ctx context.Context, name string) ([]string, error)
+
+	// LookupTxtOn returns the DNS TXT records for the given domain name
+	// queried on the given nameserver address.
+	LookupTxtOn(ctx context.Context, server, name string) ([]string, error)
+
+	// LookupCAA returns the DNS CAA records for the given domain name. It
+	// returns an empty list if the name does not exist.
+	LookupCAA(ctx context.Context, name string) ([]CAARecord, error)
 
 	// TLSDial connects to the given network address using net.Dialer and then
-	// initiates a TLS handshake, returning the resulting TLS connection.
-	TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error)
+	// initiates a TLS handshake, returning the resulting TLS connection. The
+	// dial and the handshake are canceled if the context is done.
+	TLSDial(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error)
 }
 
 type clientKey struct{}
@@ -45,13 +77,41 @@ func MustClientFromContext(ctx context.Context) Client {
 }
 
 type client struct {
-	http   *http.Client
-	dialer *net.Dialer
+	http        *http.Client
+	dialer      *net.Dialer
+	dial        func(ctx context.Context, network, addr string) (net.Conn, error)
+	resolver    *net.Resolver
+	nameservers []string
+	headers     http.Header
+}
+
+// ClientOption is the type of options passed to NewClient.
+type ClientOption func(c *client)
+
+// WithHTTPClient replaces the default HTTP client used to validate http-01
+// challenges. If the given client does not define a redirect policy, the
+// default http-01 redirect policy will be used.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *client) {
+		cp := *hc
+		if cp.CheckRedirect == nil {
+			cp.CheckRedirect = checkHTTP01Redirect
+		}
+		c.http = &cp
+	}
+}
+
+// WithHeaders sets headers, like the User-Agent, that are added to the http-01
+// validation requests.
+func WithHeaders(h http.Header) ClientOption {
+	return func(c *client) {
+		c.headers = h.Clone()
+	}
 }
 
 // NewClient returns an implementation of Client for verifying ACME challenges.
-func NewClient() Client {
-	return &client{
+func NewClient(opts ...ClientOption) Client {
+	c := &client{
 		http: &http.Client{
 			Timeout: 30 * time.Second,
 			Transport: &http.Transport{
@@ -61,21 +121,406 @@ func NewClient() Client {
 					InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
 				},
 			},
+			CheckRedirect: checkHTTP01Redirect,
 		},
 		dialer: &net.Dialer{
 			Timeout: 30 * time.Second,
 		},
 	}
+	for _, fn := range opts {
+		fn(c)
+	}
+	return c
+}
+
+// WithValidationProxy configures the client to validate all the challenges
+// through the given egress proxy. The supported proxy schemes are http, https
+// and socks5, the credentials, if any, are taken from the URL user
+// information. On http-01 the proxy is used by the HTTP transport, on
+// tls-alpn-01 the connection is tunneled through the proxy before the TLS
+// handshake, and on dns-01 the TXT lookups are done over TCP through the
+// proxy.
+func WithValidationProxy(u *url.URL) ClientOption {
+	return func(c *client) {
+		if t, ok := c.http.Transport.(*http.Transport); ok {
+			t = t.Clone()
+			t.Proxy = http.ProxyURL(u)
+			hc := *c.http
+			hc.Transport = t
+			c.http = &hc
+		}
+		switch u.Scheme {
+		case "socks5":
+			// FromURL will only fail with unknown schemes, and the SOCKS5
+			// dialer always implements proxy.ContextDialer.
+			if d, err := proxy.FromURL(u, c.dialer); err == nil {
+				c.dial = d.(proxy.ContextDialer).DialContext
+			}
+		default:
+			c.dial = (&connectDialer{
+				proxyURL: u,
+				dialer:   c.dialer,
+			}).DialContext
+		}
+		c.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				// Proxies only support stream connections.
+				return c.dial(ctx, "tcp", addr)
+			},
+		}
+	}
+}
+
+// WithLocalAddr binds the connections used to validate the http-01 and
+// tls-alpn-01 challenges, the connections to the validation proxy, and the DNS
+// queries sent to the nameservers, to the given local IP address.
+func WithLocalAddr(ip net.IP) ClientOption {
+	return func(c *client) {
+		c.dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		if t, ok := c.http.Transport.(*http.Transport); ok {
+			t = t.Clone()
+			t.DialContext = c.dialer.DialContext
+			hc := *c.http
+			hc.Transport = t
+			c.http = &hc
+		}
+	}
+}
+
+// WithNetwork sets the network used by the http-01 validation requests, "tcp4"
+// or "tcp6" to only connect using IPv4 or IPv6. If a validation proxy is used,
+// it's the network used to connect to the proxy. The network of the
+// tls-alpn-01 connections is the one passed to TLSDial.
+func WithNetwork(network string) ClientOption {
+	return func(c *client) {
+		if t, ok := c.http.Transport.(*http.Transport); ok {
+			dial := t.DialContext
+			if dial == nil {
+				dial = c.dialer.DialContext
+			}
+			t = t.Clone()
+			t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			}
+			hc := *c.http
+			hc.Transport = t
+			c.http = &hc
+		}
+	}
+}
+
+// WithIPFilter denies the http-01 and tls-alpn-01 validation connections to
+// the addresses in the deny list that are not in the allow list. The names are
+// resolved before connecting, and the connection fails if any of the
+// addresses is denied. Otherwise the resolved addresses are dialed, so the
+// name cannot resolve to another address in the meantime. The connections do
+// not use the proxy of the environment, and the filter cannot be combined with
+// WithValidationProxy, as the proxy connects to the targets.
+func WithIPFilter(deny, allow []netip.Prefix) ClientOption {
+	return func(c *client) {
+		f := &ipFilter{deny: deny, allow: allow}
+		c.dial = f.dialContext(c.dialer.DialContext)
+		if t, ok := c.http.Transport.(*http.Transport); ok {
+			dial := t.DialContext
+			if dial == nil {
+				dial = c.dialer.DialContext
+			}
+			t = t.Clone()
+			t.Proxy = nil
+			t.DialContext = f.dialContext(dial)
+			hc := *c.http
+			hc.Transport = t
+			c.http = &hc
+		}
+	}
+}
+
+// ipFilter checks the addresses of the validation connections.
+type ipFilter struct {
+	deny  []netip.Prefix
+	allow []netip.Prefix
+}
+
+func (f *ipFilter) String() string {
+	var b strings.Builder
+	for _, p := range f.deny {
+		b.WriteString("-" + p.String())
+	}
+	for _, p := range f.allow {
+		b.WriteString("+" + p.String())
+	}
+	return b.String()
+}
+
+// allowed returns true if the given address is not denied, or if it's
+// explicitly allowed.
+func (f *ipFilter) allowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range f.allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	for _, p := range f.deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialContext returns a dial function that resolves the host of the address,
+// checks all the addresses and dials them in order with the given function.
+func (f *ipFilter) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ipNetwork := "ip"
+		switch network {
+		case "tcp4":
+			ipNetwork = "ip4"
+		case "tcp6":
+			ipNetwork = "ip6"
+		}
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, ipNetwork, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			if !f.allowed(ip) {
+				return nil, fmt.Errorf("address %s of %s is not allowed", ip.Unmap(), host)
+			}
+		}
+		var firstErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil, firstErr
+	}
+}
+
+var validationClients sync.Map
+
+// validationClient returns the client used to validate the challenges through
+// the given proxy, if any, from the given local address, if any, using the
+// given network and checking the addresses with the given filter, if any. The
+// filter and the proxy cannot be used together. The given headers are added to
+// the http-01 requests.
+// Clients are cached by proxy URL, local address, network, filter and headers
+// so connections to the same proxy can be reused. The proxy credentials and
+// the headers are not kept in the cache key, only a hash of them.
+func validationClient(u *url.URL, localAddr net.IP, network string, filter *ipFilter, headers http.Header) Client {
+	var opts []ClientOption
+	var key string
+	if len(headers) > 0 {
+		var buf bytes.Buffer
+		_ = headers.Write(&buf) // keys are written in order
+		sum := sha256.Sum256(buf.Bytes())
+		opts = append(opts, WithHeaders(headers))
+		key = hex.EncodeToString(sum[:])
+	}
+	key += "|"
+	if localAddr != nil {
+		opts = append(opts, WithLocalAddr(localAddr))
+		key += localAddr.String()
+	}
+	if filter != nil {
+		opts = append(opts, WithIPFilter(filter.deny, filter.allow))
+		key += "|" + filter.String()
+	}
+	if network != "" && network != "tcp" {
+		opts = append(opts, WithNetwork(network))
+		key += "|" + network
+	}
+	if u != nil {
+		opts = append(opts, WithValidationProxy(u))
+		key += "|" + u.Redacted()
+		if u.User != nil {
+			sum := sha256.Sum256([]byte(u.User.String()))
+			key += "|" + hex.EncodeToString(sum[:])
+		}
+	}
+	if c, ok := validationClients.Load(key); ok {
+		return c.(Client)
+	}
+	c, _ := validationClients.LoadOrStore(key, NewClient(opts...))
+	return c.(Client)
+}
+
+// connectDialer is a dialer that tunnels the connections through an HTTP or
+// HTTPS proxy using the CONNECT method.
+type connectDialer struct {
+	proxyURL *url.URL
+	dialer   *net.Dialer
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyAddr := d.proxyURL.Host
+	if d.proxyURL.Port() == "" {
+		port := "80"
+		if d.proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(d.proxyURL.Hostname(), port)
+	}
+
+	conn, err := d.dialer.DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if d.proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: d.proxyURL.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := d.proxyURL.User; u != nil {
+		password, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s responded with %q to CONNECT %s", d.proxyURL.Redacted(), resp.Status, addr)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
 }
 
-func (c *client) Get(url string) (*http.Response, error) {
-	return c.http.Get(url)
+// bufferedConn is a net.Conn that reads first from a buffered reader.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
 }
 
-func (c *client) LookupTxt(name string) ([]string, error) {
-	return net.LookupTXT(name)
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
 }
 
-func (c *client) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
-	return tls.DialWithDialer(c.dialer, network, addr, config)
+// checkHTTP01Redirect implements the redirect policy used on http-01
+// challenges. RFC 8555 allows the server to follow redirects, but only to
+// the http and https schemes on their default ports. Redirects to the port
+// used to validate the challenge are also allowed.
+func checkHTTP01Redirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxHTTP01Redirects {
+		return fmt.Errorf("stopped after %d redirects", maxHTTP01Redirects)
+	}
+	switch req.URL.Scheme {
+	case "http", "https":
+	default:
+		return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+	}
+	if port := req.URL.Port(); port != "" {
+		switch {
+		case req.URL.Scheme == "http" && port == "80":
+		case req.URL.Scheme == "https" && port == "443":
+		case port == strconv.Itoa(http01Port(req.Context())):
+		default:
+			return fmt.Errorf("redirect to unsupported port %s", port)
+		}
+	}
+	return nil
+}
+
+func (c *client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.headers {
+		req.Header[k] = v
+	}
+	return c.http.Do(req)
+}
+
+func (c *client) LookupTxt(ctx context.Context, name string) ([]string, error) {
+	if c.resolver != nil {
+		return c.resolver.LookupTXT(ctx, name)
+	}
+	return net.DefaultResolver.LookupTXT(ctx, name)
+}
+
+func (c *client) TLSDial(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
+	if c.dial == nil {
+		d := &tls.Dialer{NetDialer: c.dialer, Config: config}
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return conn.(*tls.Conn), nil
+	}
+
+	if c.dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialer.Timeout)
+		defer cancel()
+	}
+
+	conn, err := c.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The config, including the acme-tls/1 protocol in NextProtos, is used
+	// as is, only the ServerName is set if it's missing, as
+	// tls.DialWithDialer does.
+	if config == nil {
+		config = &tls.Config{} //nolint:gosec // the caller sets the config
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
 }
@@ -2,6 +2,7 @@ package acme
 
 import (
 	"context"
+	"crypto"
 	"crypto/x509"
 	"time"
 
@@ -17,7 +18,22 @@ func (c *Clock) Now() time.Time {
 	return time.Now().UTC().Truncate(time.Second)
 }
 
-var clock Clock
+// clock is the clock used by the package. It's a variable so tests can
+// replace it.
+var clock interface{ Now() time.Time } = new(Clock)
+
+// defaultClockSkew is the clock skew tolerated if there's no provisioner in
+// the context.
+var defaultClockSkew = provisioner.DefaultACMEClockSkew
+
+// clockSkewFromContext returns the clock skew tolerated by the provisioner in
+// the context. A skew of 0 disables the tolerance.
+func clockSkewFromContext(ctx context.Context) time.Duration {
+	if p, ok := ProvisionerFromContext(ctx); ok {
+		return p.GetClockSkew()
+	}
+	return defaultClockSkew
+}
 
 // CertificateAuthority is the interface implemented by a CA authority.
 type CertificateAuthority interface {
@@ -69,6 +85,7 @@ func PrerequisitesCheckerFromContext(ctx context.Context) (PrerequisitesChecker,
 // only those methods required by the ACME api/authority.
 type Provisioner interface {
 	AuthorizeOrderIdentifier(ctx context.Context, identifier provisioner.ACMEIdentifier) error
+	AuthorizeCSRKey(ctx context.Context, pub crypto.PublicKey) error
 	AuthorizeSign(ctx context.Context, token string) ([]provisioner.SignOption, error)
 	AuthorizeRevoke(ctx context.Context, token string) error
 	IsChallengeEnabled(ctx context.Context, challenge provisioner.ACMEChallenge) bool
@@ -77,6 +94,25 @@ type Provisioner interface {
 	GetID() string
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
+	MinTLSCertDuration() time.Duration
+	MaxTLSCertDuration() time.Duration
+	GetClockSkew() time.Duration
+	GetDNSPropagationWait() time.Duration
+	GetChallengeTokenLength() int
+	GetDNSChallengePrefix() string
+	GetDNSChallengeName(domain, prefix string) (string, error)
+	GetDNSChallengeQuorum() provisioner.ACMEDNSQuorum
+	GetCAACheckIdentities() []string
+	GetHTTP01MaxBodySize() int64
+	GetHTTP01ExactMatch() bool
+	GetHTTP01Port() int
+	GetTLSALPN01Protocol() string
+	GetValidationNetwork() string
+	GetDNSLookupRetry() *provisioner.ACMEDNSLookupRetry
+	GetProfile(name string) (*provisioner.ACMEProfile, bool)
+	GetRateLimits() *provisioner.ACMERateLimits
+	GetValidationConcurrency() *provisioner.ACMEValidationConcurrency
+	GetCompressRecords() bool
 	GetOptions() *provisioner.Options
 }
 
@@ -113,12 +149,32 @@ type MockProvisioner struct {
 	MgetID                    func() string
 	MgetName                  func() string
 	MauthorizeOrderIdentifier func(ctx context.Context, identifier provisioner.ACMEIdentifier) error
+	MauthorizeCSRKey          func(ctx context.Context, pub crypto.PublicKey) error
 	MauthorizeSign            func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
 	MauthorizeRevoke          func(ctx context.Context, token string) error
 	MisChallengeEnabled       func(ctx context.Context, challenge provisioner.ACMEChallenge) bool
 	MisAttFormatEnabled       func(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	MgetAttestationRoots      func() (*x509.CertPool, bool)
 	MdefaultTLSCertDuration   func() time.Duration
+	MminTLSCertDuration       func() time.Duration
+	MmaxTLSCertDuration       func() time.Duration
+	MgetClockSkew             func() time.Duration
+	MgetDNSPropagationWait    func() time.Duration
+	MgetChallengeTokenLength  func() int
+	MgetDNSChallengePrefix    func() string
+	MgetDNSChallengeName      func(domain, prefix string) (string, error)
+	MgetDNSChallengeQuorum    func() provisioner.ACMEDNSQuorum
+	MgetCAACheckIdentities    func() []string
+	MgetHTTP01MaxBodySize     func() int64
+	MgetHTTP01ExactMatch      func() bool
+	MgetHTTP01Port            func() int
+	MgetTLSALPN01Protocol     func() string
+	MgetValidationNetwork     func() string
+	MgetDNSLookupRetry        func() *provisioner.ACMEDNSLookupRetry
+	MgetProfile               func(name string) (*provisioner.ACMEProfile, bool)
+	MgetRateLimits            func() *provisioner.ACMERateLimits
+	MgetValidationConcurrency func() *provisioner.ACMEValidationConcurrency
+	MgetCompressRecords       func() bool
 	MgetOptions               func() *provisioner.Options
 }
 
@@ -138,6 +194,14 @@ func (m *MockProvisioner) AuthorizeOrderIdentifier(ctx context.Context, identifi
 	return m.Merr
 }
 
+// AuthorizeCSRKey mock
+func (m *MockProvisioner) AuthorizeCSRKey(ctx context.Context, pub crypto.PublicKey) error {
+	if m.MauthorizeCSRKey != nil {
+		return m.MauthorizeCSRKey(ctx, pub)
+	}
+	return m.Merr
+}
+
 // AuthorizeSign mock
 func (m *MockProvisioner) AuthorizeSign(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
 	if m.MauthorizeSign != nil {
@@ -185,6 +249,158 @@ func (m *MockProvisioner) DefaultTLSCertDuration() time.Duration {
 	return m.Mret1.(time.Duration)
 }
 
+// MinTLSCertDuration mock
+func (m *MockProvisioner) MinTLSCertDuration() time.Duration {
+	if m.MminTLSCertDuration != nil {
+		return m.MminTLSCertDuration()
+	}
+	return m.Mret1.(time.Duration)
+}
+
+// MaxTLSCertDuration mock
+func (m *MockProvisioner) MaxTLSCertDuration() time.Duration {
+	if m.MmaxTLSCertDuration != nil {
+		return m.MmaxTLSCertDuration()
+	}
+	return m.Mret1.(time.Duration)
+}
+
+// GetDNSPropagationWait mock
+func (m *MockProvisioner) GetDNSPropagationWait() time.Duration {
+	if m.MgetDNSPropagationWait != nil {
+		return m.MgetDNSPropagationWait()
+	}
+	return 0
+}
+
+// GetClockSkew mock
+func (m *MockProvisioner) GetClockSkew() time.Duration {
+	if m.MgetClockSkew != nil {
+		return m.MgetClockSkew()
+	}
+	return defaultClockSkew
+}
+
+// GetChallengeTokenLength mock
+func (m *MockProvisioner) GetChallengeTokenLength() int {
+	if m.MgetChallengeTokenLength != nil {
+		return m.MgetChallengeTokenLength()
+	}
+	return 0
+}
+
+// GetDNSChallengePrefix mock
+func (m *MockProvisioner) GetDNSChallengePrefix() string {
+	if m.MgetDNSChallengePrefix != nil {
+		return m.MgetDNSChallengePrefix()
+	}
+	return ""
+}
+
+// GetDNSChallengeName mock
+func (m *MockProvisioner) GetDNSChallengeName(domain, prefix string) (string, error) {
+	if m.MgetDNSChallengeName != nil {
+		return m.MgetDNSChallengeName(domain, prefix)
+	}
+	return "", nil
+}
+
+// GetDNSChallengeQuorum mock
+func (m *MockProvisioner) GetDNSChallengeQuorum() provisioner.ACMEDNSQuorum {
+	if m.MgetDNSChallengeQuorum != nil {
+		return m.MgetDNSChallengeQuorum()
+	}
+	return ""
+}
+
+// GetCAACheckIdentities mock
+func (m *MockProvisioner) GetCAACheckIdentities() []string {
+	if m.MgetCAACheckIdentities != nil {
+		return m.MgetCAACheckIdentities()
+	}
+	return nil
+}
+
+// GetHTTP01MaxBodySize mock
+func (m *MockProvisioner) GetHTTP01MaxBodySize() int64 {
+	if m.MgetHTTP01MaxBodySize != nil {
+		return m.MgetHTTP01MaxBodySize()
+	}
+	return 0
+}
+
+// GetHTTP01ExactMatch mock
+func (m *MockProvisioner) GetHTTP01ExactMatch() bool {
+	if m.MgetHTTP01ExactMatch != nil {
+		return m.MgetHTTP01ExactMatch()
+	}
+	return false
+}
+
+// GetHTTP01Port mock
+func (m *MockProvisioner) GetHTTP01Port() int {
+	if m.MgetHTTP01Port != nil {
+		return m.MgetHTTP01Port()
+	}
+	return 0
+}
+
+// GetTLSALPN01Protocol mock
+func (m *MockProvisioner) GetTLSALPN01Protocol() string {
+	if m.MgetTLSALPN01Protocol != nil {
+		return m.MgetTLSALPN01Protocol()
+	}
+	return ""
+}
+
+// GetValidationNetwork mock
+func (m *MockProvisioner) GetValidationNetwork() string {
+	if m.MgetValidationNetwork != nil {
+		return m.MgetValidationNetwork()
+	}
+	return ""
+}
+
+// GetDNSLookupRetry mock
+func (m *MockProvisioner) GetDNSLookupRetry() *provisioner.ACMEDNSLookupRetry {
+	if m.MgetDNSLookupRetry != nil {
+		return m.MgetDNSLookupRetry()
+	}
+	return nil
+}
+
+// GetProfile mock
+func (m *MockProvisioner) GetProfile(name string) (*provisioner.ACMEProfile, bool) {
+	if m.MgetProfile != nil {
+		return m.MgetProfile(name)
+	}
+	return nil, false
+}
+
+// GetRateLimits mock
+func (m *MockProvisioner) GetRateLimits() *provisioner.ACMERateLimits {
+	if m.MgetRateLimits != nil {
+		return m.MgetRateLimits()
+	}
+	return nil
+}
+
+// GetValidationConcurrency mock
+func (m *MockProvisioner) GetValidationConcurrency() *provisioner.ACMEValidationConcurrency {
+	if m.MgetValidationConcurrency != nil {
+		return m.MgetValidationConcurrency()
+	}
+	return nil
+}
+
+// GetCompressRecords mock
+func (m *MockProvisioner) GetCompressRecords() bool {
+	if m.MgetCompressRecords != nil {
+		return m.MgetCompressRecords()
+	}
+	return false
+}
+
 // GetOptions mock
 func (m *MockProvisioner) GetOptions() *provisioner.Options {
 	if m.MgetOptions != nil {
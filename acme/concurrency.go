@@ -0,0 +1,125 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ValidationLimiter bounds the number of challenge validations running at the
+// same time using the limits configured in the ACME provisioners. Validations
+// over the limit wait until a running one finishes or their context is
+// canceled.
+type ValidationLimiter struct {
+	mu   sync.Mutex
+	sems map[string]*validationSemaphore
+}
+
+// validationSemaphore is a counting semaphore, refs is the number of
+// validations holding or waiting for a slot, the semaphore is removed when it
+// reaches 0.
+type validationSemaphore struct {
+	slots chan struct{}
+	refs  int
+}
+
+// NewValidationLimiter creates a new ValidationLimiter.
+func NewValidationLimiter() *ValidationLimiter {
+	return &ValidationLimiter{
+		sems: make(map[string]*validationSemaphore),
+	}
+}
+
+// acquire waits for a slot in the semaphore with the given key and limit. It
+// returns the function that releases the slot, or an error if the context is
+// done before a slot is available.
+func (l *ValidationLimiter) acquire(ctx context.Context, key string, limit int) (func(), error) {
+	// The limit is part of the key, so a provisioner update with a new limit
+	// does not share the semaphore with the running validations.
+	key = fmt.Sprintf("%s/%d", key, limit)
+
+	l.mu.Lock()
+	s, ok := l.sems[key]
+	if !ok {
+		s = &validationSemaphore{slots: make(chan struct{}, limit)}
+		l.sems[key] = s
+	}
+	s.refs++
+	l.mu.Unlock()
+
+	select {
+	case s.slots <- struct{}{}:
+		return func() {
+			<-s.slots
+			l.unref(key, s)
+		}, nil
+	case <-ctx.Done():
+		l.unref(key, s)
+		return nil, context.Cause(ctx)
+	}
+}
+
+func (l *ValidationLimiter) unref(key string, s *validationSemaphore) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s.refs--; s.refs == 0 {
+		delete(l.sems, key)
+	}
+}
+
+// acquireValidationSlots waits until the challenge can be validated without
+// exceeding the concurrency limits of the provisioner, first the limit of the
+// account and then the total one. It returns the function that releases the
+// slots. It does nothing if there is no limiter in the context or the
+// provisioner does not limit the validations.
+func acquireValidationSlots(ctx context.Context, ch *Challenge) (func(), error) {
+	noop := func() {}
+	l, ok := ValidationLimiterFromContext(ctx)
+	if !ok {
+		return noop, nil
+	}
+	p, ok := ProvisionerFromContext(ctx)
+	if !ok {
+		return noop, nil
+	}
+	limits := p.GetValidationConcurrency()
+	if limits == nil {
+		return noop, nil
+	}
+
+	releaseAccount := noop
+	if limits.PerAccount > 0 {
+		release, err := l.acquire(ctx, fmt.Sprintf("account/%s/%s", p.GetID(), ch.AccountID), limits.PerAccount)
+		if err != nil {
+			return nil, WrapErrorISE(err, "error waiting to validate challenge %s", ch.ID)
+		}
+		releaseAccount = release
+	}
+	if limits.Total > 0 {
+		release, err := l.acquire(ctx, "total/"+p.GetID(), limits.Total)
+		if err != nil {
+			releaseAccount()
+			return nil, WrapErrorISE(err, "error waiting to validate challenge %s", ch.ID)
+		}
+		return func() {
+			release()
+			releaseAccount()
+		}, nil
+	}
+	return releaseAccount, nil
+}
+
+type validationLimiterKey struct{}
+
+// NewValidationLimiterContext adds the given validation limiter to the
+// context.
+func NewValidationLimiterContext(ctx context.Context, l *ValidationLimiter) context.Context {
+	return context.WithValue(ctx, validationLimiterKey{}, l)
+}
+
+// ValidationLimiterFromContext returns the current validation limiter from the
+// given context.
+func ValidationLimiterFromContext(ctx context.Context) (l *ValidationLimiter, ok bool) {
+	l, ok = ctx.Value(validationLimiterKey{}).(*ValidationLimiter)
+	return
+}
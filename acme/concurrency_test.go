@@ -0,0 +1,141 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestChallenge_Validate_concurrency(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		limits   *provisioner.ACMEValidationConcurrency
+		accounts int
+		want     int
+	}{
+		{"perAccount", &provisioner.ACMEValidationConcurrency{PerAccount: 2}, 1, 2},
+		{"perAccount/accounts", &provisioner.ACMEValidationConcurrency{PerAccount: 2}, 2, 4},
+		{"total", &provisioner.ACMEValidationConcurrency{Total: 3}, 2, 3},
+		{"both", &provisioner.ACMEValidationConcurrency{PerAccount: 1, Total: 3}, 2, 2},
+		{"unbounded", nil, 1, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, maxRunning atomic.Int32
+			unblock := make(chan struct{})
+			ctx := NewValidationLimiterContext(context.Background(), NewValidationLimiter())
+			ctx = NewProvisionerContext(ctx, &MockProvisioner{
+				MgetID:                    func() string { return "provID" },
+				MgetValidationConcurrency: func() *provisioner.ACMEValidationConcurrency { return tt.limits },
+			})
+			ctx = NewClientContext(ctx, &mockClient{
+				get: func(string) (*http.Response, error) {
+					n := running.Add(1)
+					defer running.Add(-1)
+					for m := maxRunning.Load(); n > m && !maxRunning.CompareAndSwap(m, n); m = maxRunning.Load() {
+					}
+					<-unblock
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("wrong"))}, nil
+				},
+			})
+			db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+
+			// Start a burst of validations and wait until the expected number
+			// of them is running.
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				ch := &Challenge{
+					ID:        fmt.Sprintf("chID-%d", i),
+					AccountID: fmt.Sprintf("accID-%d", i%tt.accounts),
+					Token:     "token",
+					Type:      HTTP01,
+					Status:    StatusPending,
+					Value:     "zap.internal",
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, ch.Validate(ctx, db, jwk, nil))
+				}()
+			}
+			require.Eventually(t, func() bool {
+				return running.Load() == int32(tt.want)
+			}, 5*time.Second, time.Millisecond)
+			time.Sleep(10 * time.Millisecond)
+
+			close(unblock)
+			wg.Wait()
+			assert.Equal(t, int32(tt.want), maxRunning.Load())
+		})
+	}
+}
+
+func TestValidationLimiter_acquire(t *testing.T) {
+	l := NewValidationLimiter()
+	release, err := l.acquire(context.Background(), "key", 1)
+	require.NoError(t, err)
+
+	// A validation waiting for a slot is released when its context is
+	// canceled.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.acquire(ctx, "key", 1)
+		errc <- err
+	}()
+	cancel(errValidationsDrained)
+	assert.ErrorIs(t, <-errc, errValidationsDrained)
+
+	release()
+	release, err = l.acquire(context.Background(), "key", 1)
+	require.NoError(t, err)
+	release()
+
+	// Semaphores are removed when they are not used.
+	assert.Empty(t, l.sems)
+}
+
+func Test_acquireValidationSlots(t *testing.T) {
+	l := NewValidationLimiter()
+	ctx := NewValidationLimiterContext(context.Background(), l)
+	ctx = NewProvisionerContext(ctx, &MockProvisioner{
+		MgetID: func() string { return "provID" },
+		MgetValidationConcurrency: func() *provisioner.ACMEValidationConcurrency {
+			return &provisioner.ACMEValidationConcurrency{PerAccount: 2, Total: 1}
+		},
+	})
+	ch := &Challenge{ID: "chID", AccountID: "accID"}
+
+	release, err := acquireValidationSlots(ctx, ch)
+	require.NoError(t, err)
+
+	// The slot of the account is released if the total limit is reached.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = acquireValidationSlots(canceled, ch)
+	assert.EqualError(t, err, "error waiting to validate challenge chID: context canceled")
+	assert.Len(t, l.sems["account/provID/accID/2"].slots, 1)
+
+	release()
+	assert.Empty(t, l.sems)
+
+	// Noop without a limiter.
+	release, err = acquireValidationSlots(context.Background(), ch)
+	require.NoError(t, err)
+	release()
+}
@@ -3,6 +3,7 @@ package acme
 import (
 	"context"
 	"database/sql"
+	"fmt"
 
 	"github.com/pkg/errors"
 )
@@ -19,6 +20,18 @@ func IsErrNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound) || errors.Is(err, sql.ErrNoRows)
 }
 
+// NewNotFoundError returns a malformed Error for an entity that does not
+// exist. IsErrNotFound returns true for it.
+func NewNotFoundError(msg string, args ...interface{}) *Error {
+	return newError(ErrorMalformedType, notFoundError(fmt.Sprintf(msg, args...)))
+}
+
+type notFoundError string
+
+func (e notFoundError) Error() string { return string(e) }
+
+func (e notFoundError) Is(target error) bool { return target == ErrNotFound }
+
 // DB is the DB interface expected by the step-ca ACME API.
 type DB interface {
 	CreateAccount(ctx context.Context, acc *Account) error
@@ -49,6 +62,7 @@ type DB interface {
 	CreateChallenge(ctx context.Context, ch *Challenge) error
 	GetChallenge(ctx context.Context, id, authzID string) (*Challenge, error)
 	UpdateChallenge(ctx context.Context, ch *Challenge) error
+	UpdateChallenges(ctx context.Context, chs []*Challenge) error
 
 	CreateOrder(ctx context.Context, o *Order) error
 	GetOrder(ctx context.Context, id string) (*Order, error)
@@ -110,9 +124,10 @@ type MockDB struct {
 	MockGetCertificate         func(ctx context.Context, id string) (*Certificate, error)
 	MockGetCertificateBySerial func(ctx context.Context, serial string) (*Certificate, error)
 
-	MockCreateChallenge func(ctx context.Context, ch *Challenge) error
-	MockGetChallenge    func(ctx context.Context, id, authzID string) (*Challenge, error)
-	MockUpdateChallenge func(ctx context.Context, ch *Challenge) error
+	MockCreateChallenge  func(ctx context.Context, ch *Challenge) error
+	MockGetChallenge     func(ctx context.Context, id, authzID string) (*Challenge, error)
+	MockUpdateChallenge  func(ctx context.Context, ch *Challenge) error
+	MockUpdateChallenges func(ctx context.Context, chs []*Challenge) error
 
 	MockCreateOrder          func(ctx context.Context, o *Order) error
 	MockGetOrder             func(ctx context.Context, id string) (*Order, error)
@@ -343,6 +358,20 @@ func (m *MockDB) GetChallenge(ctx context.Context, chID, azID string) (*Challeng
 	return m.MockRet1.(*Challenge), m.MockError
 }
 
+// UpdateChallenges mock. Without MockUpdateChallenges the challenges are
+// updated one by one with UpdateChallenge.
+func (m *MockDB) UpdateChallenges(ctx context.Context, chs []*Challenge) error {
+	if m.MockUpdateChallenges != nil {
+		return m.MockUpdateChallenges(ctx, chs)
+	}
+	for _, ch := range chs {
+		if err := m.UpdateChallenge(ctx, ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // UpdateChallenge mock
 func (m *MockDB) UpdateChallenge(ctx context.Context, ch *Challenge) error {
 	if m.MockUpdateChallenge != nil {
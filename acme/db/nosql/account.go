@@ -13,14 +13,15 @@ import (
 
 // dbAccount represents an ACME account.
 type dbAccount struct {
-	ID              string           `json:"id"`
-	Key             *jose.JSONWebKey `json:"key"`
-	Contact         []string         `json:"contact,omitempty"`
-	Status          acme.Status      `json:"status"`
-	LocationPrefix  string           `json:"locationPrefix"`
-	ProvisionerName string           `json:"provisionerName"`
-	CreatedAt       time.Time        `json:"createdAt"`
-	DeactivatedAt   time.Time        `json:"deactivatedAt"`
+	ID                     string           `json:"id"`
+	Key                    *jose.JSONWebKey `json:"key"`
+	Contact                []string         `json:"contact,omitempty"`
+	Status                 acme.Status      `json:"status"`
+	LocationPrefix         string           `json:"locationPrefix"`
+	ProvisionerName        string           `json:"provisionerName"`
+	CreatedAt              time.Time        `json:"createdAt"`
+	DeactivatedAt          time.Time        `json:"deactivatedAt"`
+	TermsOfServiceAgreedAt *time.Time       `json:"termsOfServiceAgreedAt,omitempty"`
 }
 
 func (dba *dbAccount) clone() *dbAccount {
@@ -64,12 +65,13 @@ func (db *DB) GetAccount(ctx context.Context, id string) (*acme.Account, error)
 	}
 
 	return &acme.Account{
-		Status:          dbacc.Status,
-		Contact:         dbacc.Contact,
-		Key:             dbacc.Key,
-		ID:              dbacc.ID,
-		LocationPrefix:  dbacc.LocationPrefix,
-		ProvisionerName: dbacc.ProvisionerName,
+		Status:               dbacc.Status,
+		Contact:              dbacc.Contact,
+		Key:                  dbacc.Key,
+		ID:                   dbacc.ID,
+		LocationPrefix:       dbacc.LocationPrefix,
+		ProvisionerName:      dbacc.ProvisionerName,
+		TermsOfServiceAgreed: dbacc.TermsOfServiceAgreedAt != nil,
 	}, nil
 }
 
@@ -99,6 +101,9 @@ func (db *DB) CreateAccount(ctx context.Context, acc *acme.Account) error {
 		LocationPrefix:  acc.LocationPrefix,
 		ProvisionerName: acc.ProvisionerName,
 	}
+	if acc.TermsOfServiceAgreed {
+		dba.TermsOfServiceAgreedAt = &dba.CreatedAt
+	}
 
 	kid, err := acme.KeyToID(dba.Key)
 	if err != nil {
@@ -138,5 +143,50 @@ func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 		nu.DeactivatedAt = clock.Now()
 	}
 
+	// The agreement to the terms of service cannot be revoked.
+	if acc.TermsOfServiceAgreed && old.TermsOfServiceAgreedAt == nil {
+		now := clock.Now()
+		nu.TermsOfServiceAgreedAt = &now
+	}
+
+	// If the key has changed, update the jwkID -> acme account ID index too.
+	if acc.Key != nil {
+		newKid, err := acme.KeyToID(acc.Key)
+		if err != nil {
+			return err
+		}
+		oldKid, err := acme.KeyToID(old.Key)
+		if err != nil {
+			return err
+		}
+		if newKid != oldKid {
+			nu.Key = acc.Key
+			return db.updateAccountKey(ctx, old, nu, []byte(oldKid), []byte(newKid))
+		}
+	}
+
 	return db.save(ctx, old.ID, nu, old, "account", accountTable)
 }
+
+// updateAccountKey saves an account with a new key. The index of the new key
+// is created first, so the same key cannot be used by two accounts, and the
+// index of the old key is removed after the account is saved.
+func (db *DB) updateAccountKey(ctx context.Context, old, nu *dbAccount, oldKid, newKid []byte) error {
+	_, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, newKid, nil, []byte(nu.ID))
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error storing keyID to accountID index")
+	case !swapped:
+		return errors.Errorf("key-id to account-id index already exists")
+	}
+
+	if err := db.save(ctx, old.ID, nu, old, "account", accountTable); err != nil {
+		db.db.Del(accountByKeyIDTable, newKid)
+		return err
+	}
+
+	if err := db.db.Del(accountByKeyIDTable, oldKid); err != nil {
+		return errors.Wrap(err, "error deleting keyID to accountID index")
+	}
+	return nil
+}
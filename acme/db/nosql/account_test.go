@@ -565,6 +565,12 @@ func TestDB_UpdateAccount(t *testing.T) {
 	}
 	b, err := json.Marshal(dbacc)
 	assert.FatalError(t, err)
+	oldKid, err := acme.KeyToID(jwk)
+	assert.FatalError(t, err)
+	newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newKid, err := acme.KeyToID(newJWK)
+	assert.FatalError(t, err)
 	type test struct {
 		db  nosql.DB
 		acc *acme.Account
@@ -698,6 +704,167 @@ func TestDB_UpdateAccount(t *testing.T) {
 				},
 			}
 		},
+		"ok/terms-of-service-agreed": func(t *testing.T) test {
+			acc := &acme.Account{
+				ID:                   accID,
+				Status:               acme.StatusDeactivated,
+				Contact:              []string{"foo", "bar"},
+				Key:                  jwk,
+				TermsOfServiceAgreed: true,
+			}
+			return test{
+				acc: acc,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						dbNew := new(dbAccount)
+						assert.FatalError(t, json.Unmarshal(nu, dbNew))
+						assert.True(t, dbNew.TermsOfServiceAgreedAt.Add(-time.Minute).Before(now))
+						assert.True(t, dbNew.TermsOfServiceAgreedAt.Add(time.Minute).After(now))
+						return nu, true, nil
+					},
+				},
+			}
+		},
+		"ok/legacy-record": func(t *testing.T) test {
+			// Accounts stored before the terms of service agreement was
+			// recorded don't have the field.
+			legacy, err := json.Marshal(struct {
+				ID              string           `json:"id"`
+				Key             *jose.JSONWebKey `json:"key"`
+				Contact         []string         `json:"contact,omitempty"`
+				Status          acme.Status      `json:"status"`
+				LocationPrefix  string           `json:"locationPrefix"`
+				ProvisionerName string           `json:"provisionerName"`
+				CreatedAt       time.Time        `json:"createdAt"`
+				DeactivatedAt   time.Time        `json:"deactivatedAt"`
+			}{accID, jwk, []string{"foo", "bar"}, acme.StatusValid, "foo", "alpha", now, time.Time{}})
+			assert.FatalError(t, err)
+			acc := &acme.Account{
+				ID:      accID,
+				Status:  acme.StatusDeactivated,
+				Contact: []string{"foo", "bar"},
+			}
+			return test{
+				acc: acc,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return legacy, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, string(legacy), string(old))
+						dbNew := new(dbAccount)
+						assert.FatalError(t, json.Unmarshal(nu, dbNew))
+						assert.Equals(t, acme.StatusDeactivated, dbNew.Status)
+						assert.Nil(t, dbNew.TermsOfServiceAgreedAt)
+						return nu, true, nil
+					},
+				},
+			}
+		},
+		"fail/key-change-index-exists": func(t *testing.T) test {
+			acc := &acme.Account{
+				ID:      accID,
+				Status:  acme.StatusValid,
+				Contact: []string{"foo", "bar"},
+				Key:     newJWK,
+			}
+			return test{
+				acc: acc,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						assert.Nil(t, old)
+						return []byte("otherID"), false, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.FatalError(t, errors.New("delete should not be called"))
+						return nil
+					},
+				},
+				err: errors.New("key-id to account-id index already exists"),
+			}
+		},
+		"fail/key-change-save-error": func(t *testing.T) test {
+			acc := &acme.Account{
+				ID:      accID,
+				Status:  acme.StatusValid,
+				Contact: []string{"foo", "bar"},
+				Key:     newJWK,
+			}
+			var deleted []string
+			t.Cleanup(func() {
+				assert.Equals(t, []string{newKid}, deleted)
+			})
+			return test{
+				acc: acc,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						if string(bucket) == string(accountByKeyIDTable) {
+							return nu, true, nil
+						}
+						return nil, false, errors.New("force")
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						deleted = append(deleted, string(key))
+						return nil
+					},
+				},
+				err: errors.New("error saving acme account: force"),
+			}
+		},
+		"ok/key-change": func(t *testing.T) test {
+			acc := &acme.Account{
+				ID:      accID,
+				Status:  acme.StatusValid,
+				Contact: []string{"foo", "bar"},
+				Key:     newJWK,
+			}
+			var deleted []string
+			t.Cleanup(func() {
+				assert.Equals(t, []string{oldKid}, deleted)
+			})
+			return test{
+				acc: acc,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							assert.Equals(t, string(key), newKid)
+							assert.Nil(t, old)
+							assert.Equals(t, string(nu), accID)
+						case string(accountTable):
+							assert.Equals(t, old, b)
+							dbNew := new(dbAccount)
+							assert.FatalError(t, json.Unmarshal(nu, dbNew))
+							assert.Equals(t, dbNew.ID, dbacc.ID)
+							assert.Equals(t, dbNew.Key.KeyID, newJWK.KeyID)
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", bucket))
+						}
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						deleted = append(deleted, string(key))
+						return nil
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -10,6 +11,8 @@ import (
 	"github.com/smallstep/nosql"
 )
 
+var authzsByAccountMux sync.Mutex
+
 // dbAuthz is the base authz type that others build from.
 type dbAuthz struct {
 	ID           string          `json:"id"`
@@ -35,7 +38,7 @@ func (ba *dbAuthz) clone() *dbAuthz {
 func (db *DB) getDBAuthz(_ context.Context, id string) (*dbAuthz, error) {
 	data, err := db.db.Get(authzTable, []byte(id))
 	if nosql.IsErrNotFound(err) {
-		return nil, acme.NewError(acme.ErrorMalformedType, "authz %s not found", id)
+		return nil, acme.NewNotFoundError("authz %s not found", id)
 	} else if err != nil {
 		return nil, errors.Wrapf(err, "error loading authz %s", id)
 	}
@@ -54,12 +57,13 @@ func (db *DB) GetAuthorization(ctx context.Context, id string) (*acme.Authorizat
 	if err != nil {
 		return nil, err
 	}
-	var chs = make([]*acme.Challenge, len(dbaz.ChallengeIDs))
-	for i, chID := range dbaz.ChallengeIDs {
-		chs[i], err = db.GetChallenge(ctx, chID, id)
-		if err != nil {
-			return nil, err
-		}
+	dbchs, err := db.getDBChallenges(ctx, dbaz.ChallengeIDs)
+	if err != nil {
+		return nil, err
+	}
+	var chs = make([]*acme.Challenge, len(dbchs))
+	for i, dbch := range dbchs {
+		chs[i] = dbch.toChallenge()
 	}
 	return &acme.Authorization{
 		ID:          dbaz.ID,
@@ -103,7 +107,64 @@ func (db *DB) CreateAuthorization(ctx context.Context, az *acme.Authorization) e
 		Wildcard:     az.Wildcard,
 	}
 
-	return db.save(ctx, az.ID, dbaz, nil, "authz", authzTable)
+	if err := db.save(ctx, az.ID, dbaz, nil, "authz", authzTable); err != nil {
+		return err
+	}
+	if az.AccountID == "" {
+		return nil
+	}
+	if err := db.updateAddAuthzIDs(ctx, az.AccountID, az.ID); err != nil {
+		// Ignore error from delete -- we tried our best.
+		db.db.Del(authzTable, []byte(az.ID))
+		return err
+	}
+	return nil
+}
+
+// getAuthzIDs returns the authorization IDs in the index of the account.
+func (db *DB) getAuthzIDs(accID string) ([]string, error) {
+	var ids []string
+	b, err := db.db.Get(authzsByAccountIDTable, []byte(accID))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading authzIDs for account %s", accID)
+	}
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling authzIDs for account %s", accID)
+	}
+	return ids, nil
+}
+
+// saveAuthzIDs replaces the authorization IDs in the index of the account.
+func (db *DB) saveAuthzIDs(ctx context.Context, accID string, oldIDs, newIDs []string) error {
+	var (
+		_old interface{} = oldIDs
+		_new interface{} = newIDs
+	)
+	switch {
+	case len(oldIDs) == 0:
+		_old = nil
+	case len(newIDs) == 0:
+		_new = nil
+	}
+	if err := db.save(ctx, accID, _new, _old, "authzIDsByAccountID", authzsByAccountIDTable); err != nil {
+		return errors.Wrapf(err, "error saving authzIDs index for account %s", accID)
+	}
+	return nil
+}
+
+func (db *DB) updateAddAuthzIDs(ctx context.Context, accID string, addIDs ...string) error {
+	authzsByAccountMux.Lock()
+	defer authzsByAccountMux.Unlock()
+
+	oldIDs, err := db.getAuthzIDs(accID)
+	if err != nil {
+		return err
+	}
+	newIDs := append(append([]string{}, oldIDs...), addIDs...)
+	return db.saveAuthzIDs(ctx, accID, oldIDs, newIDs)
 }
 
 // UpdateAuthorization saves an updated ACME Authorization to the database.
@@ -120,24 +181,37 @@ func (db *DB) UpdateAuthorization(ctx context.Context, az *acme.Authorization) e
 	return db.save(ctx, old.ID, nu, old, "authz", authzTable)
 }
 
-// GetAuthorizationsByAccountID retrieves and unmarshals ACME authz types from the database.
-func (db *DB) GetAuthorizationsByAccountID(_ context.Context, accountID string) ([]*acme.Authorization, error) {
-	entries, err := db.db.List(authzTable)
+// GetAuthorizationsByAccountID retrieves and unmarshals the ACME authz types
+// of the account using the account index. The expired authorizations are
+// removed from the index. Authorizations created before the index existed are
+// not returned.
+func (db *DB) GetAuthorizationsByAccountID(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+	authzsByAccountMux.Lock()
+	defer authzsByAccountMux.Unlock()
+
+	ids, err := db.getAuthzIDs(accountID)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error listing authz")
+		return nil, err
 	}
+
+	now := clock.Now()
+	keep := []string{}
 	authzs := []*acme.Authorization{}
-	for _, entry := range entries {
+	for _, id := range ids {
+		b, err := db.db.Get(authzTable, []byte(id))
+		if nosql.IsErrNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "error loading authz %s", id)
+		}
 		dbaz := new(dbAuthz)
-		if err = json.Unmarshal(entry.Value, dbaz); err != nil {
-			return nil, errors.Wrapf(err, "error unmarshaling dbAuthz key '%s' into dbAuthz struct", string(entry.Key))
+		if err = json.Unmarshal(b, dbaz); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling dbAuthz key '%s' into dbAuthz struct", id)
 		}
-		// Filter out all dbAuthzs that don't belong to the accountID. This
-		// could be made more efficient with additional data structures mapping the
-		// Account ID to authorizations. Not trivial to do, though.
-		if dbaz.AccountID != accountID {
+		if !dbaz.ExpiresAt.After(now) {
 			continue
 		}
+		keep = append(keep, id)
 		authzs = append(authzs, &acme.Authorization{
 			ID:          dbaz.ID,
 			AccountID:   dbaz.AccountID,
@@ -152,5 +226,10 @@ func (db *DB) GetAuthorizationsByAccountID(_ context.Context, accountID string)
 		})
 	}
 
+	if len(keep) != len(ids) {
+		if err := db.saveAuthzIDs(ctx, accountID, ids, keep); err != nil {
+			return nil, err
+		}
+	}
 	return authzs, nil
 }
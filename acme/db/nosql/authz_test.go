@@ -192,6 +192,9 @@ func TestDB_GetAuthorization(t *testing.T) {
 							assert.Equals(t, string(key), azID)
 							return b, nil
 						case string(challengeTable):
+							if string(key) == "bar" {
+								return json.Marshal(&dbChallenge{ID: "bar"})
+							}
 							assert.Equals(t, string(key), "foo")
 							return nil, errors.New("force")
 						default:
@@ -230,6 +233,9 @@ func TestDB_GetAuthorization(t *testing.T) {
 							assert.Equals(t, string(key), azID)
 							return b, nil
 						case string(challengeTable):
+							if string(key) == "bar" {
+								return json.Marshal(&dbChallenge{ID: "bar"})
+							}
 							assert.Equals(t, string(key), "foo")
 							return nil, nosqldb.ErrNotFound
 						default:
@@ -260,7 +266,6 @@ func TestDB_GetAuthorization(t *testing.T) {
 			}
 			b, err := json.Marshal(dbaz)
 			assert.FatalError(t, err)
-			chCount := 0
 			fooChb, err := json.Marshal(&dbChallenge{ID: "foo"})
 			assert.FatalError(t, err)
 			barChb, err := json.Marshal(&dbChallenge{ID: "bar"})
@@ -273,13 +278,15 @@ func TestDB_GetAuthorization(t *testing.T) {
 							assert.Equals(t, string(key), azID)
 							return b, nil
 						case string(challengeTable):
-							if chCount == 0 {
-								chCount++
-								assert.Equals(t, string(key), "foo")
+							switch string(key) {
+							case "foo":
 								return fooChb, nil
+							case "bar":
+								return barChb, nil
+							default:
+								assert.FatalError(t, errors.Errorf("unexpected challenge '%s'", string(key)))
+								return nil, errors.New("force")
 							}
-							assert.Equals(t, string(key), "bar")
-							return barChb, nil
 						default:
 							assert.FatalError(t, errors.Errorf("unexpected bucket '%s'", string(bucket)))
 							return nil, errors.New("force")
@@ -330,10 +337,11 @@ func TestDB_GetAuthorization(t *testing.T) {
 func TestDB_CreateAuthorization(t *testing.T) {
 	azID := "azID"
 	type test struct {
-		db  nosql.DB
-		az  *acme.Authorization
-		err error
-		_id *string
+		db    nosql.DB
+		az    *acme.Authorization
+		err   error
+		_id   *string
+		check func(t *testing.T)
 	}
 	var tests = map[string]func(t *testing.T) test{
 		"fail/cmpAndSwap-error": func(t *testing.T) test {
@@ -385,6 +393,48 @@ func TestDB_CreateAuthorization(t *testing.T) {
 				err: errors.New("error saving acme authz: force"),
 			}
 		},
+		"fail/index-error": func(t *testing.T) test {
+			var deleted bool
+			az := &acme.Authorization{
+				ID:        azID,
+				AccountID: "accountID",
+				Identifier: acme.Identifier{
+					Type:  "dns",
+					Value: "test.ca.smallstep.com",
+				},
+				Status:    acme.StatusPending,
+				Token:     "token",
+				ExpiresAt: clock.Now().Add(5 * time.Minute),
+			}
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						return []byte(`["other"]`), nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						if string(bucket) == string(authzsByAccountIDTable) {
+							assert.Equals(t, old, []byte(`["other"]`))
+							assert.Equals(t, nu, []byte(`["other","`+az.ID+`"]`))
+							return nil, false, errors.New("force")
+						}
+						assert.Equals(t, bucket, authzTable)
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, authzTable)
+						assert.Equals(t, string(key), az.ID)
+						deleted = true
+						return nil
+					},
+				},
+				az:  az,
+				err: errors.New("error saving authzIDs index for account accountID: error saving acme authzIDsByAccountID: force"),
+				check: func(t *testing.T) {
+					assert.True(t, deleted)
+				},
+			}
+		},
 		"ok": func(t *testing.T) test {
 			var (
 				id    string
@@ -410,7 +460,18 @@ func TestDB_CreateAuthorization(t *testing.T) {
 			)
 			return test{
 				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), az.AccountID)
+						return nil, nosqldb.ErrNotFound
+					},
 					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						if string(bucket) == string(authzsByAccountIDTable) {
+							assert.Equals(t, string(key), az.AccountID)
+							assert.Equals(t, old, nil)
+							assert.Equals(t, nu, []byte(`["`+*idPtr+`"]`))
+							return nu, true, nil
+						}
 						*idPtr = string(key)
 						assert.Equals(t, bucket, authzTable)
 						assert.Equals(t, string(key), az.ID)
@@ -453,6 +514,9 @@ func TestDB_CreateAuthorization(t *testing.T) {
 					assert.Equals(t, tc.az.ID, *tc._id)
 				}
 			}
+			if tc.check != nil {
+				tc.check(t)
+			}
 		})
 	}
 }
@@ -630,36 +694,58 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 		authzs  []*acme.Authorization
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"fail/db.List-error": func(t *testing.T) test {
+		"fail/index-error": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
-					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), accountID)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading authzIDs for account accountID: force"),
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						if string(bucket) == string(authzsByAccountIDTable) {
+							return []byte(`["azID"]`), nil
+						}
 						assert.Equals(t, bucket, authzTable)
+						assert.Equals(t, string(key), azID)
 						return nil, errors.New("force")
 					},
 				},
-				err: errors.New("error listing authz: force"),
+				err: errors.New("error loading authz azID: force"),
 			}
 		},
 		"fail/unmarshal": func(t *testing.T) test {
-			b := []byte(`{malformed}`)
 			return test{
 				db: &db.MockNoSQLDB{
-					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
-						assert.Equals(t, bucket, authzTable)
-						return []*nosqldb.Entry{
-							{
-								Bucket: bucket,
-								Key:    []byte(azID),
-								Value:  b,
-							},
-						}, nil
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						if string(bucket) == string(authzsByAccountIDTable) {
+							return []byte(`["azID"]`), nil
+						}
+						return []byte(`{malformed}`), nil
 					},
 				},
 				authzs: nil,
 				err:    fmt.Errorf("error unmarshaling dbAuthz key '%s' into dbAuthz struct", azID),
 			}
 		},
+		"ok/no-index": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						return nil, nosqldb.ErrNotFound
+					},
+				},
+				authzs: []*acme.Authorization{},
+			}
+		},
 		"ok": func(t *testing.T) test {
 			now := clock.Now()
 			dbaz := &dbAuthz{
@@ -681,15 +767,14 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 
 			return test{
 				db: &db.MockNoSQLDB{
-					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						if string(bucket) == string(authzsByAccountIDTable) {
+							assert.Equals(t, string(key), accountID)
+							return []byte(`["azID"]`), nil
+						}
 						assert.Equals(t, bucket, authzTable)
-						return []*nosqldb.Entry{
-							{
-								Bucket: bucket,
-								Key:    []byte(azID),
-								Value:  b,
-							},
-						}, nil
+						assert.Equals(t, string(key), azID)
+						return b, nil
 					},
 				},
 				authzs: []*acme.Authorization{
@@ -707,39 +792,62 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 				},
 			}
 		},
-		"ok/skip-different-account": func(t *testing.T) test {
+		"ok/prune-expired-and-missing": func(t *testing.T) test {
 			now := clock.Now()
 			dbaz := &dbAuthz{
 				ID:        azID,
-				AccountID: "differentAccountID",
+				AccountID: accountID,
 				Identifier: acme.Identifier{
 					Type:  "dns",
 					Value: "test.ca.smallstep.com",
 				},
-				Status:       acme.StatusValid,
-				Token:        "token",
-				CreatedAt:    now,
-				ExpiresAt:    now.Add(5 * time.Minute),
-				ChallengeIDs: []string{"foo", "bar"},
-				Wildcard:     true,
+				Status:    acme.StatusValid,
+				Token:     "token",
+				CreatedAt: now,
+				ExpiresAt: now.Add(5 * time.Minute),
 			}
 			b, err := json.Marshal(dbaz)
 			assert.FatalError(t, err)
+			expired := dbaz.clone()
+			expired.ID = "expired"
+			expired.ExpiresAt = now.Add(-time.Minute)
+			eb, err := json.Marshal(expired)
+			assert.FatalError(t, err)
 
 			return test{
 				db: &db.MockNoSQLDB{
-					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
-						assert.Equals(t, bucket, authzTable)
-						return []*nosqldb.Entry{
-							{
-								Bucket: bucket,
-								Key:    []byte(azID),
-								Value:  b,
-							},
-						}, nil
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						if string(bucket) == string(authzsByAccountIDTable) {
+							return []byte(`["expired","missing","azID"]`), nil
+						}
+						switch string(key) {
+						case "expired":
+							return eb, nil
+						case azID:
+							return b, nil
+						default:
+							return nil, nosqldb.ErrNotFound
+						}
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), accountID)
+						assert.Equals(t, old, []byte(`["expired","missing","azID"]`))
+						assert.Equals(t, nu, []byte(`["azID"]`))
+						return nu, true, nil
+					},
+				},
+				authzs: []*acme.Authorization{
+					{
+						ID:         dbaz.ID,
+						AccountID:  dbaz.AccountID,
+						Token:      dbaz.Token,
+						Identifier: dbaz.Identifier,
+						Status:     dbaz.Status,
+						Wildcard:   dbaz.Wildcard,
+						ExpiresAt:  dbaz.ExpiresAt,
 					},
 				},
-				authzs: []*acme.Authorization{},
 			}
 		},
 	}
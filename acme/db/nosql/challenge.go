@@ -2,26 +2,81 @@ package nosql
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
 
 	"github.com/smallstep/certificates/acme"
 )
 
 type dbChallenge struct {
-	ID          string             `json:"id"`
-	AccountID   string             `json:"accountID"`
-	Type        acme.ChallengeType `json:"type"`
-	Status      acme.Status        `json:"status"`
-	Token       string             `json:"token"`
-	Value       string             `json:"value"`
-	ValidatedAt string             `json:"validatedAt"`
-	CreatedAt   time.Time          `json:"createdAt"`
-	Error       *acme.Error        `json:"error"` // TODO(hs): a bit dangerous; should become db-specific type
+	ID          string                `json:"id"`
+	AccountID   string                `json:"accountID"`
+	Type        acme.ChallengeType    `json:"type"`
+	Status      acme.Status           `json:"status"`
+	Token       string                `json:"token"`
+	Value       string                `json:"value"`
+	ValidatedAt string                `json:"validatedAt"`
+	CreatedAt   time.Time             `json:"createdAt"`
+	Error       *acme.Error           `json:"error"` // TODO(hs): a bit dangerous; should become db-specific type
+	Attempts    []*dbChallengeAttempt `json:"attempts,omitempty"`
+	// ProcessingAt is the time the challenge started processing.
+	ProcessingAt *time.Time `json:"processingAt,omitempty"`
+
+	// stored is the value read from the database if it was compressed.
+	stored []byte
+}
+
+func (dbc *dbChallenge) storedValue() []byte {
+	return dbc.stored
+}
+
+type dbChallengeAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Values     []string  `json:"values,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func toDBChallengeAttempts(attempts []*acme.ChallengeAttempt, limit int) []*dbChallengeAttempt {
+	if limit > 0 && len(attempts) > limit {
+		attempts = attempts[len(attempts)-limit:]
+	}
+	if len(attempts) == 0 {
+		return nil
+	}
+	dbas := make([]*dbChallengeAttempt, len(attempts))
+	for i, a := range attempts {
+		dbas[i] = &dbChallengeAttempt{
+			Time:       a.Time,
+			StatusCode: a.StatusCode,
+			Values:     a.Values,
+			Error:      a.Error,
+		}
+	}
+	return dbas
+}
+
+func (dbc *dbChallenge) attempts() []*acme.ChallengeAttempt {
+	if len(dbc.Attempts) == 0 {
+		return nil
+	}
+	attempts := make([]*acme.ChallengeAttempt, len(dbc.Attempts))
+	for i, a := range dbc.Attempts {
+		attempts[i] = &acme.ChallengeAttempt{
+			Time:       a.Time,
+			StatusCode: a.StatusCode,
+			Values:     a.Values,
+			Error:      a.Error,
+		}
+	}
+	return attempts
 }
 
 func (dbc *dbChallenge) clone() *dbChallenge {
@@ -32,18 +87,71 @@ func (dbc *dbChallenge) clone() *dbChallenge {
 func (db *DB) getDBChallenge(_ context.Context, id string) (*dbChallenge, error) {
 	data, err := db.db.Get(challengeTable, []byte(id))
 	if nosql.IsErrNotFound(err) {
-		return nil, acme.NewError(acme.ErrorMalformedType, "challenge %s not found", id)
+		return nil, acme.NewNotFoundError("challenge %s not found", id)
 	} else if err != nil {
 		return nil, errors.Wrapf(err, "error loading acme challenge %s", id)
 	}
 
 	dbch := new(dbChallenge)
-	if err := json.Unmarshal(data, dbch); err != nil {
+	compressed, err := unmarshalRecord(data, dbch)
+	if err != nil {
 		return nil, errors.Wrap(err, "error unmarshaling dbChallenge")
 	}
+	if compressed {
+		dbch.stored = data
+	}
 	return dbch, nil
 }
 
+// maxConcurrentChallengeLookups is the maximum number of challenges loaded
+// concurrently by getDBChallenges.
+const maxConcurrentChallengeLookups = 8
+
+// getDBChallenges loads the challenges with the given ids using a bounded
+// number of concurrent reads. The challenges are returned in the same order as
+// the ids. If any lookup fails, the error of the first failing id is returned.
+func (db *DB) getDBChallenges(ctx context.Context, ids []string) ([]*dbChallenge, error) {
+	dbchs := make([]*dbChallenge, len(ids))
+	errs := make([]error, len(ids))
+
+	g := new(errgroup.Group)
+	g.SetLimit(maxConcurrentChallengeLookups)
+	for i, id := range ids {
+		i, id := i, id
+		g.Go(func() error {
+			dbchs[i], errs[i] = db.getDBChallenge(ctx, id)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dbchs, nil
+}
+
+func (dbc *dbChallenge) toChallenge() *acme.Challenge {
+	var processingAt time.Time
+	if dbc.ProcessingAt != nil {
+		processingAt = *dbc.ProcessingAt
+	}
+	return &acme.Challenge{
+		ID:           dbc.ID,
+		AccountID:    dbc.AccountID,
+		Type:         dbc.Type,
+		Value:        dbc.Value,
+		Status:       dbc.Status,
+		Token:        dbc.Token,
+		Error:        dbc.Error,
+		ValidatedAt:  dbc.ValidatedAt,
+		Attempts:     dbc.attempts(),
+		ProcessingAt: processingAt,
+	}
+}
+
 // CreateChallenge creates a new ACME challenge data structure in the database.
 // Implements acme.DB.CreateChallenge interface.
 func (db *DB) CreateChallenge(ctx context.Context, ch *acme.Challenge) error {
@@ -74,18 +182,7 @@ func (db *DB) GetChallenge(ctx context.Context, id, authzID string) (*acme.Chall
 	if err != nil {
 		return nil, err
 	}
-
-	ch := &acme.Challenge{
-		ID:          dbch.ID,
-		AccountID:   dbch.AccountID,
-		Type:        dbch.Type,
-		Value:       dbch.Value,
-		Status:      dbch.Status,
-		Token:       dbch.Token,
-		Error:       dbch.Error,
-		ValidatedAt: dbch.ValidatedAt,
-	}
-	return ch, nil
+	return dbch.toChallenge(), nil
 }
 
 // UpdateChallenge updates an ACME challenge type in the database.
@@ -95,12 +192,165 @@ func (db *DB) UpdateChallenge(ctx context.Context, ch *acme.Challenge) error {
 		return err
 	}
 
+	return db.save(ctx, old.ID, db.updatedChallenge(old, ch), old, "challenge", challengeTable)
+}
+
+// UpdateChallenges updates the given ACME challenges in the database. The
+// challenges are updated in a single transaction if the backend supports them,
+// see saveAll for the guarantees.
+func (db *DB) UpdateChallenges(ctx context.Context, chs []*acme.Challenge) error {
+	updates := make([]challengeUpdate, 0, len(chs))
+	for _, ch := range chs {
+		old, err := db.getDBChallenge(ctx, ch.ID)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, challengeUpdate{id: old.ID, nu: db.updatedChallenge(old, ch), old: old})
+	}
+	return db.saveAll(ctx, updates)
+}
+
+// updatedChallenge returns a copy of the stored challenge with the values
+// changed by an update.
+func (db *DB) updatedChallenge(old *dbChallenge, ch *acme.Challenge) *dbChallenge {
 	nu := old.clone()
 
 	// These should be the only values changing in an Update request.
 	nu.Status = ch.Status
 	nu.Error = ch.Error
 	nu.ValidatedAt = ch.ValidatedAt
+	nu.Attempts = toDBChallengeAttempts(ch.Attempts, db.maxChallengeAttempts)
+	nu.ProcessingAt = nil
+	if !ch.ProcessingAt.IsZero() {
+		processingAt := ch.ProcessingAt
+		nu.ProcessingAt = &processingAt
+	}
+	return nu
+}
+
+// challengeUpdate is a compare-and-swap of a challenge applied by saveAll. Old
+// is the challenge read from the database and nu is the new value.
+type challengeUpdate struct {
+	id      string
+	nu, old *dbChallenge
+}
+
+func (u challengeUpdate) values() (nu, old interface{}) {
+	if u.nu != nil {
+		nu = u.nu
+	}
+	if u.old != nil {
+		old = u.old
+	}
+	return
+}
+
+// partialSaveError is the error returned by saveAll when the updates are applied
+// one by one and one of them fails. ID is the challenge that failed and Saved
+// contains the ids of the challenges saved before the failure.
+type partialSaveError struct {
+	ID    string
+	Saved []string
+	Err   error
+}
+
+func (e *partialSaveError) Error() string {
+	msg := fmt.Sprintf("%s (challenge %s)", e.Err, e.ID)
+	if len(e.Saved) > 0 {
+		msg += "; saved challenges " + strings.Join(e.Saved, ", ")
+	}
+	return msg
+}
+
+func (e *partialSaveError) Unwrap() error {
+	return e.Err
+}
+
+// saveAll applies the compare-and-swaps of the given challenges in a single
+// transaction. It's not atomic: the backends commit the compare-and-swaps that
+// succeed even if another one fails, so when a challenge has changed since it
+// was read the applied ones are reverted with a second transaction. Readers can
+// see the partial update until it's reverted, and the error reports if the
+// revert fails. If the backend does not support transactions, the updates are
+// applied in order until one fails, and a *partialSaveError reports the
+// challenges saved.
+func (db *DB) saveAll(ctx context.Context, updates []challengeUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	tx := new(database.Tx)
+	for _, u := range updates {
+		nu, old := u.values()
+		newB, oldB, err := db.marshalSave(ctx, nu, old, "challenge", challengeTable)
+		if err != nil {
+			return err
+		}
+		tx.Operations = append(tx.Operations, &database.TxEntry{
+			Bucket:   challengeTable,
+			Key:      []byte(u.id),
+			Value:    newB,
+			CmpValue: oldB,
+			Cmd:      database.CmpAndSwap,
+		})
+	}
 
-	return db.save(ctx, old.ID, nu, old, "challenge", challengeTable)
+	err := db.db.Update(tx)
+	switch {
+	case nosql.IsErrOpNotSupported(err):
+		return db.saveEach(ctx, updates)
+	case err != nil:
+		return errors.Wrap(err, "error saving acme challenges")
+	}
+
+	// The backends commit the transaction even if a compare-and-swap fails,
+	// so the ones applied are reverted with a second transaction.
+	var changed string
+	revert := new(database.Tx)
+	for _, q := range tx.Operations {
+		if !q.Swapped {
+			if changed == "" {
+				changed = string(q.Key)
+			}
+			continue
+		}
+		revert.Operations = append(revert.Operations, &database.TxEntry{
+			Bucket:   q.Bucket,
+			Key:      q.Key,
+			Value:    q.CmpValue,
+			CmpValue: q.Value,
+			Cmd:      database.CmpAndSwap,
+		})
+	}
+	if changed == "" {
+		return nil
+	}
+	if len(revert.Operations) > 0 {
+		if err := db.db.Update(revert); err != nil {
+			return errors.Wrapf(err, "error reverting acme challenges after challenge %s changed since last read", changed)
+		}
+		for _, q := range revert.Operations {
+			if !q.Swapped {
+				return errors.Errorf("error reverting acme challenge %s after challenge %s changed since last read", q.Key, changed)
+			}
+		}
+	}
+	return errors.Errorf("error saving acme challenge %s; changed since last read", changed)
+}
+
+// saveEach applies the given updates one by one.
+func (db *DB) saveEach(ctx context.Context, updates []challengeUpdate) error {
+	var saved []string
+	for _, u := range updates {
+		nu, old := u.values()
+		if err := db.save(ctx, u.id, nu, old, "challenge", challengeTable); err != nil {
+			return &partialSaveError{
+				ID:    u.id,
+				Saved: saved,
+				Err:   err,
+			}
+		}
+		saved = append(saved, u.id)
+	}
+	return nil
 }
@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"sync"
 	"testing"
 	"time"
 
@@ -122,6 +123,62 @@ func TestDB_getDBChallenge(t *testing.T) {
 	}
 }
 
+func TestDB_getDBChallenges(t *testing.T) {
+	ids := []string{"ch1", "ch2", "ch3", "ch4", "ch5", "ch6", "ch7", "ch8", "ch9", "ch10"}
+	var (
+		mu      sync.Mutex
+		maxRuns int
+		running int
+	)
+	newDB := func(missing ...string) nosql.DB {
+		return &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, challengeTable)
+				mu.Lock()
+				running++
+				if running > maxRuns {
+					maxRuns = running
+				}
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					running--
+					mu.Unlock()
+				}()
+				time.Sleep(time.Millisecond)
+				for _, id := range missing {
+					if id == string(key) {
+						return nil, nosqldb.ErrNotFound
+					}
+				}
+				return json.Marshal(&dbChallenge{ID: string(key), Status: acme.StatusPending})
+			},
+		}
+	}
+
+	d := DB{db: newDB()}
+	dbchs, err := d.getDBChallenges(context.Background(), ids)
+	assert.FatalError(t, err)
+	assert.Equals(t, len(dbchs), len(ids))
+	for i, dbch := range dbchs {
+		assert.Equals(t, dbch.ID, ids[i])
+	}
+	assert.True(t, maxRuns <= maxConcurrentChallengeLookups)
+
+	// The error of the first missing id is returned.
+	d = DB{db: newDB("ch7", "ch3")}
+	_, err = d.getDBChallenges(context.Background(), ids)
+	var ae *acme.Error
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.Equals(t, ae.Type, "urn:ietf:params:acme:error:malformed")
+		assert.Equals(t, ae.Err.Error(), "challenge ch3 not found")
+	}
+
+	dbchs, err = d.getDBChallenges(context.Background(), nil)
+	assert.FatalError(t, err)
+	assert.Equals(t, len(dbchs), 0)
+}
+
 func TestDB_CreateChallenge(t *testing.T) {
 	type test struct {
 		db  nosql.DB
@@ -434,6 +491,75 @@ func TestDB_UpdateChallenge(t *testing.T) {
 				},
 			}
 		},
+		"ok/stored-error": func(t *testing.T) test {
+			withErr := dbc.clone()
+			withErr.Error = acme.NewError(acme.ErrorConnectionType, "connection refused")
+			stored, err := json.Marshal(withErr)
+			assert.FatalError(t, err)
+			return test{
+				ch: &acme.Challenge{
+					ID:          dbc.ID,
+					AccountID:   dbc.AccountID,
+					Type:        dbc.Type,
+					Token:       dbc.Token,
+					Value:       dbc.Value,
+					Status:      acme.StatusValid,
+					ValidatedAt: "foobar",
+					Error:       acme.NewError(acme.ErrorMalformedType, "malformed"),
+				},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return stored, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, string(stored), string(old))
+						return nu, true, nil
+					},
+				},
+			}
+		},
+		"ok/legacy-record": func(t *testing.T) test {
+			// Challenges stored before the attempts and the processing time
+			// were recorded don't have those fields.
+			legacy, err := json.Marshal(struct {
+				ID          string             `json:"id"`
+				AccountID   string             `json:"accountID"`
+				Type        acme.ChallengeType `json:"type"`
+				Status      acme.Status        `json:"status"`
+				Token       string             `json:"token"`
+				Value       string             `json:"value"`
+				ValidatedAt string             `json:"validatedAt"`
+				CreatedAt   time.Time          `json:"createdAt"`
+				Error       *acme.Error        `json:"error"`
+			}{dbc.ID, dbc.AccountID, dbc.Type, dbc.Status, dbc.Token, dbc.Value, "", dbc.CreatedAt, nil})
+			assert.FatalError(t, err)
+			updCh := &acme.Challenge{
+				ID:          dbc.ID,
+				AccountID:   dbc.AccountID,
+				Type:        dbc.Type,
+				Token:       dbc.Token,
+				Value:       dbc.Value,
+				Status:      acme.StatusValid,
+				ValidatedAt: "foobar",
+				Error:       acme.NewError(acme.ErrorMalformedType, "malformed"),
+			}
+			return test{
+				ch: updCh,
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return legacy, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, string(legacy), string(old))
+						dbNew := new(dbChallenge)
+						assert.FatalError(t, json.Unmarshal(nu, dbNew))
+						assert.Equals(t, dbNew.Status, acme.StatusValid)
+						assert.Nil(t, dbNew.ProcessingAt)
+						return nu, true, nil
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -458,3 +584,262 @@ func TestDB_UpdateChallenge(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_UpdateChallenge_attempts(t *testing.T) {
+	now := clock.Now().Truncate(time.Second)
+	dbc := &dbChallenge{
+		ID:        "chID",
+		AccountID: "accountID",
+		Type:      "dns-01",
+		Status:    acme.StatusPending,
+		Token:     "token",
+		Value:     "test.ca.smallstep.com",
+		CreatedAt: now,
+	}
+	b, err := json.Marshal(dbc)
+	assert.FatalError(t, err)
+
+	var stored []byte
+	mockdb := &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, bucket, challengeTable)
+			assert.Equals(t, string(key), "chID")
+			if stored != nil {
+				return stored, nil
+			}
+			return b, nil
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			stored = nu
+			return nu, true, nil
+		},
+	}
+
+	ch := &acme.Challenge{
+		ID:     "chID",
+		Status: acme.StatusPending,
+		Attempts: []*acme.ChallengeAttempt{
+			{Time: now, Values: []string{"foo"}, Error: "foo"},
+			{Time: now.Add(time.Second), Values: []string{"bar"}, Error: "bar"},
+			{Time: now.Add(2 * time.Second), Values: []string{"zap"}},
+		},
+	}
+
+	d := DB{db: mockdb, maxChallengeAttempts: 2}
+	assert.FatalError(t, d.UpdateChallenge(context.Background(), ch))
+
+	got, err := d.GetChallenge(context.Background(), "chID", "azID")
+	assert.FatalError(t, err)
+	if assert.Equals(t, 2, len(got.Attempts)) {
+		assert.Equals(t, now.Add(time.Second), got.Attempts[0].Time)
+		assert.Equals(t, []string{"bar"}, got.Attempts[0].Values)
+		assert.Equals(t, "bar", got.Attempts[0].Error)
+		assert.Equals(t, now.Add(2*time.Second), got.Attempts[1].Time)
+		assert.Equals(t, []string{"zap"}, got.Attempts[1].Values)
+		assert.Equals(t, "", got.Attempts[1].Error)
+	}
+
+	// No limit
+	stored = nil
+	d = DB{db: mockdb}
+	assert.FatalError(t, d.UpdateChallenge(context.Background(), ch))
+	got, err = d.GetChallenge(context.Background(), "chID", "azID")
+	assert.FatalError(t, err)
+	assert.Equals(t, 3, len(got.Attempts))
+}
+
+func TestDB_saveAll(t *testing.T) {
+	newUpdates := func() ([]challengeUpdate, map[string][]byte) {
+		store := map[string][]byte{}
+		var updates []challengeUpdate
+		for _, id := range []string{"ch1", "ch2", "ch3"} {
+			old := &dbChallenge{ID: id, Status: acme.StatusPending, Token: "token"}
+			nu := old.clone()
+			nu.Status = acme.StatusValid
+			b, err := json.Marshal(old)
+			assert.FatalError(t, err)
+			store[id] = b
+			updates = append(updates, challengeUpdate{id: id, nu: nu, old: old})
+		}
+		return updates, store
+	}
+	// cas applies a compare-and-swap to the store like the backends do.
+	cas := func(store map[string][]byte, key, old, nu []byte) bool {
+		if string(store[string(key)]) != string(old) {
+			return false
+		}
+		store[string(key)] = nu
+		return true
+	}
+	status := func(store map[string][]byte, id string) acme.Status {
+		dbc := new(dbChallenge)
+		assert.FatalError(t, json.Unmarshal(store[id], dbc))
+		return dbc.Status
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		updates, store := newUpdates()
+		var calls int
+		d := DB{db: &db.MockNoSQLDB{
+			MUpdate: func(tx *nosqldb.Tx) error {
+				calls++
+				assert.Equals(t, 3, len(tx.Operations))
+				for _, q := range tx.Operations {
+					assert.Equals(t, challengeTable, q.Bucket)
+					assert.Equals(t, nosqldb.CmpAndSwap, q.Cmd)
+					q.Swapped = cas(store, q.Key, q.CmpValue, q.Value)
+				}
+				return nil
+			},
+		}}
+		assert.FatalError(t, d.saveAll(context.Background(), updates))
+		assert.Equals(t, 1, calls)
+		for _, id := range []string{"ch1", "ch2", "ch3"} {
+			assert.Equals(t, acme.StatusValid, status(store, id))
+		}
+	})
+
+	t.Run("fail/changed", func(t *testing.T) {
+		updates, store := newUpdates()
+		store["ch2"] = []byte(`{"id":"ch2","status":"invalid"}`)
+		var calls int
+		d := DB{db: &db.MockNoSQLDB{
+			MUpdate: func(tx *nosqldb.Tx) error {
+				calls++
+				for _, q := range tx.Operations {
+					q.Swapped = cas(store, q.Key, q.CmpValue, q.Value)
+				}
+				return nil
+			},
+		}}
+		err := d.saveAll(context.Background(), updates)
+		assert.Equals(t, "error saving acme challenge ch2; changed since last read", err.Error())
+		assert.Equals(t, 2, calls)
+		// None of the updates is applied.
+		assert.Equals(t, acme.StatusPending, status(store, "ch1"))
+		assert.Equals(t, acme.StatusInvalid, status(store, "ch2"))
+		assert.Equals(t, acme.StatusPending, status(store, "ch3"))
+	})
+
+	t.Run("fail/revert", func(t *testing.T) {
+		updates, store := newUpdates()
+		store["ch3"] = []byte(`{"id":"ch3","status":"invalid"}`)
+		var calls int
+		d := DB{db: &db.MockNoSQLDB{
+			MUpdate: func(tx *nosqldb.Tx) error {
+				if calls++; calls == 2 {
+					return errors.New("force")
+				}
+				for _, q := range tx.Operations {
+					q.Swapped = cas(store, q.Key, q.CmpValue, q.Value)
+				}
+				return nil
+			},
+		}}
+		err := d.saveAll(context.Background(), updates)
+		assert.Equals(t, "error reverting acme challenges after challenge ch3 changed since last read: force", err.Error())
+	})
+
+	t.Run("fail/update", func(t *testing.T) {
+		updates, store := newUpdates()
+		d := DB{db: &db.MockNoSQLDB{
+			MUpdate: func(tx *nosqldb.Tx) error {
+				return errors.New("force")
+			},
+		}}
+		err := d.saveAll(context.Background(), updates)
+		assert.Equals(t, "error saving acme challenges: force", err.Error())
+		assert.Equals(t, acme.StatusPending, status(store, "ch1"))
+	})
+
+	t.Run("ok/no-transactions", func(t *testing.T) {
+		updates, store := newUpdates()
+		d := DB{db: &db.MockNoSQLDB{
+			MUpdate: func(tx *nosqldb.Tx) error {
+				return nosqldb.ErrOpNotSupported
+			},
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				return nu, cas(store, key, old, nu), nil
+			},
+		}}
+		assert.FatalError(t, d.saveAll(context.Background(), updates))
+		for _, id := range []string{"ch1", "ch2", "ch3"} {
+			assert.Equals(t, acme.StatusValid, status(store, id))
+		}
+	})
+
+	t.Run("fail/no-transactions", func(t *testing.T) {
+		updates, store := newUpdates()
+		store["ch2"] = []byte(`{"id":"ch2","status":"invalid"}`)
+		d := DB{db: &db.MockNoSQLDB{
+			MUpdate: func(tx *nosqldb.Tx) error {
+				return nosqldb.ErrOpNotSupported
+			},
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				return nu, cas(store, key, old, nu), nil
+			},
+		}}
+		err := d.saveAll(context.Background(), updates)
+		var perr *partialSaveError
+		if assert.True(t, errors.As(err, &perr)) {
+			assert.Equals(t, "ch2", perr.ID)
+			assert.Equals(t, []string{"ch1"}, perr.Saved)
+		}
+		assert.Equals(t, "error saving acme challenge; changed since last read (challenge ch2); saved challenges ch1", err.Error())
+		assert.Equals(t, acme.StatusValid, status(store, "ch1"))
+		assert.Equals(t, acme.StatusPending, status(store, "ch3"))
+	})
+
+	t.Run("ok/empty", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MUpdate: func(tx *nosqldb.Tx) error {
+				return errors.New("force")
+			},
+		}}
+		assert.FatalError(t, d.saveAll(context.Background(), nil))
+	})
+}
+
+func TestDB_UpdateChallenges(t *testing.T) {
+	store := map[string][]byte{}
+	for _, id := range []string{"ch1", "ch2"} {
+		b, err := json.Marshal(&dbChallenge{ID: id, Status: acme.StatusPending, Token: "token"})
+		assert.FatalError(t, err)
+		store[id] = b
+	}
+	var calls int
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, challengeTable, bucket)
+			return store[string(key)], nil
+		},
+		MUpdate: func(tx *nosqldb.Tx) error {
+			calls++
+			assert.Equals(t, 2, len(tx.Operations))
+			for _, q := range tx.Operations {
+				if string(store[string(q.Key)]) == string(q.CmpValue) {
+					store[string(q.Key)] = q.Value
+					q.Swapped = true
+				}
+			}
+			return nil
+		},
+	}}
+
+	err := d.UpdateChallenges(context.Background(), []*acme.Challenge{
+		{ID: "ch1", Status: acme.StatusDeactivated},
+		{ID: "ch2", Status: acme.StatusDeactivated},
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, calls)
+	for _, id := range []string{"ch1", "ch2"} {
+		dbc := new(dbChallenge)
+		assert.FatalError(t, json.Unmarshal(store[id], dbc))
+		assert.Equals(t, acme.StatusDeactivated, dbc.Status)
+		assert.Equals(t, "token", dbc.Token)
+	}
+
+	err = d.UpdateChallenges(context.Background(), []*acme.Challenge{{ID: "missing"}})
+	assert.Error(t, err)
+	assert.Equals(t, 1, calls)
+}
@@ -0,0 +1,194 @@
+package nosql
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Types of the records written by Export.
+const (
+	ExportAccountType      = "account"
+	ExportAccountKeyIDType = "accountKeyID"
+	ExportOrderType        = "order"
+	ExportAccountOrderType = "accountOrders"
+	ExportAuthzType        = "authz"
+	ExportAccountAuthzType = "accountAuthzs"
+	ExportChallengeType    = "challenge"
+	ExportCheckpointType   = "checkpoint"
+)
+
+// ErrIncompleteExport is returned by Import if the stream ends before the
+// final checkpoint of the export.
+var ErrIncompleteExport = errors.New("acme export is incomplete")
+
+// exportTables are the tables written by Export, in order. The values of the
+// raw tables are not JSON and are encoded as JSON strings.
+var exportTables = []struct {
+	typ   string
+	table []byte
+	raw   bool
+}{
+	{ExportAccountType, accountTable, false},
+	{ExportAccountKeyIDType, accountByKeyIDTable, true},
+	{ExportOrderType, orderTable, false},
+	{ExportAccountOrderType, ordersByAccountIDTable, false},
+	{ExportAuthzType, authzTable, false},
+	{ExportAccountAuthzType, authzsByAccountIDTable, false},
+	{ExportChallengeType, challengeTable, false},
+}
+
+// ExportCheckpoint is the marker written by Export after all the records of a
+// type. After is the type of the last exported records, Records is the number
+// of records written so far and Complete is set on the last checkpoint.
+type ExportCheckpoint struct {
+	After    string `json:"after"`
+	Records  int    `json:"records"`
+	Complete bool   `json:"complete,omitempty"`
+}
+
+type exportRecord struct {
+	Type string          `json:"type"`
+	Key  string          `json:"key,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+	*ExportCheckpoint
+}
+
+// Export writes the ACME accounts, orders, authorizations, challenges and the
+// indexes between them to w in the JSON Lines format, one record per line.
+// The stored values are copied without decoding them, except the compressed
+// records, which are exported uncompressed. The nosql interface can
+// only list whole tables, so the entries of one table at a time are kept in
+// memory.
+//
+// A checkpoint record is written after each type of records, the last one
+// flagged as complete, so an interrupted export can be continued with
+// ExportFrom.
+func (db *DB) Export(ctx context.Context, w io.Writer) error {
+	return db.ExportFrom(ctx, w, nil)
+}
+
+// ExportFrom works like Export but starts after the given checkpoint, skipping
+// the types already exported. A nil checkpoint exports all the records.
+func (db *DB) ExportFrom(ctx context.Context, w io.Writer, cp *ExportCheckpoint) error {
+	start, records := 0, 0
+	if cp != nil {
+		if cp.Complete {
+			return nil
+		}
+		start = -1
+		for i, t := range exportTables {
+			if t.typ == cp.After {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return errors.Errorf("invalid export checkpoint after %q", cp.After)
+		}
+		records = cp.Records
+	}
+
+	enc := json.NewEncoder(w)
+	for i := start; i < len(exportTables); i++ {
+		t := exportTables[i]
+		entries, err := db.db.List(t.table)
+		if err != nil {
+			return errors.Wrapf(err, "error listing %s", string(t.table))
+		}
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var data json.RawMessage
+			if t.raw {
+				if data, err = json.Marshal(string(entry.Value)); err != nil {
+					return errors.Wrapf(err, "error encoding %s %s", t.typ, string(entry.Key))
+				}
+			} else if _, err := unmarshalRecord(entry.Value, &data); err != nil {
+				return errors.Wrapf(err, "error decoding %s %s", t.typ, string(entry.Key))
+			}
+			if err := enc.Encode(exportRecord{Type: t.typ, Key: string(entry.Key), Data: data}); err != nil {
+				return errors.Wrapf(err, "error writing %s %s", t.typ, string(entry.Key))
+			}
+			records++
+		}
+		if err := enc.Encode(exportRecord{Type: ExportCheckpointType, ExportCheckpoint: &ExportCheckpoint{
+			After:    t.typ,
+			Records:  records,
+			Complete: i == len(exportTables)-1,
+		}}); err != nil {
+			return errors.Wrap(err, "error writing checkpoint")
+		}
+	}
+	return nil
+}
+
+// Import reads the records written by Export from r and stores them in the
+// database, overwriting the existing ones with the same keys, so an
+// interrupted import can be safely repeated. The challenges and orders are
+// stored compressed if the database compresses them. It returns the last
+// checkpoint read and ErrIncompleteExport if the stream does not end with the
+// final checkpoint.
+func (db *DB) Import(ctx context.Context, r io.Reader) (*ExportCheckpoint, error) {
+	tables := make(map[string]int, len(exportTables))
+	for i, t := range exportTables {
+		tables[t.typ] = i
+	}
+
+	var cp *ExportCheckpoint
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return cp, err
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec exportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return cp, errors.Wrapf(err, "error decoding record on line %d", line)
+		}
+		if rec.Type == ExportCheckpointType {
+			if rec.ExportCheckpoint == nil {
+				return cp, errors.Errorf("invalid checkpoint on line %d", line)
+			}
+			cp = rec.ExportCheckpoint
+			continue
+		}
+		i, ok := tables[rec.Type]
+		if !ok {
+			return cp, errors.Errorf("unknown record type %q on line %d", rec.Type, line)
+		}
+		if rec.Key == "" || len(rec.Data) == 0 {
+			return cp, errors.Errorf("invalid %s record on line %d", rec.Type, line)
+		}
+		value := []byte(rec.Data)
+		if t := exportTables[i]; t.raw {
+			var s string
+			if err := json.Unmarshal(rec.Data, &s); err != nil {
+				return cp, errors.Wrapf(err, "error decoding %s record on line %d", rec.Type, line)
+			}
+			value = []byte(s)
+		} else if n := db.compressionSize(ctx, t.table); n > 0 && len(value) >= n {
+			var err error
+			if value, err = compressRecord(value); err != nil {
+				return cp, errors.Wrapf(err, "error compressing %s %s", rec.Type, rec.Key)
+			}
+		}
+		if err := db.db.Set(exportTables[i].table, []byte(rec.Key), value); err != nil {
+			return cp, errors.Wrapf(err, "error saving %s %s", rec.Type, rec.Key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cp, errors.Wrap(err, "error reading export")
+	}
+	if cp == nil || !cp.Complete {
+		return cp, ErrIncompleteExport
+	}
+	return cp, nil
+}
@@ -0,0 +1,195 @@
+package nosql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/db"
+	nosqldb "github.com/smallstep/nosql/database"
+)
+
+// newMapDB returns a mock database storing the values in the given map,
+// indexed by table and key.
+func newMapDB(tables map[string]map[string][]byte) *db.MockNoSQLDB {
+	return &db.MockNoSQLDB{
+		MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+			var entries []*nosqldb.Entry
+			for k, v := range tables[string(bucket)] {
+				entries = append(entries, &nosqldb.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			sort.Slice(entries, func(i, j int) bool {
+				return string(entries[i].Key) < string(entries[j].Key)
+			})
+			return entries, nil
+		},
+		MSet: func(bucket, key, value []byte) error {
+			if tables[string(bucket)] == nil {
+				tables[string(bucket)] = map[string][]byte{}
+			}
+			tables[string(bucket)][string(key)] = value
+			return nil
+		},
+	}
+}
+
+func exportTestTables(t *testing.T) map[string]map[string][]byte {
+	mustJSON := func(v interface{}) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+	return map[string]map[string][]byte{
+		string(accountTable): {
+			"accID": mustJSON(&dbAccount{ID: "accID", Status: "valid", Contact: []string{"mailto:foo@example.com"}}),
+		},
+		string(accountByKeyIDTable): {
+			"kid": []byte("accID"),
+		},
+		string(orderTable): {
+			"ordID": mustJSON(&dbOrder{ID: "ordID", AccountID: "accID", AuthorizationIDs: []string{"azID"}}),
+		},
+		string(ordersByAccountIDTable): {
+			"accID": mustJSON([]string{"ordID"}),
+		},
+		string(authzTable): {
+			"azID": mustJSON(&dbAuthz{ID: "azID", AccountID: "accID", ChallengeIDs: []string{"chID1", "chID2"}}),
+		},
+		string(authzsByAccountIDTable): {
+			"accID": mustJSON([]string{"azID"}),
+		},
+		string(challengeTable): {
+			"chID1": mustJSON(&dbChallenge{ID: "chID1", AccountID: "accID", Type: "http-01"}),
+			"chID2": mustJSON(&dbChallenge{ID: "chID2", AccountID: "accID", Type: "dns-01"}),
+		},
+	}
+}
+
+func TestDB_Export_roundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := exportTestTables(t)
+	var buf bytes.Buffer
+	assert.FatalError(t, (&DB{db: newMapDB(src)}).Export(ctx, &buf))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equals(t, 15, len(lines))
+	var last exportRecord
+	assert.FatalError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &last))
+	assert.Equals(t, ExportCheckpointType, last.Type)
+	assert.Equals(t, &ExportCheckpoint{After: ExportChallengeType, Records: 8, Complete: true}, last.ExportCheckpoint)
+
+	dst := map[string]map[string][]byte{}
+	cp, err := (&DB{db: newMapDB(dst)}).Import(ctx, bytes.NewReader(buf.Bytes()))
+	assert.FatalError(t, err)
+	assert.Equals(t, last.ExportCheckpoint, cp)
+	assert.Equals(t, src, dst)
+}
+
+func TestDB_Export_compressed(t *testing.T) {
+	ctx := context.Background()
+	src := exportTestTables(t)
+	want := exportTestTables(t)
+	compressed, err := compressRecord(src[string(challengeTable)]["chID1"])
+	assert.FatalError(t, err)
+	src[string(challengeTable)]["chID1"] = compressed
+
+	// The compressed records are exported uncompressed.
+	var buf bytes.Buffer
+	assert.FatalError(t, (&DB{db: newMapDB(src)}).Export(ctx, &buf))
+	dst := map[string]map[string][]byte{}
+	_, err = (&DB{db: newMapDB(dst)}).Import(ctx, bytes.NewReader(buf.Bytes()))
+	assert.FatalError(t, err)
+	assert.Equals(t, want, dst)
+
+	// The challenges and orders are imported compressed if the database
+	// compresses them.
+	dst = map[string]map[string][]byte{}
+	_, err = (&DB{db: newMapDB(dst), compress: true, compressionThreshold: 1}).Import(ctx, bytes.NewReader(buf.Bytes()))
+	assert.FatalError(t, err)
+	for _, table := range [][]byte{challengeTable, orderTable, authzTable} {
+		for k, v := range dst[string(table)] {
+			assert.Equals(t, !bytes.Equal(table, authzTable), bytes.HasPrefix(v, compressedPrefix))
+			var data json.RawMessage
+			_, err := unmarshalRecord(v, &data)
+			assert.FatalError(t, err)
+			assert.Equals(t, want[string(table)][k], []byte(data))
+		}
+	}
+}
+
+func TestDB_ExportFrom(t *testing.T) {
+	ctx := context.Background()
+	src := exportTestTables(t)
+	var buf bytes.Buffer
+	assert.FatalError(t, (&DB{db: newMapDB(src)}).Export(ctx, &buf))
+
+	// Import only up to the checkpoint after the orders.
+	var partial bytes.Buffer
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		partial.Write(scanner.Bytes())
+		partial.WriteByte('\n')
+		if strings.Contains(scanner.Text(), `"after":"order"`) {
+			break
+		}
+	}
+	dst := map[string]map[string][]byte{}
+	d := &DB{db: newMapDB(dst)}
+	cp, err := d.Import(ctx, &partial)
+	assert.Equals(t, ErrIncompleteExport, err)
+	assert.Equals(t, &ExportCheckpoint{After: ExportOrderType, Records: 3}, cp)
+	assert.Equals(t, 3, len(dst))
+
+	// Resume the export after the checkpoint.
+	var rest bytes.Buffer
+	assert.FatalError(t, (&DB{db: newMapDB(src)}).ExportFrom(ctx, &rest, cp))
+	cp, err = d.Import(ctx, &rest)
+	assert.FatalError(t, err)
+	assert.Equals(t, &ExportCheckpoint{After: ExportChallengeType, Records: 8, Complete: true}, cp)
+	assert.Equals(t, src, dst)
+
+	// A complete checkpoint does not export anything.
+	rest.Reset()
+	assert.FatalError(t, (&DB{db: newMapDB(src)}).ExportFrom(ctx, &rest, cp))
+	assert.Equals(t, 0, rest.Len())
+
+	err = (&DB{db: newMapDB(src)}).ExportFrom(ctx, &rest, &ExportCheckpoint{After: "foo"})
+	assert.HasPrefix(t, err.Error(), `invalid export checkpoint after "foo"`)
+}
+
+func TestDB_Export_errors(t *testing.T) {
+	ctx := context.Background()
+	d := &DB{db: &db.MockNoSQLDB{
+		MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}}
+	err := d.Export(ctx, &bytes.Buffer{})
+	assert.HasPrefix(t, err.Error(), "error listing acme_accounts: force")
+
+	for name, tc := range map[string]struct {
+		input string
+		err   string
+	}{
+		"fail/decode":   {"{", "error decoding record on line 1"},
+		"fail/type":     {`{"type":"foo","key":"k","data":{}}`, `unknown record type "foo" on line 1`},
+		"fail/key":      {`{"type":"account","data":{}}`, "invalid account record on line 1"},
+		"fail/raw":      {`{"type":"accountKeyID","key":"k","data":{}}`, "error decoding accountKeyID record on line 1"},
+		"fail/no-final": {`{"type":"checkpoint","after":"account","records":0}`, ErrIncompleteExport.Error()},
+		"fail/empty":    {"", ErrIncompleteExport.Error()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := &DB{db: newMapDB(map[string]map[string][]byte{})}
+			_, err := d.Import(ctx, strings.NewReader(tc.input))
+			if assert.NotNil(t, err) {
+				assert.HasPrefix(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
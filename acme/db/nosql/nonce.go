@@ -3,6 +3,10 @@ package nosql
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -40,7 +44,13 @@ func (db *DB) CreateNonce(ctx context.Context) (acme.Nonce, error) {
 // DeleteNonce verifies that the nonce is valid (by checking if it exists),
 // and if so, consumes the nonce resource by deleting it from the database.
 func (db *DB) DeleteNonce(_ context.Context, nonce acme.Nonce) error {
-	err := db.db.Update(&database.Tx{
+	_, err := db.consumeNonce(nonce)
+	return err
+}
+
+// consumeNonce deletes the given nonce and returns its stored value.
+func (db *DB) consumeNonce(nonce acme.Nonce) ([]byte, error) {
+	tx := &database.Tx{
 		Operations: []*database.TxEntry{
 			{
 				Bucket: nonceTable,
@@ -53,14 +63,137 @@ func (db *DB) DeleteNonce(_ context.Context, nonce acme.Nonce) error {
 				Cmd:    database.Delete,
 			},
 		},
-	})
+	}
+	err := db.db.Update(tx)
 
 	switch {
 	case nosql.IsErrNotFound(err):
-		return acme.NewError(acme.ErrorBadNonceType, "nonce %s not found", string(nonce))
+		return nil, acme.NewError(acme.ErrorBadNonceType, "nonce %s not found", string(nonce))
 	case err != nil:
-		return errors.Wrapf(err, "error deleting nonce %s", string(nonce))
+		return nil, errors.Wrapf(err, "error deleting nonce %s", string(nonce))
 	default:
-		return nil
+		return tx.Operations[0].Result, nil
+	}
+}
+
+// nonceStorePurgeInterval is the time between two purges of the nonces of a
+// NonceStore.
+const nonceStorePurgeInterval = time.Minute
+
+// NonceStore is an acme.NonceStore that keeps the nonces in the database, so
+// they can be shared by multiple CA instances. The nonces expire after the
+// TTL. Once started, the store purges the expired nonces, and the oldest ones
+// if there are more than the maximum, once a minute in the background.
+type NonceStore struct {
+	db        *DB
+	ttl       time.Duration
+	maxSize   int
+	now       func() time.Time
+	startOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+// NewNonceStore creates a new NonceStore that keeps the nonces in the given
+// database, with the given TTL and maximum number of nonces,
+// acme.DefaultNonceTTL and acme.DefaultNonceStoreSize if they are 0.
+func NewNonceStore(db *DB, ttl time.Duration, maxSize int) *NonceStore {
+	if ttl <= 0 {
+		ttl = acme.DefaultNonceTTL
+	}
+	if maxSize <= 0 {
+		maxSize = acme.DefaultNonceStoreSize
+	}
+	return &NonceStore{
+		db:      db,
+		ttl:     ttl,
+		maxSize: maxSize,
+		now:     clock.Now,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start starts purging the nonces in the background until the store is
+// closed. Calling it more than once has no effect.
+func (s *NonceStore) Start() {
+	s.startOnce.Do(func() {
+		go s.run(nonceStorePurgeInterval)
+	})
+}
+
+// Close stops purging the nonces. It implements the io.Closer interface.
+func (s *NonceStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
+func (s *NonceStore) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.purge()
+		}
+	}
+}
+
+// New creates and returns a new nonce. Implements the acme.NonceStore
+// interface.
+func (s *NonceStore) New(ctx context.Context) (acme.Nonce, error) {
+	return s.db.CreateNonce(ctx)
+}
+
+// Consume deletes the given nonce. It returns a badNonce error if the nonce
+// does not exist or it has expired. Implements the acme.NonceStore interface.
+func (s *NonceStore) Consume(_ context.Context, nonce acme.Nonce) error {
+	b, err := s.db.consumeNonce(nonce)
+	if err != nil {
+		return err
+	}
+	n := new(dbNonce)
+	if err := json.Unmarshal(b, n); err != nil {
+		return errors.Wrapf(err, "error unmarshaling nonce %s", string(nonce))
+	}
+	if !s.now().Before(n.CreatedAt.Add(s.ttl)) {
+		return acme.NewError(acme.ErrorBadNonceType, "nonce %s has expired", string(nonce))
+	}
+	return nil
+}
+
+// purge deletes the expired nonces and the oldest ones over the maximum.
+// Errors are logged, the nonces are purged again on the next interval.
+func (s *NonceStore) purge() {
+	now := s.now()
+	entries, err := s.db.db.List(nonceTable)
+	if err != nil {
+		log.Printf("error listing acme nonces: %v", err)
+		return
+	}
+	var nonces []*dbNonce
+	for _, e := range entries {
+		// Nonces that cannot be read are purged.
+		n := new(dbNonce)
+		if err := json.Unmarshal(e.Value, n); err != nil {
+			n = new(dbNonce)
+		}
+		n.ID = string(e.Key)
+		nonces = append(nonces, n)
+	}
+	// Newest first, so the oldest ones are over the maximum.
+	sort.SliceStable(nonces, func(i, j int) bool {
+		return nonces[i].CreatedAt.After(nonces[j].CreatedAt)
+	})
+	for i, n := range nonces {
+		if i < s.maxSize && now.Before(n.CreatedAt.Add(s.ttl)) {
+			continue
+		}
+		if err := s.db.db.Del(nonceTable, []byte(n.ID)); err != nil && !nosql.IsErrNotFound(err) {
+			log.Printf("error deleting acme nonce %s: %v", n.ID, err)
+		}
 	}
 }
@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -166,3 +167,128 @@ func TestDB_DeleteNonce(t *testing.T) {
 		})
 	}
 }
+
+// newNonceTestDB returns a database that keeps the nonces in the given table.
+func newNonceTestDB(table map[string][]byte) *db.MockNoSQLDB {
+	return &db.MockNoSQLDB{
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			table[string(key)] = nu
+			return nu, true, nil
+		},
+		MUpdate: func(tx *database.Tx) error {
+			key := string(tx.Operations[0].Key)
+			v, ok := table[key]
+			if !ok {
+				return database.ErrNotFound
+			}
+			tx.Operations[0].Result = v
+			delete(table, key)
+			return nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			var entries []*database.Entry
+			for k, v := range table {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+		MDel: func(bucket, key []byte) error {
+			delete(table, string(key))
+			return nil
+		},
+	}
+}
+
+func TestNonceStore(t *testing.T) {
+	ctx := context.Background()
+	table := map[string][]byte{}
+	s := NewNonceStore(&DB{db: newNonceTestDB(table)}, time.Minute, 3)
+	var offset time.Duration
+	s.now = func() time.Time { return clock.Now().Add(offset) }
+
+	n1, err := s.New(ctx)
+	assert.FatalError(t, err)
+	n2, err := s.New(ctx)
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, len(table))
+
+	// Nonces can only be used once.
+	assert.FatalError(t, s.Consume(ctx, n1))
+	err = s.Consume(ctx, n1)
+	var ae *acme.Error
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.Equals(t, acme.NewError(acme.ErrorBadNonceType, "").Type, ae.Type)
+		assert.Equals(t, "nonce "+n1.String()+" not found", ae.Err.Error())
+	}
+
+	// Expired nonces are rejected.
+	offset = time.Minute
+	err = s.Consume(ctx, n2)
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.Equals(t, acme.NewError(acme.ErrorBadNonceType, "").Type, ae.Type)
+		assert.Equals(t, "nonce "+n2.String()+" has expired", ae.Err.Error())
+	}
+	assert.Equals(t, 0, len(table))
+}
+
+func TestNonceStore_purge(t *testing.T) {
+	ctx := context.Background()
+	now := clock.Now()
+	table := map[string][]byte{}
+	for i, age := range []time.Duration{2 * time.Hour, 30 * time.Minute, 20 * time.Minute, 10 * time.Minute, 5 * time.Minute} {
+		b, err := json.Marshal(&dbNonce{ID: fmt.Sprintf("n%d", i), CreatedAt: now.Add(-age)})
+		assert.FatalError(t, err)
+		table[fmt.Sprintf("n%d", i)] = b
+	}
+	table["broken"] = []byte("foo")
+
+	// The creation of a nonce does not purge them.
+	s := NewNonceStore(&DB{db: newNonceTestDB(table)}, time.Hour, 3)
+	s.now = func() time.Time { return now }
+	n, err := s.New(ctx)
+	assert.FatalError(t, err)
+	assert.Equals(t, 7, len(table))
+
+	// The expired nonce, the unreadable one and the oldest over the maximum
+	// are deleted.
+	s.purge()
+	keys := func() map[string]bool {
+		m := map[string]bool{}
+		for k := range table {
+			m[k] = true
+		}
+		return m
+	}
+	assert.Equals(t, map[string]bool{n.String(): true, "n3": true, "n4": true}, keys())
+}
+
+func TestNonceStore_run(t *testing.T) {
+	now := clock.Now()
+	table := map[string][]byte{}
+	for i := 0; i < 5; i++ {
+		b, err := json.Marshal(&dbNonce{ID: fmt.Sprintf("n%d", i), CreatedAt: now.Add(-time.Duration(i) * time.Minute)})
+		assert.FatalError(t, err)
+		table[fmt.Sprintf("n%d", i)] = b
+	}
+
+	s := NewNonceStore(&DB{db: newNonceTestDB(table)}, time.Hour, 2)
+	s.now = func() time.Time { return now }
+	done := make(chan struct{})
+	go func() {
+		s.run(time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.FatalError(t, s.Close())
+	assert.FatalError(t, s.Close())
+	<-done
+	assert.Equals(t, 2, len(table))
+	assert.NotNil(t, table["n0"])
+	assert.NotNil(t, table["n1"])
+}
+
+func TestNewNonceStore_defaults(t *testing.T) {
+	s := NewNonceStore(&DB{}, 0, 0)
+	assert.Equals(t, acme.DefaultNonceTTL, s.ttl)
+	assert.Equals(t, acme.DefaultNonceStoreSize, s.maxSize)
+}
@@ -1,13 +1,18 @@
 package nosql
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"io"
 	"time"
 
 	"github.com/pkg/errors"
 	nosqlDB "github.com/smallstep/nosql"
 	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/acme"
 )
 
 var (
@@ -18,24 +23,72 @@ var (
 	nonceTable                                = []byte("nonces")
 	orderTable                                = []byte("acme_orders")
 	ordersByAccountIDTable                    = []byte("acme_account_orders_index")
+	authzsByAccountIDTable                    = []byte("acme_account_authzs_index")
 	certTable                                 = []byte("acme_certs")
 	certBySerialTable                         = []byte("acme_serial_certs_index")
 	externalAccountKeyTable                   = []byte("acme_external_account_keys")
 	externalAccountKeyIDsByReferenceTable     = []byte("acme_external_account_keyID_reference_index")
 	externalAccountKeyIDsByProvisionerIDTable = []byte("acme_external_account_keyID_provisionerID_index")
+	rateLimitTable                            = []byte("acme_rate_limits")
 )
 
+// DefaultMaxChallengeAttempts is the default number of validation attempts
+// stored with each challenge.
+const DefaultMaxChallengeAttempts = 10
+
+// DefaultCompressionThreshold is the default minimum size, in bytes, of the
+// JSON value of the compressed challenges and orders.
+const DefaultCompressionThreshold = 1024
+
 // DB is a struct that implements the AcmeDB interface.
 type DB struct {
-	db nosqlDB.DB
+	db                   nosqlDB.DB
+	maxChallengeAttempts int
+	compress             bool
+	compressionThreshold int
+}
+
+// Option is the type of options passed to New.
+type Option func(db *DB)
+
+// WithMaxChallengeAttempts sets the maximum number of validation attempts
+// stored with each challenge. Older attempts are discarded when a challenge is
+// updated. A value lower than or equal to 0 disables the limit.
+func WithMaxChallengeAttempts(n int) Option {
+	return func(db *DB) {
+		db.maxChallengeAttempts = n
+	}
+}
+
+// WithCompression enables the compression of the challenges and orders of all
+// the provisioners. Without it, only the records of the provisioners with
+// compressRecords are compressed.
+func WithCompression() Option {
+	return func(db *DB) {
+		db.compress = true
+	}
+}
+
+// WithCompressionThreshold sets the minimum size, in bytes, of the JSON value
+// of the compressed challenges and orders. Smaller records are stored
+// uncompressed. A value lower than or equal to 0 uses
+// DefaultCompressionThreshold.
+func WithCompressionThreshold(n int) Option {
+	return func(db *DB) {
+		if n > 0 {
+			db.compressionThreshold = n
+		}
+	}
 }
 
 // New configures and returns a new ACME DB backend implemented using a nosql DB.
-func New(db nosqlDB.DB) (*DB, error) {
+func New(db nosqlDB.DB, opts ...Option) (*DB, error) {
 	tables := [][]byte{accountTable, accountByKeyIDTable, authzTable,
 		challengeTable, nonceTable, orderTable, ordersByAccountIDTable,
+		authzsByAccountIDTable,
 		certTable, certBySerialTable, externalAccountKeyTable,
 		externalAccountKeyIDsByReferenceTable, externalAccountKeyIDsByProvisionerIDTable,
+		rateLimitTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -43,32 +96,23 @@ func New(db nosqlDB.DB) (*DB, error) {
 				string(b))
 		}
 	}
-	return &DB{db}, nil
+	d := &DB{
+		db:                   db,
+		maxChallengeAttempts: DefaultMaxChallengeAttempts,
+		compressionThreshold: DefaultCompressionThreshold,
+	}
+	for _, fn := range opts {
+		fn(d)
+	}
+	return d, nil
 }
 
 // save writes the new data to the database, overwriting the old data if it
 // existed.
-func (db *DB) save(_ context.Context, id string, nu, old interface{}, typ string, table []byte) error {
-	var (
-		err  error
-		newB []byte
-	)
-	if nu == nil {
-		newB = nil
-	} else {
-		newB, err = json.Marshal(nu)
-		if err != nil {
-			return errors.Wrapf(err, "error marshaling acme type: %s, value: %v", typ, nu)
-		}
-	}
-	var oldB []byte
-	if old == nil {
-		oldB = nil
-	} else {
-		oldB, err = json.Marshal(old)
-		if err != nil {
-			return errors.Wrapf(err, "error marshaling acme type: %s, value: %v", typ, old)
-		}
+func (db *DB) save(ctx context.Context, id string, nu, old interface{}, typ string, table []byte) error {
+	newB, oldB, err := db.marshalSave(ctx, nu, old, typ, table)
+	if err != nil {
+		return err
 	}
 
 	_, swapped, err := db.db.CmpAndSwap(table, []byte(id), oldB, newB)
@@ -82,6 +126,89 @@ func (db *DB) save(_ context.Context, id string, nu, old interface{}, typ string
 	}
 }
 
+// marshalSave returns the JSON encoding of the new and old data of a save. Nil
+// values are encoded as nil. The new value of the challenges and orders is
+// compressed if it's enabled in the context, the old value uses the encoding
+// it was read with.
+func (db *DB) marshalSave(ctx context.Context, nu, old interface{}, typ string, table []byte) (newB, oldB []byte, err error) {
+	if nu != nil {
+		newB, err = json.Marshal(nu)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error marshaling acme type: %s, value: %v", typ, nu)
+		}
+		if n := db.compressionSize(ctx, table); n > 0 && len(newB) >= n {
+			if newB, err = compressRecord(newB); err != nil {
+				return nil, nil, errors.Wrapf(err, "error compressing acme %s", typ)
+			}
+		}
+	}
+	if old != nil {
+		if r, ok := old.(storedRecord); ok && r.storedValue() != nil {
+			return newB, r.storedValue(), nil
+		}
+		oldB, err = json.Marshal(old)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error marshaling acme type: %s, value: %v", typ, old)
+		}
+	}
+	return newB, oldB, nil
+}
+
+// compressedPrefix are the magic bytes of the gzip format. All the compressed
+// records start with them, and a JSON value never does.
+var compressedPrefix = []byte{0x1f, 0x8b}
+
+// storedRecord is implemented by the records that keep the compressed value
+// read from the database. It's used as the old value of the compare-and-swaps,
+// as compressing the same JSON again is not guaranteed to give the same bytes.
+type storedRecord interface {
+	storedValue() []byte
+}
+
+// compressionSize returns the minimum size of the records of the given table
+// compressed in the given context, or 0 if they are not compressed. Only the
+// challenges and orders are compressed.
+func (db *DB) compressionSize(ctx context.Context, table []byte) int {
+	if !bytes.Equal(table, challengeTable) && !bytes.Equal(table, orderTable) {
+		return 0
+	}
+	if !db.compress {
+		if p, ok := acme.ProvisionerFromContext(ctx); !ok || !p.GetCompressRecords() {
+			return 0
+		}
+	}
+	return db.compressionThreshold
+}
+
+func compressRecord(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalRecord parses the JSON value of a record, stored compressed or not,
+// and stores the result in the value pointed to by v. It returns true if the
+// record was compressed.
+func unmarshalRecord(b []byte, v interface{}) (compressed bool, err error) {
+	if bytes.HasPrefix(b, compressedPrefix) {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return true, err
+		}
+		if b, err = io.ReadAll(zr); err != nil {
+			return true, err
+		}
+		compressed = true
+	}
+	return compressed, json.Unmarshal(b, v)
+}
+
 var idLen = 32
 
 func randID() (val string, err error) {
@@ -1,13 +1,17 @@
 package nosql
 
 import (
+	"bytes"
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/nosql"
+	nosqldb "github.com/smallstep/nosql/database"
 )
 
 func TestNew(t *testing.T) {
@@ -137,3 +141,105 @@ func TestDB_save(t *testing.T) {
 		})
 	}
 }
+
+// newCmpAndSwapDB returns a mock database storing the values in the given
+// map, indexed by table and key, with compare-and-swap semantics.
+func newCmpAndSwapDB(tables map[string]map[string][]byte) *db.MockNoSQLDB {
+	return &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if v, ok := tables[string(bucket)][string(key)]; ok {
+				return v, nil
+			}
+			return nil, nosqldb.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			if tables[string(bucket)] == nil {
+				tables[string(bucket)] = map[string][]byte{}
+			}
+			cur := tables[string(bucket)][string(key)]
+			if !bytes.Equal(cur, old) {
+				return cur, false, nil
+			}
+			tables[string(bucket)][string(key)] = nu
+			return nu, true, nil
+		},
+	}
+}
+
+func TestDB_compression(t *testing.T) {
+	ctx := context.Background()
+	tables := map[string]map[string][]byte{}
+	mdb := newCmpAndSwapDB(tables)
+	isCompressed := func(id string) bool {
+		return bytes.HasPrefix(tables[string(challengeTable)][id], compressedPrefix)
+	}
+	attempts := func(n int) []*acme.ChallengeAttempt {
+		var a []*acme.ChallengeAttempt
+		for i := 0; i < n; i++ {
+			a = append(a, &acme.ChallengeAttempt{Time: clock.Now(), StatusCode: 404, Error: strings.Repeat("x", 100)})
+		}
+		return a
+	}
+
+	// Uncompressed records.
+	plain := &DB{db: mdb, compressionThreshold: 512}
+	ch := &acme.Challenge{AccountID: "accID", Type: "http-01", Token: "token", Value: "example.com"}
+	assert.FatalError(t, plain.CreateChallenge(ctx, ch))
+	ch.Attempts = attempts(5)
+	assert.FatalError(t, plain.UpdateChallenge(ctx, ch))
+	assert.False(t, isCompressed(ch.ID))
+
+	// Records under the threshold are not compressed.
+	d := &DB{db: mdb, compress: true, compressionThreshold: 512}
+	small := &acme.Challenge{AccountID: "accID", Type: "dns-01", Token: "token", Value: "example.com"}
+	assert.FatalError(t, d.CreateChallenge(ctx, small))
+	assert.False(t, isCompressed(small.ID))
+
+	// An uncompressed record is compressed on update.
+	got, err := d.GetChallenge(ctx, ch.ID, "")
+	assert.FatalError(t, err)
+	assert.Equals(t, 5, len(got.Attempts))
+	got.Attempts = attempts(6)
+	assert.FatalError(t, d.UpdateChallenge(ctx, got))
+	assert.True(t, isCompressed(ch.ID))
+
+	// Compressed records are read and updated transparently, with compression
+	// enabled or not.
+	for _, d := range []*DB{d, plain} {
+		got, err := d.GetChallenge(ctx, ch.ID, "")
+		assert.FatalError(t, err)
+		assert.Equals(t, 6, len(got.Attempts))
+		got.Status = acme.StatusValid
+		assert.FatalError(t, d.UpdateChallenge(ctx, got))
+		got, err = d.GetChallenge(ctx, ch.ID, "")
+		assert.FatalError(t, err)
+		assert.Equals(t, acme.StatusValid, got.Status)
+	}
+	assert.False(t, isCompressed(ch.ID))
+
+	// A compressed record changed since it was read is not overwritten.
+	got.Status = acme.StatusPending
+	assert.FatalError(t, d.UpdateChallenge(ctx, got))
+	assert.True(t, isCompressed(ch.ID))
+	dbch, err := d.getDBChallenge(ctx, ch.ID)
+	assert.FatalError(t, err)
+	got.Status = acme.StatusInvalid
+	assert.FatalError(t, d.UpdateChallenge(ctx, got))
+	err = d.save(ctx, ch.ID, dbch.clone(), dbch, "challenge", challengeTable)
+	assert.HasPrefix(t, err.Error(), "error saving acme challenge; changed since last read")
+
+	// The provisioner can enable the compression of its records.
+	d = &DB{db: mdb, compressionThreshold: 512}
+	pctx := acme.NewProvisionerContext(ctx, &acme.MockProvisioner{
+		MgetCompressRecords: func() bool { return true },
+	})
+	o := &acme.Order{AccountID: "accID", ProvisionerID: "provID", AuthorizationIDs: []string{strings.Repeat("a", 600)}}
+	assert.FatalError(t, d.CreateOrder(pctx, o))
+	assert.True(t, bytes.HasPrefix(tables[string(orderTable)][o.ID], compressedPrefix))
+	o.Status = acme.StatusReady
+	assert.FatalError(t, d.UpdateOrder(ctx, o))
+	assert.False(t, bytes.HasPrefix(tables[string(orderTable)][o.ID], compressedPrefix))
+	gotOrder, err := d.GetOrder(ctx, o.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, acme.StatusReady, gotOrder.Status)
+}
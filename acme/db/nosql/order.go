@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"sort"
 	"sync"
 	"time"
 
@@ -23,10 +24,18 @@ type dbOrder struct {
 	Status           acme.Status       `json:"status"`
 	NotBefore        time.Time         `json:"notBefore,omitempty"`
 	NotAfter         time.Time         `json:"notAfter,omitempty"`
+	Profile          string            `json:"profile,omitempty"`
 	CreatedAt        time.Time         `json:"createdAt"`
 	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
 	CertificateID    string            `json:"certificate,omitempty"`
 	Error            *acme.Error       `json:"error,omitempty"`
+
+	// stored is the value read from the database if it was compressed.
+	stored []byte
+}
+
+func (a *dbOrder) storedValue() []byte {
+	return a.stored
 }
 
 func (a *dbOrder) clone() *dbOrder {
@@ -43,9 +52,13 @@ func (db *DB) getDBOrder(_ context.Context, id string) (*dbOrder, error) {
 		return nil, errors.Wrapf(err, "error loading order %s", id)
 	}
 	o := new(dbOrder)
-	if err := json.Unmarshal(b, &o); err != nil {
+	compressed, err := unmarshalRecord(b, o)
+	if err != nil {
 		return nil, errors.Wrapf(err, "error unmarshaling order %s into dbOrder", id)
 	}
+	if compressed {
+		o.stored = b
+	}
 	return o, nil
 }
 
@@ -55,22 +68,24 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 	if err != nil {
 		return nil, err
 	}
+	return dbo.toOrder(), nil
+}
 
-	o := &acme.Order{
-		ID:               dbo.ID,
-		AccountID:        dbo.AccountID,
-		ProvisionerID:    dbo.ProvisionerID,
-		CertificateID:    dbo.CertificateID,
-		Status:           dbo.Status,
-		ExpiresAt:        dbo.ExpiresAt,
-		Identifiers:      dbo.Identifiers,
-		NotBefore:        dbo.NotBefore,
-		NotAfter:         dbo.NotAfter,
-		AuthorizationIDs: dbo.AuthorizationIDs,
-		Error:            dbo.Error,
+func (a *dbOrder) toOrder() *acme.Order {
+	return &acme.Order{
+		ID:               a.ID,
+		AccountID:        a.AccountID,
+		ProvisionerID:    a.ProvisionerID,
+		CertificateID:    a.CertificateID,
+		Status:           a.Status,
+		ExpiresAt:        a.ExpiresAt,
+		Identifiers:      a.Identifiers,
+		NotBefore:        a.NotBefore,
+		NotAfter:         a.NotAfter,
+		Profile:          a.Profile,
+		AuthorizationIDs: a.AuthorizationIDs,
+		Error:            a.Error,
 	}
-
-	return o, nil
 }
 
 // CreateOrder creates ACME Order resources and saves them to the DB.
@@ -92,6 +107,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		Identifiers:      o.Identifiers,
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
+		Profile:          o.Profile,
 		AuthorizationIDs: o.AuthorizationIDs,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
@@ -185,3 +201,86 @@ func (db *DB) updateAddOrderIDs(ctx context.Context, accID string, addOids ...st
 func (db *DB) GetOrdersByAccountID(ctx context.Context, accID string) ([]string, error) {
 	return db.updateAddOrderIDs(ctx, accID)
 }
+
+// defaultOrdersByAccountLimit is the maximum number of orders returned by
+// GetOrdersByAccount if no limit is given.
+const defaultOrdersByAccountLimit = 100
+
+// GetOrdersByAccount returns the orders of an account in any state, sorted by
+// creation time. Unlike GetOrdersByAccountID, which only returns the pending
+// orders as required by RFC 8555, it's meant to be used to inspect the
+// history of an account.
+//
+// At most limit orders, or 100 if limit is not positive, are returned. The
+// orders start after the one with the cursor ID, or at the oldest one if the
+// cursor is empty. The returned cursor is the ID of the last order returned,
+// or an empty string if there are no more orders.
+func (db *DB) GetOrdersByAccount(_ context.Context, accID, cursor string, limit int) ([]*acme.Order, string, error) {
+	if limit <= 0 {
+		limit = defaultOrdersByAccountLimit
+	}
+
+	entries, err := db.db.List(orderTable)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return []*acme.Order{}, "", nil
+		}
+		return nil, "", errors.Wrap(err, "error listing orders")
+	}
+
+	var dbos []*dbOrder
+	for _, e := range entries {
+		dbo := new(dbOrder)
+		if _, err := unmarshalRecord(e.Value, dbo); err != nil {
+			return nil, "", errors.Wrapf(err, "error unmarshaling order %s into dbOrder", string(e.Key))
+		}
+		if dbo.AccountID == accID {
+			dbos = append(dbos, dbo)
+		}
+	}
+	sort.Slice(dbos, func(i, j int) bool {
+		if dbos[i].CreatedAt.Equal(dbos[j].CreatedAt) {
+			return dbos[i].ID < dbos[j].ID
+		}
+		return dbos[i].CreatedAt.Before(dbos[j].CreatedAt)
+	})
+
+	if cursor != "" {
+		i := 0
+		for ; i < len(dbos); i++ {
+			if dbos[i].ID == cursor {
+				break
+			}
+		}
+		if i == len(dbos) {
+			return nil, "", acme.NewError(acme.ErrorMalformedType, "order %s not found", cursor)
+		}
+		dbos = dbos[i+1:]
+	}
+
+	var next string
+	if len(dbos) > limit {
+		dbos = dbos[:limit]
+		next = dbos[limit-1].ID
+	}
+
+	orders := make([]*acme.Order, len(dbos))
+	for i, dbo := range dbos {
+		orders[i] = dbo.toOrder()
+	}
+	return orders, next, nil
+}
+
+// GetOrderAuthorizations returns the authorizations of an order, with their
+// challenges, in the same order as the authorization IDs of the order.
+func (db *DB) GetOrderAuthorizations(ctx context.Context, o *acme.Order) ([]*acme.Authorization, error) {
+	azs := make([]*acme.Authorization, len(o.AuthorizationIDs))
+	for i, azID := range o.AuthorizationIDs {
+		az, err := db.GetAuthorization(ctx, azID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading authorization %s of order %s", azID, o.ID)
+		}
+		azs[i] = az
+	}
+	return azs, nil
+}
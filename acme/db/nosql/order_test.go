@@ -1023,3 +1023,98 @@ func TestDB_updateAddOrderIDs(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_GetOrdersByAccount(t *testing.T) {
+	now := clock.Now()
+	newEntry := func(id, accID string, createdAt time.Time) *database.Entry {
+		b, err := json.Marshal(&dbOrder{ID: id, AccountID: accID, Status: acme.StatusValid, CreatedAt: createdAt})
+		assert.FatalError(t, err)
+		return &database.Entry{Bucket: orderTable, Key: []byte(id), Value: b}
+	}
+	entries := []*database.Entry{
+		newEntry("o3", "accID", now.Add(time.Minute)),
+		newEntry("o1", "accID", now.Add(-time.Minute)),
+		newEntry("other", "otherAccID", now),
+		newEntry("o2", "accID", now),
+	}
+	d := DB{db: &db.MockNoSQLDB{
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, bucket, orderTable)
+			return entries, nil
+		},
+	}}
+	ids := func(orders []*acme.Order) []string {
+		var res []string
+		for _, o := range orders {
+			res = append(res, o.ID)
+		}
+		return res
+	}
+
+	orders, cursor, err := d.GetOrdersByAccount(context.Background(), "accID", "", 0)
+	assert.FatalError(t, err)
+	assert.Equals(t, ids(orders), []string{"o1", "o2", "o3"})
+	assert.Equals(t, orders[0].Status, acme.StatusValid)
+	assert.Equals(t, cursor, "")
+
+	orders, cursor, err = d.GetOrdersByAccount(context.Background(), "accID", "", 2)
+	assert.FatalError(t, err)
+	assert.Equals(t, ids(orders), []string{"o1", "o2"})
+	assert.Equals(t, cursor, "o2")
+
+	orders, cursor, err = d.GetOrdersByAccount(context.Background(), "accID", cursor, 2)
+	assert.FatalError(t, err)
+	assert.Equals(t, ids(orders), []string{"o3"})
+	assert.Equals(t, cursor, "")
+
+	_, _, err = d.GetOrdersByAccount(context.Background(), "accID", "other", 2)
+	assert.Equals(t, err.Error(), "order other not found")
+
+	orders, _, err = d.GetOrdersByAccount(context.Background(), "missingAccID", "", 0)
+	assert.FatalError(t, err)
+	assert.Equals(t, len(orders), 0)
+
+	d = DB{db: &db.MockNoSQLDB{
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}}
+	_, _, err = d.GetOrdersByAccount(context.Background(), "accID", "", 0)
+	assert.Equals(t, err.Error(), "error listing orders: force")
+
+	d = DB{db: &db.MockNoSQLDB{
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return []*database.Entry{{Bucket: orderTable, Key: []byte("o1"), Value: []byte("foo")}}, nil
+		},
+	}}
+	_, _, err = d.GetOrdersByAccount(context.Background(), "accID", "", 0)
+	assert.HasPrefix(t, err.Error(), "error unmarshaling order o1 into dbOrder")
+}
+
+func TestDB_GetOrderAuthorizations(t *testing.T) {
+	azb, err := json.Marshal(&dbAuthz{ID: "az1", Status: acme.StatusValid, ChallengeIDs: []string{"ch1"}})
+	assert.FatalError(t, err)
+	chb, err := json.Marshal(&dbChallenge{ID: "ch1", Status: acme.StatusValid})
+	assert.FatalError(t, err)
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			switch {
+			case string(bucket) == string(authzTable) && string(key) == "az1":
+				return azb, nil
+			case string(bucket) == string(challengeTable) && string(key) == "ch1":
+				return chb, nil
+			default:
+				return nil, database.ErrNotFound
+			}
+		},
+	}}
+
+	azs, err := d.GetOrderAuthorizations(context.Background(), &acme.Order{ID: "o1", AuthorizationIDs: []string{"az1"}})
+	assert.FatalError(t, err)
+	assert.Equals(t, len(azs), 1)
+	assert.Equals(t, azs[0].ID, "az1")
+	assert.Equals(t, azs[0].Challenges, []*acme.Challenge{{ID: "ch1", Status: acme.StatusValid}})
+
+	_, err = d.GetOrderAuthorizations(context.Background(), &acme.Order{ID: "o1", AuthorizationIDs: []string{"az1", "az2"}})
+	assert.Equals(t, err.Error(), "error loading authorization az2 of order o1: authz az2 not found")
+}
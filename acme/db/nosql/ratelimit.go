@@ -0,0 +1,73 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/nosql"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+type dbRateLimitCounter struct {
+	Count       int       `json:"count"`
+	WindowStart time.Time `json:"windowStart"`
+}
+
+func toDBRateLimitCounter(c *acme.RateLimitCounter) *dbRateLimitCounter {
+	if c == nil {
+		return nil
+	}
+	return &dbRateLimitCounter{
+		Count:       c.Count,
+		WindowStart: c.WindowStart.UTC(),
+	}
+}
+
+// GetRateLimitCounter retrieves and unmarshals a rate limit counter. It
+// returns nil if it does not exist. Implements the acme.RateLimitStore
+// interface.
+func (db *DB) GetRateLimitCounter(_ context.Context, key string) (*acme.RateLimitCounter, error) {
+	data, err := db.db.Get(rateLimitTable, []byte(key))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading acme rate limit counter %s", key)
+	}
+
+	dbc := new(dbRateLimitCounter)
+	if err := json.Unmarshal(data, dbc); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling acme rate limit counter %s", key)
+	}
+	return &acme.RateLimitCounter{
+		Count:       dbc.Count,
+		WindowStart: dbc.WindowStart,
+	}, nil
+}
+
+// UpdateRateLimitCounter replaces the rate limit counter if it has not changed
+// since it was read. Implements the acme.RateLimitStore interface.
+func (db *DB) UpdateRateLimitCounter(_ context.Context, key string, old, nu *acme.RateLimitCounter) (bool, error) {
+	var oldB []byte
+	if old != nil {
+		b, err := json.Marshal(toDBRateLimitCounter(old))
+		if err != nil {
+			return false, errors.Wrapf(err, "error marshaling acme rate limit counter %s", key)
+		}
+		oldB = b
+	}
+	newB, err := json.Marshal(toDBRateLimitCounter(nu))
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling acme rate limit counter %s", key)
+	}
+
+	_, swapped, err := db.db.CmpAndSwap(rateLimitTable, []byte(key), oldB, newB)
+	if err != nil {
+		return false, errors.Wrapf(err, "error saving acme rate limit counter %s", key)
+	}
+	return swapped, nil
+}
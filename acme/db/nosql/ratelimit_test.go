@@ -0,0 +1,141 @@
+package nosql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_GetRateLimitCounter(t *testing.T) {
+	windowStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type test struct {
+		db  nosql.DB
+		exp *acme.RateLimitCounter
+		err error
+	}
+	var tests = map[string]test{
+		"ok/not-found": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, bucket, rateLimitTable)
+					assert.Equals(t, string(key), "orders/provID/dns:zap.internal")
+					return nil, database.ErrNotFound
+				},
+			},
+		},
+		"fail/db.Get-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, errors.New("force")
+				},
+			},
+			err: errors.New("error loading acme rate limit counter orders/provID/dns:zap.internal: force"),
+		},
+		"fail/unmarshal-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return []byte("foo"), nil
+				},
+			},
+			err: errors.New("error unmarshaling acme rate limit counter orders/provID/dns:zap.internal"),
+		},
+		"ok": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return []byte(`{"count":2,"windowStart":"2024-01-01T00:00:00Z"}`), nil
+				},
+			},
+			exp: &acme.RateLimitCounter{Count: 2, WindowStart: windowStart},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			c, err := d.GetRateLimitCounter(context.Background(), "orders/provID/dns:zap.internal")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, c, tc.exp)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateRateLimitCounter(t *testing.T) {
+	windowStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := &acme.RateLimitCounter{Count: 1, WindowStart: windowStart}
+	nu := &acme.RateLimitCounter{Count: 2, WindowStart: windowStart}
+	type test struct {
+		db      nosql.DB
+		old     *acme.RateLimitCounter
+		swapped bool
+		err     error
+	}
+	var tests = map[string]test{
+		"fail/db.CmpAndSwap-error": {
+			db: &db.MockNoSQLDB{
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("force")
+				},
+			},
+			err: errors.New("error saving acme rate limit counter key: force"),
+		},
+		"ok/new": {
+			db: &db.MockNoSQLDB{
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					assert.Equals(t, bucket, rateLimitTable)
+					assert.Equals(t, string(key), "key")
+					assert.Equals(t, old, nil)
+					assert.Equals(t, string(nu), `{"count":2,"windowStart":"2024-01-01T00:00:00Z"}`)
+					return nu, true, nil
+				},
+			},
+			swapped: true,
+		},
+		"ok/update": {
+			db: &db.MockNoSQLDB{
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					assert.Equals(t, string(old), `{"count":1,"windowStart":"2024-01-01T00:00:00Z"}`)
+					assert.Equals(t, string(nu), `{"count":2,"windowStart":"2024-01-01T00:00:00Z"}`)
+					return nu, true, nil
+				},
+			},
+			old:     old,
+			swapped: true,
+		},
+		"ok/changed": {
+			db: &db.MockNoSQLDB{
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					return []byte(`{"count":3,"windowStart":"2024-01-01T00:00:00Z"}`), false, nil
+				},
+			},
+			old: old,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			swapped, err := d.UpdateRateLimitCounter(context.Background(), "key", tc.old, nu)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, swapped, tc.swapped)
+			}
+		})
+	}
+}
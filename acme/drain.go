@@ -0,0 +1,127 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultDrainTimeout is the time Drain waits for the running challenge
+// validations if the CA does not configure one.
+const DefaultDrainTimeout = 30 * time.Second
+
+// drainRetryAfter is the time clients are asked to wait before retrying a
+// validation rejected while draining.
+const drainRetryAfter = 10 * time.Second
+
+// errValidationsDrained is the cause of the cancellation of the validations
+// that did not finish before the drain deadline.
+var errValidationsDrained = errors.New("challenge validations drained")
+
+// drainingError is the error returned to clients that try to validate a
+// challenge while the validations are being drained.
+type drainingError struct{}
+
+func (drainingError) Error() string {
+	return "challenge validations are being drained"
+}
+
+// RetryAfter implements render.RetryAfterError.
+func (drainingError) RetryAfter() time.Duration {
+	return drainRetryAfter
+}
+
+// ValidationCoordinator tracks the challenge validations in flight so they can
+// be drained gracefully when the CA shuts down.
+type ValidationCoordinator struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+}
+
+// NewValidationCoordinator creates a new ValidationCoordinator.
+func NewValidationCoordinator() *ValidationCoordinator {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &ValidationCoordinator{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// start registers a new validation. It returns the context the validation
+// must use, which is canceled if the validation does not finish before the
+// drain deadline, and the function to call when the validation finishes. It
+// fails if the validations are being drained.
+func (c *ValidationCoordinator) start(ctx context.Context) (context.Context, func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.draining {
+		return nil, nil, &Error{
+			Type:   errorServerInternalMetadata.typ,
+			Detail: "The server is shutting down",
+			Status: http.StatusServiceUnavailable,
+			Err:    drainingError{},
+		}
+	}
+
+	c.wg.Add(1)
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(c.ctx, func() {
+		cancel(context.Cause(c.ctx))
+	})
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		c.wg.Done()
+	}, nil
+}
+
+// Drain stops accepting new validations and waits for the running ones to
+// finish. If the given context is done before, the running validations are
+// canceled, the challenges are kept as pending so the clients can retry them,
+// and Drain returns the context error once they return.
+func (c *ValidationCoordinator) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.cancel(errValidationsDrained)
+		<-done
+		return ctx.Err()
+	}
+}
+
+// isDrained returns true if the validation using the given context was
+// canceled by Drain.
+func isDrained(ctx context.Context) bool {
+	return ctx != nil && errors.Is(context.Cause(ctx), errValidationsDrained)
+}
+
+type validationCoordinatorKey struct{}
+
+// NewValidationCoordinatorContext adds the given validation coordinator to the
+// context.
+func NewValidationCoordinatorContext(ctx context.Context, c *ValidationCoordinator) context.Context {
+	return context.WithValue(ctx, validationCoordinatorKey{}, c)
+}
+
+// ValidationCoordinatorFromContext returns the current validation coordinator
+// from the given context.
+func ValidationCoordinatorFromContext(ctx context.Context) (c *ValidationCoordinator, ok bool) {
+	c, ok = ctx.Value(validationCoordinatorKey{}).(*ValidationCoordinator)
+	return
+}
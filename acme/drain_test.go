@@ -0,0 +1,119 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func TestValidationCoordinator_Drain(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+
+	// validate starts the validation of an http-01 challenge that responds
+	// with the given body once release is closed.
+	validate := func(c *ValidationCoordinator, body string, release chan struct{}) (*Challenge, chan error) {
+		started := make(chan struct{})
+		ch := &Challenge{ID: "chID", Type: HTTP01, Status: StatusPending, Token: "token", Value: "zap.internal"}
+		ctx := NewValidationCoordinatorContext(context.Background(), c)
+		ctx = NewClientContext(ctx, &mockClient{
+			get: func(string) (*http.Response, error) {
+				close(started)
+				<-release
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}, nil
+			},
+		})
+		db := &MockDB{
+			MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+				return nil
+			},
+		}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- ch.Validate(ctx, db, jwk, nil)
+		}()
+		<-started
+		return ch, errCh
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		c := NewValidationCoordinator()
+		release := make(chan struct{})
+		ch, errCh := validate(c, keyAuth, release)
+
+		drained := make(chan error, 1)
+		go func() {
+			drained <- c.Drain(context.Background())
+		}()
+
+		// New validations are rejected while draining.
+		require.Eventually(t, func() bool {
+			_, done, err := c.start(context.Background())
+			if err != nil {
+				return true
+			}
+			done()
+			return false
+		}, time.Second, time.Millisecond)
+		select {
+		case <-drained:
+			t.Fatal("Drain returned before the validation finished")
+		default:
+		}
+
+		// The validation in progress completes during the drain.
+		close(release)
+		require.NoError(t, <-errCh)
+		require.NoError(t, <-drained)
+		assert.Equal(t, StatusValid, ch.Status)
+	})
+
+	t.Run("ok/deadline", func(t *testing.T) {
+		c := NewValidationCoordinator()
+		release := make(chan struct{})
+		ch, errCh := validate(c, "wrong", release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		drained := make(chan error, 1)
+		go func() {
+			drained <- c.Drain(ctx)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+
+		// The canceled validation is kept as pending.
+		require.NoError(t, <-errCh)
+		assert.ErrorIs(t, <-drained, context.DeadlineExceeded)
+		assert.Equal(t, StatusPending, ch.Status)
+		require.NotNil(t, ch.Error)
+		assert.Equal(t, NewError(ErrorRejectedIdentifierType, "").Type, ch.Error.Type)
+	})
+
+	t.Run("fail/draining", func(t *testing.T) {
+		c := NewValidationCoordinator()
+		require.NoError(t, c.Drain(context.Background()))
+
+		ch := &Challenge{ID: "chID", Type: HTTP01, Status: StatusPending, Token: "token", Value: "zap.internal"}
+		err := ch.Validate(NewValidationCoordinatorContext(context.Background(), c), &MockDB{}, jwk, nil)
+		var ae *Error
+		require.True(t, errors.As(err, &ae))
+		assert.Equal(t, http.StatusServiceUnavailable, ae.StatusCode())
+		var ra render.RetryAfterError
+		require.True(t, errors.As(ae.Err, &ra))
+		assert.Equal(t, drainRetryAfter, ra.RetryAfter())
+		assert.Equal(t, StatusPending, ch.Status)
+	})
+}
@@ -65,6 +65,8 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorServiceUnavailableType server is temporarily unable to handle the request
+	ErrorServiceUnavailableType
 )
 
 // String returns the string representation of the acme problem type,
@@ -98,7 +100,7 @@ func (ap ProblemType) String() string {
 	case ErrorExternalAccountRequiredType:
 		return "externalAccountRequired"
 	case ErrorInvalidContactType:
-		return "incorrectResponse"
+		return "invalidContact"
 	case ErrorMalformedType:
 		return "malformed"
 	case ErrorOrderNotReadyType:
@@ -121,6 +123,8 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorServiceUnavailableType:
+		return "serviceUnavailable"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -266,6 +270,11 @@ var (
 			details: "Visit the “instance” URL and take actions specified there",
 			status:  400,
 		},
+		ErrorServiceUnavailableType: {
+			typ:     officialACMEPrefix + ErrorServiceUnavailableType.String(),
+			details: "The server is temporarily unable to handle the request",
+			status:  503,
+		},
 		ErrorServerInternalType: errorServerInternalMetadata,
 	}
 )
@@ -414,6 +423,102 @@ func (e *Error) Cause() error {
 	return e.Err
 }
 
+// Unwrap returns the internal error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON implements the json.Marshaler interface. The JSON
+// representation is the ACME problem document returned to clients, it
+// includes the HTTP status code as recommended by RFC 7807.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(problemDocument{
+		Type:        e.Type,
+		Detail:      e.Detail,
+		Status:      e.Status,
+		Subproblems: e.Subproblems,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It reads the
+// representation generated by MarshalJSON as is, so the errors stored with
+// other values are encoded again with the same bytes. Use ParseError to
+// validate the problem documents received from other servers.
+func (e *Error) UnmarshalJSON(b []byte) error {
+	var doc problemDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	*e = Error{
+		Type:        doc.Type,
+		Detail:      doc.Detail,
+		Status:      doc.Status,
+		Subproblems: doc.Subproblems,
+	}
+	return nil
+}
+
+// problemDocument is the JSON representation of an Error.
+type problemDocument struct {
+	Type        string       `json:"type"`
+	Detail      string       `json:"detail"`
+	Status      int          `json:"status,omitempty"`
+	Subproblems []Subproblem `json:"subproblems,omitempty"`
+}
+
+// ParseError parses an ACME problem document, like the ones generated by
+// (*Error).MarshalJSON, and returns the Error it represents. Problem types
+// not defined by RFC 8555 or this package are returned as a server internal
+// error, the original type and detail are kept in the internal error. If the
+// document does not include a status, the default one of the problem type is
+// used.
+func ParseError(b []byte) (*Error, error) {
+	var doc problemDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrap(err, "error parsing acme error")
+	}
+	if doc.Type == "" {
+		return nil, errors.New("error parsing acme error: type is required")
+	}
+	if doc.Status != 0 && (doc.Status < 400 || doc.Status > 599) {
+		return nil, errors.Errorf("error parsing acme error: invalid status %d", doc.Status)
+	}
+
+	meta, ok := problemTypeMetadata(doc.Type)
+	if !ok {
+		return &Error{
+			Type:        errorServerInternalMetadata.typ,
+			Detail:      errorServerInternalMetadata.details,
+			Status:      errorServerInternalMetadata.status,
+			Subproblems: doc.Subproblems,
+			Err:         errors.Errorf("unsupported acme error type %q: %s", doc.Type, doc.Detail),
+		}, nil
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = meta.status
+	}
+	return &Error{
+		Type:        doc.Type,
+		Detail:      doc.Detail,
+		Status:      status,
+		Subproblems: doc.Subproblems,
+		Err:         errors.New(doc.Detail),
+	}, nil
+}
+
+// problemTypeMetadata returns the metadata of the problem with the given
+// type URN.
+func problemTypeMetadata(typ string) (errorMetadata, bool) {
+	for _, meta := range errorMap {
+		if meta.typ == typ {
+			return meta, true
+		}
+	}
+	return errorMetadata{}, false
+}
+
 // ToLog implements the EnableLogger interface.
 func (e *Error) ToLog() (interface{}, error) {
 	b, err := json.Marshal(e)
@@ -425,6 +530,10 @@ func (e *Error) ToLog() (interface{}, error) {
 
 // Render implements render.RenderableError for Error.
 func (e *Error) Render(w http.ResponseWriter) {
+	var ra render.RetryAfterError
+	if errors.As(e.Err, &ra) {
+		render.SetRetryAfter(w, ra.RetryAfter())
+	}
 	w.Header().Set("Content-Type", "application/problem+json")
 	render.JSONStatus(w, e, e.StatusCode())
 }
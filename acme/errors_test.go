@@ -2,10 +2,14 @@ package acme
 
 import (
 	"encoding/json"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/errs"
 )
 
 func mustJSON(t *testing.T, m map[string]interface{}) string {
@@ -21,15 +25,18 @@ func TestError_WithAdditionalErrorDetail(t *testing.T) {
 	internalJSON := mustJSON(t, map[string]interface{}{
 		"detail": "The server experienced an internal error",
 		"type":   "urn:ietf:params:acme:error:serverInternal",
+		"status": 500,
 	})
 	malformedErr := NewError(ErrorMalformedType, "malformed error") // will result in Err == nil behavior
 	malformedJSON := mustJSON(t, map[string]interface{}{
 		"detail": "The request message was malformed",
 		"type":   "urn:ietf:params:acme:error:malformed",
+		"status": 400,
 	})
 	withDetailJSON := mustJSON(t, map[string]interface{}{
 		"detail": "Attestation statement cannot be verified: invalid property",
 		"type":   "urn:ietf:params:acme:error:badAttestationStatement",
+		"status": 400,
 	})
 	tests := []struct {
 		name string
@@ -52,3 +59,114 @@ func TestError_WithAdditionalErrorDetail(t *testing.T) {
 		})
 	}
 }
+
+func TestError_Render(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            *Error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"ok", NewError(ErrorMalformedType, "malformed error"), 400, ""},
+		{"ok/retry-after", WrapErrorISE(errs.ServiceUnavailable("paused", errs.WithRetryAfter(90*time.Second)), "error signing"), 500, "90"},
+		{"ok/service-unavailable", WrapError(ErrorServiceUnavailableType, errs.ServiceUnavailable("paused", errs.WithRetryAfter(time.Minute)), "error signing"), 503, "60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.err.Render(w)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantRetryAfter, w.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *Error
+	}{
+		{"malformed", NewError(ErrorMalformedType, "malformed error")},
+		{"detailed", NewDetailedError(ErrorBadAttestationStatementType, "invalid property")},
+		{"internal", NewErrorISE("internal error")},
+		{"rateLimited", NewDetailedError(ErrorRateLimitedType, "too many orders")},
+		{"subproblems", NewDetailedError(ErrorRejectedIdentifierType, "rejected").AddSubproblems(
+			NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: DNS, Value: "foo.internal"}, "policy"),
+			NewSubproblem(ErrorCaaType, "caa"),
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.err)
+			require.NoError(t, err)
+
+			got, err := ParseError(b)
+			require.NoError(t, err)
+			assert.Equal(t, tt.err.Type, got.Type)
+			assert.Equal(t, tt.err.Detail, got.Detail)
+			assert.Equal(t, tt.err.Status, got.Status)
+			assert.Equal(t, tt.err.Subproblems, got.Subproblems)
+			assert.EqualError(t, got, tt.err.Detail)
+
+			// The parsed error marshals to the same document.
+			b2, err := json.Marshal(got)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(b), string(b2))
+		})
+	}
+}
+
+func TestError_UnmarshalJSON(t *testing.T) {
+	for _, s := range []string{
+		`{"type":"urn:ietf:params:acme:error:malformed","detail":"The request message was malformed","status":400}`,
+		// Errors stored without the status.
+		`{"type":"urn:ietf:params:acme:error:malformed","detail":"The request message was malformed"}`,
+		`{"type":"urn:ietf:params:acme:error:rejectedIdentifier","detail":"rejected","status":400,"subproblems":[{"type":"urn:ietf:params:acme:error:caa","detail":"caa"}]}`,
+	} {
+		var e Error
+		require.NoError(t, json.Unmarshal([]byte(s), &e))
+		b, err := json.Marshal(&e)
+		require.NoError(t, err)
+		assert.Equal(t, s, string(b))
+	}
+
+	var e Error
+	assert.Error(t, json.Unmarshal([]byte(`{"type":1}`), &e))
+}
+
+func TestParseError_defaults(t *testing.T) {
+	// The status defaults to the one of the problem type.
+	got, err := ParseError([]byte(`{"type":"urn:ietf:params:acme:error:unauthorized","detail":"nope"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 401, got.Status)
+	assert.Equal(t, "nope", got.Detail)
+
+	// Unknown problem types are server internal errors.
+	got, err = ParseError([]byte(`{"type":"urn:example:error:custom","detail":"custom error","status":418,"subproblems":[{"type":"urn:ietf:params:acme:error:dns","detail":"dns"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "urn:ietf:params:acme:error:serverInternal", got.Type)
+	assert.Equal(t, "The server experienced an internal error", got.Detail)
+	assert.Equal(t, 500, got.Status)
+	assert.Equal(t, []Subproblem{{Type: "urn:ietf:params:acme:error:dns", Detail: "dns"}}, got.Subproblems)
+	assert.EqualError(t, got, `unsupported acme error type "urn:example:error:custom": custom error`)
+}
+
+func TestParseError_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       string
+		wantErr string
+	}{
+		{"fail/json", `{"type":`, "error parsing acme error: unexpected end of JSON input"},
+		{"fail/type", `{"detail":"no type"}`, "error parsing acme error: type is required"},
+		{"fail/status", `{"type":"urn:ietf:params:acme:error:malformed","status":200}`, "error parsing acme error: invalid status 200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseError([]byte(tt.b))
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Nil(t, got)
+		})
+	}
+}
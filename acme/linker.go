@@ -203,6 +203,41 @@ func (l *linker) Middleware(next http.Handler) http.Handler {
 		}
 
 		ctx = NewProvisionerContext(ctx, Provisioner(acmeProv))
+
+		// Validate the challenges through the egress proxy, from the source
+		// address, using the network and checking the addresses, if
+		// configured.
+		var proxyURL *url.URL
+		if vp := acmeProv.ValidationProxy; vp != nil {
+			if proxyURL, err = vp.ProxyURL(); err != nil {
+				render.Error(w, WrapErrorISE(err, "error parsing validation proxy for provisioner '%s'", name))
+				return
+			}
+		}
+		localAddr := acmeProv.GetValidationSourceAddress()
+		network := acmeProv.GetValidationNetwork()
+		var filter *ipFilter
+		if f := acmeProv.ValidationIPFilter; f != nil {
+			deny, allow, err := f.Prefixes()
+			if err != nil {
+				render.Error(w, WrapErrorISE(err, "error parsing validation IP filter for provisioner '%s'", name))
+				return
+			}
+			filter = &ipFilter{deny: deny, allow: allow}
+		}
+		if proxyURL != nil && filter != nil {
+			// The proxy dialers would bypass the filter.
+			render.Error(w, NewErrorISE("validation IP filter cannot be used with a validation proxy for provisioner '%s'", name))
+			return
+		}
+		if proxyURL != nil || localAddr != nil || network != "tcp" || filter != nil {
+			var headers http.Header
+			if cfg := authority.MustFromContext(ctx).GetConfig(); cfg != nil {
+				headers = cfg.AuthorityConfig.GetHTTP01Headers()
+			}
+			ctx = NewClientContext(ctx, validationClient(proxyURL, localAddr, network, filter, headers))
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smallstep/certificates/middleware/requestid"
+)
+
+// LogLevel is the level of the events sent to the Logger.
+type LogLevel int
+
+const (
+	// LogLevelDebug is used for verbose events.
+	LogLevelDebug LogLevel = iota
+	// LogLevelInfo is used for regular events, like a valid challenge.
+	LogLevelInfo
+	// LogLevelWarn is used for events caused by the clients, like an invalid
+	// challenge.
+	LogLevelWarn
+	// LogLevelError is used for internal errors.
+	LogLevelError
+)
+
+// String returns the name of the level.
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Logger is the interface used to emit structured events from the ACME
+// package. The kv arguments are alternating keys and values. It's small
+// enough to be adapted to any structured logger.
+type Logger interface {
+	Log(level LogLevel, msg string, kv ...any)
+}
+
+type loggerKey struct{}
+
+// NewLoggerContext adds the given logger to the context.
+func NewLoggerContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the current logger from the given context.
+func LoggerFromContext(ctx context.Context) (l Logger, ok bool) {
+	l, ok = ctx.Value(loggerKey{}).(Logger)
+	return
+}
+
+// MustLoggerFromContext returns the current logger from the given context. It
+// will return a noop logger if it does not exist.
+func MustLoggerFromContext(ctx context.Context) Logger {
+	l, ok := LoggerFromContext(ctx)
+	if !ok {
+		return noopLogger{}
+	}
+	return l
+}
+
+// noopLogger implements a noop [Logger].
+type noopLogger struct{}
+
+func (noopLogger) Log(LogLevel, string, ...any) {}
+
+// logChallengeValidated emits the event of a finished challenge validation. A
+// panicking logger does not affect the validation.
+func logChallengeValidated(ctx context.Context, ch *Challenge, outcome ValidationOutcome, err error, d time.Duration) {
+	defer func() {
+		_ = recover()
+	}()
+
+	level := LogLevelInfo
+	kv := []any{
+		"account-id", ch.AccountID,
+		"authorization-id", ch.AuthorizationID,
+		"challenge-id", ch.ID,
+		"challenge-type", string(ch.Type),
+		"target", ch.Value,
+		"outcome", string(outcome),
+		"duration", d,
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		kv = append(kv, "request-id", id)
+	}
+
+	var acmeErr *Error
+	switch {
+	case err != nil:
+		level = LogLevelError
+		if errors.As(err, &acmeErr) {
+			kv = append(kv, "error-type", acmeErr.Type)
+		}
+		kv = append(kv, "error", err.Error())
+	case ch.Error != nil:
+		level = LogLevelWarn
+		kv = append(kv, "error-type", ch.Error.Type, "error", ch.Error.Error())
+	}
+
+	MustLoggerFromContext(ctx).Log(level, "acme challenge validated", kv...)
+}
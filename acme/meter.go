@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"context"
+	"time"
+)
+
+// ValidationOutcome is the result of a challenge validation reported to the
+// Meter.
+type ValidationOutcome string
+
+const (
+	// ValidationValid is the outcome of a challenge that was validated.
+	ValidationValid ValidationOutcome = "valid"
+	// ValidationInvalid is the outcome of a challenge that could not be
+	// validated, the challenge error contains the reason.
+	ValidationInvalid ValidationOutcome = "invalid"
+	// ValidationError is the outcome of a validation that failed because of an
+	// internal error.
+	ValidationError ValidationOutcome = "error"
+)
+
+// Meter is the interface used to instrument the ACME challenge validations.
+type Meter interface {
+	// ACMEChallengeValidated is called whenever a challenge validation
+	// finishes, with the type of challenge, the outcome and the time it took.
+	ACMEChallengeValidated(typ ChallengeType, outcome ValidationOutcome, d time.Duration)
+}
+
+type meterKey struct{}
+
+// NewMeterContext adds the given meter to the context.
+func NewMeterContext(ctx context.Context, m Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// MeterFromContext returns the current meter from the given context.
+func MeterFromContext(ctx context.Context) (m Meter, ok bool) {
+	m, ok = ctx.Value(meterKey{}).(Meter)
+	return
+}
+
+// MustMeterFromContext returns the current meter from the given context. It
+// will return a noop meter if it does not exist.
+func MustMeterFromContext(ctx context.Context) Meter {
+	m, ok := MeterFromContext(ctx)
+	if !ok {
+		return noopMeter{}
+	}
+	return m
+}
+
+// noopMeter implements a noop [Meter].
+type noopMeter struct{}
+
+func (noopMeter) ACMEChallengeValidated(ChallengeType, ValidationOutcome, time.Duration) {}
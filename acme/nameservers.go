@@ -0,0 +1,119 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// LookupNS returns the addresses of the authoritative nameservers of the zone
+// of the given name. The zone is found removing labels from the name until
+// one with NS records is found. The NS records are queried using the
+// nameservers in /etc/resolv.conf.
+func (c *client) LookupNS(ctx context.Context, name string) ([]string, error) {
+	name = strings.TrimSuffix(name, ".")
+	for name != "" {
+		hosts, err := c.lookup(ctx, name, dnsmessage.TypeNS)
+		if err != nil {
+			return nil, err
+		}
+		if len(hosts) > 0 {
+			servers := make([]string, len(hosts))
+			for i, h := range hosts {
+				servers[i] = net.JoinHostPort(strings.TrimSuffix(h, "."), "53")
+			}
+			return servers, nil
+		}
+		_, name, _ = strings.Cut(name, ".")
+	}
+	return nil, errors.New("no nameservers found")
+}
+
+// LookupTxtOn queries the TXT records of the given name on the given
+// nameserver. CNAME records are not followed, so the server must be
+// authoritative for the name.
+func (c *client) LookupTxtOn(ctx context.Context, server, name string) ([]string, error) {
+	resp, id, err := c.query(ctx, server, name, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSResponse(resp, id, dnsmessage.TypeTXT)
+}
+
+// lookup queries the records of the given type using the nameservers in
+// /etc/resolv.conf, the first server that responds is used.
+func (c *client) lookup(ctx context.Context, name string, typ dnsmessage.Type) ([]string, error) {
+	servers := c.nameservers
+	if len(servers) == 0 {
+		servers = systemNameservers()
+	}
+	var err error
+	for _, server := range servers {
+		var resp []byte
+		var id uint16
+		if resp, id, err = c.query(ctx, server, name, typ); err != nil {
+			continue
+		}
+		var values []string
+		if values, err = parseDNSResponse(resp, id, typ); err == nil {
+			return values, nil
+		}
+	}
+	return nil, err
+}
+
+// parseDNSResponse returns the values of the NS or TXT records of the given
+// type in the answer section of a DNS response. The strings of a TXT record
+// are concatenated.
+func parseDNSResponse(resp []byte, id uint16, typ dnsmessage.Type) ([]string, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case h.ID != id:
+		return nil, errors.New("unexpected DNS response id")
+	case h.RCode == dnsmessage.RCodeNameError:
+		return nil, nil
+	case h.RCode != dnsmessage.RCodeSuccess:
+		return nil, fmt.Errorf("unexpected DNS response code %s", h.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for {
+		ah, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ah.Type != typ:
+			err = p.SkipAnswer()
+		case typ == dnsmessage.TypeNS:
+			var r dnsmessage.NSResource
+			if r, err = p.NSResource(); err == nil {
+				values = append(values, r.NS.String())
+			}
+		case typ == dnsmessage.TypeTXT:
+			var r dnsmessage.TXTResource
+			if r, err = p.TXTResource(); err == nil {
+				values = append(values, strings.Join(r.TXT, ""))
+			}
+		default:
+			err = p.SkipAnswer()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
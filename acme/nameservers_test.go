@@ -0,0 +1,133 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestDNSServer starts a UDP DNS server that responds with the NS and
+// TXT records in the given zone. Names without records return NXDOMAIN.
+func newTestDNSServer(t *testing.T, ns, txt map[string][]string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+
+	respond := func(query []byte) []byte {
+		var p dnsmessage.Parser
+		h, err := p.Start(query)
+		require.NoError(t, err)
+		q, err := p.Question()
+		require.NoError(t, err)
+
+		name := strings.TrimSuffix(q.Name.String(), ".")
+		nsRecords, hasNS := ns[name]
+		txtRecords, hasTXT := txt[name]
+		rcode := dnsmessage.RCodeSuccess
+		if !hasNS && !hasTXT {
+			rcode = dnsmessage.RCodeNameError
+		}
+
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, RCode: rcode})
+		require.NoError(t, b.StartQuestions())
+		require.NoError(t, b.Question(q))
+		require.NoError(t, b.StartAnswers())
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET}
+		switch q.Type {
+		case dnsmessage.TypeNS:
+			for _, r := range nsRecords {
+				require.NoError(t, b.NSResource(rh, dnsmessage.NSResource{NS: dnsmessage.MustNewName(r + ".")}))
+			}
+		case dnsmessage.TypeTXT:
+			for _, r := range txtRecords {
+				// Split long values in multiple strings.
+				var parts []string
+				for len(r) > 10 {
+					parts, r = append(parts, r[:10]), r[10:]
+				}
+				require.NoError(t, b.TXTResource(rh, dnsmessage.TXTResource{TXT: append(parts, r)}))
+			}
+		}
+		resp, err := b.Finish()
+		require.NoError(t, err)
+		return resp
+	}
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(respond(buf[:n]), addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestClient_LookupNS(t *testing.T) {
+	server := newTestDNSServer(t, map[string][]string{
+		"example.com":         {"ns1.example.com", "ns2.example.net"},
+		"sub.example.com":     {"ns1.sub.example.com"},
+		"_acme.example.org":   nil,
+		"example.org":         {"ns.example.org"},
+		"empty.example.local": nil,
+	}, nil)
+
+	c := NewClient().(*client)
+	c.nameservers = []string{server}
+	tests := []struct {
+		name    string
+		want    []string
+		wantErr string
+	}{
+		{"example.com", []string{"ns1.example.com:53", "ns2.example.net:53"}, ""},
+		{"_acme-challenge.www.example.com.", []string{"ns1.example.com:53", "ns2.example.net:53"}, ""},
+		{"_acme-challenge.sub.example.com", []string{"ns1.sub.example.com:53"}, ""},
+		{"_acme.example.org", []string{"ns.example.org:53"}, ""},
+		{"empty.example.local", nil, "no nameservers found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.LookupNS(context.Background(), tt.name)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient_LookupTxtOn(t *testing.T) {
+	server := newTestDNSServer(t, nil, map[string][]string{
+		"_acme-challenge.example.com": {"short", "a-value-longer-than-ten-bytes"},
+	})
+
+	c := NewClient().(*client)
+	got, err := c.LookupTxtOn(context.Background(), server, "_acme-challenge.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short", "a-value-longer-than-ten-bytes"}, got)
+
+	got, err = c.LookupTxtOn(context.Background(), server, "_acme-challenge.missing.com")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func Test_parseDNSResponse(t *testing.T) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1, Response: true, RCode: dnsmessage.RCodeServerFailure})
+	resp, err := b.Finish()
+	require.NoError(t, err)
+	_, err = parseDNSResponse(resp, 1, dnsmessage.TypeTXT)
+	assert.EqualError(t, err, "unexpected DNS response code RCodeServerFailure")
+	_, err = parseDNSResponse(resp, 2, dnsmessage.TypeTXT)
+	assert.EqualError(t, err, "unexpected DNS response id")
+}
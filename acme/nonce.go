@@ -1,5 +1,25 @@
 package acme
 
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// Defaults of the nonce stores.
+const (
+	// DefaultNonceTTL is the time a nonce can be used after it's created.
+	DefaultNonceTTL = time.Hour
+	// DefaultNonceStoreSize is the maximum number of nonces kept by a store.
+	DefaultNonceStoreSize = 100000
+)
+
+// nonceLength is the number of alphanumeric characters of the nonces created
+// by the in-memory store.
+const nonceLength = 32
+
 // Nonce represents an ACME nonce type.
 type Nonce string
 
@@ -7,3 +27,119 @@ type Nonce string
 func (n Nonce) String() string {
 	return string(n)
 }
+
+// NonceStore is the interface used to create and consume the anti-replay
+// nonces of the ACME requests.
+type NonceStore interface {
+	// New creates and returns a new nonce.
+	New(ctx context.Context) (Nonce, error)
+	// Consume removes the given nonce. It returns a badNonce error if the
+	// nonce does not exist, it has already been used or it has expired.
+	Consume(ctx context.Context, nonce Nonce) error
+}
+
+// MemoryNonceStore is a NonceStore that keeps the nonces in memory. The nonces
+// expire after the TTL, and if the store is full the least recently created
+// one is evicted to make room for a new one. The nonces are not shared, so it
+// can only be used by a single CA instance.
+type MemoryNonceStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	now     func() time.Time
+	nonces  map[Nonce]*list.Element
+	lru     *list.List
+}
+
+type memoryNonce struct {
+	nonce     Nonce
+	createdAt time.Time
+}
+
+// NewMemoryNonceStore creates a new MemoryNonceStore with the given TTL and
+// maximum number of nonces, DefaultNonceTTL and DefaultNonceStoreSize if they
+// are 0. If now is nil the current time is used.
+func NewMemoryNonceStore(ttl time.Duration, maxSize int, now func() time.Time) *MemoryNonceStore {
+	if ttl <= 0 {
+		ttl = DefaultNonceTTL
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultNonceStoreSize
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryNonceStore{
+		ttl:     ttl,
+		maxSize: maxSize,
+		now:     now,
+		nonces:  make(map[Nonce]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// New creates and returns a new nonce. Expired nonces are removed, and the
+// oldest one is evicted if the store is full.
+func (s *MemoryNonceStore) New(context.Context) (Nonce, error) {
+	v, err := randomAlphanumeric(rand.Reader, nonceLength)
+	if err != nil {
+		return "", WrapErrorISE(err, "error generating nonce")
+	}
+	nonce := Nonce(v)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for e := s.lru.Back(); e != nil; e = s.lru.Back() {
+		n := e.Value.(*memoryNonce)
+		if s.lru.Len() < s.maxSize && now.Before(n.createdAt.Add(s.ttl)) {
+			break
+		}
+		s.remove(e)
+	}
+	s.nonces[nonce] = s.lru.PushFront(&memoryNonce{nonce: nonce, createdAt: now})
+	return nonce, nil
+}
+
+// Consume removes the given nonce. It returns a badNonce error if the nonce is
+// not in the store or it has expired.
+func (s *MemoryNonceStore) Consume(_ context.Context, nonce Nonce) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.nonces[nonce]
+	if !ok {
+		return NewError(ErrorBadNonceType, "nonce %s not found", string(nonce))
+	}
+	s.remove(e)
+	if !s.now().Before(e.Value.(*memoryNonce).createdAt.Add(s.ttl)) {
+		return NewError(ErrorBadNonceType, "nonce %s has expired", string(nonce))
+	}
+	return nil
+}
+
+// Len returns the number of nonces in the store, including the expired ones
+// not removed yet.
+func (s *MemoryNonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *MemoryNonceStore) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.nonces, e.Value.(*memoryNonce).nonce)
+}
+
+type nonceStoreKey struct{}
+
+// NewNonceStoreContext adds the given nonce store to the context.
+func NewNonceStoreContext(ctx context.Context, s NonceStore) context.Context {
+	return context.WithValue(ctx, nonceStoreKey{}, s)
+}
+
+// NonceStoreFromContext returns the current nonce store from the given
+// context.
+func NonceStoreFromContext(ctx context.Context) (s NonceStore, ok bool) {
+	s, ok = ctx.Value(nonceStoreKey{}).(NonceStore)
+	return
+}
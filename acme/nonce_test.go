@@ -0,0 +1,101 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertBadNonce(t *testing.T, err error, msg string) {
+	t.Helper()
+	var ae *Error
+	require.True(t, errors.As(err, &ae), "error is not an acme error: %v", err)
+	assert.Equal(t, NewError(ErrorBadNonceType, "").Type, ae.Type)
+	assert.EqualError(t, ae.Err, msg)
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	ctx := context.Background()
+	clk := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryNonceStore(time.Minute, 10, clk.Now)
+
+	n1, err := s.New(ctx)
+	require.NoError(t, err)
+	assert.Len(t, string(n1), nonceLength)
+	n2, err := s.New(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, n1, n2)
+	assert.Equal(t, 2, s.Len())
+
+	// Nonces can only be used once.
+	require.NoError(t, s.Consume(ctx, n1))
+	assertBadNonce(t, s.Consume(ctx, n1), "nonce "+n1.String()+" not found")
+	assertBadNonce(t, s.Consume(ctx, "foo"), "nonce foo not found")
+
+	// Expired nonces are rejected and removed.
+	clk.Add(time.Minute)
+	assertBadNonce(t, s.Consume(ctx, n2), "nonce "+n2.String()+" has expired")
+	assert.Zero(t, s.Len())
+}
+
+func TestMemoryNonceStore_expiry(t *testing.T) {
+	ctx := context.Background()
+	clk := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryNonceStore(time.Minute, 10, clk.Now)
+
+	old, err := s.New(ctx)
+	require.NoError(t, err)
+	clk.Add(30 * time.Second)
+	recent, err := s.New(ctx)
+	require.NoError(t, err)
+
+	// New nonces remove the expired ones.
+	clk.Add(30 * time.Second)
+	_, err = s.New(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Len())
+	assertBadNonce(t, s.Consume(ctx, old), "nonce "+old.String()+" not found")
+	require.NoError(t, s.Consume(ctx, recent))
+}
+
+func TestMemoryNonceStore_eviction(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryNonceStore(time.Hour, 3, nil)
+
+	var nonces []Nonce
+	for i := 0; i < 5; i++ {
+		n, err := s.New(ctx)
+		require.NoError(t, err)
+		nonces = append(nonces, n)
+	}
+	assert.Equal(t, 3, s.Len())
+
+	// The oldest nonces are evicted.
+	for _, n := range nonces[:2] {
+		assertBadNonce(t, s.Consume(ctx, n), "nonce "+n.String()+" not found")
+	}
+	for _, n := range nonces[2:] {
+		require.NoError(t, s.Consume(ctx, n))
+	}
+}
+
+func TestNewMemoryNonceStore_defaults(t *testing.T) {
+	s := NewMemoryNonceStore(0, 0, nil)
+	assert.Equal(t, DefaultNonceTTL, s.ttl)
+	assert.Equal(t, DefaultNonceStoreSize, s.maxSize)
+	assert.NotNil(t, s.now)
+}
+
+func TestNonceStoreFromContext(t *testing.T) {
+	_, ok := NonceStoreFromContext(context.Background())
+	assert.False(t, ok)
+
+	s := NewMemoryNonceStore(0, 0, nil)
+	got, ok := NonceStoreFromContext(NewNonceStoreContext(context.Background(), s))
+	assert.True(t, ok)
+	assert.Same(t, s, got)
+}
@@ -6,12 +6,17 @@ import (
 	"crypto/subtle"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"net"
+	"net/http"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/webhook"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x509util"
 )
@@ -44,6 +49,7 @@ type Order struct {
 	Identifiers       []Identifier `json:"identifiers"`
 	NotBefore         time.Time    `json:"notBefore"`
 	NotAfter          time.Time    `json:"notAfter"`
+	Profile           string       `json:"profile,omitempty"`
 	Error             *Error       `json:"error,omitempty"`
 	AuthorizationIDs  []string     `json:"-"`
 	AuthorizationURLs []string     `json:"authorizations"`
@@ -65,6 +71,7 @@ func (o *Order) ToLog() (interface{}, error) {
 // Changes to the order are saved using the database interface.
 func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 	now := clock.Now()
+	expiresAt := o.ExpiresAt.Add(clockSkewFromContext(ctx))
 
 	switch o.Status {
 	case StatusInvalid:
@@ -73,7 +80,7 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 		return nil
 	case StatusReady:
 		// Check expiry
-		if now.After(o.ExpiresAt) {
+		if now.After(expiresAt) {
 			o.Status = StatusInvalid
 			o.Error = NewError(ErrorMalformedType, "order has expired")
 			break
@@ -81,7 +88,7 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 		return nil
 	case StatusPending:
 		// Check expiry
-		if now.After(o.ExpiresAt) {
+		if now.After(expiresAt) {
 			o.Status = StatusInvalid
 			o.Error = NewError(ErrorMalformedType, "order has expired")
 			break
@@ -101,6 +108,9 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 				return WrapErrorISE(err, "error updating authorization ID %s", azID)
 			}
 			st := az.Status
+			if st == StatusDeactivated || st == StatusRevoked {
+				st = StatusInvalid
+			}
 			count[st]++
 		}
 		switch {
@@ -151,43 +161,130 @@ func (o *Order) getAuthorizationFingerprint(ctx context.Context, db DB) (string,
 // Finalize signs a certificate if the necessary conditions for Order completion
 // have been met.
 //
+// If the context was created with authority.NewContextWithDryRun, all the
+// validations are run but the certificate is not signed and the order is not
+// updated.
+//
 // TODO(mariano): Here or in the challenge validation we should perform some
 // external validation using the identifier value and the attestation data. From
 // a validation service we can get the list of SANs to set in the final
 // certificate.
 func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateRequest, auth CertificateAuthority, p Provisioner) error {
-	if err := o.UpdateStatus(ctx, db); err != nil {
+	if ok, err := o.readyToFinalize(ctx, db); !ok || err != nil {
+		return err
+	}
+
+	certChain, err := o.sign(ctx, db, csr, auth, p)
+	if err != nil {
 		return err
 	}
+	if authority.DryRunFromContext(ctx) {
+		return nil
+	}
+
+	cert := &Certificate{
+		AccountID:     o.AccountID,
+		OrderID:       o.ID,
+		Leaf:          certChain[0],
+		Intermediates: certChain[1:],
+	}
+	if err := db.CreateCertificate(ctx, cert); err != nil {
+		return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
+	}
+
+	o.CertificateID = cert.ID
+	o.Status = StatusValid
+	if err = db.UpdateOrder(ctx, o); err != nil {
+		return WrapErrorISE(err, "error updating order %s", o.ID)
+	}
+	return nil
+}
+
+// FinalizeDryRun runs the same validations, policies and webhooks as Finalize,
+// and returns the errors Finalize would return, but it does not sign nor store
+// the certificate. It returns the certificate template that would be signed.
+func (o *Order) FinalizeDryRun(ctx context.Context, db DB, csr *x509.CertificateRequest, auth CertificateAuthority, p Provisioner) (*x509.Certificate, error) {
+	ok, err := o.readyToFinalize(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, NewError(ErrorOrderNotReadyType, "order %s has already been finalized", o.ID)
+	}
+
+	certChain, err := o.sign(authority.NewContextWithDryRun(ctx), db, csr, auth, p)
+	if err != nil {
+		return nil, err
+	}
+	return certChain[0], nil
+}
+
+// readyToFinalize updates the status of the order and returns if the order is
+// ready to be finalized. It returns false without an error if the order is
+// already valid.
+func (o *Order) readyToFinalize(ctx context.Context, db DB) (bool, error) {
+	if err := o.UpdateStatus(ctx, db); err != nil {
+		return false, err
+	}
 
 	switch o.Status {
 	case StatusInvalid:
-		return NewError(ErrorOrderNotReadyType, "order %s has been abandoned", o.ID)
+		if !o.ExpiresAt.IsZero() && clock.Now().After(o.ExpiresAt.Add(clockSkewFromContext(ctx))) {
+			return false, NewError(ErrorOrderNotReadyType, "order %s has expired", o.ID)
+		}
+		return false, NewError(ErrorOrderNotReadyType, "order %s has been abandoned", o.ID)
 	case StatusValid:
-		return nil
+		return false, nil
 	case StatusPending:
-		return NewError(ErrorOrderNotReadyType, "order %s is not ready", o.ID)
+		return false, NewError(ErrorOrderNotReadyType, "order %s is not ready", o.ID)
 	case StatusReady:
-		break
+		// An authorization can be deactivated after the order is ready.
+		if err := o.checkAuthorizations(ctx, db); err != nil {
+			return false, err
+		}
+		return true, nil
 	default:
-		return NewErrorISE("unexpected status %s for order %s", o.Status, o.ID)
+		return false, NewErrorISE("unexpected status %s for order %s", o.Status, o.ID)
+	}
+}
+
+// checkAuthorizations verifies that all the authorizations of a ready order are
+// still valid. If one is not, the order is marked as invalid.
+func (o *Order) checkAuthorizations(ctx context.Context, db DB) error {
+	for _, azID := range o.AuthorizationIDs {
+		az, err := db.GetAuthorization(ctx, azID)
+		if err != nil {
+			return WrapErrorISE(err, "error getting authorization %q", azID)
+		}
+		if az.Status == StatusValid {
+			continue
+		}
+		o.Status = StatusInvalid
+		if err := db.UpdateOrder(ctx, o); err != nil {
+			return WrapErrorISE(err, "error updating order %s", o.ID)
+		}
+		return NewError(ErrorOrderNotReadyType, "order %s has been abandoned: authorization %s is %s", o.ID, azID, az.Status)
 	}
+	return nil
+}
 
+// sign validates the CSR and signs the certificate of a ready order.
+func (o *Order) sign(ctx context.Context, db DB, csr *x509.CertificateRequest, auth CertificateAuthority, p Provisioner) ([]*x509.Certificate, error) {
 	// Get key fingerprint if any. And then compare it with the CSR fingerprint.
 	//
 	// In device-attest-01 challenges we should check that the keys in the CSR
 	// and the attestation certificate are the same.
 	fingerprint, err := o.getAuthorizationFingerprint(ctx, db)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if fingerprint != "" {
 		fp, err := keyutil.Fingerprint(csr.PublicKey)
 		if err != nil {
-			return WrapErrorISE(err, "error calculating key fingerprint")
+			return nil, WrapErrorISE(err, "error calculating key fingerprint")
 		}
 		if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(fp)) == 0 {
-			return NewError(ErrorUnauthorizedType, "order %s csr does not match the attested key", o.ID)
+			return nil, NewError(ErrorUnauthorizedType, "order %s csr does not match the attested key", o.ID)
 		}
 	}
 
@@ -212,7 +309,7 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 			// could result in unauthorized access if a relying system relies on the Common
 			// Name in its authorization logic.
 			if csr.Subject.CommonName != "" && csr.Subject.CommonName != permanentIdentifier {
-				return NewError(ErrorBadCSRType, "CSR Subject Common Name does not match identifiers exactly: "+
+				return nil, NewError(ErrorBadCSRType, "CSR Subject Common Name does not match identifiers exactly: "+
 					"CSR Subject Common Name = %s, Order Permanent Identifier = %s", csr.Subject.CommonName, permanentIdentifier)
 			}
 			break
@@ -233,29 +330,62 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		defaultTemplate = x509util.DefaultLeafTemplate
 		sans, err := o.sans(csr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		data.SetSubjectAlternativeNames(sans...)
 	}
 
+	// Check that the CSR key is one of the allowed key types.
+	if err := p.AuthorizeCSRKey(ctx, csr.PublicKey); err != nil {
+		return nil, NewDetailedError(ErrorBadCSRType, "order %s csr key is not allowed: %v", o.ID, err)
+	}
+
+	// Check that the CAA records of the DNS identifiers allow the issuance.
+	if identities := p.GetCAACheckIdentities(); len(identities) > 0 {
+		vc := MustClientFromContext(ctx)
+		for _, id := range o.Identifiers {
+			if id.Type == DNS {
+				if err := checkCAA(ctx, vc, id.Value, identities); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Use the claims and template options of the profile of the order.
+	var profile *provisioner.ACMEProfile
+	if o.Profile != "" {
+		var ok bool
+		if profile, ok = p.GetProfile(o.Profile); !ok {
+			return nil, NewError(ErrorMalformedType, "order %s profile %s is not supported", o.ID, o.Profile)
+		}
+		ctx = provisioner.NewContextWithACMEProfile(ctx, o.Profile)
+	}
+
 	// Get authorizations from the ACME provisioner.
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
 	signOps, err := p.AuthorizeSign(ctx, "")
 	if err != nil {
-		return WrapErrorISE(err, "error retrieving authorization options from ACME provisioner")
+		return nil, WrapErrorISE(err, "error retrieving authorization options from ACME provisioner")
 	}
 	// Unlike most of the provisioners, ACME's AuthorizeSign method doesn't
 	// define the templates, and the template data used in WebHooks is not
-	// available.
+	// available. The order is sent to the webhooks, so AUTHORIZING webhooks
+	// can decide on the account and identifiers.
 	for _, signOp := range signOps {
 		if wc, ok := signOp.(*provisioner.WebhookController); ok {
 			wc.TemplateData = data
+			wc.AddRequestBodyOptions(webhook.WithACMEOrder(o.webhookOrder(), csr))
 		}
 	}
 
-	templateOptions, err := provisioner.CustomTemplateOptions(p.GetOptions(), data, defaultTemplate)
+	options := p.GetOptions()
+	if profile != nil {
+		options = profile.GetOptions()
+	}
+	templateOptions, err := provisioner.CustomTemplateOptions(options, data, defaultTemplate)
 	if err != nil {
-		return WrapErrorISE(err, "error creating template options from ACME provisioner")
+		return nil, WrapErrorISE(err, "error creating template options from ACME provisioner")
 	}
 
 	// Build extra signing options.
@@ -268,25 +398,31 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		NotAfter:  provisioner.NewTimeDuration(o.NotAfter),
 	}, signOps...)
 	if err != nil {
-		return WrapErrorISE(err, "error signing certificate for order %s", o.ID)
+		if errors.Is(err, provisioner.ErrWebhookDenied) {
+			return nil, WrapError(ErrorUnauthorizedType, err, "order %s was not authorized by the webhook server", o.ID)
+		}
+		// Report temporary failures, like the authority being in maintenance
+		// mode, as such, so clients know they can retry later.
+		var sc render.StatusCodedError
+		if errors.As(err, &sc) && sc.StatusCode() == http.StatusServiceUnavailable {
+			return nil, WrapError(ErrorServiceUnavailableType, err, "error signing certificate for order %s", o.ID)
+		}
+		return nil, WrapErrorISE(err, "error signing certificate for order %s", o.ID)
 	}
+	return certChain, nil
+}
 
-	cert := &Certificate{
-		AccountID:     o.AccountID,
-		OrderID:       o.ID,
-		Leaf:          certChain[0],
-		Intermediates: certChain[1:],
+// webhookOrder returns the representation of the order sent to webhook servers.
+func (o *Order) webhookOrder() *webhook.ACMEOrder {
+	identifiers := make([]webhook.ACMEIdentifier, len(o.Identifiers))
+	for i, id := range o.Identifiers {
+		identifiers[i] = webhook.ACMEIdentifier{Type: string(id.Type), Value: id.Value}
 	}
-	if err := db.CreateCertificate(ctx, cert); err != nil {
-		return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
-	}
-
-	o.CertificateID = cert.ID
-	o.Status = StatusValid
-	if err = db.UpdateOrder(ctx, o); err != nil {
-		return WrapErrorISE(err, "error updating order %s", o.ID)
+	return &webhook.ACMEOrder{
+		ID:          o.ID,
+		AccountID:   o.AccountID,
+		Identifiers: identifiers,
 	}
-	return nil
 }
 
 func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativeName, error) {
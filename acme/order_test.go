@@ -3,12 +3,15 @@ package acme
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"testing"
@@ -18,7 +21,10 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x509util"
 )
@@ -76,6 +82,18 @@ func TestOrder_UpdateStatus(t *testing.T) {
 				},
 			}
 		},
+		"ok/ready-expired-within-clock-skew": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:        "oID",
+				AccountID: "accID",
+				Status:    StatusReady,
+				ExpiresAt: now.Add(-defaultClockSkew / 2),
+			}
+			return test{
+				o: o,
+			}
+		},
 		"fail/ready-expired-db.UpdateOrder-error": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -337,6 +355,24 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewError(ErrorOrderNotReadyType, "order %s has been abandoned", o.ID),
 			}
 		},
+		"fail/expired": func(t *testing.T) test {
+			o := &Order{
+				ID:        "oid",
+				AccountID: "accID",
+				Status:    StatusReady,
+				ExpiresAt: clock.Now().Add(-5 * time.Minute),
+			}
+			return test{
+				o: o,
+				db: &MockDB{
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, StatusInvalid, updo.Status)
+						return nil
+					},
+				},
+				err: NewError(ErrorOrderNotReadyType, "order %s has expired", o.ID),
+			}
+		},
 		"fail/pending": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -591,6 +627,49 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewErrorISE("error signing certificate for order oID: force"),
 			}
 		},
+		"fail/error-ca-sign-maintenance": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			}
+
+			err := NewError(ErrorServiceUnavailableType, "error signing certificate for order oID: authority is in maintenance mode")
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+				},
+				ca: &mockSignAuth{
+					signWithContext: func(_ context.Context, _csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						return nil, errs.ServiceUnavailable("authority is in maintenance mode", errs.WithRetryAfter(time.Minute))
+					},
+				},
+				db: &MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+				err: err,
+			}
+		},
 		"fail/error-db.CreateCertificate": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -1229,6 +1308,461 @@ func TestOrder_Finalize(t *testing.T) {
 	}
 }
 
+func TestOrder_FinalizeDryRun(t *testing.T) {
+	now := clock.Now()
+	newOrder := func(status Status) *Order {
+		return &Order{
+			ID:               "oID",
+			AccountID:        "accID",
+			Status:           status,
+			ExpiresAt:        now.Add(5 * time.Minute),
+			AuthorizationIDs: []string{"a"},
+			Identifiers:      []Identifier{{Type: "dns", Value: "foo.internal"}},
+		}
+	}
+	csr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "foo.internal"},
+		DNSNames: []string{"foo.internal"},
+	}
+	prov := &MockProvisioner{
+		MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+			return nil, nil
+		},
+		MgetOptions: func() *provisioner.Options {
+			return nil
+		},
+	}
+	tmpl := &x509.Certificate{Subject: pkix.Name{CommonName: "foo.internal"}, DNSNames: []string{"foo.internal"}}
+	ca := &mockSignAuth{
+		signWithContext: func(ctx context.Context, _csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			if !authority.DryRunFromContext(ctx) {
+				return nil, errors.New("not a dry run")
+			}
+			if _csr.Subject.CommonName != "foo.internal" {
+				return nil, errs.Forbidden("common name not allowed")
+			}
+			return []*x509.Certificate{tmpl}, nil
+		},
+	}
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			return &Authorization{ID: id, Status: StatusValid}, nil
+		},
+		MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+			t.Error("certificate created on a dry run")
+			return nil
+		},
+		MockUpdateOrder: func(ctx context.Context, o *Order) error {
+			t.Error("order updated on a dry run")
+			return nil
+		},
+	}
+
+	// The template is returned, and nothing is stored.
+	o := newOrder(StatusReady)
+	got, err := o.FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	assert.FatalError(t, err)
+	assert.Equals(t, tmpl, got)
+	assert.Equals(t, StatusReady, o.Status)
+	assert.Equals(t, "", o.CertificateID)
+
+	// Finalize does not store anything with a dry run context.
+	o = newOrder(StatusReady)
+	assert.FatalError(t, o.Finalize(authority.NewContextWithDryRun(context.Background()), db, csr, ca, prov))
+	assert.Equals(t, StatusReady, o.Status)
+
+	// The errors are the same as on Finalize.
+	assertError := func(t *testing.T, want *Error, err error) {
+		t.Helper()
+		var k *Error
+		if assert.True(t, errors.As(err, &k)) {
+			assert.Equals(t, want.Type, k.Type)
+			assert.Equals(t, want.Detail, k.Detail)
+			assert.Equals(t, want.Status, k.Status)
+			assert.Equals(t, want.Err.Error(), k.Err.Error())
+		}
+	}
+	_, err = newOrder(StatusValid).FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	assertError(t, NewError(ErrorOrderNotReadyType, "order oID has already been finalized"), err)
+	_, err = newOrder(StatusInvalid).FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	assertError(t, NewError(ErrorOrderNotReadyType, "order oID has been abandoned"), err)
+
+	badCSR := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "bar.internal"},
+		DNSNames: []string{"foo.internal"},
+	}
+	_, err = newOrder(StatusReady).FinalizeDryRun(context.Background(), db, badCSR, ca, prov)
+	assertError(t, NewError(ErrorBadCSRType, "CSR names do not match identifiers exactly: "+
+		"CSR names = [bar.internal foo.internal], Order names = [foo.internal]"), err)
+
+	ca.signWithContext = func(ctx context.Context, _csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+		return nil, errs.Forbidden("common name not allowed")
+	}
+	_, err = newOrder(StatusReady).FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	assertError(t, WrapErrorISE(errs.Forbidden("common name not allowed"), "error signing certificate for order oID"), err)
+}
+
+func TestOrder_FinalizeDryRun_profile(t *testing.T) {
+	prov := &provisioner.ACME{
+		Type: "ACME",
+		Name: "acme",
+		Profiles: []*provisioner.ACMEProfile{
+			{
+				Name:   "mtls",
+				Claims: &provisioner.Claims{DefaultTLSDur: &provisioner.Duration{Duration: 5 * time.Minute}},
+				X509: &provisioner.X509Options{
+					Template: `{"subject": {{ toJson .Subject }}, "sans": {{ toJson .SANs }}, "extKeyUsage": ["clientAuth"]}`,
+				},
+			},
+			{
+				Name:   "server",
+				Claims: &provisioner.Claims{DefaultTLSDur: &provisioner.Duration{Duration: 24 * time.Hour}},
+			},
+		},
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "foo.internal"},
+		DNSNames: []string{"foo.internal"},
+	}, signer)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	// The mock authority applies the sign options like the authority does.
+	ca := &mockSignAuth{
+		signWithContext: func(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			var certOptions []x509util.Option
+			for _, op := range extraOpts {
+				if k, ok := op.(provisioner.CertificateOptions); ok {
+					certOptions = append(certOptions, k.Options(signOpts)...)
+				}
+			}
+			c, err := x509util.NewCertificate(csr, certOptions...)
+			if err != nil {
+				return nil, err
+			}
+			leaf := c.GetCertificate()
+			for _, op := range extraOpts {
+				if k, ok := op.(provisioner.CertificateModifier); ok {
+					if err := k.Modify(leaf, signOpts); err != nil {
+						return nil, err
+					}
+				}
+			}
+			for _, op := range extraOpts {
+				if k, ok := op.(provisioner.CertificateValidator); ok {
+					if err := k.Valid(leaf, signOpts); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return []*x509.Certificate{leaf}, nil
+		},
+	}
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			return &Authorization{ID: id, Status: StatusValid}, nil
+		},
+	}
+	finalize := func(profile string) (*x509.Certificate, error) {
+		o := &Order{
+			ID:               "oID",
+			AccountID:        "accID",
+			Status:           StatusReady,
+			ExpiresAt:        clock.Now().Add(5 * time.Minute),
+			AuthorizationIDs: []string{"a"},
+			Identifiers:      []Identifier{{Type: "dns", Value: "foo.internal"}},
+			Profile:          profile,
+		}
+		return o.FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	}
+
+	mtls, err := finalize("mtls")
+	assert.FatalError(t, err)
+	assert.Equals(t, 5*time.Minute, mtls.NotAfter.Sub(mtls.NotBefore))
+	assert.Equals(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, mtls.ExtKeyUsage)
+
+	server, err := finalize("server")
+	assert.FatalError(t, err)
+	assert.Equals(t, 24*time.Hour, server.NotAfter.Sub(server.NotBefore))
+	assert.Equals(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, server.ExtKeyUsage)
+
+	_, err = finalize("unknown")
+	var k *Error
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, "urn:ietf:params:acme:error:malformed", k.Type)
+		assert.Equals(t, "order oID profile unknown is not supported", k.Err.Error())
+	}
+}
+
+func TestOrder_Finalize_caa(t *testing.T) {
+	order := &Order{
+		ID:               "oID",
+		AccountID:        "accID",
+		Status:           StatusReady,
+		ExpiresAt:        clock.Now().Add(5 * time.Minute),
+		AuthorizationIDs: []string{"a"},
+		Identifiers:      []Identifier{{Type: "dns", Value: "foo.example.com"}},
+	}
+	csr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "foo.example.com"},
+		DNSNames: []string{"foo.example.com"},
+	}
+	prov := &MockProvisioner{
+		MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+			return nil, nil
+		},
+		MgetOptions: func() *provisioner.Options {
+			return nil
+		},
+		MgetCAACheckIdentities: func() []string {
+			return []string{"ca.example.com"}
+		},
+	}
+	ca := &mockSignAuth{
+		signWithContext: func(ctx context.Context, _csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{{}}, nil
+		},
+	}
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			return &Authorization{ID: id, Status: StatusValid}, nil
+		},
+	}
+	vc := &mockClient{lookupCAA: func(name string) ([]CAARecord, error) {
+		assert.Equals(t, "foo.example.com", name)
+		return []CAARecord{{Tag: "issue", Value: "letsencrypt.org"}}, nil
+	}}
+
+	_, err := order.FinalizeDryRun(NewClientContext(context.Background(), vc), db, csr, ca, prov)
+	var k *Error
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, "urn:ietf:params:acme:error:caa", k.Type)
+		assert.Equals(t, "CAA records for foo.example.com do not authorize the issuance", k.Err.Error())
+	}
+
+	// Issuance is allowed by the CAA records.
+	vc.lookupCAA = func(name string) ([]CAARecord, error) {
+		return []CAARecord{{Tag: "issue", Value: "ca.example.com"}}, nil
+	}
+	_, err = order.FinalizeDryRun(NewClientContext(context.Background(), vc), db, csr, ca, prov)
+	assert.FatalError(t, err)
+}
+
+func TestOrder_Finalize_authorizingWebhooks(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "foo.internal"},
+		DNSNames: []string{"foo.internal"},
+	}, signer)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	// Each server records the orders it receives and allows them if allow is
+	// true.
+	newServer := func(allow *bool, orders *[]*webhook.ACMEOrder) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body webhook.RequestBody
+			assert.FatalError(t, json.NewDecoder(r.Body).Decode(&body))
+			*orders = append(*orders, body.ACMEOrder)
+			assert.FatalError(t, json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: *allow}))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	var orders1, orders2 []*webhook.ACMEOrder
+	allow1, allow2 := true, true
+	srv1, srv2 := newServer(&allow1, &orders1), newServer(&allow2, &orders2)
+
+	prov := &provisioner.ACME{
+		Type: "ACME",
+		Name: "acme",
+		Options: &provisioner.Options{
+			Webhooks: []*provisioner.Webhook{
+				{ID: "wh1", Name: "policy1", URL: srv1.URL, Kind: "AUTHORIZING", CertType: "X509"},
+				{ID: "wh2", Name: "policy2", URL: srv2.URL, Kind: "AUTHORIZING", CertType: "X509"},
+			},
+		},
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	// The mock authority calls the authorizing webhooks like the authority
+	// does.
+	ca := &mockSignAuth{
+		signWithContext: func(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			for _, op := range extraOpts {
+				if wc, ok := op.(*provisioner.WebhookController); ok {
+					if err := wc.Authorize(ctx, &webhook.RequestBody{}); err != nil {
+						return nil, errs.ForbiddenErr(err, "error creating certificate")
+					}
+				}
+			}
+			return []*x509.Certificate{{}}, nil
+		},
+	}
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			return &Authorization{ID: id, Status: StatusValid}, nil
+		},
+	}
+	o := &Order{
+		ID:               "oID",
+		AccountID:        "accID",
+		Status:           StatusReady,
+		ExpiresAt:        clock.Now().Add(5 * time.Minute),
+		AuthorizationIDs: []string{"a"},
+		Identifiers:      []Identifier{{Type: "dns", Value: "foo.internal"}},
+	}
+	want := &webhook.ACMEOrder{
+		ID:          "oID",
+		AccountID:   "accID",
+		Identifiers: []webhook.ACMEIdentifier{{Type: "dns", Value: "foo.internal"}},
+		CSR:         der,
+	}
+
+	// All the webhooks allow the order.
+	_, err = o.FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	assert.FatalError(t, err)
+	assert.Equals(t, []*webhook.ACMEOrder{want}, orders1)
+	assert.Equals(t, []*webhook.ACMEOrder{want}, orders2)
+
+	// The second webhook denies the order.
+	allow2 = false
+	_, err = o.FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	var k *Error
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, "urn:ietf:params:acme:error:unauthorized", k.Type)
+		assert.Equals(t, http.StatusUnauthorized, k.Status)
+		assert.HasPrefix(t, k.Err.Error(), "order oID was not authorized by the webhook server")
+	}
+	assert.Len(t, 2, orders2)
+
+	// The first webhook denies the order, the second one is not called.
+	allow1 = false
+	_, err = o.FinalizeDryRun(context.Background(), db, csr, ca, prov)
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, "urn:ietf:params:acme:error:unauthorized", k.Type)
+	}
+	assert.Len(t, 3, orders1)
+	assert.Len(t, 2, orders2)
+}
+
+func TestOrder_FinalizeDryRun_allowedKeyTypes(t *testing.T) {
+	newCSR := func(kty, crv string, size int) *x509.CertificateRequest {
+		signer, err := keyutil.GenerateSigner(kty, crv, size)
+		assert.FatalError(t, err)
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "foo.internal"},
+			DNSNames: []string{"foo.internal"},
+		}, signer)
+		assert.FatalError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		assert.FatalError(t, err)
+		return csr
+	}
+
+	prov := &provisioner.ACME{
+		Type:            "ACME",
+		Name:            "acme",
+		AllowedKeyTypes: []provisioner.ACMEKeyType{"EC:P-256", "RSA:3072"},
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	ca := &mockSignAuth{
+		signWithContext: func(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{{}}, nil
+		},
+	}
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			return &Authorization{ID: id, Status: StatusValid}, nil
+		},
+	}
+	o := &Order{
+		ID:               "oID",
+		AccountID:        "accID",
+		Status:           StatusReady,
+		ExpiresAt:        clock.Now().Add(5 * time.Minute),
+		AuthorizationIDs: []string{"a"},
+		Identifiers:      []Identifier{{Type: "dns", Value: "foo.internal"}},
+	}
+
+	_, err := o.FinalizeDryRun(context.Background(), db, newCSR("EC", "P-256", 0), ca, prov)
+	assert.FatalError(t, err)
+
+	_, err = o.FinalizeDryRun(context.Background(), db, newCSR("RSA", "", 2048), ca, prov)
+	var k *Error
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, "urn:ietf:params:acme:error:badCSR", k.Type)
+		assert.Equals(t, http.StatusBadRequest, k.Status)
+		assert.Equals(t, "The CSR is unacceptable: order oID csr key is not allowed: public key type is not allowed, allowed key types are [EC:P-256 RSA:3072]", k.Detail)
+	}
+}
+
+func TestOrder_Finalize_deactivatedAuthorization(t *testing.T) {
+	authzs := map[string]*Authorization{
+		"a": {ID: "a", Status: StatusValid, Challenges: []*Challenge{{ID: "ch", Status: StatusValid}}},
+		"b": {ID: "b", Status: StatusValid},
+	}
+	var updatedOrder *Order
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			az := *authzs[id]
+			return &az, nil
+		},
+		MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+			authzs[az.ID] = az
+			return nil
+		},
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			return nil
+		},
+		MockUpdateOrder: func(ctx context.Context, o *Order) error {
+			updatedOrder = o
+			return nil
+		},
+	}
+	newOrder := func(status Status) *Order {
+		return &Order{
+			ID:               "oID",
+			Status:           status,
+			ExpiresAt:        clock.Now().Add(5 * time.Minute),
+			AuthorizationIDs: []string{"a", "b"},
+		}
+	}
+	csr := &x509.CertificateRequest{DNSNames: []string{"foo.example.com"}}
+
+	az, err := db.GetAuthorization(context.Background(), "a")
+	assert.FatalError(t, err)
+	assert.FatalError(t, az.Deactivate(context.Background(), db, StatusDeactivated))
+
+	// A ready order cannot be finalized after the authorization is deactivated.
+	o := newOrder(StatusReady)
+	err = o.Finalize(context.Background(), db, csr, &mockSignAuth{}, &MockProvisioner{})
+	var k *Error
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, NewError(ErrorOrderNotReadyType, "").Type, k.Type)
+		assert.Equals(t, "order oID has been abandoned: authorization a is deactivated", k.Err.Error())
+	}
+	assert.Equals(t, StatusInvalid, o.Status)
+	assert.Equals(t, o, updatedOrder)
+
+	// Neither can a pending one.
+	o = newOrder(StatusPending)
+	err = o.Finalize(context.Background(), db, csr, &mockSignAuth{}, &MockProvisioner{})
+	if assert.True(t, errors.As(err, &k)) {
+		assert.Equals(t, NewError(ErrorOrderNotReadyType, "").Type, k.Type)
+		assert.Equals(t, "order oID has been abandoned", k.Err.Error())
+	}
+	assert.Equals(t, StatusInvalid, o.Status)
+}
+
 func Test_uniqueSortedIPs(t *testing.T) {
 	type args struct {
 		ips []net.IP
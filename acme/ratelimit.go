@@ -0,0 +1,175 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// maxRateLimitRetries is the number of times a counter update is retried if it
+// was changed by a concurrent request.
+const maxRateLimitRetries = 5
+
+// RateLimitCounter is the number of events counted in a rate limit window.
+type RateLimitCounter struct {
+	Count       int       `json:"count"`
+	WindowStart time.Time `json:"windowStart"`
+}
+
+// RateLimitStore is the interface used to store the rate limit counters.
+type RateLimitStore interface {
+	// GetRateLimitCounter returns the counter with the given key. It returns
+	// nil if the counter does not exist.
+	GetRateLimitCounter(ctx context.Context, key string) (*RateLimitCounter, error)
+	// UpdateRateLimitCounter replaces the counter with the given key if it's
+	// still the old one, nil if it did not exist. It returns false if the
+	// counter has changed since it was read.
+	UpdateRateLimitCounter(ctx context.Context, key string, old, nu *RateLimitCounter) (bool, error)
+}
+
+// RateLimiter implements fixed window rate limits using a RateLimitStore.
+type RateLimiter struct {
+	store RateLimitStore
+	now   func() time.Time
+}
+
+// NewRateLimiter creates a new RateLimiter that stores the counters in the
+// given store. If now is nil the current time is used.
+func NewRateLimiter(store RateLimitStore, now func() time.Time) *RateLimiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &RateLimiter{
+		store: store,
+		now:   now,
+	}
+}
+
+// Check returns a rateLimited error if the counter with the given key has
+// reached the limit in the current window.
+func (l *RateLimiter) Check(ctx context.Context, key string, limit int, window time.Duration) error {
+	c, err := l.store.GetRateLimitCounter(ctx, key)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving rate limit counter %s", key)
+	}
+	now := l.now()
+	if c == nil || !now.Before(c.WindowStart.Add(window)) || c.Count < limit {
+		return nil
+	}
+	retryAfter := c.WindowStart.Add(window).Sub(now)
+	return newError(ErrorRateLimitedType, &rateLimitError{
+		msg:        fmt.Sprintf("rate limit of %d per %s exceeded for %s", limit, window, key),
+		retryAfter: retryAfter,
+	}).withDetail()
+}
+
+// Increment increments the counter with the given key. A new window is
+// started if the current one has finished.
+func (l *RateLimiter) Increment(ctx context.Context, key string, window time.Duration) error {
+	for i := 0; i < maxRateLimitRetries; i++ {
+		old, err := l.store.GetRateLimitCounter(ctx, key)
+		if err != nil {
+			return WrapErrorISE(err, "error retrieving rate limit counter %s", key)
+		}
+		now := l.now()
+		nu := &RateLimitCounter{Count: 1, WindowStart: now}
+		if old != nil && now.Before(old.WindowStart.Add(window)) {
+			nu = &RateLimitCounter{Count: old.Count + 1, WindowStart: old.WindowStart}
+		}
+		swapped, err := l.store.UpdateRateLimitCounter(ctx, key, old, nu)
+		if err != nil {
+			return WrapErrorISE(err, "error updating rate limit counter %s", key)
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return NewErrorISE("error updating rate limit counter %s: too many concurrent updates", key)
+}
+
+// rateLimitError is the internal error of rateLimited errors, it reports
+// when the client can retry the request.
+type rateLimitError struct {
+	msg        string
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return e.msg
+}
+
+// RetryAfter implements render.RetryAfterError.
+func (e *rateLimitError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// orderRateLimitKey returns the key of the counter of orders of an identifier.
+func orderRateLimitKey(p Provisioner, id Identifier) string {
+	return fmt.Sprintf("orders/%s/%s:%s", p.GetID(), id.Type, id.Value)
+}
+
+// failedValidationRateLimitKey returns the key of the counter of failed
+// validations of an account.
+func failedValidationRateLimitKey(p Provisioner, accountID string) string {
+	return fmt.Sprintf("failedValidations/%s/%s", p.GetID(), accountID)
+}
+
+// CheckOrderRateLimits returns a rateLimited error if one of the identifiers
+// has reached the limit of orders of the provisioner. Otherwise, it counts a
+// new order for each identifier. It does nothing if there is no rate limiter
+// in the context or the provisioner does not limit the orders.
+func CheckOrderRateLimits(ctx context.Context, p Provisioner, ids []Identifier) error {
+	l, ok := RateLimiterFromContext(ctx)
+	limits := p.GetRateLimits()
+	if !ok || limits == nil || limits.OrdersPerIdentifier == 0 {
+		return nil
+	}
+	window := limits.GetWindow()
+	for _, id := range ids {
+		if err := l.Check(ctx, orderRateLimitKey(p, id), limits.OrdersPerIdentifier, window); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		if err := l.Increment(ctx, orderRateLimitKey(p, id), window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failedValidationRateLimit returns the rate limiter, the key and the limits
+// used to count the failed validations of the account of the challenge. It
+// returns false if there is no rate limiter in the context or the provisioner
+// does not limit the failed validations.
+func failedValidationRateLimit(ctx context.Context, ch *Challenge) (*RateLimiter, string, *provisioner.ACMERateLimits, bool) {
+	l, ok := RateLimiterFromContext(ctx)
+	if !ok {
+		return nil, "", nil, false
+	}
+	p, ok := ProvisionerFromContext(ctx)
+	if !ok {
+		return nil, "", nil, false
+	}
+	limits := p.GetRateLimits()
+	if limits == nil || limits.FailedValidationsPerAccount == 0 {
+		return nil, "", nil, false
+	}
+	return l, failedValidationRateLimitKey(p, ch.AccountID), limits, true
+}
+
+type rateLimiterKey struct{}
+
+// NewRateLimiterContext adds the given rate limiter to the context.
+func NewRateLimiterContext(ctx context.Context, l *RateLimiter) context.Context {
+	return context.WithValue(ctx, rateLimiterKey{}, l)
+}
+
+// RateLimiterFromContext returns the current rate limiter from the given
+// context.
+func RateLimiterFromContext(ctx context.Context) (l *RateLimiter, ok bool) {
+	l, ok = ctx.Value(rateLimiterKey{}).(*RateLimiter)
+	return
+}
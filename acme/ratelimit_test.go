@@ -0,0 +1,163 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// memoryRateLimitStore is an in-memory implementation of RateLimitStore.
+type memoryRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]RateLimitCounter
+}
+
+func (s *memoryRateLimitStore) GetRateLimitCounter(_ context.Context, key string) (*RateLimitCounter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok {
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (s *memoryRateLimitStore) UpdateRateLimitCounter(_ context.Context, key string, old, nu *RateLimitCounter) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	if ok != (old != nil) || (ok && c != *old) {
+		return false, nil
+	}
+	if s.counters == nil {
+		s.counters = make(map[string]RateLimitCounter)
+	}
+	s.counters[key] = *nu
+	return true, nil
+}
+
+// testClock is a clock that only moves when the test says so.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time      { return c.now }
+func (c *testClock) Add(d time.Duration) { c.now = c.now.Add(d) }
+func (c *testClock) Set(t time.Time)     { c.now = t }
+
+func assertRateLimited(t *testing.T, err error, retryAfter time.Duration) {
+	t.Helper()
+	var ae *Error
+	require.True(t, errors.As(err, &ae), "error is not an acme error: %v", err)
+	assert.Equal(t, NewError(ErrorRateLimitedType, "").Type, ae.Type)
+	assert.Equal(t, NewError(ErrorRateLimitedType, "").StatusCode(), ae.StatusCode())
+	var ra render.RetryAfterError
+	require.True(t, errors.As(ae.Err, &ra))
+	assert.Equal(t, retryAfter, ra.RetryAfter())
+}
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := &testClock{now: start}
+	l := NewRateLimiter(&memoryRateLimitStore{}, clk.Now)
+
+	require.NoError(t, l.Check(ctx, "key", 2, time.Hour))
+	require.NoError(t, l.Increment(ctx, "key", time.Hour))
+	clk.Add(10 * time.Minute)
+	require.NoError(t, l.Check(ctx, "key", 2, time.Hour))
+	require.NoError(t, l.Increment(ctx, "key", time.Hour))
+
+	// The limit is reached until the end of the window.
+	assertRateLimited(t, l.Check(ctx, "key", 2, time.Hour), 50*time.Minute)
+	clk.Set(start.Add(time.Hour - time.Second))
+	assertRateLimited(t, l.Check(ctx, "key", 2, time.Hour), time.Second)
+	require.NoError(t, l.Check(ctx, "other", 2, time.Hour))
+
+	// The limit resets after the window.
+	clk.Set(start.Add(time.Hour))
+	require.NoError(t, l.Check(ctx, "key", 2, time.Hour))
+	require.NoError(t, l.Increment(ctx, "key", time.Hour))
+	c, err := l.store.GetRateLimitCounter(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, &RateLimitCounter{Count: 1, WindowStart: start.Add(time.Hour)}, c)
+	require.NoError(t, l.Increment(ctx, "key", time.Hour))
+	assertRateLimited(t, l.Check(ctx, "key", 2, time.Hour), time.Hour)
+}
+
+func TestCheckOrderRateLimits(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := &testClock{now: start}
+	ctx := NewRateLimiterContext(context.Background(), NewRateLimiter(&memoryRateLimitStore{}, clk.Now))
+	prov := &MockProvisioner{
+		MgetID: func() string { return "provID" },
+		MgetRateLimits: func() *provisioner.ACMERateLimits {
+			return &provisioner.ACMERateLimits{
+				OrdersPerIdentifier: 1,
+				Window:              &provisioner.Duration{Duration: time.Minute},
+			}
+		},
+	}
+	foo := Identifier{Type: DNS, Value: "foo.internal"}
+	bar := Identifier{Type: DNS, Value: "bar.internal"}
+
+	require.NoError(t, CheckOrderRateLimits(ctx, prov, []Identifier{foo}))
+	assertRateLimited(t, CheckOrderRateLimits(ctx, prov, []Identifier{bar, foo}), time.Minute)
+	// Orders that are rate limited are not counted.
+	require.NoError(t, CheckOrderRateLimits(ctx, prov, []Identifier{bar}))
+
+	clk.Add(time.Minute)
+	require.NoError(t, CheckOrderRateLimits(ctx, prov, []Identifier{bar, foo}))
+
+	// Noop without a limiter or limits.
+	require.NoError(t, CheckOrderRateLimits(context.Background(), prov, []Identifier{foo}))
+	require.NoError(t, CheckOrderRateLimits(ctx, &MockProvisioner{}, []Identifier{foo}))
+}
+
+func TestChallenge_Validate_rateLimited(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := &testClock{now: start}
+	ctx := NewRateLimiterContext(context.Background(), NewRateLimiter(&memoryRateLimitStore{}, clk.Now))
+	ctx = NewProvisionerContext(ctx, &MockProvisioner{
+		MgetID: func() string { return "provID" },
+		MgetRateLimits: func() *provisioner.ACMERateLimits {
+			return &provisioner.ACMERateLimits{FailedValidationsPerAccount: 1}
+		},
+	})
+	ctx = NewClientContext(ctx, &mockClient{
+		get: func(string) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("wrong"))}, nil
+		},
+	})
+	db := &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }}
+	newChallenge := func() *Challenge {
+		return &Challenge{ID: "chID", AccountID: "accID", Token: "token", Type: HTTP01, Status: StatusPending, Value: "zap.internal"}
+	}
+
+	ch := newChallenge()
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	assert.Equal(t, StatusInvalid, ch.Status)
+
+	// The account cannot validate challenges until the window resets.
+	ch = newChallenge()
+	assertRateLimited(t, ch.Validate(ctx, db, jwk, nil), provisioner.DefaultACMERateLimitWindow)
+	assert.Equal(t, StatusPending, ch.Status)
+
+	clk.Add(provisioner.DefaultACMERateLimitWindow)
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	assert.Equal(t, StatusInvalid, ch.Status)
+}
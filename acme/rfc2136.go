@@ -0,0 +1,217 @@
+package acme
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // hmac-sha1 is a TSIG algorithm
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DNSUpdater is the interface used to write and remove the TXT records of the
+// dns-01 self-test.
+type DNSUpdater interface {
+	AddTXT(ctx context.Context, name, value string) error
+	RemoveTXT(ctx context.Context, name, value string) error
+}
+
+const (
+	// rfc2136TTL is the TTL of the records added with dynamic updates.
+	rfc2136TTL = 60
+	// tsigFudge is the number of seconds of error permitted in the time
+	// signed of the TSIG records.
+	tsigFudge = 300
+	// dnsOpcodeUpdate is the DNS opcode of the dynamic updates.
+	dnsOpcodeUpdate = 5
+	// dnsTypeTSIG is the DNS type of the TSIG records.
+	dnsTypeTSIG = dnsmessage.Type(250)
+	// dnsClassNone and dnsClassAny are the DNS classes used to delete records
+	// and in the TSIG records.
+	dnsClassNone = dnsmessage.Class(254)
+	dnsClassAny  = dnsmessage.Class(255)
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha384": sha512.New384,
+	"hmac-sha512": sha512.New,
+}
+
+// rfc2136Updater is a DNSUpdater that sends RFC 2136 dynamic updates signed
+// with a TSIG key as described in RFC 8945. The TSIG records in the responses
+// are not verified.
+type rfc2136Updater struct {
+	client    *client
+	server    string
+	zone      string
+	keyName   string
+	algorithm string
+	secret    []byte
+	now       func() time.Time
+}
+
+// NewRFC2136Updater creates a DNSUpdater that sends RFC 2136 dynamic updates
+// to the server in the given configuration.
+func NewRFC2136Updater(cfg *provisioner.ACMEDNSUpdate) (DNSUpdater, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	secret, err := base64.StdEncoding.DecodeString(cfg.KeySecret)
+	if err != nil {
+		return nil, err
+	}
+	return &rfc2136Updater{
+		client: &client{
+			dialer: &net.Dialer{Timeout: 30 * time.Second},
+		},
+		server:    cfg.Server,
+		zone:      cfg.Zone,
+		keyName:   cfg.KeyName,
+		algorithm: cfg.GetKeyAlgorithm(),
+		secret:    secret,
+		now:       time.Now,
+	}, nil
+}
+
+// AddTXT adds a TXT record with the given value.
+func (u *rfc2136Updater) AddTXT(ctx context.Context, name, value string) error {
+	return u.update(ctx, name, value, dnsmessage.ClassINET, rfc2136TTL)
+}
+
+// RemoveTXT removes the TXT record with the given value.
+func (u *rfc2136Updater) RemoveTXT(ctx context.Context, name, value string) error {
+	return u.update(ctx, name, value, dnsClassNone, 0)
+}
+
+func (u *rfc2136Updater) update(ctx context.Context, name, value string, class dnsmessage.Class, ttl uint32) error {
+	zone, err := dnsmessage.NewName(strings.TrimSuffix(u.zone, ".") + ".")
+	if err != nil {
+		return err
+	}
+	rname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return err
+	}
+
+	// The zone section is encoded as the question and the update section as
+	// the authority section.
+	id := uint16(rand.Intn(1 << 16)) //nolint:gosec // DNS message id
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: dnsOpcodeUpdate})
+	if err := b.StartQuestions(); err != nil {
+		return err
+	}
+	if err := b.Question(dnsmessage.Question{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return err
+	}
+	if err := b.StartAuthorities(); err != nil {
+		return err
+	}
+	if err := b.TXTResource(dnsmessage.ResourceHeader{Name: rname, Class: class, TTL: ttl}, dnsmessage.TXTResource{TXT: []string{value}}); err != nil {
+		return err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return err
+	}
+	if msg, err = u.sign(msg, id); err != nil {
+		return err
+	}
+
+	resp, err := u.client.exchange(ctx, "tcp", u.server, msg)
+	if err != nil {
+		return err
+	}
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	switch {
+	case err != nil:
+		return err
+	case h.ID != id:
+		return errors.New("unexpected DNS response id")
+	case h.RCode != dnsmessage.RCodeSuccess:
+		return fmt.Errorf("DNS update for %s failed with %s", name, h.RCode)
+	default:
+		return nil
+	}
+}
+
+// sign appends a TSIG record to the given message.
+func (u *rfc2136Updater) sign(msg []byte, id uint16) ([]byte, error) {
+	newHash, ok := tsigAlgorithms[u.algorithm]
+	if !ok {
+		return nil, fmt.Errorf("TSIG algorithm %q is not supported", u.algorithm)
+	}
+	keyName, err := wireName(u.keyName)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := wireName(u.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	timeSigned := uint64(u.now().Unix())
+
+	// The MAC covers the message and the TSIG variables.
+	mac := hmac.New(newHash, u.secret)
+	mac.Write(msg)
+	mac.Write(keyName)
+	mac.Write(binary.BigEndian.AppendUint16(nil, uint16(dnsClassAny)))
+	mac.Write([]byte{0, 0, 0, 0}) // TTL
+	mac.Write(algorithm)
+	mac.Write(appendUint48(nil, timeSigned))
+	mac.Write(binary.BigEndian.AppendUint16(nil, tsigFudge))
+	mac.Write([]byte{0, 0, 0, 0}) // Error and Other Len
+	sum := mac.Sum(nil)
+
+	rdata := append([]byte{}, algorithm...)
+	rdata = appendUint48(rdata, timeSigned)
+	rdata = binary.BigEndian.AppendUint16(rdata, tsigFudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = binary.BigEndian.AppendUint16(rdata, id)
+	rdata = append(rdata, 0, 0, 0, 0) // Error and Other Len
+
+	signed := append([]byte{}, msg...)
+	signed = append(signed, keyName...)
+	signed = binary.BigEndian.AppendUint16(signed, uint16(dnsTypeTSIG))
+	signed = binary.BigEndian.AppendUint16(signed, uint16(dnsClassAny))
+	signed = append(signed, 0, 0, 0, 0) // TTL
+	signed = binary.BigEndian.AppendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+
+	// Increment the number of additional records.
+	binary.BigEndian.PutUint16(signed[10:], binary.BigEndian.Uint16(signed[10:])+1)
+	return signed, nil
+}
+
+// wireName returns the canonical wire format of a DNS name, lowercase and
+// without compression.
+func wireName(name string) ([]byte, error) {
+	var b []byte
+	for _, label := range strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,186 @@
+package acme
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// newTestUpdateServer starts a TCP DNS server that sends the received updates
+// to the returned channel and responds with the given code.
+func newTestUpdateServer(t *testing.T, rcode dnsmessage.RCode) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	updates := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var size [2]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				conn.Close()
+				continue
+			}
+			msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+			if _, err := io.ReadFull(conn, msg); err != nil {
+				conn.Close()
+				continue
+			}
+			updates <- msg
+
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+				ID:       binary.BigEndian.Uint16(msg),
+				Response: true,
+				OpCode:   dnsOpcodeUpdate,
+				RCode:    rcode,
+			})
+			resp, _ := b.Finish()
+			conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), updates
+}
+
+func newTestUpdater(t *testing.T, server string) *rfc2136Updater {
+	t.Helper()
+	u, err := NewRFC2136Updater(&provisioner.ACMEDNSUpdate{
+		Server:    server,
+		Zone:      "example.com",
+		KeyName:   "CA-Key.",
+		KeySecret: base64.StdEncoding.EncodeToString([]byte("secret")),
+	})
+	require.NoError(t, err)
+	updater := u.(*rfc2136Updater)
+	updater.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return updater
+}
+
+func TestRFC2136Updater(t *testing.T) {
+	server, updates := newTestUpdateServer(t, dnsmessage.RCodeSuccess)
+	u := newTestUpdater(t, server)
+
+	tests := []struct {
+		name  string
+		fn    func(ctx context.Context, name, value string) error
+		class dnsmessage.Class
+		ttl   uint32
+	}{
+		{"add", u.AddTXT, dnsmessage.ClassINET, rfc2136TTL},
+		{"remove", u.RemoveTXT, dnsClassNone, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.fn(context.Background(), "_acme-challenge.www.example.com", "value"))
+			msg := <-updates
+
+			var p dnsmessage.Parser
+			h, err := p.Start(msg)
+			require.NoError(t, err)
+			assert.Equal(t, dnsmessage.OpCode(dnsOpcodeUpdate), h.OpCode)
+			q, err := p.AllQuestions()
+			require.NoError(t, err)
+			assert.Equal(t, []dnsmessage.Question{{
+				Name:  dnsmessage.MustNewName("example.com."),
+				Type:  dnsmessage.TypeSOA,
+				Class: dnsmessage.ClassINET,
+			}}, q)
+			require.NoError(t, p.SkipAllAnswers())
+
+			ah, err := p.AuthorityHeader()
+			require.NoError(t, err)
+			assert.Equal(t, "_acme-challenge.www.example.com.", ah.Name.String())
+			assert.Equal(t, tt.class, ah.Class)
+			assert.Equal(t, tt.ttl, ah.TTL)
+			txt, err := p.TXTResource()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"value"}, txt.TXT)
+			require.NoError(t, p.SkipAllAuthorities())
+
+			// The message is signed with the TSIG key, the record is appended
+			// at the end of the message.
+			ad, err := p.AdditionalHeader()
+			require.NoError(t, err)
+			assert.Equal(t, "ca-key.", ad.Name.String())
+			assert.Equal(t, dnsTypeTSIG, ad.Type)
+			assert.Equal(t, dnsClassAny, ad.Class)
+			r, err := p.UnknownResource()
+			require.NoError(t, err)
+
+			alg, _ := wireName("hmac-sha256")
+			require.Greater(t, len(r.Data), len(alg)+10)
+			assert.Equal(t, alg, r.Data[:len(alg)])
+			rest := r.Data[len(alg):]
+			assert.Equal(t, appendUint48(nil, 1700000000), rest[:6])
+			macSize := int(binary.BigEndian.Uint16(rest[8:]))
+			mac := rest[10 : 10+macSize]
+			assert.Equal(t, h.ID, binary.BigEndian.Uint16(rest[10+macSize:]))
+
+			keyName, _ := wireName("ca-key")
+			unsigned := append([]byte{}, msg[:len(msg)-len(keyName)-10-int(ad.Length)]...)
+			binary.BigEndian.PutUint16(unsigned[10:], binary.BigEndian.Uint16(unsigned[10:])-1)
+			expected := hmac.New(sha256.New, []byte("secret"))
+			expected.Write(unsigned)
+			expected.Write(keyName)
+			expected.Write([]byte{0, 255, 0, 0, 0, 0})
+			expected.Write(alg)
+			expected.Write(rest[:8])
+			expected.Write([]byte{0, 0, 0, 0})
+			assert.Equal(t, expected.Sum(nil), mac)
+		})
+	}
+}
+
+func TestRFC2136Updater_refused(t *testing.T) {
+	server, _ := newTestUpdateServer(t, dnsmessage.RCodeRefused)
+	u := newTestUpdater(t, server)
+	err := u.AddTXT(context.Background(), "_acme-challenge.example.com", "value")
+	assert.EqualError(t, err, "DNS update for _acme-challenge.example.com failed with RCodeRefused")
+}
+
+func TestNewRFC2136Updater(t *testing.T) {
+	_, err := NewRFC2136Updater(&provisioner.ACMEDNSUpdate{
+		Server:    "127.0.0.1",
+		Zone:      "example.com",
+		KeyName:   "key",
+		KeySecret: "c2VjcmV0",
+	})
+	assert.ErrorContains(t, err, `dnsUpdate server "127.0.0.1" is not valid`)
+
+	_, err = NewRFC2136Updater(&provisioner.ACMEDNSUpdate{
+		Server:       "127.0.0.1:53",
+		Zone:         "example.com",
+		KeyName:      "key",
+		KeyAlgorithm: "hmac-md5",
+		KeySecret:    "c2VjcmV0",
+	})
+	assert.EqualError(t, err, `dnsUpdate keyAlgorithm "hmac-md5" is not supported`)
+
+	u, err := NewRFC2136Updater(&provisioner.ACMEDNSUpdate{
+		Server:       "127.0.0.1:53",
+		Zone:         "example.com",
+		KeyName:      "key",
+		KeyAlgorithm: "HMAC-SHA512",
+		KeySecret:    "c2VjcmV0",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hmac-sha512", u.(*rfc2136Updater).algorithm)
+	assert.Equal(t, []byte("secret"), u.(*rfc2136Updater).secret)
+}
@@ -0,0 +1,134 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// DefaultDNS01SelfTestTimeout is the maximum time SelfTestDNS01 waits for the
+// test record if the context does not have a deadline.
+const DefaultDNS01SelfTestTimeout = 2 * time.Minute
+
+// dns01SelfTestInterval is the time between the lookups of the test record.
+var dns01SelfTestInterval = 2 * time.Second
+
+// DNS01SelfTestResult is the report of a dns-01 self-test.
+type DNS01SelfTestResult struct {
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	// Success is true if the record was written, seen by the CA and removed.
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Lookups is the number of lookups done until the record was seen.
+	Lookups int `json:"lookups"`
+	// UpdateDuration, PropagationDuration and CleanupDuration are the time
+	// spent writing the record, waiting until it's seen and removing it.
+	UpdateDuration      time.Duration `json:"updateDuration"`
+	PropagationDuration time.Duration `json:"propagationDuration"`
+	CleanupDuration     time.Duration `json:"cleanupDuration"`
+}
+
+// SelfTestDNS01 checks that the CA can validate dns-01 challenges for the given
+// domain. It writes a random TXT record with the given updater on the name a
+// dns-01 challenge would use, waits until the record is seen by the same
+// lookups done on validation, and removes it. The context must contain the
+// ACME client and the provisioner, which configures the prefix of the name and
+// the quorum of nameservers.
+func SelfTestDNS01(ctx context.Context, updater DNSUpdater, domain string) *DNS01SelfTestResult {
+	_, name, err := dns01Target(ctx, &Challenge{Value: domain})
+	res := &DNS01SelfTestResult{
+		Domain: domain,
+		Name:   name,
+	}
+	fail := func(format string, args ...any) *DNS01SelfTestResult {
+		res.Error = fmt.Sprintf(format, args...)
+		return res
+	}
+	if err != nil {
+		return fail("error computing the record name: %v", err)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fail("error generating test record: %v", err)
+	}
+	res.Value = base64.RawURLEncoding.EncodeToString(b)
+
+	start := time.Now()
+	if err := updater.AddTXT(ctx, name, res.Value); err != nil {
+		res.UpdateDuration = time.Since(start)
+		return fail("error adding TXT record %s: %v", name, err)
+	}
+	res.UpdateDuration = time.Since(start)
+
+	// Always remove the record, even if the context is canceled.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		start := time.Now()
+		err := updater.RemoveTXT(ctx, name, res.Value)
+		res.CleanupDuration = time.Since(start)
+		if err != nil {
+			res.Success = false
+			if res.Error == "" {
+				res.Error = fmt.Sprintf("error removing TXT record %s: %v", name, err)
+			}
+		}
+	}()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultDNS01SelfTestTimeout)
+		defer cancel()
+	}
+
+	start = time.Now()
+	ticker := time.NewTicker(dns01SelfTestInterval)
+	defer ticker.Stop()
+	for {
+		res.Lookups++
+		err := dns01SelfTestLookup(ctx, name, res.Value)
+		if err == nil {
+			res.PropagationDuration = time.Since(start)
+			res.Success = true
+			return res
+		}
+		select {
+		case <-ctx.Done():
+			res.PropagationDuration = time.Since(start)
+			return fail("TXT record %s was not seen after %d lookups: %v", name, res.Lookups, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// dns01SelfTestLookup returns an error if the TXT record with the given value
+// is not seen as it would be seen when a dns-01 challenge is validated.
+func dns01SelfTestLookup(ctx context.Context, name, value string) error {
+	vc := MustClientFromContext(ctx)
+	if p, ok := ProvisionerFromContext(ctx); ok && p.GetDNSChallengeQuorum() != "" {
+		servers, err := vc.LookupNS(ctx, name)
+		if err != nil {
+			return fmt.Errorf("error looking up nameservers: %w", err)
+		}
+		_, disagreed := lookupTxtOnNameservers(ctx, vc, servers, name, value)
+		agreed := len(servers) - len(disagreed)
+		if required := p.GetDNSChallengeQuorum().Required(len(servers)); agreed < required {
+			return fmt.Errorf("record found on %d of %d nameservers, %d required", agreed, len(servers), required)
+		}
+		return nil
+	}
+
+	records, err := vc.LookupTxt(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error looking up TXT records: %w", err)
+	}
+	if !containsTXTRecord(records, value) {
+		return fmt.Errorf("record not found in %v", records)
+	}
+	return nil
+}
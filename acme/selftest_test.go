@@ -0,0 +1,137 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// memoryDNSUpdater is a DNSUpdater that stores the records in memory. The
+// records are visible after the given number of lookups.
+type memoryDNSUpdater struct {
+	mu        sync.Mutex
+	records   map[string][]string
+	delay     int
+	lookups   int
+	addErr    error
+	removeErr error
+	removed   bool
+}
+
+func (u *memoryDNSUpdater) AddTXT(_ context.Context, name, value string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.addErr != nil {
+		return u.addErr
+	}
+	if u.records == nil {
+		u.records = make(map[string][]string)
+	}
+	u.records[name] = append(u.records[name], value)
+	return nil
+}
+
+func (u *memoryDNSUpdater) RemoveTXT(_ context.Context, name, _ string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.removed = true
+	delete(u.records, name)
+	return u.removeErr
+}
+
+func (u *memoryDNSUpdater) lookupTxt(name string) ([]string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.lookups++; u.lookups <= u.delay {
+		return nil, errors.New("no such host")
+	}
+	return u.records[name], nil
+}
+
+func TestSelfTestDNS01(t *testing.T) {
+	interval := dns01SelfTestInterval
+	dns01SelfTestInterval = time.Millisecond
+	t.Cleanup(func() { dns01SelfTestInterval = interval })
+
+	newContext := func(u *memoryDNSUpdater, quorum provisioner.ACMEDNSQuorum) context.Context {
+		ctx := NewClientContext(context.Background(), &mockClient{
+			lookupTxt: u.lookupTxt,
+			lookupNS: func(name string) ([]string, error) {
+				return []string{"ns1:53", "ns2:53", "ns3:53"}, nil
+			},
+			lookupTxtOn: func(server, name string) ([]string, error) {
+				if server == "ns3:53" {
+					return nil, errors.New("timeout")
+				}
+				return u.lookupTxt(name)
+			},
+		})
+		return NewProvisionerContext(ctx, &MockProvisioner{
+			MgetDNSChallengePrefix: func() string { return "_acme-challenge.tenant1" },
+			MgetDNSChallengeQuorum: func() provisioner.ACMEDNSQuorum { return quorum },
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		u := &memoryDNSUpdater{delay: 2}
+		res := SelfTestDNS01(newContext(u, ""), u, "*.example.com")
+		assert.True(t, res.Success)
+		assert.Empty(t, res.Error)
+		assert.Equal(t, "*.example.com", res.Domain)
+		assert.Equal(t, "_acme-challenge.tenant1.example.com", res.Name)
+		assert.Len(t, res.Value, 43)
+		assert.Equal(t, 3, res.Lookups)
+		assert.True(t, u.removed)
+		assert.Empty(t, u.records)
+	})
+
+	t.Run("ok/quorum", func(t *testing.T) {
+		u := &memoryDNSUpdater{}
+		res := SelfTestDNS01(newContext(u, provisioner.DNSQuorumMajority), u, "example.com")
+		assert.True(t, res.Success)
+		assert.Equal(t, 1, res.Lookups)
+	})
+
+	t.Run("fail/quorum", func(t *testing.T) {
+		u := &memoryDNSUpdater{}
+		ctx, cancel := context.WithTimeout(newContext(u, provisioner.DNSQuorumAll), 50*time.Millisecond)
+		defer cancel()
+		res := SelfTestDNS01(ctx, u, "example.com")
+		assert.False(t, res.Success)
+		assert.Regexp(t, `^TXT record _acme-challenge.tenant1.example.com was not seen after \d+ lookups: record found on 2 of 3 nameservers, 3 required$`, res.Error)
+		assert.True(t, u.removed)
+	})
+
+	t.Run("fail/add", func(t *testing.T) {
+		u := &memoryDNSUpdater{addErr: errors.New("refused")}
+		res := SelfTestDNS01(newContext(u, ""), u, "example.com")
+		assert.False(t, res.Success)
+		assert.Equal(t, "error adding TXT record _acme-challenge.tenant1.example.com: refused", res.Error)
+		assert.Zero(t, res.Lookups)
+		assert.False(t, u.removed)
+	})
+
+	t.Run("fail/remove", func(t *testing.T) {
+		u := &memoryDNSUpdater{removeErr: errors.New("refused")}
+		res := SelfTestDNS01(newContext(u, ""), u, "example.com")
+		assert.False(t, res.Success)
+		assert.Equal(t, "error removing TXT record _acme-challenge.tenant1.example.com: refused", res.Error)
+	})
+
+	t.Run("fail/canceled", func(t *testing.T) {
+		u := &memoryDNSUpdater{delay: 1000}
+		ctx, cancel := context.WithCancel(newContext(u, ""))
+		cancel()
+		res := SelfTestDNS01(ctx, u, "example.com")
+		require.False(t, res.Success)
+		assert.Equal(t, "TXT record _acme-challenge.tenant1.example.com was not seen after 1 lookups: error looking up TXT records: no such host", res.Error)
+		assert.True(t, u.removed)
+	})
+}
@@ -14,7 +14,11 @@ var (
 	StatusDeactivated = Status("deactivated")
 	// StatusReady -- ready; e.g. for an Order that is ready to be finalized.
 	StatusReady = Status("ready")
+	// StatusRevoked -- revoked; e.g. for an Authorization revoked by an administrator.
+	StatusRevoked = Status("revoked")
+	// StatusProcessing -- processing; e.g. for a Challenge waiting for its
+	// validation.
+	StatusProcessing = Status("processing")
 	//statusExpired     = "expired"
 	//statusActive      = "active"
-	//statusProcessing  = "processing"
 )
@@ -0,0 +1,70 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+)
+
+// defaultTokenLength is the number of alphanumeric characters of the challenge
+// tokens if the provisioner does not configure a length.
+const defaultTokenLength = 32
+
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// NewChallengeToken returns a new random token for the challenges of an
+// authorization. If the provisioner in the context configures a token length,
+// the token is that number of random bytes encoded using base64url, otherwise
+// it's a string of 32 random alphanumeric characters. The random bytes are
+// read from the entropy source in the context, or crypto/rand if there is
+// none.
+func NewChallengeToken(ctx context.Context) (string, error) {
+	r := EntropySourceFromContext(ctx)
+	if p, ok := ProvisionerFromContext(ctx); ok && p.GetChallengeTokenLength() > 0 {
+		b := make([]byte, p.GetChallengeTokenLength())
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	}
+	return randomAlphanumeric(r, defaultTokenLength)
+}
+
+// randomAlphanumeric returns a string of n alphanumeric characters read from
+// the given source. Bytes that would bias the distribution are discarded.
+func randomAlphanumeric(r io.Reader, n int) (string, error) {
+	// 248 is the largest multiple of len(alphanumeric) lower than 256.
+	const maxByte = 256 - 256%len(alphanumeric)
+	token := make([]byte, 0, n)
+	for len(token) < n {
+		buf := make([]byte, n-len(token))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < maxByte {
+				token = append(token, alphanumeric[int(b)%len(alphanumeric)])
+			}
+		}
+	}
+	return string(token), nil
+}
+
+type entropySourceKey struct{}
+
+// NewEntropySourceContext adds the source of the random bytes of the challenge
+// tokens to the context.
+func NewEntropySourceContext(ctx context.Context, r io.Reader) context.Context {
+	return context.WithValue(ctx, entropySourceKey{}, r)
+}
+
+// EntropySourceFromContext returns the source of the random bytes of the
+// challenge tokens in the context. It returns crypto/rand.Reader if the
+// context does not have one.
+func EntropySourceFromContext(ctx context.Context) io.Reader {
+	if r, ok := ctx.Value(entropySourceKey{}).(io.Reader); ok && r != nil {
+		return r
+	}
+	return rand.Reader
+}
@@ -0,0 +1,71 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/randutil"
+)
+
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) {
+	return 0, errors.New("force")
+}
+
+func TestNewChallengeToken(t *testing.T) {
+	withLength := func(n int) context.Context {
+		return NewProvisionerContext(context.Background(), &MockProvisioner{
+			MgetChallengeTokenLength: func() int { return n },
+		})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		token, err := NewChallengeToken(context.Background())
+		require.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9A-Za-z]{32}$`), token)
+
+		token, err = NewChallengeToken(withLength(0))
+		require.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9A-Za-z]{32}$`), token)
+	})
+
+	t.Run("length", func(t *testing.T) {
+		for _, n := range []int{16, 32, 64} {
+			token, err := NewChallengeToken(withLength(n))
+			require.NoError(t, err)
+			b, err := base64.RawURLEncoding.DecodeString(token)
+			require.NoError(t, err)
+			assert.Len(t, b, n)
+		}
+	})
+
+	t.Run("entropySource", func(t *testing.T) {
+		random, err := randutil.Salt(32)
+		require.NoError(t, err)
+		ctx := NewEntropySourceContext(withLength(32), bytes.NewReader(random))
+		token, err := NewChallengeToken(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(random), token)
+
+		// The default tokens use the source too, discarding the bytes that
+		// would bias the distribution.
+		source := append(bytes.Repeat([]byte{255}, 10), bytes.Repeat([]byte{0, 1, 61, 62 + 61}, 8)...)
+		token, err = NewChallengeToken(NewEntropySourceContext(context.Background(), bytes.NewReader(source)))
+		require.NoError(t, err)
+		assert.Equal(t, "01zz01zz01zz01zz01zz01zz01zz01zz", token)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := NewChallengeToken(NewEntropySourceContext(withLength(32), failReader{}))
+		assert.EqualError(t, err, "force")
+		_, err = NewChallengeToken(NewEntropySourceContext(context.Background(), failReader{}))
+		assert.EqualError(t, err, "force")
+	})
+}
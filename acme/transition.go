@@ -0,0 +1,48 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+)
+
+// ChallengeTransitionFunc is called after a challenge changes its status, e.g.
+// from pending to valid or invalid, with copies of the challenge before and
+// after the change.
+type ChallengeTransitionFunc func(old, new Challenge)
+
+type challengeTransitionKey struct{}
+
+// NewChallengeTransitionContext adds the given challenge transition callback to
+// the context.
+func NewChallengeTransitionContext(ctx context.Context, fn ChallengeTransitionFunc) context.Context {
+	return context.WithValue(ctx, challengeTransitionKey{}, fn)
+}
+
+// ChallengeTransitionFromContext returns the current challenge transition
+// callback from the given context.
+func ChallengeTransitionFromContext(ctx context.Context) (fn ChallengeTransitionFunc, ok bool) {
+	fn, ok = ctx.Value(challengeTransitionKey{}).(ChallengeTransitionFunc)
+	return fn, ok && fn != nil
+}
+
+// notifyChallengeTransition calls the challenge transition callback in the
+// context if the status of the challenge has changed. The callback runs in its
+// own goroutine, so it cannot block or fail the validation; a panic is
+// recovered and logged.
+func notifyChallengeTransition(ctx context.Context, old, ch *Challenge) {
+	fn, ok := ChallengeTransitionFromContext(ctx)
+	if !ok || old.Status == ch.Status {
+		return
+	}
+
+	oldCh, newCh := *old, *ch
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				MustLoggerFromContext(ctx).Log(LogLevelError, "acme challenge transition callback panicked",
+					"challenge-id", newCh.ID, "panic", fmt.Sprint(r))
+			}
+		}()
+		fn(oldCh, newCh)
+	}()
+}
@@ -255,22 +255,41 @@ func scepFromProvisioner(p *provisioner.SCEP) *models.SCEP {
 	}
 }
 
+// acmeFromProvisioner returns a copy of the ACME provisioner with the TSIG
+// secret of the dynamic DNS updates and the validation proxy password
+// redacted.
+func acmeFromProvisioner(p *provisioner.ACME) *provisioner.ACME {
+	cp := *p
+	if p.ValidationProxy != nil && p.ValidationProxy.Password != "" {
+		proxy := *p.ValidationProxy
+		proxy.Password = redacted
+		cp.ValidationProxy = &proxy
+	}
+	if p.DNSUpdate != nil {
+		dnsUpdate := *p.DNSUpdate
+		dnsUpdate.KeySecret = redacted
+		cp.DNSUpdate = &dnsUpdate
+	}
+	return &cp
+}
+
 // MarshalJSON implements json.Marshaler. It marshals the ProvisionersResponse
 // into a byte slice.
 //
-// Special treatment is given to the SCEP provisioner, as it contains a
-// challenge secret that MUST NOT be leaked in (public) HTTP responses. The
-// challenge value is thus redacted in HTTP responses.
+// Special treatment is given to the SCEP and ACME provisioners, as they can
+// contain secrets that MUST NOT be leaked in (public) HTTP responses. The
+// SCEP challenge and the ACME TSIG secret and proxy password are thus redacted in HTTP responses.
 func (p ProvisionersResponse) MarshalJSON() ([]byte, error) {
 	var responseProvisioners provisioner.List
 	for _, item := range p.Provisioners {
-		scepProv, ok := item.(*provisioner.SCEP)
-		if !ok {
+		switch prov := item.(type) {
+		case *provisioner.SCEP:
+			responseProvisioners = append(responseProvisioners, scepFromProvisioner(prov))
+		case *provisioner.ACME:
+			responseProvisioners = append(responseProvisioners, acmeFromProvisioner(prov))
+		default:
 			responseProvisioners = append(responseProvisioners, item)
-			continue
 		}
-
-		responseProvisioners = append(responseProvisioners, scepFromProvisioner(scepProv))
 	}
 
 	var list = struct {
@@ -359,9 +378,18 @@ func Version(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Health is an HTTP handler that returns the status of the server.
-func Health(w http.ResponseWriter, _ *http.Request) {
-	render.JSON(w, HealthResponse{Status: "ok"})
+// Health is an HTTP handler that returns the status of the server. If the
+// authority is in the context, it checks that the signing key is usable, and
+// returns a 503 Service Unavailable with the status if it's not.
+func Health(w http.ResponseWriter, r *http.Request) {
+	if a, ok := authority.FromContext(r.Context()); ok {
+		if status, err := a.Health(r.Context()); status != authority.HealthStatusServing {
+			log.Error(w, err)
+			render.JSONStatus(w, HealthResponse{Status: string(status)}, http.StatusServiceUnavailable)
+			return
+		}
+	}
+	render.JSON(w, HealthResponse{Status: string(authority.HealthStatusServing)})
 }
 
 // Root is an HTTP handler that using the SHA256 from the URL, returns the root
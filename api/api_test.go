@@ -834,6 +834,38 @@ func Test_Health(t *testing.T) {
 	}
 }
 
+func Test_Health_keyUnavailable(t *testing.T) {
+	a, err := authority.NewEmbedded(
+		authority.WithX509SignerFunc(func() ([]*x509.Certificate, crypto.Signer, error) {
+			return nil, nil, errors.New("session closed")
+		}),
+		authority.WithX509RootCerts(parseCertificate(rootPEM)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/health", http.NoBody)
+	req = req.WithContext(authority.NewContext(req.Context(), a))
+	w := httptest.NewRecorder()
+	Health(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("caHandler.Health StatusCode = %d, wants %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Errorf("caHandler.Health unexpected error = %v", err)
+	}
+	expected := []byte("{\"status\":\"keyUnavailable\"}\n")
+	if !bytes.Equal(body, expected) {
+		t.Errorf("caHandler.Health Body = %s, wants %s", body, expected)
+	}
+}
+
 func Test_Root(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1635,6 +1667,47 @@ const (
 	fixtureECDSACertificate = `ecdsa-sha2-nistp256-cert-v01@openssh.com AAAAKGVjZHNhLXNoYTItbmlzdHAyNTYtY2VydC12MDFAb3BlbnNzaC5jb20AAAAgLnkvSk4odlo3b1R+RDw+LmorL3RkN354IilCIVFVen4AAAAIbmlzdHAyNTYAAABBBHjKHss8WM2ffMYlavisoLXR0I6UEIU+cidV1ogEH1U6+/SYaFPrlzQo0tGLM5CNkMbhInbyasQsrHzn8F1Rt7nHg5/tcSf9qwAAAAEAAAAGaGVybWFuAAAACgAAAAZoZXJtYW4AAAAAY8kvJwAAAABjyhBjAAAAAAAAAIIAAAAVcGVybWl0LVgxMS1mb3J3YXJkaW5nAAAAAAAAABdwZXJtaXQtYWdlbnQtZm9yd2FyZGluZwAAAAAAAAAWcGVybWl0LXBvcnQtZm9yd2FyZGluZwAAAAAAAAAKcGVybWl0LXB0eQAAAAAAAAAOcGVybWl0LXVzZXItcmMAAAAAAAAAAAAAAGgAAAATZWNkc2Etc2hhMi1uaXN0cDI1NgAAAAhuaXN0cDI1NgAAAEEE/ayqpPrZZF5uA1UlDt4FreTf15agztQIzpxnWq/XoxAHzagRSkFGkdgFpjgsfiRpP8URHH3BZScqc0ZDCTxhoQAAAGQAAAATZWNkc2Etc2hhMi1uaXN0cDI1NgAAAEkAAAAhAJuP1wCVwoyrKrEtHGfFXrVbRHySDjvXtS1tVTdHyqymAAAAIBa/CSSzfZb4D2NLP+eEmOOMJwSjYOiNM8fiOoAaqglI herman`
 )
 
+func TestProvisionersResponse_MarshalJSON_acme(t *testing.T) {
+	p := &provisioner.ACME{
+		Type: "ACME",
+		Name: "acme",
+		ValidationProxy: &provisioner.ACMEValidationProxy{
+			URL:      "http://proxy.example.com:3128",
+			Username: "user",
+			Password: "password",
+		},
+		DNSUpdate: &provisioner.ACMEDNSUpdate{
+			Server:    "ns.example.com:53",
+			Zone:      "example.com",
+			KeyName:   "tsig-key.",
+			KeySecret: "c2VjcmV0",
+		},
+	}
+	b, err := ProvisionersResponse{Provisioners: provisioner.List{p}}.MarshalJSON()
+	require.NoError(t, err)
+
+	var res struct {
+		Provisioners []map[string]any `json:"provisioners"`
+	}
+	require.NoError(t, json.Unmarshal(b, &res))
+	require.Len(t, res.Provisioners, 1)
+	assert.Equal(t, map[string]any{
+		"server":    "ns.example.com:53",
+		"zone":      "example.com",
+		"keyName":   "tsig-key.",
+		"keySecret": "*** REDACTED ***",
+	}, res.Provisioners[0]["dnsUpdate"])
+	assert.Equal(t, map[string]any{
+		"url":      "http://proxy.example.com:3128",
+		"username": "user",
+		"password": "*** REDACTED ***",
+	}, res.Provisioners[0]["validationProxy"])
+
+	// MarshalJSON must not affect the provisioner itself
+	assert.Equal(t, "c2VjcmV0", p.DNSUpdate.KeySecret)
+	assert.Equal(t, "password", p.ValidationProxy.Password)
+}
+
 func TestLogSSHCertificate(t *testing.T) {
 
 	out, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fixtureECDSACertificate))
@@ -4,7 +4,10 @@ package render
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
@@ -83,11 +86,27 @@ type RenderableError interface {
 	Render(http.ResponseWriter)
 }
 
+// RetryAfterError is the set of errors that report how long a client should
+// wait before retrying the request.
+//
+// Errors that implement this interface will set the Retry-After header when
+// the duration reported by RetryAfter is greater than zero.
+type RetryAfterError interface {
+	error
+
+	RetryAfter() time.Duration
+}
+
 // Error marshals the JSON representation of err to w. In case err implements
 // RenderableError its own Render method will be called instead.
 func Error(w http.ResponseWriter, err error) {
 	log.Error(w, err)
 
+	var ra RetryAfterError
+	if errors.As(err, &ra) {
+		SetRetryAfter(w, ra.RetryAfter())
+	}
+
 	var r RenderableError
 	if errors.As(err, &r) {
 		r.Render(w)
@@ -98,6 +117,14 @@ func Error(w http.ResponseWriter, err error) {
 	JSONStatus(w, err, statusCodeFromError(err))
 }
 
+// SetRetryAfter sets the Retry-After header in seconds if d is greater than
+// zero.
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	}
+}
+
 // StatusCodedError is the set of errors that implement the basic StatusCode
 // function.
 //
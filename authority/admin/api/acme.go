@@ -3,13 +3,17 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
 	"go.step.sm/linkedca"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 // CreateExternalAccountKeyRequest is the type for POST /admin/acme/eab requests
@@ -83,6 +87,182 @@ func (h *acmeAdminResponder) DeleteExternalAccountKey(w http.ResponseWriter, _ *
 	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
 }
 
+// GetACMEChallengeAttemptsResponse is the type for GET
+// /admin/acme/challenges/{id}/attempts responses.
+type GetACMEChallengeAttemptsResponse struct {
+	ID       string                   `json:"id"`
+	Type     acme.ChallengeType       `json:"type"`
+	Status   acme.Status              `json:"status"`
+	Value    string                   `json:"value"`
+	Attempts []*acme.ChallengeAttempt `json:"attempts"`
+}
+
+// GetACMEChallengeAttempts returns the history of validation attempts of an
+// ACME challenge.
+func GetACMEChallengeAttempts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, ok := acme.DatabaseFromContext(ctx)
+	if !ok || db == nil {
+		render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "acme is not enabled"))
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	ch, err := db.GetChallenge(ctx, id, "")
+	if err != nil {
+		if acme.IsErrNotFound(err) {
+			render.Error(w, admin.NewError(admin.ErrorNotFoundType, "acme challenge %s not found", id))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving acme challenge %s", id))
+		return
+	}
+
+	attempts := ch.Attempts
+	if attempts == nil {
+		attempts = []*acme.ChallengeAttempt{}
+	}
+
+	render.JSON(w, &GetACMEChallengeAttemptsResponse{
+		ID:       ch.ID,
+		Type:     ch.Type,
+		Status:   ch.Status,
+		Value:    ch.Value,
+		Attempts: attempts,
+	})
+}
+
+// UpdateACMEAuthorizationRequest is the type for PUT
+// /admin/acme/authz/{id} requests.
+type UpdateACMEAuthorizationRequest struct {
+	Status acme.Status `json:"status"`
+}
+
+// Validate validates an update ACME authorization request body.
+func (r *UpdateACMEAuthorizationRequest) Validate() error {
+	switch r.Status {
+	case acme.StatusDeactivated, acme.StatusRevoked:
+		return nil
+	default:
+		return admin.NewError(admin.ErrorBadRequestType, "status must be %s or %s", acme.StatusDeactivated, acme.StatusRevoked)
+	}
+}
+
+// UpdateACMEAuthorizationResponse is the type for PUT
+// /admin/acme/authz/{id} responses.
+type UpdateACMEAuthorizationResponse struct {
+	ID         string          `json:"id"`
+	Identifier acme.Identifier `json:"identifier"`
+	Status     acme.Status     `json:"status"`
+}
+
+// UpdateACMEAuthorization deactivates or revokes an ACME authorization and its
+// challenges, so the orders using it cannot be finalized.
+func UpdateACMEAuthorization(w http.ResponseWriter, r *http.Request) {
+	var body UpdateACMEAuthorizationRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	db, ok := acme.DatabaseFromContext(ctx)
+	if !ok || db == nil {
+		render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "acme is not enabled"))
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	az, err := db.GetAuthorization(ctx, id)
+	if err != nil {
+		if acme.IsErrNotFound(err) {
+			render.Error(w, admin.NewError(admin.ErrorNotFoundType, "acme authorization %s not found", id))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving acme authorization %s", id))
+		return
+	}
+
+	if err := az.Deactivate(ctx, db, body.Status); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error updating acme authorization %s", id))
+		return
+	}
+
+	render.JSON(w, &UpdateACMEAuthorizationResponse{
+		ID:         az.ID,
+		Identifier: az.Identifier,
+		Status:     az.Status,
+	})
+}
+
+// SelfTestACMEDNS01Request is the type for POST
+// /admin/acme/selftest/{provisionerName}/dns-01 requests.
+type SelfTestACMEDNS01Request struct {
+	Domain string `json:"domain"`
+}
+
+// newDNSUpdater creates the updater used to write the records of the dns-01
+// self-test. It can be replaced in tests.
+var newDNSUpdater = acme.NewRFC2136Updater
+
+// SelfTestACMEDNS01 runs the dns-01 self-test of an ACME provisioner. It writes
+// a test record using the RFC 2136 dynamic updates configured in the
+// provisioner, waits until the CA can see it, removes it, and returns the
+// report of the test.
+func SelfTestACMEDNS01(w http.ResponseWriter, r *http.Request) {
+	var body SelfTestACMEDNS01Request
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	domain := strings.TrimSuffix(strings.TrimPrefix(body.Domain, "*."), ".")
+	if domain == "" {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "domain cannot be empty"))
+		return
+	}
+
+	ctx := r.Context()
+	if _, ok := acme.ClientFromContext(ctx); !ok {
+		render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "acme is not enabled"))
+		return
+	}
+
+	name := chi.URLParam(r, "provisionerName")
+	p, err := mustAuthority(ctx).LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error loading provisioner %s", name))
+		return
+	}
+	acmeProv, ok := p.(*provisioner.ACME)
+	if !ok {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not an ACME provisioner", name))
+		return
+	}
+	cfg := acmeProv.DNSUpdate
+	if cfg == nil {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "provisioner %s does not configure dnsUpdate", name))
+		return
+	}
+	zone := strings.TrimSuffix(cfg.Zone, ".")
+	if domain != zone && !strings.HasSuffix(domain, "."+zone) {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "domain %s is not in the zone %s", domain, zone))
+		return
+	}
+
+	updater, err := newDNSUpdater(cfg)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error creating dns updater for provisioner %s", name))
+		return
+	}
+
+	ctx = acme.NewProvisionerContext(ctx, acmeProv)
+	render.JSON(w, acme.SelfTestDNS01(ctx, updater, domain))
+}
+
 func eakToLinked(k *acme.ExternalAccountKey) *linkedca.EABKey {
 	if k == nil {
 		return nil
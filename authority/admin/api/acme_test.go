@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -22,6 +23,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func readProtoJSON(r io.ReadCloser, m proto.Message) error {
@@ -556,3 +558,478 @@ func Test_linkedEAKToCertificates(t *testing.T) {
 		})
 	}
 }
+
+func TestGetACMEChallengeAttempts(t *testing.T) {
+	now := time.Now().Truncate(time.Second).UTC()
+	type test struct {
+		ctx        context.Context
+		statusCode int
+		err        *admin.Error
+		resp       *GetACMEChallengeAttemptsResponse
+	}
+	newContext := func(db acme.DB) context.Context {
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("id", "chID")
+		ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		if db != nil {
+			ctx = acme.NewDatabaseContext(ctx, db)
+		}
+		return ctx
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-acme-db": func(t *testing.T) test {
+			return test{
+				ctx:        newContext(nil),
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    admin.ErrorNotImplementedType.String(),
+					Status:  http.StatusNotImplemented,
+					Message: "acme is not enabled",
+					Detail:  "not implemented",
+				},
+			}
+		},
+		"fail/not-found": func(t *testing.T) test {
+			db := &acme.MockDB{
+				MockGetChallenge: func(ctx context.Context, id, authzID string) (*acme.Challenge, error) {
+					assert.Equals(t, "chID", id)
+					return nil, acme.NewNotFoundError("challenge chID not found")
+				},
+			}
+			return test{
+				ctx:        newContext(db),
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "acme challenge chID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/db-error": func(t *testing.T) test {
+			db := &acme.MockDB{
+				MockGetChallenge: func(ctx context.Context, id, authzID string) (*acme.Challenge, error) {
+					return nil, errors.New("force")
+				},
+			}
+			return test{
+				ctx:        newContext(db),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving acme challenge chID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			attempts := []*acme.ChallengeAttempt{
+				{Time: now, Values: []string{"foo"}, Error: "keyAuthorization does not match"},
+				{Time: now.Add(time.Minute), Values: []string{"bar"}},
+			}
+			db := &acme.MockDB{
+				MockGetChallenge: func(ctx context.Context, id, authzID string) (*acme.Challenge, error) {
+					return &acme.Challenge{
+						ID:       "chID",
+						Type:     acme.DNS01,
+						Status:   acme.StatusValid,
+						Value:    "example.com",
+						Attempts: attempts,
+					}, nil
+				},
+			}
+			return test{
+				ctx:        newContext(db),
+				statusCode: 200,
+				resp: &GetACMEChallengeAttemptsResponse{
+					ID:       "chID",
+					Type:     acme.DNS01,
+					Status:   acme.StatusValid,
+					Value:    "example.com",
+					Attempts: attempts,
+				},
+			}
+		},
+		"ok/no-attempts": func(t *testing.T) test {
+			db := &acme.MockDB{
+				MockGetChallenge: func(ctx context.Context, id, authzID string) (*acme.Challenge, error) {
+					return &acme.Challenge{
+						ID:     "chID",
+						Type:   acme.HTTP01,
+						Status: acme.StatusPending,
+						Value:  "example.com",
+					}, nil
+				},
+			}
+			return test{
+				ctx:        newContext(db),
+				statusCode: 200,
+				resp: &GetACMEChallengeAttemptsResponse{
+					ID:       "chID",
+					Type:     acme.HTTP01,
+					Status:   acme.StatusPending,
+					Value:    "example.com",
+					Attempts: []*acme.ChallengeAttempt{},
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/foo", http.NoBody) // chi routing is prepared in test setup
+			req = req.WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			GetACMEChallengeAttempts(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
+
+			resp := new(GetACMEChallengeAttemptsResponse)
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), resp))
+			assert.Equals(t, tc.resp, resp)
+		})
+	}
+}
+
+func TestUpdateACMEAuthorization(t *testing.T) {
+	type test struct {
+		ctx        context.Context
+		body       []byte
+		statusCode int
+		err        *admin.Error
+		resp       *UpdateACMEAuthorizationResponse
+	}
+	newContext := func(db acme.DB) context.Context {
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("id", "azID")
+		ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		if db != nil {
+			ctx = acme.NewDatabaseContext(ctx, db)
+		}
+		return ctx
+	}
+	newDB := func(status acme.Status) *acme.MockDB {
+		return &acme.MockDB{
+			MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+				assert.Equals(t, "azID", id)
+				return &acme.Authorization{
+					ID:         "azID",
+					Identifier: acme.Identifier{Type: acme.DNS, Value: "example.com"},
+					Status:     status,
+					Challenges: []*acme.Challenge{{ID: "chID", Status: acme.StatusValid}},
+				}, nil
+			},
+			MockUpdateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+				assert.Equals(t, "chID", ch.ID)
+				return nil
+			},
+			MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+				assert.Equals(t, "azID", az.ID)
+				return nil
+			},
+		}
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read-body": func(t *testing.T) test {
+			return test{
+				ctx:        newContext(newDB(acme.StatusValid)),
+				body:       []byte("{"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: unexpected EOF",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				ctx:        newContext(newDB(acme.StatusValid)),
+				body:       []byte(`{"status":"valid"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "status must be deactivated or revoked",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/no-acme-db": func(t *testing.T) test {
+			return test{
+				ctx:        newContext(nil),
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    admin.ErrorNotImplementedType.String(),
+					Status:  http.StatusNotImplemented,
+					Message: "acme is not enabled",
+					Detail:  "not implemented",
+				},
+			}
+		},
+		"fail/not-found": func(t *testing.T) test {
+			db := &acme.MockDB{
+				MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+					return nil, acme.NewNotFoundError("authz azID not found")
+				},
+			}
+			return test{
+				ctx:        newContext(db),
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "acme authorization azID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/update-error": func(t *testing.T) test {
+			db := newDB(acme.StatusValid)
+			db.MockUpdateAuthorization = func(ctx context.Context, az *acme.Authorization) error {
+				return errors.New("force")
+			}
+			return test{
+				ctx:        newContext(db),
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error updating acme authorization azID: error updating authorization: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok/deactivated": func(t *testing.T) test {
+			return test{
+				ctx:        newContext(newDB(acme.StatusValid)),
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 200,
+				resp: &UpdateACMEAuthorizationResponse{
+					ID:         "azID",
+					Identifier: acme.Identifier{Type: acme.DNS, Value: "example.com"},
+					Status:     acme.StatusDeactivated,
+				},
+			}
+		},
+		"ok/already-revoked": func(t *testing.T) test {
+			db := newDB(acme.StatusRevoked)
+			db.MockUpdateAuthorization = func(ctx context.Context, az *acme.Authorization) error {
+				return errors.New("unexpected update")
+			}
+			return test{
+				ctx:        newContext(db),
+				body:       []byte(`{"status":"revoked"}`),
+				statusCode: 200,
+				resp: &UpdateACMEAuthorizationResponse{
+					ID:         "azID",
+					Identifier: acme.Identifier{Type: acme.DNS, Value: "example.com"},
+					Status:     acme.StatusRevoked,
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/foo", bytes.NewReader(tc.body)) // chi routing is prepared in test setup
+			req = req.WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			UpdateACMEAuthorization(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			resp := new(UpdateACMEAuthorizationResponse)
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), resp))
+			assert.Equals(t, tc.resp, resp)
+		})
+	}
+}
+
+// txtClient is an acme.Client that returns the records of a memory updater.
+type txtClient struct {
+	acme.Client
+	updater *memoryDNSUpdater
+}
+
+func (c *txtClient) LookupTxt(_ context.Context, name string) ([]string, error) {
+	return c.updater.records[name], nil
+}
+
+type memoryDNSUpdater struct {
+	records map[string][]string
+}
+
+func (u *memoryDNSUpdater) AddTXT(_ context.Context, name, value string) error {
+	u.records[name] = append(u.records[name], value)
+	return nil
+}
+
+func (u *memoryDNSUpdater) RemoveTXT(_ context.Context, name, _ string) error {
+	delete(u.records, name)
+	return nil
+}
+
+func TestSelfTestACMEDNS01(t *testing.T) {
+	dnsUpdate := &provisioner.ACMEDNSUpdate{
+		Server:    "127.0.0.1:53",
+		Zone:      "example.com",
+		KeyName:   "key",
+		KeySecret: "c2VjcmV0",
+	}
+	updater := &memoryDNSUpdater{records: map[string][]string{}}
+	fn := newDNSUpdater
+	t.Cleanup(func() { newDNSUpdater = fn })
+	newDNSUpdater = func(cfg *provisioner.ACMEDNSUpdate) (acme.DNSUpdater, error) {
+		assert.Equals(t, dnsUpdate, cfg)
+		return updater, nil
+	}
+
+	type test struct {
+		ctx        context.Context
+		auth       adminAuthority
+		body       string
+		statusCode int
+		err        *admin.Error
+	}
+	newContext := func(withClient bool) context.Context {
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("provisionerName", "acme")
+		ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		if withClient {
+			ctx = acme.NewClientContext(ctx, &txtClient{updater: updater})
+		}
+		return ctx
+	}
+	newAuth := func(p provisioner.Interface) adminAuthority {
+		return &mockAdminAuthority{
+			MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+				assert.Equals(t, "acme", name)
+				if p == nil {
+					return nil, errors.New("force")
+				}
+				return p, nil
+			},
+		}
+	}
+	acmeProv := &provisioner.ACME{Type: "ACME", Name: "acme", DNSUpdate: dnsUpdate}
+	badRequest := func(msg string) *admin.Error {
+		return &admin.Error{
+			Type:    admin.ErrorBadRequestType.String(),
+			Status:  http.StatusBadRequest,
+			Message: msg,
+			Detail:  "bad request",
+		}
+	}
+	var tests = map[string]test{
+		"fail/read-body": {
+			ctx: newContext(true), auth: newAuth(acmeProv), body: "{", statusCode: 400,
+			err: badRequest("error reading request body: error decoding json: unexpected EOF"),
+		},
+		"fail/empty-domain": {
+			ctx: newContext(true), auth: newAuth(acmeProv), body: `{"domain":""}`, statusCode: 400,
+			err: badRequest("domain cannot be empty"),
+		},
+		"fail/no-acme": {
+			ctx: newContext(false), auth: newAuth(acmeProv), body: `{"domain":"example.com"}`, statusCode: 501,
+			err: &admin.Error{
+				Type:    admin.ErrorNotImplementedType.String(),
+				Status:  http.StatusNotImplemented,
+				Message: "acme is not enabled",
+				Detail:  "not implemented",
+			},
+		},
+		"fail/load-provisioner": {
+			ctx: newContext(true), auth: newAuth(nil), body: `{"domain":"example.com"}`, statusCode: 500,
+			err: &admin.Error{
+				Type:    admin.ErrorServerInternalType.String(),
+				Status:  http.StatusInternalServerError,
+				Message: "error loading provisioner acme: force",
+				Detail:  "the server experienced an internal error",
+			},
+		},
+		"fail/not-acme": {
+			ctx: newContext(true), auth: newAuth(&provisioner.JWK{Name: "acme"}), body: `{"domain":"example.com"}`, statusCode: 400,
+			err: badRequest("provisioner acme is not an ACME provisioner"),
+		},
+		"fail/no-dns-update": {
+			ctx: newContext(true), auth: newAuth(&provisioner.ACME{Name: "acme"}), body: `{"domain":"example.com"}`, statusCode: 400,
+			err: badRequest("provisioner acme does not configure dnsUpdate"),
+		},
+		"fail/other-zone": {
+			ctx: newContext(true), auth: newAuth(acmeProv), body: `{"domain":"www.notexample.com"}`, statusCode: 400,
+			err: badRequest("domain www.notexample.com is not in the zone example.com"),
+		},
+		"ok": {
+			ctx: newContext(true), auth: newAuth(acmeProv), body: `{"domain":"www.example.com"}`, statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/foo", strings.NewReader(tc.body)) // chi routing is prepared in test setup
+			req = req.WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			SelfTestACMEDNS01(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			resp := new(acme.DNS01SelfTestResult)
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), resp))
+			assert.True(t, resp.Success)
+			assert.Equals(t, "", resp.Error)
+			assert.Equals(t, "_acme-challenge.www.example.com", resp.Name)
+			assert.Equals(t, 1, resp.Lookups)
+			assert.Equals(t, 0, len(updater.records))
+		})
+	}
+}
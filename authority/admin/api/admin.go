@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -33,6 +34,9 @@ type adminAuthority interface {
 	CreateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	UpdateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	RemoveAuthorityPolicy(ctx context.Context) error
+	SetMaintenanceMode(retryAfter time.Duration)
+	ClearMaintenanceMode()
+	IsMaintenanceMode() bool
 }
 
 // CreateAdminRequest represents the body for a CreateAdmin request.
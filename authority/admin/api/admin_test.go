@@ -44,6 +44,10 @@ type mockAdminAuthority struct {
 	MockCreateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockUpdateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockRemoveAuthorityPolicy func(ctx context.Context) error
+
+	MockSetMaintenanceMode   func(retryAfter time.Duration)
+	MockClearMaintenanceMode func()
+	MockIsMaintenanceMode    func() bool
 }
 
 func (m *mockAdminAuthority) IsAdminAPIEnabled() bool {
@@ -165,6 +169,25 @@ func (m *mockAdminAuthority) RemoveAuthorityPolicy(ctx context.Context) error {
 	return m.MockErr
 }
 
+func (m *mockAdminAuthority) SetMaintenanceMode(retryAfter time.Duration) {
+	if m.MockSetMaintenanceMode != nil {
+		m.MockSetMaintenanceMode(retryAfter)
+	}
+}
+
+func (m *mockAdminAuthority) ClearMaintenanceMode() {
+	if m.MockClearMaintenanceMode != nil {
+		m.MockClearMaintenanceMode()
+	}
+}
+
+func (m *mockAdminAuthority) IsMaintenanceMode() bool {
+	if m.MockIsMaintenanceMode != nil {
+		return m.MockIsMaintenanceMode()
+	}
+	return false
+}
+
 func TestCreateAdminRequest_Validate(t *testing.T) {
 	type fields struct {
 		Subject     string
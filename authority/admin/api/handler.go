@@ -100,6 +100,15 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("DELETE", "/acme/eab/{provisionerName}/{id}", acmeEABMiddleware(router.acmeResponder.DeleteExternalAccountKey))
 	}
 
+	// ACME challenges
+	r.MethodFunc("GET", "/acme/challenges/{id}/attempts", authnz(GetACMEChallengeAttempts))
+	r.MethodFunc("PUT", "/acme/authz/{id}", authnz(UpdateACMEAuthorization))
+	r.MethodFunc("POST", "/acme/selftest/{provisionerName}/dns-01", authnz(SelfTestACMEDNS01))
+
+	// Maintenance mode
+	r.MethodFunc("GET", "/maintenance", authnz(GetMaintenance))
+	r.MethodFunc("PUT", "/maintenance", authnz(UpdateMaintenance))
+
 	// Policy responder
 	if router.policyResponder != nil {
 		// Policy - Authority
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// UpdateMaintenanceRequest is the type for PUT /admin/maintenance requests.
+type UpdateMaintenanceRequest struct {
+	Enabled    bool                  `json:"enabled"`
+	RetryAfter *provisioner.Duration `json:"retryAfter,omitempty"`
+}
+
+// Validate validates an update maintenance request body.
+func (r *UpdateMaintenanceRequest) Validate() error {
+	if r.RetryAfter != nil && r.RetryAfter.Duration < 0 {
+		return admin.NewError(admin.ErrorBadRequestType, "retryAfter cannot be negative")
+	}
+	return nil
+}
+
+// MaintenanceResponse is the type for /admin/maintenance responses.
+type MaintenanceResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// GetMaintenance returns if the issuance of new certificates is paused.
+func GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, &MaintenanceResponse{
+		Enabled: mustAuthority(r.Context()).IsMaintenanceMode(),
+	})
+}
+
+// UpdateMaintenance enables or disables the maintenance mode, pausing or
+// resuming the issuance of new certificates.
+func UpdateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var body UpdateMaintenanceRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	auth := mustAuthority(r.Context())
+	if body.Enabled {
+		auth.SetMaintenanceMode(body.RetryAfter.Value())
+	} else {
+		auth.ClearMaintenanceMode()
+	}
+
+	render.JSON(w, &MaintenanceResponse{
+		Enabled: auth.IsMaintenanceMode(),
+	})
+}
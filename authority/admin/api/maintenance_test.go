@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func TestGetMaintenance(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockIsMaintenanceMode: func() bool { return true },
+	})
+	req := httptest.NewRequest("GET", "/foo", http.NoBody)
+	w := httptest.NewRecorder()
+	GetMaintenance(w, req)
+	res := w.Result()
+	assert.Equals(t, 200, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	resp := new(MaintenanceResponse)
+	assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), resp))
+	assert.Equals(t, &MaintenanceResponse{Enabled: true}, resp)
+}
+
+func TestUpdateMaintenance(t *testing.T) {
+	type test struct {
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+		err        *admin.Error
+		resp       *MaintenanceResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read-body": func(t *testing.T) test {
+			return test{
+				body:       []byte("{!?}"),
+				auth:       &mockAdminAuthority{},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				body:       []byte(`{"enabled":true,"retryAfter":"-1m"}`),
+				auth:       &mockAdminAuthority{},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "retryAfter cannot be negative",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"ok/enable": func(t *testing.T) test {
+			var enabled bool
+			return test{
+				body: []byte(`{"enabled":true,"retryAfter":"5m"}`),
+				auth: &mockAdminAuthority{
+					MockSetMaintenanceMode: func(retryAfter time.Duration) {
+						assert.Equals(t, 5*time.Minute, retryAfter)
+						enabled = true
+					},
+					MockIsMaintenanceMode: func() bool { return enabled },
+				},
+				statusCode: 200,
+				resp:       &MaintenanceResponse{Enabled: true},
+			}
+		},
+		"ok/disable": func(t *testing.T) test {
+			enabled := true
+			return test{
+				body: []byte(`{"enabled":false}`),
+				auth: &mockAdminAuthority{
+					MockClearMaintenanceMode: func() { enabled = false },
+					MockIsMaintenanceMode:    func() bool { return enabled },
+				},
+				statusCode: 200,
+				resp:       &MaintenanceResponse{Enabled: false},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("PUT", "/foo", bytes.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			UpdateMaintenance(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			resp := new(MaintenanceResponse)
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), resp))
+			assert.Equals(t, tc.resp, resp)
+		})
+	}
+}
@@ -12,14 +12,14 @@ import (
 func (a *Authority) LoadAdminByID(id string) (*linkedca.Admin, bool) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	return a.admins.LoadByID(id)
+	return a.getAdmins().LoadByID(id)
 }
 
 // LoadAdminBySubProv returns an *linkedca.Admin with the given ID.
 func (a *Authority) LoadAdminBySubProv(subject, prov string) (*linkedca.Admin, bool) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	return a.admins.LoadBySubProv(subject, prov)
+	return a.getAdmins().LoadBySubProv(subject, prov)
 }
 
 // GetAdmins returns a map listing each provisioner and the JWK Key Set
@@ -27,7 +27,7 @@ func (a *Authority) LoadAdminBySubProv(subject, prov string) (*linkedca.Admin, b
 func (a *Authority) GetAdmins(cursor string, limit int) ([]*linkedca.Admin, string, error) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	admins, nextCursor := a.admins.Find(cursor, limit)
+	admins, nextCursor := a.getAdmins().Find(cursor, limit)
 	return admins, nextCursor, nil
 }
 
@@ -40,7 +40,7 @@ func (a *Authority) StoreAdmin(ctx context.Context, adm *linkedca.Admin, prov pr
 		return admin.NewErrorISE("admin.provisionerId does not match provisioner argument")
 	}
 
-	if _, ok := a.admins.LoadBySubProv(adm.Subject, prov.GetName()); ok {
+	if _, ok := a.getAdmins().LoadBySubProv(adm.Subject, prov.GetName()); ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"admin with subject %s and provisioner %s already exists", adm.Subject, prov.GetName())
 	}
@@ -48,7 +48,7 @@ func (a *Authority) StoreAdmin(ctx context.Context, adm *linkedca.Admin, prov pr
 	if err := a.adminDB.CreateAdmin(ctx, adm); err != nil {
 		return admin.WrapErrorISE(err, "error creating admin")
 	}
-	if err := a.admins.Store(adm, prov); err != nil {
+	if err := a.getAdmins().Store(adm, prov); err != nil {
 		if err := a.ReloadAdminResources(ctx); err != nil {
 			return admin.WrapErrorISE(err, "error reloading admin resources on failed admin store")
 		}
@@ -61,7 +61,7 @@ func (a *Authority) StoreAdmin(ctx context.Context, adm *linkedca.Admin, prov pr
 func (a *Authority) UpdateAdmin(ctx context.Context, id string, nu *linkedca.Admin) (*linkedca.Admin, error) {
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
-	adm, err := a.admins.Update(id, nu)
+	adm, err := a.getAdmins().Update(id, nu)
 	if err != nil {
 		return nil, admin.WrapErrorISE(err, "error updating cached admin %s", id)
 	}
@@ -84,7 +84,7 @@ func (a *Authority) RemoveAdmin(ctx context.Context, id string) error {
 
 // removeAdmin helper that assumes lock.
 func (a *Authority) removeAdmin(ctx context.Context, id string) error {
-	if err := a.admins.Remove(id); err != nil {
+	if err := a.getAdmins().Remove(id); err != nil {
 		return admin.WrapErrorISE(err, "error removing admin %s from authority cache", id)
 	}
 	if err := a.adminDB.DeleteAdmin(ctx, id); err != nil {
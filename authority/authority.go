@@ -12,10 +12,12 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/singleflight"
 
 	"go.step.sm/crypto/kms"
 	kmsapi "go.step.sm/crypto/kms/apiv1"
@@ -58,6 +60,7 @@ type Authority struct {
 	rootX509CertPool      *x509.CertPool
 	federatedX509Certs    []*x509.Certificate
 	intermediateX509Certs []*x509.Certificate
+	issuerX509Chains      [][]*x509.Certificate
 	certificates          *sync.Map
 	x509Enforcers         []provisioner.CertificateEnforcer
 
@@ -100,6 +103,11 @@ type Authority struct {
 
 	adminMutex sync.RWMutex
 
+	// provisionersMutex guards the provisioners and admins collections, and
+	// the provisioners, admins and claims in the configuration, which are
+	// replaced when they are reloaded. The writers also hold adminMutex.
+	provisionersMutex sync.RWMutex
+
 	// If true, do not initialize the authority
 	skipInit bool
 
@@ -108,6 +116,16 @@ type Authority struct {
 
 	// Called whenever applicable, in order to instrument the authority.
 	meter Meter
+
+	// If set, the issuance of new certificates is paused.
+	maintenance atomic.Pointer[maintenanceMode]
+
+	// Used by the health check to get the active X.509 signer.
+	healthSignerFunc   func() ([]*x509.Certificate, crypto.Signer, error)
+	healthCheckTimeout time.Duration
+	healthGroup        singleflight.Group
+	healthMutex        sync.Mutex
+	healthResult       *healthResult
 }
 
 // Info contains information about the authority.
@@ -178,9 +196,9 @@ func NewEmbedded(opts ...Option) (*Authority, error) {
 		return nil, errors.New("cannot create an authority without a configuration")
 	case len(a.rootX509Certs) == 0 && a.config.Root.HasEmpties():
 		return nil, errors.New("cannot create an authority without a root certificate")
-	case a.x509CAService == nil && a.config.IntermediateCert == "":
+	case a.x509CAService == nil && (a.config.GetActiveIssuer() == nil || a.config.GetActiveIssuer().Certificate == ""):
 		return nil, errors.New("cannot create an authority without an issuer certificate")
-	case a.x509CAService == nil && a.config.IntermediateKey == "":
+	case a.x509CAService == nil && a.config.GetActiveIssuer().Key == "":
 		return nil, errors.New("cannot create an authority without an issuer signer")
 	}
 
@@ -275,10 +293,14 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 		}
 	}
 
+	a.provisionersMutex.Lock()
+	old := allProvisioners(a.provisioners)
 	a.config.AuthorityConfig.Provisioners = provList
 	a.provisioners = provClxn
 	a.config.AuthorityConfig.Admins = adminList
 	a.admins = adminClxn
+	a.provisionersMutex.Unlock()
+	closeReplacedProvisioners(old, provList)
 
 	switch {
 	case a.requiresSCEP() && a.GetSCEP() == nil:
@@ -415,17 +437,33 @@ func (a *Authority) init() error {
 
 		// Read intermediate and create X509 signer for default CAS.
 		if options.Is(casapi.SoftCAS) {
-			options.CertificateChain, err = pemutil.ReadCertificateBundle(a.config.IntermediateCert)
+			issuer := a.config.GetActiveIssuer()
+			if issuer == nil {
+				return errors.New("cannot create an authority without an active issuer")
+			}
+			options.CertificateChain, err = pemutil.ReadCertificateBundle(issuer.Certificate)
 			if err != nil {
 				return err
 			}
 			options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.IntermediateKey,
+				SigningKey: issuer.Key,
 				Password:   a.password,
 			})
 			if err != nil {
 				return err
 			}
+			// Read the other issuers, they are only checked to chain to a root.
+			a.issuerX509Chains = [][]*x509.Certificate{options.CertificateChain}
+			for _, iss := range a.config.GetIssuers() {
+				if iss == issuer {
+					continue
+				}
+				chain, err := pemutil.ReadCertificateBundle(iss.Certificate)
+				if err != nil {
+					return err
+				}
+				a.issuerX509Chains = append(a.issuerX509Chains, chain)
+			}
 			// If not defined with an option, add intermediates to the list of
 			// certificates used for name constraints validation at issuance
 			// time.
@@ -462,6 +500,15 @@ func (a *Authority) init() error {
 			a.rootX509Certs = append(a.rootX509Certs, crts...)
 		}
 	}
+	// Check that all the configured issuers chain to a root. Without the root
+	// key, an intermediate-only CA must always chain to the root bundle.
+	if len(a.config.AuthorityConfig.Issuers) > 0 || a.config.IntermediateOnly {
+		for _, chain := range a.issuerX509Chains {
+			if err := config.VerifyIssuerChain(chain, a.rootX509Certs); err != nil {
+				return errors.Errorf("issuer certificate %q %v", chain[0].Subject, err)
+			}
+		}
+	}
 	for _, crt := range a.rootX509Certs {
 		sum := sha256.Sum256(crt.Raw)
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
@@ -703,11 +750,11 @@ func (a *Authority) init() error {
 				options.SignerCert = a.intermediateX509Certs[0]
 			}
 
-			// attempt to create the (default) SCEP signer if the intermediate
-			// key is configured.
-			if a.config.IntermediateKey != "" {
+			// attempt to create the (default) SCEP signer if the key of the
+			// active issuer is configured.
+			if issuer := a.config.GetActiveIssuer(); issuer != nil && issuer.Key != "" {
 				if options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-					SigningKey: a.config.IntermediateKey,
+					SigningKey: issuer.Key,
 					Password:   a.password,
 				}); err != nil {
 					return err
@@ -724,7 +771,7 @@ func (a *Authority) init() error {
 				_, isRSAKey := options.Signer.Public().(*rsa.PublicKey)
 				if km, ok := a.keyManager.(kmsapi.Decrypter); ok && isRSAKey {
 					if decrypter, err := km.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
-						DecryptionKey: a.config.IntermediateKey,
+						DecryptionKey: issuer.Key,
 						Password:      a.password,
 					}); err == nil {
 						// only pass the decrypter down when it was successfully created,
@@ -883,6 +930,7 @@ func (a *Authority) Shutdown() error {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	closeProvisioners(allProvisioners(a.provisioners))
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
@@ -896,6 +944,7 @@ func (a *Authority) CloseForReload() {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	closeProvisioners(allProvisioners(a.provisioners))
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
@@ -921,6 +970,8 @@ func (a *Authority) IsRevoked(sn string) (bool, error) {
 // requiresSCEP iterates over the configured provisioners
 // and determines if at least one of them is a SCEP provisioner.
 func (a *Authority) requiresSCEP() bool {
+	a.provisionersMutex.RLock()
+	defer a.provisionersMutex.RUnlock()
 	for _, p := range a.config.AuthorityConfig.Provisioners {
 		if p.GetType() == provisioner.TypeSCEP {
 			return true
@@ -932,6 +983,8 @@ func (a *Authority) requiresSCEP() bool {
 // getSCEPProvisionerNames returns the names of the SCEP provisioners
 // that are currently available in the CA.
 func (a *Authority) getSCEPProvisionerNames() (names []string) {
+	a.provisionersMutex.RLock()
+	defer a.provisionersMutex.RUnlock()
 	for _, p := range a.config.AuthorityConfig.Provisioners {
 		if p.GetType() == provisioner.TypeSCEP {
 			names = append(names, p.GetName())
@@ -21,6 +21,7 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
 )
@@ -94,6 +95,124 @@ func testAuthority(t *testing.T, opts ...Option) *Authority {
 	return a
 }
 
+func TestAuthorityNew_issuers(t *testing.T) {
+	load := func(t *testing.T, issuers ...*config.Issuer) *Config {
+		t.Helper()
+		c, err := LoadConfiguration("../ca/testdata/ca.json")
+		assert.FatalError(t, err)
+		c.Root = append(c.Root, "testdata/certs/root_ca.crt")
+		c.IntermediateCert = ""
+		c.IntermediateKey = ""
+		c.AuthorityConfig.Issuers = issuers
+		return c
+	}
+
+	intermediate, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+
+	t.Run("ok", func(t *testing.T) {
+		a, err := New(load(t,
+			&config.Issuer{Certificate: "testdata/certs/intermediate_ca.crt", Key: "testdata/secrets/intermediate_ca_key"},
+			&config.Issuer{Certificate: "../ca/testdata/secrets/intermediate_ca.crt", Key: "../ca/testdata/secrets/intermediate_ca_key", Active: true},
+		))
+		assert.FatalError(t, err)
+		chains := a.issuerX509Chains
+		assert.Len(t, 2, chains)
+		// The active issuer comes first.
+		assert.Equals(t, a.intermediateX509Certs[0], chains[0][0])
+		assert.Equals(t, intermediate, chains[1][0])
+	})
+
+	t.Run("ok/scep", func(t *testing.T) {
+		c := load(t,
+			&config.Issuer{Certificate: "testdata/certs/intermediate_ca.crt", Key: "testdata/secrets/intermediate_ca_key"},
+			&config.Issuer{Certificate: "../ca/testdata/secrets/intermediate_ca.crt", Key: "../ca/testdata/secrets/intermediate_ca_key", Active: true},
+		)
+		c.AuthorityConfig.Provisioners = append(c.AuthorityConfig.Provisioners, &provisioner.SCEP{Name: "scep", Type: "SCEP"})
+		a, err := New(c)
+		assert.FatalError(t, err)
+		// The SCEP signer uses the key of the active issuer.
+		assert.Equals(t, a.intermediateX509Certs[0], a.scepOptions.SignerCert)
+		assert.Equals(t, a.intermediateX509Certs[0].PublicKey, a.scepOptions.Signer.Public())
+	})
+
+	t.Run("fail/not-signed-by-root", func(t *testing.T) {
+		_, err := New(load(t,
+			&config.Issuer{Certificate: "testdata/certs/foo.crt", Key: "testdata/secrets/foo.key"},
+			&config.Issuer{Certificate: "../ca/testdata/secrets/intermediate_ca.crt", Key: "../ca/testdata/secrets/intermediate_ca_key", Active: true},
+		))
+		if assert.Error(t, err) {
+			assert.HasSuffix(t, err.Error(), "is not signed by the root")
+		}
+	})
+
+	t.Run("fail/no-active", func(t *testing.T) {
+		_, err := New(load(t,
+			&config.Issuer{Certificate: "../ca/testdata/secrets/intermediate_ca.crt", Key: "../ca/testdata/secrets/intermediate_ca_key"},
+		))
+		assert.Equals(t, "authority.issuers must have exactly one active issuer", err.Error())
+	})
+}
+
+func TestAuthorityNew_intermediateOnly(t *testing.T) {
+	maxjwk, err := jose.ReadKey("testdata/secrets/max_pub.jwk")
+	assert.FatalError(t, err)
+	load := func(t *testing.T, root string) *Config {
+		t.Helper()
+		return &Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{root},
+			IntermediateCert: "testdata/certs/intermediate_ca.crt",
+			IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+			IntermediateOnly: true,
+			DNSNames:         []string{"example.com"},
+			Password:         "pass",
+			AuthorityConfig: &AuthConfig{
+				Provisioners: provisioner.List{
+					&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+				},
+			},
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		// There is no root key in testdata, the root is only a certificate.
+		a, err := New(load(t, "testdata/certs/root_ca.crt"))
+		assert.FatalError(t, err)
+
+		key, err := keyutil.GenerateDefaultSigner()
+		assert.FatalError(t, err)
+		cr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			DNSNames: []string{"foo.bar.zar"},
+		}, key)
+		assert.FatalError(t, err)
+		csr, err := x509.ParseCertificateRequest(cr)
+		assert.FatalError(t, err)
+
+		chain, err := a.SignWithContext(context.Background(), csr, provisioner.SignOptions{})
+		assert.FatalError(t, err)
+		assert.Len(t, 2, chain)
+		intermediates := x509.NewCertPool()
+		for _, crt := range chain[1:] {
+			intermediates.AddCert(crt)
+		}
+		_, err = chain[0].Verify(x509.VerifyOptions{
+			Roots:         a.rootX509CertPool,
+			Intermediates: intermediates,
+			DNSName:       "foo.bar.zar",
+			CurrentTime:   chain[0].NotBefore,
+		})
+		assert.FatalError(t, err)
+	})
+
+	t.Run("fail/not-signed-by-root", func(t *testing.T) {
+		_, err := New(load(t, "testdata/certs/foo.crt"))
+		if assert.Error(t, err) {
+			assert.HasSuffix(t, err.Error(), "is not signed by the root")
+		}
+	})
+}
+
 func TestAuthorityNew(t *testing.T) {
 	type newTest struct {
 		config *Config
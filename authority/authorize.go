@@ -60,7 +60,7 @@ func (a *Authority) getProvisionerFromToken(token string) (provisioner.Interface
 	}
 
 	// This method will also validate the audiences for JWK provisioners.
-	p, ok := a.provisioners.LoadByToken(tok, &claims.Claims)
+	p, ok := a.getProvisioners().LoadByToken(tok, &claims.Claims)
 	if !ok {
 		return nil, nil, fmt.Errorf("provisioner not found or invalid audience (%s)", strings.Join(claims.Audience, ", "))
 	}
@@ -304,7 +304,7 @@ func (a *Authority) authorizeRenew(ctx context.Context, cert *x509.Certificate)
 		// certificate does not have a provisioner extension. LoadByCertificate
 		// returns the noop provisioner if this happens, and it allows
 		// certificate renewals.
-		if p, ok = a.provisioners.LoadByCertificate(cert); !ok {
+		if p, ok = a.getProvisioners().LoadByCertificate(cert); !ok {
 			return nil, errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
 		}
 	}
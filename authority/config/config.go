@@ -2,15 +2,24 @@ package config
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 
 	kms "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/authority/policy"
@@ -80,14 +89,31 @@ type Config struct {
 	AuthorityConfig  *AuthConfig          `json:"authority,omitempty"`
 	TLS              *TLSOptions          `json:"tls,omitempty"`
 	Password         string               `json:"password,omitempty"`
+	PasswordFile     string               `json:"passwordFile,omitempty"`
+	PasswordCommand  string               `json:"passwordCommand,omitempty"`
 	Templates        *templates.Templates `json:"templates,omitempty"`
 	CommonName       string               `json:"commonName,omitempty"`
 	CRL              *CRLConfig           `json:"crl,omitempty"`
 	MetricsAddress   string               `json:"metricsAddress,omitempty"`
-	SkipValidation   bool                 `json:"-"`
+	ExpandEnv        bool                 `json:"expandEnv,omitempty"`
+	// IntermediateOnly declares that the CA signs with the intermediate and
+	// has no access to the root key. The root is then only a bundle used to
+	// build and verify chains, and the issuers must chain to it.
+	IntermediateOnly bool `json:"intermediateOnly,omitempty"`
+	SkipValidation   bool `json:"-"`
 
 	// Keeps record of the filename the Config is read from
 	loadedFromFilepath string
+
+	// Keeps record of whether the Config was read from a YAML file
+	loadedFromYAML bool
+
+	// Keeps record of the values before the environment variables expansion
+	unexpandedValues []string
+
+	// Keeps record of whether the password was read from the passwordFile or
+	// the passwordCommand
+	passwordResolved bool
 }
 
 // CRLConfig represents config options for CRL generation
@@ -153,6 +179,52 @@ type ASN1DN struct {
 	CommonName         string `json:"commonName,omitempty"`
 }
 
+// ACMENonceOptions configures the store of the ACME anti-replay nonces.
+type ACMENonceOptions struct {
+	// Type is the store of the nonces, "db" to keep them in the database or
+	// "memory" to keep them in memory. A memory store can only be used by a
+	// single CA instance. Defaults to "db".
+	Type string `json:"type,omitempty"`
+	// TTL is the time a nonce can be used after it's created. Defaults to 1
+	// hour.
+	TTL *provisioner.Duration `json:"ttl,omitempty"`
+	// MaxSize is the maximum number of nonces in the store, the oldest ones
+	// are evicted first. Defaults to 100000.
+	MaxSize int `json:"maxSize,omitempty"`
+}
+
+// Validate returns an error if the nonce options are not valid.
+func (o *ACMENonceOptions) Validate() error {
+	switch {
+	case o == nil:
+		return nil
+	case o.Type != "" && o.Type != "db" && o.Type != "memory":
+		return errors.Errorf("authority.acmeNonces type %q is not supported, it must be db or memory", o.Type)
+	case o.TTL != nil && o.TTL.Duration < 0:
+		return errors.New("authority.acmeNonces ttl cannot be negative")
+	case o.MaxSize < 0:
+		return errors.New("authority.acmeNonces maxSize cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// GetTTL returns the TTL of the nonces, 0 if it's not configured.
+func (o *ACMENonceOptions) GetTTL() time.Duration {
+	if o == nil || o.TTL == nil {
+		return 0
+	}
+	return o.TTL.Duration
+}
+
+// GetMaxSize returns the maximum number of nonces, 0 if it's not configured.
+func (o *ACMENonceOptions) GetMaxSize() int {
+	if o == nil {
+		return 0
+	}
+	return o.MaxSize
+}
+
 // AuthConfig represents the configuration options for the authority. An
 // underlaying registration authority can also be configured using the
 // cas.Options.
@@ -169,6 +241,60 @@ type AuthConfig struct {
 	Backdate             *provisioner.Duration `json:"backdate,omitempty"`
 	EnableAdmin          bool                  `json:"enableAdmin,omitempty"`
 	DisableGetSSHHosts   bool                  `json:"disableGetSSHHosts,omitempty"`
+	Issuers              []*Issuer             `json:"issuers,omitempty"`
+	// HTTP01AllowedPorts are the ports, besides 80, that ACME provisioners
+	// can be configured to use to validate http-01 challenges.
+	HTTP01AllowedPorts []int `json:"http01AllowedPorts,omitempty"`
+	// ACMEDrainTimeout is the maximum time the CA waits on shutdown for the
+	// running ACME challenge validations. It defaults to 30 seconds.
+	ACMEDrainTimeout *provisioner.Duration `json:"acmeDrainTimeout,omitempty"`
+	// ACMENonces configures the store of the ACME nonces. By default the
+	// nonces are kept in the database for 1 hour.
+	ACMENonces *ACMENonceOptions `json:"acmeNonces,omitempty"`
+	// UserAgent is the User-Agent of the http-01 validation requests and the
+	// webhook requests. It defaults to the name and version of the CA.
+	UserAgent string `json:"userAgent,omitempty"`
+	// HTTP01Headers are static headers added to the http-01 validation
+	// requests. Headers that change the meaning of the request, like Host or
+	// credentials, are not allowed.
+	HTTP01Headers map[string]string `json:"http01Headers,omitempty"`
+	// WebhookHeaders are static headers added to the webhook requests. The
+	// headers set by the CA, like the signature, cannot be overridden.
+	WebhookHeaders map[string]string `json:"webhookHeaders,omitempty"`
+}
+
+// Issuer is an intermediate certificate and key used by the default RA/CAS.
+// A list of issuers can be configured to rotate the intermediate: the active
+// issuer signs the new certificates, and the other ones are kept to build the
+// chains of the certificates they signed.
+type Issuer struct {
+	Certificate string `json:"crt"`
+	Key         string `json:"key"`
+	Active      bool   `json:"active,omitempty"`
+}
+
+// GetIssuers returns the list of configured issuers. If authority.issuers is
+// not set, it returns the active issuer defined by the crt and key fields.
+func (c *Config) GetIssuers() []*Issuer {
+	if c.AuthorityConfig != nil && len(c.AuthorityConfig.Issuers) > 0 {
+		return c.AuthorityConfig.Issuers
+	}
+	return []*Issuer{{
+		Certificate: c.IntermediateCert,
+		Key:         c.IntermediateKey,
+		Active:      true,
+	}}
+}
+
+// GetActiveIssuer returns the issuer used to sign new certificates, or nil if
+// there is none.
+func (c *Config) GetActiveIssuer() *Issuer {
+	for _, iss := range c.GetIssuers() {
+		if iss.Active {
+			return iss
+		}
+	}
+	return nil
 }
 
 // init initializes the required fields in the AuthConfig if they are not
@@ -211,23 +337,76 @@ func (c *AuthConfig) Validate(provisioner.Audiences) error {
 		return errors.New("authority.backdate cannot be less than 0")
 	}
 
+	for i, port := range c.HTTP01AllowedPorts {
+		if port <= 0 || port > 65535 {
+			return errors.Errorf("authority.http01AllowedPorts[%d] %d is not a valid port", i, port)
+		}
+	}
+
+	if err := c.validateHeaders(); err != nil {
+		return err
+	}
+
+	if err := c.ACMENonces.Validate(); err != nil {
+		return err
+	}
+
+	if len(c.Issuers) > 0 {
+		var active int
+		for i, iss := range c.Issuers {
+			switch {
+			case iss == nil:
+				return errors.Errorf("authority.issuers[%d] cannot be empty", i)
+			case iss.Certificate == "":
+				return errors.Errorf("authority.issuers[%d] crt cannot be empty", i)
+			case iss.Key == "":
+				return errors.Errorf("authority.issuers[%d] key cannot be empty", i)
+			case iss.Active:
+				active++
+			}
+		}
+		if active != 1 {
+			return errors.New("authority.issuers must have exactly one active issuer")
+		}
+	}
+
 	return nil
 }
 
-// LoadConfiguration parses the given filename in JSON format and returns the
-// configuration struct.
+// LoadConfiguration parses the given filename in JSON or YAML format and
+// returns the configuration struct. YAML is used if the file has a .yaml or
+// .yml extension, or if its content doesn't start with a JSON object.
 func LoadConfiguration(filename string) (*Config, error) {
-	f, err := os.Open(filename)
+	b, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error opening %s", filename)
 	}
-	defer f.Close()
 
 	var c Config
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
+	if isYAML(filename, b) {
+		// YAML documents are converted to JSON, so the json tags and the
+		// custom unmarshalers are used in both formats.
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+		c.loadedFromYAML = true
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
 		return nil, errors.Wrapf(err, "error parsing %s", filename)
 	}
 
+	// expand the environment variables if enabled
+	if c.ExpandEnv {
+		if err := c.expandEnv(); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+	}
+
+	// read the password from the passwordFile or the passwordCommand
+	if err := c.resolvePassword(); err != nil {
+		return nil, errors.Wrapf(err, "error loading %s", filename)
+	}
+
 	// store filename that was read to populate Config
 	c.loadedFromFilepath = filename
 
@@ -258,20 +437,211 @@ func (c *Config) Init() {
 	c.AuthorityConfig.init()
 }
 
-// Save saves the configuration to the given filename.
+// envValues returns pointers to the fields that support the expansion of
+// environment variables.
+func (c *Config) envValues() []*string {
+	values := []*string{
+		&c.IntermediateCert, &c.IntermediateKey, &c.Address, &c.InsecureAddress,
+		&c.Password, &c.PasswordFile, &c.PasswordCommand, &c.CommonName,
+		&c.MetricsAddress,
+	}
+	for _, s := range [][]string{c.Root, c.FederatedRoots, c.DNSNames} {
+		for i := range s {
+			values = append(values, &s[i])
+		}
+	}
+	return values
+}
+
+// expandEnv replaces the ${VAR} or $VAR references in the root, federated
+// roots, crt, key, addresses, dnsNames, password and commonName fields with
+// the value of the environment variable. It returns an error if a referenced
+// variable is not set. A literal dollar sign can be written as $$.
+func (c *Config) expandEnv() error {
+	var missing []string
+	mapping := func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	}
+
+	values := c.envValues()
+	unexpanded := make([]string, len(values))
+	for i, v := range values {
+		unexpanded[i] = *v
+		*v = os.Expand(*v, mapping)
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("environment variable %q is not set", missing[0])
+	}
+
+	c.unexpandedValues = unexpanded
+	return nil
+}
+
+// resolvePassword sets the password with the contents of the passwordFile or
+// the output of the passwordCommand. The command is split on white spaces and
+// it's run without a shell. Only one of password, passwordFile and
+// passwordCommand can be set.
+func (c *Config) resolvePassword() error {
+	var n int
+	for _, s := range []string{c.Password, c.PasswordFile, c.PasswordCommand} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one of password, passwordFile or passwordCommand can be set")
+	}
+
+	var b []byte
+	switch {
+	case c.PasswordFile != "":
+		var err error
+		if b, err = os.ReadFile(c.PasswordFile); err != nil {
+			return errors.Wrap(err, "error reading passwordFile")
+		}
+	case c.PasswordCommand != "":
+		args := strings.Fields(c.PasswordCommand)
+		if len(args) == 0 {
+			return errors.New("passwordCommand cannot be empty")
+		}
+		out, err := exec.Command(args[0], args[1:]...).Output() //nolint:gosec // command set by the CA administrator
+		if err != nil {
+			return errors.Wrap(err, "error running passwordCommand")
+		}
+		b = out
+	default:
+		return nil
+	}
+
+	password := strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r")
+	if password == "" {
+		if c.PasswordFile != "" {
+			return errors.New("passwordFile cannot be empty")
+		}
+		return errors.New("passwordCommand returned an empty password")
+	}
+
+	c.Password = password
+	c.passwordResolved = true
+	return nil
+}
+
+// Save saves the configuration to the given filename. If the configuration
+// was loaded with the environment variables expansion enabled, the original
+// references are saved instead of their values. The configuration is saved
+// in YAML if it was loaded from a YAML file or if the filename has a .yaml or
+// .yml extension, otherwise JSON is used. A password read from the
+// passwordFile or the passwordCommand is not saved.
 func (c *Config) Save(filename string) error {
-	var b bytes.Buffer
-	enc := json.NewEncoder(&b)
-	enc.SetIndent("", "\t")
-	if err := enc.Encode(c); err != nil {
-		return fmt.Errorf("error encoding configuration: %w", err)
+	cfg := c
+	if c.unexpandedValues != nil || c.passwordResolved {
+		cc := *c
+		cc.Root = append(multiString(nil), c.Root...)
+		cc.FederatedRoots = append([]string(nil), c.FederatedRoots...)
+		cc.DNSNames = append([]string(nil), c.DNSNames...)
+		if values := cc.envValues(); len(values) == len(c.unexpandedValues) {
+			for i, v := range values {
+				*v = c.unexpandedValues[i]
+			}
+		}
+		// The password read from a file or command is never saved.
+		if c.passwordResolved {
+			cc.Password = ""
+		}
+		cfg = &cc
+	}
+
+	var b []byte
+	if c.loadedFromYAML || hasYAMLExtension(filename) {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("error encoding configuration: %w", err)
+		}
+		if b, err = jsonToYAML(data); err != nil {
+			return fmt.Errorf("error encoding configuration: %w", err)
+		}
+	} else {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(cfg); err != nil {
+			return fmt.Errorf("error encoding configuration: %w", err)
+		}
+		b = buf.Bytes()
 	}
-	if err := os.WriteFile(filename, b.Bytes(), 0600); err != nil {
+	if err := os.WriteFile(filename, b, 0600); err != nil {
 		return fmt.Errorf("error writing %q: %w", filename, err)
 	}
 	return nil
 }
 
+func hasYAMLExtension(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// isYAML returns true if the configuration in b must be decoded as YAML.
+func isYAML(filename string, b []byte) bool {
+	if hasYAMLExtension(filename) {
+		return true
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return false
+	}
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] != '{'
+}
+
+// yamlToJSON converts a YAML document into JSON.
+func yamlToJSON(b []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// jsonToYAML converts a JSON document into YAML, keeping the order of the
+// fields.
+func jsonToYAML(b []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resetYAMLStyle removes the flow and quoted styles inherited from JSON, so
+// the document is written in block style.
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		resetYAMLStyle(n)
+	}
+}
+
 // Commit saves the current configuration to the same
 // file it was initially loaded from.
 //
@@ -311,16 +681,22 @@ func (c *Config) Validate() error {
 
 	// Options holds the RA/CAS configuration.
 	ra := c.AuthorityConfig.Options
-	// The default RA/CAS requires root, crt and key.
+	// The default RA/CAS requires root, crt and key, or a list of issuers.
 	if ra.Is(cas.SoftCAS) {
 		switch {
 		case c.Root.HasEmpties():
 			return errors.New("root cannot be empty")
+		case len(c.AuthorityConfig.Issuers) > 0:
+			if c.IntermediateCert != "" || c.IntermediateKey != "" {
+				return errors.New("crt and key cannot be used with authority.issuers")
+			}
 		case c.IntermediateCert == "":
 			return errors.New("crt cannot be empty")
 		case c.IntermediateKey == "":
 			return errors.New("key cannot be empty")
 		}
+	} else if c.IntermediateOnly {
+		return errors.New("intermediateOnly requires the default RA/CAS")
 	}
 
 	// Validate address (a port is required)
@@ -346,9 +722,25 @@ func (c *Config) Validate() error {
 		if c.TLS.MinVersion == 0 {
 			c.TLS.MinVersion = DefaultTLSOptions.MinVersion
 		}
+		if err := c.TLS.MinVersion.Validate(); err != nil {
+			return errors.Wrap(err, "invalid tls minVersion")
+		}
+		if err := c.TLS.MaxVersion.Validate(); err != nil {
+			return errors.Wrap(err, "invalid tls maxVersion")
+		}
 		if c.TLS.MinVersion > c.TLS.MaxVersion {
 			return errors.New("tls minVersion cannot exceed tls maxVersion")
 		}
+		// Cipher suites are not configurable in TLS 1.3, so they are only
+		// validated if an older version can be negotiated.
+		if c.TLS.MinVersion.Value() < tls.VersionTLS13 {
+			if err := c.TLS.CipherSuites.Validate(); err != nil {
+				return errors.Wrap(err, "invalid tls cipherSuites")
+			}
+		}
+		if err := c.TLS.CurvePreferences.Validate(); err != nil {
+			return errors.Wrap(err, "invalid tls curvePreferences")
+		}
 		c.TLS.Renegotiation = c.TLS.Renegotiation || DefaultTLSOptions.Renegotiation
 	}
 
@@ -380,6 +772,151 @@ func (c *Config) Validate() error {
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
+// ValidateStrict validates the configuration like Validate does, and it also
+// checks the files it references. The root and federated root certificates,
+// and the intermediate certificates, must be readable PEM files. Each
+// intermediate certificate must be signed by one of the roots. If the
+// intermediate key is a file, it must match the intermediate certificate.
+// If a database is configured, the ACME server is enabled and the database
+// must support the operations it requires.
+//
+// These checks read and parse files, and open the database, so they are not
+// part of Validate.
+func (c *Config) ValidateStrict() error {
+	if err := c.Validate(); err != nil || c.SkipValidation {
+		return err
+	}
+
+	roots := make([]*x509.Certificate, 0, len(c.Root))
+	for _, filename := range c.Root {
+		certs, err := pemutil.ReadCertificateBundle(filename)
+		if err != nil {
+			return errors.Wrapf(err, "error reading root %q", filename)
+		}
+		roots = append(roots, certs...)
+	}
+	for _, filename := range c.FederatedRoots {
+		if _, err := pemutil.ReadCertificateBundle(filename); err != nil {
+			return errors.Wrapf(err, "error reading federated root %q", filename)
+		}
+	}
+
+	if err := validateDatabase(c.DB); err != nil {
+		return err
+	}
+
+	// The intermediate certificate and key are only files with the default
+	// RA/CAS.
+	if !c.AuthorityConfig.Options.Is(cas.SoftCAS) {
+		return nil
+	}
+
+	for _, iss := range c.GetIssuers() {
+		if err := c.validateIssuer(iss, roots); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newDatabase opens the database checked by ValidateStrict.
+var newDatabase = db.New
+
+// validateDatabase checks that the configured database supports the
+// operations required by the ACME server.
+func validateDatabase(cfg *db.Config) error {
+	if cfg == nil {
+		return nil
+	}
+	d, err := newDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer d.Shutdown()
+	if err := db.CheckOperations(d, db.ACMEOperations...); err != nil {
+		return errors.Wrapf(err, "db of type %q cannot be used by ACME", cfg.Type)
+	}
+	return nil
+}
+
+// validateIssuer checks that the issuer certificate is signed by one of the
+// roots and that the key matches it.
+func (c *Config) validateIssuer(iss *Issuer, roots []*x509.Certificate) error {
+	chain, err := pemutil.ReadCertificateBundle(iss.Certificate)
+	if err != nil {
+		return errors.Wrapf(err, "error reading crt %q", iss.Certificate)
+	}
+	if err := VerifyIssuerChain(chain, roots); err != nil {
+		return errors.Errorf("crt %q %v", iss.Certificate, err)
+	}
+
+	// Keys in a KMS cannot be read.
+	if c.KMS != nil {
+		if t := kms.Type(strings.ToLower(string(c.KMS.Type))); t != kms.DefaultKMS && t != kms.SoftKMS {
+			return nil
+		}
+	}
+	b, err := os.ReadFile(iss.Key)
+	if err != nil {
+		return errors.Wrapf(err, "error reading key %q", iss.Key)
+	}
+	var opts []pemutil.Options
+	if c.Password != "" {
+		opts = append(opts, pemutil.WithPassword([]byte(c.Password)))
+	} else if isEncryptedPEM(b) {
+		// Without a password, the key will be decrypted at startup.
+		return nil
+	}
+	key, err := pemutil.ParseKey(b, opts...)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing key %q", iss.Key)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return errors.Errorf("key %q is not a private key", iss.Key)
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(chain[0].PublicKey) {
+		return errors.Errorf("key %q does not match crt %q", iss.Key, iss.Certificate)
+	}
+
+	return nil
+}
+
+// VerifyIssuerChain checks that each certificate of the issuer chain is signed
+// by the next one, and that the last one is one of the roots or is signed by
+// one of them. The errors describe the chain, so they can be prefixed with
+// its name.
+func VerifyIssuerChain(chain, roots []*x509.Certificate) error {
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return errors.New("is not a valid certificate chain")
+		}
+	}
+	if !isSignedByAny(chain[len(chain)-1], roots) {
+		return errors.New("is not signed by the root")
+	}
+	return nil
+}
+
+func isSignedByAny(cert *x509.Certificate, roots []*x509.Certificate) bool {
+	for _, root := range roots {
+		if cert.Equal(root) || cert.CheckSignatureFrom(root) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isEncryptedPEM(b []byte) bool {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return false
+	}
+	//nolint:staticcheck // legacy encrypted PEM blocks are still supported
+	return block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+}
+
 // GetAudiences returns the legacy and possible urls without the ports that will
 // be used as the default provisioner audiences. The CA might have proxies in
 // front so we cannot rely on the port.
@@ -1,15 +1,23 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
 	_ "github.com/smallstep/certificates/cas"
+	cas "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
 	"go.step.sm/crypto/jose"
+	kms "go.step.sm/crypto/kms/apiv1"
 )
 
 func TestConfigValidate(t *testing.T) {
@@ -111,6 +119,20 @@ func TestConfigValidate(t *testing.T) {
 				err: errors.New("key cannot be empty"),
 			}
 		},
+		"fail-intermediate-only-cas": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					DNSNames:         []string{"test.smallstep.com"},
+					IntermediateOnly: true,
+					AuthorityConfig: &AuthConfig{
+						Provisioners: ac.Provisioners,
+						Options:      &cas.Options{Type: cas.StepCAS},
+					},
+				},
+				err: errors.New("intermediateOnly requires the default RA/CAS"),
+			}
+		},
 		"empty-dnsNames": func(t *testing.T) ConfigValidateTest {
 			return ConfigValidateTest{
 				config: &Config{
@@ -204,6 +226,147 @@ func TestConfigValidate(t *testing.T) {
 				err: errors.New("tls minVersion cannot exceed tls maxVersion"),
 			}
 		},
+		"tls-1.3": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CipherSuites: CipherSuites{"TLS_BAD_CIPHERSUITE"},
+						MinVersion:   1.3,
+						MaxVersion:   1.3,
+					},
+				},
+				tls: &TLSOptions{
+					CipherSuites: CipherSuites{"TLS_BAD_CIPHERSUITE"},
+					MinVersion:   1.3,
+					MaxVersion:   1.3,
+				},
+			}
+		},
+		"tls-1.2-1.3": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CipherSuites: CipherSuites{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_AES_128_GCM_SHA256"},
+						MinVersion:   1.2,
+						MaxVersion:   1.3,
+					},
+				},
+				tls: &TLSOptions{
+					CipherSuites: CipherSuites{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_AES_128_GCM_SHA256"},
+					MinVersion:   1.2,
+					MaxVersion:   1.3,
+				},
+			}
+		},
+		"fail-tls-cipher-suites": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CipherSuites: CipherSuites{"TLS_BAD_CIPHERSUITE"},
+						MinVersion:   1.2,
+						MaxVersion:   1.3,
+					},
+				},
+				err: errors.New("invalid tls cipherSuites: TLS_BAD_CIPHERSUITE is not a valid cipher suite"),
+			}
+		},
+		"fail-tls-max-version": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						MinVersion: 1.3,
+						MaxVersion: 1.4,
+					},
+				},
+				err: errors.New("invalid tls maxVersion: 1.400000 is not a valid tls version"),
+			}
+		},
+		"fail-tls-min-version": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						MinVersion: 0.9,
+					},
+				},
+				err: errors.New("invalid tls minVersion: 0.900000 is not a valid tls version"),
+			}
+		},
+		"tls-curves": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CurvePreferences:       CurvePreferences{"X25519", "P-256"},
+						SessionTicketsDisabled: true,
+					},
+				},
+				tls: &TLSOptions{
+					CipherSuites:           DefaultTLSCipherSuites,
+					MinVersion:             DefaultTLSMinVersion,
+					MaxVersion:             DefaultTLSMaxVersion,
+					CurvePreferences:       CurvePreferences{"X25519", "P-256"},
+					SessionTicketsDisabled: true,
+				},
+			}
+		},
+		"fail-tls-curves": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CurvePreferences: CurvePreferences{"X25519", "P-224"},
+					},
+				},
+				err: errors.New("invalid tls curvePreferences: P-224 is not a valid curve, valid curves are CurveP256, CurveP384, CurveP521, P-256, P-384, P-521, X25519"),
+			}
+		},
 	}
 
 	for name, get := range tests {
@@ -225,6 +388,474 @@ func TestConfigValidate(t *testing.T) {
 	}
 }
 
+func TestConfig_ValidateStrict(t *testing.T) {
+	maxjwk, err := jose.ReadKey("../testdata/secrets/max_pub.jwk")
+	assert.FatalError(t, err)
+	ac := &AuthConfig{
+		Provisioners: provisioner.List{
+			&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+		},
+	}
+	newConfig := func(fn func(c *Config)) *Config {
+		c := &Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{"../testdata/certs/root_ca.crt"},
+			IntermediateCert: "../testdata/certs/intermediate_ca.crt",
+			IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+			DNSNames:         []string{"test.smallstep.com"},
+			Password:         "pass",
+			AuthorityConfig:  ac,
+		}
+		if fn != nil {
+			fn(c)
+		}
+		return c
+	}
+
+	tests := map[string]struct {
+		config *Config
+		err    string
+	}{
+		"ok":                 {newConfig(nil), ""},
+		"ok/skip-validation": {&Config{SkipValidation: true, Root: []string{"missing.crt"}}, ""},
+		"ok/federated-roots": {newConfig(func(c *Config) {
+			c.FederatedRoots = []string{"../testdata/certs/root_ca.crt"}
+		}), ""},
+		"ok/encrypted-key-no-password": {newConfig(func(c *Config) {
+			c.Password = ""
+		}), ""},
+		"ok/kms": {newConfig(func(c *Config) {
+			c.IntermediateKey = "awskms:key-id=foo"
+			c.KMS = &kms.Options{Type: kms.AmazonKMS}
+		}), ""},
+		"fail/validate": {newConfig(func(c *Config) {
+			c.Address = ""
+		}), "address cannot be empty"},
+		"fail/root": {newConfig(func(c *Config) {
+			c.Root = []string{"../testdata/certs/missing.crt"}
+		}), `error reading root "../testdata/certs/missing.crt"`},
+		"fail/root-not-pem": {newConfig(func(c *Config) {
+			c.Root = []string{"../testdata/secrets/max_pub.jwk"}
+		}), `error reading root "../testdata/secrets/max_pub.jwk"`},
+		"fail/federated-root": {newConfig(func(c *Config) {
+			c.FederatedRoots = []string{"../testdata/certs/missing.crt"}
+		}), `error reading federated root "../testdata/certs/missing.crt"`},
+		"fail/crt": {newConfig(func(c *Config) {
+			c.IntermediateCert = "../testdata/certs/missing.crt"
+		}), `error reading crt "../testdata/certs/missing.crt"`},
+		"fail/crt-not-signed-by-root": {newConfig(func(c *Config) {
+			c.IntermediateCert = "../testdata/certs/foo.crt"
+		}), `crt "../testdata/certs/foo.crt" is not signed by the root`},
+		"fail/key": {newConfig(func(c *Config) {
+			c.IntermediateKey = "../testdata/secrets/missing_key"
+		}), `error reading key "../testdata/secrets/missing_key"`},
+		"fail/key-password": {newConfig(func(c *Config) {
+			c.Password = "bad"
+		}), `error parsing key "../testdata/secrets/intermediate_ca_key"`},
+		"fail/key-mismatch": {newConfig(func(c *Config) {
+			c.IntermediateKey = "../testdata/secrets/foo.key"
+			c.Password = ""
+		}), `key "../testdata/secrets/foo.key" does not match crt "../testdata/certs/intermediate_ca.crt"`},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.config.ValidateStrict()
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+// noCmpAndSwapDB is a database backend without support for CmpAndSwap.
+type noCmpAndSwapDB struct {
+	*db.MockAuthDB
+	*db.MockNoSQLDB
+}
+
+func (noCmpAndSwapDB) SupportsOperation(op db.Operation) bool {
+	return op != db.OperationCmpAndSwap
+}
+
+func TestConfig_ValidateStrict_database(t *testing.T) {
+	maxjwk, err := jose.ReadKey("../testdata/secrets/max_pub.jwk")
+	assert.FatalError(t, err)
+	newConfig := func() *Config {
+		return &Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{"../testdata/certs/root_ca.crt"},
+			IntermediateCert: "../testdata/certs/intermediate_ca.crt",
+			IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+			DNSNames:         []string{"test.smallstep.com"},
+			Password:         "pass",
+			DB:               &db.Config{Type: "mock"},
+			AuthorityConfig: &AuthConfig{
+				Provisioners: provisioner.List{
+					&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+				},
+			},
+		}
+	}
+
+	origNewDatabase := newDatabase
+	t.Cleanup(func() { newDatabase = origNewDatabase })
+
+	tests := map[string]struct {
+		db  db.AuthDB
+		err string
+	}{
+		"ok":                {&db.DB{DB: &db.MockNoSQLDB{}}, ""},
+		"fail/cmp-and-swap": {noCmpAndSwapDB{&db.MockAuthDB{}, &db.MockNoSQLDB{}}, `db of type "mock" cannot be used by ACME: database does not support the CmpAndSwap operation`},
+		"fail/not-nosql":    {&db.MockAuthDB{}, `db of type "mock" cannot be used by ACME: database of type *db.MockAuthDB is not a nosql database`},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			newDatabase = func(*db.Config) (db.AuthDB, error) {
+				return tc.db, nil
+			}
+			err := newConfig().ValidateStrict()
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+		})
+	}
+
+	newDatabase = func(*db.Config) (db.AuthDB, error) {
+		return nil, errors.New("force")
+	}
+	err = newConfig().ValidateStrict()
+	assert.Error(t, err)
+}
+
+func TestConfig_issuers(t *testing.T) {
+	maxjwk, err := jose.ReadKey("../testdata/secrets/max_pub.jwk")
+	assert.FatalError(t, err)
+	newConfig := func(crt, key string, issuers ...*Issuer) *Config {
+		return &Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{"../testdata/certs/root_ca.crt"},
+			IntermediateCert: crt,
+			IntermediateKey:  key,
+			DNSNames:         []string{"test.smallstep.com"},
+			Password:         "pass",
+			AuthorityConfig: &AuthConfig{
+				Provisioners: provisioner.List{
+					&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+				},
+				Issuers: issuers,
+			},
+		}
+	}
+	oldIssuer := &Issuer{Certificate: "../testdata/certs/intermediate_ca.crt", Key: "../testdata/secrets/intermediate_ca_key"}
+	newIssuer := &Issuer{Certificate: "../testdata/certs/intermediate_ca.crt", Key: "../testdata/secrets/intermediate_ca_key", Active: true}
+
+	// Single issuer shorthand.
+	c := newConfig("../testdata/certs/intermediate_ca.crt", "../testdata/secrets/intermediate_ca_key")
+	assert.FatalError(t, c.ValidateStrict())
+	assert.Equals(t, []*Issuer{newIssuer}, c.GetIssuers())
+	assert.Equals(t, newIssuer, c.GetActiveIssuer())
+
+	// List of issuers.
+	c = newConfig("", "", oldIssuer, newIssuer)
+	assert.FatalError(t, c.ValidateStrict())
+	assert.Equals(t, []*Issuer{oldIssuer, newIssuer}, c.GetIssuers())
+	assert.Equals(t, newIssuer, c.GetActiveIssuer())
+
+	tests := map[string]struct {
+		config *Config
+		err    string
+	}{
+		"fail/crt-and-issuers": {newConfig("../testdata/certs/intermediate_ca.crt", "", newIssuer), "crt and key cannot be used with authority.issuers"},
+		"fail/no-active":       {newConfig("", "", oldIssuer), "authority.issuers must have exactly one active issuer"},
+		"fail/two-active":      {newConfig("", "", newIssuer, newIssuer), "authority.issuers must have exactly one active issuer"},
+		"fail/nil":             {newConfig("", "", newIssuer, nil), "authority.issuers[1] cannot be empty"},
+		"fail/empty-crt":       {newConfig("", "", &Issuer{Key: "key"}), "authority.issuers[0] crt cannot be empty"},
+		"fail/empty-key":       {newConfig("", "", &Issuer{Certificate: "crt"}), "authority.issuers[0] key cannot be empty"},
+		"fail/strict":          {newConfig("", "", &Issuer{Certificate: "../testdata/certs/foo.crt", Key: "../testdata/secrets/foo.key"}, newIssuer), `crt "../testdata/certs/foo.crt" is not signed by the root`},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.config.ValidateStrict(); assert.Error(t, err) {
+				assert.Equals(t, tc.err, err.Error())
+			}
+		})
+	}
+	assert.Nil(t, newConfig("", "", oldIssuer).GetActiveIssuer())
+}
+
+func TestLoadConfiguration_expandEnv(t *testing.T) {
+	t.Setenv("TEST_CA_PASSWORD", "pass")
+	t.Setenv("TEST_CA_DIR", "/etc/step")
+	t.Setenv("TEST_CA_PORT", "9000")
+
+	write := func(t *testing.T, v string) string {
+		filename := filepath.Join(t.TempDir(), "ca.json")
+		assert.FatalError(t, os.WriteFile(filename, []byte(v), 0600))
+		return filename
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		filename := write(t, `{
+			"expandEnv": true,
+			"root": "${TEST_CA_DIR}/certs/root_ca.crt",
+			"crt": "$TEST_CA_DIR/certs/intermediate_ca.crt",
+			"key": "${TEST_CA_DIR}/secrets/intermediate_ca_key",
+			"address": ":${TEST_CA_PORT}",
+			"dnsNames": ["ca-${TEST_CA_PORT}.local"],
+			"password": "${TEST_CA_PASSWORD}$$"
+		}`)
+		c, err := LoadConfiguration(filename)
+		assert.FatalError(t, err)
+		assert.Equals(t, multiString{"/etc/step/certs/root_ca.crt"}, c.Root)
+		assert.Equals(t, "/etc/step/certs/intermediate_ca.crt", c.IntermediateCert)
+		assert.Equals(t, "/etc/step/secrets/intermediate_ca_key", c.IntermediateKey)
+		assert.Equals(t, ":9000", c.Address)
+		assert.Equals(t, []string{"ca-9000.local"}, c.DNSNames)
+		assert.Equals(t, "pass$", c.Password)
+
+		// The references are saved instead of the values.
+		assert.FatalError(t, c.Commit())
+		b, err := os.ReadFile(filename)
+		assert.FatalError(t, err)
+		var saved Config
+		assert.FatalError(t, json.Unmarshal(b, &saved))
+		assert.Equals(t, multiString{"${TEST_CA_DIR}/certs/root_ca.crt"}, saved.Root)
+		assert.Equals(t, "${TEST_CA_PASSWORD}$$", saved.Password)
+		assert.Equals(t, []string{"ca-${TEST_CA_PORT}.local"}, saved.DNSNames)
+		assert.Equals(t, "pass$", c.Password)
+	})
+
+	t.Run("ok/disabled", func(t *testing.T) {
+		c, err := LoadConfiguration(write(t, `{"password": "${TEST_CA_PASSWORD}"}`))
+		assert.FatalError(t, err)
+		assert.Equals(t, "${TEST_CA_PASSWORD}", c.Password)
+	})
+
+	t.Run("fail/unset", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, `{"expandEnv": true, "password": "${TEST_CA_UNSET}"}`))
+		if assert.Error(t, err) {
+			assert.HasSuffix(t, err.Error(), `environment variable "TEST_CA_UNSET" is not set`)
+		}
+	})
+}
+
+func TestLoadConfiguration_password(t *testing.T) {
+	dir := t.TempDir()
+	write := func(t *testing.T, name, v string) string {
+		filename := filepath.Join(dir, name)
+		assert.FatalError(t, os.WriteFile(filename, []byte(v), 0600))
+		return filename
+	}
+	passwordFile := write(t, "password.txt", "file-password\r\n")
+	emptyFile := write(t, "empty.txt", "\n")
+	quote := func(s string) string {
+		b, err := json.Marshal(s)
+		assert.FatalError(t, err)
+		return string(b)
+	}
+
+	t.Run("ok/file", func(t *testing.T) {
+		filename := write(t, "ca.json", `{"address": ":9000", "passwordFile": `+quote(passwordFile)+`}`)
+		c, err := LoadConfiguration(filename)
+		assert.FatalError(t, err)
+		assert.Equals(t, "file-password", c.Password)
+
+		// The password is not saved.
+		assert.FatalError(t, c.Commit())
+		b, err := os.ReadFile(filename)
+		assert.FatalError(t, err)
+		var saved Config
+		assert.FatalError(t, json.Unmarshal(b, &saved))
+		assert.Equals(t, "", saved.Password)
+		assert.Equals(t, passwordFile, saved.PasswordFile)
+		assert.Equals(t, "file-password", c.Password)
+	})
+
+	t.Run("ok/command", func(t *testing.T) {
+		c, err := LoadConfiguration(write(t, "ca.json", `{"passwordCommand": "echo  command-password"}`))
+		assert.FatalError(t, err)
+		assert.Equals(t, "command-password", c.Password)
+	})
+
+	t.Run("ok/expandEnv", func(t *testing.T) {
+		t.Setenv("TEST_CA_PASSWORD_FILE", passwordFile)
+		c, err := LoadConfiguration(write(t, "ca.json", `{"expandEnv": true, "passwordFile": "${TEST_CA_PASSWORD_FILE}"}`))
+		assert.FatalError(t, err)
+		assert.Equals(t, "file-password", c.Password)
+	})
+
+	t.Run("fail/multiple", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, "ca.json", `{"password": "pass", "passwordFile": `+quote(passwordFile)+`}`))
+		if assert.Error(t, err) {
+			assert.HasSuffix(t, err.Error(), "only one of password, passwordFile or passwordCommand can be set")
+		}
+	})
+
+	t.Run("fail/missing-file", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, "ca.json", `{"passwordFile": `+quote(filepath.Join(dir, "missing.txt"))+`}`))
+		if assert.Error(t, err) {
+			assert.HasPrefix(t, err.Error(), "error loading "+filepath.Join(dir, "ca.json")+": error reading passwordFile")
+		}
+	})
+
+	t.Run("fail/empty-file", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, "ca.json", `{"passwordFile": `+quote(emptyFile)+`}`))
+		if assert.Error(t, err) {
+			assert.HasSuffix(t, err.Error(), "passwordFile cannot be empty")
+		}
+	})
+
+	t.Run("fail/command", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, "ca.json", `{"passwordCommand": "step-ca-password-command-not-found"}`))
+		if assert.Error(t, err) {
+			assert.True(t, strings.Contains(err.Error(), "error running passwordCommand"))
+		}
+	})
+
+	t.Run("fail/blank-command", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, "ca.json", `{"passwordCommand": "  \t "}`))
+		if assert.Error(t, err) {
+			assert.HasSuffix(t, err.Error(), "passwordCommand cannot be empty")
+		}
+	})
+
+	t.Run("fail/empty-command", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, "ca.json", `{"passwordCommand": "echo"}`))
+		if assert.Error(t, err) {
+			assert.HasSuffix(t, err.Error(), "passwordCommand returned an empty password")
+		}
+	})
+}
+
+func TestLoadConfiguration_yaml(t *testing.T) {
+	jsonConfig := `{
+		"root": ["testdata/root_ca.crt", "testdata/other_ca.crt"],
+		"crt": "testdata/intermediate_ca.crt",
+		"key": "testdata/intermediate_ca_key",
+		"address": ":9000",
+		"dnsNames": ["ca.local", "127.0.0.1"],
+		"password": "1234",
+		"commonName": "true",
+		"logger": {"format":"text"},
+		"db": {"type": "badgerv2", "dataSource": "db"},
+		"tls": {"minVersion": 1.2, "maxVersion": 1.2, "cipherSuites": ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"]},
+		"authority": {
+			"claims": {"minTLSCertDuration": "5m", "maxTLSCertDuration": "24h", "defaultTLSCertDuration": "24h"},
+			"provisioners": [
+				{"type": "ACME", "name": "acme", "forceCN": true, "claims": {"maxTLSCertDuration": "12h"}}
+			]
+		}
+	}`
+	yamlConfig := `
+root:
+  - testdata/root_ca.crt
+  - testdata/other_ca.crt
+crt: testdata/intermediate_ca.crt
+key: testdata/intermediate_ca_key
+address: ":9000"
+dnsNames: [ca.local, 127.0.0.1]
+password: "1234"
+commonName: "true"
+logger:
+  format: text
+db:
+  type: badgerv2
+  dataSource: db
+tls:
+  minVersion: 1.2
+  maxVersion: 1.2
+  cipherSuites:
+    - TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+authority:
+  claims:
+    minTLSCertDuration: 5m
+    maxTLSCertDuration: 24h
+    defaultTLSCertDuration: 24h
+  provisioners:
+    - type: ACME
+      name: acme
+      forceCN: true
+      claims:
+        maxTLSCertDuration: 12h
+`
+	dir := t.TempDir()
+	write := func(t *testing.T, name, v string) string {
+		filename := filepath.Join(dir, name)
+		assert.FatalError(t, os.WriteFile(filename, []byte(v), 0600))
+		return filename
+	}
+	// equal compares two configurations ignoring where they were loaded from.
+	equal := func(t *testing.T, want, got *Config) {
+		t.Helper()
+		w, g := *want, *got
+		w.loadedFromFilepath, g.loadedFromFilepath = "", ""
+		w.loadedFromYAML, g.loadedFromYAML = false, false
+		assert.Equals(t, w, g)
+	}
+
+	want, err := LoadConfiguration(write(t, "ca.json", jsonConfig))
+	assert.FatalError(t, err)
+	assert.False(t, want.loadedFromYAML)
+	assert.Equals(t, 12*time.Hour, want.AuthorityConfig.Provisioners[0].(*provisioner.ACME).Claims.MaxTLSDur.Duration)
+
+	for _, name := range []string{"ca.yaml", "ca.yml", "ca.conf"} {
+		t.Run(name, func(t *testing.T) {
+			got, err := LoadConfiguration(write(t, name, yamlConfig))
+			assert.FatalError(t, err)
+			assert.True(t, got.loadedFromYAML)
+			equal(t, want, got)
+		})
+	}
+
+	t.Run("save", func(t *testing.T) {
+		// A YAML config is saved as YAML.
+		c, err := LoadConfiguration(write(t, "save.yaml", yamlConfig))
+		assert.FatalError(t, err)
+		assert.FatalError(t, c.Commit())
+		b, err := os.ReadFile(c.Filepath())
+		assert.FatalError(t, err)
+		assert.False(t, json.Valid(b))
+		got, err := LoadConfiguration(c.Filepath())
+		assert.FatalError(t, err)
+		equal(t, want, got)
+
+		// A JSON config is saved as JSON.
+		c, err = LoadConfiguration(write(t, "save.json", jsonConfig))
+		assert.FatalError(t, err)
+		assert.FatalError(t, c.Commit())
+		b, err = os.ReadFile(c.Filepath())
+		assert.FatalError(t, err)
+		assert.True(t, json.Valid(b))
+
+		// Unless the filename has a YAML extension.
+		filename := filepath.Join(dir, "copy.yml")
+		assert.FatalError(t, c.Save(filename))
+		b, err = os.ReadFile(filename)
+		assert.FatalError(t, err)
+		assert.False(t, json.Valid(b))
+		got, err = LoadConfiguration(filename)
+		assert.FatalError(t, err)
+		equal(t, want, got)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := LoadConfiguration(write(t, "bad.yaml", "root: [foo"))
+		assert.Error(t, err)
+		_, err = LoadConfiguration(write(t, "bad-type.yaml", "dnsNames: foo"))
+		assert.Error(t, err)
+		_, err = LoadConfiguration(write(t, "bad.json", "root: foo"))
+		assert.Error(t, err)
+	})
+}
+
 func TestAuthConfigValidate(t *testing.T) {
 	asn1dn := ASN1DN{
 		Country:       "Tazmania",
@@ -287,6 +918,54 @@ func TestAuthConfigValidate(t *testing.T) {
 				asn1dn: asn1dn,
 			}
 		},
+		"ok-http01-allowed-ports": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					HTTP01AllowedPorts: []int{8080, 65535},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-http01-allowed-ports": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					HTTP01AllowedPorts: []int{8080, 0},
+				},
+				err: errors.New("authority.http01AllowedPorts[1] 0 is not a valid port"),
+			}
+		},
+		"ok-acme-nonces": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					ACMENonces: &ACMENonceOptions{Type: "memory", TTL: &provisioner.Duration{Duration: time.Minute}, MaxSize: 1000},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-acme-nonces-type": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					ACMENonces: &ACMENonceOptions{Type: "redis"},
+				},
+				err: errors.New(`authority.acmeNonces type "redis" is not supported, it must be db or memory`),
+			}
+		},
+		"fail-acme-nonces-ttl": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					ACMENonces: &ACMENonceOptions{TTL: &provisioner.Duration{Duration: -time.Minute}},
+				},
+				err: errors.New("authority.acmeNonces ttl cannot be negative"),
+			}
+		},
+		"fail-acme-nonces-max-size": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					ACMENonces: &ACMENonceOptions{MaxSize: -1},
+				},
+				err: errors.New("authority.acmeNonces maxSize cannot be negative"),
+			}
+		},
 	}
 
 	for name, get := range tests {
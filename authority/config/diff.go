@@ -0,0 +1,244 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ConfigChangeAction is the kind of change reported by Config.Diff.
+type ConfigChangeAction string
+
+const (
+	// ConfigChangeAdded is the action of a value only present in the new
+	// configuration.
+	ConfigChangeAdded ConfigChangeAction = "added"
+	// ConfigChangeRemoved is the action of a value only present in the old
+	// configuration.
+	ConfigChangeRemoved ConfigChangeAction = "removed"
+	// ConfigChangeChanged is the action of a value present in both
+	// configurations with a different value.
+	ConfigChangeChanged ConfigChangeAction = "changed"
+)
+
+// ConfigChange is a change between two configurations. Path is the location of
+// the value using the JSON names of the fields, e.g. "tls.minVersion".
+// Provisioners are identified by type and name, e.g.
+// "authority.provisioners[JWK/admin].claims.maxTLSCertDuration".
+//
+// The values of sensitive fields, like passwords and secrets, are never
+// included; their changes are reported with the Redacted flag.
+type ConfigChange struct {
+	Path     string             `json:"path"`
+	Action   ConfigChangeAction `json:"action"`
+	Old      any                `json:"old,omitempty"`
+	New      any                `json:"new,omitempty"`
+	Redacted bool               `json:"redacted,omitempty"`
+}
+
+// String returns a one line description of the change, for logging.
+func (c ConfigChange) String() string {
+	switch {
+	case c.Redacted:
+		return fmt.Sprintf("%s %s", c.Path, c.Action)
+	case c.Action == ConfigChangeAdded:
+		return fmt.Sprintf("%s added: %s", c.Path, formatChangeValue(c.New))
+	case c.Action == ConfigChangeRemoved:
+		return fmt.Sprintf("%s removed: %s", c.Path, formatChangeValue(c.Old))
+	default:
+		return fmt.Sprintf("%s changed from %s to %s", c.Path, formatChangeValue(c.Old), formatChangeValue(c.New))
+	}
+}
+
+func formatChangeValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// sensitiveConfigFields are the JSON names of the fields whose values are
+// redacted in the changes. Names are compared in lowercase.
+var sensitiveConfigFields = map[string]bool{
+	"password":             true,
+	"passwordcommand":      true,
+	"encryptedkey":         true,
+	"clientsecret":         true,
+	"keysecret":            true,
+	"secret":               true,
+	"bearertoken":          true,
+	"challenge":            true,
+	"decrypterkeypem":      true,
+	"decrypterkeypassword": true,
+	"pin":                  true,
+	"managementkey":        true,
+	"datasource":           true,
+	"http01headers":        true,
+	"webhookheaders":       true,
+}
+
+func isSensitiveConfigField(name string) bool {
+	return sensitiveConfigFields[strings.ToLower(name)]
+}
+
+// sensitiveURIAttribute matches the attributes of the KMS URIs that contain a
+// PIN or a key, e.g. the pin-value of a pkcs11 URI.
+var sensitiveURIAttribute = regexp.MustCompile(`(?i)[:;?&](pin-value|pin|management-key)=`)
+
+// isSensitiveConfigValue returns true if the value is a URI with a secret
+// attribute, like kms.uri or a key with a pkcs11 pin-value. These values are
+// redacted as a whole.
+func isSensitiveConfigValue(v any) bool {
+	s, ok := v.(string)
+	return ok && sensitiveURIAttribute.MatchString(s)
+}
+
+// Diff returns the changes from the old configuration to c, ordered by the
+// names of the fields. It returns nil if both configurations are equivalent or
+// one of them cannot be encoded.
+func (c *Config) Diff(old *Config) []ConfigChange {
+	oldValue, err := configValue(old)
+	if err != nil {
+		return nil
+	}
+	newValue, err := configValue(c)
+	if err != nil {
+		return nil
+	}
+	var changes []ConfigChange
+	diffConfigValues(&changes, "", false, oldValue, newValue)
+	return changes
+}
+
+// configValue returns the generic JSON representation of the configuration.
+func configValue(c *Config) (any, error) {
+	if c == nil {
+		return map[string]any{}, nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func diffConfigValues(changes *[]ConfigChange, path string, sensitive bool, oldValue, newValue any) {
+	switch {
+	case reflect.DeepEqual(oldValue, newValue):
+		return
+	case sensitive || isSensitiveConfigValue(oldValue) || isSensitiveConfigValue(newValue):
+		action := ConfigChangeChanged
+		if oldValue == nil {
+			action = ConfigChangeAdded
+		} else if newValue == nil {
+			action = ConfigChangeRemoved
+		}
+		*changes = append(*changes, ConfigChange{Path: path, Action: action, Redacted: true})
+		return
+	case oldValue == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Action: ConfigChangeAdded, New: redactConfigValue(newValue)})
+		return
+	case newValue == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Action: ConfigChangeRemoved, Old: redactConfigValue(oldValue)})
+		return
+	}
+
+	oldMap, oldOK := oldValue.(map[string]any)
+	newMap, newOK := newValue.(map[string]any)
+	if oldOK && newOK {
+		for _, key := range unionKeys(oldMap, newMap) {
+			diffConfigValues(changes, joinConfigPath(path, key), isSensitiveConfigField(key), oldMap[key], newMap[key])
+		}
+		return
+	}
+
+	if path == "authority.provisioners" {
+		oldList, oldOK := oldValue.([]any)
+		newList, newOK := newValue.([]any)
+		if oldOK && newOK {
+			oldByID, newByID := provisionersByID(oldList), provisionersByID(newList)
+			for _, id := range unionKeys(oldByID, newByID) {
+				diffConfigValues(changes, path+"["+id+"]", false, oldByID[id], newByID[id])
+			}
+			return
+		}
+	}
+
+	*changes = append(*changes, ConfigChange{
+		Path:   path,
+		Action: ConfigChangeChanged,
+		Old:    redactConfigValue(oldValue),
+		New:    redactConfigValue(newValue),
+	})
+}
+
+// provisionersByID indexes the JSON representation of the provisioners by
+// type and name.
+func provisionersByID(list []any) map[string]any {
+	m := make(map[string]any, len(list))
+	for i, v := range list {
+		p, _ := v.(map[string]any)
+		typ, _ := p["type"].(string)
+		name, _ := p["name"].(string)
+		id := typ + "/" + name
+		if _, ok := m[id]; ok || p == nil {
+			id = fmt.Sprintf("%s#%d", id, i)
+		}
+		m[id] = v
+	}
+	return m
+}
+
+// redactConfigValue returns a copy of the value without the sensitive fields
+// and values.
+func redactConfigValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			if !isSensitiveConfigField(key) && !isSensitiveConfigValue(value) {
+				m[key] = redactConfigValue(value)
+			}
+		}
+		return m
+	case []any:
+		l := make([]any, 0, len(v))
+		for _, value := range v {
+			if !isSensitiveConfigValue(value) {
+				l = append(l, redactConfigValue(value))
+			}
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+func unionKeys(a, b map[string]any) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kms "go.step.sm/crypto/kms/apiv1"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestConfig_Diff(t *testing.T) {
+	newConfig := func(provisioners ...provisioner.Interface) *Config {
+		return &Config{
+			Root:             multiString{"root.crt"},
+			IntermediateCert: "intermediate.crt",
+			IntermediateKey:  "intermediate.key",
+			Address:          ":443",
+			DNSNames:         []string{"ca.example.com"},
+			Password:         "password",
+			TLS: &TLSOptions{
+				CipherSuites: CipherSuites{"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"},
+				MinVersion:   1.2,
+				MaxVersion:   1.3,
+			},
+			AuthorityConfig: &AuthConfig{
+				Provisioners: provisioners,
+				Claims: &provisioner.Claims{
+					MaxTLSDur: &provisioner.Duration{Duration: 24 * time.Hour},
+				},
+			},
+		}
+	}
+	jwk := func(name, encryptedKey string) *provisioner.JWK {
+		return &provisioner.JWK{Type: "JWK", Name: name, EncryptedKey: encryptedKey}
+	}
+
+	t.Run("equal", func(t *testing.T) {
+		old := newConfig(jwk("admin", "key"))
+		assert.Empty(t, newConfig(jwk("admin", "key")).Diff(old))
+	})
+
+	t.Run("provisioners", func(t *testing.T) {
+		old := newConfig(jwk("admin", "key"), jwk("removed", "key"), &provisioner.ACME{Type: "ACME", Name: "acme"})
+		c := newConfig(jwk("admin", "key"), &provisioner.ACME{Type: "ACME", Name: "acme", ForceCN: true}, jwk("added", "secret key"))
+		assert.Equal(t, []ConfigChange{
+			{Path: "authority.provisioners[ACME/acme].forceCN", Action: ConfigChangeAdded, New: true},
+			{Path: "authority.provisioners[JWK/added]", Action: ConfigChangeAdded, New: map[string]any{"type": "JWK", "name": "added", "key": nil}},
+			{Path: "authority.provisioners[JWK/removed]", Action: ConfigChangeRemoved, Old: map[string]any{"type": "JWK", "name": "removed", "key": nil}},
+		}, c.Diff(old))
+	})
+
+	t.Run("provisioner secret", func(t *testing.T) {
+		old := newConfig(jwk("admin", "key"))
+		c := newConfig(jwk("admin", "rotated key"))
+		changes := c.Diff(old)
+		assert.Equal(t, []ConfigChange{
+			{Path: "authority.provisioners[JWK/admin].encryptedKey", Action: ConfigChangeChanged, Redacted: true},
+		}, changes)
+		assert.Equal(t, "authority.provisioners[JWK/admin].encryptedKey changed", changes[0].String())
+	})
+
+	t.Run("password", func(t *testing.T) {
+		old := newConfig()
+		c := newConfig()
+		c.Password = "new password"
+		changes := c.Diff(old)
+		require.Len(t, changes, 1)
+		assert.Equal(t, ConfigChange{Path: "password", Action: ConfigChangeChanged, Redacted: true}, changes[0])
+		assert.Nil(t, changes[0].Old)
+		assert.Nil(t, changes[0].New)
+		assert.Equal(t, "password changed", changes[0].String())
+
+		c.Password = ""
+		assert.Equal(t, []ConfigChange{
+			{Path: "password", Action: ConfigChangeRemoved, Redacted: true},
+		}, c.Diff(old))
+	})
+
+	t.Run("claims and tls", func(t *testing.T) {
+		old := newConfig()
+		c := newConfig()
+		c.AuthorityConfig.Claims.MaxTLSDur = &provisioner.Duration{Duration: 48 * time.Hour}
+		c.AuthorityConfig.Claims.DisableRenewal = new(bool)
+		c.TLS.MinVersion = 1.3
+		c.TLS.CipherSuites = CipherSuites{"TLS_AES_128_GCM_SHA256"}
+		changes := c.Diff(old)
+		assert.Equal(t, []ConfigChange{
+			{Path: "authority.claims.disableRenewal", Action: ConfigChangeAdded, New: false},
+			{Path: "authority.claims.maxTLSCertDuration", Action: ConfigChangeChanged, Old: "24h0m0s", New: "48h0m0s"},
+			{Path: "tls.cipherSuites", Action: ConfigChangeChanged,
+				Old: []any{"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"}, New: []any{"TLS_AES_128_GCM_SHA256"}},
+			{Path: "tls.minVersion", Action: ConfigChangeChanged, Old: 1.2, New: 1.3},
+		}, changes)
+		assert.Equal(t, `authority.claims.maxTLSCertDuration changed from "24h0m0s" to "48h0m0s"`, changes[1].String())
+	})
+
+	t.Run("kms pin", func(t *testing.T) {
+		old := newConfig()
+		old.KMS = &kms.Options{Type: "pkcs11", URI: "pkcs11:module-path=/usr/lib/softhsm.so;token=ca?pin-value=old-pin"}
+		c := newConfig()
+		c.KMS = &kms.Options{Type: "pkcs11", URI: "pkcs11:module-path=/usr/lib/softhsm.so;token=ca?pin-value=new-pin"}
+		c.IntermediateKey = "pkcs11:id=7331;object=intermediate?pin-value=new-pin"
+		changes := c.Diff(old)
+		assert.Equal(t, []ConfigChange{
+			{Path: "key", Action: ConfigChangeChanged, Redacted: true},
+			{Path: "kms.uri", Action: ConfigChangeChanged, Redacted: true},
+		}, changes)
+
+		changes = c.Diff(nil)
+		for _, change := range changes {
+			if change.Path == "kms" {
+				assert.Equal(t, map[string]any{"type": "pkcs11"}, change.New)
+			}
+			assert.NotContains(t, change.String(), "new-pin")
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		changes := newConfig().Diff(nil)
+		assert.NotEmpty(t, changes)
+		for _, change := range changes {
+			assert.Equal(t, ConfigChangeAdded, change.Action)
+			if change.Path == "password" {
+				assert.True(t, change.Redacted)
+				assert.Nil(t, change.New)
+			}
+		}
+	})
+}
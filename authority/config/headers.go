@@ -0,0 +1,116 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/cli-utils/step"
+	"golang.org/x/net/http/httpguts"
+)
+
+// forbiddenHTTP01Headers are the headers that cannot be added to the http-01
+// validation requests. They are set by the HTTP client, or they change the
+// response or leak credentials to the server being validated.
+var forbiddenHTTP01Headers = map[string]bool{
+	"Authorization":       true,
+	"Connection":          true,
+	"Content-Length":      true,
+	"Cookie":              true,
+	"Host":                true,
+	"If-Match":            true,
+	"If-Modified-Since":   true,
+	"If-None-Match":       true,
+	"If-Range":            true,
+	"If-Unmodified-Since": true,
+	"Keep-Alive":          true,
+	"Proxy-Authorization": true,
+	"Range":               true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"User-Agent":          true,
+}
+
+// forbiddenWebhookHeaders are the headers that cannot be added to the webhook
+// requests because they are set by the CA or the HTTP client.
+var forbiddenWebhookHeaders = map[string]bool{
+	"Authorization":     true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Host":              true,
+	"Traceparent":       true,
+	"Tracestate":        true,
+	"Transfer-Encoding": true,
+	"User-Agent":        true,
+	"X-Request-Id":      true,
+}
+
+// GetUserAgent returns the User-Agent of the http-01 validation requests and
+// the webhook requests.
+func (c *AuthConfig) GetUserAgent() string {
+	if c == nil || c.UserAgent == "" {
+		return step.Version()
+	}
+	return c.UserAgent
+}
+
+// GetHTTP01Headers returns the headers of the http-01 validation requests,
+// including the User-Agent.
+func (c *AuthConfig) GetHTTP01Headers() http.Header {
+	var headers map[string]string
+	if c != nil {
+		headers = c.HTTP01Headers
+	}
+	return newHeaders(c.GetUserAgent(), headers)
+}
+
+// GetWebhookHeaders returns the headers of the webhook requests, including the
+// User-Agent.
+func (c *AuthConfig) GetWebhookHeaders() http.Header {
+	var headers map[string]string
+	if c != nil {
+		headers = c.WebhookHeaders
+	}
+	return newHeaders(c.GetUserAgent(), headers)
+}
+
+func newHeaders(userAgent string, headers map[string]string) http.Header {
+	h := make(http.Header, len(headers)+1)
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	h.Set("User-Agent", userAgent)
+	return h
+}
+
+// validateHeaders checks the User-Agent and the static headers.
+func (c *AuthConfig) validateHeaders() error {
+	if !httpguts.ValidHeaderFieldValue(c.UserAgent) {
+		return errors.New("authority.userAgent is not a valid header value")
+	}
+	if err := validateHeaders("authority.http01Headers", c.HTTP01Headers, func(key string) bool {
+		return forbiddenHTTP01Headers[key]
+	}); err != nil {
+		return err
+	}
+	return validateHeaders("authority.webhookHeaders", c.WebhookHeaders, func(key string) bool {
+		return forbiddenWebhookHeaders[key] || strings.HasPrefix(key, "X-Smallstep-")
+	})
+}
+
+func validateHeaders(name string, headers map[string]string, forbidden func(string) bool) error {
+	for k, v := range headers {
+		switch key := http.CanonicalHeaderKey(k); {
+		case !httpguts.ValidHeaderFieldName(k):
+			return errors.Errorf("%s %q is not a valid header name", name, k)
+		case !httpguts.ValidHeaderFieldValue(v):
+			return errors.Errorf("%s %q does not have a valid value", name, k)
+		case forbidden(key):
+			return errors.Errorf("%s %q cannot be configured", name, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.step.sm/cli-utils/step"
+)
+
+func TestAuthConfig_GetHTTP01Headers(t *testing.T) {
+	var c *AuthConfig
+	assert.Equal(t, http.Header{"User-Agent": {step.Version()}}, c.GetHTTP01Headers())
+	assert.Equal(t, http.Header{"User-Agent": {step.Version()}}, c.GetWebhookHeaders())
+
+	c = &AuthConfig{
+		UserAgent:      "my-ca/1.0",
+		HTTP01Headers:  map[string]string{"x-validation": "acme"},
+		WebhookHeaders: map[string]string{"X-Api-Key": "key", "X-Tenant": "tenant1"},
+	}
+	assert.Equal(t, http.Header{
+		"User-Agent":   {"my-ca/1.0"},
+		"X-Validation": {"acme"},
+	}, c.GetHTTP01Headers())
+	assert.Equal(t, http.Header{
+		"User-Agent": {"my-ca/1.0"},
+		"X-Api-Key":  {"key"},
+		"X-Tenant":   {"tenant1"},
+	}, c.GetWebhookHeaders())
+}
+
+func TestAuthConfig_validateHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *AuthConfig
+		wantErr string
+	}{
+		{"ok", &AuthConfig{
+			UserAgent:      "my-ca/1.0",
+			HTTP01Headers:  map[string]string{"X-Validation": "acme"},
+			WebhookHeaders: map[string]string{"X-Api-Key": "key"},
+		}, ""},
+		{"ok/empty", &AuthConfig{}, ""},
+		{"fail/userAgent", &AuthConfig{UserAgent: "my-ca\r\nX-Foo: bar"}, "authority.userAgent is not a valid header value"},
+		{"fail/name", &AuthConfig{HTTP01Headers: map[string]string{"X Validation": "acme"}}, `authority.http01Headers "X Validation" is not a valid header name`},
+		{"fail/value", &AuthConfig{WebhookHeaders: map[string]string{"X-Api-Key": "key\n"}}, `authority.webhookHeaders "X-Api-Key" does not have a valid value`},
+		{"fail/http01-host", &AuthConfig{HTTP01Headers: map[string]string{"host": "example.com"}}, `authority.http01Headers "host" cannot be configured`},
+		{"fail/http01-authorization", &AuthConfig{HTTP01Headers: map[string]string{"Authorization": "Bearer token"}}, `authority.http01Headers "Authorization" cannot be configured`},
+		{"fail/http01-userAgent", &AuthConfig{HTTP01Headers: map[string]string{"User-Agent": "my-ca/1.0"}}, `authority.http01Headers "User-Agent" cannot be configured`},
+		{"fail/webhook-signature", &AuthConfig{WebhookHeaders: map[string]string{"x-smallstep-signature": "sig"}}, `authority.webhookHeaders "x-smallstep-signature" cannot be configured`},
+		{"fail/webhook-content-type", &AuthConfig{WebhookHeaders: map[string]string{"Content-Type": "text/plain"}}, `authority.webhookHeaders "Content-Type" cannot be configured`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateHeaders()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
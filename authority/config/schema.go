@@ -0,0 +1,212 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// jsonSchemaDraft is the JSON Schema dialect used by JSONSchema.
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the strings accepted by time.ParseDuration, the
+// format used by provisioner.Duration.
+const durationPattern = `^[-+]?(0|((\d+(\.\d*)?|\.\d+)(ns|us|µs|μs|ms|s|m|h))+)$`
+
+var (
+	durationType         = reflect.TypeOf(provisioner.Duration{})
+	tlsVersionType       = reflect.TypeOf(TLSVersion(0))
+	cipherSuitesType     = reflect.TypeOf(CipherSuites{})
+	curvePreferencesType = reflect.TypeOf(CurvePreferences{})
+	multiStringType      = reflect.TypeOf(multiString{})
+	rawMessageType       = reflect.TypeOf(json.RawMessage{})
+	provisionerListType  = reflect.TypeOf(provisioner.List{})
+	unmarshalerType      = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// JSONSchema returns a JSON Schema describing the CA configuration file. The
+// schema is generated from the json tags of the Config type and the types it
+// uses, so it's always in sync with the configuration the CA accepts.
+func JSONSchema() ([]byte, error) {
+	g := &schemaGenerator{defs: make(map[string]any)}
+	root := g.schema(reflect.TypeOf(Config{}))
+	s := map[string]any{
+		"$schema": jsonSchemaDraft,
+		"title":   "step-ca configuration",
+		"$ref":    root["$ref"],
+		"$defs":   g.defs,
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// schemaGenerator creates the schemas for Go types. Named structs are added to
+// defs and referenced, so recursive types are supported.
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+// defName returns the name of a struct in the $defs section, e.g.
+// "config.AuthConfig".
+func defName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return pkg + "." + t.Name()
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// Types with a special JSON representation.
+	switch t {
+	case durationType:
+		return map[string]any{
+			"type":        "string",
+			"pattern":     durationPattern,
+			"description": `A duration like "24h", "1h30m" or "300ms".`,
+		}
+	case tlsVersionType:
+		return map[string]any{
+			"type": "number",
+			"enum": sortedKeys(tlsVersions, func(a, b TLSVersion) bool { return a < b }),
+		}
+	case cipherSuitesType:
+		return nullable(map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string", "enum": sortedKeys(cipherSuites, stringLess)},
+		})
+	case curvePreferencesType:
+		return nullable(map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string", "enum": sortedKeys(curves, stringLess)},
+		})
+	case multiStringType:
+		return map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "string"},
+				map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+		}
+	case rawMessageType:
+		return map[string]any{}
+	case provisionerListType:
+		return nullable(map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type":     "object",
+				"required": []any{"type", "name"},
+				"properties": map[string]any{
+					"type": map[string]any{"type": "string"},
+					"name": map[string]any{"type": "string"},
+				},
+			},
+		})
+	}
+
+	// Other types with a custom unmarshaler can have any format.
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded in base64.
+			return map[string]any{"type": "string"}
+		}
+		return nullable(map[string]any{"type": "array", "items": g.schema(t.Elem())})
+	case reflect.Map:
+		return nullable(map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())})
+	case reflect.Struct:
+		name := defName(t)
+		if _, ok := g.defs[name]; !ok {
+			// Reserve the name before visiting the fields.
+			g.defs[name] = nil
+			props := make(map[string]any)
+			g.fields(t, props)
+			g.defs[name] = map[string]any{
+				"type":       "object",
+				"properties": props,
+			}
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	default:
+		// Interfaces accept any value.
+		return map[string]any{}
+	}
+}
+
+// fields adds the properties of the struct t to props. Embedded structs
+// without a json name are inlined like encoding/json does.
+func (g *schemaGenerator) fields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, props)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(","+opts+",", ",string,") {
+			props[name] = map[string]any{"type": "string"}
+			continue
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+// nullable allows the null value on the given schema, encoding/json encodes
+// nil slices and maps as null.
+func nullable(s map[string]any) map[string]any {
+	s["type"] = []any{s["type"], "null"}
+	return s
+}
+
+func stringLess(a, b string) bool { return a < b }
+
+func sortedKeys[K comparable, V any](m map[K]V, less func(a, b K) bool) []any {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		values[i] = k
+	}
+	return values
+}
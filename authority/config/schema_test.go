@@ -0,0 +1,239 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// validateSchema validates v using the subset of JSON Schema generated by
+// JSONSchema.
+func validateSchema(root, s map[string]any, v any, path string) error {
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		def, ok := root["$defs"].(map[string]any)[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: unknown $ref %s", path, ref)
+		}
+		return validateSchema(root, def, v, path)
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		var n int
+		for _, o := range oneOf {
+			if validateSchema(root, o.(map[string]any), v, path) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("%s: %d oneOf schemas match", path, n)
+		}
+		return nil
+	}
+	if typ, ok := s["type"]; ok {
+		types, ok := typ.([]any)
+		if !ok {
+			types = []any{typ}
+		}
+		var match bool
+		for _, t := range types {
+			switch t {
+			case "null":
+				match = match || v == nil
+			case "boolean":
+				_, ok := v.(bool)
+				match = match || ok
+			case "number":
+				_, ok := v.(float64)
+				match = match || ok
+			case "integer":
+				f, ok := v.(float64)
+				match = match || (ok && f == float64(int64(f)))
+			case "string":
+				_, ok := v.(string)
+				match = match || ok
+			case "array":
+				_, ok := v.([]any)
+				match = match || ok
+			case "object":
+				_, ok := v.(map[string]any)
+				match = match || ok
+			}
+		}
+		if !match {
+			return fmt.Errorf("%s: %v is not of type %v", path, v, typ)
+		}
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		var found bool
+		for _, e := range enum {
+			found = found || e == v
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+		}
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		if str, ok := v.(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			return fmt.Errorf("%s: %q does not match %s", path, str, pattern)
+		}
+	}
+	switch vv := v.(type) {
+	case []any:
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range vv {
+				if err := validateSchema(root, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				if _, ok := vv[r.(string)]; !ok {
+					return fmt.Errorf("%s: missing %s", path, r)
+				}
+			}
+		}
+		props, _ := s["properties"].(map[string]any)
+		for k, value := range vv {
+			if p, ok := props[k].(map[string]any); ok {
+				if err := validateSchema(root, p, value, path+"."+k); err != nil {
+					return err
+				}
+			} else if ap, ok := s["additionalProperties"].(map[string]any); ok {
+				if err := validateSchema(root, ap, value, path+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestJSONSchema(t *testing.T) {
+	b, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(b, &schema))
+	assert.Equal(t, jsonSchemaDraft, schema["$schema"])
+	assert.Equal(t, "#/$defs/config.Config", schema["$ref"])
+
+	defs := schema["$defs"].(map[string]any)
+	for _, name := range []string{"config.Config", "config.AuthConfig", "config.TLSOptions", "provisioner.Claims"} {
+		assert.Contains(t, defs, name)
+	}
+
+	// Properties use the json names, and ignored fields are not present.
+	authConfig := defs["config.AuthConfig"].(map[string]any)["properties"].(map[string]any)
+	assert.Contains(t, authConfig, "claims")
+	assert.Contains(t, authConfig, "backdate")
+	assert.NotContains(t, authConfig, "Admins")
+	assert.NotContains(t, authConfig, "admins")
+	// Embedded structs are inlined.
+	assert.Contains(t, authConfig, "type")
+	assert.Contains(t, authConfig, "certificateAuthority")
+
+	claims := defs["provisioner.Claims"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"type":        "string",
+		"pattern":     durationPattern,
+		"description": `A duration like "24h", "1h30m" or "300ms".`,
+	}, claims["maxTLSCertDuration"])
+
+	tlsOptions := defs["config.TLSOptions"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"type": "number",
+		"enum": []any{0.0, 1.0, 1.1, 1.2, 1.3},
+	}, tlsOptions["minVersion"])
+}
+
+func TestJSONSchema_validate(t *testing.T) {
+	jwk, err := jose.ReadKey("../testdata/secrets/max_pub.jwk")
+	require.NoError(t, err)
+
+	b, err := JSONSchema()
+	require.NoError(t, err)
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(b, &schema))
+
+	validate := func(t *testing.T, c *Config) error {
+		t.Helper()
+		b, err := json.Marshal(c)
+		require.NoError(t, err)
+		var v any
+		require.NoError(t, json.Unmarshal(b, &v))
+		return validateSchema(schema, schema, v, "$")
+	}
+
+	newConfig := func() *Config {
+		tlsOptions := DefaultTLSOptions
+		tlsOptions.CurvePreferences = CurvePreferences{"X25519", "P-256"}
+		claims := GlobalProvisionerClaims
+		return &Config{
+			Root:             multiString{"/home/user/.step/certs/root_ca.crt"},
+			IntermediateCert: "/home/user/.step/certs/intermediate_ca.crt",
+			IntermediateKey:  "/home/user/.step/secrets/intermediate_ca_key",
+			Address:          ":443",
+			DNSNames:         []string{"ca.example.com"},
+			Logger:           json.RawMessage(`{"format": "text"}`),
+			DB: &db.Config{
+				Type:       "badgerv2",
+				DataSource: "/home/user/.step/db",
+			},
+			AuthorityConfig: &AuthConfig{
+				Provisioners: provisioner.List{
+					&provisioner.JWK{Name: "Max", Type: "JWK", Key: jwk},
+				},
+				Template: &ASN1DN{},
+				Claims:   &claims,
+				Backdate: &provisioner.Duration{Duration: DefaultBackdate},
+			},
+			TLS: &tlsOptions,
+			CRL: &CRLConfig{
+				Enabled:       true,
+				CacheDuration: DefaultCRLCacheDuration,
+			},
+		}
+	}
+
+	require.NoError(t, validate(t, newConfig()))
+
+	c := newConfig()
+	c.Root = multiString{"root1.crt", "root2.crt"}
+	c.DNSNames = nil
+	c.TLS = nil
+	assert.NoError(t, validate(t, c))
+
+	c = newConfig()
+	c.TLS.MinVersion = 1.5
+	assert.ErrorContains(t, validate(t, c), "$.tls.minVersion: 1.5 is not one of")
+
+	c = newConfig()
+	c.TLS.CipherSuites = CipherSuites{"TLS_FOO_WITH_BAR"}
+	assert.ErrorContains(t, validate(t, c), "$.tls.cipherSuites[0]: TLS_FOO_WITH_BAR is not one of")
+
+	c = newConfig()
+	c.AuthorityConfig.Claims = &provisioner.Claims{MaxTLSDur: &provisioner.Duration{Duration: 90 * 24 * time.Hour}}
+	assert.NoError(t, validate(t, c))
+
+	// Durations must be strings in the time.ParseDuration format.
+	var v map[string]any
+	b, err = json.Marshal(newConfig())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &v))
+	v["authority"].(map[string]any)["backdate"] = "1 minute"
+	assert.ErrorContains(t, validateSchema(schema, schema, v, "$"), `$.authority.backdate: "1 minute" does not match`)
+	v["authority"].(map[string]any)["backdate"] = 60
+	assert.ErrorContains(t, validateSchema(schema, schema, v, "$"), `$.authority.backdate: 60 is not of type string`)
+}
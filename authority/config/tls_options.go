@@ -3,6 +3,8 @@ package config
 import (
 	"crypto/tls"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -151,13 +153,61 @@ var cipherSuites = map[string]uint16{
 	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
 }
 
+// CurvePreferences represents an array of string codes representing the
+// elliptic curves that will be used in an ECDHE handshake, in preference
+// order.
+type CurvePreferences []string
+
+// Validate implements models.Validator and checks that the curves are valid.
+func (c CurvePreferences) Validate() error {
+	for _, s := range c {
+		if _, ok := curves[s]; !ok {
+			names := make([]string, 0, len(curves))
+			for name := range curves {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return errors.Errorf("%s is not a valid curve, valid curves are %s", s, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// Value returns an []tls.CurveID for the curves. It returns nil if no curves
+// are set, so the Go defaults are used.
+func (c CurvePreferences) Value() []tls.CurveID {
+	if len(c) == 0 {
+		return nil
+	}
+	values := make([]tls.CurveID, len(c))
+	for i, s := range c {
+		values[i] = curves[s]
+	}
+	return values
+}
+
+// curves has the list of supported elliptic curves.
+var curves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P-256":  tls.CurveP256,
+	"P-384":  tls.CurveP384,
+	"P-521":  tls.CurveP521,
+
+	// Go names.
+	"CurveP256": tls.CurveP256,
+	"CurveP384": tls.CurveP384,
+	"CurveP521": tls.CurveP521,
+}
+
 // TLSOptions represents the TLS options that can be specified on *tls.Config
 // types to configure HTTPS servers and clients.
 type TLSOptions struct {
-	CipherSuites  CipherSuites `json:"cipherSuites"`
-	MinVersion    TLSVersion   `json:"minVersion"`
-	MaxVersion    TLSVersion   `json:"maxVersion"`
-	Renegotiation bool         `json:"renegotiation"`
+	CipherSuites           CipherSuites     `json:"cipherSuites"`
+	MinVersion             TLSVersion       `json:"minVersion"`
+	MaxVersion             TLSVersion       `json:"maxVersion"`
+	Renegotiation          bool             `json:"renegotiation"`
+	CurvePreferences       CurvePreferences `json:"curvePreferences,omitempty"`
+	SessionTicketsDisabled bool             `json:"sessionTicketsDisabled,omitempty"`
 }
 
 // TLSConfig returns the tls.Config equivalent of the TLSOptions.
@@ -171,9 +221,11 @@ func (t *TLSOptions) TLSConfig() *tls.Config {
 
 	//nolint:gosec // default MinVersion 1.2, if defined but empty 1.3 is used
 	return &tls.Config{
-		CipherSuites:  t.CipherSuites.Value(),
-		MinVersion:    t.MinVersion.Value(),
-		MaxVersion:    t.MaxVersion.Value(),
-		Renegotiation: rs,
+		CipherSuites:           t.CipherSuites.Value(),
+		MinVersion:             t.MinVersion.Value(),
+		MaxVersion:             t.MaxVersion.Value(),
+		Renegotiation:          rs,
+		CurvePreferences:       t.CurvePreferences.Value(),
+		SessionTicketsDisabled: t.SessionTicketsDisabled,
 	}
 }
@@ -128,38 +128,93 @@ func TestCipherSuites_Value(t *testing.T) {
 	}
 }
 
+func TestCurvePreferences_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       CurvePreferences
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"X25519", CurvePreferences{"X25519"}, false},
+		{"P-256", CurvePreferences{"P-256"}, false},
+		{"P-384", CurvePreferences{"P-384"}, false},
+		{"P-521", CurvePreferences{"P-521"}, false},
+		{"CurveP256", CurvePreferences{"CurveP256"}, false},
+		{"multiple", CurvePreferences{"X25519", "P-256", "P-384"}, false},
+		{"fail", CurvePreferences{"X25519", "P-224"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CurvePreferences.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCurvePreferences_Value(t *testing.T) {
+	tests := []struct {
+		name string
+		c    CurvePreferences
+		want []tls.CurveID
+	}{
+		{"empty", nil, nil},
+		{"X25519", CurvePreferences{"X25519"}, []tls.CurveID{tls.X25519}},
+		{"multiple", CurvePreferences{"P-521", "CurveP384", "P-256"}, []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.Value(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CurvePreferences.Value() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestTLSOptions_TLSConfig(t *testing.T) {
 	type fields struct {
-		CipherSuites  CipherSuites
-		MinVersion    TLSVersion
-		MaxVersion    TLSVersion
-		Renegotiation bool
+		CipherSuites           CipherSuites
+		MinVersion             TLSVersion
+		MaxVersion             TLSVersion
+		Renegotiation          bool
+		CurvePreferences       CurvePreferences
+		SessionTicketsDisabled bool
 	}
 	tests := []struct {
 		name   string
 		fields fields
 		want   *tls.Config
 	}{
-		{"default", fields{DefaultTLSCipherSuites, DefaultTLSMinVersion, DefaultTLSMaxVersion, DefaultTLSRenegotiation}, &tls.Config{
+		{"default", fields{DefaultTLSCipherSuites, DefaultTLSMinVersion, DefaultTLSMaxVersion, DefaultTLSRenegotiation, nil, false}, &tls.Config{
 			CipherSuites:  []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
 			MinVersion:    tls.VersionTLS12,
 			MaxVersion:    tls.VersionTLS13,
 			Renegotiation: tls.RenegotiateNever,
 		}},
-		{"renegotation", fields{DefaultTLSCipherSuites, DefaultTLSMinVersion, DefaultTLSMaxVersion, true}, &tls.Config{
+		{"renegotation", fields{DefaultTLSCipherSuites, DefaultTLSMinVersion, DefaultTLSMaxVersion, true, nil, false}, &tls.Config{
 			CipherSuites:  []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
 			MinVersion:    tls.VersionTLS12,
 			MaxVersion:    tls.VersionTLS13,
 			Renegotiation: tls.RenegotiateFreelyAsClient,
 		}},
+		{"curves", fields{DefaultTLSCipherSuites, DefaultTLSMinVersion, DefaultTLSMaxVersion, false, CurvePreferences{"X25519", "P-256"}, true}, &tls.Config{
+			CipherSuites:           []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			MinVersion:             tls.VersionTLS12,
+			MaxVersion:             tls.VersionTLS13,
+			Renegotiation:          tls.RenegotiateNever,
+			CurvePreferences:       []tls.CurveID{tls.X25519, tls.CurveP256},
+			SessionTicketsDisabled: true,
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &TLSOptions{
-				CipherSuites:  tt.fields.CipherSuites,
-				MinVersion:    tt.fields.MinVersion,
-				MaxVersion:    tt.fields.MaxVersion,
-				Renegotiation: tt.fields.Renegotiation,
+				CipherSuites:           tt.fields.CipherSuites,
+				MinVersion:             tt.fields.MinVersion,
+				MaxVersion:             tt.fields.MaxVersion,
+				Renegotiation:          tt.fields.Renegotiation,
+				CurvePreferences:       tt.fields.CurvePreferences,
+				SessionTicketsDisabled: tt.fields.SessionTicketsDisabled,
 			}
 			if got := o.TLSConfig(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("TLSOptions.TLSConfig() = %v, want %v", got, tt.want)
@@ -29,13 +29,19 @@ func (a *Authority) Export() (c *linkedca.Configuration, err error) {
 
 	files := make(map[string][]byte)
 
+	// Only the active issuer can be exported.
+	var crt, key string
+	if issuer := a.config.GetActiveIssuer(); issuer != nil {
+		crt, key = issuer.Certificate, issuer.Key
+	}
+
 	// The exported configuration should not include the password in it.
 	c = &linkedca.Configuration{
 		Version:         "1.0",
 		Root:            mustReadFilesOrURIs(a.config.Root, files),
 		FederatedRoots:  mustReadFilesOrURIs(a.config.FederatedRoots, files),
-		Intermediate:    mustReadFileOrURI(a.config.IntermediateCert, files),
-		IntermediateKey: mustReadFileOrURI(a.config.IntermediateKey, files),
+		Intermediate:    mustReadFileOrURI(crt, files),
+		IntermediateKey: mustReadFileOrURI(key, files),
 		Address:         a.config.Address,
 		InsecureAddress: a.config.InsecureAddress,
 		DnsNames:        a.config.DNSNames,
@@ -128,7 +134,7 @@ func (a *Authority) Export() (c *linkedca.Configuration, err error) {
 	}
 	// admins
 	for {
-		list, cursor := a.admins.Find("", 100)
+		list, cursor := a.getAdmins().Find("", 100)
 		c.Authority.Admins = append(c.Authority.Admins, list...)
 		if cursor == "" {
 			break
@@ -136,7 +142,7 @@ func (a *Authority) Export() (c *linkedca.Configuration, err error) {
 	}
 	// provisioners
 	for {
-		list, cursor := a.provisioners.Find("", 100)
+		list, cursor := a.getProvisioners().Find("", 100)
 		for _, p := range list {
 			lp, err := ProvisionerToLinkedca(p)
 			if err != nil {
@@ -149,7 +155,9 @@ func (a *Authority) Export() (c *linkedca.Configuration, err error) {
 		}
 	}
 	// global claims
+	a.provisionersMutex.RLock()
 	c.Authority.Claims = claimsToLinkedca(a.config.AuthorityConfig.Claims)
+	a.provisionersMutex.RUnlock()
 	// Distinguished names template
 	if v := a.config.AuthorityConfig.Template; v != nil {
 		c.Authority.Template = &linkedca.DistinguishedName{
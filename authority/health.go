@@ -0,0 +1,179 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+)
+
+// DefaultHealthCheckTimeout is the maximum time the health check waits for the
+// signer if no other timeout is configured.
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// HealthStatus is the status returned by the health check.
+type HealthStatus string
+
+const (
+	// HealthStatusServing indicates that the authority can sign certificates.
+	// It's encoded as "ok" to keep the format of the health endpoint.
+	HealthStatusServing HealthStatus = "ok"
+	// HealthStatusKeyUnavailable indicates that the signing key cannot be
+	// used, for example, because the session with the HSM has been lost.
+	HealthStatusKeyUnavailable HealthStatus = "keyUnavailable"
+)
+
+// healthCheckMessage is the message signed by the health check.
+var healthCheckMessage = []byte("step-ca health check")
+
+// healthCheckTTL is the time the result of a health check is reused.
+var healthCheckTTL = 5 * time.Second
+
+// healthResult is the result of the last health check.
+type healthResult struct {
+	err       error
+	checkedAt time.Time
+}
+
+// Health checks that the active X.509 signing key is usable. It signs a
+// message with the key and verifies the signature using the issuer
+// certificate. The check fails if the signer does not respond before the
+// health check timeout.
+//
+// The result of a check is reused for a few seconds, and the concurrent
+// requests share the same check, so there's only one signature in flight even
+// if the signer hangs.
+//
+// Authorities using a CAS without a local signer are always reported as
+// serving.
+func (a *Authority) Health(ctx context.Context) (HealthStatus, error) {
+	fn := a.healthSignerFunc
+	if fn == nil {
+		getter, ok := a.x509CAService.(casapi.CertificateSignerGetter)
+		if !ok {
+			return HealthStatusServing, nil
+		}
+		fn = getter.GetCertificateSigner
+	}
+
+	a.healthMutex.Lock()
+	r := a.healthResult
+	a.healthMutex.Unlock()
+	if r != nil && time.Since(r.checkedAt) < healthCheckTTL {
+		return healthStatus(r.err)
+	}
+
+	timeout := a.healthCheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The signer does not support contexts, the result is discarded if it
+	// doesn't return on time, but it's stored for the next checks.
+	ch := a.healthGroup.DoChan("health", func() (interface{}, error) {
+		err := checkSigner(fn)
+		a.healthMutex.Lock()
+		a.healthResult = &healthResult{err: err, checkedAt: time.Now()}
+		a.healthMutex.Unlock()
+		return nil, err
+	})
+
+	select {
+	case res := <-ch:
+		return healthStatus(res.Err)
+	case <-ctx.Done():
+		return HealthStatusKeyUnavailable, fmt.Errorf("error checking signing key: %w", ctx.Err())
+	}
+}
+
+func healthStatus(err error) (HealthStatus, error) {
+	if err != nil {
+		return HealthStatusKeyUnavailable, err
+	}
+	return HealthStatusServing, nil
+}
+
+// checkSigner signs the health check message with the signer returned by fn
+// and verifies the signature with the first certificate in the chain.
+func checkSigner(fn func() ([]*x509.Certificate, crypto.Signer, error)) error {
+	chain, signer, err := fn()
+	switch {
+	case err != nil:
+		return fmt.Errorf("error getting signing key: %w", err)
+	case len(chain) == 0 || chain[0] == nil:
+		return errors.New("error getting signing key: issuer certificate is missing")
+	case signer == nil:
+		return errors.New("error getting signing key: signer is missing")
+	}
+
+	algo := healthSignatureAlgorithm(signer)
+	digest, opts, err := healthDigest(algo)
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return fmt.Errorf("error signing with signing key: %w", err)
+	}
+	if err := chain[0].CheckSignature(algo, healthCheckMessage, signature); err != nil {
+		return fmt.Errorf("error verifying signature with issuer certificate: %w", err)
+	}
+	return nil
+}
+
+// healthSignatureAlgorithm returns the signature algorithm of the signer.
+func healthSignatureAlgorithm(signer crypto.Signer) x509.SignatureAlgorithm {
+	if sa, ok := signer.(casapi.SignatureAlgorithmGetter); ok {
+		if algo := sa.SignatureAlgorithm(); algo != x509.UnknownSignatureAlgorithm {
+			return algo
+		}
+	}
+	switch signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		return x509.ECDSAWithSHA256
+	case *rsa.PublicKey:
+		return x509.SHA256WithRSA
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	default:
+		return x509.UnknownSignatureAlgorithm
+	}
+}
+
+// healthDigest returns the data to sign and the signer options for the given
+// signature algorithm.
+func healthDigest(algo x509.SignatureAlgorithm) ([]byte, crypto.SignerOpts, error) {
+	var hash crypto.Hash
+	switch algo {
+	case x509.PureEd25519:
+		return healthCheckMessage, crypto.Hash(0), nil
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256, x509.SHA256WithRSAPSS:
+		hash = crypto.SHA256
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		hash = crypto.SHA512
+	default:
+		return nil, nil, fmt.Errorf("error signing with signing key: unsupported signature algorithm %s", algo)
+	}
+
+	h := hash.New()
+	h.Write(healthCheckMessage)
+	digest := h.Sum(nil)
+	switch algo {
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}, nil
+	default:
+		return digest, hash, nil
+	}
+}
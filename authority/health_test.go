@@ -0,0 +1,142 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/pemutil"
+
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+)
+
+// blockingSigner is a signer that never returns.
+type blockingSigner struct {
+	crypto.Signer
+}
+
+func (s blockingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	select {}
+}
+
+// externalCAS is a CAS without a local signer.
+type externalCAS struct {
+	casapi.CertificateAuthorityService
+}
+
+func TestAuthority_Health(t *testing.T) {
+	caPEM, err := os.ReadFile("testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+	crt, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	key, err := pemutil.Read("testdata/secrets/intermediate_ca_key", pemutil.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	signer := key.(crypto.Signer)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	signerFunc := func(chain []*x509.Certificate, s crypto.Signer, err error) func() ([]*x509.Certificate, crypto.Signer, error) {
+		return func() ([]*x509.Certificate, crypto.Signer, error) {
+			return chain, s, err
+		}
+	}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantStatus HealthStatus
+		wantErr    string
+	}{
+		{"ok", []Option{WithX509Signer(crt, signer)}, HealthStatusServing, ""},
+		{"ok/signer-func", []Option{WithX509Signer(crt, signer), WithHealthSignerFunc(signerFunc([]*x509.Certificate{crt}, signer, nil))}, HealthStatusServing, ""},
+		{"ok/external-cas", []Option{WithX509CAService(externalCAS{})}, HealthStatusServing, ""},
+		{"fail/signer-error", []Option{WithX509Signer(crt, signer), WithHealthSignerFunc(signerFunc(nil, nil, errors.New("session closed")))}, HealthStatusKeyUnavailable, "error getting signing key: session closed"},
+		{"fail/no-chain", []Option{WithX509Signer(crt, signer), WithHealthSignerFunc(signerFunc(nil, signer, nil))}, HealthStatusKeyUnavailable, "error getting signing key: issuer certificate is missing"},
+		{"fail/no-signer", []Option{WithX509Signer(crt, signer), WithHealthSignerFunc(signerFunc([]*x509.Certificate{crt}, nil, nil))}, HealthStatusKeyUnavailable, "error getting signing key: signer is missing"},
+		{"fail/wrong-key", []Option{WithX509Signer(crt, otherKey)}, HealthStatusKeyUnavailable, "error verifying signature with issuer certificate"},
+		{"fail/timeout", []Option{WithX509Signer(crt, blockingSigner{signer}), WithHealthCheckTimeout(10 * time.Millisecond)}, HealthStatusKeyUnavailable, "error checking signing key: context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewEmbedded(append([]Option{WithX509RootBundle(caPEM)}, tt.opts...)...)
+			assert.FatalError(t, err)
+
+			status, err := a.Health(context.Background())
+			assert.Equals(t, tt.wantStatus, status)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_Health_shared(t *testing.T) {
+	caPEM, err := os.ReadFile("testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+	crt, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	key, err := pemutil.Read("testdata/secrets/intermediate_ca_key", pemutil.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	signer := key.(crypto.Signer)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	a, err := NewEmbedded(WithX509RootBundle(caPEM), WithX509Signer(crt, signer),
+		WithHealthCheckTimeout(10*time.Millisecond),
+		WithHealthSignerFunc(func() ([]*x509.Certificate, crypto.Signer, error) {
+			calls.Add(1)
+			<-release
+			return []*x509.Certificate{crt}, signer, nil
+		}))
+	assert.FatalError(t, err)
+
+	// The checks waiting for a signer that hangs share the same signature.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := a.Health(context.Background())
+			assert.Equals(t, HealthStatusKeyUnavailable, status)
+			assert.Error(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equals(t, int32(1), calls.Load())
+
+	// The result of the check is reused.
+	close(release)
+	for i := 0; i < 100; i++ {
+		if status, _ := a.Health(context.Background()); status == HealthStatusServing {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	status, err := a.Health(context.Background())
+	assert.NoError(t, err)
+	assert.Equals(t, HealthStatusServing, status)
+	assert.Equals(t, int32(1), calls.Load())
+
+	// Expired results are checked again.
+	defer func(d time.Duration) { healthCheckTTL = d }(healthCheckTTL)
+	healthCheckTTL = 0
+	status, err = a.Health(context.Background())
+	assert.NoError(t, err)
+	assert.Equals(t, HealthStatusServing, status)
+	assert.Equals(t, int32(2), calls.Load())
+}
@@ -0,0 +1,64 @@
+package authority
+
+import (
+	"time"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultMaintenanceRetryAfter is the Retry-After duration reported to the
+// clients if the maintenance mode is enabled without a duration.
+const DefaultMaintenanceRetryAfter = time.Minute
+
+type maintenanceMode struct {
+	retryAfter time.Duration
+}
+
+// SetMaintenanceMode pauses the issuance of new X.509 and SSH certificates.
+// Any new signing, renewal or rekey request will fail with a 503 Service
+// Unavailable error telling the client to retry after the given duration.
+// Operations that have already started will complete, and other endpoints,
+// like the health check, will not be affected.
+//
+// The maintenance mode can be enabled and disabled at runtime, for example
+// with the PUT /admin/maintenance endpoint, and it's kept when the CA
+// configuration is reloaded.
+func (a *Authority) SetMaintenanceMode(retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = DefaultMaintenanceRetryAfter
+	}
+	a.maintenance.Store(&maintenanceMode{
+		retryAfter: retryAfter,
+	})
+}
+
+// ClearMaintenanceMode disables the maintenance mode and resumes the issuance
+// of new certificates.
+func (a *Authority) ClearMaintenanceMode() {
+	a.maintenance.Store(nil)
+}
+
+// IsMaintenanceMode returns true if the issuance of new certificates is
+// paused.
+func (a *Authority) IsMaintenanceMode() bool {
+	return a.maintenance.Load() != nil
+}
+
+// MaintenanceMode returns the Retry-After duration of the maintenance mode and
+// true if the issuance of new certificates is paused.
+func (a *Authority) MaintenanceMode() (time.Duration, bool) {
+	if m := a.maintenance.Load(); m != nil {
+		return m.retryAfter, true
+	}
+	return 0, false
+}
+
+// checkMaintenanceMode returns a 503 error with the Retry-After duration set if
+// the authority is in maintenance mode.
+func (a *Authority) checkMaintenanceMode() error {
+	if m := a.maintenance.Load(); m != nil {
+		return errs.ServiceUnavailable("authority is in maintenance mode",
+			errs.WithRetryAfter(m.retryAfter))
+	}
+	return nil
+}
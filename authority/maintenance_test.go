@@ -0,0 +1,88 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthority_MaintenanceMode(t *testing.T) {
+	caPEM, err := os.ReadFile("testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+	crt, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	key, err := pemutil.Read("testdata/secrets/intermediate_ca_key", pemutil.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	a, err := NewEmbedded(WithX509RootBundle(caPEM), WithX509Signer(crt, key.(crypto.Signer)))
+	assert.FatalError(t, err)
+
+	cr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{"foo.bar.zar"},
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(cr)
+	assert.FatalError(t, err)
+
+	assertMaintenanceError := func(t *testing.T, err error, retryAfter time.Duration) {
+		t.Helper()
+		var e *errs.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equals(t, http.StatusServiceUnavailable, e.StatusCode())
+			assert.Equals(t, retryAfter, e.RetryAfter())
+		}
+		w := httptest.NewRecorder()
+		render.Error(w, err)
+		assert.Equals(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equals(t, "30", w.Header().Get("Retry-After"))
+	}
+
+	// Initially not paused.
+	assert.False(t, a.IsMaintenanceMode())
+	_, ok := a.MaintenanceMode()
+	assert.False(t, ok)
+	_, err = a.SignWithContext(context.Background(), csr, provisioner.SignOptions{})
+	assert.FatalError(t, err)
+
+	// Paused.
+	a.SetMaintenanceMode(30 * time.Second)
+	assert.True(t, a.IsMaintenanceMode())
+	retryAfter, ok := a.MaintenanceMode()
+	assert.True(t, ok)
+	assert.Equals(t, 30*time.Second, retryAfter)
+	_, err = a.SignWithContext(context.Background(), csr, provisioner.SignOptions{})
+	assertMaintenanceError(t, err, 30*time.Second)
+	_, err = a.SignSSH(context.Background(), nil, provisioner.SignSSHOptions{})
+	assertMaintenanceError(t, err, 30*time.Second)
+	_, err = a.RenewContext(context.Background(), crt, nil)
+	assertMaintenanceError(t, err, 30*time.Second)
+
+	// Resumed.
+	a.ClearMaintenanceMode()
+	assert.False(t, a.IsMaintenanceMode())
+	cert, err := a.SignWithContext(context.Background(), csr, provisioner.SignOptions{})
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"foo.bar.zar"}, cert[0].DNSNames)
+
+	// Default retry after.
+	a.SetMaintenanceMode(0)
+	err = a.checkMaintenanceMode()
+	var e *errs.Error
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equals(t, DefaultMaintenanceRetryAfter, e.RetryAfter())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
@@ -215,6 +216,25 @@ func WithX509SignerFunc(fn func() ([]*x509.Certificate, crypto.Signer, error)) O
 	}
 }
 
+// WithHealthSignerFunc defines the function used by the health check to get the
+// issuer chain and the signer to test. By default, the signer of the X.509 CAS
+// is used.
+func WithHealthSignerFunc(fn func() ([]*x509.Certificate, crypto.Signer, error)) Option {
+	return func(a *Authority) error {
+		a.healthSignerFunc = fn
+		return nil
+	}
+}
+
+// WithHealthCheckTimeout defines the maximum time the health check waits for
+// the signer. Defaults to DefaultHealthCheckTimeout.
+func WithHealthCheckTimeout(d time.Duration) Option {
+	return func(a *Authority) error {
+		a.healthCheckTimeout = d
+		return nil
+	}
+}
+
 // WithFullSCEPOptions defines the options used for SCEP support.
 //
 // This feature is EXPERIMENTAL and might change at any time.
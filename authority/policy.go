@@ -143,7 +143,7 @@ func (a *Authority) checkProvisionerPolicy(ctx context.Context, provName string,
 	}
 
 	// get all admins for the provisioner; ignoring case in which they're not found
-	allProvisionerAdmins, _ := a.admins.LoadByProvisioner(provName)
+	allProvisionerAdmins, _ := a.getAdmins().LoadByProvisioner(provName)
 
 	// check the policy; pass in nil as the current admin, as all admins for the
 	// provisioner will be checked by looping through allProvisionerAdmins. Also,
@@ -1,15 +1,31 @@
 package provisioner
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/templates"
+	"github.com/smallstep/certificates/webhook"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 )
 
@@ -76,6 +92,464 @@ func (f ACMEAttestationFormat) Validate() error {
 	}
 }
 
+// ACMEDNSQuorum is the number of authoritative nameservers that must serve
+// the TXT record of a dns-01 challenge.
+type ACMEDNSQuorum string
+
+const (
+	// DNSQuorumAll requires the record on all the authoritative nameservers.
+	DNSQuorumAll ACMEDNSQuorum = "all"
+	// DNSQuorumMajority requires the record on more than half of the
+	// authoritative nameservers.
+	DNSQuorumMajority ACMEDNSQuorum = "majority"
+)
+
+// String returns a normalized version of the quorum.
+func (q ACMEDNSQuorum) String() string {
+	return strings.ToLower(string(q))
+}
+
+// Validate returns an error if the quorum is not a valid one.
+func (q ACMEDNSQuorum) Validate() error {
+	switch ACMEDNSQuorum(q.String()) {
+	case DNSQuorumAll, DNSQuorumMajority:
+		return nil
+	default:
+		return fmt.Errorf("dnsChallengeQuorum %q is not supported", q)
+	}
+}
+
+// Required returns the number of nameservers, of the given total, that must
+// agree to reach the quorum.
+func (q ACMEDNSQuorum) Required(total int) int {
+	if ACMEDNSQuorum(q.String()) == DNSQuorumMajority {
+		return total/2 + 1
+	}
+	return total
+}
+
+// ACMEKeyType is a type of public key allowed in the CSRs of an ACME order.
+// ECDSA keys are specified with the curve, e.g. "EC:P-256", RSA keys with the
+// minimum size in bits, e.g. "RSA:3072", and Ed25519 keys with "OKP:Ed25519".
+type ACMEKeyType string
+
+// parse returns the key type, and the curve or the minimum size of the key.
+func (k ACMEKeyType) parse() (kty, crv string, size int, err error) {
+	kty, param, ok := strings.Cut(string(k), ":")
+	if !ok || param == "" {
+		return "", "", 0, fmt.Errorf("acme key type %q is not valid", k)
+	}
+	switch strings.ToUpper(kty) {
+	case "EC":
+		switch crv = strings.ToUpper(param); crv {
+		case "P-256", "P-384", "P-521":
+			return "EC", crv, 0, nil
+		}
+	case "RSA":
+		if size, err = strconv.Atoi(param); err == nil && size > 0 {
+			return "RSA", "", size, nil
+		}
+	case "OKP":
+		if strings.EqualFold(param, "Ed25519") {
+			return "OKP", "Ed25519", 0, nil
+		}
+	}
+	return "", "", 0, fmt.Errorf("acme key type %q is not supported", k)
+}
+
+// Validate returns an error if the key type is not a valid one.
+func (k ACMEKeyType) Validate() error {
+	_, _, _, err := k.parse()
+	return err
+}
+
+// Allows returns true if the public key is of the key type.
+func (k ACMEKeyType) Allows(pub crypto.PublicKey) bool {
+	kty, crv, size, err := k.parse()
+	if err != nil {
+		return false
+	}
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		return kty == "EC" && pub.Curve != nil && pub.Curve.Params().Name == crv
+	case *rsa.PublicKey:
+		return kty == "RSA" && pub.N != nil && pub.N.BitLen() >= size
+	case ed25519.PublicKey:
+		return kty == "OKP"
+	default:
+		return false
+	}
+}
+
+// ErrACMEContactNotAllowed is returned when the contacts of an ACME account are
+// rejected by the contact policy.
+var ErrACMEContactNotAllowed = errors.New("acme contact is not allowed")
+
+// ACMEContactPolicy restricts the contacts of the ACME accounts created or
+// updated with a provisioner. All contacts are allowed if empty.
+type ACMEContactPolicy struct {
+	// Allow is a list of regular expressions, each contact must match one of
+	// them entirely, e.g. "mailto:.+@example\\.com".
+	Allow []string `json:"allow,omitempty"`
+	// MailtoOnly rejects the contacts with a scheme other than mailto.
+	MailtoOnly bool `json:"mailtoOnly,omitempty"`
+	// Webhook is the name of a NOTIFYING webhook of the provisioner that
+	// receives the contacts of the account, and must allow them.
+	Webhook string `json:"webhook,omitempty"`
+	allow   []*regexp.Regexp
+	webhook *Webhook
+}
+
+// init compiles the allowed contacts and looks up the webhook.
+func (p *ACMEContactPolicy) init(webhooks []*Webhook) error {
+	p.allow = make([]*regexp.Regexp, len(p.Allow))
+	for i, s := range p.Allow {
+		re, err := regexp.Compile("^(?:" + s + ")$")
+		if err != nil {
+			return fmt.Errorf("contactPolicy allow %q is not valid: %w", s, err)
+		}
+		p.allow[i] = re
+	}
+	p.webhook = nil
+	if p.Webhook != "" {
+		for _, wh := range webhooks {
+			if wh.Name == p.Webhook {
+				p.webhook = wh
+				break
+			}
+		}
+		switch {
+		case p.webhook == nil:
+			return fmt.Errorf("contactPolicy webhook %q does not exist", p.Webhook)
+		case p.webhook.Kind != linkedca.Webhook_NOTIFYING.String():
+			return fmt.Errorf("contactPolicy webhook %q must be a NOTIFYING webhook", p.Webhook)
+		}
+	}
+	return nil
+}
+
+// allowed returns an error wrapping ErrACMEContactNotAllowed if the contact is
+// not allowed by the scheme and the regular expressions.
+func (p *ACMEContactPolicy) allowed(contact string) error {
+	if p.MailtoOnly && !strings.HasPrefix(strings.ToLower(contact), "mailto:") {
+		return fmt.Errorf("%w: %q is not a mailto contact", ErrACMEContactNotAllowed, contact)
+	}
+	if len(p.allow) == 0 {
+		return nil
+	}
+	for _, re := range p.allow {
+		if re.MatchString(contact) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrACMEContactNotAllowed, contact)
+}
+
+// ACMEValidationProxy configures an egress proxy used to connect to the
+// clients when the ACME challenges are validated.
+type ACMEValidationProxy struct {
+	// URL is the address of the proxy. The supported schemes are http, https
+	// and socks5.
+	URL string `json:"url"`
+	// Username and Password are the optional credentials used to authenticate
+	// with the proxy. HTTP proxies will use basic authentication.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Validate returns an error if the validation proxy is not a valid one.
+func (p *ACMEValidationProxy) Validate() error {
+	_, err := p.ProxyURL()
+	return err
+}
+
+// ProxyURL returns the parsed proxy URL. If a username is configured, the
+// credentials are added to the user information of the URL.
+func (p *ACMEValidationProxy) ProxyURL() (*url.URL, error) {
+	if p.URL == "" {
+		return nil, errors.New("validationProxy url cannot be empty")
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing validationProxy url %q", p.URL)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("validationProxy url scheme %q is not supported", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("validationProxy url %q is missing the host", p.URL)
+	}
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u, nil
+}
+
+// DefaultACMEValidationDeny are the CIDRs denied by a validation IP filter
+// without a deny list: the private, loopback, link-local and unspecified
+// ranges. The link-local ranges include the 169.254.169.254 address of the
+// cloud metadata services, and the unique local IPv6 range the fd00:ec2::254
+// address of the AWS one.
+var DefaultACMEValidationDeny = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// ACMEValidationIPFilter restricts the IP addresses the CA connects to when it
+// validates the http-01 and tls-alpn-01 challenges. The names of the
+// identifiers are resolved before connecting, and the validation fails if any
+// of the addresses is denied.
+type ACMEValidationIPFilter struct {
+	// Deny is the list of denied CIDRs. Defaults to
+	// DefaultACMEValidationDeny.
+	Deny []string `json:"deny,omitempty"`
+	// Allow is the list of CIDRs allowed even if they are denied, e.g. the
+	// internal networks of the clients of the CA.
+	Allow []string `json:"allow,omitempty"`
+}
+
+// Validate returns an error if the filter is not a valid one.
+func (f *ACMEValidationIPFilter) Validate() error {
+	_, _, err := f.Prefixes()
+	return err
+}
+
+// Prefixes returns the parsed denied and allowed CIDRs.
+func (f *ACMEValidationIPFilter) Prefixes() (deny, allow []netip.Prefix, err error) {
+	denied := f.Deny
+	if len(denied) == 0 {
+		denied = DefaultACMEValidationDeny
+	}
+	if deny, err = parsePrefixes("deny", denied); err != nil {
+		return nil, nil, err
+	}
+	if allow, err = parsePrefixes("allow", f.Allow); err != nil {
+		return nil, nil, err
+	}
+	return deny, allow, nil
+}
+
+func parsePrefixes(name string, cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for i, s := range cidrs {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("validationIPFilter %s %q is not a valid CIDR", name, s)
+		}
+		prefixes[i] = p.Masked()
+	}
+	return prefixes, nil
+}
+
+// ACMEDNSUpdate configures the RFC 2136 dynamic updates, authenticated with a
+// TSIG key, used to write the records of the dns-01 self-test.
+type ACMEDNSUpdate struct {
+	// Server is the host:port of the primary nameserver of the zone.
+	Server string `json:"server"`
+	// Zone is the zone updated, e.g. "example.com".
+	Zone string `json:"zone"`
+	// KeyName is the name of the TSIG key.
+	KeyName string `json:"keyName"`
+	// KeyAlgorithm is the algorithm of the TSIG key, one of hmac-sha1,
+	// hmac-sha256, hmac-sha384 or hmac-sha512. Defaults to hmac-sha256.
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+	// KeySecret is the base64 encoded secret of the TSIG key.
+	KeySecret string `json:"keySecret"`
+}
+
+// GetKeyAlgorithm returns the algorithm of the TSIG key.
+func (u *ACMEDNSUpdate) GetKeyAlgorithm() string {
+	if u.KeyAlgorithm == "" {
+		return "hmac-sha256"
+	}
+	return strings.ToLower(u.KeyAlgorithm)
+}
+
+// Validate returns an error if the dynamic update configuration is not valid.
+func (u *ACMEDNSUpdate) Validate() error {
+	if _, _, err := net.SplitHostPort(u.Server); err != nil {
+		return errors.Wrapf(err, "dnsUpdate server %q is not valid", u.Server)
+	}
+	switch {
+	case u.Zone == "":
+		return errors.New("dnsUpdate zone cannot be empty")
+	case u.KeyName == "":
+		return errors.New("dnsUpdate keyName cannot be empty")
+	case u.KeySecret == "":
+		return errors.New("dnsUpdate keySecret cannot be empty")
+	}
+	if _, err := base64.StdEncoding.DecodeString(u.KeySecret); err != nil {
+		return errors.Wrap(err, "dnsUpdate keySecret is not valid base64")
+	}
+	switch u.GetKeyAlgorithm() {
+	case "hmac-sha1", "hmac-sha256", "hmac-sha384", "hmac-sha512":
+		return nil
+	default:
+		return errors.Errorf("dnsUpdate keyAlgorithm %q is not supported", u.KeyAlgorithm)
+	}
+}
+
+// ACMEValidationConcurrency configures the maximum number of challenge
+// validations of an ACME provisioner that can run at the same time. A limit
+// set to 0 is disabled.
+type ACMEValidationConcurrency struct {
+	// PerAccount is the maximum number of concurrent validations of the
+	// challenges of an account, e.g. the ones of an order with many
+	// identifiers.
+	PerAccount int `json:"perAccount,omitempty"`
+	// Total is the maximum number of concurrent validations of all the
+	// accounts of the provisioner.
+	Total int `json:"total,omitempty"`
+}
+
+// Validate returns an error if the concurrency limits are not valid.
+func (c *ACMEValidationConcurrency) Validate() error {
+	switch {
+	case c.PerAccount < 0:
+		return errors.New("validationConcurrency perAccount cannot be negative")
+	case c.Total < 0:
+		return errors.New("validationConcurrency total cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// MinACMEChallengeTokenLength is the minimum number of random bytes of the
+// ACME challenge tokens, RFC 8555 requires at least 128 bits of entropy.
+const MinACMEChallengeTokenLength = 16
+
+// DefaultACMEMaxIdentifiers is the maximum number of identifiers of an ACME
+// order if the provisioner does not configure one.
+const DefaultACMEMaxIdentifiers = 100
+
+// Default lifetimes of the ACME orders and authorizations if the provisioner
+// does not configure them.
+const (
+	DefaultACMEOrderExpiry = 24 * time.Hour
+	DefaultACMEAuthzExpiry = 24 * time.Hour
+)
+
+// DefaultACMEClockSkew is the tolerance applied to the expiration of the ACME
+// orders and authorizations if the provisioner does not configure it.
+const DefaultACMEClockSkew = time.Minute
+
+// DefaultACMERateLimitWindow is the window of the ACME rate limits if the
+// provisioner does not configure one.
+const DefaultACMERateLimitWindow = time.Hour
+
+// ACMERateLimits configures the rate limits of an ACME provisioner. A limit set
+// to 0 is disabled.
+type ACMERateLimits struct {
+	// OrdersPerIdentifier is the maximum number of orders that can be created
+	// for the same identifier in a window. The pre-authorizations created with
+	// newAuthz count as orders.
+	OrdersPerIdentifier int `json:"ordersPerIdentifier,omitempty"`
+	// FailedValidationsPerAccount is the maximum number of failed challenge
+	// validations of an account in a window. Once it's reached, the account
+	// cannot validate challenges until the window resets.
+	FailedValidationsPerAccount int `json:"failedValidationsPerAccount,omitempty"`
+	// Window is the duration of the rate limit windows. Defaults to 1 hour.
+	Window *Duration `json:"window,omitempty"`
+}
+
+// GetWindow returns the duration of the rate limit windows.
+func (l *ACMERateLimits) GetWindow() time.Duration {
+	if l == nil || l.Window == nil || l.Window.Duration == 0 {
+		return DefaultACMERateLimitWindow
+	}
+	return l.Window.Duration
+}
+
+// Validate returns an error if the rate limits are not valid.
+func (l *ACMERateLimits) Validate() error {
+	switch {
+	case l.OrdersPerIdentifier < 0:
+		return errors.New("rateLimits ordersPerIdentifier cannot be negative")
+	case l.FailedValidationsPerAccount < 0:
+		return errors.New("rateLimits failedValidationsPerAccount cannot be negative")
+	case l.Window != nil && l.Window.Duration < 0:
+		return errors.New("rateLimits window cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// Defaults of the dns-01 TXT lookup retries.
+const (
+	DefaultACMEDNSLookupTimeout    = 5 * time.Second
+	DefaultACMEDNSLookupBackoff    = time.Second
+	DefaultACMEDNSLookupMaxBackoff = 10 * time.Second
+)
+
+// ACMEDNSLookupRetry configures the retries of the TXT lookup of a dns-01
+// validation attempt. Failed lookups are retried with an exponential backoff,
+// and the challenge error is only stored once all attempts fail.
+type ACMEDNSLookupRetry struct {
+	// Attempts is the maximum number of lookups in a validation attempt,
+	// including the first one.
+	Attempts int `json:"attempts"`
+	// Timeout is the deadline of each lookup. Defaults to 5 seconds.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// Backoff is the wait before the first retry, it doubles on each retry.
+	// Defaults to 1 second.
+	Backoff *Duration `json:"backoff,omitempty"`
+	// MaxBackoff is the maximum wait between two lookups. Defaults to 10
+	// seconds.
+	MaxBackoff *Duration `json:"maxBackoff,omitempty"`
+}
+
+// GetTimeout returns the deadline of each lookup.
+func (r *ACMEDNSLookupRetry) GetTimeout() time.Duration {
+	if r == nil || r.Timeout == nil || r.Timeout.Duration == 0 {
+		return DefaultACMEDNSLookupTimeout
+	}
+	return r.Timeout.Duration
+}
+
+// GetBackoff returns the wait before the first retry.
+func (r *ACMEDNSLookupRetry) GetBackoff() time.Duration {
+	if r == nil || r.Backoff == nil || r.Backoff.Duration == 0 {
+		return DefaultACMEDNSLookupBackoff
+	}
+	return r.Backoff.Duration
+}
+
+// GetMaxBackoff returns the maximum wait between two lookups.
+func (r *ACMEDNSLookupRetry) GetMaxBackoff() time.Duration {
+	if r == nil || r.MaxBackoff == nil || r.MaxBackoff.Duration == 0 {
+		return DefaultACMEDNSLookupMaxBackoff
+	}
+	return r.MaxBackoff.Duration
+}
+
+// Validate returns an error if the lookup retries are not valid.
+func (r *ACMEDNSLookupRetry) Validate() error {
+	switch {
+	case r.Attempts < 1:
+		return errors.New("dnsLookupRetry attempts must be greater than 0")
+	case r.Timeout != nil && r.Timeout.Duration < 0:
+		return errors.New("dnsLookupRetry timeout cannot be negative")
+	case r.Backoff != nil && r.Backoff.Duration < 0:
+		return errors.New("dnsLookupRetry backoff cannot be negative")
+	case r.MaxBackoff != nil && r.MaxBackoff.Duration < 0:
+		return errors.New("dnsLookupRetry maxBackoff cannot be negative")
+	case r.GetMaxBackoff() < r.GetBackoff():
+		return errors.New("dnsLookupRetry maxBackoff cannot be lower than backoff")
+	default:
+		return nil
+	}
+}
+
 // ACME is the acme provisioner type, an entity that can authorize the ACME
 // provisioning flow.
 type ACME struct {
@@ -87,6 +561,9 @@ type ACME struct {
 	// TermsOfService contains a URL pointing to the ACME server's
 	// terms of service. Defaults to empty.
 	TermsOfService string `json:"termsOfService,omitempty"`
+	// RequireTermsOfServiceAgreement rejects new accounts that do not agree
+	// to the TermsOfService.
+	RequireTermsOfServiceAgreement bool `json:"requireTermsOfServiceAgreement,omitempty"`
 	// Website contains an URL pointing to more information about
 	// the ACME server. Defaults to empty.
 	Website string `json:"website,omitempty"`
@@ -100,6 +577,17 @@ type ACME struct {
 	// EAB will be verified. If set to false and an EAB is provided, it is
 	// not verified. Defaults to false.
 	RequireEAB bool `json:"requireEAB,omitempty"`
+	// CheckCAA enables the verification of the CAA records of the DNS
+	// identifiers before issuing a certificate. The issuance is refused if the
+	// records exist and none of them authorizes one of the CaaIdentities.
+	// Defaults to false.
+	CheckCAA bool `json:"checkCAA,omitempty"`
+	// EnablePreAuthorization advertises the newAuthz resource in the
+	// directory, so clients can authorize identifiers before creating an
+	// order, as described in RFC 8555 section 7.4.1. New orders reuse the
+	// valid authorizations of the account for the same identifiers. Defaults
+	// to false.
+	EnablePreAuthorization bool `json:"enablePreAuthorization,omitempty"`
 	// Challenges contains the enabled challenges for this provisioner. If this
 	// value is not set the default http-01, dns-01 and tls-alpn-01 challenges
 	// will be enabled, device-attest-01 will be disabled.
@@ -111,10 +599,146 @@ type ACME struct {
 	// AttestationRoots contains a bundle of root certificates in PEM format
 	// that will be used to verify the attestation certificates. If provided,
 	// this bundle will be used even for well-known CAs like Apple and Yubico.
-	AttestationRoots    []byte   `json:"attestationRoots,omitempty"`
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+	// ValidationProxy configures an egress proxy used to validate the
+	// http-01, dns-01 and tls-alpn-01 challenges. If this value is not set,
+	// the challenges will be validated using direct connections.
+	ValidationProxy *ACMEValidationProxy `json:"validationProxy,omitempty"`
+	// ContactPolicy restricts the contacts of the accounts. All contacts are
+	// allowed by default.
+	ContactPolicy *ACMEContactPolicy `json:"contactPolicy,omitempty"`
+	// ValidationSourceAddress is the local IP address used as the source of
+	// the connections that validate the http-01 and tls-alpn-01 challenges.
+	// The address is chosen by the OS if empty.
+	ValidationSourceAddress string `json:"validationSourceAddress,omitempty"`
+	// ValidationNetwork is the network used to connect to the clients to
+	// validate the http-01 and tls-alpn-01 challenges: "tcp4" to only use
+	// IPv4, "tcp6" to only use IPv6, or "tcp" to use both. Defaults to "tcp".
+	ValidationNetwork string `json:"validationNetwork,omitempty"`
+	// ValidationIPFilter restricts the addresses the CA connects to when it
+	// validates the http-01 and tls-alpn-01 challenges, to protect the
+	// internal services from the validation requests. It cannot be used with
+	// a validation proxy, the proxy enforces its own egress policy. All
+	// addresses are allowed by default.
+	ValidationIPFilter *ACMEValidationIPFilter `json:"validationIPFilter,omitempty"`
+	// RenewalHint is the fraction of the lifetime of the certificates after
+	// which the clients are told to renew them, e.g. 0.66. If set, the
+	// finalize and certificate responses include a Renew-After header, so
+	// clients without support for renewal information can renew short-lived
+	// certificates before they expire. It must be between 0 and 1.
+	RenewalHint float64 `json:"renewalHint,omitempty"`
+	// MaxIdentifiers is the maximum number of identifiers of an order. Orders
+	// with more identifiers are rejected before creating any authorization.
+	// With pre-authorization enabled, it's also the maximum number of pending
+	// authorizations of an account when a new one is requested. Defaults to
+	// 100.
+	MaxIdentifiers int `json:"maxIdentifiers,omitempty"`
+	// OrderExpiry is the lifetime of the orders, an order cannot be finalized
+	// after it expires. Orders expire at the latest with their first
+	// authorization. Defaults to 24 hours.
+	OrderExpiry *Duration `json:"orderExpiry,omitempty"`
+	// AuthzExpiry is the lifetime of the authorizations. With
+	// pre-authorization enabled, it's also the time a valid authorization can
+	// be reused by new orders. Defaults to 24 hours.
+	AuthzExpiry *Duration `json:"authzExpiry,omitempty"`
+	// ClockSkew is the tolerance applied when the expiration of orders and
+	// authorizations is compared with the time the challenges were validated,
+	// so small clock drifts between servers don't invalidate them. Defaults
+	// to 1 minute, "0s" disables the tolerance.
+	ClockSkew *Duration `json:"clockSkew,omitempty"`
+	// DNSChallengePrefix is the prefix of the name where clients publish the
+	// TXT records used to validate the dns-01 challenges, e.g. with the value
+	// "_acme-challenge.tenant1" the challenge for "example.com" will be
+	// validated using the records of "_acme-challenge.tenant1.example.com".
+	// Defaults to "_acme-challenge".
+	DNSChallengePrefix string `json:"dnsChallengePrefix,omitempty"`
+	// DNSChallengeName is a template of the name of the TXT records used to
+	// validate the dns-01 challenges, so organizations can publish the
+	// challenges of their subdomains on delegated zones. The template is
+	// rendered with the domain of the challenge, without the wildcard
+	// prefix, in .Domain, and the dns-01 prefix in .Prefix, e.g.
+	// `{{ .Prefix }}.{{ if hasSuffix ".team1.example.com" .Domain }}team1.example.com{{ else }}{{ .Domain }}{{ end }}`.
+	// Defaults to "<prefix>.<domain>".
+	DNSChallengeName string `json:"dnsChallengeName,omitempty"`
+	// DNSChallengeQuorum makes the dns-01 challenges query the TXT records on
+	// all the authoritative nameservers of the zone, instead of the system
+	// resolver, and requires the record on "all" of them or on the
+	// "majority". Disabled by default.
+	DNSChallengeQuorum ACMEDNSQuorum `json:"dnsChallengeQuorum,omitempty"`
+	// ChallengeTokenLength is the number of random bytes of the challenge
+	// tokens, encoded using base64url. It must be at least 16. By default,
+	// tokens are 32 random alphanumeric characters.
+	ChallengeTokenLength int `json:"challengeTokenLength,omitempty"`
+	// DNSUpdate configures the RFC 2136 dynamic updates used by the dns-01
+	// self-test of the admin API to write a test record and check that the CA
+	// can see it. The self-test is disabled if it's not set.
+	DNSUpdate *ACMEDNSUpdate `json:"dnsUpdate,omitempty"`
+	// HTTP01MaxBodySize is the maximum number of bytes read from the response
+	// of an http-01 challenge. Larger responses invalidate the challenge.
+	// Defaults to 64 KiB.
+	HTTP01MaxBodySize int64 `json:"http01MaxBodySize,omitempty"`
+	// HTTP01ExactMatch requires the response of an http-01 challenge to be
+	// exactly the key authorization. By default, leading and trailing
+	// whitespace, like the newline added by some proxies, is ignored.
+	HTTP01ExactMatch bool `json:"http01ExactMatch,omitempty"`
+	// HTTP01Port is the port used to validate the http-01 challenges. Ports
+	// other than 80 must be in the http01AllowedPorts of the authority.
+	// Defaults to 80.
+	HTTP01Port int `json:"http01Port,omitempty"`
+	// TLSALPN01Protocol is the ALPN protocol negotiated to validate the
+	// tls-alpn-01 challenges. It's meant for interoperability testing with
+	// implementations of drafts that use a different protocol id. Defaults to
+	// "acme-tls/1".
+	TLSALPN01Protocol string `json:"tlsALPN01Protocol,omitempty"`
+	// DNSLookupRetry configures the retries of the TXT lookup of the dns-01
+	// challenges within a validation attempt. By default a single lookup is
+	// done.
+	DNSLookupRetry *ACMEDNSLookupRetry `json:"dnsLookupRetry,omitempty"`
+	// DNSPropagationWait is the minimum time between the first request to
+	// validate a dns-01 challenge and the first TXT lookup, so the records
+	// have time to propagate. The challenge is processing in the meantime, and
+	// the responses include a Retry-After header. By default the lookup is
+	// done immediately.
+	DNSPropagationWait *Duration `json:"dnsPropagationWait,omitempty"`
+	// Profiles are the certificate profiles clients can select when they
+	// create an order. Orders without a profile use the claims and options of
+	// the provisioner.
+	Profiles []*ACMEProfile `json:"profiles,omitempty"`
+	// AllowedKeyTypes is the list of public key types allowed in the CSRs of
+	// the orders, e.g. ["EC:P-256", "RSA:3072"]. All the key types are allowed
+	// if empty.
+	AllowedKeyTypes []ACMEKeyType `json:"allowedKeyTypes,omitempty"`
+	// SignatureAlgorithm is the algorithm used to sign the certificates, e.g.
+	// "ECDSA-SHA384". It must be compatible with the key of the issuer. The
+	// default algorithm of the issuer key is used if empty.
+	SignatureAlgorithm x509util.SignatureAlgorithm `json:"signatureAlgorithm,omitempty"`
+	// AlternateChains are bundles of intermediate certificates in PEM format,
+	// issuer first, offered to the clients as alternatives to the chain of the
+	// authority using the "alternate" link relation, see RFC 8555 section
+	// 7.4.2. The first certificate of each bundle must use the key of the
+	// issuer, e.g. a cross-signed intermediate.
+	AlternateChains [][]byte `json:"alternateChains,omitempty"`
+	// IncludeRoot appends the root certificate of the authority to the
+	// certificate chains downloaded by the clients. Alternate chains issued
+	// by other roots are not modified.
+	IncludeRoot bool `json:"includeRoot,omitempty"`
+	// RateLimits configures the limits of orders per identifier and failed
+	// validations per account. Rate limits are disabled by default.
+	RateLimits *ACMERateLimits `json:"rateLimits,omitempty"`
+	// ValidationConcurrency limits the number of challenge validations that
+	// run at the same time, per account and in total. Validations over the
+	// limit wait until a running one finishes. Unbounded by default.
+	ValidationConcurrency *ACMEValidationConcurrency `json:"validationConcurrency,omitempty"`
+	// CompressRecords enables the compression of the large challenges and
+	// orders of the provisioner in the database, as if it was enabled for all
+	// the provisioners in the db configuration.
+	CompressRecords     bool     `json:"compressRecords,omitempty"`
 	Claims              *Claims  `json:"claims,omitempty"`
 	Options             *Options `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
+	dnsChallengeName    *template.Template
+	alternateChains     [][]*x509.Certificate
+	roots               []*x509.Certificate
 	ctl                 *Controller
 }
 
@@ -163,6 +787,201 @@ func (p *ACME) DefaultTLSCertDuration() time.Duration {
 	return p.ctl.Claimer.DefaultTLSCertDuration()
 }
 
+// MinTLSCertDuration returns the minimum TLS cert duration enforced by the
+// provisioner.
+func (p *ACME) MinTLSCertDuration() time.Duration {
+	return p.ctl.Claimer.MinTLSCertDuration()
+}
+
+// MaxTLSCertDuration returns the maximum TLS cert duration enforced by the
+// provisioner.
+func (p *ACME) MaxTLSCertDuration() time.Duration {
+	return p.ctl.Claimer.MaxTLSCertDuration()
+}
+
+// GetClockSkew returns the configured clock skew tolerance,
+// DefaultACMEClockSkew if it's not configured. A skew of 0 disables the
+// tolerance.
+func (p *ACME) GetClockSkew() time.Duration {
+	if p.ClockSkew == nil {
+		return DefaultACMEClockSkew
+	}
+	return p.ClockSkew.Duration
+}
+
+// GetDNSPropagationWait returns the minimum wait before the first TXT lookup of
+// a dns-01 challenge. It returns 0 if it's not configured.
+func (p *ACME) GetDNSPropagationWait() time.Duration {
+	if p.DNSPropagationWait == nil {
+		return 0
+	}
+	return p.DNSPropagationWait.Duration
+}
+
+// GetChallengeTokenLength returns the number of random bytes of the challenge
+// tokens. It returns 0 if it's not configured.
+func (p *ACME) GetChallengeTokenLength() int {
+	return p.ChallengeTokenLength
+}
+
+// GetDNSChallengePrefix returns the configured prefix of the dns-01 challenge
+// records. It returns an empty string if it's not configured.
+func (p *ACME) GetDNSChallengePrefix() string {
+	return p.DNSChallengePrefix
+}
+
+// GetDNSChallengeName returns the name of the TXT records used to validate a
+// dns-01 challenge for the given domain, rendering the dnsChallengeName
+// template. It returns an empty string if the template is not configured.
+func (p *ACME) GetDNSChallengeName(domain, prefix string) (string, error) {
+	if p.dnsChallengeName == nil {
+		return "", nil
+	}
+	buf := new(bytes.Buffer)
+	if err := p.dnsChallengeName.Execute(buf, map[string]string{
+		"Domain": domain,
+		"Prefix": prefix,
+	}); err != nil {
+		return "", fmt.Errorf("error rendering dnsChallengeName: %w", err)
+	}
+	name := strings.TrimSuffix(strings.TrimSpace(buf.String()), ".")
+	if name == "" {
+		return "", fmt.Errorf("dnsChallengeName is empty for domain %q", domain)
+	}
+	return name, nil
+}
+
+// GetDNSChallengeQuorum returns the quorum of authoritative nameservers
+// required on dns-01 challenges. It returns an empty string if it's not
+// configured.
+func (p *ACME) GetDNSChallengeQuorum() ACMEDNSQuorum {
+	return ACMEDNSQuorum(p.DNSChallengeQuorum.String())
+}
+
+// GetHTTP01MaxBodySize returns the maximum size of the http-01 responses. It
+// returns 0 if it's not configured.
+func (p *ACME) GetHTTP01MaxBodySize() int64 {
+	return p.HTTP01MaxBodySize
+}
+
+// GetHTTP01ExactMatch returns whether the response of the http-01 challenges
+// must be exactly the key authorization.
+func (p *ACME) GetHTTP01ExactMatch() bool {
+	return p.HTTP01ExactMatch
+}
+
+// GetHTTP01Port returns the port used to validate the http-01 challenges. It
+// returns 0 if it's not configured.
+func (p *ACME) GetHTTP01Port() int {
+	return p.HTTP01Port
+}
+
+// GetTLSALPN01Protocol returns the ALPN protocol used to validate the
+// tls-alpn-01 challenges. It returns an empty string if it's not configured.
+func (p *ACME) GetTLSALPN01Protocol() string {
+	return p.TLSALPN01Protocol
+}
+
+// GetValidationSourceAddress returns the local IP address used to validate the
+// http-01 and tls-alpn-01 challenges, or nil if not configured.
+func (p *ACME) GetValidationSourceAddress() net.IP {
+	if p.ValidationSourceAddress == "" {
+		return nil
+	}
+	return net.ParseIP(p.ValidationSourceAddress)
+}
+
+// GetMaxIdentifiers returns the maximum number of identifiers of an order,
+// DefaultACMEMaxIdentifiers if it's not configured.
+func (p *ACME) GetMaxIdentifiers() int {
+	if p.MaxIdentifiers == 0 {
+		return DefaultACMEMaxIdentifiers
+	}
+	return p.MaxIdentifiers
+}
+
+// GetOrderExpiry returns the lifetime of the orders, DefaultACMEOrderExpiry if
+// it's not configured.
+func (p *ACME) GetOrderExpiry() time.Duration {
+	if p.OrderExpiry == nil {
+		return DefaultACMEOrderExpiry
+	}
+	return p.OrderExpiry.Duration
+}
+
+// GetAuthzExpiry returns the lifetime of the authorizations,
+// DefaultACMEAuthzExpiry if it's not configured.
+func (p *ACME) GetAuthzExpiry() time.Duration {
+	if p.AuthzExpiry == nil {
+		return DefaultACMEAuthzExpiry
+	}
+	return p.AuthzExpiry.Duration
+}
+
+// GetRenewAfter returns the time after which the given certificate should be
+// renewed, computed using the renewal hint. It returns false if the renewal
+// hint is not configured.
+func (p *ACME) GetRenewAfter(cert *x509.Certificate) (time.Time, bool) {
+	if p.RenewalHint <= 0 || cert == nil {
+		return time.Time{}, false
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return cert.NotBefore.Add(time.Duration(float64(lifetime) * p.RenewalHint)), true
+}
+
+// GetValidationNetwork returns the network used to validate the http-01 and
+// tls-alpn-01 challenges. It defaults to "tcp".
+func (p *ACME) GetValidationNetwork() string {
+	if p.ValidationNetwork == "" {
+		return "tcp"
+	}
+	return p.ValidationNetwork
+}
+
+// GetDNSLookupRetry returns the retries of the dns-01 TXT lookups. It returns
+// nil if they are not configured.
+func (p *ACME) GetDNSLookupRetry() *ACMEDNSLookupRetry {
+	return p.DNSLookupRetry
+}
+
+// GetRateLimits returns the rate limits of the provisioner. It returns nil if
+// they are not configured.
+func (p *ACME) GetRateLimits() *ACMERateLimits {
+	return p.RateLimits
+}
+
+// GetValidationConcurrency returns the limits of concurrent challenge
+// validations. It returns nil if they are not configured.
+func (p *ACME) GetValidationConcurrency() *ACMEValidationConcurrency {
+	return p.ValidationConcurrency
+}
+
+// GetCompressRecords returns whether the challenges and orders of the
+// provisioner are compressed in the database.
+func (p *ACME) GetCompressRecords() bool {
+	return p.CompressRecords
+}
+
+// GetProfile returns the profile with the given name.
+func (p *ACME) GetProfile(name string) (*ACMEProfile, bool) {
+	for _, profile := range p.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+// GetCAACheckIdentities returns the CAA identities that must be authorized by
+// the CAA records of the identifiers. It returns nil if the CAA check is not
+// enabled.
+func (p *ACME) GetCAACheckIdentities() []string {
+	if !p.CheckCAA {
+		return nil
+	}
+	return p.CaaIdentities
+}
+
 // Init initializes and validates the fields of an ACME type.
 func (p *ACME) Init(config Config) (err error) {
 	switch {
@@ -182,6 +1001,112 @@ func (p *ACME) Init(config Config) (err error) {
 			return err
 		}
 	}
+	for _, k := range p.AllowedKeyTypes {
+		if err := k.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.ValidationProxy != nil {
+		if err := p.ValidationProxy.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.ContactPolicy != nil {
+		if err := p.ContactPolicy.init(p.Options.GetWebhooks()); err != nil {
+			return err
+		}
+	}
+	if p.ValidationSourceAddress != "" && net.ParseIP(p.ValidationSourceAddress) == nil {
+		return fmt.Errorf("validationSourceAddress %q is not a valid IP address", p.ValidationSourceAddress)
+	}
+	switch p.ValidationNetwork {
+	case "", "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("validationNetwork %q is not supported, it must be tcp, tcp4 or tcp6", p.ValidationNetwork)
+	}
+	if p.ValidationIPFilter != nil {
+		if p.ValidationProxy != nil {
+			return errors.New("validationIPFilter cannot be used with validationProxy")
+		}
+		if err := p.ValidationIPFilter.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.RenewalHint < 0 || p.RenewalHint >= 1 {
+		return fmt.Errorf("renewalHint %v must be between 0 and 1", p.RenewalHint)
+	}
+	if err := validateSignatureAlgorithm(x509.SignatureAlgorithm(p.SignatureAlgorithm), config.X509IssuerPublicKey); err != nil {
+		return err
+	}
+	if p.MaxIdentifiers < 0 {
+		return errors.New("maxIdentifiers cannot be negative")
+	}
+	if p.OrderExpiry != nil && p.OrderExpiry.Duration <= 0 {
+		return errors.New("orderExpiry must be positive")
+	}
+	if p.AuthzExpiry != nil && p.AuthzExpiry.Duration <= 0 {
+		return errors.New("authzExpiry must be positive")
+	}
+	if p.DNSPropagationWait != nil && p.DNSPropagationWait.Duration < 0 {
+		return errors.New("dnsPropagationWait cannot be negative")
+	}
+	if p.ClockSkew != nil && p.ClockSkew.Duration < 0 {
+		return errors.New("clockSkew cannot be negative")
+	}
+	if p.HTTP01MaxBodySize < 0 {
+		return errors.New("http01MaxBodySize cannot be negative")
+	}
+	if p.HTTP01Port != 0 && p.HTTP01Port != 80 && !slices.Contains(config.HTTP01AllowedPorts, p.HTTP01Port) {
+		return fmt.Errorf("http01Port %d is not an allowed http-01 port", p.HTTP01Port)
+	}
+	// ALPN protocol ids are limited to 255 bytes, see RFC 7301 section 3.1.
+	if len(p.TLSALPN01Protocol) > 255 {
+		return errors.New("tlsALPN01Protocol cannot be longer than 255 bytes")
+	}
+	if p.DNSLookupRetry != nil {
+		if err := p.DNSLookupRetry.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.RateLimits != nil {
+		if err := p.RateLimits.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.ChallengeTokenLength != 0 && p.ChallengeTokenLength < MinACMEChallengeTokenLength {
+		return fmt.Errorf("challengeTokenLength cannot be lower than %d", MinACMEChallengeTokenLength)
+	}
+	if p.DNSUpdate != nil {
+		if err := p.DNSUpdate.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.ValidationConcurrency != nil {
+		if err := p.ValidationConcurrency.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.RequireTermsOfServiceAgreement && p.TermsOfService == "" {
+		return errors.New("requireTermsOfServiceAgreement requires a termsOfService")
+	}
+	if p.CheckCAA && len(p.CaaIdentities) == 0 {
+		return errors.New("checkCAA requires at least one caaIdentities")
+	}
+	if p.DNSChallengePrefix != "" {
+		if err := validateDNSChallengePrefix(p.DNSChallengePrefix); err != nil {
+			return err
+		}
+	}
+	if p.DNSChallengeQuorum != "" {
+		if err := p.DNSChallengeQuorum.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.DNSChallengeName != "" {
+		if p.dnsChallengeName, err = template.New("dnsChallengeName").Funcs(templates.StepFuncMap()).Parse(p.DNSChallengeName); err != nil {
+			return fmt.Errorf("error parsing dnsChallengeName: %w", err)
+		}
+	}
 
 	// Parse attestation roots.
 	// The pool will be nil if there are no roots.
@@ -206,8 +1131,53 @@ func (p *ACME) Init(config Config) (err error) {
 		}
 	}
 
-	p.ctl, err = NewController(p, p.Claims, config, p.Options)
-	return
+	p.alternateChains = nil
+	for i, b := range p.AlternateChains {
+		chain, err := parseAlternateChain(b, config.X509IssuerPublicKey)
+		if err != nil {
+			return fmt.Errorf("error parsing alternateChains[%d]: %w", i, err)
+		}
+		p.alternateChains = append(p.alternateChains, chain)
+	}
+	p.roots = config.X509Roots
+
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(p.Profiles))
+	for _, profile := range p.Profiles {
+		if err := profile.init(p.Claims, p.Options, config.Claims); err != nil {
+			return err
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("acme profile %q is duplicated", profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	return nil
+}
+
+// validateDNSChallengePrefix returns an error if the prefix is not made of
+// valid DNS labels. Labels can start with an underscore, as the default
+// "_acme-challenge" does.
+func validateDNSChallengePrefix(prefix string) error {
+	for _, label := range strings.Split(prefix, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("dnsChallengePrefix %q contains an invalid label", prefix)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("dnsChallengePrefix %q contains an invalid label", prefix)
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return fmt.Errorf("dnsChallengePrefix %q contains an invalid label", prefix)
+			}
+		}
+	}
+	return nil
 }
 
 // ACMEIdentifierType encodes ACME Identifier types
@@ -250,26 +1220,123 @@ func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdenti
 	return err
 }
 
+// AuthorizeCSRKey verifies the public key of an order CSR is one of the allowed
+// key types of the provisioner.
+func (p *ACME) AuthorizeCSRKey(_ context.Context, pub crypto.PublicKey) error {
+	if len(p.AllowedKeyTypes) == 0 {
+		return nil
+	}
+	for _, k := range p.AllowedKeyTypes {
+		if k.Allows(pub) {
+			return nil
+		}
+	}
+	return fmt.Errorf("public key type is not allowed, allowed key types are %v", p.AllowedKeyTypes)
+}
+
+// AuthorizeContacts verifies the contacts of an ACME account are allowed by the
+// contact policy of the provisioner. Contacts that are not allowed return an
+// error wrapping ErrACMEContactNotAllowed.
+func (p *ACME) AuthorizeContacts(ctx context.Context, contacts []string) error {
+	cp := p.ContactPolicy
+	if cp == nil || len(contacts) == 0 {
+		return nil
+	}
+	for _, c := range contacts {
+		if err := cp.allowed(c); err != nil {
+			return err
+		}
+	}
+	if cp.webhook == nil {
+		return nil
+	}
+
+	client := http.DefaultClient
+	if p.ctl != nil && p.ctl.webhookClient != nil {
+		client = p.ctl.webhookClient
+	}
+	ctx, cancel := context.WithTimeout(ctx, cp.webhook.timeout())
+	defer cancel()
+	resp, err := cp.webhook.DoWithContext(ctx, client, &webhook.RequestBody{
+		ProvisionerName: p.Name,
+		ACMEContacts:    contacts,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed executing contact webhook %q: %w", cp.webhook.Name, err)
+	}
+	if !resp.Allow {
+		return fmt.Errorf("%w: contacts were denied by webhook %q", ErrACMEContactNotAllowed, cp.webhook.Name)
+	}
+	return nil
+}
+
 // AuthorizeSign does not do any validation, because all validation is handled
 // in the ACME protocol. This method returns a list of modifiers / constraints
-// on the resulting certificate.
-func (p *ACME) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+// on the resulting certificate. If the context has an ACME profile, the
+// durations of the profile are used.
+func (p *ACME) AuthorizeSign(ctx context.Context, _ string) ([]SignOption, error) {
+	claimer := p.ctl.Claimer
+	if name, ok := ACMEProfileFromContext(ctx); ok {
+		profile, ok := p.GetProfile(name)
+		if !ok {
+			return nil, fmt.Errorf("acme profile %q is not supported", name)
+		}
+		claimer = profile.claimer
+	}
+
 	opts := []SignOption{
 		p,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeACME, p.Name, "").WithControllerOptions(p.ctl),
 		newForceCNOption(p.ForceCN),
-		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		profileDefaultDuration(claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newValidityValidator(claimer.MinTLSCertDuration(), claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(nil, linkedca.Webhook_X509),
 	}
+	if p.SignatureAlgorithm != 0 {
+		opts = append(opts, newSignatureAlgorithmModifier(x509.SignatureAlgorithm(p.SignatureAlgorithm)))
+	}
 
 	return opts, nil
 }
 
+// newSignatureAlgorithmModifier returns a modifier that sets the signature
+// algorithm of the certificate.
+func newSignatureAlgorithmModifier(alg x509.SignatureAlgorithm) CertificateModifierFunc {
+	return func(cert *x509.Certificate, _ SignOptions) error {
+		cert.SignatureAlgorithm = alg
+		return nil
+	}
+}
+
+// validateSignatureAlgorithm returns an error if the given signature algorithm
+// cannot be used to sign certificates with the given issuer key. Only the
+// algorithms with SHA-2 hashes and Ed25519 are supported. The key type is not
+// checked if the issuer key is unknown.
+func validateSignatureAlgorithm(alg x509.SignatureAlgorithm, issuerKey crypto.PublicKey) error {
+	var ok bool
+	switch alg {
+	case x509.UnknownSignatureAlgorithm:
+		return nil
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		_, ok = issuerKey.(*rsa.PublicKey)
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		_, ok = issuerKey.(*ecdsa.PublicKey)
+	case x509.PureEd25519:
+		_, ok = issuerKey.(ed25519.PublicKey)
+	default:
+		return fmt.Errorf("signatureAlgorithm %s is not supported", alg)
+	}
+	if !ok && issuerKey != nil {
+		return fmt.Errorf("signatureAlgorithm %s cannot be used with an issuer key of type %T", alg, issuerKey)
+	}
+	return nil
+}
+
 // AuthorizeRevoke is called just before the certificate is to be revoked by
 // the CA. It can be used to authorize revocation of a certificate. With the
 // ACME protocol, revocation authorization is specified and performed as part
@@ -322,6 +1389,69 @@ func (p *ACME) IsAttestationFormatEnabled(_ context.Context, format ACMEAttestat
 	return false
 }
 
+// GetCertificateChains returns the chains downloaded by the clients for a
+// certificate with the given intermediates. The first chain is the one of the
+// authority, and the rest are the alternate chains of the issuer of the
+// certificate. The root is appended to the chains if includeRoot is set.
+func (p *ACME) GetCertificateChains(leaf *x509.Certificate, intermediates []*x509.Certificate) [][]*x509.Certificate {
+	chains := [][]*x509.Certificate{p.withRoot(append([]*x509.Certificate{leaf}, intermediates...))}
+	for _, alt := range p.alternateChains {
+		// Certificates signed before a rotation have a different issuer.
+		if leaf.CheckSignatureFrom(alt[0]) == nil {
+			chains = append(chains, p.withRoot(append([]*x509.Certificate{leaf}, alt...)))
+		}
+	}
+	return chains
+}
+
+// withRoot appends the root that issued the last certificate of the chain, if
+// includeRoot is set and it's one of the roots of the authority.
+func (p *ACME) withRoot(chain []*x509.Certificate) []*x509.Certificate {
+	if !p.IncludeRoot {
+		return chain
+	}
+	last := chain[len(chain)-1]
+	for _, root := range p.roots {
+		if last.Equal(root) {
+			return chain
+		}
+		if last.CheckSignatureFrom(root) == nil {
+			return append(chain, root)
+		}
+	}
+	return chain
+}
+
+// parseAlternateChain parses a bundle of intermediates and verifies that each
+// certificate is signed by the next one, and that the first one uses the key
+// of the issuer, if it's known.
+func parseAlternateChain(b []byte, issuerKey crypto.PublicKey) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for rest := b; len(rest) > 0; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.New("malformed certificate")
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, fmt.Errorf("certificate %d is not signed by the next one: %w", i, err)
+		}
+	}
+	if k, ok := issuerKey.(interface{ Equal(crypto.PublicKey) bool }); ok && !k.Equal(chain[0].PublicKey) {
+		return nil, errors.New("the first certificate does not use the key of the issuer")
+	}
+	return chain, nil
+}
+
 // GetAttestationRoots returns certificate pool with the configured attestation
 // roots and reports if the pool contains at least one certificate.
 //
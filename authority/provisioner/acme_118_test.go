@@ -5,9 +5,27 @@ package provisioner
 
 import (
 	"bytes"
+	"context"
+	"crypto"
 	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/webhook"
 )
 
 func TestACME_GetAttestationRoots(t *testing.T) {
@@ -80,3 +98,494 @@ func TestACME_GetAttestationRoots(t *testing.T) {
 		})
 	}
 }
+
+func TestACME_AuthorizeCSRKey(t *testing.T) {
+	mustSigner := func(kty, crv string, size int) crypto.PublicKey {
+		signer, err := keyutil.GenerateSigner(kty, crv, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer.Public()
+	}
+	p256 := mustSigner("EC", "P-256", 0)
+	p384 := mustSigner("EC", "P-384", 0)
+	rsa2048 := mustSigner("RSA", "", 2048)
+	rsa3072 := mustSigner("RSA", "", 3072)
+	ed := mustSigner("OKP", "Ed25519", 0)
+
+	tests := []struct {
+		name     string
+		keyTypes []ACMEKeyType
+		pub      crypto.PublicKey
+		wantErr  bool
+	}{
+		{"ok/empty", nil, rsa2048, false},
+		{"ok/ec", []ACMEKeyType{"EC:P-256", "RSA:3072"}, p256, false},
+		{"ok/rsa", []ACMEKeyType{"EC:P-256", "RSA:3072"}, rsa3072, false},
+		{"ok/okp", []ACMEKeyType{"OKP:Ed25519"}, ed, false},
+		{"ok/case", []ACMEKeyType{"ec:p-384"}, p384, false},
+		{"fail/curve", []ACMEKeyType{"EC:P-256", "RSA:3072"}, p384, true},
+		{"fail/size", []ACMEKeyType{"EC:P-256", "RSA:3072"}, rsa2048, true},
+		{"fail/type", []ACMEKeyType{"EC:P-256", "RSA:3072"}, ed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", AllowedKeyTypes: tt.keyTypes}
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.AuthorizeCSRKey(context.Background(), tt.pub); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.AuthorizeCSRKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACME_Init_allowedKeyTypes(t *testing.T) {
+	for _, k := range []ACMEKeyType{"EC", "EC:", "EC:P-224", "RSA:0", "RSA:big", "OKP:X25519", "DSA:2048"} {
+		t.Run(string(k), func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", AllowedKeyTypes: []ACMEKeyType{k}}
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); err == nil {
+				t.Errorf("ACME.Init() error = nil, want an error for %q", k)
+			}
+		})
+	}
+}
+
+func TestACME_Init_validationSourceAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    net.IP
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"192.0.2.10", net.ParseIP("192.0.2.10"), false},
+		{"2001:db8::10", net.ParseIP("2001:db8::10"), false},
+		{"192.0.2.10:80", nil, true},
+		{"eth0", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", ValidationSourceAddress: tt.addr}
+			err := p.Init(Config{Claims: globalProvisionerClaims})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := p.GetValidationSourceAddress(); !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ACME.GetValidationSourceAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACME_GetRenewAfter(t *testing.T) {
+	nbf := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotBefore: nbf, NotAfter: nbf.Add(24 * time.Hour)}
+	tests := []struct {
+		hint    float64
+		cert    *x509.Certificate
+		want    time.Time
+		wantOK  bool
+		wantErr bool
+	}{
+		{0, cert, time.Time{}, false, false},
+		{0.5, cert, nbf.Add(12 * time.Hour), true, false},
+		{0.75, cert, nbf.Add(18 * time.Hour), true, false},
+		{0.5, nil, time.Time{}, false, false},
+		{-0.5, cert, time.Time{}, false, true},
+		{1, cert, time.Time{}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.hint), func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", RenewalHint: tt.hint}
+			err := p.Init(Config{Claims: globalProvisionerClaims})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, ok := p.GetRenewAfter(tt.cert)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("ACME.GetRenewAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestACME_GetDNSChallengeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		domain   string
+		want     string
+		wantErr  bool
+	}{
+		{"default", "", "example.com", "", false},
+		{"ok", "{{ .Prefix }}.{{ .Domain }}", "example.com", "_acme-challenge.example.com", false},
+		{"ok/delegated", `{{ .Prefix }}.{{ if hasSuffix ".team1.example.com" .Domain }}team1.example.com{{ else }}{{ .Domain }}{{ end }}`, "www.team1.example.com", "_acme-challenge.team1.example.com", false},
+		{"ok/trailing-dot", "{{ .Prefix }}.{{ .Domain }}.", "example.com", "_acme-challenge.example.com", false},
+		{"fail/empty", "{{ if false }}x{{ end }}", "example.com", "", true},
+		{"fail/execute", "{{ .Domain.Foo }}", "example.com", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", DNSChallengeName: tt.template}
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); err != nil {
+				t.Fatalf("ACME.Init() error = %v", err)
+			}
+			got, err := p.GetDNSChallengeName(tt.domain, "_acme-challenge")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ACME.GetDNSChallengeName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ACME.GetDNSChallengeName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	p := &ACME{Type: "ACME", Name: "acme", DNSChallengeName: "{{ .Domain "}
+	if err := p.Init(Config{Claims: globalProvisionerClaims}); err == nil {
+		t.Error("ACME.Init() error = nil, want error")
+	}
+}
+
+func TestACME_signatureAlgorithm(t *testing.T) {
+	signer, err := keyutil.GenerateSigner("EC", "P-384", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Claims: globalProvisionerClaims, X509IssuerPublicKey: signer.Public()}
+
+	// A P-384 issuer signing with SHA-384.
+	var p ACME
+	if err := json.Unmarshal([]byte(`{"type":"ACME","name":"acme","signatureAlgorithm":"ECDSA-SHA384"}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(config); err != nil {
+		t.Fatalf("ACME.Init() error = %v", err)
+	}
+	opts, err := p.AuthorizeSign(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{}
+	for _, o := range opts {
+		if m, ok := o.(CertificateModifier); ok {
+			if err := m.Modify(cert, SignOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if cert.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+		t.Errorf("SignatureAlgorithm = %v, want %v", cert.SignatureAlgorithm, x509.ECDSAWithSHA384)
+	}
+
+	// An RSA algorithm cannot be used with an EC key.
+	p = ACME{Type: "ACME", Name: "acme", SignatureAlgorithm: x509util.SignatureAlgorithm(x509.SHA384WithRSA)}
+	err = p.Init(config)
+	if err == nil || err.Error() != "signatureAlgorithm SHA384-RSA cannot be used with an issuer key of type *ecdsa.PublicKey" {
+		t.Errorf("ACME.Init() error = %v", err)
+	}
+
+	// Insecure algorithms are not supported.
+	p = ACME{Type: "ACME", Name: "acme", SignatureAlgorithm: x509util.SignatureAlgorithm(x509.ECDSAWithSHA1)}
+	if err := p.Init(config); err == nil {
+		t.Error("ACME.Init() error = nil, want error")
+	}
+
+	// The key type is not checked if the issuer is unknown.
+	p = ACME{Type: "ACME", Name: "acme", SignatureAlgorithm: x509util.SignatureAlgorithm(x509.SHA256WithRSA)}
+	if err := p.Init(Config{Claims: globalProvisionerClaims}); err != nil {
+		t.Errorf("ACME.Init() error = %v", err)
+	}
+}
+
+func TestACME_GetCertificateChains(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := other.Sign(&x509.Certificate{
+		Subject:               ca.Intermediate.Subject,
+		PublicKey:             ca.Intermediate.PublicKey,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(certs ...*x509.Certificate) []byte {
+		var b []byte
+		for _, c := range certs {
+			b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+		return b
+	}
+	config := Config{
+		Claims:              globalProvisionerClaims,
+		X509IssuerPublicKey: ca.Intermediate.PublicKey,
+		X509Roots:           []*x509.Certificate{ca.Root},
+	}
+
+	for name, tc := range map[string]struct {
+		chain []byte
+		err   string
+	}{
+		"ok":         {encode(cross, other.Intermediate), ""},
+		"fail/empty": {[]byte("foo"), "error parsing alternateChains[0]: no certificates found"},
+		"fail/order": {encode(other.Intermediate, cross), "error parsing alternateChains[0]: certificate 0 is not signed by the next one"},
+		"fail/key":   {encode(other.Intermediate), "error parsing alternateChains[0]: the first certificate does not use the key of the issuer"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", AlternateChains: [][]byte{tc.chain}}
+			err := p.Init(config)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("ACME.Init() error = %v", err)
+			case tc.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tc.err)):
+				t.Fatalf("ACME.Init() error = %v, want %s", err, tc.err)
+			}
+		})
+	}
+
+	p := &ACME{Type: "ACME", Name: "acme", AlternateChains: [][]byte{encode(cross, other.Intermediate)}}
+	if err := p.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.Sign(&x509.Certificate{DNSNames: []string{"example.com"}, PublicKey: ca.Signer.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]*x509.Certificate{{leaf, ca.Intermediate}, {leaf, cross, other.Intermediate}}
+	if got := p.GetCertificateChains(leaf, []*x509.Certificate{ca.Intermediate}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ACME.GetCertificateChains() = %v, want %v", got, want)
+	}
+
+	// The root of the authority is appended.
+	p.IncludeRoot = true
+	want = [][]*x509.Certificate{{leaf, ca.Intermediate, ca.Root}, {leaf, cross, other.Intermediate}}
+	if got := p.GetCertificateChains(leaf, []*x509.Certificate{ca.Intermediate}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ACME.GetCertificateChains() = %v, want %v", got, want)
+	}
+
+	// Alternate chains of other issuers are ignored.
+	otherLeaf, err := other.Sign(&x509.Certificate{DNSNames: []string{"example.com"}, PublicKey: other.Signer.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = [][]*x509.Certificate{{otherLeaf, other.Intermediate}}
+	if got := p.GetCertificateChains(otherLeaf, []*x509.Certificate{other.Intermediate}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ACME.GetCertificateChains() = %v, want %v", got, want)
+	}
+}
+
+func TestACME_GetMaxIdentifiers(t *testing.T) {
+	p := &ACME{Type: "ACME", Name: "acme"}
+	if err := p.Init(Config{Claims: globalProvisionerClaims}); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetMaxIdentifiers(); got != DefaultACMEMaxIdentifiers {
+		t.Errorf("ACME.GetMaxIdentifiers() = %d, want %d", got, DefaultACMEMaxIdentifiers)
+	}
+	p.MaxIdentifiers = 5
+	if got := p.GetMaxIdentifiers(); got != 5 {
+		t.Errorf("ACME.GetMaxIdentifiers() = %d, want 5", got)
+	}
+	p.MaxIdentifiers = -1
+	if err := p.Init(Config{Claims: globalProvisionerClaims}); err == nil {
+		t.Error("ACME.Init() error = nil, want error")
+	}
+}
+
+func TestACME_GetOrderExpiry(t *testing.T) {
+	p := &ACME{Type: "ACME", Name: "acme"}
+	if err := p.Init(Config{Claims: globalProvisionerClaims}); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetOrderExpiry(); got != DefaultACMEOrderExpiry {
+		t.Errorf("ACME.GetOrderExpiry() = %v, want %v", got, DefaultACMEOrderExpiry)
+	}
+	if got := p.GetAuthzExpiry(); got != DefaultACMEAuthzExpiry {
+		t.Errorf("ACME.GetAuthzExpiry() = %v, want %v", got, DefaultACMEAuthzExpiry)
+	}
+	p.OrderExpiry = &Duration{Duration: time.Hour}
+	p.AuthzExpiry = &Duration{Duration: 2 * time.Hour}
+	if err := p.Init(Config{Claims: globalProvisionerClaims}); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetOrderExpiry(); got != time.Hour {
+		t.Errorf("ACME.GetOrderExpiry() = %v, want 1h", got)
+	}
+	if got := p.GetAuthzExpiry(); got != 2*time.Hour {
+		t.Errorf("ACME.GetAuthzExpiry() = %v, want 2h", got)
+	}
+	for _, p := range []*ACME{
+		{Type: "ACME", Name: "acme", OrderExpiry: &Duration{}},
+		{Type: "ACME", Name: "acme", AuthzExpiry: &Duration{Duration: -time.Hour}},
+	} {
+		if err := p.Init(Config{Claims: globalProvisionerClaims}); err == nil {
+			t.Error("ACME.Init() error = nil, want error")
+		}
+	}
+}
+
+func TestACME_Init_validationNetwork(t *testing.T) {
+	tests := []struct {
+		network string
+		want    string
+		wantErr bool
+	}{
+		{"", "tcp", false},
+		{"tcp", "tcp", false},
+		{"tcp4", "tcp4", false},
+		{"tcp6", "tcp6", false},
+		{"udp", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", ValidationNetwork: tt.network}
+			err := p.Init(Config{Claims: globalProvisionerClaims})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := p.GetValidationNetwork(); !tt.wantErr && got != tt.want {
+				t.Errorf("ACME.GetValidationNetwork() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACME_Init_validationIPFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *ACMEValidationIPFilter
+		proxy   *ACMEValidationProxy
+		wantErr string
+	}{
+		{"default", &ACMEValidationIPFilter{}, nil, ""},
+		{"allow", &ACMEValidationIPFilter{Allow: []string{"10.1.0.0/16"}}, nil, ""},
+		{"fail-deny", &ACMEValidationIPFilter{Deny: []string{"10.0.0.1"}}, nil, `validationIPFilter deny "10.0.0.1" is not a valid CIDR`},
+		{"fail-allow", &ACMEValidationIPFilter{Allow: []string{"foo"}}, nil, `validationIPFilter allow "foo" is not a valid CIDR`},
+		{"fail-proxy", &ACMEValidationIPFilter{}, &ACMEValidationProxy{URL: "http://proxy:3128"}, "validationIPFilter cannot be used with validationProxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", ValidationIPFilter: tt.filter, ValidationProxy: tt.proxy}
+			err := p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ACME.Init() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("ACME.Init() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACMEValidationIPFilter_Prefixes(t *testing.T) {
+	deny, allow, err := (&ACMEValidationIPFilter{Allow: []string{"10.1.2.3/16"}}).Prefixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deny) != len(DefaultACMEValidationDeny) {
+		t.Errorf("ACMEValidationIPFilter.Prefixes() deny = %v, want %v", deny, DefaultACMEValidationDeny)
+	}
+	if len(allow) != 1 || allow[0].String() != "10.1.0.0/16" {
+		t.Errorf("ACMEValidationIPFilter.Prefixes() allow = %v, want [10.1.0.0/16]", allow)
+	}
+
+	deny, _, err = (&ACMEValidationIPFilter{Deny: []string{"192.0.2.0/24"}}).Prefixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deny) != 1 || deny[0].String() != "192.0.2.0/24" {
+		t.Errorf("ACMEValidationIPFilter.Prefixes() deny = %v, want [192.0.2.0/24]", deny)
+	}
+}
+
+func TestACME_AuthorizeContacts(t *testing.T) {
+	var allow bool
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body webhook.RequestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		got = body.ACMEContacts
+		json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: allow}) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+
+	p := &ACME{
+		Type: "ACME",
+		Name: "acme",
+		ContactPolicy: &ACMEContactPolicy{
+			Allow:   []string{`mailto:[^@]+@example\.com`, `tel:.+`},
+			Webhook: "contacts",
+		},
+		Options: &Options{Webhooks: []*Webhook{
+			{ID: "wh", Name: "contacts", URL: srv.URL, Kind: "NOTIFYING"},
+		}},
+	}
+	if err := p.Init(Config{Claims: globalProvisionerClaims}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	allow = true
+	if err := p.AuthorizeContacts(ctx, []string{"mailto:admin@example.com", "tel:+12025550100"}); err != nil {
+		t.Errorf("ACME.AuthorizeContacts() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("webhook contacts = %v, want 2 contacts", got)
+	}
+
+	allow = false
+	if err := p.AuthorizeContacts(ctx, []string{"mailto:admin@example.com"}); !errors.Is(err, ErrACMEContactNotAllowed) {
+		t.Errorf("ACME.AuthorizeContacts() error = %v, want ErrACMEContactNotAllowed", err)
+	}
+
+	got = nil
+	if err := p.AuthorizeContacts(ctx, []string{"mailto:admin@example.com.evil"}); !errors.Is(err, ErrACMEContactNotAllowed) {
+		t.Errorf("ACME.AuthorizeContacts() error = %v, want ErrACMEContactNotAllowed", err)
+	}
+	if got != nil {
+		t.Errorf("webhook called with rejected contacts %v", got)
+	}
+
+	p.ContactPolicy.MailtoOnly = true
+	if err := p.AuthorizeContacts(ctx, []string{"tel:+12025550100"}); !errors.Is(err, ErrACMEContactNotAllowed) {
+		t.Errorf("ACME.AuthorizeContacts() error = %v, want ErrACMEContactNotAllowed", err)
+	}
+}
+
+func TestACME_Init_contactPolicy(t *testing.T) {
+	webhooks := []*Webhook{
+		{ID: "wh1", Name: "contacts", URL: "https://example.com", Kind: "NOTIFYING"},
+		{ID: "wh2", Name: "authz", URL: "https://example.com", Kind: "AUTHORIZING"},
+	}
+	tests := []struct {
+		name    string
+		policy  *ACMEContactPolicy
+		wantErr bool
+	}{
+		{"ok", &ACMEContactPolicy{Allow: []string{`mailto:.+`}, Webhook: "contacts"}, false},
+		{"fail/regexp", &ACMEContactPolicy{Allow: []string{`mailto:(`}}, true},
+		{"fail/webhook", &ACMEContactPolicy{Webhook: "missing"}, true},
+		{"fail/kind", &ACMEContactPolicy{Webhook: "authz"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", ContactPolicy: tt.policy, Options: &Options{Webhooks: webhooks}}
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); (err != nil) != tt.wantErr {
+				t.Errorf("ACME.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
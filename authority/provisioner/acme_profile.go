@@ -0,0 +1,117 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ACMEProfile is a named certificate profile that ACME clients can select when
+// they create an order. A profile can override the claims and the X.509
+// template options of the provisioner.
+type ACMEProfile struct {
+	// Name is the name clients use to select the profile. It can only contain
+	// letters, digits, dots, dashes and underscores.
+	Name string `json:"name"`
+	// Description is a human readable description of the profile advertised
+	// in the ACME directory.
+	Description string `json:"description,omitempty"`
+	// Claims overrides the claims of the provisioner, claims not set use the
+	// provisioner ones.
+	Claims *Claims `json:"claims,omitempty"`
+	// X509 overrides the X.509 template options of the provisioner.
+	X509    *X509Options `json:"x509,omitempty"`
+	claimer *Claimer
+	options *Options
+}
+
+// init validates the profile and merges its claims and options with the ones
+// of the provisioner.
+func (p *ACMEProfile) init(claims *Claims, options *Options, global Claims) (err error) {
+	if err := validateACMEProfileName(p.Name); err != nil {
+		return err
+	}
+	if p.claimer, err = NewClaimer(mergeClaims(claims, p.Claims), global); err != nil {
+		return fmt.Errorf("acme profile %q: %w", p.Name, err)
+	}
+	p.options = options
+	if p.X509 != nil {
+		opts := Options{}
+		if options != nil {
+			opts = *options
+		}
+		opts.X509 = p.X509
+		p.options = &opts
+	}
+	return nil
+}
+
+// GetOptions returns the options of the provisioner with the X.509 options of
+// the profile.
+func (p *ACMEProfile) GetOptions() *Options {
+	return p.options
+}
+
+// DefaultTLSCertDuration returns the default TLS cert duration of the
+// profile.
+func (p *ACMEProfile) DefaultTLSCertDuration() time.Duration {
+	return p.claimer.DefaultTLSCertDuration()
+}
+
+// MinTLSCertDuration returns the minimum TLS cert duration of the profile.
+func (p *ACMEProfile) MinTLSCertDuration() time.Duration {
+	return p.claimer.MinTLSCertDuration()
+}
+
+// MaxTLSCertDuration returns the maximum TLS cert duration of the profile.
+func (p *ACMEProfile) MaxTLSCertDuration() time.Duration {
+	return p.claimer.MaxTLSCertDuration()
+}
+
+// mergeClaims returns the claims in base with the ones set in override.
+func mergeClaims(base, override *Claims) *Claims {
+	if base == nil || override == nil {
+		if override != nil {
+			return override
+		}
+		return base
+	}
+	merged := *base
+	dst, src := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(override).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if !src.Field(i).IsNil() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return &merged
+}
+
+func validateACMEProfileName(name string) error {
+	if name == "" {
+		return errors.New("acme profile name cannot be empty")
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return fmt.Errorf("acme profile name %q is not valid", name)
+		}
+	}
+	return nil
+}
+
+type acmeProfileKey struct{}
+
+// NewContextWithACMEProfile creates a new context from ctx and attaches the
+// name of the ACME profile used to sign a certificate.
+func NewContextWithACMEProfile(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, acmeProfileKey{}, name)
+}
+
+// ACMEProfileFromContext returns the name of the ACME profile in the context.
+func ACMEProfileFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(acmeProfileKey{}).(string)
+	return name, ok && name != ""
+}
@@ -0,0 +1,109 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACME_Init_profiles(t *testing.T) {
+	short := &Claims{DefaultTLSDur: &Duration{Duration: 5 * time.Minute}}
+	tests := []struct {
+		name     string
+		profiles []*ACMEProfile
+		wantErr  string
+	}{
+		{"ok", []*ACMEProfile{{Name: "short-lived_mTLS.v1", Claims: short}, {Name: "server"}}, ""},
+		{"fail/empty", []*ACMEProfile{{Name: ""}}, "acme profile name cannot be empty"},
+		{"fail/name", []*ACMEProfile{{Name: "short lived"}}, `acme profile name "short lived" is not valid`},
+		{"fail/duplicated", []*ACMEProfile{{Name: "server"}, {Name: "server", Claims: short}}, `acme profile "server" is duplicated`},
+		{"fail/claims", []*ACMEProfile{{Name: "server", Claims: &Claims{
+			MinTLSDur: &Duration{Duration: time.Hour},
+			MaxTLSDur: &Duration{Duration: time.Minute},
+		}}}, `acme profile "server": `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", Profiles: tt.profiles}
+			err := p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_mergeClaims(t *testing.T) {
+	hour, day := &Duration{Duration: time.Hour}, &Duration{Duration: 24 * time.Hour}
+	base := &Claims{MinTLSDur: hour, DefaultTLSDur: day}
+	assert.Nil(t, mergeClaims(nil, nil))
+	assert.Same(t, base, mergeClaims(base, nil))
+	assert.Same(t, base, mergeClaims(nil, base))
+	assert.Equal(t, &Claims{MinTLSDur: hour, DefaultTLSDur: hour, MaxTLSDur: day}, mergeClaims(base, &Claims{DefaultTLSDur: hour, MaxTLSDur: day}))
+	assert.Equal(t, &Claims{MinTLSDur: hour, DefaultTLSDur: day}, base)
+}
+
+func TestACME_AuthorizeSign_profile(t *testing.T) {
+	template := `{"subject": {{ toJson .Subject }}, "sans": {{ toJson .SANs }}, "extKeyUsage": ["clientAuth"]}`
+	options := &Options{X509: &X509Options{TemplateData: []byte(`{"foo":"bar"}`)}}
+	p := &ACME{
+		Type:    "ACME",
+		Name:    "acme",
+		Options: options,
+		Profiles: []*ACMEProfile{
+			{Name: "mtls", Claims: &Claims{DefaultTLSDur: &Duration{Duration: 5 * time.Minute}}, X509: &X509Options{Template: template}},
+			{Name: "server", Claims: &Claims{MaxTLSDur: &Duration{Duration: 90 * 24 * time.Hour}}},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	durations := func(ctx context.Context) (profileDefaultDuration, *validityValidator) {
+		t.Helper()
+		opts, err := p.AuthorizeSign(ctx, "")
+		require.NoError(t, err)
+		var def profileDefaultDuration
+		var validity *validityValidator
+		for _, o := range opts {
+			switch v := o.(type) {
+			case profileDefaultDuration:
+				def = v
+			case *validityValidator:
+				validity = v
+			}
+		}
+		require.NotNil(t, validity)
+		return def, validity
+	}
+
+	def, validity := durations(context.Background())
+	assert.Equal(t, profileDefaultDuration(globalProvisionerClaims.DefaultTLSDur.Duration), def)
+	assert.Equal(t, globalProvisionerClaims.MaxTLSDur.Duration, validity.max)
+
+	def, validity = durations(NewContextWithACMEProfile(context.Background(), "mtls"))
+	assert.Equal(t, profileDefaultDuration(5*time.Minute), def)
+	assert.Equal(t, globalProvisionerClaims.MaxTLSDur.Duration, validity.max)
+
+	def, validity = durations(NewContextWithACMEProfile(context.Background(), "server"))
+	assert.Equal(t, profileDefaultDuration(globalProvisionerClaims.DefaultTLSDur.Duration), def)
+	assert.Equal(t, 90*24*time.Hour, validity.max)
+
+	_, err := p.AuthorizeSign(NewContextWithACMEProfile(context.Background(), "unknown"), "")
+	assert.EqualError(t, err, `acme profile "unknown" is not supported`)
+
+	// The template options of the profile replace the provisioner ones.
+	mtls, ok := p.GetProfile("mtls")
+	require.True(t, ok)
+	assert.Equal(t, template, mtls.GetOptions().GetX509Options().Template)
+	assert.Nil(t, mtls.GetOptions().GetX509Options().TemplateData)
+	assert.Same(t, options.X509, p.Options.X509)
+	server, ok := p.GetProfile("server")
+	require.True(t, ok)
+	assert.Same(t, options, server.GetOptions())
+	_, ok = p.GetProfile("unknown")
+	assert.False(t, ok)
+}
@@ -13,6 +13,9 @@ type Claims struct {
 	MinTLSDur     *Duration `json:"minTLSCertDuration,omitempty"`
 	MaxTLSDur     *Duration `json:"maxTLSCertDuration,omitempty"`
 	DefaultTLSDur *Duration `json:"defaultTLSCertDuration,omitempty"`
+	// CeilingTLSDur is a hard limit for the maximum TLS cert duration. It's
+	// inherited by all provisioners, and a provisioner can only lower it.
+	CeilingTLSDur *Duration `json:"ceilingTLSCertDuration,omitempty"`
 
 	// SSH CA properties
 	MinUserSSHDur     *Duration `json:"minUserSSHCertDuration,omitempty"`
@@ -52,10 +55,16 @@ func (c *Claimer) Claims() Claims {
 	enableSSHCA := c.IsSSHCAEnabled()
 	disableSmallstepExtensions := c.IsDisableSmallstepExtensions()
 
+	var ceilingTLSDur *Duration
+	if d := c.CeilingTLSCertDuration(); d > 0 {
+		ceilingTLSDur = &Duration{d}
+	}
+
 	return Claims{
 		MinTLSDur:                  &Duration{c.MinTLSCertDuration()},
 		MaxTLSDur:                  &Duration{c.MaxTLSCertDuration()},
 		DefaultTLSDur:              &Duration{c.DefaultTLSCertDuration()},
+		CeilingTLSDur:              ceilingTLSDur,
 		MinUserSSHDur:              &Duration{c.MinUserSSHCertDuration()},
 		MaxUserSSHDur:              &Duration{c.MaxUserSSHCertDuration()},
 		DefaultUserSSHDur:          &Duration{c.DefaultUserSSHCertDuration()},
@@ -105,6 +114,23 @@ func (c *Claimer) MaxTLSCertDuration() time.Duration {
 	return c.claims.MaxTLSDur.Duration
 }
 
+// CeilingTLSCertDuration returns the hard limit for the maximum TLS cert
+// duration. The lowest of the provisioner and global values is used, so a
+// provisioner cannot raise the ceiling set in the authority configuration. It
+// returns 0 if there's no ceiling.
+func (c *Claimer) CeilingTLSCertDuration() time.Duration {
+	var ceiling time.Duration
+	if c.global.CeilingTLSDur != nil {
+		ceiling = c.global.CeilingTLSDur.Duration
+	}
+	if c.claims != nil && c.claims.CeilingTLSDur != nil {
+		if d := c.claims.CeilingTLSDur.Duration; ceiling <= 0 || d < ceiling {
+			return d
+		}
+	}
+	return ceiling
+}
+
 // IsDisableRenewal returns if the renewal flow is disabled for the
 // provisioner. If the property is not set within the provisioner, then the
 // global value from the authority configuration will be used.
@@ -234,9 +260,10 @@ func (c *Claimer) IsSSHCAEnabled() bool {
 // Validate validates and modifies the Claims with default values.
 func (c *Claimer) Validate() error {
 	var (
-		min = c.MinTLSCertDuration()
-		max = c.MaxTLSCertDuration()
-		def = c.DefaultTLSCertDuration()
+		min     = c.MinTLSCertDuration()
+		max     = c.MaxTLSCertDuration()
+		def     = c.DefaultTLSCertDuration()
+		ceiling = c.CeilingTLSCertDuration()
 	)
 	switch {
 	case min <= 0:
@@ -252,6 +279,10 @@ func (c *Claimer) Validate() error {
 		return errors.Errorf("claims: DefaultCertDuration cannot be less than MinCertDuration: DefaultCertDuration - %v, MinCertDuration - %v", def, min)
 	case max < def:
 		return errors.Errorf("claims: MaxCertDuration cannot be less than DefaultCertDuration: MaxCertDuration - %v, DefaultCertDuration - %v", max, def)
+	case ceiling < 0:
+		return errors.Errorf("claims: CeilingTLSCertDuration cannot be negative")
+	case ceiling > 0 && max > ceiling:
+		return errors.Errorf("claims: MaxCertDuration cannot be greater than CeilingTLSCertDuration: MaxCertDuration - %v, CeilingTLSCertDuration - %v", max, ceiling)
 	default:
 		return nil
 	}
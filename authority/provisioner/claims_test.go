@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -49,3 +51,78 @@ func TestClaimer_DefaultSSHCertDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestClaimer_Claims_merge(t *testing.T) {
+	global := globalProvisionerClaims
+	global.CeilingTLSDur = &Duration{Duration: 90 * 24 * time.Hour}
+
+	// The provisioner claims take precedence over the global ones, and they
+	// can exceed the global maximum up to the ceiling.
+	c, err := NewClaimer(&Claims{
+		MaxTLSDur:     &Duration{Duration: 90 * 24 * time.Hour},
+		DefaultTLSDur: &Duration{Duration: 30 * 24 * time.Hour},
+	}, global)
+	require.NoError(t, err)
+	claims := c.Claims()
+	assert.Equal(t, 5*time.Minute, claims.MinTLSDur.Duration)
+	assert.Equal(t, 90*24*time.Hour, claims.MaxTLSDur.Duration)
+	assert.Equal(t, 30*24*time.Hour, claims.DefaultTLSDur.Duration)
+	assert.Equal(t, 90*24*time.Hour, claims.CeilingTLSDur.Duration)
+
+	// The merged claims are the global claims of the provisioners.
+	c, err = NewClaimer(&Claims{
+		MaxTLSDur:     &Duration{Duration: 7 * 24 * time.Hour},
+		DefaultTLSDur: &Duration{Duration: 24 * time.Hour},
+		CeilingTLSDur: &Duration{Duration: 7 * 24 * time.Hour},
+	}, claims)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, c.MinTLSCertDuration())
+	assert.Equal(t, 7*24*time.Hour, c.MaxTLSCertDuration())
+	assert.Equal(t, 24*time.Hour, c.DefaultTLSCertDuration())
+	assert.Equal(t, 7*24*time.Hour, c.CeilingTLSCertDuration())
+
+	// A provisioner cannot raise the ceiling.
+	c, err = NewClaimer(&Claims{CeilingTLSDur: &Duration{Duration: 365 * 24 * time.Hour}}, claims)
+	require.NoError(t, err)
+	assert.Equal(t, 90*24*time.Hour, c.CeilingTLSCertDuration())
+
+	// Without a ceiling none is returned.
+	c, err = NewClaimer(nil, globalProvisionerClaims)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), c.CeilingTLSCertDuration())
+	assert.Nil(t, c.Claims().CeilingTLSDur)
+}
+
+func TestClaimer_Validate_ceiling(t *testing.T) {
+	global := globalProvisionerClaims
+	global.CeilingTLSDur = &Duration{Duration: 90 * 24 * time.Hour}
+
+	tests := []struct {
+		name    string
+		global  Claims
+		claims  *Claims
+		wantErr string
+	}{
+		{"ok", global, nil, ""},
+		{"ok/max-at-ceiling", global, &Claims{MaxTLSDur: &Duration{Duration: 90 * 24 * time.Hour}}, ""},
+		{"ok/no-ceiling", globalProvisionerClaims, &Claims{MaxTLSDur: &Duration{Duration: 365 * 24 * time.Hour}}, ""},
+		{"fail/max", global, &Claims{MaxTLSDur: &Duration{Duration: 91 * 24 * time.Hour}},
+			"claims: MaxCertDuration cannot be greater than CeilingTLSCertDuration: MaxCertDuration - 2184h0m0s, CeilingTLSCertDuration - 2160h0m0s"},
+		{"fail/default", global, &Claims{DefaultTLSDur: &Duration{Duration: 91 * 24 * time.Hour}},
+			"claims: MaxCertDuration cannot be greater than CeilingTLSCertDuration: MaxCertDuration - 2184h0m0s, CeilingTLSCertDuration - 2160h0m0s"},
+		{"fail/lowered-ceiling", global, &Claims{MaxTLSDur: &Duration{Duration: 48 * time.Hour}, CeilingTLSDur: &Duration{Duration: 36 * time.Hour}},
+			"claims: MaxCertDuration cannot be greater than CeilingTLSCertDuration: MaxCertDuration - 48h0m0s, CeilingTLSCertDuration - 36h0m0s"},
+		{"fail/negative", globalProvisionerClaims, &Claims{CeilingTLSDur: &Duration{Duration: -time.Hour}},
+			"claims: CeilingTLSCertDuration cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClaimer(tt.claims, tt.global)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -26,6 +27,7 @@ type Controller struct {
 	policy                *policyEngine
 	webhookClient         *http.Client
 	webhooks              []*Webhook
+	webhookCaches         map[*Webhook]*webhookResponseCache
 }
 
 // NewController initializes a new provisioner controller.
@@ -38,6 +40,34 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 	if err != nil {
 		return nil, err
 	}
+	if err := options.GetSSHOptions().Validate(); err != nil {
+		return nil, err
+	}
+	var webhookCaches map[*Webhook]*webhookResponseCache
+	// Webhooks with the same TLS options share the client.
+	webhookClients := make(map[WebhookTLS]*http.Client)
+	for _, wh := range options.GetWebhooks() {
+		if err := wh.Validate(); err != nil {
+			return nil, err
+		}
+		wh.headers = config.WebhookHeaders
+		if wh.TLS != nil {
+			client, ok := webhookClients[*wh.TLS]
+			if !ok {
+				if client, err = wh.TLS.newClient(config.WebhookClient); err != nil {
+					return nil, fmt.Errorf("webhook %q: %w", wh.Name, err)
+				}
+				webhookClients[*wh.TLS] = client
+			}
+			wh.client = client
+		}
+		if wh.Cache != nil && wh.Kind == linkedca.Webhook_ENRICHING.String() {
+			if webhookCaches == nil {
+				webhookCaches = make(map[*Webhook]*webhookResponseCache)
+			}
+			webhookCaches[wh] = newWebhookResponseCache(wh.Cache)
+		}
+	}
 	return &Controller{
 		Interface:             p,
 		Audiences:             &config.Audiences,
@@ -48,6 +78,7 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 		policy:                policy,
 		webhookClient:         config.WebhookClient,
 		webhooks:              options.GetWebhooks(),
+		webhookCaches:         webhookCaches,
 	}, nil
 }
 
@@ -82,10 +113,16 @@ func (c *Controller) newWebhookController(templateData WebhookSetter, certType l
 	if client == nil {
 		client = http.DefaultClient
 	}
+	var provisionerName string
+	if c.Interface != nil {
+		provisionerName = c.GetName()
+	}
 	return &WebhookController{
 		TemplateData: templateData,
 		client:       client,
 		webhooks:     c.webhooks,
+		caches:       c.webhookCaches,
+		provisioner:  provisionerName,
 		certType:     certType,
 		options:      opts,
 	}
@@ -130,6 +130,12 @@ func TestNewController(t *testing.T) {
 				},
 			},
 		}}, nil, true},
+		{"fail webhook", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			Webhooks: []*Webhook{{Name: "people", Kind: "ENRICHING", FailurePolicy: "ignore"}},
+		}}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
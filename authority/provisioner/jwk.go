@@ -280,6 +280,8 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Remove or reject the critical options and extensions not allowed
+		newSSHExtensionsModifier(p.Options.GetSSHOptions()),
 		// Call webhooks
 		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
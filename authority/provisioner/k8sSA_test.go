@@ -370,7 +370,7 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					if assert.NotNil(t, opts) {
-						assert.Len(t, 9, opts)
+						assert.Len(t, 10, opts)
 						for _, o := range opts {
 							switch v := o.(type) {
 							case Interface:
@@ -386,6 +386,8 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 							case *sshNamePolicyValidator:
 								assert.Equals(t, nil, v.userPolicyEngine)
 								assert.Equals(t, nil, v.hostPolicyEngine)
+							case *sshExtensionsModifier:
+								assert.Equals(t, v, &sshExtensionsModifier{})
 							case *WebhookController:
 								assert.Len(t, 0, v.webhooks)
 							default:
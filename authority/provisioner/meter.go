@@ -0,0 +1,86 @@
+package provisioner
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// WebhookOutcome is the result of a webhook request reported to the Meter.
+type WebhookOutcome string
+
+const (
+	// WebhookAllowed is the outcome of a webhook request that was allowed by
+	// the webhook server.
+	WebhookAllowed WebhookOutcome = "allowed"
+	// WebhookDenied is the outcome of a webhook request that was not allowed
+	// by the webhook server.
+	WebhookDenied WebhookOutcome = "denied"
+	// WebhookFailed is the outcome of a webhook request that failed, after all
+	// the retries.
+	WebhookFailed WebhookOutcome = "error"
+)
+
+// Meter is the interface used to instrument the webhook requests.
+type Meter interface {
+	// WebhookCalled is called whenever a webhook request finishes, with the
+	// name and kind of the webhook, the status code of the last response, or
+	// 0 if there was no response, the outcome and the time it took, including
+	// retries.
+	WebhookCalled(name, kind string, statusCode int, outcome WebhookOutcome, d time.Duration)
+}
+
+type meterKey struct{}
+
+// NewMeterContext adds the given meter to the context.
+func NewMeterContext(ctx context.Context, m Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// MeterFromContext returns the current meter from the given context.
+func MeterFromContext(ctx context.Context) (m Meter, ok bool) {
+	m, ok = ctx.Value(meterKey{}).(Meter)
+	return
+}
+
+// MustMeterFromContext returns the current meter from the given context. It
+// will return a noop meter if it does not exist.
+func MustMeterFromContext(ctx context.Context) Meter {
+	m, ok := MeterFromContext(ctx)
+	if !ok {
+		return noopMeter{}
+	}
+	return m
+}
+
+// noopMeter implements a noop [Meter].
+type noopMeter struct{}
+
+func (noopMeter) WebhookCalled(string, string, int, WebhookOutcome, time.Duration) {}
+
+type tracerProviderKey struct{}
+
+// NewTracerProviderContext adds the OpenTelemetry tracer provider used to trace
+// the webhook requests to the context.
+func NewTracerProviderContext(ctx context.Context, tp trace.TracerProvider) context.Context {
+	return context.WithValue(ctx, tracerProviderKey{}, tp)
+}
+
+// TracerProviderFromContext returns the current tracer provider from the given
+// context.
+func TracerProviderFromContext(ctx context.Context) (tp trace.TracerProvider, ok bool) {
+	tp, ok = ctx.Value(tracerProviderKey{}).(trace.TracerProvider)
+	return
+}
+
+// MustTracerProviderFromContext returns the current tracer provider from the
+// given context. It will return a noop tracer provider if it does not exist.
+func MustTracerProviderFromContext(ctx context.Context) trace.TracerProvider {
+	tp, ok := TracerProviderFromContext(ctx)
+	if !ok {
+		return tracenoop.NewTracerProvider()
+	}
+	return tp
+}
@@ -2,6 +2,8 @@ package provisioner
 
 import (
 	"context"
+
+	"github.com/smallstep/certificates/webhook"
 )
 
 // Method indicates the action to action that we will perform, it's used as part
@@ -78,3 +80,18 @@ func TokenFromContext(ctx context.Context) (string, bool) {
 	token, ok := ctx.Value(tokenKey{}).(string)
 	return token, ok
 }
+
+type requestMetadataKey struct{}
+
+// NewContextWithRequestMetadata creates a new context with the metadata of the
+// HTTP request.
+func NewContextWithRequestMetadata(ctx context.Context, md *webhook.RequestMetadata) context.Context {
+	return context.WithValue(ctx, requestMetadataKey{}, md)
+}
+
+// RequestMetadataFromContext returns the metadata of the HTTP request stored in
+// the given context.
+func RequestMetadataFromContext(ctx context.Context) (*webhook.RequestMetadata, bool) {
+	md, ok := ctx.Value(requestMetadataKey{}).(*webhook.RequestMetadata)
+	return md, ok && md != nil
+}
@@ -424,7 +424,7 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		defaultTemplate = sshutil.DefaultAdminTemplate
 	}
 
-	templateOptions, err := CustomSSHTemplateOptions(o.Options, data, defaultTemplate)
+	templateOptions, err := CustomSSHTemplateOptionsWithContext(ctx, o.Options, data, defaultTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
 	}
@@ -457,6 +457,8 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(o.ctl.getPolicy().getSSHHost(), o.ctl.getPolicy().getSSHUser()),
+		// Remove or reject the critical options and extensions not allowed
+		newSSHExtensionsModifier(o.Options.GetSSHOptions()),
 		// Call webhooks
 		o.ctl.newWebhookController(data, linkedca.Webhook_SSH),
 	), nil
@@ -2,6 +2,7 @@ package provisioner
 
 import (
 	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	stderrors "errors"
@@ -234,8 +235,19 @@ type Config struct {
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
 	// WebhookClient is an http client to use in webhook request
 	WebhookClient *http.Client
+	// WebhookHeaders are headers added to all the webhook requests, like the
+	// User-Agent.
+	WebhookHeaders http.Header
 	// SCEPKeyManager, if defined, is the interface used by SCEP provisioners.
 	SCEPKeyManager SCEPKeyManager
+	// HTTP01AllowedPorts are the ports, besides 80, that ACME provisioners
+	// can use to validate http-01 challenges.
+	HTTP01AllowedPorts []int
+	// X509IssuerPublicKey is the public key of the intermediate certificate
+	// that signs the X.509 certificates, if it's known.
+	X509IssuerPublicKey crypto.PublicKey
+	// X509Roots are the root certificates of the authority.
+	X509Roots []*x509.Certificate
 }
 
 type provisioner struct {
@@ -7,6 +7,7 @@ import (
 	"crypto/subtle"
 	"crypto/x509"
 	"encoding/pem"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -15,6 +16,7 @@ import (
 
 	"go.step.sm/crypto/kms"
 	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/webhook"
@@ -31,6 +33,21 @@ type SCEP struct {
 	ChallengePassword string   `json:"challenge,omitempty"`
 	Capabilities      []string `json:"capabilities,omitempty"`
 
+	// GRPCChallenge configures a gRPC service used to validate the SCEP
+	// challenges. If set, it takes precedence over the SCEPCHALLENGE webhooks
+	// and the static challenge.
+	GRPCChallenge *SCEPGRPCChallenge `json:"grpcChallenge,omitempty"`
+
+	// ChallengeIssuance configures a SCEPCHALLENGE webhook that issues
+	// one-time challenges to the clients before they enroll. The enrollment
+	// must use the challenge issued for its transaction ID, the other
+	// SCEPCHALLENGE webhooks, if any, must also allow it.
+	ChallengeIssuance *SCEPChallengeIssuance `json:"challengeIssuance,omitempty"`
+
+	// ChallengeWebhookRetry configures the retries of the SCEPCHALLENGE
+	// webhook requests. By default, a failed request is retried once.
+	ChallengeWebhookRetry *WebhookRetry `json:"challengeWebhookRetry,omitempty"`
+
 	// IncludeRoot makes the provisioner return the CA root in addition to the
 	// intermediate in the GetCACerts response
 	IncludeRoot bool `json:"includeRoot,omitempty"`
@@ -57,6 +74,8 @@ type SCEP struct {
 	ctl                           *Controller
 	encryptionAlgorithm           int
 	challengeValidationController *challengeValidationController
+	grpcChallengeValidator        *grpcChallengeValidator
+	challengeIssuer               *challengeIssuer
 	notificationController        *notificationController
 	keyManager                    SCEPKeyManager
 	decrypter                     crypto.Decrypter
@@ -113,11 +132,12 @@ func (s *SCEP) DefaultTLSCertDuration() time.Duration {
 type challengeValidationController struct {
 	client   *http.Client
 	webhooks []*Webhook
+	retry    *WebhookRetry
 }
 
 // newChallengeValidationController creates a new challengeValidationController
 // that performs challenge validation through webhooks.
-func newChallengeValidationController(client *http.Client, webhooks []*Webhook) *challengeValidationController {
+func newChallengeValidationController(client *http.Client, webhooks []*Webhook, retry *WebhookRetry) *challengeValidationController {
 	scepHooks := []*Webhook{}
 	for _, wh := range webhooks {
 		if wh.Kind != linkedca.Webhook_SCEPCHALLENGE.String() {
@@ -128,42 +148,80 @@ func newChallengeValidationController(client *http.Client, webhooks []*Webhook)
 		}
 		scepHooks = append(scepHooks, wh)
 	}
+	if retry == nil {
+		retry = defaultWebhookRetry
+	}
 	return &challengeValidationController{
 		client:   client,
 		webhooks: scepHooks,
+		retry:    retry,
 	}
 }
 
 var (
-	ErrSCEPChallengeInvalid   = errors.New("webhook server did not allow request")
+	// ErrSCEPChallengeInvalid is returned when the SCEP challenge validation
+	// webhooks, or the gRPC validator, explicitly denied the request. It's the
+	// same error as ErrWebhookDenied, so callers can tell a deny from an
+	// error executing the requests.
+	ErrSCEPChallengeInvalid   = ErrWebhookDenied
 	ErrSCEPNotificationFailed = errors.New("scep notification failed")
 )
 
 // Validate executes zero or more configured webhooks to
-// validate the SCEP challenge. If at least one of them indicates
+// validate the SCEP challenge. The webhooks are executed in the
+// order they are configured, and if at least one of them indicates
 // the challenge value is accepted, validation succeeds. In
-// that case, the other webhooks will be skipped. If none of
-// the webhooks indicates the value of the challenge was accepted,
-// an error is returned.
+// that case, the other webhooks will be skipped. A webhook that
+// fails does not prevent the next ones from being executed. If none
+// of the webhooks indicates the value of the challenge was accepted,
+// the errors of the failed webhooks, in order, are returned, or
+// ErrWebhookDenied if all of them denied the request.
 func (c *challengeValidationController) Validate(ctx context.Context, csr *x509.CertificateRequest, provisionerName, challenge, transactionID string) error {
+	var errs []error
 	for _, wh := range c.webhooks {
-		req, err := webhook.NewRequestBody(webhook.WithX509CertificateRequest(csr))
-		if err != nil {
-			return fmt.Errorf("failed creating new webhook request: %w", err)
-		}
+		req := newChallengeRequestBody(csr)
 		req.ProvisionerName = provisionerName
 		req.SCEPChallenge = challenge
 		req.SCEPTransactionID = transactionID
-		resp, err := wh.DoWithContext(ctx, c.client, req, nil) // TODO(hs): support templated URL? Requires some refactoring
+		if wh.IncludeRequestMetadata {
+			req.RequestMetadata, _ = RequestMetadataFromContext(ctx)
+		}
+		resp, err := wh.DoWithRetry(ctx, c.client, req, nil, c.retry) // TODO(hs): support templated URL? Requires some refactoring
 		if err != nil {
-			return fmt.Errorf("failed executing webhook request: %w", err)
+			errs = append(errs, fmt.Errorf("failed executing webhook request: %w", err))
+			continue
 		}
 		if resp.Allow {
 			return nil // return early when response is positive
 		}
 	}
 
-	return ErrSCEPChallengeInvalid
+	if len(errs) > 0 {
+		return stderrors.Join(errs...)
+	}
+	return ErrWebhookDenied
+}
+
+// newChallengeRequestBody creates the body of the SCEP challenge validation
+// webhook requests. Besides the raw CSR, the body includes the parsed subject,
+// SANs and public key, so webhook servers don't need to parse the CSR. If the
+// CSR only contains the raw bytes, they will be parsed first. If the CSR is
+// malformed, only the raw bytes are sent.
+func newChallengeRequestBody(csr *x509.CertificateRequest) *webhook.RequestBody {
+	if csr.PublicKey == nil && len(csr.Raw) > 0 {
+		if cr, err := x509.ParseCertificateRequest(csr.Raw); err == nil {
+			csr = cr
+		}
+	}
+	if req, err := webhook.NewRequestBody(webhook.WithX509CertificateRequest(csr)); err == nil {
+		return req
+	}
+	return &webhook.RequestBody{
+		X509CertificateRequest: &webhook.X509CertificateRequest{
+			CertificateRequest: &x509util.CertificateRequest{},
+			Raw:                csr.Raw,
+		},
+	}
 }
 
 type notificationController struct {
@@ -223,13 +281,30 @@ func (c *notificationController) Failure(ctx context.Context, csr *x509.Certific
 	return nil
 }
 
+// validationWebhooks returns the configured webhooks without the one used to
+// issue challenges.
+func (s *SCEP) validationWebhooks() []*Webhook {
+	webhooks := s.GetOptions().GetWebhooks()
+	if s.ChallengeIssuance == nil {
+		return webhooks
+	}
+	res := make([]*Webhook, 0, len(webhooks))
+	for _, wh := range webhooks {
+		if wh.Name != s.ChallengeIssuance.Webhook {
+			res = append(res, wh)
+		}
+	}
+	return res
+}
+
 // isCertTypeOK returns whether or not the webhook can be used
 // with the SCEP challenge validation webhook controller.
 func isCertTypeOK(wh *Webhook) bool {
-	if wh.CertType == linkedca.Webhook_ALL.String() || wh.CertType == "" {
-		return true
+	certType, err := wh.CertTypeEnum()
+	if err != nil {
+		return false
 	}
-	return linkedca.Webhook_X509.String() == wh.CertType
+	return certType == linkedca.Webhook_ALL || certType == linkedca.Webhook_X509
 }
 
 // Init initializes and validates the fields of a SCEP type.
@@ -256,11 +331,51 @@ func (s *SCEP) Init(config Config) (err error) {
 	}
 
 	// Prepare the SCEP challenge validator
+	for _, wh := range s.GetOptions().GetWebhooks() {
+		if err := wh.ValidateSigningAlg(); err != nil {
+			return err
+		}
+	}
+	if s.ChallengeWebhookRetry != nil {
+		if err := s.ChallengeWebhookRetry.Validate(); err != nil {
+			return err
+		}
+	}
 	s.challengeValidationController = newChallengeValidationController(
 		config.WebhookClient,
-		s.GetOptions().GetWebhooks(),
+		s.validationWebhooks(),
+		s.ChallengeWebhookRetry,
 	)
 
+	// Prepare the SCEP challenge issuer
+	if s.ChallengeIssuance != nil {
+		switch {
+		case s.GRPCChallenge != nil:
+			return errors.New("challengeIssuance cannot be combined with grpcChallenge")
+		case s.ChallengePassword != "":
+			return errors.New("challengeIssuance cannot be combined with a static challenge")
+		}
+		if s.challengeIssuer, err = newChallengeIssuer(
+			config.WebhookClient,
+			s.GetOptions().GetWebhooks(),
+			s.ChallengeWebhookRetry,
+			s.ChallengeIssuance,
+		); err != nil {
+			return err
+		}
+	}
+
+	// Prepare the gRPC challenge validator, closing the connection of a
+	// previous initialization.
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if s.GRPCChallenge != nil {
+		if s.grpcChallengeValidator, err = newGRPCChallengeValidator(s.GRPCChallenge); err != nil {
+			return err
+		}
+	}
+
 	// Prepare the SCEP notification controller
 	s.notificationController = newNotificationController(
 		config.WebhookClient,
@@ -445,8 +560,23 @@ func (s *SCEP) ValidateChallenge(ctx context.Context, csr *x509.CertificateReque
 		return fmt.Errorf("provisioner %q wasn't initialized", s.Name)
 	}
 	switch s.selectValidationMethod() {
+	case validationMethodGRPC:
+		return s.grpcChallengeValidator.Validate(ctx, csr, s.Name, challenge, transactionID)
 	case validationMethodWebhook:
 		return s.challengeValidationController.Validate(ctx, csr, s.Name, challenge, transactionID)
+	case validationMethodIssued:
+		if err := s.challengeIssuer.Validate(transactionID, challenge); err != nil {
+			return err
+		}
+		if len(s.challengeValidationController.webhooks) == 0 {
+			return nil
+		}
+		return s.challengeValidationController.Validate(ctx, csr, s.Name, challenge, transactionID)
+	case validationMethodCombined:
+		if subtle.ConstantTimeCompare([]byte(s.ChallengePassword), []byte(challenge)) == 0 {
+			return errors.New("invalid challenge password provided")
+		}
+		return s.challengeValidationController.Validate(ctx, csr, s.Name, challenge, transactionID)
 	default:
 		if subtle.ConstantTimeCompare([]byte(s.ChallengePassword), []byte(challenge)) == 0 {
 			return errors.New("invalid challenge password provided")
@@ -455,6 +585,34 @@ func (s *SCEP) ValidateChallenge(ctx context.Context, csr *x509.CertificateReque
 	}
 }
 
+// IssueChallenge gets a new one-time challenge for the given transaction from
+// the challenge issuance webhook. The request must be authorized with the
+// bearer token of the challenge issuance. It returns
+// ErrSCEPChallengeIssuanceDisabled if the provisioner does not issue
+// challenges, and ErrWebhookDenied if the webhook server did not allow the
+// request.
+func (s *SCEP) IssueChallenge(ctx context.Context, token, transactionID string) (*SCEPIssuedChallenge, error) {
+	if s.challengeIssuer == nil {
+		return nil, ErrSCEPChallengeIssuanceDisabled
+	}
+	if transactionID == "" {
+		return nil, errors.New("transaction ID cannot be empty")
+	}
+	return s.challengeIssuer.Issue(ctx, s.Name, token, transactionID)
+}
+
+// Close releases the resources of the provisioner, the client connection of
+// the gRPC challenge service. The authority closes the provisioners when they
+// are replaced or removed, and on shutdown.
+func (s *SCEP) Close() error {
+	if s.grpcChallengeValidator == nil {
+		return nil
+	}
+	err := s.grpcChallengeValidator.Close()
+	s.grpcChallengeValidator = nil
+	return err
+}
+
 func (s *SCEP) NotifySuccess(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate, transactionID string) error {
 	if s.notificationController == nil {
 		return fmt.Errorf("provisioner %q wasn't initialized", s.Name)
@@ -475,14 +633,34 @@ const (
 	validationMethodNone    validationMethod = "none"
 	validationMethodStatic  validationMethod = "static"
 	validationMethodWebhook validationMethod = "webhook"
+	validationMethodGRPC    validationMethod = "grpc"
+	// validationMethodCombined requires both the static challenge password
+	// and the approval of a webhook.
+	validationMethodCombined validationMethod = "combined"
+	// validationMethodIssued requires the challenge issued for the
+	// transaction, and the approval of the validation webhooks if any.
+	validationMethodIssued validationMethod = "issued"
 )
 
 // selectValidationMethod returns the method to validate SCEP
-// challenges. If a webhook is configured with kind `SCEPCHALLENGE`,
-// the webhook method will be used. If a challenge password is set,
-// the static method is used. It will default to the `none` method.
+// challenges. If the `grpcChallenge` option is set, the grpc method
+// will be used. If the `challengeIssuance` option is set, the issued method
+// will be used. If a webhook is configured with kind `SCEPCHALLENGE`
+// and a challenge password is set, the combined method will be used;
+// with only the webhook, the webhook method will be used. If only a
+// challenge password is set, the static method is used. It will
+// default to the `none` method.
 func (s *SCEP) selectValidationMethod() validationMethod {
+	if s.grpcChallengeValidator != nil {
+		return validationMethodGRPC
+	}
+	if s.challengeIssuer != nil {
+		return validationMethodIssued
+	}
 	if len(s.challengeValidationController.webhooks) > 0 {
+		if s.ChallengePassword != "" {
+			return validationMethodCombined
+		}
 		return validationMethodWebhook
 	}
 	if s.ChallengePassword != "" {
@@ -0,0 +1,290 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// defaultSCEPGRPCChallengeTimeout is the timeout used on the gRPC challenge
+// validation requests if none is configured.
+const defaultSCEPGRPCChallengeTimeout = 10 * time.Second
+
+// scepGRPCChallengeMethod is the full name of the gRPC method used to validate
+// SCEP challenges. The service is described by the following protobuf
+// definition:
+//
+//	syntax = "proto3";
+//
+//	package smallstep.scep.v1;
+//
+//	service ChallengeValidator {
+//	  rpc ValidateChallenge(ValidateChallengeRequest) returns (ValidateChallengeResponse);
+//	}
+//
+//	message ValidateChallengeRequest {
+//	  string provisioner_name = 1;
+//	  string challenge = 2;
+//	  string transaction_id = 3;
+//	  bytes csr = 4;
+//	}
+//
+//	message ValidateChallengeResponse {
+//	  bool allow = 1;
+//	}
+const scepGRPCChallengeMethod = "/smallstep.scep.v1.ChallengeValidator/ValidateChallenge"
+
+// SCEPGRPCChallenge configures a gRPC service used to validate the SCEP
+// challenges.
+type SCEPGRPCChallenge struct {
+	// Endpoint is the address of the gRPC service, e.g. "scep-validator:443".
+	Endpoint string `json:"endpoint"`
+	// Timeout is the maximum time a validation request can take. Defaults to
+	// 10s.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// Root is the path to a PEM bundle used to verify the server certificate.
+	// If it's not set, the system roots will be used.
+	Root string `json:"root,omitempty"`
+	// Certificate and Key are the paths to the PEM encoded certificate and key
+	// used to authenticate with the server using mTLS.
+	Certificate string `json:"crt,omitempty"`
+	Key         string `json:"key,omitempty"`
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string `json:"serverName,omitempty"`
+	// Insecure disables TLS on the connection, this can be used when the
+	// connection is secured by a service mesh sidecar.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// grpcChallengeValidator validates SCEP challenges using a gRPC service. The
+// client connection is created when the provisioner is initialized, it's
+// shared by all requests and it's closed with the provisioner.
+type grpcChallengeValidator struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+// newGRPCChallengeValidator creates a new validator that uses the configured
+// gRPC service.
+func newGRPCChallengeValidator(cfg *SCEPGRPCChallenge) (*grpcChallengeValidator, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("grpcChallenge endpoint cannot be empty")
+	}
+
+	var creds credentials.TransportCredentials
+	if cfg.Insecure {
+		if cfg.Root != "" || cfg.Certificate != "" || cfg.Key != "" {
+			return nil, errors.New("grpcChallenge cannot set TLS options with insecure")
+		}
+		creds = insecure.NewCredentials()
+	} else {
+		tlsConfig := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: cfg.ServerName,
+		}
+		if cfg.Root != "" {
+			b, err := os.ReadFile(cfg.Root)
+			if err != nil {
+				return nil, fmt.Errorf("error reading grpcChallenge root: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(b) {
+				return nil, fmt.Errorf("error parsing grpcChallenge root: no certificates found in %s", cfg.Root)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		switch {
+		case cfg.Certificate != "" && cfg.Key != "":
+			cert, err := tls.LoadX509KeyPair(cfg.Certificate, cfg.Key)
+			if err != nil {
+				return nil, fmt.Errorf("error loading grpcChallenge certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		case cfg.Certificate != "" || cfg.Key != "":
+			return nil, errors.New("grpcChallenge crt and key must be set together")
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	timeout := defaultSCEPGRPCChallengeTimeout
+	if cfg.Timeout != nil && cfg.Timeout.Duration > 0 {
+		timeout = cfg.Timeout.Duration
+	}
+
+	// The connection is established lazily on the first request.
+	conn, err := grpc.NewClient(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("error creating grpcChallenge client: %w", err)
+	}
+
+	return &grpcChallengeValidator{
+		conn:    conn,
+		timeout: timeout,
+	}, nil
+}
+
+// Close closes the client connection.
+func (v *grpcChallengeValidator) Close() error {
+	return v.conn.Close()
+}
+
+// Validate calls the gRPC service to validate the SCEP challenge. The request
+// is bound to the given context and to the configured timeout.
+func (v *grpcChallengeValidator) Validate(ctx context.Context, csr *x509.CertificateRequest, provisionerName, challenge, transactionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	req := &grpcChallengeRequest{
+		ProvisionerName: provisionerName,
+		Challenge:       challenge,
+		TransactionID:   transactionID,
+	}
+	if csr != nil {
+		req.CSR = csr.Raw
+	}
+
+	resp := new(grpcChallengeResponse)
+	if err := v.conn.Invoke(ctx, scepGRPCChallengeMethod, req, resp, grpc.ForceCodec(grpcChallengeCodec{})); err != nil {
+		return fmt.Errorf("failed executing grpc challenge request: %w", err)
+	}
+	if !resp.Allow {
+		return ErrWebhookDenied
+	}
+	return nil
+}
+
+// grpcChallengeRequest is the ValidateChallengeRequest message.
+type grpcChallengeRequest struct {
+	ProvisionerName string
+	Challenge       string
+	TransactionID   string
+	CSR             []byte
+}
+
+func (r *grpcChallengeRequest) marshal() []byte {
+	var b []byte
+	for _, f := range []struct {
+		num   protowire.Number
+		value []byte
+	}{
+		{1, []byte(r.ProvisionerName)},
+		{2, []byte(r.Challenge)},
+		{3, []byte(r.TransactionID)},
+		{4, r.CSR},
+	} {
+		// Default values are not encoded in proto3.
+		if len(f.value) > 0 {
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendBytes(b, f.value)
+		}
+	}
+	return b
+}
+
+func (r *grpcChallengeRequest) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.BytesType && num >= 1 && num <= 4 {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			switch num {
+			case 1:
+				r.ProvisionerName = string(v)
+			case 2:
+				r.Challenge = string(v)
+			case 3:
+				r.TransactionID = string(v)
+			case 4:
+				r.CSR = append([]byte(nil), v...)
+			}
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// grpcChallengeResponse is the ValidateChallengeResponse message.
+type grpcChallengeResponse struct {
+	Allow bool
+}
+
+func (r *grpcChallengeResponse) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num == 1 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			r.Allow = protowire.DecodeBool(v)
+			b = b[n:]
+			continue
+		}
+		// Skip unknown fields.
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// grpcChallengeCodec encodes the challenge validation messages using the
+// protobuf wire format, so any standard gRPC server implementing the service
+// can be used.
+type grpcChallengeCodec struct{}
+
+func (grpcChallengeCodec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case *grpcChallengeRequest:
+		return m.marshal(), nil
+	case *grpcChallengeResponse:
+		if m.Allow {
+			return protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1), nil
+		}
+		return []byte{}, nil
+	default:
+		return nil, fmt.Errorf("unexpected grpc challenge message %T", v)
+	}
+}
+
+func (grpcChallengeCodec) Unmarshal(data []byte, v any) error {
+	switch m := v.(type) {
+	case *grpcChallengeResponse:
+		return m.unmarshal(data)
+	case *grpcChallengeRequest:
+		return m.unmarshal(data)
+	default:
+		return fmt.Errorf("unexpected grpc challenge message %T", v)
+	}
+}
+
+func (grpcChallengeCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,196 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+type testChallengeValidatorServer func(ctx context.Context, req *grpcChallengeRequest) (*grpcChallengeResponse, error)
+
+func newTestGRPCChallengeServer(t *testing.T, fn testChallengeValidatorServer) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(grpc.ForceServerCodec(grpcChallengeCodec{}))
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "smallstep.scep.v1.ChallengeValidator",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "ValidateChallenge",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				req := new(grpcChallengeRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return fn(ctx, req)
+			},
+		}},
+	}, struct{}{})
+
+	go srv.Serve(lis) //nolint:errcheck // test server
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func Test_grpcChallengeValidator_Validate(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte{1, 2, 3}}
+	endpoint := newTestGRPCChallengeServer(t, func(ctx context.Context, req *grpcChallengeRequest) (*grpcChallengeResponse, error) {
+		assert.Equal(t, "SCEP", req.ProvisionerName)
+		assert.Equal(t, "transaction-1", req.TransactionID)
+		switch req.Challenge {
+		case "allow":
+			assert.Equal(t, []byte{1, 2, 3}, req.CSR)
+			return &grpcChallengeResponse{Allow: true}, nil
+		case "deny":
+			return &grpcChallengeResponse{Allow: false}, nil
+		case "slow":
+			<-ctx.Done()
+			return nil, ctx.Err()
+		default:
+			return nil, status.Error(codes.InvalidArgument, "bad challenge")
+		}
+	})
+
+	v, err := newGRPCChallengeValidator(&SCEPGRPCChallenge{
+		Endpoint: endpoint,
+		Insecure: true,
+		Timeout:  &Duration{Duration: 200 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, v.timeout)
+
+	ctx := context.Background()
+	assert.NoError(t, v.Validate(ctx, csr, "SCEP", "allow", "transaction-1"))
+	// The connection is reused.
+	assert.NoError(t, v.Validate(ctx, csr, "SCEP", "allow", "transaction-1"))
+
+	err = v.Validate(ctx, csr, "SCEP", "deny", "transaction-1")
+	assert.ErrorIs(t, err, ErrSCEPChallengeInvalid)
+
+	err = v.Validate(ctx, csr, "SCEP", "other", "transaction-1")
+	assert.ErrorContains(t, err, "failed executing grpc challenge request")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = v.Validate(ctx, csr, "SCEP", "slow", "transaction-1")
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// The parent context is propagated.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = v.Validate(cancelCtx, csr, "SCEP", "allow", "transaction-1")
+	assert.Equal(t, codes.Canceled, status.Code(err))
+}
+
+func Test_newGRPCChallengeValidator(t *testing.T) {
+	dir := t.TempDir()
+	badRoot := filepath.Join(dir, "bad.crt")
+	require.NoError(t, os.WriteFile(badRoot, []byte("foo"), 0600))
+
+	tests := []struct {
+		name    string
+		cfg     *SCEPGRPCChallenge
+		timeout time.Duration
+		wantErr string
+	}{
+		{"ok/insecure", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Insecure: true}, defaultSCEPGRPCChallengeTimeout, ""},
+		{"ok/tls", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Root: "testdata/certs/root_ca.crt", Timeout: &Duration{Duration: time.Second}}, time.Second, ""},
+		{"ok/mtls", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Certificate: "testdata/certs/foo.crt", Key: "testdata/secrets/foo.key"}, defaultSCEPGRPCChallengeTimeout, ""},
+		{"fail/endpoint", &SCEPGRPCChallenge{}, 0, "grpcChallenge endpoint cannot be empty"},
+		{"fail/insecure-tls", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Insecure: true, Root: "testdata/certs/root_ca.crt"}, 0, "grpcChallenge cannot set TLS options with insecure"},
+		{"fail/root-missing", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Root: filepath.Join(dir, "missing.crt")}, 0, "error reading grpcChallenge root"},
+		{"fail/root-bad", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Root: badRoot}, 0, "error parsing grpcChallenge root: no certificates found"},
+		{"fail/crt-only", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Certificate: "testdata/certs/foo.crt"}, 0, "grpcChallenge crt and key must be set together"},
+		{"fail/crt-bad", &SCEPGRPCChallenge{Endpoint: "localhost:9000", Certificate: badRoot, Key: "testdata/secrets/foo.key"}, 0, "error loading grpcChallenge certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newGRPCChallengeValidator(tt.cfg)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.timeout, got.timeout)
+			assert.NoError(t, got.conn.Close())
+		})
+	}
+}
+
+func TestSCEP_ValidateChallenge_grpc(t *testing.T) {
+	endpoint := newTestGRPCChallengeServer(t, func(ctx context.Context, req *grpcChallengeRequest) (*grpcChallengeResponse, error) {
+		return &grpcChallengeResponse{Allow: req.Challenge == "grpc-challenge"}, nil
+	})
+
+	p := &SCEP{
+		Name:              "SCEP",
+		Type:              "SCEP",
+		ChallengePassword: "static-challenge",
+		GRPCChallenge: &SCEPGRPCChallenge{
+			Endpoint: endpoint,
+			Insecure: true,
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equal(t, validationMethodGRPC, p.selectValidationMethod())
+
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+	assert.NoError(t, p.ValidateChallenge(context.Background(), csr, "grpc-challenge", "transaction-1"))
+	assert.ErrorIs(t, p.ValidateChallenge(context.Background(), csr, "static-challenge", "transaction-1"), ErrSCEPChallengeInvalid)
+
+	// Closing the provisioner closes the connection.
+	conn := p.grpcChallengeValidator.conn
+	require.NoError(t, p.Close())
+	assert.Equal(t, connectivity.Shutdown, conn.GetState())
+	assert.Nil(t, p.grpcChallengeValidator)
+	assert.NoError(t, p.Close())
+}
+
+func Test_grpcChallengeCodec(t *testing.T) {
+	c := grpcChallengeCodec{}
+	assert.Equal(t, "proto", c.Name())
+
+	req := &grpcChallengeRequest{
+		ProvisionerName: "SCEP",
+		Challenge:       "challenge",
+		TransactionID:   "transaction-1",
+		CSR:             []byte{1, 2, 3},
+	}
+	b, err := c.Marshal(req)
+	require.NoError(t, err)
+	got := new(grpcChallengeRequest)
+	require.NoError(t, c.Unmarshal(b, got))
+	assert.Equal(t, req, got)
+
+	for _, allow := range []bool{true, false} {
+		b, err := c.Marshal(&grpcChallengeResponse{Allow: allow})
+		require.NoError(t, err)
+		resp := new(grpcChallengeResponse)
+		require.NoError(t, c.Unmarshal(b, resp))
+		assert.Equal(t, allow, resp.Allow)
+	}
+
+	// Unknown fields are skipped: field 2 (string "foo") and field 1 (true).
+	resp := new(grpcChallengeResponse)
+	require.NoError(t, c.Unmarshal([]byte{0x12, 0x03, 'f', 'o', 'o', 0x08, 0x01}, resp))
+	assert.True(t, resp.Allow)
+
+	assert.Error(t, c.Unmarshal([]byte{0x08}, resp))
+	_, err = c.Marshal("foo")
+	assert.Error(t, err)
+	assert.Error(t, c.Unmarshal(nil, new(string)))
+}
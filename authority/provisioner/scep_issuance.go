@@ -0,0 +1,303 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/webhook"
+)
+
+// DefaultSCEPIssuedChallengeTTL is the time an issued SCEP challenge can be
+// used if the provisioner does not configure it.
+const DefaultSCEPIssuedChallengeTTL = 10 * time.Minute
+
+// DefaultSCEPMaxIssuedChallenges is the maximum number of issued SCEP
+// challenges a provisioner keeps if it does not configure it.
+const DefaultSCEPMaxIssuedChallenges = 10000
+
+var (
+	// ErrSCEPChallengeIssuanceDisabled is returned when a challenge is
+	// requested from a SCEP provisioner that does not issue them.
+	ErrSCEPChallengeIssuanceDisabled = errors.New("scep challenge issuance is not enabled")
+	// ErrSCEPChallengeIssuanceUnauthorized is returned when a challenge is
+	// requested without the bearer token of the provisioner.
+	ErrSCEPChallengeIssuanceUnauthorized = errors.New("scep challenge request is not authorized")
+	// ErrSCEPChallengeAlreadyIssued is returned when a challenge is requested
+	// for a transaction that already has a challenge that has not expired.
+	ErrSCEPChallengeAlreadyIssued = errors.New("scep challenge already issued for the transaction")
+	// ErrSCEPTooManyIssuedChallenges is returned when a challenge is requested
+	// and the provisioner already keeps the maximum number of challenges.
+	ErrSCEPTooManyIssuedChallenges = errors.New("too many scep challenges issued")
+)
+
+// SCEPChallengeIssuance configures the issuance of one-time SCEP challenges.
+// Before enrolling, a client requests a challenge for its transaction ID, and
+// the CA gets a new challenge from the configured SCEPCHALLENGE webhook. The
+// webhook request sets scepIssueChallenge and scepTransactionID, and a server
+// that allows it must return the challenge in the data of the response:
+//
+//	{"allow": true, "data": {"challenge": "<challenge>"}}
+//
+// The enrollment with the same transaction ID must then use the issued
+// challenge, which can only be used once. The challenges are requested with
+// the configured bearer token, which must only be known by the MDM.
+//
+// The issued challenges are kept in memory by each provisioner instance. They
+// are lost when the provisioners are reloaded, and they are not shared by the
+// replicas of a CA, so the enrollment must reach the instance that issued the
+// challenge.
+type SCEPChallengeIssuance struct {
+	// Webhook is the name of the SCEPCHALLENGE webhook that issues the
+	// challenges. It's not used to validate challenges.
+	Webhook string `json:"webhook"`
+	// BearerToken is the token that authorizes the challenge requests, they
+	// must send it in the Authorization header.
+	BearerToken string `json:"bearerToken"`
+	// TTL is the time an issued challenge can be used. Defaults to 10m.
+	TTL *Duration `json:"ttl,omitempty"`
+	// MaxChallenges is the maximum number of challenges that have not been
+	// used or expired. Defaults to 10000.
+	MaxChallenges int `json:"maxChallenges,omitempty"`
+}
+
+// Validate returns an error if the challenge issuance options are not valid.
+func (o *SCEPChallengeIssuance) Validate() error {
+	switch {
+	case o.Webhook == "":
+		return errors.New("challengeIssuance webhook cannot be empty")
+	case o.BearerToken == "":
+		return errors.New("challengeIssuance bearerToken cannot be empty")
+	case o.TTL != nil && o.TTL.Duration <= 0:
+		return errors.New("challengeIssuance ttl must be positive")
+	case o.MaxChallenges < 0:
+		return errors.New("challengeIssuance maxChallenges cannot be negative")
+	}
+	return nil
+}
+
+func (o *SCEPChallengeIssuance) ttl() time.Duration {
+	if o.TTL != nil {
+		return o.TTL.Duration
+	}
+	return DefaultSCEPIssuedChallengeTTL
+}
+
+func (o *SCEPChallengeIssuance) maxChallenges() int {
+	if o.MaxChallenges > 0 {
+		return o.MaxChallenges
+	}
+	return DefaultSCEPMaxIssuedChallenges
+}
+
+// SCEPIssuedChallenge is a challenge issued for a SCEP transaction.
+type SCEPIssuedChallenge struct {
+	TransactionID string    `json:"transactionID"`
+	Challenge     string    `json:"challenge"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
+// challengeIssuer gets the SCEP challenges from a webhook and keeps them until
+// they are used or they expire.
+type challengeIssuer struct {
+	client  *http.Client
+	webhook *Webhook
+	retry   *WebhookRetry
+	token   string
+	store   *issuedChallengeStore
+}
+
+// newChallengeIssuer creates a new challengeIssuer that uses the configured
+// SCEPCHALLENGE webhook.
+func newChallengeIssuer(client *http.Client, webhooks []*Webhook, retry *WebhookRetry, o *SCEPChallengeIssuance) (*challengeIssuer, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	var wh *Webhook
+	for _, w := range webhooks {
+		if w.Name == o.Webhook {
+			wh = w
+			break
+		}
+	}
+	switch {
+	case wh == nil:
+		return nil, fmt.Errorf("challengeIssuance webhook %q is not configured", o.Webhook)
+	case wh.Kind != linkedca.Webhook_SCEPCHALLENGE.String():
+		return nil, fmt.Errorf("challengeIssuance webhook %q must be a SCEPCHALLENGE webhook", o.Webhook)
+	case !isCertTypeOK(wh):
+		return nil, fmt.Errorf("challengeIssuance webhook %q must be an X509 webhook", o.Webhook)
+	case wh.ResponseMapping != "":
+		return nil, fmt.Errorf("challengeIssuance webhook %q cannot set responseMapping", o.Webhook)
+	}
+	if retry == nil {
+		retry = defaultWebhookRetry
+	}
+	return &challengeIssuer{
+		client:  client,
+		webhook: wh,
+		retry:   retry,
+		token:   o.BearerToken,
+		store:   newIssuedChallengeStore(o.ttl(), o.maxChallenges(), time.Now),
+	}, nil
+}
+
+// Issue requests a new challenge for the given transaction from the webhook
+// and stores it. It returns ErrSCEPChallengeIssuanceUnauthorized if the token
+// is not the configured one, ErrSCEPChallengeAlreadyIssued if the transaction
+// already has a challenge, ErrSCEPTooManyIssuedChallenges if the store is
+// full, and ErrWebhookDenied if the webhook server did not allow the request.
+func (c *challengeIssuer) Issue(ctx context.Context, provisionerName, token, transactionID string) (*SCEPIssuedChallenge, error) {
+	if subtle.ConstantTimeCompare([]byte(c.token), []byte(token)) == 0 {
+		return nil, ErrSCEPChallengeIssuanceUnauthorized
+	}
+	if err := c.store.CanAdd(transactionID); err != nil {
+		return nil, err
+	}
+
+	req := &webhook.RequestBody{
+		ProvisionerName:    provisionerName,
+		SCEPTransactionID:  transactionID,
+		SCEPIssueChallenge: true,
+	}
+	if c.webhook.IncludeRequestMetadata {
+		req.RequestMetadata, _ = RequestMetadataFromContext(ctx)
+	}
+	resp, err := c.webhook.DoWithRetry(ctx, c.client, req, nil, c.retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed executing webhook request: %w", err)
+	}
+	if !resp.Allow {
+		return nil, ErrWebhookDenied
+	}
+
+	var data webhook.SCEPIssuedChallengeData
+	if b, err := json.Marshal(resp.Data); err == nil {
+		_ = json.Unmarshal(b, &data)
+	}
+	if data.Challenge == "" {
+		return nil, fmt.Errorf("webhook %q did not return a challenge", c.webhook.Name)
+	}
+
+	expiresAt, err := c.store.Add(transactionID, data.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	return &SCEPIssuedChallenge{
+		TransactionID: transactionID,
+		Challenge:     data.Challenge,
+		ExpiresAt:     expiresAt,
+	}, nil
+}
+
+// Validate consumes the challenge issued for the given transaction. It returns
+// an error if there's no challenge for the transaction, if it has expired or
+// if it does not match the given one.
+func (c *challengeIssuer) Validate(transactionID, challenge string) error {
+	return c.store.Consume(transactionID, challenge)
+}
+
+// issuedChallengeStore keeps the issued challenges in memory, keyed by the
+// transaction ID. Expired challenges are removed when new ones are added.
+type issuedChallengeStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	max        int
+	now        func() time.Time
+	challenges map[string]issuedChallenge
+}
+
+type issuedChallenge struct {
+	challenge string
+	expiresAt time.Time
+}
+
+func newIssuedChallengeStore(ttl time.Duration, maxChallenges int, now func() time.Time) *issuedChallengeStore {
+	return &issuedChallengeStore{
+		ttl:        ttl,
+		max:        maxChallenges,
+		now:        now,
+		challenges: make(map[string]issuedChallenge),
+	}
+}
+
+// CanAdd returns an error if the challenge of the given transaction cannot be
+// added. It's used to avoid requesting challenges that would not be stored.
+func (s *issuedChallengeStore) CanAdd(transactionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.canAdd(s.now(), transactionID)
+}
+
+// Add stores the challenge of the given transaction and returns the time it
+// expires. It does not replace the challenge of a transaction that has not
+// been used or expired, and it does not store more than the maximum number of
+// challenges.
+func (s *issuedChallengeStore) Add(transactionID, challenge string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for id, c := range s.challenges {
+		if !now.Before(c.expiresAt) {
+			delete(s.challenges, id)
+		}
+	}
+	if err := s.canAdd(now, transactionID); err != nil {
+		return time.Time{}, err
+	}
+	expiresAt := now.Add(s.ttl)
+	s.challenges[transactionID] = issuedChallenge{challenge: challenge, expiresAt: expiresAt}
+	return expiresAt, nil
+}
+
+func (s *issuedChallengeStore) canAdd(now time.Time, transactionID string) error {
+	if c, ok := s.challenges[transactionID]; ok && now.Before(c.expiresAt) {
+		return ErrSCEPChallengeAlreadyIssued
+	}
+	if len(s.challenges) >= s.max {
+		// Expired challenges are only removed when a challenge is added.
+		var active int
+		for _, c := range s.challenges {
+			if now.Before(c.expiresAt) {
+				active++
+			}
+		}
+		if active >= s.max {
+			return ErrSCEPTooManyIssuedChallenges
+		}
+	}
+	return nil
+}
+
+// Consume removes the challenge of the given transaction and checks it
+// matches the given one. A challenge is removed even if it does not match, so
+// a transaction only gets one attempt.
+func (s *issuedChallengeStore) Consume(transactionID, challenge string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[transactionID]
+	if !ok {
+		return fmt.Errorf("no challenge issued for transaction %q", transactionID)
+	}
+	delete(s.challenges, transactionID)
+	if !s.now().Before(c.expiresAt) {
+		return fmt.Errorf("challenge issued for transaction %q has expired", transactionID)
+	}
+	if subtle.ConstantTimeCompare([]byte(c.challenge), []byte(challenge)) == 0 {
+		return errors.New("invalid challenge password provided")
+	}
+	return nil
+}
+
+func (s *issuedChallengeStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.challenges)
+}
@@ -0,0 +1,259 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/webhook"
+)
+
+func newIssuanceSCEP(t *testing.T, url string, webhooks ...*Webhook) *SCEP {
+	t.Helper()
+	p := &SCEP{
+		Name: "SCEP",
+		Type: "SCEP",
+		Options: &Options{
+			Webhooks: append([]*Webhook{{
+				ID:     "webhook-id",
+				Name:   "issuer",
+				Secret: "MTIzNAo=",
+				Kind:   linkedca.Webhook_SCEPCHALLENGE.String(),
+				URL:    url,
+			}}, webhooks...),
+		},
+		ChallengeIssuance:     &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token", TTL: &Duration{Duration: time.Minute}, MaxChallenges: 4},
+		ChallengeWebhookRetry: &WebhookRetry{},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, WebhookClient: http.DefaultClient}))
+	return p
+}
+
+func TestSCEP_IssueChallenge(t *testing.T) {
+	var issued int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhook.RequestBody
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "SCEP", req.ProvisionerName)
+		assert.True(t, req.SCEPIssueChallenge)
+		assert.Empty(t, req.SCEPChallenge)
+		issued++
+		switch req.SCEPTransactionID {
+		case "denied":
+			json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: false})
+		case "empty":
+			json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: true})
+		default:
+			json.NewEncoder(w).Encode(webhook.ResponseBody{
+				Allow: true,
+				Data:  webhook.SCEPIssuedChallengeData{Challenge: req.SCEPTransactionID + "-challenge"},
+			})
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+	p := newIssuanceSCEP(t, srv.URL)
+	now := time.Now()
+	p.challengeIssuer.store.now = func() time.Time { return now }
+
+	ch, err := p.IssueChallenge(ctx, "token", "tx-1")
+	require.NoError(t, err)
+	assert.Equal(t, &SCEPIssuedChallenge{
+		TransactionID: "tx-1",
+		Challenge:     "tx-1-challenge",
+		ExpiresAt:     now.Add(time.Minute),
+	}, ch)
+	assert.Equal(t, 1, issued)
+
+	// The request must use the bearer token, and a transaction cannot get a
+	// new challenge until the issued one is used or expires.
+	_, err = p.IssueChallenge(ctx, "other", "tx-1")
+	assert.ErrorIs(t, err, ErrSCEPChallengeIssuanceUnauthorized)
+	_, err = p.IssueChallenge(ctx, "token", "tx-1")
+	assert.ErrorIs(t, err, ErrSCEPChallengeAlreadyIssued)
+	assert.Equal(t, 1, issued)
+
+	// An issued challenge can only be used once.
+	assert.NoError(t, p.ValidateChallenge(ctx, csr, "tx-1-challenge", "tx-1"))
+	assert.EqualError(t, p.ValidateChallenge(ctx, csr, "tx-1-challenge", "tx-1"), `no challenge issued for transaction "tx-1"`)
+
+	// The challenge of another transaction is rejected.
+	_, err = p.IssueChallenge(ctx, "token", "tx-2")
+	require.NoError(t, err)
+	assert.EqualError(t, p.ValidateChallenge(ctx, csr, "tx-1-challenge", "tx-2"), "invalid challenge password provided")
+	assert.Error(t, p.ValidateChallenge(ctx, csr, "tx-2-challenge", "tx-2"))
+
+	// Expired challenges are rejected.
+	_, err = p.IssueChallenge(ctx, "token", "tx-3")
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	assert.EqualError(t, p.ValidateChallenge(ctx, csr, "tx-3-challenge", "tx-3"), `challenge issued for transaction "tx-3" has expired`)
+
+	// The webhook must allow the request and return a challenge.
+	_, err = p.IssueChallenge(ctx, "token", "denied")
+	assert.ErrorIs(t, err, ErrWebhookDenied)
+	_, err = p.IssueChallenge(ctx, "token", "empty")
+	assert.EqualError(t, err, `webhook "issuer" did not return a challenge`)
+	_, err = p.IssueChallenge(ctx, "token", "")
+	assert.Error(t, err)
+
+	// Provisioners without challenge issuance.
+	p = &SCEP{Name: "SCEP", Type: "SCEP", ChallengePassword: "secret"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	_, err = p.IssueChallenge(ctx, "token", "tx-1")
+	assert.ErrorIs(t, err, ErrSCEPChallengeIssuanceDisabled)
+}
+
+func TestSCEP_ValidateChallenge_issuedWithWebhooks(t *testing.T) {
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: true, Data: map[string]any{"challenge": "issued"}})
+	}))
+	defer issuer.Close()
+	var validated []string
+	validator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhook.RequestBody
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		validated = append(validated, req.SCEPChallenge)
+		json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: req.SCEPTransactionID == "tx-1"})
+	}))
+	defer validator.Close()
+
+	ctx := context.Background()
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+	p := newIssuanceSCEP(t, issuer.URL, &Webhook{
+		ID:     "validator-id",
+		Name:   "validator",
+		Secret: "MTIzNAo=",
+		Kind:   linkedca.Webhook_SCEPCHALLENGE.String(),
+		URL:    validator.URL,
+	})
+	require.Len(t, p.challengeValidationController.webhooks, 1)
+
+	// The validation webhooks are called after checking the issued challenge.
+	for _, id := range []string{"tx-1", "tx-2"} {
+		_, err := p.IssueChallenge(ctx, "token", id)
+		require.NoError(t, err)
+	}
+	assert.NoError(t, p.ValidateChallenge(ctx, csr, "issued", "tx-1"))
+	assert.ErrorIs(t, p.ValidateChallenge(ctx, csr, "issued", "tx-2"), ErrWebhookDenied)
+	assert.Equal(t, []string{"issued", "issued"}, validated)
+}
+
+func TestSCEP_Init_challengeIssuance(t *testing.T) {
+	issuer := &Webhook{Name: "issuer", Kind: linkedca.Webhook_SCEPCHALLENGE.String()}
+	tests := []struct {
+		name   string
+		p      *SCEP
+		expErr error
+	}{
+		{"fail/no-webhook", &SCEP{
+			ChallengeIssuance: &SCEPChallengeIssuance{},
+		}, errors.New("challengeIssuance webhook cannot be empty")},
+		{"fail/no-bearer-token", &SCEP{
+			Options:           &Options{Webhooks: []*Webhook{issuer}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer"},
+		}, errors.New("challengeIssuance bearerToken cannot be empty")},
+		{"fail/max-challenges", &SCEP{
+			Options:           &Options{Webhooks: []*Webhook{issuer}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token", MaxChallenges: -1},
+		}, errors.New("challengeIssuance maxChallenges cannot be negative")},
+		{"fail/ttl", &SCEP{
+			Options:           &Options{Webhooks: []*Webhook{issuer}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token", TTL: &Duration{}},
+		}, errors.New("challengeIssuance ttl must be positive")},
+		{"fail/missing-webhook", &SCEP{
+			Options:           &Options{Webhooks: []*Webhook{issuer}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "foo", BearerToken: "token"},
+		}, errors.New(`challengeIssuance webhook "foo" is not configured`)},
+		{"fail/webhook-kind", &SCEP{
+			Options: &Options{Webhooks: []*Webhook{
+				{Name: "issuer", Kind: linkedca.Webhook_NOTIFYING.String()},
+			}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token"},
+		}, errors.New(`challengeIssuance webhook "issuer" must be a SCEPCHALLENGE webhook`)},
+		{"fail/webhook-response-mapping", &SCEP{
+			Options: &Options{Webhooks: []*Webhook{
+				{Name: "issuer", Kind: linkedca.Webhook_SCEPCHALLENGE.String(), ResponseMapping: "true"},
+			}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token"},
+		}, errors.New(`challengeIssuance webhook "issuer" cannot set responseMapping`)},
+		{"fail/static-challenge", &SCEP{
+			ChallengePassword: "secret",
+			Options:           &Options{Webhooks: []*Webhook{issuer}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token"},
+		}, errors.New("challengeIssuance cannot be combined with a static challenge")},
+		{"fail/grpc-challenge", &SCEP{
+			GRPCChallenge:     &SCEPGRPCChallenge{Endpoint: "localhost:443"},
+			Options:           &Options{Webhooks: []*Webhook{issuer}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token"},
+		}, errors.New("challengeIssuance cannot be combined with grpcChallenge")},
+		{"ok", &SCEP{
+			Options:           &Options{Webhooks: []*Webhook{issuer}},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token"},
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.p.Name, tt.p.Type = "SCEP", "SCEP"
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.expErr != nil {
+				assert.EqualError(t, err, tt.expErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, DefaultSCEPIssuedChallengeTTL, tt.p.challengeIssuer.store.ttl)
+			assert.Equal(t, DefaultSCEPMaxIssuedChallenges, tt.p.challengeIssuer.store.max)
+			assert.Empty(t, tt.p.challengeValidationController.webhooks)
+		})
+	}
+}
+
+func Test_issuedChallengeStore(t *testing.T) {
+	now := time.Now()
+	s := newIssuedChallengeStore(time.Minute, 3, func() time.Time { return now })
+
+	expiresAt, err := s.Add("tx-1", "one")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), expiresAt)
+	now = now.Add(30 * time.Second)
+	_, err = s.Add("tx-2", "two")
+	require.NoError(t, err)
+	_, err = s.Add("tx-3", "three")
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.Len())
+
+	// A challenge that has not expired is not replaced.
+	assert.ErrorIs(t, s.CanAdd("tx-3"), ErrSCEPChallengeAlreadyIssued)
+	_, err = s.Add("tx-3", "four")
+	assert.ErrorIs(t, err, ErrSCEPChallengeAlreadyIssued)
+
+	// The store does not keep more than the maximum number of challenges.
+	assert.ErrorIs(t, s.CanAdd("tx-4"), ErrSCEPTooManyIssuedChallenges)
+	_, err = s.Add("tx-4", "four")
+	assert.ErrorIs(t, err, ErrSCEPTooManyIssuedChallenges)
+
+	// Adding a challenge removes the expired ones.
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, s.CanAdd("tx-4"))
+	_, err = s.Add("tx-4", "five")
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.Len())
+	assert.EqualError(t, s.Consume("tx-1", "one"), `no challenge issued for transaction "tx-1"`)
+
+	// A mismatched challenge also consumes the issued one.
+	assert.EqualError(t, s.Consume("tx-3", "four"), "invalid challenge password provided")
+	assert.EqualError(t, s.Consume("tx-3", "three"), `no challenge issued for transaction "tx-3"`)
+	assert.NoError(t, s.Consume("tx-2", "two"))
+	assert.Equal(t, 1, s.Len())
+}
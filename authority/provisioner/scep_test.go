@@ -10,11 +10,14 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/smallstep/certificates/webhook"
 	"github.com/stretchr/testify/assert"
@@ -22,6 +25,7 @@ import (
 	"go.step.sm/crypto/kms/softkms"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 )
 
@@ -50,6 +54,13 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 		w.WriteHeader(200)
 		w.Write(b)
 	}))
+	denyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.Marshal(response{Allow: false})
+		require.NoError(t, err)
+		w.WriteHeader(200)
+		w.Write(b)
+	}))
+	defer denyServer.Close()
 	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req := &request{}
 		err := json.NewDecoder(r.Body).Decode(req)
@@ -137,6 +148,75 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 			server: nokServer,
 			expErr: errors.New("webhook server did not allow request"),
 		},
+		{
+			name: "fail/errors",
+			fields: fields{http.DefaultClient, []*Webhook{
+				{
+					ID:       "webhook-id-1",
+					Name:     "webhook-name-1",
+					Secret:   "{{}}",
+					Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+					CertType: linkedca.Webhook_X509.String(),
+					URL:      denyServer.URL,
+				},
+				{
+					ID:       "webhook-id-2",
+					Name:     "webhook-name-2",
+					Secret:   "MTIzNAo=",
+					Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+					CertType: linkedca.Webhook_X509.String(),
+					URL:      denyServer.URL,
+				},
+				{
+					ID:       "webhook-id-3",
+					Name:     "webhook-name-3",
+					Secret:   "{{{}}}",
+					Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+					CertType: linkedca.Webhook_X509.String(),
+					URL:      denyServer.URL,
+				},
+			}},
+			args: args{
+				provisionerName: "my-scep-provisioner",
+				challenge:       "not-allowed",
+				transactionID:   "transaction-1",
+			},
+			expErr: errors.New("failed executing webhook request: illegal base64 data at input byte 0\nfailed executing webhook request: illegal base64 data at input byte 0"),
+		},
+		{
+			name: "ok/deny-and-allow",
+			fields: fields{http.DefaultClient, []*Webhook{
+				{
+					ID:       "webhook-id-1",
+					Name:     "webhook-name-1",
+					Secret:   "MTIzNAo=",
+					Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+					CertType: linkedca.Webhook_X509.String(),
+					URL:      denyServer.URL,
+				},
+				{
+					ID:       "webhook-id-2",
+					Name:     "webhook-name-2",
+					Secret:   "{{}}",
+					Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+					CertType: linkedca.Webhook_X509.String(),
+					URL:      okServer.URL,
+				},
+				{
+					ID:       "webhook-id-3",
+					Name:     "webhook-name-3",
+					Secret:   "MTIzNAo=",
+					Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+					CertType: linkedca.Webhook_X509.String(),
+					URL:      okServer.URL,
+				},
+			}},
+			args: args{
+				provisionerName: "my-scep-provisioner",
+				challenge:       "challenge",
+				transactionID:   "transaction-1",
+			},
+		},
 		{
 			name: "ok",
 			fields: fields{http.DefaultClient, []*Webhook{
@@ -159,7 +239,7 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := newChallengeValidationController(tt.fields.client, tt.fields.webhooks)
+			c := newChallengeValidationController(tt.fields.client, tt.fields.webhooks, nil)
 
 			if tt.server != nil {
 				defer tt.server.Close()
@@ -178,6 +258,140 @@ func Test_challengeValidationController_Validate(t *testing.T) {
 	}
 }
 
+func Test_challengeValidationController_Validate_denied(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+	denyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"allow":false}`))
+	}))
+	defer denyServer.Close()
+	failServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`not json`))
+	}))
+	defer failServer.Close()
+
+	newWebhook := func(url string) *Webhook {
+		return &Webhook{
+			ID:       "webhook-id",
+			Name:     "webhook-name",
+			Secret:   "MTIzNAo=",
+			Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+			CertType: linkedca.Webhook_X509.String(),
+			URL:      url,
+		}
+	}
+	retry := &WebhookRetry{}
+
+	// An explicit deny.
+	c := newChallengeValidationController(http.DefaultClient, []*Webhook{newWebhook(denyServer.URL)}, retry)
+	err := c.Validate(context.Background(), csr, "SCEP", "challenge", "transaction-1")
+	assert.ErrorIs(t, err, ErrWebhookDenied)
+	assert.ErrorIs(t, err, ErrSCEPChallengeInvalid)
+	assert.EqualError(t, err, "webhook server did not allow request")
+
+	// A failed request is not a deny.
+	c = newChallengeValidationController(http.DefaultClient, []*Webhook{newWebhook(denyServer.URL), newWebhook(failServer.URL)}, retry)
+	err = c.Validate(context.Background(), csr, "SCEP", "challenge", "transaction-1")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrWebhookDenied)
+	assert.Contains(t, err.Error(), "failed executing webhook request: ")
+}
+
+func Test_challengeValidationController_Validate_responseMapping(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/approved":
+			w.Write([]byte(`{"result":"approved"}`))
+		case "/rejected":
+			w.Write([]byte(`{"result":"rejected"}`))
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Write([]byte(`OK`))
+		}
+	}))
+	defer srv.Close()
+
+	newWebhook := func(path, mapping string) *Webhook {
+		return &Webhook{
+			Name:            path,
+			Kind:            linkedca.Webhook_SCEPCHALLENGE.String(),
+			CertType:        linkedca.Webhook_X509.String(),
+			URL:             srv.URL + path,
+			Secret:          "MTIzNAo=",
+			ResponseMapping: mapping,
+		}
+	}
+	resultMapping := `{{ eq .Body.result "approved" }}`
+	tests := []struct {
+		name    string
+		webhook *Webhook
+		wantErr string
+	}{
+		{"ok/body", newWebhook("/approved", resultMapping), ""},
+		{"ok/status", newWebhook("/no-content", `{{ eq .StatusCode 204 }}`), ""},
+		{"ok/text", newWebhook("/text", `{{ eq .Body "OK" }}`), ""},
+		{"fail/denied", newWebhook("/rejected", resultMapping), "webhook server did not allow request"},
+		{"fail/status", newWebhook("/approved", `{{ eq .StatusCode 204 }}`), "webhook server did not allow request"},
+		{"fail/missing", newWebhook("/no-content", resultMapping), `failed executing webhook request: webhook "/no-content" responseMapping failed: template: responseMapping:1:11: executing "responseMapping" at <.Body.result>: nil pointer evaluating interface {}.result`},
+		{"fail/not-bool", newWebhook("/approved", `{{ .Body.result }}`), `failed executing webhook request: webhook "/approved" responseMapping returned "approved", it must return true or false`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.webhook.Validate())
+			c := newChallengeValidationController(srv.Client(), []*Webhook{tt.webhook}, &WebhookRetry{})
+			err := c.Validate(context.Background(), csr, "SCEP", "challenge", "transaction-1")
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_challengeValidationController_Validate_requestMetadata(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+	var got map[string]*webhook.RequestMetadata
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhook.RequestBody
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		got[r.URL.Path] = req.RequestMetadata
+		w.Write([]byte(`{"allow":false}`))
+	}))
+	defer srv.Close()
+
+	newWebhook := func(path string, include bool) *Webhook {
+		return &Webhook{
+			Name:                   path,
+			Kind:                   linkedca.Webhook_SCEPCHALLENGE.String(),
+			CertType:               linkedca.Webhook_X509.String(),
+			URL:                    srv.URL + path,
+			Secret:                 "MTIzNAo=",
+			IncludeRequestMetadata: include,
+		}
+	}
+	c := newChallengeValidationController(srv.Client(), []*Webhook{
+		newWebhook("/with", true),
+		newWebhook("/without", false),
+	}, &WebhookRetry{})
+
+	md := &webhook.RequestMetadata{
+		RemoteAddr:   "10.0.0.1",
+		ForwardedFor: []string{"192.168.0.1"},
+		UserAgent:    "scep-client/1.0",
+	}
+	got = map[string]*webhook.RequestMetadata{}
+	ctx := NewContextWithRequestMetadata(context.Background(), md)
+	assert.ErrorIs(t, c.Validate(ctx, csr, "SCEP", "challenge", "transaction-1"), ErrWebhookDenied)
+	assert.Equal(t, map[string]*webhook.RequestMetadata{"/with": md, "/without": nil}, got)
+
+	// The metadata is optional.
+	got = map[string]*webhook.RequestMetadata{}
+	assert.ErrorIs(t, c.Validate(context.Background(), csr, "SCEP", "challenge", "transaction-1"), ErrWebhookDenied)
+	assert.Equal(t, map[string]*webhook.RequestMetadata{"/with": nil, "/without": nil}, got)
+}
+
 func TestController_isCertTypeOK(t *testing.T) {
 	assert.True(t, isCertTypeOK(&Webhook{CertType: linkedca.Webhook_X509.String()}))
 	assert.True(t, isCertTypeOK(&Webhook{CertType: linkedca.Webhook_ALL.String()}))
@@ -207,6 +421,18 @@ func Test_selectValidationMethod(t *testing.T) {
 			Type:              "SCEP",
 			ChallengePassword: "pass",
 		}, "static"},
+		{"challenge-with-webhooks", &SCEP{
+			Name: "SCEP",
+			Type: "SCEP",
+			Options: &Options{
+				Webhooks: []*Webhook{
+					{
+						Kind: linkedca.Webhook_SCEPCHALLENGE.String(),
+					},
+				},
+			},
+			ChallengePassword: "pass",
+		}, "combined"},
 		{"challenge-with-different-webhook", &SCEP{
 			Name: "SCEP",
 			Type: "SCEP",
@@ -219,6 +445,19 @@ func Test_selectValidationMethod(t *testing.T) {
 			},
 			ChallengePassword: "pass",
 		}, "static"},
+		{"issued", &SCEP{
+			Name: "SCEP",
+			Type: "SCEP",
+			Options: &Options{
+				Webhooks: []*Webhook{
+					{
+						Name: "issuer",
+						Kind: linkedca.Webhook_SCEPCHALLENGE.String(),
+					},
+				},
+			},
+			ChallengeIssuance: &SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token"},
+		}, "issued"},
 		{"none", &SCEP{
 			Name: "SCEP",
 			Type: "SCEP",
@@ -273,6 +512,13 @@ func TestSCEP_ValidateChallenge(t *testing.T) {
 		w.WriteHeader(200)
 		w.Write(b)
 	}))
+	denyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.Marshal(response{Allow: false})
+		require.NoError(t, err)
+		w.WriteHeader(200)
+		w.Write(b)
+	}))
+	defer denyServer.Close()
 	type args struct {
 		challenge     string
 		transactionID string
@@ -284,6 +530,63 @@ func TestSCEP_ValidateChallenge(t *testing.T) {
 		args   args
 		expErr error
 	}{
+		{"ok/combined", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			ChallengePassword: "webhook-challenge",
+			Options: &Options{
+				Webhooks: []*Webhook{
+					{
+						ID:       "webhook-id-1",
+						Name:     "webhook-name-1",
+						Secret:   "MTIzNAo=",
+						Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+						CertType: linkedca.Webhook_X509.String(),
+						URL:      okServer.URL,
+					},
+				},
+			},
+		}, nil, args{"webhook-challenge", "webhook-transaction-1"},
+			nil,
+		},
+		{"fail/combined-wrong-static-challenge", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			ChallengePassword: "secret-static-challenge",
+			Options: &Options{
+				Webhooks: []*Webhook{
+					{
+						ID:       "webhook-id-1",
+						Name:     "webhook-name-1",
+						Secret:   "MTIzNAo=",
+						Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+						CertType: linkedca.Webhook_X509.String(),
+						URL:      okServer.URL,
+					},
+				},
+			},
+		}, nil, args{"webhook-challenge", "webhook-transaction-1"},
+			errors.New("invalid challenge password provided"),
+		},
+		{"fail/combined-webhook-denied", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			ChallengePassword: "secret-static-challenge",
+			Options: &Options{
+				Webhooks: []*Webhook{
+					{
+						ID:       "webhook-id-1",
+						Name:     "webhook-name-1",
+						Secret:   "MTIzNAo=",
+						Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+						CertType: linkedca.Webhook_X509.String(),
+						URL:      denyServer.URL,
+					},
+				},
+			},
+		}, nil, args{"secret-static-challenge", "static-transaction-1"},
+			ErrSCEPChallengeInvalid,
+		},
 		{"ok/webhooks", &SCEP{
 			Name: "SCEP",
 			Type: "SCEP",
@@ -632,6 +935,24 @@ func TestSCEP_Init(t *testing.T) {
 			DecrypterKeyPassword:          "password",
 			EncryptionAlgorithmIdentifier: 0,
 		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"ok webhook signingAlg", &SCEP{
+			Type: "SCEP",
+			Name: "scep",
+			Options: &Options{Webhooks: []*Webhook{{
+				Name:       "webhook",
+				Kind:       linkedca.Webhook_SCEPCHALLENGE.String(),
+				SigningAlg: WebhookSigningAlgSHA384,
+			}}},
+		}, args{Config{Claims: globalProvisionerClaims}}, false},
+		{"fail webhook signingAlg", &SCEP{
+			Type: "SCEP",
+			Name: "scep",
+			Options: &Options{Webhooks: []*Webhook{{
+				Name:       "webhook",
+				Kind:       linkedca.Webhook_SCEPCHALLENGE.String(),
+				SigningAlg: "MD5",
+			}}},
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -641,3 +962,111 @@ func TestSCEP_Init(t *testing.T) {
 		})
 	}
 }
+
+func Test_newChallengeRequestBody(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	u, err := url.Parse("https://example.com/device")
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:         "device-1",
+			Organization:       []string{"Smallstep"},
+			OrganizationalUnit: []string{"Devices"},
+		},
+		DNSNames:       []string{"device-1.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		EmailAddresses: []string{"device@example.com"},
+		URIs:           []*url.URL{u},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	assertParsed := func(t *testing.T, req *webhook.RequestBody) {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require.NoError(t, err)
+		var got struct {
+			Request webhook.X509CertificateRequest `json:"x509CertificateRequest"`
+		}
+		require.NoError(t, json.Unmarshal(b, &got))
+		assert.Equal(t, der, got.Request.Raw)
+		assert.Equal(t, "device-1", got.Request.Subject.CommonName)
+		assert.Equal(t, x509util.MultiString{"Smallstep"}, got.Request.Subject.Organization)
+		assert.Equal(t, x509util.MultiString{"Devices"}, got.Request.Subject.OrganizationalUnit)
+		assert.Equal(t, x509util.MultiString{"device-1.example.com"}, got.Request.DNSNames)
+		assert.Equal(t, x509util.MultiString{"device@example.com"}, got.Request.EmailAddresses)
+		if assert.Len(t, got.Request.IPAddresses, 1) {
+			assert.True(t, got.Request.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+		}
+		if assert.Len(t, got.Request.URIs, 1) {
+			assert.Equal(t, u.String(), got.Request.URIs[0].String())
+		}
+		assert.Equal(t, "RSA", got.Request.PublicKeyAlgorithm)
+		assert.NotEmpty(t, got.Request.PublicKey)
+	}
+
+	t.Run("ok/parsed", func(t *testing.T) {
+		assertParsed(t, newChallengeRequestBody(csr))
+	})
+
+	t.Run("ok/raw-only", func(t *testing.T) {
+		assertParsed(t, newChallengeRequestBody(&x509.CertificateRequest{Raw: der}))
+	})
+
+	t.Run("ok/malformed", func(t *testing.T) {
+		req := newChallengeRequestBody(&x509.CertificateRequest{Raw: []byte{1, 2, 3}})
+		if assert.NotNil(t, req.X509CertificateRequest) {
+			assert.Equal(t, []byte{1, 2, 3}, req.X509CertificateRequest.Raw)
+			assert.Empty(t, req.X509CertificateRequest.Subject.CommonName)
+			assert.Empty(t, req.X509CertificateRequest.DNSNames)
+			assert.Empty(t, req.X509CertificateRequest.PublicKey)
+		}
+	})
+
+	t.Run("ok/unsupported-key", func(t *testing.T) {
+		req := newChallengeRequestBody(&x509.CertificateRequest{Raw: []byte{1}, PublicKey: "foo"})
+		if assert.NotNil(t, req.X509CertificateRequest) {
+			assert.Equal(t, []byte{1}, req.X509CertificateRequest.Raw)
+			assert.Empty(t, req.X509CertificateRequest.PublicKey)
+		}
+	})
+}
+
+func Test_challengeValidationController_Validate_retry(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"allow":true}`))
+	}))
+	defer srv.Close()
+
+	webhooks := []*Webhook{{
+		ID:       "webhook-id-1",
+		Name:     "webhook-name-1",
+		Secret:   "MTIzNAo=",
+		Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+		CertType: linkedca.Webhook_X509.String(),
+		URL:      srv.URL,
+	}}
+	csr := &x509.CertificateRequest{Raw: []byte{1}}
+
+	// A single retry is not enough.
+	c := newChallengeValidationController(http.DefaultClient, webhooks, &WebhookRetry{BaseDelay: &Duration{Duration: time.Millisecond}, MaxRetries: 1})
+	err := c.Validate(context.Background(), csr, "my-scep-provisioner", "challenge", "transaction-1")
+	assert.EqualError(t, err, "failed executing webhook request: Webhook server responded with 503")
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	c = newChallengeValidationController(http.DefaultClient, webhooks, &WebhookRetry{BaseDelay: &Duration{Duration: time.Millisecond}, MaxRetries: 3})
+	assert.NoError(t, c.Validate(context.Background(), csr, "my-scep-provisioner", "challenge", "transaction-1"))
+	assert.Equal(t, 3, attempts)
+
+	c = newChallengeValidationController(http.DefaultClient, webhooks, nil)
+	assert.Equal(t, defaultWebhookRetry, c.retry)
+}
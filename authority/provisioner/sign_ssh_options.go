@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -419,6 +421,73 @@ func (v *sshNamePolicyValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions)
 	}
 }
 
+// sshExtensionsModifier removes or rejects the critical options and extensions
+// that are not allowed by the provisioner options. It runs after the template
+// has been rendered.
+type sshExtensionsModifier struct {
+	user *SSHExtensionsOptions
+	host *SSHExtensionsOptions
+}
+
+// newSSHExtensionsModifier returns a new modifier using the user and host
+// extensions options.
+func newSSHExtensionsModifier(o *SSHOptions) *sshExtensionsModifier {
+	if o == nil {
+		return &sshExtensionsModifier{}
+	}
+	return &sshExtensionsModifier{
+		user: o.UserExtensions,
+		host: o.HostExtensions,
+	}
+}
+
+// Modify implements the SSHCertModifier interface.
+func (m *sshExtensionsModifier) Modify(cert *ssh.Certificate, _ SignSSHOptions) error {
+	var o *SSHExtensionsOptions
+	switch cert.CertType {
+	case ssh.UserCert:
+		o = m.user
+	case ssh.HostCert:
+		o = m.host
+	}
+	if o == nil {
+		return nil
+	}
+	if err := filterSSHOptions(cert.CriticalOptions, "critical option", o.AllowedCriticalOptions, o.DeniedCriticalOptions, o.Strip); err != nil {
+		return err
+	}
+	return filterSSHOptions(cert.Extensions, "extension", o.AllowedExtensions, o.DeniedExtensions, o.Strip)
+}
+
+// filterSSHOptions deletes the entries in m that are not allowed if strip is
+// true, or returns an error for the first one otherwise.
+func filterSSHOptions(m map[string]string, kind string, allowed, denied []string, strip bool) error {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if isSSHOptionAllowed(name, allowed, denied) {
+			continue
+		}
+		if !strip {
+			return errors.Errorf("ssh certificate %s %q is not allowed", kind, name)
+		}
+		delete(m, name)
+	}
+	return nil
+}
+
+// isSSHOptionAllowed reports whether name is allowed. Denied names always win,
+// and if there are allowed names, name must be one of them.
+func isSSHOptionAllowed(name string, allowed, denied []string) bool {
+	if slices.Contains(denied, name) {
+		return false
+	}
+	return len(allowed) == 0 || slices.Contains(allowed, name)
+}
+
 // sshCertTypeUInt32
 func sshCertTypeUInt32(ct string) uint32 {
 	switch ct {
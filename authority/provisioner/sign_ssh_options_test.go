@@ -227,6 +227,102 @@ func Test_sshCertValidAfterModifier_Modify(t *testing.T) {
 	}
 }
 
+func Test_sshExtensionsModifier_Modify(t *testing.T) {
+	newCert := func(certType uint32) *ssh.Certificate {
+		return &ssh.Certificate{
+			CertType: certType,
+			Permissions: ssh.Permissions{
+				CriticalOptions: map[string]string{"force-command": "/bin/true", "source-address": "10.0.0.0/8"},
+				Extensions:      map[string]string{"permit-pty": "", "permit-port-forwarding": "", "permit-X11-forwarding": ""},
+			},
+		}
+	}
+	tests := map[string]struct {
+		options         *SSHOptions
+		certType        uint32
+		criticalOptions map[string]string
+		extensions      map[string]string
+		err             error
+	}{
+		"ok/no-options": {
+			options:         nil,
+			certType:        ssh.UserCert,
+			criticalOptions: map[string]string{"force-command": "/bin/true", "source-address": "10.0.0.0/8"},
+			extensions:      map[string]string{"permit-pty": "", "permit-port-forwarding": "", "permit-X11-forwarding": ""},
+		},
+		"ok/host-options-on-user-cert": {
+			options:         &SSHOptions{HostExtensions: &SSHExtensionsOptions{DeniedExtensions: []string{"permit-pty"}}},
+			certType:        ssh.UserCert,
+			criticalOptions: map[string]string{"force-command": "/bin/true", "source-address": "10.0.0.0/8"},
+			extensions:      map[string]string{"permit-pty": "", "permit-port-forwarding": "", "permit-X11-forwarding": ""},
+		},
+		"ok/allowed": {
+			options: &SSHOptions{UserExtensions: &SSHExtensionsOptions{
+				AllowedCriticalOptions: []string{"force-command", "source-address"},
+				AllowedExtensions:      []string{"permit-pty", "permit-port-forwarding", "permit-X11-forwarding", "permit-agent-forwarding"},
+			}},
+			certType:        ssh.UserCert,
+			criticalOptions: map[string]string{"force-command": "/bin/true", "source-address": "10.0.0.0/8"},
+			extensions:      map[string]string{"permit-pty": "", "permit-port-forwarding": "", "permit-X11-forwarding": ""},
+		},
+		"ok/strip-denied": {
+			options: &SSHOptions{UserExtensions: &SSHExtensionsOptions{
+				DeniedCriticalOptions: []string{"force-command"},
+				DeniedExtensions:      []string{"permit-X11-forwarding"},
+				Strip:                 true,
+			}},
+			certType:        ssh.UserCert,
+			criticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+			extensions:      map[string]string{"permit-pty": "", "permit-port-forwarding": ""},
+		},
+		"ok/strip-not-allowed": {
+			options: &SSHOptions{HostExtensions: &SSHExtensionsOptions{
+				AllowedCriticalOptions: []string{"source-address"},
+				AllowedExtensions:      []string{"permit-pty", "permit-port-forwarding"},
+				DeniedExtensions:       []string{"permit-port-forwarding"},
+				Strip:                  true,
+			}},
+			certType:        ssh.HostCert,
+			criticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+			extensions:      map[string]string{"permit-pty": ""},
+		},
+		"fail/denied-extension": {
+			options:  &SSHOptions{UserExtensions: &SSHExtensionsOptions{DeniedExtensions: []string{"permit-X11-forwarding"}}},
+			certType: ssh.UserCert,
+			err:      errors.New(`ssh certificate extension "permit-X11-forwarding" is not allowed`),
+		},
+		"fail/deny-wins": {
+			options: &SSHOptions{UserExtensions: &SSHExtensionsOptions{
+				AllowedExtensions: []string{"permit-pty", "permit-port-forwarding", "permit-X11-forwarding"},
+				DeniedExtensions:  []string{"permit-pty"},
+			}},
+			certType: ssh.UserCert,
+			err:      errors.New(`ssh certificate extension "permit-pty" is not allowed`),
+		},
+		"fail/critical-option-not-allowed": {
+			options:  &SSHOptions{HostExtensions: &SSHExtensionsOptions{AllowedCriticalOptions: []string{"source-address"}}},
+			certType: ssh.HostCert,
+			err:      errors.New(`ssh certificate critical option "force-command" is not allowed`),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cert := newCert(tc.certType)
+			err := newSSHExtensionsModifier(tc.options).Modify(cert, SignSSHOptions{})
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tc.err.Error(), err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equals(t, tc.criticalOptions, cert.CriticalOptions)
+				assert.Equals(t, tc.extensions, cert.Extensions)
+			}
+		})
+	}
+}
+
 func Test_sshCertDefaultValidator_Valid(t *testing.T) {
 	pub, _, err := keyutil.GenerateDefaultKeyPair()
 	assert.FatalError(t, err)
@@ -1,8 +1,16 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.step.sm/cli-utils/step"
@@ -33,15 +41,67 @@ type SSHOptions struct {
 	// TemplateFile points to a file containing a SSH certificate template.
 	TemplateFile string `json:"templateFile,omitempty"`
 
+	// TemplateURL is an HTTP(S) URL serving a SSH certificate template. The
+	// template is fetched on each request using an ETag check, and the last
+	// good template is used if the server cannot be reached.
+	TemplateURL string `json:"templateURL,omitempty"`
+
+	// TemplateURLTimeout is the maximum time used to fetch the template from
+	// TemplateURL. Defaults to 5s.
+	TemplateURLTimeout *Duration `json:"templateURLTimeout,omitempty"`
+
 	// TemplateData is a JSON object with variables that can be used in custom
 	// templates.
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 
+	// TemplateDataFile points to a file containing a JSON object with
+	// variables that can be used in custom templates. The file is read again
+	// when it's modified, and its variables replace the ones in TemplateData
+	// with the same name.
+	TemplateDataFile string `json:"templateDataFile,omitempty"`
+
 	// User contains SSH user certificate options.
 	User *policy.SSHUserCertificateOptions `json:"-"`
 
 	// Host contains SSH host certificate options.
 	Host *policy.SSHHostCertificateOptions `json:"-"`
+
+	// UserExtensions contains the critical options and extensions allowed or
+	// denied in SSH user certificates.
+	UserExtensions *SSHExtensionsOptions `json:"userExtensions,omitempty"`
+
+	// HostExtensions contains the critical options and extensions allowed or
+	// denied in SSH host certificates.
+	HostExtensions *SSHExtensionsOptions `json:"hostExtensions,omitempty"`
+}
+
+// SSHExtensionsOptions restricts the critical options and extensions of the
+// SSH certificates after the template has been rendered. Denied entries always
+// win, and if an allow list is not empty only the entries in it are permitted.
+type SSHExtensionsOptions struct {
+	AllowedCriticalOptions []string `json:"allowCriticalOptions,omitempty"`
+	DeniedCriticalOptions  []string `json:"denyCriticalOptions,omitempty"`
+	AllowedExtensions      []string `json:"allowExtensions,omitempty"`
+	DeniedExtensions       []string `json:"denyExtensions,omitempty"`
+
+	// Strip removes the entries that are not allowed instead of rejecting the
+	// certificate.
+	Strip bool `json:"strip,omitempty"`
+}
+
+// Validate returns an error if any of the lists contains an empty name.
+func (o *SSHExtensionsOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, names := range [][]string{o.AllowedCriticalOptions, o.DeniedCriticalOptions, o.AllowedExtensions, o.DeniedExtensions} {
+		for _, name := range names {
+			if name == "" {
+				return errors.New("ssh extensions options cannot contain empty names")
+			}
+		}
+	}
+	return nil
 }
 
 // GetAllowedUserNameOptions returns the SSHNameOptions that are
@@ -94,7 +154,41 @@ func (o *SSHOptions) GetDeniedHostNameOptions() *policy.SSHNameOptions {
 
 // HasTemplate returns true if a template is defined in the provisioner options.
 func (o *SSHOptions) HasTemplate() bool {
-	return o != nil && (o.Template != "" || o.TemplateFile != "")
+	return o != nil && (o.Template != "" || o.TemplateFile != "" || o.TemplateURL != "")
+}
+
+// Validate returns an error if more than one template source is set in the
+// SSH options, or if the template URL is not valid.
+func (o *SSHOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	var n int
+	for _, s := range []string{o.Template, o.TemplateFile, o.TemplateURL} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("ssh options can only set one of template, templateFile or templateURL")
+	}
+	if o.TemplateURL != "" {
+		if !strings.HasPrefix(o.TemplateURL, "https://") && !strings.HasPrefix(o.TemplateURL, "http://") {
+			return errors.Errorf("ssh templateURL %q must be an http or https url", o.TemplateURL)
+		}
+	}
+	if o.TemplateURLTimeout != nil && o.TemplateURLTimeout.Duration < 0 {
+		return errors.New("ssh templateURLTimeout cannot be negative")
+	}
+	if o.TemplateDataFile != "" {
+		if _, err := sshTemplateDataFiles.read(step.Abs(o.TemplateDataFile)); err != nil {
+			return err
+		}
+	}
+	if err := o.UserExtensions.Validate(); err != nil {
+		return err
+	}
+	return o.HostExtensions.Validate()
 }
 
 // TemplateSSHOptions generates a SSHCertificateOptions with the template and
@@ -110,11 +204,19 @@ func TemplateSSHOptions(o *Options, data sshutil.TemplateData) (SSHCertificateOp
 // user data provided in the request. If no template has been provided in the
 // ProvisionerOptions, the given template will be used.
 func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemplate string) (SSHCertificateOptions, error) {
+	return CustomSSHTemplateOptionsWithContext(context.Background(), o, data, defaultTemplate)
+}
+
+// CustomSSHTemplateOptionsWithContext is like CustomSSHTemplateOptions, but
+// the template of a TemplateURL is fetched with the given context, so the
+// request is canceled with the request that signs the certificate.
+func CustomSSHTemplateOptionsWithContext(ctx context.Context, o *Options, data sshutil.TemplateData, defaultTemplate string) (SSHCertificateOptions, error) {
 	opts := o.GetSSHOptions()
 	if data == nil {
 		data = sshutil.NewTemplateData()
 	}
 
+	var remoteTemplate string
 	if opts != nil {
 		// Add template data if any.
 		if len(opts.TemplateData) > 0 && string(opts.TemplateData) != "null" {
@@ -122,44 +224,287 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 				return nil, errors.Wrap(err, "error unmarshaling template data")
 			}
 		}
+		// Add the template data of the file, if any, over the inline one.
+		if opts.TemplateDataFile != "" {
+			fileData, err := sshTemplateDataFiles.load(step.Abs(opts.TemplateDataFile))
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range fileData {
+				data[k] = v
+			}
+		}
+		// Fetch the template from the URL if defined.
+		if opts.TemplateURL != "" {
+			timeout := defaultSSHTemplateURLTimeout
+			if opts.TemplateURLTimeout != nil && opts.TemplateURLTimeout.Duration > 0 {
+				timeout = opts.TemplateURLTimeout.Duration
+			}
+			var err error
+			if remoteTemplate, err = sshTemplates.fetch(ctx, opts.TemplateURL, timeout); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return sshCertificateOptionsFunc(func(so SignSSHOptions) []sshutil.Option {
 		// We're not provided user data without custom templates.
 		if !opts.HasTemplate() {
 			return []sshutil.Option{
-				sshutil.WithTemplate(defaultTemplate, data),
+				withSSHTemplateData(data, nil, func(data sshutil.TemplateData) sshutil.Option {
+					return sshutil.WithTemplate(defaultTemplate, data)
+				}),
 			}
 		}
 
-		// Add user provided data.
-		if len(so.TemplateData) > 0 {
-			userObject := make(map[string]interface{})
-			if err := json.Unmarshal(so.TemplateData, &userObject); err != nil {
-				data.SetUserData(map[string]interface{}{})
-			} else {
-				data.SetUserData(userObject)
+		var fn func(sshutil.TemplateData) sshutil.Option
+		template := strings.TrimSpace(opts.Template)
+		switch {
+		// Use the template fetched from TemplateURL.
+		case opts.TemplateURL != "":
+			fn = func(data sshutil.TemplateData) sshutil.Option {
+				return sshutil.WithTemplate(remoteTemplate, data)
 			}
-		}
-
 		// Load a template from a file if Template is not defined.
-		if opts.Template == "" && opts.TemplateFile != "" {
-			return []sshutil.Option{
-				sshutil.WithTemplateFile(step.Abs(opts.TemplateFile), data),
+		case opts.Template == "" && opts.TemplateFile != "":
+			fn = func(data sshutil.TemplateData) sshutil.Option {
+				return sshutil.WithTemplateFile(step.Abs(opts.TemplateFile), data)
 			}
-		}
-
 		// Load a template from the Template fields
 		// 1. As a JSON in a string.
-		template := strings.TrimSpace(opts.Template)
-		if strings.HasPrefix(template, "{") {
-			return []sshutil.Option{
-				sshutil.WithTemplate(template, data),
+		case strings.HasPrefix(template, "{"):
+			fn = func(data sshutil.TemplateData) sshutil.Option {
+				return sshutil.WithTemplate(template, data)
 			}
-		}
 		// 2. As a base64 encoded JSON.
+		default:
+			fn = func(data sshutil.TemplateData) sshutil.Option {
+				return sshutil.WithTemplateBase64(template, data)
+			}
+		}
 		return []sshutil.Option{
-			sshutil.WithTemplateBase64(template, data),
+			withSSHTemplateData(data, so.TemplateData, fn),
 		}
 	}), nil
 }
+
+// withSSHTemplateData returns an option that renders a template with the
+// option returned by fn, using the data returned by sshTemplateData. The copy
+// of the data is made when the option is applied, after the webhooks have
+// added their data.
+func withSSHTemplateData(data sshutil.TemplateData, userData []byte, fn func(sshutil.TemplateData) sshutil.Option) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		return fn(sshTemplateData(data, userData))(cr, o)
+	}
+}
+
+// sshTemplateData returns the data used to render a SSH template. The data is
+// merged with the following precedence, from lowest to highest:
+//
+//  1. The data generated by the provisioner.
+//  2. The templateData in the SSH options of the provisioner.
+//  3. The data in the templateDataFile in the SSH options of the provisioner.
+//  4. The data of the ENRICHING webhooks, in the Webhooks key.
+//  5. The user data in the request, in the Insecure.User key.
+//
+// Each render uses a copy of the data, so the data of a render, like the user
+// data or the certificate request, is never seen by another one, and the same
+// inputs always render the same certificate. Templates ranging over maps
+// iterate in key order, the keys function of sprig does not sort the keys and
+// must be used with sortAlpha for a stable output.
+func sshTemplateData(data sshutil.TemplateData, userData []byte) sshutil.TemplateData {
+	cp := make(sshutil.TemplateData, len(data)+1)
+	for k, v := range data {
+		cp[k] = v
+	}
+
+	// Copy the insecure data, it can be a map if it was set in the
+	// templateData of the provisioner.
+	var insecure sshutil.TemplateData
+	switch v := data[sshutil.InsecureKey].(type) {
+	case sshutil.TemplateData:
+		insecure = make(sshutil.TemplateData, len(v)+1)
+		for k, vv := range v {
+			insecure[k] = vv
+		}
+	case map[string]interface{}:
+		insecure = make(sshutil.TemplateData, len(v)+1)
+		for k, vv := range v {
+			insecure[k] = vv
+		}
+	}
+	if insecure != nil {
+		cp[sshutil.InsecureKey] = insecure
+	}
+
+	// Add user provided data.
+	if len(userData) > 0 {
+		userObject := make(map[string]interface{})
+		if err := json.Unmarshal(userData, &userObject); err != nil {
+			cp.SetUserData(map[string]interface{}{})
+		} else {
+			cp.SetUserData(userObject)
+		}
+	}
+	return cp
+}
+
+// defaultSSHTemplateURLTimeout is the timeout used to fetch a SSH template
+// from a URL if none is configured.
+const defaultSSHTemplateURLTimeout = 5 * time.Second
+
+// maxSSHTemplateURLSize is the maximum size, in bytes, of a SSH template
+// fetched from a URL.
+const maxSSHTemplateURLSize = 1 << 20
+
+// sshTemplates is the cache of the templates fetched from a URL.
+var sshTemplates = &templateURLCache{
+	client:    http.DefaultClient,
+	templates: make(map[string]*cachedTemplate),
+}
+
+type cachedTemplate struct {
+	etag string
+	text string
+}
+
+// templateURLCache keeps the last good template fetched from each URL.
+type templateURLCache struct {
+	client    *http.Client
+	mu        sync.RWMutex
+	templates map[string]*cachedTemplate
+}
+
+// fetch returns the template served at the given URL. If the template is
+// cached, the request is sent with an If-None-Match header, and the cached
+// template is returned if the server responds with 304 Not Modified or if the
+// request fails. The request is canceled if ctx is done or after the timeout.
+func (c *templateURLCache) fetch(ctx context.Context, url string, timeout time.Duration) (string, error) {
+	c.mu.RLock()
+	cached := c.templates[url]
+	c.mu.RUnlock()
+
+	tpl, err := c.do(ctx, url, timeout, cached)
+	if err != nil {
+		if cached != nil {
+			log.Printf("error fetching ssh template from %s, using the cached one: %v", url, err)
+			return cached.text, nil
+		}
+		return "", err
+	}
+
+	if tpl != cached {
+		c.mu.Lock()
+		c.templates[url] = tpl
+		c.mu.Unlock()
+	}
+	return tpl.text, nil
+}
+
+func (c *templateURLCache) do(ctx context.Context, url string, timeout time.Duration, cached *cachedTemplate) (*cachedTemplate, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request for ssh template %s", url)
+	}
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching ssh template %s", url)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		return cached, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("error fetching ssh template %s: server responded with %d", url, resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxSSHTemplateURLSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading ssh template %s", url)
+	}
+	if len(b) > maxSSHTemplateURLSize {
+		return nil, fmt.Errorf("error reading ssh template %s: template exceeds %d bytes", url, maxSSHTemplateURLSize)
+	}
+	return &cachedTemplate{
+		etag: resp.Header.Get("ETag"),
+		text: string(b),
+	}, nil
+}
+
+// sshTemplateDataFiles is the cache of the template data read from files.
+var sshTemplateDataFiles = &templateDataFileCache{
+	files: make(map[string]*cachedTemplateData),
+}
+
+type cachedTemplateData struct {
+	modTime time.Time
+	size    int64
+	data    map[string]interface{}
+}
+
+// templateDataFileCache keeps the last good template data read from each
+// file, and reads the file again only if its modification time or size
+// change.
+type templateDataFileCache struct {
+	mu    sync.RWMutex
+	files map[string]*cachedTemplateData
+}
+
+// load returns the template data in the given file. If the file cannot be
+// read or it's not valid, the cached data is returned if there is any.
+func (c *templateDataFileCache) load(name string) (map[string]interface{}, error) {
+	data, err := c.read(name)
+	if err != nil {
+		c.mu.RLock()
+		cached := c.files[name]
+		c.mu.RUnlock()
+		if cached != nil {
+			log.Printf("error reading ssh template data from %s, using the cached one: %v", name, err)
+			return cached.data, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// read returns the template data in the given file, from the cache if the
+// file did not change.
+func (c *templateDataFileCache) read(name string) (map[string]interface{}, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading ssh templateDataFile %s", name)
+	}
+
+	c.mu.RLock()
+	cached := c.files[name]
+	c.mu.RUnlock()
+	if cached != nil && cached.modTime.Equal(fi.ModTime()) && cached.size == fi.Size() {
+		return cached.data, nil
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading ssh templateDataFile %s", name)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil || data == nil {
+		return nil, fmt.Errorf("ssh templateDataFile %s is not a valid JSON object", name)
+	}
+
+	c.mu.Lock()
+	c.files[name] = &cachedTemplateData{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		data:    data,
+	}
+	c.mu.Unlock()
+	return data, nil
+}
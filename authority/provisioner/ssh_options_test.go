@@ -2,9 +2,18 @@ package provisioner
 
 import (
 	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/sshutil"
 )
 
@@ -104,3 +113,220 @@ func TestCustomSSHTemplateOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomSSHTemplateOptions_deterministic(t *testing.T) {
+	cr := sshutil.CertificateRequest{
+		Type:       "user",
+		KeyID:      "foo@smallstep.com",
+		Principals: []string{"foo"},
+	}
+	data := sshutil.CreateTemplateData(sshutil.UserCert, "foo@smallstep.com", []string{"foo"})
+	o := &Options{SSH: &SSHOptions{
+		Template:     `{"keyId": "{{ .Insecure.Provisioner }}", "extensions": {{ toJson .Insecure.User }}, "webhooks": [{{ range $k, $v := .Webhooks.people }}"{{ $k }}={{ $v }}",{{ end }}""]}`,
+		TemplateData: []byte(`{"Insecure": {"Provisioner": "data"}}`),
+	}}
+	cof, err := CustomSSHTemplateOptions(o, data, sshutil.DefaultTemplate)
+	require.NoError(t, err)
+
+	render := func(so SignSSHOptions) string {
+		var opts sshutil.Options
+		options := cof.Options(so)
+		// Webhooks add their data after the options are created.
+		data.SetWebhook("people", map[string]interface{}{"c": 3, "a": 1, "b": 2})
+		for _, fn := range options {
+			require.NoError(t, fn(cr, &opts))
+		}
+		return opts.CertBuffer.String()
+	}
+
+	userOptions := SignSSHOptions{TemplateData: []byte(`{"z":"1","y":"2","x":"3"}`)}
+	want := render(userOptions)
+	assert.Equal(t, `{"keyId": "data", "extensions": {"x":"3","y":"2","z":"1"}, "webhooks": ["a=1","b=2","c=3",""]}`, want)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, want, render(userOptions))
+	}
+
+	// User data is not kept between renders.
+	assert.Equal(t, `{"keyId": "data", "extensions": null, "webhooks": ["a=1","b=2","c=3",""]}`, render(SignSSHOptions{}))
+}
+
+func TestCustomSSHTemplateOptions_templateURL(t *testing.T) {
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"keyId": "{{ .KeyID }}"}`))
+	}))
+	defer srv.Close()
+
+	cr := sshutil.CertificateRequest{Type: "user", KeyID: "foo@smallstep.com"}
+	data := sshutil.CreateTemplateData(sshutil.UserCert, "foo@smallstep.com", []string{"foo"})
+	o := &Options{SSH: &SSHOptions{TemplateURL: srv.URL + "/ssh.tpl"}}
+	want := sshutil.Options{CertBuffer: bytes.NewBufferString(`{"keyId": "foo@smallstep.com"}`)}
+
+	apply := func(t *testing.T) sshutil.Options {
+		t.Helper()
+		cof, err := CustomSSHTemplateOptions(o, data, sshutil.DefaultTemplate)
+		require.NoError(t, err)
+		var opts sshutil.Options
+		for _, fn := range cof.Options(SignSSHOptions{}) {
+			require.NoError(t, fn(cr, &opts))
+		}
+		return opts
+	}
+	assert.Equal(t, want, apply(t))
+
+	// The last good template is used if the server fails.
+	down.Store(true)
+	assert.Equal(t, want, apply(t))
+
+	// Without a cached template the error is returned.
+	_, err := CustomSSHTemplateOptions(&Options{SSH: &SSHOptions{TemplateURL: srv.URL + "/other.tpl"}}, data, sshutil.DefaultTemplate)
+	assert.ErrorContains(t, err, "server responded with 502")
+}
+
+func TestCustomSSHTemplateOptions_templateDataFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "inventory.json")
+	modTime := time.Now().Add(-time.Hour)
+	write := func(t *testing.T, s string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(name, []byte(s), 0600))
+		// Make sure the modification time changes on each write.
+		modTime = modTime.Add(time.Minute)
+		require.NoError(t, os.Chtimes(name, modTime, modTime))
+	}
+
+	cr := sshutil.CertificateRequest{Type: "host", KeyID: "foo.internal"}
+	data := sshutil.CreateTemplateData(sshutil.HostCert, "foo.internal", []string{"foo.internal"})
+	o := &Options{SSH: &SSHOptions{
+		Template:         `{"keyId": "{{ .Rack }}-{{ .Zone }}"}`,
+		TemplateData:     []byte(`{"Rack": "inline", "Zone": "eu-1"}`),
+		TemplateDataFile: name,
+	}}
+	apply := func(t *testing.T) string {
+		t.Helper()
+		cof, err := CustomSSHTemplateOptions(o, data, sshutil.DefaultTemplate)
+		require.NoError(t, err)
+		var opts sshutil.Options
+		for _, fn := range cof.Options(SignSSHOptions{}) {
+			require.NoError(t, fn(cr, &opts))
+		}
+		return opts.CertBuffer.String()
+	}
+
+	// The file replaces the inline variables.
+	write(t, `{"Rack": "r1"}`)
+	require.NoError(t, o.SSH.Validate())
+	assert.Equal(t, `{"keyId": "r1-eu-1"}`, apply(t))
+
+	// The file is read again after a change.
+	write(t, `{"Rack": "r2", "Zone": "us-1"}`)
+	assert.Equal(t, `{"keyId": "r2-us-1"}`, apply(t))
+
+	// The last good data is used if the file is not valid.
+	write(t, `{"Rack": `)
+	assert.Equal(t, `{"keyId": "r2-us-1"}`, apply(t))
+	assert.EqualError(t, o.SSH.Validate(), "ssh templateDataFile "+name+" is not a valid JSON object")
+
+	write(t, `{"Rack": "r3"}`)
+	assert.Equal(t, `{"keyId": "r3-eu-1"}`, apply(t))
+
+	// Without cached data the error is returned.
+	_, err := CustomSSHTemplateOptions(&Options{SSH: &SSHOptions{TemplateDataFile: name + ".missing"}}, data, sshutil.DefaultTemplate)
+	assert.ErrorContains(t, err, "error reading ssh templateDataFile "+name+".missing")
+}
+
+func Test_templateURLCache_fetch(t *testing.T) {
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("etag template"))
+		case "/slow":
+			<-r.Context().Done()
+		case "/large":
+			w.Write(bytes.Repeat([]byte("a"), maxSSHTemplateURLSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := &templateURLCache{
+		client:    srv.Client(),
+		templates: make(map[string]*cachedTemplate),
+	}
+
+	got, err := c.fetch(context.Background(), srv.URL+"/etag", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "etag template", got)
+	got, err = c.fetch(context.Background(), srv.URL+"/etag", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "etag template", got)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+
+	_, err = c.fetch(context.Background(), srv.URL+"/missing", time.Second)
+	assert.ErrorContains(t, err, "server responded with 404")
+
+	_, err = c.fetch(context.Background(), srv.URL+"/slow", 50*time.Millisecond)
+	assert.ErrorContains(t, err, "error fetching ssh template")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.fetch(ctx, srv.URL+"/slow", time.Minute)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = c.fetch(context.Background(), srv.URL+"/large", time.Second)
+	assert.ErrorContains(t, err, "template exceeds 1048576 bytes")
+}
+
+func TestSSHOptions_Validate(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.json")
+	require.NoError(t, os.WriteFile(dataFile, []byte(`{"Rack": "r1"}`), 0600))
+	listFile := filepath.Join(dir, "list.json")
+	require.NoError(t, os.WriteFile(listFile, []byte(`["r1"]`), 0600))
+	missingFile := filepath.Join(dir, "missing.json")
+
+	tests := []struct {
+		name    string
+		o       *SSHOptions
+		wantErr string
+	}{
+		{"ok/nil", nil, ""},
+		{"ok/empty", &SSHOptions{}, ""},
+		{"ok/template", &SSHOptions{Template: "{}"}, ""},
+		{"ok/file", &SSHOptions{TemplateFile: "./testdata/templates/cr.tpl"}, ""},
+		{"ok/url", &SSHOptions{TemplateURL: "https://templates.example.com/ssh.tpl", TemplateURLTimeout: &Duration{Duration: time.Second}}, ""},
+		{"fail/template-and-file", &SSHOptions{Template: "{}", TemplateFile: "./testdata/templates/cr.tpl"}, "ssh options can only set one of template, templateFile or templateURL"},
+		{"fail/template-and-url", &SSHOptions{Template: "{}", TemplateURL: "https://templates.example.com/ssh.tpl"}, "ssh options can only set one of template, templateFile or templateURL"},
+		{"fail/url-scheme", &SSHOptions{TemplateURL: "file:///etc/ssh.tpl"}, `ssh templateURL "file:///etc/ssh.tpl" must be an http or https url`},
+		{"fail/url-timeout", &SSHOptions{TemplateURL: "https://templates.example.com/ssh.tpl", TemplateURLTimeout: &Duration{Duration: -time.Second}}, "ssh templateURLTimeout cannot be negative"},
+		{"ok/data-file", &SSHOptions{TemplateDataFile: dataFile}, ""},
+		{"fail/data-file-missing", &SSHOptions{TemplateDataFile: missingFile}, "error reading ssh templateDataFile " + missingFile + ": stat " + missingFile + ": no such file or directory"},
+		{"fail/data-file-json", &SSHOptions{TemplateDataFile: listFile}, "ssh templateDataFile " + listFile + " is not a valid JSON object"},
+		{"ok/extensions", &SSHOptions{UserExtensions: &SSHExtensionsOptions{AllowedExtensions: []string{"permit-pty"}}, HostExtensions: &SSHExtensionsOptions{}}, ""},
+		{"fail/user-extensions", &SSHOptions{UserExtensions: &SSHExtensionsOptions{DeniedCriticalOptions: []string{""}}}, "ssh extensions options cannot contain empty names"},
+		{"fail/host-extensions", &SSHOptions{HostExtensions: &SSHExtensionsOptions{AllowedExtensions: []string{""}}}, "ssh extensions options cannot contain empty names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.o.Validate()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
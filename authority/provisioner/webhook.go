@@ -5,12 +5,18 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"io"
 	"log"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -18,6 +24,10 @@ import (
 	"github.com/smallstep/certificates/middleware/requestid"
 	"github.com/smallstep/certificates/templates"
 	"github.com/smallstep/certificates/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.step.sm/linkedca"
 )
 
@@ -30,6 +40,8 @@ type WebhookSetter interface {
 type WebhookController struct {
 	client       *http.Client
 	webhooks     []*Webhook
+	caches       map[*Webhook]*webhookResponseCache
+	provisioner  string
 	certType     linkedca.Webhook_CertType
 	options      []webhook.RequestBodyOption
 	TemplateData WebhookSetter
@@ -57,21 +69,46 @@ func (wc *WebhookController) Enrich(ctx context.Context, req *webhook.RequestBod
 			continue
 		}
 
-		whCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		whCtx, cancel := context.WithTimeout(ctx, wh.timeout())
 		defer cancel() //nolint:gocritic // every request canceled with its own timeout
 
-		resp, err := wh.DoWithContext(whCtx, wc.client, req, wc.TemplateData)
+		resp, err := wc.doEnriching(whCtx, wh, req)
 		if err != nil {
+			if wh.FailurePolicy == WebhookFailOpen {
+				log.Printf("Webhook %q request to %s failed, continuing without its data: %v", wh.Name, wh.URL, err)
+				continue
+			}
 			return err
 		}
 		if !resp.Allow {
 			return ErrWebhookDenied
 		}
+		if reason, ok := wh.denied(resp.Data); ok {
+			if reason == "" {
+				return fmt.Errorf("%w: webhook %q denied the request", ErrWebhookDenied, wh.Name)
+			}
+			return fmt.Errorf("%w: webhook %q denied the request: %s", ErrWebhookDenied, wh.Name, reason)
+		}
 		wc.TemplateData.SetWebhook(wh.Name, resp.Data)
 	}
 	return nil
 }
 
+// doEnriching executes an ENRICHING webhook request. If the webhook has a
+// cache configured, the cached response is returned for identical requests.
+func (wc *WebhookController) doEnriching(ctx context.Context, wh *Webhook, req *webhook.RequestBody) (*webhook.ResponseBody, error) {
+	if cache, ok := wc.caches[wh]; ok {
+		if key, ok := webhookCacheKey(wc.provisioner, wh, req); ok {
+			return cache.Do(ctx, key, func(ctx context.Context) (*webhook.ResponseBody, error) {
+				ctx, cancel := context.WithTimeout(ctx, wh.timeout())
+				defer cancel()
+				return wh.DoWithContext(ctx, wc.client, req, wc.TemplateData)
+			})
+		}
+	}
+	return wh.DoWithContext(ctx, wc.client, req, wc.TemplateData)
+}
+
 // Authorize checks that all remote servers allow the request
 func (wc *WebhookController) Authorize(ctx context.Context, req *webhook.RequestBody) error {
 	if wc == nil {
@@ -107,14 +144,23 @@ func (wc *WebhookController) Authorize(ctx context.Context, req *webhook.Request
 	return nil
 }
 
+// AddRequestBodyOptions adds options that are applied to the bodies of the
+// enriching and authorizing webhook requests.
+func (wc *WebhookController) AddRequestBodyOptions(opts ...webhook.RequestBodyOption) {
+	if wc != nil {
+		wc.options = append(wc.options, opts...)
+	}
+}
+
 func (wc *WebhookController) isCertTypeOK(wh *Webhook) bool {
 	if wc.certType == linkedca.Webhook_ALL {
 		return true
 	}
-	if wh.CertType == linkedca.Webhook_ALL.String() || wh.CertType == "" {
-		return true
+	certType, err := wh.CertTypeEnum()
+	if err != nil {
+		return false
 	}
-	return wc.certType.String() == wh.CertType
+	return certType == linkedca.Webhook_ALL || certType == wc.certType
 }
 
 type Webhook struct {
@@ -130,9 +176,304 @@ type Webhook struct {
 		Username string
 		Password string
 	} `json:"-"`
+	// Timeout is the maximum time an ENRICHING webhook request can take,
+	// including retries. Defaults to 10s.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// FailurePolicy defines whether the certificate is issued if an ENRICHING
+	// webhook request fails, it can be failClosed or failOpen. A webhook
+	// server denying the request always fails it. Defaults to failClosed.
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// Cache enables the caching of the responses of an ENRICHING webhook.
+	Cache *WebhookCache `json:"cache,omitempty"`
+	// DenyField is the name of a field in the data of the ENRICHING webhook
+	// responses that denies the request if it's true or a non-empty string.
+	// A string is used as the reason of the denial. The data is used in the
+	// templates as usual if the field is missing, false or empty.
+	DenyField string `json:"denyField,omitempty"`
+	// SigningAlg is the hash algorithm used to compute the HMAC signature of
+	// SCEPCHALLENGE webhook requests. It can be SHA-256, SHA-384 or SHA-512,
+	// and it defaults to SHA-256. Other kinds of webhooks always use SHA-256.
+	SigningAlg string `json:"signingAlg,omitempty"`
+	// TLS configures the client certificate and the roots used on the
+	// connections to the webhook server.
+	TLS *WebhookTLS `json:"tls,omitempty"`
+	// IncludeRequestMetadata adds the remote address, X-Forwarded-For and
+	// User-Agent of the HTTP request to SCEPCHALLENGE webhook requests.
+	IncludeRequestMetadata bool `json:"includeRequestMetadata,omitempty"`
+	// ResponseMapping is a template used to get the decision of SCEPCHALLENGE
+	// webhook servers that don't return the allow field. The template is
+	// executed with the StatusCode and the JSON decoded Body of the response,
+	// and it must return true or false, e.g. {{ eq .Body.result "approved" }}
+	// or {{ eq .StatusCode 204 }}. If it's not set, the allow field is used.
+	ResponseMapping string `json:"responseMapping,omitempty"`
+
+	// client is the client created for the TLS options.
+	client *http.Client
+	// headers are the static headers of the requests, set from the
+	// configuration of the authority.
+	headers http.Header
+}
+
+// Supported webhook failure policies.
+const (
+	WebhookFailClosed = "failClosed"
+	WebhookFailOpen   = "failOpen"
+)
+
+// defaultWebhookTimeout is the timeout used on the ENRICHING and AUTHORIZING
+// webhook requests if none is configured.
+const defaultWebhookTimeout = 10 * time.Second
+
+// webhookKinds are the kinds of webhook supported by the provisioners.
+var webhookKinds = []linkedca.Webhook_Kind{
+	linkedca.Webhook_ENRICHING,
+	linkedca.Webhook_AUTHORIZING,
+	linkedca.Webhook_SCEPCHALLENGE,
+	linkedca.Webhook_NOTIFYING,
+}
+
+// webhookCertTypes are the certificate types a webhook can be used for.
+var webhookCertTypes = []linkedca.Webhook_CertType{
+	linkedca.Webhook_ALL,
+	linkedca.Webhook_X509,
+	linkedca.Webhook_SSH,
+}
+
+// KindEnum returns the kind of the webhook as a linkedca enum.
+func (w *Webhook) KindEnum() (linkedca.Webhook_Kind, error) {
+	for _, k := range webhookKinds {
+		if w.Kind == k.String() {
+			return k, nil
+		}
+	}
+	return linkedca.Webhook_NO_KIND, fmt.Errorf("webhook %q kind %q is not supported, it must be one of %s",
+		w.Name, w.Kind, joinEnums(webhookKinds))
+}
+
+// CertTypeEnum returns the certificate type of the webhook as a linkedca enum.
+// An empty certificate type means all types.
+func (w *Webhook) CertTypeEnum() (linkedca.Webhook_CertType, error) {
+	if w.CertType == "" {
+		return linkedca.Webhook_ALL, nil
+	}
+	for _, t := range webhookCertTypes {
+		if w.CertType == t.String() {
+			return t, nil
+		}
+	}
+	return linkedca.Webhook_ALL, fmt.Errorf("webhook %q certType %q is not supported, it must be one of %s",
+		w.Name, w.CertType, joinEnums(webhookCertTypes))
+}
+
+func joinEnums[T fmt.Stringer](values []T) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = v.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Validate returns an error if the webhook kind, certificate type, timeout,
+// failure policy, cache, response mapping or TLS options are not valid.
+func (w *Webhook) Validate() error {
+	if _, err := w.KindEnum(); err != nil {
+		return err
+	}
+	if _, err := w.CertTypeEnum(); err != nil {
+		return err
+	}
+	if w.Timeout != nil && w.Timeout.Duration < 0 {
+		return fmt.Errorf("webhook %q timeout cannot be negative", w.Name)
+	}
+	if w.Cache != nil {
+		if err := w.Cache.Validate(); err != nil {
+			return fmt.Errorf("webhook %q: %w", w.Name, err)
+		}
+	}
+	if w.DenyField != "" && w.Kind != linkedca.Webhook_ENRICHING.String() {
+		return fmt.Errorf("webhook %q denyField is only supported on ENRICHING webhooks", w.Name)
+	}
+	if w.ResponseMapping != "" {
+		if w.Kind != linkedca.Webhook_SCEPCHALLENGE.String() {
+			return fmt.Errorf("webhook %q responseMapping is only supported on SCEPCHALLENGE webhooks", w.Name)
+		}
+		if _, err := w.responseMappingTemplate(); err != nil {
+			return err
+		}
+	}
+	if w.TLS != nil {
+		if w.DisableTLSClientAuth {
+			return fmt.Errorf("webhook %q cannot set tls with disableTLSClientAuth", w.Name)
+		}
+		if err := w.TLS.Validate(); err != nil {
+			return fmt.Errorf("webhook %q: %w", w.Name, err)
+		}
+	}
+	switch w.FailurePolicy {
+	case "", WebhookFailClosed, WebhookFailOpen:
+		return nil
+	default:
+		return fmt.Errorf("webhook %q failurePolicy %q is not supported", w.Name, w.FailurePolicy)
+	}
+}
+
+// denied returns true, and the reason if any, if the deny field is set in the
+// data of a response.
+func (w *Webhook) denied(data any) (string, bool) {
+	if w.DenyField == "" {
+		return "", false
+	}
+	m, ok := data.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	switch v := m[w.DenyField].(type) {
+	case bool:
+		return "", v
+	case string:
+		return v, v != ""
+	default:
+		return "", false
+	}
+}
+
+// timeout returns the configured timeout or the default one.
+func (w *Webhook) timeout() time.Duration {
+	if w.Timeout != nil && w.Timeout.Duration > 0 {
+		return w.Timeout.Duration
+	}
+	return defaultWebhookTimeout
+}
+
+// webhookResponseData is the data used to execute the response mapping.
+type webhookResponseData struct {
+	StatusCode int
+	Body       any
+}
+
+func (w *Webhook) responseMappingTemplate() (*template.Template, error) {
+	tmpl, err := template.New("responseMapping").Funcs(templates.StepFuncMap()).Parse(w.ResponseMapping)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %q responseMapping is not valid: %w", w.Name, err)
+	}
+	return tmpl, nil
+}
+
+// mapResponse returns the response body using the response mapping to get the
+// allow decision. An empty body is mapped to a nil Body, and a body that is
+// not JSON to a string.
+func (w *Webhook) mapResponse(statusCode int, body []byte) (*webhook.ResponseBody, error) {
+	tmpl, err := w.responseMappingTemplate()
+	if err != nil {
+		return nil, err
+	}
+	data := webhookResponseData{StatusCode: statusCode}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &data.Body); err != nil {
+			data.Body = string(body)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("webhook %q responseMapping failed: %w", w.Name, err)
+	}
+	allow, err := strconv.ParseBool(strings.TrimSpace(buf.String()))
+	if err != nil {
+		return nil, fmt.Errorf("webhook %q responseMapping returned %q, it must return true or false", w.Name, buf.String())
+	}
+	return &webhook.ResponseBody{Allow: allow}, nil
+}
+
+// Supported webhook signing algorithms.
+const (
+	WebhookSigningAlgSHA256 = "SHA-256"
+	WebhookSigningAlgSHA384 = "SHA-384"
+	WebhookSigningAlgSHA512 = "SHA-512"
+)
+
+// ValidateSigningAlg returns an error if the signing algorithm of the webhook
+// is not supported.
+func (w *Webhook) ValidateSigningAlg() error {
+	if _, _, err := w.signingHash(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// signingHash returns the name and the hash function of the algorithm used to
+// sign the webhook requests.
+func (w *Webhook) signingHash() (string, func() hash.Hash, error) {
+	alg := w.SigningAlg
+	if w.Kind != linkedca.Webhook_SCEPCHALLENGE.String() {
+		alg = ""
+	}
+	switch alg {
+	case "", WebhookSigningAlgSHA256:
+		return WebhookSigningAlgSHA256, sha256.New, nil
+	case WebhookSigningAlgSHA384:
+		return WebhookSigningAlgSHA384, sha512.New384, nil
+	case WebhookSigningAlgSHA512:
+		return WebhookSigningAlgSHA512, sha512.New, nil
+	default:
+		return "", nil, fmt.Errorf("webhook %q signingAlg %q is not supported", w.Name, w.SigningAlg)
+	}
+}
+
+// WebhookRetry configures how the webhook requests are retried. Requests are
+// only retried on network errors and 5xx responses, a response that denies
+// the request is never retried.
+type WebhookRetry struct {
+	// MaxRetries is the maximum number of retries after the first attempt.
+	MaxRetries int `json:"maxRetries"`
+	// BaseDelay is the delay before the first retry. The delay is doubled on
+	// each retry. Defaults to 1s.
+	BaseDelay *Duration `json:"baseDelay,omitempty"`
+	// Jitter is the maximum random duration added to each delay.
+	Jitter *Duration `json:"jitter,omitempty"`
+}
+
+// defaultWebhookRetry is the retry policy used by DoWithContext.
+var defaultWebhookRetry = &WebhookRetry{MaxRetries: 1}
+
+// Validate returns an error if the retry options are not valid.
+func (r *WebhookRetry) Validate() error {
+	switch {
+	case r.MaxRetries < 0:
+		return errors.New("webhook retry maxRetries cannot be negative")
+	case r.BaseDelay != nil && r.BaseDelay.Duration < 0:
+		return errors.New("webhook retry baseDelay cannot be negative")
+	case r.Jitter != nil && r.Jitter.Duration < 0:
+		return errors.New("webhook retry jitter cannot be negative")
+	}
+	return nil
+}
+
+// delay returns the duration to wait before the given retry, starting at 1.
+func (r *WebhookRetry) delay(retry int) time.Duration {
+	d := time.Second
+	if r.BaseDelay != nil {
+		d = r.BaseDelay.Duration
+	}
+	if retry > 1 {
+		d <<= min(retry-1, 16)
+	}
+	if r.Jitter != nil && r.Jitter.Duration > 0 {
+		d += time.Duration(rand.Int63n(int64(r.Jitter.Duration))) //nolint:gosec // not used for security
+	}
+	return d
 }
 
+// DoWithContext executes the webhook request. If the request fails with a
+// network error or a 5xx status code, it will be retried once.
 func (w *Webhook) DoWithContext(ctx context.Context, client *http.Client, reqBody *webhook.RequestBody, data any) (*webhook.ResponseBody, error) {
+	return w.DoWithRetry(ctx, client, reqBody, data, defaultWebhookRetry)
+}
+
+// DoWithRetry executes the webhook request, retrying it with an exponential
+// backoff on network errors and 5xx status codes. Retries stop if the context
+// is done or if the context deadline would be exceeded before the next
+// attempt. The error of the last attempt is returned if all of them fail.
+func (w *Webhook) DoWithRetry(ctx context.Context, client *http.Client, reqBody *webhook.RequestBody, data any, retry *WebhookRetry) (*webhook.ResponseBody, error) {
 	tmpl, err := template.New("url").Funcs(templates.StepFuncMap()).Parse(w.URL)
 	if err != nil {
 		return nil, err
@@ -163,35 +504,31 @@ func (w *Webhook) DoWithContext(ctx context.Context, client *http.Client, reqBod
 		return nil, err
 	}
 
-	retries := 1
-retry:
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBytes))
+	secret, err := base64.StdEncoding.DecodeString(w.Secret)
 	if err != nil {
 		return nil, err
 	}
 
-	if requestID, ok := requestid.FromContext(ctx); ok {
-		req.Header.Set("X-Request-Id", requestID)
-	}
-
-	secret, err := base64.StdEncoding.DecodeString(w.Secret)
+	// The signature covers the body, including the timestamp, so the
+	// timestamp header can be verified against it.
+	alg, newHash, err := w.signingHash()
 	if err != nil {
 		return nil, err
 	}
-	h := hmac.New(sha256.New, secret)
+	h := hmac.New(newHash, secret)
 	h.Write(reqBytes)
-	sig := h.Sum(nil)
-	req.Header.Set("X-Smallstep-Signature", hex.EncodeToString(sig))
-	req.Header.Set("X-Smallstep-Webhook-ID", w.ID)
-
-	if w.BearerToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", w.BearerToken))
-	} else if w.BasicAuth.Username != "" || w.BasicAuth.Password != "" {
-		req.SetBasicAuth(w.BasicAuth.Username, w.BasicAuth.Password)
+	header := w.headers.Clone()
+	if header == nil {
+		header = http.Header{}
 	}
+	header.Set("X-Smallstep-Signature", hex.EncodeToString(h.Sum(nil)))
+	header.Set("X-Smallstep-Signature-Algorithm", alg)
+	header.Set("X-Smallstep-Timestamp", reqBody.Timestamp.Format(time.RFC3339Nano))
+	header.Set("X-Smallstep-Webhook-ID", w.ID)
 
-	if w.DisableTLSClientAuth {
+	if w.client != nil {
+		client = w.client
+	} else if w.DisableTLSClientAuth {
 		transport, ok := client.Transport.(*http.Transport)
 		if !ok {
 			return nil, errors.New("client transport is not a *http.Transport")
@@ -205,35 +542,122 @@ retry:
 			Transport: transport,
 		}
 	}
+
+	if retry == nil {
+		retry = &WebhookRetry{}
+	}
+
+	ctx, span := MustTracerProviderFromContext(ctx).Tracer(webhookTracerName).Start(ctx, "webhook "+w.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("webhook.name", w.Name),
+			attribute.String("webhook.kind", w.Kind),
+		),
+	)
+	start := time.Now()
+	respBody, statusCode, err := w.doWithRetry(ctx, client, url, reqBytes, header, retry)
+
+	outcome := WebhookAllowed
+	switch {
+	case err != nil:
+		outcome = WebhookFailed
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case !respBody.Allow:
+		outcome = WebhookDenied
+	}
+	if statusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+	span.SetAttributes(attribute.String("webhook.outcome", string(outcome)))
+	span.End()
+	MustMeterFromContext(ctx).WebhookCalled(w.Name, w.Kind, statusCode, outcome, time.Since(start))
+
+	return respBody, err
+}
+
+// webhookTracerName is the name of the tracer used on the webhook requests.
+// Spans are only recorded if the context has a tracer provider.
+const webhookTracerName = "github.com/smallstep/certificates/authority/provisioner"
+
+// doWithRetry executes the webhook requests until one succeeds or the retries
+// are exhausted. It returns the status code of the last response, or 0 if
+// there was none.
+func (w *Webhook) doWithRetry(ctx context.Context, client *http.Client, url string, reqBytes []byte, header http.Header, retry *WebhookRetry) (*webhook.ResponseBody, int, error) {
+	for attempt := 0; ; attempt++ {
+		respBody, statusCode, retryable, err := w.do(ctx, client, url, reqBytes, header)
+		if err == nil || !retryable || attempt >= retry.MaxRetries {
+			return respBody, statusCode, err
+		}
+
+		delay := retry.delay(attempt + 1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, statusCode, err
+		}
+		log.Printf("Webhook %q request to %s failed, retrying in %s (%d/%d): %v", w.Name, w.URL, delay, attempt+1, retry.MaxRetries, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, statusCode, err
+		case <-timer.C:
+		}
+	}
+}
+
+// do executes a single webhook request. It returns the status code of the
+// response and whether the request can be retried if it fails. The trace
+// context is propagated to the webhook server in the request headers.
+func (w *Webhook) do(ctx context.Context, client *http.Client, url string, reqBytes []byte, header http.Header) (*webhook.ResponseBody, int, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	if requestID, ok := requestid.FromContext(ctx); ok {
+		req.Header.Set("X-Request-Id", requestID)
+	}
+
+	if w.BearerToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", w.BearerToken))
+	} else if w.BasicAuth.Username != "" || w.BasicAuth.Password != "" {
+		req.SetBasicAuth(w.BasicAuth.Username, w.BasicAuth.Password)
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, err
-		} else if retries > 0 {
-			retries--
-			time.Sleep(time.Second)
-			goto retry
-		}
-		return nil, err
+		return nil, 0, !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled), err
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
 			log.Printf("Failed to close body of response from %s", w.URL)
 		}
 	}()
-	if resp.StatusCode >= 500 && retries > 0 {
-		retries--
-		time.Sleep(time.Second)
-		goto retry
+	if resp.StatusCode >= 500 {
+		return nil, resp.StatusCode, true, fmt.Errorf("Webhook server responded with %d", resp.StatusCode)
 	}
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("Webhook server responded with %d", resp.StatusCode)
+		return nil, resp.StatusCode, false, fmt.Errorf("Webhook server responded with %d", resp.StatusCode)
+	}
+
+	if w.ResponseMapping != "" {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, resp.StatusCode, false, err
+		}
+		respBody, err := w.mapResponse(resp.StatusCode, body)
+		return respBody, resp.StatusCode, false, err
 	}
 
 	respBody := &webhook.ResponseBody{}
 	if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
-		return nil, err
+		return nil, resp.StatusCode, false, err
 	}
 
-	return respBody, nil
+	return respBody, resp.StatusCode, false, nil
 }
@@ -0,0 +1,165 @@
+package provisioner
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/smallstep/certificates/webhook"
+)
+
+// defaultWebhookCacheMaxEntries is the maximum number of responses kept by a
+// webhook cache if none is configured.
+const defaultWebhookCacheMaxEntries = 1000
+
+// WebhookCache configures an in-memory cache for the responses of an
+// ENRICHING webhook. Responses are cached by provisioner, webhook and SSH
+// certificate request, so identical requests made in quick succession only
+// call the webhook server once.
+type WebhookCache struct {
+	// TTL is the time a response is kept in the cache.
+	TTL *Duration `json:"ttl"`
+	// MaxEntries is the maximum number of responses in the cache, the least
+	// recently used ones are evicted first. Defaults to 1000.
+	MaxEntries int `json:"maxEntries,omitempty"`
+}
+
+// Validate returns an error if the cache options are not valid.
+func (c *WebhookCache) Validate() error {
+	switch {
+	case c.TTL == nil || c.TTL.Duration <= 0:
+		return errors.New("webhook cache ttl must be greater than 0")
+	case c.MaxEntries < 0:
+		return errors.New("webhook cache maxEntries cannot be negative")
+	}
+	return nil
+}
+
+type webhookCacheEntry struct {
+	key       string
+	resp      *webhook.ResponseBody
+	expiresAt time.Time
+}
+
+// webhookResponseCache is an LRU cache of webhook responses with a TTL.
+// Concurrent requests for the same key are coalesced into a single call.
+type webhookResponseCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	group      singleflight.Group
+	now        func() time.Time
+}
+
+func newWebhookResponseCache(cfg *WebhookCache) *webhookResponseCache {
+	maxEntries := cfg.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = defaultWebhookCacheMaxEntries
+	}
+	return &webhookResponseCache{
+		ttl:        cfg.TTL.Duration,
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// webhookCacheKey returns the cache key for the given request. It returns
+// false if the request cannot be cached.
+func webhookCacheKey(provisionerName string, wh *Webhook, req *webhook.RequestBody) (string, bool) {
+	if req.SSHCertificateRequest == nil {
+		return "", false
+	}
+	b, err := json.Marshal(req.SSHCertificateRequest)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	for _, v := range [][]byte{[]byte(provisionerName), []byte(wh.ID), []byte(wh.Name), b} {
+		// Hash the length of each field to avoid ambiguous concatenations.
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(v))))
+		h.Write(v)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// Do returns the cached response for the key, or calls fn and caches its
+// response if it allows the request. Errors and denied requests are never
+// cached.
+//
+// Concurrent calls for the same key share a single call to fn. That call does
+// not use the cancellation of the caller that starts it, so it's not aborted
+// for the other callers if the first one goes away; fn must set its own
+// timeout. Each caller stops waiting when its ctx is done.
+func (c *webhookResponseCache) Do(ctx context.Context, key string, fn func(context.Context) (*webhook.ResponseBody, error)) (*webhook.ResponseBody, error) {
+	if resp, ok := c.get(key); ok {
+		return resp, nil
+	}
+	ch := c.group.DoChan(key, func() (any, error) {
+		if resp, ok := c.get(key); ok {
+			return resp, nil
+		}
+		resp, err := fn(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if resp.Allow {
+			c.add(key, resp)
+		}
+		return resp, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*webhook.ResponseBody), nil
+	}
+}
+
+func (c *webhookResponseCache) get(key string) (*webhook.ResponseBody, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*webhookCacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.resp, true
+}
+
+func (c *webhookResponseCache) add(key string, resp *webhook.ResponseBody) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &webhookCacheEntry{key: key, resp: resp, expiresAt: c.now().Add(c.ttl)}
+	if e, ok := c.items[key]; ok {
+		e.Value = entry
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.maxEntries {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*webhookCacheEntry).key)
+	}
+}
@@ -0,0 +1,237 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/webhook"
+)
+
+func TestWebhookCache_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   *WebhookCache
+		wantErr string
+	}{
+		{"ok", &WebhookCache{TTL: &Duration{Duration: time.Minute}}, ""},
+		{"ok/max-entries", &WebhookCache{TTL: &Duration{Duration: time.Minute}, MaxEntries: 10}, ""},
+		{"fail/no-ttl", &WebhookCache{}, "webhook cache ttl must be greater than 0"},
+		{"fail/zero-ttl", &WebhookCache{TTL: &Duration{}}, "webhook cache ttl must be greater than 0"},
+		{"fail/max-entries", &WebhookCache{TTL: &Duration{Duration: time.Minute}, MaxEntries: -1}, "webhook cache maxEntries cannot be negative"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cache.Validate()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_webhookCacheKey(t *testing.T) {
+	wh := &Webhook{ID: "id", Name: "people"}
+	req := func(keyID string) *webhook.RequestBody {
+		return &webhook.RequestBody{
+			SSHCertificateRequest: &webhook.SSHCertificateRequest{
+				Type:       "user",
+				KeyID:      keyID,
+				Principals: []string{"jane"},
+			},
+		}
+	}
+
+	k1, ok := webhookCacheKey("prov", wh, req("jane@example.com"))
+	assert.True(t, ok)
+	k2, ok := webhookCacheKey("prov", wh, req("jane@example.com"))
+	assert.True(t, ok)
+	assert.Equal(t, k1, k2)
+
+	// The request is part of the key.
+	k3, ok := webhookCacheKey("prov", wh, req("john@example.com"))
+	assert.True(t, ok)
+	assert.NotEqual(t, k1, k3)
+
+	// The provisioner and the webhook are part of the key.
+	k4, ok := webhookCacheKey("other", wh, req("jane@example.com"))
+	assert.True(t, ok)
+	assert.NotEqual(t, k1, k4)
+	k5, ok := webhookCacheKey("prov", &Webhook{ID: "other", Name: "people"}, req("jane@example.com"))
+	assert.True(t, ok)
+	assert.NotEqual(t, k1, k5)
+	k6, ok := webhookCacheKey("pro", &Webhook{ID: "vid", Name: "people"}, req("jane@example.com"))
+	assert.True(t, ok)
+	assert.NotEqual(t, k1, k6)
+
+	// Only SSH certificate requests are cached.
+	_, ok = webhookCacheKey("prov", wh, &webhook.RequestBody{})
+	assert.False(t, ok)
+}
+
+func Test_webhookResponseCache(t *testing.T) {
+	now := time.Now()
+	c := newWebhookResponseCache(&WebhookCache{TTL: &Duration{Duration: time.Minute}, MaxEntries: 2})
+	c.now = func() time.Time { return now }
+
+	var calls int
+	fn := func(resp *webhook.ResponseBody, err error) func(context.Context) (*webhook.ResponseBody, error) {
+		return func(context.Context) (*webhook.ResponseBody, error) {
+			calls++
+			return resp, err
+		}
+	}
+	allow := &webhook.ResponseBody{Allow: true, Data: map[string]any{"role": "dba"}}
+
+	// Misses call fn, hits don't.
+	got, err := c.Do(context.Background(), "a", fn(allow, nil))
+	require.NoError(t, err)
+	assert.Equal(t, allow, got)
+	got, err = c.Do(context.Background(), "a", fn(nil, errors.New("not called")))
+	require.NoError(t, err)
+	assert.Equal(t, allow, got)
+	assert.Equal(t, 1, calls)
+
+	// Errors and denied requests are not cached.
+	_, err = c.Do(context.Background(), "b", fn(nil, errors.New("boom")))
+	assert.EqualError(t, err, "boom")
+	got, err = c.Do(context.Background(), "b", fn(&webhook.ResponseBody{Allow: false}, nil))
+	require.NoError(t, err)
+	assert.False(t, got.Allow)
+	_, ok := c.get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 3, calls)
+
+	// The least recently used entry is evicted.
+	_, err = c.Do(context.Background(), "b", fn(allow, nil))
+	require.NoError(t, err)
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	_, err = c.Do(context.Background(), "c", fn(allow, nil))
+	require.NoError(t, err)
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	_, ok = c.get("c")
+	assert.True(t, ok)
+
+	// Entries expire.
+	now = now.Add(time.Minute)
+	_, ok = c.get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.ll.Len())
+}
+
+func Test_webhookResponseCache_coalesce(t *testing.T) {
+	c := newWebhookResponseCache(&WebhookCache{TTL: &Duration{Duration: time.Minute}})
+	assert.Equal(t, defaultWebhookCacheMaxEntries, c.maxEntries)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (*webhook.ResponseBody, error) {
+		calls.Add(1)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &webhook.ResponseBody{Allow: true}, nil
+	}
+
+	// The first caller stops waiting when it goes away, but the shared call
+	// is not canceled for the other ones.
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.Do(first, "key", fn)
+		firstErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Do(context.Background(), "key", fn)
+			assert.NoError(t, err)
+			assert.True(t, resp.Allow)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestWebhookController_Enrich_cache(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"allow":true,"data":{"role":"dba"}}`))
+	}))
+	defer srv.Close()
+
+	options := &Options{Webhooks: []*Webhook{
+		{ID: "cached", Name: "cached", Kind: linkedca.Webhook_ENRICHING.String(), URL: srv.URL, Cache: &WebhookCache{TTL: &Duration{Duration: time.Minute}}},
+		{ID: "uncached", Name: "uncached", Kind: linkedca.Webhook_ENRICHING.String(), URL: srv.URL},
+	}}
+	ctl, err := NewController(&JWK{Name: "jwk"}, nil, Config{Claims: globalProvisionerClaims}, options)
+	require.NoError(t, err)
+	assert.Len(t, ctl.webhookCaches, 1)
+
+	req := func() *webhook.RequestBody {
+		return &webhook.RequestBody{
+			SSHCertificateRequest: &webhook.SSHCertificateRequest{
+				Type:       "user",
+				KeyID:      "jane@example.com",
+				Principals: []string{"jane"},
+			},
+		}
+	}
+	want := sshutil.TemplateData{"Webhooks": map[string]any{
+		"cached":   map[string]any{"role": "dba"},
+		"uncached": map[string]any{"role": "dba"},
+	}}
+
+	for i := 0; i < 3; i++ {
+		wc := ctl.newWebhookController(sshutil.TemplateData{}, linkedca.Webhook_SSH)
+		require.NoError(t, wc.Enrich(context.Background(), req()))
+		assert.Equal(t, want, wc.TemplateData)
+	}
+	// The first request calls both webhooks, the others only the uncached one.
+	assert.Equal(t, 4, calls)
+
+	// X.509 requests are not cached.
+	wc := ctl.newWebhookController(sshutil.TemplateData{}, linkedca.Webhook_X509)
+	require.NoError(t, wc.Enrich(context.Background(), &webhook.RequestBody{}))
+	assert.Equal(t, 6, calls)
+}
+
+func TestNewController_webhookCache(t *testing.T) {
+	_, err := NewController(&JWK{Name: "jwk"}, nil, Config{Claims: globalProvisionerClaims}, &Options{Webhooks: []*Webhook{
+		{Name: "people", Kind: linkedca.Webhook_ENRICHING.String(), Cache: &WebhookCache{}},
+	}})
+	assert.EqualError(t, err, `webhook "people": webhook cache ttl must be greater than 0`)
+
+	// Caches are only used by enriching webhooks.
+	ctl, err := NewController(&JWK{Name: "jwk"}, nil, Config{Claims: globalProvisionerClaims}, &Options{Webhooks: []*Webhook{
+		{Name: "people", Kind: linkedca.Webhook_AUTHORIZING.String(), Cache: &WebhookCache{TTL: &Duration{Duration: time.Minute}}},
+	}})
+	require.NoError(t, err)
+	assert.Nil(t, ctl.webhookCaches)
+}
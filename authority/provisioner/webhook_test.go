@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -11,6 +12,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -19,8 +21,13 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
 
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/sshutil"
 	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 
@@ -272,6 +279,183 @@ func TestWebhookController_Enrich(t *testing.T) {
 	}
 }
 
+func TestWebhookController_Enrich_failurePolicy(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The body must be read to detect the closed connection.
+		io.Copy(io.Discard, r.Body) //nolint:errcheck // test server
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	deny := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"allow":false}`))
+	}))
+	defer deny.Close()
+	allow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"allow":true,"data":{"role":"dba"}}`))
+	}))
+	defer allow.Close()
+
+	timeout := &Duration{Duration: 50 * time.Millisecond}
+	tests := []struct {
+		name               string
+		webhooks           []*Webhook
+		expectErr          error
+		expectTemplateData any
+	}{
+		{"ok/fail-open", []*Webhook{
+			{Name: "slow", Kind: "ENRICHING", URL: slow.URL, Timeout: timeout, FailurePolicy: WebhookFailOpen},
+			{Name: "people", Kind: "ENRICHING", URL: allow.URL},
+		}, nil, sshutil.TemplateData{"Webhooks": map[string]any{"people": map[string]any{"role": "dba"}}}},
+		{"fail/fail-closed", []*Webhook{
+			{Name: "slow", Kind: "ENRICHING", URL: slow.URL, Timeout: timeout, FailurePolicy: WebhookFailClosed},
+			{Name: "people", Kind: "ENRICHING", URL: allow.URL},
+		}, context.DeadlineExceeded, sshutil.TemplateData{}},
+		{"fail/default", []*Webhook{
+			{Name: "slow", Kind: "ENRICHING", URL: slow.URL, Timeout: timeout},
+		}, context.DeadlineExceeded, sshutil.TemplateData{}},
+		{"fail/deny-fail-open", []*Webhook{
+			{Name: "deny", Kind: "ENRICHING", URL: deny.URL, FailurePolicy: WebhookFailOpen},
+		}, ErrWebhookDenied, sshutil.TemplateData{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctl := &WebhookController{
+				client:       http.DefaultClient,
+				webhooks:     tc.webhooks,
+				certType:     linkedca.Webhook_SSH,
+				TemplateData: sshutil.TemplateData{},
+			}
+			err := ctl.Enrich(context.Background(), &webhook.RequestBody{})
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectTemplateData, ctl.TemplateData)
+		})
+	}
+}
+
+func TestWebhookController_Enrich_denyField(t *testing.T) {
+	newServer := func(data string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"allow":true,"data":` + data + `}`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	active := newServer(`{"status":"active","decommissioned":false}`)
+	decommissioned := newServer(`{"status":"retired","decommissioned":true}`)
+	reason := newServer(`{"status":"retired","decommissioned":"host retired on 2024-01-01"}`)
+
+	tests := []struct {
+		name               string
+		webhook            *Webhook
+		expectErr          string
+		expectTemplateData any
+	}{
+		{"ok", &Webhook{Name: "cmdb", Kind: "ENRICHING", URL: active.URL, DenyField: "decommissioned"}, "",
+			sshutil.TemplateData{"Webhooks": map[string]any{"cmdb": map[string]any{"status": "active", "decommissioned": false}}}},
+		{"ok/no-deny-field", &Webhook{Name: "cmdb", Kind: "ENRICHING", URL: decommissioned.URL}, "",
+			sshutil.TemplateData{"Webhooks": map[string]any{"cmdb": map[string]any{"status": "retired", "decommissioned": true}}}},
+		{"fail/denied", &Webhook{Name: "cmdb", Kind: "ENRICHING", URL: decommissioned.URL, DenyField: "decommissioned"},
+			`webhook server did not allow request: webhook "cmdb" denied the request`, sshutil.TemplateData{}},
+		{"fail/denied-reason", &Webhook{Name: "cmdb", Kind: "ENRICHING", URL: reason.URL, DenyField: "decommissioned", FailurePolicy: WebhookFailOpen},
+			`webhook server did not allow request: webhook "cmdb" denied the request: host retired on 2024-01-01`, sshutil.TemplateData{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctl := &WebhookController{
+				client:       http.DefaultClient,
+				webhooks:     []*Webhook{tc.webhook},
+				certType:     linkedca.Webhook_SSH,
+				TemplateData: sshutil.TemplateData{},
+			}
+			err := ctl.Enrich(context.Background(), &webhook.RequestBody{})
+			if tc.expectErr != "" {
+				assert.ErrorIs(t, err, ErrWebhookDenied)
+				assert.EqualError(t, err, tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectTemplateData, ctl.TemplateData)
+		})
+	}
+}
+
+func TestWebhook_CertTypeEnum(t *testing.T) {
+	tests := []struct {
+		certType string
+		want     linkedca.Webhook_CertType
+		wantErr  bool
+	}{
+		{"", linkedca.Webhook_ALL, false},
+		{"ALL", linkedca.Webhook_ALL, false},
+		{"X509", linkedca.Webhook_X509, false},
+		{"SSH", linkedca.Webhook_SSH, false},
+		{"x509", linkedca.Webhook_ALL, true},
+		{"ssh", linkedca.Webhook_ALL, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.certType, func(t *testing.T) {
+			wh := &Webhook{Name: "wh", CertType: tc.certType}
+			got, err := wh.CertTypeEnum()
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	// A webhook with an invalid certType is never executed.
+	wh := &Webhook{Name: "wh", Kind: "SCEPCHALLENGE", CertType: "x509"}
+	assert.False(t, isCertTypeOK(wh))
+	ctl := &WebhookController{certType: linkedca.Webhook_X509}
+	assert.False(t, ctl.isCertTypeOK(wh))
+	wh.CertType = "X509"
+	assert.True(t, isCertTypeOK(wh))
+	assert.True(t, ctl.isCertTypeOK(wh))
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook *Webhook
+		wantErr string
+	}{
+		{"ok", &Webhook{Name: "wh", Kind: "ENRICHING"}, ""},
+		{"ok/fail-open", &Webhook{Name: "wh", Kind: "ENRICHING", FailurePolicy: WebhookFailOpen, Timeout: &Duration{Duration: time.Second}}, ""},
+		{"ok/fail-closed", &Webhook{Name: "wh", Kind: "ENRICHING", FailurePolicy: WebhookFailClosed}, ""},
+		{"ok/cert-type", &Webhook{Name: "wh", Kind: "SCEPCHALLENGE", CertType: "X509"}, ""},
+		{"ok/cert-type-all", &Webhook{Name: "wh", Kind: "NOTIFYING", CertType: "ALL"}, ""},
+		{"fail/policy", &Webhook{Name: "wh", Kind: "ENRICHING", FailurePolicy: "ignore"}, `webhook "wh" failurePolicy "ignore" is not supported`},
+		{"fail/timeout", &Webhook{Name: "wh", Kind: "ENRICHING", Timeout: &Duration{Duration: -time.Second}}, `webhook "wh" timeout cannot be negative`},
+		{"fail/no-kind", &Webhook{Name: "wh"}, `webhook "wh" kind "" is not supported, it must be one of ENRICHING, AUTHORIZING, SCEPCHALLENGE, NOTIFYING`},
+		{"fail/kind", &Webhook{Name: "wh", Kind: "enriching"}, `webhook "wh" kind "enriching" is not supported, it must be one of ENRICHING, AUTHORIZING, SCEPCHALLENGE, NOTIFYING`},
+		{"fail/kind-no-kind", &Webhook{Name: "wh", Kind: "NO_KIND"}, `webhook "wh" kind "NO_KIND" is not supported, it must be one of ENRICHING, AUTHORIZING, SCEPCHALLENGE, NOTIFYING`},
+		{"fail/cert-type", &Webhook{Name: "wh", Kind: "SCEPCHALLENGE", CertType: "x509"}, `webhook "wh" certType "x509" is not supported, it must be one of ALL, X509, SSH`},
+		{"ok/response-mapping", &Webhook{Name: "wh", Kind: "SCEPCHALLENGE", ResponseMapping: `{{ eq .Body.result "approved" }}`}, ""},
+		{"fail/response-mapping", &Webhook{Name: "wh", Kind: "SCEPCHALLENGE", ResponseMapping: `{{ eq .Body.result "approved" `}, `webhook "wh" responseMapping is not valid: template: responseMapping:1: unclosed action`},
+		{"fail/response-mapping-kind", &Webhook{Name: "wh", Kind: "AUTHORIZING", ResponseMapping: `{{ .Body.allowed }}`}, `webhook "wh" responseMapping is only supported on SCEPCHALLENGE webhooks`},
+		{"ok/deny-field", &Webhook{Name: "wh", Kind: "ENRICHING", DenyField: "decommissioned"}, ""},
+		{"fail/deny-field-kind", &Webhook{Name: "wh", Kind: "AUTHORIZING", DenyField: "decommissioned"}, `webhook "wh" denyField is only supported on ENRICHING webhooks`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.webhook.Validate()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWebhook_timeout(t *testing.T) {
+	assert.Equal(t, 10*time.Second, (&Webhook{}).timeout())
+	assert.Equal(t, 10*time.Second, (&Webhook{Timeout: &Duration{}}).timeout())
+	assert.Equal(t, time.Second, (&Webhook{Timeout: &Duration{Duration: time.Second}}).timeout())
+}
+
 func TestWebhookController_Authorize(t *testing.T) {
 	cert, err := pemutil.ReadCertificate("testdata/certs/x5c-leaf.crt", pemutil.WithFirstBlock())
 	require.NoError(t, err)
@@ -622,3 +806,330 @@ func TestWebhook_Do(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestWebhook_DoWithRetry(t *testing.T) {
+	type test struct {
+		statusCodes  []int
+		allow        bool
+		retry        *WebhookRetry
+		timeout      time.Duration
+		wantAttempts int
+		wantErr      string
+	}
+	tests := map[string]test{
+		"ok/first-attempt": {
+			statusCodes:  []int{200},
+			allow:        true,
+			retry:        &WebhookRetry{MaxRetries: 3},
+			wantAttempts: 1,
+		},
+		"ok/after-retries": {
+			statusCodes:  []int{500, 503, 200},
+			allow:        true,
+			retry:        &WebhookRetry{MaxRetries: 3},
+			wantAttempts: 3,
+		},
+		"ok/deny-not-retried": {
+			statusCodes:  []int{200},
+			allow:        false,
+			retry:        &WebhookRetry{MaxRetries: 3},
+			wantAttempts: 1,
+		},
+		"fail/4xx-not-retried": {
+			statusCodes:  []int{400},
+			retry:        &WebhookRetry{MaxRetries: 3},
+			wantAttempts: 1,
+			wantErr:      "Webhook server responded with 400",
+		},
+		"fail/exhausted": {
+			statusCodes:  []int{500, 502, 503, 504},
+			retry:        &WebhookRetry{MaxRetries: 2},
+			wantAttempts: 3,
+			wantErr:      "Webhook server responded with 503",
+		},
+		"fail/no-retries": {
+			statusCodes:  []int{500},
+			retry:        nil,
+			wantAttempts: 1,
+			wantErr:      "Webhook server responded with 500",
+		},
+		"fail/deadline": {
+			statusCodes:  []int{500, 200},
+			retry:        &WebhookRetry{MaxRetries: 3, BaseDelay: &Duration{Duration: time.Minute}},
+			timeout:      time.Second,
+			wantAttempts: 1,
+			wantErr:      "Webhook server responded with 500",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var attempts int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				code := tc.statusCodes[attempts]
+				attempts++
+				if code != 200 {
+					w.WriteHeader(code)
+					return
+				}
+				err := json.NewEncoder(w).Encode(&webhook.ResponseBody{Allow: tc.allow})
+				assert.NoError(t, err)
+			}))
+			defer srv.Close()
+
+			if tc.retry != nil && tc.retry.BaseDelay == nil {
+				tc.retry.BaseDelay = &Duration{Duration: time.Millisecond}
+			}
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			wh := &Webhook{
+				Name:   "retry",
+				URL:    srv.URL,
+				Secret: "MTIzNAo=",
+			}
+			got, err := wh.DoWithRetry(ctx, http.DefaultClient, &webhook.RequestBody{}, nil, tc.retry)
+			assert.Equal(t, tc.wantAttempts, attempts)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.allow, got.Allow)
+		})
+	}
+
+	t.Run("fail/network-error", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		wh := &Webhook{URL: srv.URL, Secret: "MTIzNAo="}
+		_, err := wh.DoWithRetry(context.Background(), http.DefaultClient, &webhook.RequestBody{}, nil, &WebhookRetry{
+			MaxRetries: 2,
+			BaseDelay:  &Duration{Duration: time.Millisecond},
+		})
+		assert.ErrorContains(t, err, "connection refused")
+	})
+}
+
+// testSpan is a trace.Span that records its attributes and status.
+type testSpan struct {
+	tracenoop.Span
+	sc     trace.SpanContext
+	name   string
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	ended  bool
+}
+
+func (s *testSpan) SpanContext() trace.SpanContext   { return s.sc }
+func (s *testSpan) IsRecording() bool                { return !s.ended }
+func (s *testSpan) SetStatus(c codes.Code, _ string) { s.status = c }
+func (s *testSpan) End(...trace.SpanEndOption)       { s.ended = true }
+func (s *testSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+// testTracerProvider is a trace.TracerProvider that records the spans started
+// by its tracers.
+type testTracerProvider struct {
+	tracenoop.TracerProvider
+	spans []*testSpan
+}
+
+func (p *testTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &testTracer{provider: p}
+}
+
+type testTracer struct {
+	tracenoop.Tracer
+	provider *testTracerProvider
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &testSpan{
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+			TraceFlags: trace.FlagsSampled,
+		}),
+		name:  name,
+		attrs: map[attribute.Key]attribute.Value{},
+	}
+	cfg := trace.NewSpanStartConfig(opts...)
+	span.SetAttributes(cfg.Attributes()...)
+	t.provider.spans = append(t.provider.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type testWebhookMeter struct {
+	calls []string
+}
+
+func (m *testWebhookMeter) WebhookCalled(name, kind string, statusCode int, outcome WebhookOutcome, d time.Duration) {
+	m.calls = append(m.calls, fmt.Sprintf("%s/%s/%d/%s", name, kind, statusCode, outcome))
+}
+
+func TestWebhook_DoWithRetry_instrumentation(t *testing.T) {
+	tp := &testTracerProvider{}
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		switch r.URL.Path {
+		case "/allow":
+			w.Write([]byte(`{"allow":true}`))
+		case "/deny":
+			w.Write([]byte(`{"allow":false}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	meter := &testWebhookMeter{}
+	ctx := NewTracerProviderContext(NewMeterContext(context.Background(), meter), tp)
+	for _, path := range []string{"/allow", "/deny", "/fail"} {
+		wh := &Webhook{Name: path, Kind: linkedca.Webhook_SCEPCHALLENGE.String(), URL: srv.URL + path, Secret: "MTIzNAo="}
+		_, err := wh.DoWithRetry(ctx, srv.Client(), &webhook.RequestBody{}, nil, &WebhookRetry{})
+		assert.Equal(t, path == "/fail", err != nil)
+		// The trace context is sent to the webhook server.
+		assert.Equal(t, "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01", traceparent)
+	}
+
+	assert.Equal(t, []string{
+		"/allow/SCEPCHALLENGE/200/allowed",
+		"/deny/SCEPCHALLENGE/200/denied",
+		"/fail/SCEPCHALLENGE/503/error",
+	}, meter.calls)
+
+	require.Len(t, tp.spans, 3)
+	for i, outcome := range []string{"allowed", "denied", "error"} {
+		span := tp.spans[i]
+		assert.True(t, span.ended)
+		assert.Equal(t, "webhook "+span.attrs["webhook.name"].AsString(), span.name)
+		assert.Equal(t, "SCEPCHALLENGE", span.attrs["webhook.kind"].AsString())
+		assert.Equal(t, outcome, span.attrs["webhook.outcome"].AsString())
+	}
+	assert.Equal(t, int64(200), tp.spans[0].attrs["http.response.status_code"].AsInt64())
+	assert.Equal(t, int64(503), tp.spans[2].attrs["http.response.status_code"].AsInt64())
+	assert.Equal(t, codes.Unset, tp.spans[1].status)
+	assert.Equal(t, codes.Error, tp.spans[2].status)
+}
+
+func TestWebhook_DoWithContext_headers(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte(`{"allow":true}`))
+	}))
+	defer srv.Close()
+
+	wh := &Webhook{ID: "id", Name: "my-webhook", Kind: linkedca.Webhook_AUTHORIZING.String(), URL: srv.URL, CertType: "X509", BearerToken: "token"}
+	_, err := NewController(&JWK{}, nil, Config{
+		Claims: globalProvisionerClaims,
+		WebhookHeaders: http.Header{
+			"User-Agent": {"step-ca/1.2.3"},
+			"X-Tenant":   {"tenant1"},
+		},
+	}, &Options{Webhooks: []*Webhook{wh}})
+	require.NoError(t, err)
+
+	_, err = wh.DoWithContext(context.Background(), srv.Client(), &webhook.RequestBody{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "step-ca/1.2.3", header.Get("User-Agent"))
+	assert.Equal(t, "tenant1", header.Get("X-Tenant"))
+	// The headers of the CA are still sent.
+	assert.Equal(t, "id", header.Get("X-Smallstep-Webhook-ID"))
+	assert.NotEmpty(t, header.Get("X-Smallstep-Signature"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+}
+
+func TestWebhook_DoWithContext_signingAlg(t *testing.T) {
+	secret := []byte("secret")
+	tests := []struct {
+		name    string
+		kind    string
+		alg     string
+		wantAlg string
+		newHash func() hash.Hash
+		wantErr string
+	}{
+		{"ok/default", linkedca.Webhook_SCEPCHALLENGE.String(), "", "SHA-256", sha256.New, ""},
+		{"ok/sha256", linkedca.Webhook_SCEPCHALLENGE.String(), "SHA-256", "SHA-256", sha256.New, ""},
+		{"ok/sha384", linkedca.Webhook_SCEPCHALLENGE.String(), "SHA-384", "SHA-384", sha512.New384, ""},
+		{"ok/sha512", linkedca.Webhook_SCEPCHALLENGE.String(), "SHA-512", "SHA-512", sha512.New, ""},
+		{"ok/other-kind", linkedca.Webhook_ENRICHING.String(), "SHA-512", "SHA-256", sha256.New, ""},
+		{"fail/unknown", linkedca.Webhook_SCEPCHALLENGE.String(), "sha1", "", nil, `webhook "my-webhook" signingAlg "sha1" is not supported`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantAlg, r.Header.Get("X-Smallstep-Signature-Algorithm"))
+
+				sig, err := hex.DecodeString(r.Header.Get("X-Smallstep-Signature"))
+				require.NoError(t, err)
+				h := hmac.New(tc.newHash, secret)
+				h.Write(body)
+				assert.True(t, hmac.Equal(h.Sum(nil), sig))
+
+				reqBody := new(webhook.RequestBody)
+				require.NoError(t, json.Unmarshal(body, reqBody))
+				ts, err := time.Parse(time.RFC3339Nano, r.Header.Get("X-Smallstep-Timestamp"))
+				require.NoError(t, err)
+				assert.True(t, reqBody.Timestamp.Equal(ts))
+
+				w.Write([]byte(`{"allow":true}`))
+			}))
+			defer srv.Close()
+
+			wh := &Webhook{
+				Name:       "my-webhook",
+				URL:        srv.URL,
+				Kind:       tc.kind,
+				Secret:     base64.StdEncoding.EncodeToString(secret),
+				SigningAlg: tc.alg,
+			}
+			resp, err := wh.DoWithContext(context.Background(), http.DefaultClient, &webhook.RequestBody{}, nil)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				assert.EqualError(t, wh.ValidateSigningAlg(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, resp.Allow)
+			assert.NoError(t, wh.ValidateSigningAlg())
+		})
+	}
+}
+
+func TestWebhookRetry_delay(t *testing.T) {
+	r := &WebhookRetry{BaseDelay: &Duration{Duration: 100 * time.Millisecond}}
+	assert.Equal(t, 100*time.Millisecond, r.delay(1))
+	assert.Equal(t, 200*time.Millisecond, r.delay(2))
+	assert.Equal(t, 400*time.Millisecond, r.delay(3))
+
+	assert.Equal(t, time.Second, (&WebhookRetry{}).delay(1))
+
+	r.Jitter = &Duration{Duration: 50 * time.Millisecond}
+	for i := 0; i < 10; i++ {
+		d := r.delay(1)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.Less(t, d, 150*time.Millisecond)
+	}
+}
+
+func TestWebhookRetry_Validate(t *testing.T) {
+	assert.NoError(t, (&WebhookRetry{MaxRetries: 3, BaseDelay: &Duration{Duration: time.Second}, Jitter: &Duration{Duration: time.Second}}).Validate())
+	assert.EqualError(t, (&WebhookRetry{MaxRetries: -1}).Validate(), "webhook retry maxRetries cannot be negative")
+	assert.EqualError(t, (&WebhookRetry{BaseDelay: &Duration{Duration: -time.Second}}).Validate(), "webhook retry baseDelay cannot be negative")
+	assert.EqualError(t, (&WebhookRetry{Jitter: &Duration{Duration: -time.Second}}).Validate(), "webhook retry jitter cannot be negative")
+}
@@ -0,0 +1,148 @@
+package provisioner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// WebhookTLS configures the TLS options used on the connections to a webhook
+// server. A dedicated client is created for the webhooks using it, webhooks
+// without it use the client shared by all provisioners.
+type WebhookTLS struct {
+	// Certificate and Key are the paths to the PEM encoded certificate and key
+	// used to authenticate with the webhook server using mTLS. The files are
+	// reloaded if they change.
+	Certificate string `json:"crt,omitempty"`
+	Key         string `json:"key,omitempty"`
+	// Root is the path to a PEM bundle used to verify the webhook server
+	// certificate. If it's not set, the roots of the shared client are used.
+	Root string `json:"root,omitempty"`
+}
+
+// Validate returns an error if the TLS options are not valid.
+func (t *WebhookTLS) Validate() error {
+	switch {
+	case t.Certificate == "" && t.Key == "" && t.Root == "":
+		return errors.New("webhook tls requires a crt and key or a root")
+	case (t.Certificate == "") != (t.Key == ""):
+		return errors.New("webhook tls crt and key must be set together")
+	}
+	return nil
+}
+
+// newClient returns a copy of the given client that uses the configured client
+// certificate and roots. It validates the key pair and the roots.
+func (t *WebhookTLS) newClient(base *http.Client) (*http.Client, error) {
+	var transport *http.Transport
+	if base != nil {
+		if tr, ok := base.Transport.(*http.Transport); ok {
+			transport = tr.Clone()
+		}
+	}
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+
+	tlsConfig := transport.TLSClientConfig.Clone()
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if t.Root != "" {
+		b, err := os.ReadFile(t.Root)
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook tls root: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("error parsing webhook tls root: no certificates found in %s", t.Root)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.Certificate != "" {
+		cert, err := newWebhookCertificate(t.Certificate, t.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = nil
+		tlsConfig.GetClientCertificate = cert.GetClientCertificate
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	client := &http.Client{Transport: transport}
+	if base != nil {
+		client.Timeout = base.Timeout
+	}
+	return client, nil
+}
+
+// webhookCertificate is a client certificate that is reloaded when the
+// certificate or key files change.
+type webhookCertificate struct {
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certMod  time.Time
+	keyMod   time.Time
+}
+
+func newWebhookCertificate(certFile, keyFile string) (*webhookCertificate, error) {
+	c := &webhookCertificate{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads the key pair and the modification times of the files. The
+// current certificate is kept if the key pair cannot be read.
+func (c *webhookCertificate) load() error {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return fmt.Errorf("error loading webhook tls certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading webhook tls certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading webhook tls certificate: %w", err)
+	}
+	c.cert = &cert
+	c.certMod = certInfo.ModTime()
+	c.keyMod = keyInfo.ModTime()
+	return nil
+}
+
+// GetClientCertificate implements the tls.Config GetClientCertificate
+// callback. It reloads the key pair if any of the files has changed.
+func (c *webhookCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changed() {
+		if err := c.load(); err != nil {
+			log.Printf("Failed to reload webhook certificate %s: %v", c.certFile, err)
+		}
+	}
+	return c.cert, nil
+}
+
+func (c *webhookCertificate) changed() bool {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(c.certMod) || !keyInfo.ModTime().Equal(c.keyMod)
+}
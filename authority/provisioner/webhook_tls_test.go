@@ -0,0 +1,182 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/webhook"
+)
+
+// writeTestKeyPair writes a self-signed certificate and its key to the
+// given files.
+func writeTestKeyPair(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}, key.Public(), key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestWebhookTLS_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     *WebhookTLS
+		wantErr string
+	}{
+		{"ok/mtls", &WebhookTLS{Certificate: "crt", Key: "key"}, ""},
+		{"ok/root", &WebhookTLS{Root: "root"}, ""},
+		{"ok/all", &WebhookTLS{Certificate: "crt", Key: "key", Root: "root"}, ""},
+		{"fail/empty", &WebhookTLS{}, "webhook tls requires a crt and key or a root"},
+		{"fail/crt-only", &WebhookTLS{Certificate: "crt"}, "webhook tls crt and key must be set together"},
+		{"fail/key-only", &WebhookTLS{Key: "key", Root: "root"}, "webhook tls crt and key must be set together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tls.Validate()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_webhookCertificate_reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeTestKeyPair(t, certFile, keyFile, "first")
+
+	c, err := newWebhookCertificate(certFile, keyFile)
+	require.NoError(t, err)
+	commonName := func() string {
+		cert, err := c.GetClientCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", commonName())
+
+	// The key pair is reloaded when the files change.
+	writeTestKeyPair(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+	assert.Equal(t, "second", commonName())
+
+	// An invalid key pair keeps the current certificate.
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+	assert.Equal(t, "second", commonName())
+
+	_, err = newWebhookCertificate(certFile, keyFile)
+	assert.ErrorContains(t, err, "error loading webhook tls certificate")
+	_, err = newWebhookCertificate(filepath.Join(dir, "missing.crt"), keyFile)
+	assert.ErrorContains(t, err, "error loading webhook tls certificate")
+}
+
+func TestNewController_webhookTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeTestKeyPair(t, certFile, keyFile, "client")
+
+	mtls := &WebhookTLS{Certificate: certFile, Key: keyFile}
+	options := &Options{Webhooks: []*Webhook{
+		{Name: "a", Kind: linkedca.Webhook_ENRICHING.String(), TLS: mtls},
+		{Name: "b", Kind: linkedca.Webhook_AUTHORIZING.String(), TLS: &WebhookTLS{Certificate: certFile, Key: keyFile}},
+		{Name: "c", Kind: linkedca.Webhook_AUTHORIZING.String(), TLS: &WebhookTLS{Certificate: certFile, Key: keyFile, Root: "testdata/certs/root_ca.crt"}},
+		{Name: "d", Kind: linkedca.Webhook_AUTHORIZING.String()},
+	}}
+	_, err := NewController(&JWK{Name: "jwk"}, nil, Config{Claims: globalProvisionerClaims}, options)
+	require.NoError(t, err)
+
+	// Webhooks with the same options share the client, and webhooks without
+	// them use the shared one.
+	whs := options.Webhooks
+	require.NotNil(t, whs[0].client)
+	assert.Same(t, whs[0].client, whs[1].client)
+	assert.NotSame(t, whs[0].client, whs[2].client)
+	assert.Nil(t, whs[3].client)
+	assert.NotNil(t, whs[2].client.Transport.(*http.Transport).TLSClientConfig.RootCAs)
+
+	tests := []struct {
+		name    string
+		wh      *Webhook
+		wantErr string
+	}{
+		{"fail/validate", &Webhook{Name: "people", Kind: linkedca.Webhook_AUTHORIZING.String(), TLS: &WebhookTLS{Certificate: certFile}}, `webhook "people": webhook tls crt and key must be set together`},
+		{"fail/disableTLSClientAuth", &Webhook{Name: "people", Kind: linkedca.Webhook_AUTHORIZING.String(), DisableTLSClientAuth: true, TLS: mtls}, `webhook "people" cannot set tls with disableTLSClientAuth`},
+		{"fail/key-pair", &Webhook{Name: "people", Kind: linkedca.Webhook_AUTHORIZING.String(), TLS: &WebhookTLS{Certificate: certFile, Key: "testdata/secrets/foo.key"}}, `webhook "people": error loading webhook tls certificate`},
+		{"fail/root", &Webhook{Name: "people", Kind: linkedca.Webhook_AUTHORIZING.String(), TLS: &WebhookTLS{Root: keyFile}}, `webhook "people": error parsing webhook tls root`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewController(&JWK{Name: "jwk"}, nil, Config{Claims: globalProvisionerClaims}, &Options{Webhooks: []*Webhook{tt.wh}})
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestWebhook_DoWithContext_mTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "client" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"allow":true}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	rootFile := filepath.Join(dir, "root.crt")
+	writeTestKeyPair(t, certFile, keyFile, "client")
+	require.NoError(t, os.WriteFile(rootFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600))
+
+	authorizing := linkedca.Webhook_AUTHORIZING.String()
+	options := &Options{Webhooks: []*Webhook{
+		{Name: "mtls", Kind: authorizing, URL: srv.URL, TLS: &WebhookTLS{Certificate: certFile, Key: keyFile, Root: rootFile}},
+	}}
+	_, err := NewController(&JWK{Name: "jwk"}, nil, Config{Claims: globalProvisionerClaims, WebhookClient: srv.Client()}, options)
+	require.NoError(t, err)
+
+	resp, err := options.Webhooks[0].DoWithContext(context.Background(), srv.Client(), &webhook.RequestBody{}, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.Allow)
+
+	// The shared client does not send the client certificate.
+	wh := &Webhook{Name: "shared", Kind: authorizing, URL: srv.URL}
+	_, err = wh.DoWithRetry(context.Background(), srv.Client(), &webhook.RequestBody{}, nil, &WebhookRetry{})
+	assert.Error(t, err)
+}
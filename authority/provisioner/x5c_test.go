@@ -803,6 +803,8 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 							case *sshNamePolicyValidator:
 								assert.Equals(t, nil, v.userPolicyEngine)
 								assert.Equals(t, nil, v.hostPolicyEngine)
+							case *sshExtensionsModifier:
+								assert.Equals(t, v, &sshExtensionsModifier{})
 							case *sshDefaultPublicKeyValidator, *sshCertDefaultValidator, sshCertificateOptionsFunc:
 							case *WebhookController:
 								assert.Len(t, 0, v.webhooks)
@@ -814,9 +816,9 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 							tot++
 						}
 						if tc.claims.Step.SSH.CertType != "" {
-							assert.Equals(t, tot, 12)
+							assert.Equals(t, tot, 13)
 						} else {
-							assert.Equals(t, tot, 10)
+							assert.Equals(t, tot, 11)
 						}
 					}
 				}
@@ -3,10 +3,13 @@ package authority
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"log"
 	"os"
 
 	"github.com/pkg/errors"
@@ -17,6 +20,7 @@ import (
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/administrator"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
@@ -82,7 +86,7 @@ func (p *wrappedProvisioner) RAInfo() *provisioner.RAInfo {
 func (a *Authority) GetEncryptedKey(kid string) (string, error) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	key, ok := a.provisioners.LoadEncryptedKey(kid)
+	key, ok := a.getProvisioners().LoadEncryptedKey(kid)
 	if !ok {
 		return "", errs.NotFound("encrypted key with kid %s was not found", kid)
 	}
@@ -94,7 +98,7 @@ func (a *Authority) GetEncryptedKey(kid string) (string, error) {
 func (a *Authority) GetProvisioners(cursor string, limit int) (provisioner.List, string, error) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	provisioners, nextCursor := a.provisioners.Find(cursor, limit)
+	provisioners, nextCursor := a.getProvisioners().Find(cursor, limit)
 	return provisioners, nextCursor, nil
 }
 
@@ -110,7 +114,7 @@ func (a *Authority) LoadProvisionerByCertificate(crt *x509.Certificate) (provisi
 }
 
 func (a *Authority) unsafeLoadProvisionerFromExtension(crt *x509.Certificate) (provisioner.Interface, error) {
-	p, ok := a.provisioners.LoadByCertificate(crt)
+	p, ok := a.getProvisioners().LoadByCertificate(crt)
 	if !ok || p.GetType() == 0 {
 		return nil, admin.NewError(admin.ErrorNotFoundType, "unable to load provisioner from certificate")
 	}
@@ -133,7 +137,7 @@ func (a *Authority) unsafeLoadProvisionerFromDatabase(crt *x509.Certificate) (pr
 		data, err = cdg.GetCertificateData(crt.SerialNumber.String())
 	}
 	if err == nil && data != nil && data.Provisioner != nil {
-		if p, ok := a.provisioners.Load(data.Provisioner.ID); ok {
+		if p, ok := a.getProvisioners().Load(data.Provisioner.ID); ok {
 			if data.RaInfo != nil {
 				return wrapRAProvisioner(p, data.RaInfo), nil
 			}
@@ -148,7 +152,7 @@ func (a *Authority) unsafeLoadProvisionerFromDatabase(crt *x509.Certificate) (pr
 func (a *Authority) LoadProvisionerByToken(token *jose.JSONWebToken, claims *jose.Claims) (provisioner.Interface, error) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	p, ok := a.provisioners.LoadByToken(token, claims)
+	p, ok := a.getProvisioners().LoadByToken(token, claims)
 	if !ok {
 		return nil, admin.NewError(admin.ErrorNotFoundType, "unable to load provisioner from token")
 	}
@@ -159,7 +163,7 @@ func (a *Authority) LoadProvisionerByToken(token *jose.JSONWebToken, claims *jos
 func (a *Authority) LoadProvisionerByID(id string) (provisioner.Interface, error) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	p, ok := a.provisioners.Load(id)
+	p, ok := a.getProvisioners().Load(id)
 	if !ok {
 		return nil, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", id)
 	}
@@ -170,16 +174,155 @@ func (a *Authority) LoadProvisionerByID(id string) (provisioner.Interface, error
 func (a *Authority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
 	a.adminMutex.RLock()
 	defer a.adminMutex.RUnlock()
-	p, ok := a.provisioners.LoadByName(name)
+	p, ok := a.getProvisioners().LoadByName(name)
 	if !ok {
 		return nil, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", name)
 	}
 	return p, nil
 }
 
+// ReloadProvisioners replaces the provisioners and the global claims with the
+// ones in the given configuration. The new provisioners are initialized before
+// replacing the current ones, so if the configuration is not valid, the
+// current provisioners are kept. Other parts of the authority, like signing
+// keys, are not modified.
+//
+// It returns the names of the provisioners added and removed. Provisioners
+// cannot be reloaded if they are managed with the admin API.
+func (a *Authority) ReloadProvisioners(ctx context.Context, cfg *config.Config) (added, removed []string, err error) {
+	if a.config.AuthorityConfig.EnableAdmin {
+		return nil, nil, errors.New("provisioners cannot be reloaded if the admin API is enabled")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	provisionerConfig, err := a.generateProvisionerConfigWithClaims(ctx, cfg.AuthorityConfig.Claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provList := cfg.AuthorityConfig.Provisioners
+	provClxn := provisioner.NewCollection(provisionerConfig.Audiences)
+	for _, p := range provList {
+		if err := p.Init(provisionerConfig); err != nil {
+			closeProvisioners(provList)
+			return nil, nil, err
+		}
+		if err := provClxn.Store(p); err != nil {
+			closeProvisioners(provList)
+			return nil, nil, err
+		}
+	}
+
+	current := make(map[string]bool)
+	for _, p := range a.config.AuthorityConfig.Provisioners {
+		current[p.GetName()] = true
+	}
+	for _, p := range provList {
+		if !current[p.GetName()] {
+			added = append(added, p.GetName())
+		}
+		delete(current, p.GetName())
+	}
+	for _, p := range a.config.AuthorityConfig.Provisioners {
+		if current[p.GetName()] {
+			removed = append(removed, p.GetName())
+		}
+	}
+
+	a.provisionersMutex.Lock()
+	old := allProvisioners(a.provisioners)
+	a.config.AuthorityConfig.Provisioners = provList
+	a.config.AuthorityConfig.Claims = cfg.AuthorityConfig.Claims
+	a.provisioners = provClxn
+	a.admins = administrator.NewCollection(provClxn)
+	a.provisionersMutex.Unlock()
+	closeReplacedProvisioners(old, provList)
+
+	if a.requiresSCEP() && a.GetSCEP() != nil {
+		a.scepAuthority.UpdateProvisioners(a.getSCEPProvisionerNames())
+		if err := a.scepAuthority.Validate(); err != nil {
+			log.Printf("failed validating SCEP authority: %v\n", err)
+		}
+	}
+
+	return added, removed, nil
+}
+
+// getProvisioners returns the provisioners collection, which is replaced when
+// the provisioners are reloaded.
+func (a *Authority) getProvisioners() *provisioner.Collection {
+	a.provisionersMutex.RLock()
+	defer a.provisionersMutex.RUnlock()
+	return a.provisioners
+}
+
+// getAdmins returns the admins collection, which is replaced when the
+// provisioners are reloaded.
+func (a *Authority) getAdmins() *administrator.Collection {
+	a.provisionersMutex.RLock()
+	defer a.provisionersMutex.RUnlock()
+	return a.admins
+}
+
+// allProvisioners returns all the provisioners in the given collection.
+func allProvisioners(c *provisioner.Collection) provisioner.List {
+	var list provisioner.List
+	if c == nil {
+		return list
+	}
+	for cursor := ""; ; {
+		var l provisioner.List
+		l, cursor = c.Find(cursor, 100)
+		list = append(list, l...)
+		if cursor == "" {
+			return list
+		}
+	}
+}
+
+// closeProvisioners releases the resources of the provisioners that keep
+// them, like the gRPC connections of the SCEP provisioners.
+func closeProvisioners(list provisioner.List) {
+	for _, p := range list {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("error closing provisioner %s: %v", p.GetName(), err)
+			}
+		}
+	}
+}
+
+// closeReplacedProvisioners closes the old provisioners that are not in the
+// current list. The provisioners initialized again are kept open.
+func closeReplacedProvisioners(old, current provisioner.List) {
+	keep := make(map[provisioner.Interface]bool, len(current))
+	for _, p := range current {
+		keep[p] = true
+	}
+	var replaced provisioner.List
+	for _, p := range old {
+		if !keep[p] {
+			replaced = append(replaced, p)
+		}
+	}
+	closeProvisioners(replaced)
+}
+
 func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.Config, error) {
+	a.provisionersMutex.RLock()
+	claims := a.config.AuthorityConfig.Claims
+	a.provisionersMutex.RUnlock()
+	return a.generateProvisionerConfigWithClaims(ctx, claims)
+}
+
+func (a *Authority) generateProvisionerConfigWithClaims(ctx context.Context, claims *provisioner.Claims) (provisioner.Config, error) {
 	// Merge global and configuration claims
-	claimer, err := provisioner.NewClaimer(a.config.AuthorityConfig.Claims, config.GlobalProvisionerClaims)
+	claimer, err := provisioner.NewClaimer(claims, config.GlobalProvisionerClaims)
 	if err != nil {
 		return provisioner.Config{}, err
 	}
@@ -190,6 +333,10 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 	if err != nil {
 		return provisioner.Config{}, err
 	}
+	var issuerKey crypto.PublicKey
+	if len(a.intermediateX509Certs) > 0 {
+		issuerKey = a.intermediateX509Certs[0].PublicKey
+	}
 	return provisioner.Config{
 		Claims:    claimer.Claims(),
 		Audiences: a.config.GetAudiences(),
@@ -201,7 +348,11 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 		AuthorizeRenewFunc:    a.authorizeRenewFunc,
 		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
 		WebhookClient:         a.webhookClient,
+		WebhookHeaders:        a.config.AuthorityConfig.GetWebhookHeaders(),
 		SCEPKeyManager:        a.scepKeyManager,
+		HTTP01AllowedPorts:    a.config.AuthorityConfig.HTTP01AllowedPorts,
+		X509IssuerPublicKey:   issuerKey,
+		X509Roots:             a.rootX509Certs,
 	}, nil
 }
 
@@ -216,11 +367,11 @@ func (a *Authority) StoreProvisioner(ctx context.Context, prov *linkedca.Provisi
 			"error converting to certificates provisioner from linkedca provisioner")
 	}
 
-	if _, ok := a.provisioners.LoadByName(prov.GetName()); ok {
+	if _, ok := a.getProvisioners().LoadByName(prov.GetName()); ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"provisioner with name %s already exists", prov.GetName())
 	}
-	if _, ok := a.provisioners.LoadByTokenID(certProv.GetIDForToken()); ok {
+	if _, ok := a.getProvisioners().LoadByTokenID(certProv.GetIDForToken()); ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"provisioner with token ID %s already exists", certProv.GetIDForToken())
 	}
@@ -254,7 +405,7 @@ func (a *Authority) StoreProvisioner(ctx context.Context, prov *linkedca.Provisi
 		return admin.WrapErrorISE(err, "error initializing provisioner %s", prov.Name)
 	}
 
-	if err := a.provisioners.Store(certProv); err != nil {
+	if err := a.getProvisioners().Store(certProv); err != nil {
 		if err := a.ReloadAdminResources(ctx); err != nil {
 			return admin.WrapErrorISE(err, "error reloading admin resources on failed provisioner store")
 		}
@@ -287,9 +438,11 @@ func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisio
 		return admin.WrapErrorISE(err, "error initializing provisioner %s", nu.Name)
 	}
 
-	if err := a.provisioners.Update(certProv); err != nil {
+	old, _ := a.getProvisioners().Load(certProv.GetID())
+	if err := a.getProvisioners().Update(certProv); err != nil {
 		return admin.WrapErrorISE(err, "error updating provisioner '%s' in authority cache", nu.Name)
 	}
+	closeProvisioners(provisioner.List{old})
 	if err := a.adminDB.UpdateProvisioner(ctx, nu); err != nil {
 		if err := a.ReloadAdminResources(ctx); err != nil {
 			return admin.WrapErrorISE(err, "error reloading admin resources on failed provisioner update")
@@ -304,7 +457,7 @@ func (a *Authority) RemoveProvisioner(ctx context.Context, id string) error {
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
 
-	p, ok := a.provisioners.Load(id)
+	p, ok := a.getProvisioners().Load(id)
 	if !ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"provisioner %s not found", id)
@@ -315,13 +468,13 @@ func (a *Authority) RemoveProvisioner(ctx context.Context, id string) error {
 		// Validate
 		//  - Check that there will be SUPER_ADMINs that remain after we
 		//    remove this provisioner.
-		if a.IsAdminAPIEnabled() && a.admins.SuperCount() == a.admins.SuperCountByProvisioner(provName) {
+		if a.IsAdminAPIEnabled() && a.getAdmins().SuperCount() == a.getAdmins().SuperCountByProvisioner(provName) {
 			return admin.NewError(admin.ErrorBadRequestType,
 				"cannot remove provisioner %s because no super admins will remain", provName)
 		}
 
 		// Delete all admins associated with the provisioner.
-		admins, ok := a.admins.LoadByProvisioner(provName)
+		admins, ok := a.getAdmins().LoadByProvisioner(provName)
 		if ok {
 			for _, adm := range admins {
 				if err := a.removeAdmin(ctx, adm.Id); err != nil {
@@ -332,9 +485,10 @@ func (a *Authority) RemoveProvisioner(ctx context.Context, id string) error {
 	}
 
 	// Remove provisioner from authority caches.
-	if err := a.provisioners.Remove(provID); err != nil {
+	if err := a.getProvisioners().Remove(provID); err != nil {
 		return admin.WrapErrorISE(err, "error removing provisioner from authority cache")
 	}
+	closeProvisioners(provisioner.List{p})
 	// Remove provisioner from database.
 	if err := a.adminDB.DeleteProvisioner(ctx, provID); err != nil {
 		if err := a.ReloadAdminResources(ctx); err != nil {
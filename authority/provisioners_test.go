@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/http"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -390,3 +391,102 @@ func Test_isRAProvisioner(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_ReloadProvisioners(t *testing.T) {
+	maxjwk, err := jose.ReadKey("testdata/secrets/max_pub.jwk")
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	newConfig := func(provs provisioner.List, claims *provisioner.Claims) *Config {
+		return &Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{"testdata/certs/root_ca.crt"},
+			IntermediateCert: "testdata/certs/intermediate_ca.crt",
+			IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+			DNSNames:         []string{"example.com"},
+			Password:         "pass",
+			AuthorityConfig: &AuthConfig{
+				Provisioners: provs,
+				Claims:       claims,
+			},
+		}
+	}
+	maxDur := &provisioner.Duration{Duration: 2 * time.Hour}
+
+	added, removed, err := a.ReloadProvisioners(context.Background(), newConfig(provisioner.List{
+		&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+		&provisioner.JWK{Name: "new", Type: "JWK", Key: maxjwk},
+	}, &provisioner.Claims{MaxTLSDur: maxDur, DefaultTLSDur: maxDur}))
+	require.NoError(t, err)
+	assert.Equals(t, []string{"new"}, added)
+	assert.Equals(t, []string{"step-cli", "dev", "renew_disabled", "sshpop"}, removed)
+
+	p, err := a.LoadProvisionerByName("new")
+	require.NoError(t, err)
+	assert.Equals(t, "new", p.GetName())
+	_, err = a.LoadProvisionerByName("step-cli")
+	assert.Error(t, err)
+	// The new global claims are used.
+	assert.Equals(t, maxDur, a.config.AuthorityConfig.Claims.MaxTLSDur)
+
+	// The current provisioners are kept if the configuration is not valid.
+	_, _, err = a.ReloadProvisioners(context.Background(), newConfig(provisioner.List{
+		&provisioner.JWK{Name: "bad", Type: "JWK"},
+	}, nil))
+	assert.Error(t, err)
+	_, err = a.LoadProvisionerByName("new")
+	assert.NoError(t, err)
+	_, err = a.LoadProvisionerByName("bad")
+	assert.Error(t, err)
+
+	cfg := newConfig(provisioner.List{&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk}}, nil)
+	cfg.Address = ""
+	_, _, err = a.ReloadProvisioners(context.Background(), cfg)
+	assert.Equals(t, "address cannot be empty", err.Error())
+
+	// The replaced provisioners are closed.
+	closer := &closerJWK{JWK: &provisioner.JWK{Name: "closer", Type: "JWK", Key: maxjwk}}
+	_, _, err = a.ReloadProvisioners(context.Background(), newConfig(provisioner.List{closer}, nil))
+	require.NoError(t, err)
+	assert.False(t, closer.closed)
+	_, _, err = a.ReloadProvisioners(context.Background(), newConfig(provisioner.List{
+		&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+	}, nil))
+	require.NoError(t, err)
+	assert.True(t, closer.closed)
+
+	// The provisioners can be loaded while they are reloaded.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, _ = a.LoadProvisionerByName("Max")
+				_, _ = a.LoadAdminBySubProv("foo", "Max")
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err = a.ReloadProvisioners(context.Background(), newConfig(provisioner.List{
+			&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+		}, nil))
+		require.NoError(t, err)
+	}
+	wg.Wait()
+
+	a.config.AuthorityConfig.EnableAdmin = true
+	_, _, err = a.ReloadProvisioners(context.Background(), newConfig(nil, nil))
+	assert.Equals(t, "provisioners cannot be reloaded if the admin API is enabled", err.Error())
+}
+
+// closerJWK is a JWK provisioner that records when it's closed.
+type closerJWK struct {
+	*provisioner.JWK
+	closed bool
+}
+
+func (p *closerJWK) Close() error {
+	p.closed = true
+	return nil
+}
@@ -159,6 +159,10 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		validators  []provisioner.SSHCertValidator
 	)
 
+	if err := a.checkMaintenanceMode(); err != nil {
+		return nil, nil, err
+	}
+
 	// Validate given options.
 	if err := opts.Validate(); err != nil {
 		return nil, nil, err
@@ -323,6 +327,10 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 }
 
 func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ssh.Certificate, provisioner.Interface, error) {
+	if err := a.checkMaintenanceMode(); err != nil {
+		return nil, nil, err
+	}
+
 	if oldCert.ValidAfter == 0 || oldCert.ValidBefore == 0 {
 		return nil, nil, errs.BadRequest("cannot renew a certificate without validity period")
 	}
@@ -394,6 +402,10 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 }
 
 func (a *Authority) rekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub ssh.PublicKey, signOpts ...provisioner.SignOption) (*ssh.Certificate, provisioner.Interface, error) {
+	if err := a.checkMaintenanceMode(); err != nil {
+		return nil, nil, err
+	}
+
 	var prov provisioner.Interface
 	var validators []provisioner.SSHCertValidator
 	for _, op := range signOpts {
@@ -548,6 +560,9 @@ func IsValidForAddUser(cert *ssh.Certificate) error {
 
 // SignSSHAddUser signs a certificate that provisions a new user in a server.
 func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subject *ssh.Certificate) (*ssh.Certificate, error) {
+	if err := a.checkMaintenanceMode(); err != nil {
+		return nil, err
+	}
 	if a.sshCAUserCertSignKey == nil {
 		return nil, errs.NotImplemented("signSSHAddUser: user certificate signing is not enabled")
 	}
@@ -47,6 +47,22 @@ func TokenFromContext(ctx context.Context) (token string, ok bool) {
 	return
 }
 
+type dryRunKey struct{}
+
+// NewContextWithDryRun creates a new context from ctx that makes
+// SignWithContext run all the validations, policies and webhooks but not sign
+// or store the certificate. The returned chain only contains the unsigned
+// certificate template.
+func NewContextWithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// DryRunFromContext returns if the certificate must not be signed.
+func DryRunFromContext(ctx context.Context) bool {
+	m, _ := ctx.Value(dryRunKey{}).(bool)
+	return m
+}
+
 // GetTLSOptions returns the tls options configured.
 func (a *Authority) GetTLSOptions() *config.TLSOptions {
 	return a.config.TLS
@@ -103,7 +119,9 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 // request, taking the provided context.Context.
 func (a *Authority) SignWithContext(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	chain, prov, err := a.signX509(ctx, csr, signOpts, extraOpts...)
-	a.meter.X509Signed(prov, err)
+	if !DryRunFromContext(ctx) {
+		a.meter.X509Signed(prov, err)
+	}
 	return chain, err
 }
 
@@ -115,6 +133,10 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		certEnforcers  []provisioner.CertificateEnforcer
 	)
 
+	if err := a.checkMaintenanceMode(); err != nil {
+		return nil, nil, err
+	}
+
 	opts := []any{errs.WithKeyVal("csr", csr), errs.WithKeyVal("signOptions", signOpts)}
 	if err := csr.CheckSignature(); err != nil {
 		return nil, nil, errs.ApplyOptions(
@@ -281,6 +303,11 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
+	// Return the template without signing it on dry runs
+	if DryRunFromContext(ctx) {
+		return []*x509.Certificate{leaf}, prov, nil
+	}
+
 	// Sign certificate
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
 
@@ -365,6 +392,10 @@ func (a *Authority) RenewContext(ctx context.Context, oldCert *x509.Certificate,
 }
 
 func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, provisioner.Interface, error) {
+	if err := a.checkMaintenanceMode(); err != nil {
+		return nil, nil, err
+	}
+
 	isRekey := (pk != nil)
 	opts := []errs.Option{
 		errs.WithKeyVal("serialNumber", oldCert.SerialNumber.String()),
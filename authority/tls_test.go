@@ -935,6 +935,53 @@ ZYtQ9Ot36qc=
 	}
 }
 
+func TestAuthority_SignWithContext_dryRun(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := NewContextWithDryRun(provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod))
+	assert.True(t, DryRunFromContext(ctx))
+	assert.False(t, DryRunFromContext(context.Background()))
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+	a.db = &db.MockAuthDB{
+		MStoreCertificate: func(crt *x509.Certificate) error {
+			t.Error("certificate stored on a dry run")
+			return nil
+		},
+	}
+
+	nb := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(nb),
+		NotAfter:  provisioner.NewTimeDuration(nb.Add(5 * time.Minute)),
+	}
+
+	// The unsigned template is returned.
+	chain, err := a.SignWithContext(ctx, getCSR(t, priv), signOpts, extraOpts...)
+	require.NoError(t, err)
+	require.Len(t, chain, 1)
+	assert.Equal(t, "smallstep test", chain[0].Subject.CommonName)
+	assert.Equal(t, []string{"test.smallstep.com"}, chain[0].DNSNames)
+	assert.Nil(t, chain[0].Raw)
+	assert.Nil(t, chain[0].Signature)
+
+	// Validations return the same errors.
+	csr := getCSR(t, priv, func(csr *x509.CertificateRequest) {
+		csr.DNSNames = []string{"other.smallstep.com"}
+	})
+	_, err = a.SignWithContext(ctx, csr, signOpts, extraOpts...)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+	assert.ErrorContains(t, err, "certificate request does not contain the valid DNS names")
+}
+
 func TestAuthority_Renew(t *testing.T) {
 	a := testAuthority(t)
 	a.config.AuthorityConfig.Template = &ASN1DN{
@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/smallstep/certificates/acme"
 	acmeAPI "github.com/smallstep/certificates/acme/api"
 	acmeNoSQL "github.com/smallstep/certificates/acme/db/nosql"
@@ -26,6 +28,7 @@ import (
 	"github.com/smallstep/certificates/authority/admin"
 	adminAPI "github.com/smallstep/certificates/authority/admin/api"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/internal/metrix"
@@ -36,6 +39,7 @@ import (
 	scepAPI "github.com/smallstep/certificates/scep/api"
 	"github.com/smallstep/certificates/server"
 	"github.com/smallstep/nosql"
+	"go.opentelemetry.io/otel/trace"
 	"go.step.sm/cli-utils/step"
 	"go.step.sm/crypto/x509util"
 )
@@ -51,6 +55,10 @@ type options struct {
 	database        db.AuthDB
 	x509CAService   apiv1.CertificateAuthorityService
 	tlsConfig       *tls.Config
+	acmeEntropy     io.Reader
+	acmeTransition  acme.ChallengeTransitionFunc
+	tracerProvider  trace.TracerProvider
+	acmeNonces      acme.NonceStore
 }
 
 func (o *options) apply(opts []Option) {
@@ -131,6 +139,39 @@ func WithLinkedCAToken(token string) Option {
 	}
 }
 
+// WithACMEEntropySource sets the source of the random bytes of the ACME
+// challenge tokens. Defaults to crypto/rand.
+func WithACMEEntropySource(r io.Reader) Option {
+	return func(o *options) {
+		o.acmeEntropy = r
+	}
+}
+
+// WithACMEChallengeTransition sets a callback called after an ACME challenge
+// changes its status. The callback runs asynchronously and cannot block or
+// fail the validation.
+func WithACMEChallengeTransition(fn acme.ChallengeTransitionFunc) Option {
+	return func(o *options) {
+		o.acmeTransition = fn
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used to trace the
+// webhook requests. Webhook requests are not traced without it.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// withACMENonceStore sets the ACME nonce store used instead of creating a new
+// one. It's used to keep the nonces when the CA is reloaded.
+func withACMENonceStore(s acme.NonceStore) Option {
+	return func(o *options) {
+		o.acmeNonces = s
+	}
+}
+
 // WithQuiet sets the quiet flag.
 func WithQuiet(quiet bool) Option {
 	return func(o *options) {
@@ -149,6 +190,8 @@ type CA struct {
 	opts        *options
 	renewer     *TLSRenewer
 	compactStop chan struct{}
+	validations *acme.ValidationCoordinator
+	nonces      acme.NonceStore
 }
 
 // New creates and initializes the CA with the given configuration and options.
@@ -256,12 +299,34 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	// ACME Router is only available if we have a database.
 	var acmeDB acme.DB
 	var acmeLinker acme.Linker
+	var acmeNonces acme.NonceStore
 	if cfg.DB != nil {
-		acmeDB, err = acmeNoSQL.New(auth.GetDatabase().(nosql.DB))
+		acmeDBOptions := []acmeNoSQL.Option{
+			acmeNoSQL.WithCompressionThreshold(cfg.DB.ACMECompressionThreshold),
+		}
+		if cfg.DB.CompressACMERecords {
+			acmeDBOptions = append(acmeDBOptions, acmeNoSQL.WithCompression())
+		}
+		if n := cfg.DB.ACMEMaxChallengeAttempts; n != 0 {
+			acmeDBOptions = append(acmeDBOptions, acmeNoSQL.WithMaxChallengeAttempts(n))
+		}
+		nosqlDB, err := acmeNoSQL.New(auth.GetDatabase().(nosql.DB), acmeDBOptions...)
 		if err != nil {
 			return nil, errors.Wrap(err, "error configuring ACME DB interface")
 		}
+		acmeDB = nosqlDB
+		nonces := cfg.AuthorityConfig.ACMENonces
+		switch {
+		case ca.opts.acmeNonces != nil:
+			acmeNonces = ca.opts.acmeNonces
+		case nonces != nil && nonces.Type == "memory":
+			acmeNonces = acme.NewMemoryNonceStore(nonces.GetTTL(), nonces.GetMaxSize(), nil)
+		default:
+			acmeNonces = acmeNoSQL.NewNonceStore(nosqlDB, nonces.GetTTL(), nonces.GetMaxSize())
+		}
+		ca.nonces = acmeNonces
 		acmeLinker = acme.NewLinker(dns, "acme")
+		ca.validations = acme.NewValidationCoordinator()
 		mux.Route("/acme", func(r chi.Router) {
 			acmeAPI.Route(r)
 		})
@@ -330,10 +395,12 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	}
 
 	// Add logger if configured
-	var legacyTraceHeader string
+	var (
+		legacyTraceHeader string
+		logger            *logging.Logger
+	)
 	if len(cfg.Logger) > 0 {
-		logger, err := logging.New("ca", cfg.Logger)
-		if err != nil {
+		if logger, err = logging.New("ca", cfg.Logger); err != nil {
 			return nil, err
 		}
 		legacyTraceHeader = logger.GetTraceHeader()
@@ -347,6 +414,34 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 
 	// Create context with all the necessary values.
 	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeLinker)
+	if ca.validations != nil {
+		baseContext = acme.NewValidationCoordinatorContext(baseContext, ca.validations)
+		baseContext = acme.NewValidationLimiterContext(baseContext, acme.NewValidationLimiter())
+	}
+	if ca.opts.acmeEntropy != nil {
+		baseContext = acme.NewEntropySourceContext(baseContext, ca.opts.acmeEntropy)
+	}
+	if ca.opts.acmeTransition != nil {
+		baseContext = acme.NewChallengeTransitionContext(baseContext, ca.opts.acmeTransition)
+	}
+	if acmeNonces != nil {
+		baseContext = acme.NewNonceStoreContext(baseContext, acmeNonces)
+	}
+	if store, ok := acmeDB.(acme.RateLimitStore); ok {
+		baseContext = acme.NewRateLimiterContext(baseContext, acme.NewRateLimiter(store, nil))
+	}
+	if meter != nil && acmeDB != nil {
+		baseContext = acme.NewMeterContext(baseContext, meter)
+	}
+	if meter != nil {
+		baseContext = provisioner.NewMeterContext(baseContext, meter)
+	}
+	if ca.opts.tracerProvider != nil {
+		baseContext = provisioner.NewTracerProviderContext(baseContext, ca.opts.tracerProvider)
+	}
+	if logger != nil && acmeDB != nil {
+		baseContext = acme.NewLoggerContext(baseContext, acmeLogger{logger})
+	}
 
 	ca.srv = server.New(cfg.Address, handler, tlsConfig)
 	ca.srv.BaseContext = func(net.Listener) context.Context {
@@ -406,11 +501,39 @@ func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB
 		ctx = scep.NewContext(ctx, scepAuthority)
 	}
 	if acmeDB != nil {
-		ctx = acme.NewContext(ctx, acmeDB, acme.NewClient(), acmeLinker, nil)
+		ctx = acme.NewContext(ctx, acmeDB, acme.NewClient(
+			acme.WithHeaders(a.GetConfig().AuthorityConfig.GetHTTP01Headers()),
+		), acmeLinker, nil)
 	}
 	return ctx
 }
 
+// acmeLogger adapts the CA logger to the acme.Logger interface.
+type acmeLogger struct {
+	*logging.Logger
+}
+
+// Log implements the acme.Logger interface.
+func (l acmeLogger) Log(level acme.LogLevel, msg string, kv ...any) {
+	fields := make(logrus.Fields, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if k, ok := kv[i].(string); ok {
+			fields[k] = kv[i+1]
+		}
+	}
+	entry := l.WithFields(fields)
+	switch level {
+	case acme.LogLevelDebug:
+		entry.Debug(msg)
+	case acme.LogLevelWarn:
+		entry.Warn(msg)
+	case acme.LogLevelError:
+		entry.Error(msg)
+	default:
+		entry.Info(msg)
+	}
+}
+
 // Run starts the CA calling to the server ListenAndServe method.
 func (ca *CA) Run() error {
 	var wg sync.WaitGroup
@@ -451,6 +574,8 @@ func (ca *CA) Run() error {
 		ca.runCompactJob()
 	}()
 
+	startNoncePurge(ca.nonces)
+
 	if ca.insecureSrv != nil {
 		wg.Add(1)
 		go func() {
@@ -502,6 +627,9 @@ func (ca *CA) Stop() error {
 		ca.renewer.Stop()
 	}
 
+	ca.drainValidations()
+	closeNonceStore(ca.nonces)
+
 	if err := ca.auth.Shutdown(); err != nil {
 		log.Printf("error stopping ca.Authority: %+v\n", err)
 	}
@@ -538,7 +666,7 @@ func (ca *CA) Reload() error {
 		return errors.New("error reloading ca: database configuration cannot change")
 	}
 
-	newCA, err := New(cfg,
+	opts := []Option{
 		WithPassword(ca.opts.password),
 		WithSSHHostPassword(ca.opts.sshHostPassword),
 		WithSSHUserPassword(ca.opts.sshUserPassword),
@@ -547,12 +675,26 @@ func (ca *CA) Reload() error {
 		WithQuiet(ca.opts.quiet),
 		WithConfigFile(ca.opts.configFile),
 		WithDatabase(ca.auth.GetDatabase()),
-	)
+		WithACMEEntropySource(ca.opts.acmeEntropy),
+		WithACMEChallengeTransition(ca.opts.acmeTransition),
+		WithTracerProvider(ca.opts.tracerProvider),
+	}
+	// Keep the ACME nonces if their configuration has not changed.
+	if reflect.DeepEqual(ca.config.AuthorityConfig.ACMENonces, cfg.AuthorityConfig.ACMENonces) {
+		opts = append(opts, withACMENonceStore(ca.nonces))
+	}
+
+	newCA, err := New(cfg, opts...)
 	if err != nil {
 		logContinue("Reload failed because the CA with new configuration could not be initialized.")
 		return errors.Wrap(err, "error reloading ca")
 	}
 
+	// Keep the maintenance mode before the new authority starts serving.
+	if retryAfter, ok := ca.auth.MaintenanceMode(); ok {
+		newCA.auth.SetMaintenanceMode(retryAfter)
+	}
+
 	if ca.insecureSrv != nil {
 		if err = ca.insecureSrv.Reload(newCA.insecureSrv); err != nil {
 			logContinue("Reload failed because insecure server could not be replaced.")
@@ -580,11 +722,74 @@ func (ca *CA) Reload() error {
 		ca.renewer.Stop()
 	}
 
+	for _, change := range newCA.config.Diff(ca.config) {
+		log.Printf("Configuration changed: %s", change)
+	}
+
 	ca.auth.CloseForReload()
 	ca.auth = newCA.auth
 	ca.config = newCA.config
 	ca.opts = newCA.opts
 	ca.renewer = newCA.renewer
+	ca.validations = newCA.validations
+	if newCA.nonces != ca.nonces {
+		closeNonceStore(ca.nonces)
+		startNoncePurge(newCA.nonces)
+		ca.nonces = newCA.nonces
+	}
+	return nil
+}
+
+// startNoncePurge starts the background purge of the ACME nonces if the store
+// requires it.
+func startNoncePurge(s acme.NonceStore) {
+	if s, ok := s.(*acmeNoSQL.NonceStore); ok {
+		s.Start()
+	}
+}
+
+// closeNonceStore stops the background jobs of the ACME nonce store, if any.
+func closeNonceStore(s acme.NonceStore) {
+	if c, ok := s.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// drainValidations waits for the running ACME challenge validations before the
+// CA is stopped. Validations still running after the drain timeout are canceled
+// and the challenges are kept as pending.
+func (ca *CA) drainValidations() {
+	if ca.validations == nil {
+		return
+	}
+	timeout := acme.DefaultDrainTimeout
+	if d := ca.config.AuthorityConfig.ACMEDrainTimeout; d != nil && d.Duration > 0 {
+		timeout = d.Duration
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := ca.validations.Drain(ctx); err != nil {
+		log.Printf("error draining ACME challenge validations: %v\n", err)
+	}
+}
+
+// ReloadProvisioners reloads the configuration file and replaces the
+// provisioners and global claims of the CA. Unlike Reload, the servers and the
+// signing keys are not replaced, and the current provisioners are kept if the
+// new configuration is not valid.
+func (ca *CA) ReloadProvisioners() error {
+	cfg, err := config.LoadConfiguration(ca.opts.configFile)
+	if err != nil {
+		return errors.Wrap(err, "error reloading ca configuration")
+	}
+
+	added, removed, err := ca.auth.ReloadProvisioners(context.Background(), cfg)
+	if err != nil {
+		log.Println("Reload of the provisioners failed, continuing to run with the original provisioners.")
+		return errors.Wrap(err, "error reloading provisioners")
+	}
+
+	log.Printf("Provisioners reloaded: %d added %v, %d removed %v", len(added), added, len(removed), removed)
 	return nil
 }
 
@@ -698,3 +698,29 @@ func TestCARenew(t *testing.T) {
 		})
 	}
 }
+
+func TestCAReload_maintenanceMode(t *testing.T) {
+	ca, _, err := startCAServer("testdata/ca.json")
+	assert.FatalError(t, err)
+	ca.opts.configFile = "testdata/ca.json"
+	defer ca.Stop()
+	// Wait a few ms until the http server calls listener.Accept().
+	time.Sleep(100 * time.Millisecond)
+
+	// The maintenance mode is kept by the new authority.
+	ca.auth.SetMaintenanceMode(time.Hour)
+	old := ca.auth
+	assert.FatalError(t, ca.Reload())
+	// Wait a few ms until the http server uses the new listener.
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, old != ca.auth)
+	retryAfter, ok := ca.auth.MaintenanceMode()
+	assert.True(t, ok)
+	assert.Equals(t, time.Hour, retryAfter)
+
+	// And it stays disabled once it's cleared.
+	ca.auth.ClearMaintenanceMode()
+	assert.FatalError(t, ca.Reload())
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, ca.auth.IsMaintenanceMode())
+}
@@ -20,6 +20,24 @@ type StopReloader interface {
 	Reload() error
 }
 
+// ProvisionersReloader is the interface that external commands can implement
+// to reload the provisioners while running.
+type ProvisionersReloader interface {
+	ReloadProvisioners() error
+}
+
+// ReloadProvisionersHandler calls ReloadProvisioners on the given server each
+// time the trigger channel receives a value, it returns when the channel is
+// closed. The trigger is usually a channel notified on SIGHUP.
+func ReloadProvisionersHandler(trigger <-chan os.Signal, srv ProvisionersReloader) {
+	for range trigger {
+		log.Println("reloading provisioners ...")
+		if err := srv.ReloadProvisioners(); err != nil {
+			log.Printf("error reloading provisioners: %+v", err)
+		}
+	}
+}
+
 // StopHandler watches SIGINT, SIGTERM on a list of servers implementing the
 // Stopper interface, and when one of those signals is caught we'll run Stop
 // (SIGINT, SIGTERM) on all servers.
@@ -0,0 +1,32 @@
+package ca
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testProvisionersReloader struct {
+	calls int
+	err   error
+}
+
+func (r *testProvisionersReloader) ReloadProvisioners() error {
+	r.calls++
+	return r.err
+}
+
+func TestReloadProvisionersHandler(t *testing.T) {
+	trigger := make(chan os.Signal, 3)
+	trigger <- syscall.SIGHUP
+	trigger <- syscall.SIGHUP
+	trigger <- syscall.SIGHUP
+	close(trigger)
+
+	srv := &testProvisionersReloader{err: errors.New("an error does not stop the handler")}
+	ReloadProvisionersHandler(trigger, srv)
+	assert.Equal(t, 3, srv.calls)
+}
@@ -1,6 +1,7 @@
 package apiv1
 
 import (
+	"crypto"
 	"crypto/x509"
 	"net/http"
 	"strings"
@@ -33,6 +34,13 @@ type CertificateAuthorityCreator interface {
 	CreateCertificateAuthority(req *CreateCertificateAuthorityRequest) (*CreateCertificateAuthorityResponse, error)
 }
 
+// CertificateSignerGetter is an optional interface implemented by a
+// CertificateAuthorityService that signs certificates with a local signer. It
+// returns the issuer chain and the signer currently in use.
+type CertificateSignerGetter interface {
+	GetCertificateSigner() ([]*x509.Certificate, crypto.Signer, error)
+}
+
 // SignatureAlgorithmGetter is an optional implementation in a crypto.Signer
 // that returns the SignatureAlgorithm to use.
 type SignatureAlgorithmGetter interface {
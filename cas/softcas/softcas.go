@@ -229,6 +229,12 @@ func (c *SoftCAS) initializeKeyManager() (err error) {
 	return
 }
 
+// GetCertificateSigner implements the apiv1.CertificateSignerGetter interface
+// and returns the certificate chain and signer currently used.
+func (c *SoftCAS) GetCertificateSigner() ([]*x509.Certificate, crypto.Signer, error) {
+	return c.getCertSigner()
+}
+
 // getCertSigner returns the certificate chain and signer to use.
 func (c *SoftCAS) getCertSigner() ([]*x509.Certificate, crypto.Signer, error) {
 	if c.CertificateSigner != nil {
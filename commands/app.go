@@ -7,9 +7,11 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"unicode"
 
 	"github.com/pkg/errors"
@@ -91,6 +93,11 @@ Requires **--insecure** flag.`,
 			Name:  "insecure",
 			Usage: "enable insecure flags.",
 		},
+		cli.BoolFlag{
+			Name: "reload-provisioners",
+			Usage: `reload only the provisioners and claims on SIGHUP. The servers and the
+signing keys are not replaced.`,
+		},
 	},
 }
 
@@ -257,7 +264,14 @@ To get a linked authority token:
 		fatal(err)
 	}
 
-	go ca.StopReloaderHandler(srv)
+	if ctx.Bool("reload-provisioners") {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go ca.ReloadProvisionersHandler(reload, srv)
+		go ca.StopHandler(srv)
+	} else {
+		go ca.StopReloaderHandler(srv)
+	}
 	if err = srv.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		fatal(err)
 	}
@@ -47,6 +47,18 @@ type Config struct {
 	// 'MemoryMap') to avoid memory-mapping log files. This can be useful
 	// in environments with low RAM
 	BadgerFileLoadingMode string `json:"badgerFileLoadingMode"`
+
+	// CompressACMERecords enables the compression of the large ACME
+	// challenges and orders of all the provisioners. Records stored before
+	// enabling or disabling it are still read.
+	CompressACMERecords bool `json:"compressACMERecords,omitempty"`
+	// ACMECompressionThreshold is the minimum size, in bytes, of the
+	// compressed ACME records. Defaults to 1024.
+	ACMECompressionThreshold int `json:"acmeCompressionThreshold,omitempty"`
+	// ACMEMaxChallengeAttempts is the maximum number of validation attempts
+	// stored with each ACME challenge. Defaults to 10, a negative value keeps
+	// all the attempts.
+	ACMEMaxChallengeAttempts int `json:"acmeMaxChallengeAttempts,omitempty"`
 }
 
 // AuthDB is an interface over an Authority DB client that implements a nosql.DB interface.
@@ -102,6 +114,44 @@ type CertificateRevocationListDB interface {
 	StoreCRL(*CertificateRevocationListInfo) error
 }
 
+// Operation is an optional operation of a database backend.
+type Operation string
+
+// OperationCmpAndSwap is the atomic compare-and-swap of a value, used by the
+// ACME server to update accounts, orders, authorizations and challenges.
+const OperationCmpAndSwap Operation = "CmpAndSwap"
+
+// ACMEOperations are the optional operations required by the ACME server.
+var ACMEOperations = []Operation{OperationCmpAndSwap}
+
+// OperationSupporter is an interface to indicate whether a database backend
+// supports an optional operation. Backends not implementing it are expected
+// to support all the operations of the nosql.DB interface.
+type OperationSupporter interface {
+	SupportsOperation(op Operation) bool
+}
+
+// CheckOperations returns an error if the given database does not support one
+// of the given operations.
+func CheckOperations(db interface{}, ops ...Operation) error {
+	if db == nil {
+		return errors.New("database is not configured")
+	}
+	if _, ok := db.(nosql.DB); !ok {
+		return errors.Errorf("database of type %T is not a nosql database", db)
+	}
+	s, ok := db.(OperationSupporter)
+	if !ok {
+		return nil
+	}
+	for _, op := range ops {
+		if !s.SupportsOperation(op) {
+			return errors.Errorf("database does not support the %s operation", op)
+		}
+	}
+	return nil
+}
+
 // DB is a wrapper over the nosql.DB interface.
 type DB struct {
 	nosql.DB
@@ -138,6 +138,12 @@ func (s *SimpleDB) CmpAndSwap([]byte, []byte, []byte, []byte) ([]byte, bool, err
 	return nil, false, ErrNotImplemented
 }
 
+// SupportsOperation returns false as SimpleDB does not implement any of the
+// optional operations.
+func (s *SimpleDB) SupportsOperation(Operation) bool {
+	return false
+}
+
 // Del deletes the data in the given table/bucket and key.
 func (s *SimpleDB) Del([]byte, []byte) error {
 	return ErrNotImplemented
@@ -18,6 +18,9 @@ func TestSimpleDB(t *testing.T) {
 	assert.False(t, isRevoked)
 	assert.Nil(t, err)
 
+	// SupportsOperation
+	assert.False(t, db.SupportsOperation(OperationCmpAndSwap))
+
 	// StoreCertificate
 	assert.Equals(t, ErrNotImplemented, db.StoreCertificate(nil))
 
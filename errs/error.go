@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -47,13 +48,23 @@ func WithKeyVal(key string, val interface{}) Option {
 	}
 }
 
+// WithRetryAfter returns an Option that sets the duration a client should
+// wait before retrying the request.
+func WithRetryAfter(d time.Duration) Option {
+	return func(e *Error) error {
+		e.retryAfter = d
+		return e
+	}
+}
+
 // Error represents the CA API errors.
 type Error struct {
-	Status    int
-	Err       error
-	Msg       string
-	Details   map[string]interface{}
-	RequestID string `json:"-"`
+	Status     int
+	Err        error
+	Msg        string
+	Details    map[string]interface{}
+	RequestID  string `json:"-"`
+	retryAfter time.Duration
 }
 
 // ErrorResponse represents an error in JSON format.
@@ -67,6 +78,11 @@ func (e *Error) Cause() error {
 	return e.Err
 }
 
+// Unwrap returns the original error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // Error implements the error interface and returns the error string.
 func (e *Error) Error() string {
 	return e.Err.Error()
@@ -78,6 +94,12 @@ func (e *Error) StatusCode() int {
 	return e.Status
 }
 
+// RetryAfter returns the duration a client should wait before retrying the
+// request, it returns 0 if it is not set.
+func (e *Error) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
 // Message returns a user friendly error, if one is set.
 func (e *Error) Message() string {
 	if e.Msg != "" {
@@ -191,6 +213,8 @@ var (
 	InternalServerErrorDefaultMsg = "The certificate authority encountered an Internal Server Error. " + seeLogs
 	// NotImplementedDefaultMsg 501 default msg
 	NotImplementedDefaultMsg = "The requested method is not implemented by the certificate authority. " + seeLogs
+	// ServiceUnavailableDefaultMsg 503 default msg
+	ServiceUnavailableDefaultMsg = "The certificate authority is temporarily unavailable. Please try again later."
 )
 
 var (
@@ -332,6 +356,12 @@ func NotImplementedErr(err error, opts ...Option) error {
 	return NewErr(http.StatusNotImplemented, err, opts...)
 }
 
+// ServiceUnavailable creates a 503 error with the given format and arguments.
+func ServiceUnavailable(format string, args ...interface{}) error {
+	args = append(args, withDefaultMessage(ServiceUnavailableDefaultMsg))
+	return Errorf(http.StatusServiceUnavailable, format, args...)
+}
+
 // BadRequest creates a 400 error with the given format and arguments.
 func BadRequest(format string, args ...interface{}) error {
 	return New(http.StatusBadRequest, format, args...)
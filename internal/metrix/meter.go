@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/authority/provisioner"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,6 +15,12 @@ import (
 
 // New initializes and returns a new [Meter].
 func New() (m *Meter) {
+	return NewWithRegistry(prometheus.NewRegistry())
+}
+
+// NewWithRegistry initializes and returns a new [Meter] that registers its
+// instruments in the given registry.
+func NewWithRegistry(reg *prometheus.Registry) (m *Meter) {
 	initializedAt := time.Now()
 
 	m = &Meter{
@@ -33,10 +40,10 @@ func New() (m *Meter) {
 			signed: prometheus.NewCounter(prometheus.CounterOpts(opts("kms", "signed", "Number of KMS-backed signatures"))),
 			errors: prometheus.NewCounter(prometheus.CounterOpts(opts("kms", "errors", "Number of KMS-related errors"))),
 		},
+		acme:    newACMEInstruments(),
+		webhook: newWebhookInstruments(),
 	}
 
-	reg := prometheus.NewRegistry()
-
 	reg.MustRegister(
 		m.uptime,
 		m.ssh.rekeyed,
@@ -51,6 +58,10 @@ func New() (m *Meter) {
 		m.x509.webhookEnriched,
 		m.kms.signed,
 		m.kms.errors,
+		m.acme.validated,
+		m.acme.validationDuration,
+		m.webhook.requests,
+		m.webhook.requestDuration,
 	)
 
 	h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{
@@ -74,6 +85,9 @@ type Meter struct {
 	ssh    *provisionerInstruments
 	x509   *provisionerInstruments
 	kms    *kms
+	acme   *acmeInstruments
+
+	webhook *webhookInstruments
 }
 
 // SSHRekeyed implements [authority.Meter] for [Meter].
@@ -144,6 +158,18 @@ func (m *Meter) KMSSigned(err error) {
 	}
 }
 
+// ACMEChallengeValidated implements [acme.Meter] for [Meter].
+func (m *Meter) ACMEChallengeValidated(typ acme.ChallengeType, outcome acme.ValidationOutcome, d time.Duration) {
+	m.acme.validated.WithLabelValues(string(typ), string(outcome)).Inc()
+	m.acme.validationDuration.WithLabelValues(string(typ)).Observe(d.Seconds())
+}
+
+// WebhookCalled implements [provisioner.Meter] for [Meter].
+func (m *Meter) WebhookCalled(name, kind string, statusCode int, outcome provisioner.WebhookOutcome, d time.Duration) {
+	m.webhook.requests.WithLabelValues(name, kind, strconv.Itoa(statusCode), string(outcome)).Inc()
+	m.webhook.requestDuration.WithLabelValues(name, kind).Observe(d.Seconds())
+}
+
 // provisionerInstruments wraps the counters exported by provisioners.
 type provisionerInstruments struct {
 	rekeyed *prometheus.CounterVec
@@ -179,6 +205,53 @@ func newProvisionerInstruments(subsystem string) *provisionerInstruments {
 	}
 }
 
+// acmeInstruments wraps the instruments exported by the ACME challenge
+// validations.
+type acmeInstruments struct {
+	validated          *prometheus.CounterVec
+	validationDuration *prometheus.HistogramVec
+}
+
+func newACMEInstruments() *acmeInstruments {
+	return &acmeInstruments{
+		validated: newCounterVec("acme", "challenge_validations_total", "Number of ACME challenge validations",
+			"type",
+			"outcome",
+		),
+		validationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "step_ca",
+			Subsystem: "acme",
+			Name:      "challenge_validation_duration_seconds",
+			Help:      "Duration of the ACME challenge validations",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type"}),
+	}
+}
+
+// webhookInstruments wraps the instruments exported by the webhook requests.
+type webhookInstruments struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+func newWebhookInstruments() *webhookInstruments {
+	return &webhookInstruments{
+		requests: newCounterVec("webhook", "requests_total", "Number of webhook requests",
+			"webhook",
+			"kind",
+			"status",
+			"outcome",
+		),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "step_ca",
+			Subsystem: "webhook",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the webhook requests, including retries",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"webhook", "kind"}),
+	}
+}
+
 type kms struct {
 	signed prometheus.Counter
 	errors prometheus.Counter
@@ -0,0 +1,94 @@
+package metrix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestMeter_ACMEChallengeValidated(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewWithRegistry(reg)
+
+	m.ACMEChallengeValidated(acme.DNS01, acme.ValidationValid, time.Second)
+	m.ACMEChallengeValidated(acme.DNS01, acme.ValidationValid, time.Second)
+	m.ACMEChallengeValidated(acme.HTTP01, acme.ValidationInvalid, time.Second)
+	m.ACMEChallengeValidated(acme.TLSALPN01, acme.ValidationError, time.Second)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	counters := map[string]float64{}
+	observations := map[string]uint64{}
+	for _, mf := range families {
+		for _, metric := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			switch mf.GetName() {
+			case "step_ca_acme_challenge_validations_total":
+				counters[labels["type"]+"/"+labels["outcome"]] = metric.GetCounter().GetValue()
+			case "step_ca_acme_challenge_validation_duration_seconds":
+				observations[labels["type"]] = metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"dns-01/valid":      2,
+		"http-01/invalid":   1,
+		"tls-alpn-01/error": 1,
+	}, counters)
+	assert.Equal(t, map[string]uint64{
+		"dns-01":      2,
+		"http-01":     1,
+		"tls-alpn-01": 1,
+	}, observations)
+}
+
+func TestMeter_WebhookCalled(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewWithRegistry(reg)
+
+	m.WebhookCalled("people", "ENRICHING", 200, provisioner.WebhookAllowed, time.Second)
+	m.WebhookCalled("people", "ENRICHING", 200, provisioner.WebhookAllowed, time.Second)
+	m.WebhookCalled("scep", "SCEPCHALLENGE", 200, provisioner.WebhookDenied, time.Second)
+	m.WebhookCalled("scep", "SCEPCHALLENGE", 0, provisioner.WebhookFailed, time.Second)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	counters := map[string]float64{}
+	observations := map[string]uint64{}
+	for _, mf := range families {
+		for _, metric := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			switch mf.GetName() {
+			case "step_ca_webhook_requests_total":
+				counters[labels["webhook"]+"/"+labels["kind"]+"/"+labels["status"]+"/"+labels["outcome"]] = metric.GetCounter().GetValue()
+			case "step_ca_webhook_request_duration_seconds":
+				observations[labels["webhook"]+"/"+labels["kind"]] = metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"people/ENRICHING/200/allowed":  2,
+		"scep/SCEPCHALLENGE/200/denied": 1,
+		"scep/SCEPCHALLENGE/0/error":    1,
+	}, counters)
+	assert.Equal(t, map[string]uint64{
+		"people/ENRICHING":   2,
+		"scep/SCEPCHALLENGE": 2,
+	}, observations)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -18,9 +19,11 @@ import (
 
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/scep"
+	"github.com/smallstep/certificates/webhook"
 )
 
 const (
@@ -80,13 +83,16 @@ func Route(r api.Router) {
 func route(r api.Router, middleware func(next http.HandlerFunc) http.HandlerFunc) {
 	getHandler := lookupProvisioner(Get)
 	postHandler := lookupProvisioner(Post)
+	challengeHandler := lookupProvisioner(IssueChallenge)
 
 	// For backward compatibility.
 	if middleware != nil {
 		getHandler = middleware(getHandler)
 		postHandler = middleware(postHandler)
+		challengeHandler = middleware(challengeHandler)
 	}
 
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/challenge", challengeHandler)
 	r.MethodFunc(http.MethodGet, "/{provisionerName}/*", getHandler)
 	r.MethodFunc(http.MethodGet, "/{provisionerName}", getHandler)
 	r.MethodFunc(http.MethodPost, "/{provisionerName}/*", postHandler)
@@ -147,6 +153,63 @@ func Post(w http.ResponseWriter, r *http.Request) {
 	writeResponse(w, res)
 }
 
+// IssueChallengeRequest is the body of the requests for one-time SCEP
+// challenges.
+type IssueChallengeRequest struct {
+	TransactionID string `json:"transactionID"`
+}
+
+// IssueChallenge handles the requests for one-time SCEP challenges. The
+// challenge is issued by the webhook configured in the provisioner, and it's
+// returned with the transaction ID and the time it expires. The SCEP request
+// of the transaction must use it as the challenge password. The request must
+// send the bearer token of the provisioner in the Authorization header.
+func IssueChallenge(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		failWithStatus(w, provisioner.ErrSCEPChallengeIssuanceUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	var req IssueChallengeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPayloadSize)).Decode(&req); err != nil {
+		failWithStatus(w, fmt.Errorf("invalid scep challenge request: %w", err), http.StatusBadRequest)
+		return
+	}
+	if req.TransactionID == "" {
+		failWithStatus(w, errors.New("invalid scep challenge request: transactionID cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	auth := scep.MustFromContext(ctx)
+	ch, err := auth.IssueChallenge(ctx, token, req.TransactionID)
+	switch {
+	case errors.Is(err, provisioner.ErrSCEPChallengeIssuanceDisabled):
+		failWithStatus(w, err, http.StatusNotFound)
+		return
+	case errors.Is(err, provisioner.ErrSCEPChallengeIssuanceUnauthorized):
+		failWithStatus(w, err, http.StatusUnauthorized)
+		return
+	case errors.Is(err, provisioner.ErrSCEPChallengeAlreadyIssued):
+		failWithStatus(w, err, http.StatusConflict)
+		return
+	case errors.Is(err, provisioner.ErrSCEPTooManyIssuedChallenges):
+		failWithStatus(w, err, http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, provisioner.ErrWebhookDenied):
+		failWithStatus(w, err, http.StatusForbidden)
+		return
+	case err != nil:
+		fail(w, fmt.Errorf("scep challenge request failed: %w", err))
+		return
+	}
+
+	render.JSON(w, ch)
+}
+
 func decodeRequest(r *http.Request) (request, error) {
 	defer r.Body.Close()
 
@@ -293,6 +356,7 @@ func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		ctx = scep.NewProvisionerContext(ctx, scep.Provisioner(prov))
+		ctx = provisioner.NewContextWithRequestMetadata(ctx, webhook.NewRequestMetadata(r))
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -386,7 +450,7 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	// We'll have to see how it works out.
 	if msg.MessageType == smallscep.PKCSReq || msg.MessageType == smallscep.RenewalReq {
 		if err := auth.ValidateChallenge(ctx, csr, challengePassword, transactionID); err != nil {
-			if errors.Is(err, provisioner.ErrSCEPChallengeInvalid) {
+			if errors.Is(err, provisioner.ErrWebhookDenied) {
 				return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, err.Error(), err)
 			}
 			scepErr := errors.New("failed validating challenge password")
@@ -444,9 +508,13 @@ func writeResponse(w http.ResponseWriter, res Response) {
 }
 
 func fail(w http.ResponseWriter, err error) {
+	failWithStatus(w, err, http.StatusInternalServerError)
+}
+
+func failWithStatus(w http.ResponseWriter, err error, status int) {
 	log.Error(w, err)
 
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	http.Error(w, err.Error(), status)
 }
 
 func createFailureResponse(ctx context.Context, csr *x509.CertificateRequest, msg *scep.PKIMessage, info smallscep.FailInfo, infoText string, failError error) (Response, error) {
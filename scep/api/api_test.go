@@ -3,7 +3,9 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -15,6 +17,12 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/scep"
+	"github.com/smallstep/certificates/webhook"
 )
 
 func Test_decodeRequest(t *testing.T) {
@@ -181,3 +189,84 @@ func Test_decodeRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestIssueChallenge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhook.RequestBody
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		json.NewEncoder(w).Encode(webhook.ResponseBody{
+			Allow: req.SCEPTransactionID != "denied",
+			Data:  webhook.SCEPIssuedChallengeData{Challenge: "issued-" + req.SCEPTransactionID},
+		})
+	}))
+	defer srv.Close()
+
+	issuing := &provisioner.SCEP{
+		Name: "scep",
+		Type: "SCEP",
+		Options: &provisioner.Options{
+			Webhooks: []*provisioner.Webhook{{
+				ID:     "webhook-id",
+				Name:   "issuer",
+				Secret: "MTIzNAo=",
+				Kind:   linkedca.Webhook_SCEPCHALLENGE.String(),
+				URL:    srv.URL,
+			}},
+		},
+		ChallengeIssuance:     &provisioner.SCEPChallengeIssuance{Webhook: "issuer", BearerToken: "token"},
+		ChallengeWebhookRetry: &provisioner.WebhookRetry{},
+	}
+	require.NoError(t, issuing.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims, WebhookClient: http.DefaultClient}))
+	static := &provisioner.SCEP{Name: "static", Type: "SCEP", ChallengePassword: "secret"}
+	require.NoError(t, static.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	issueChallenge := func(p *provisioner.SCEP, token, body string) *http.Response {
+		ctx := scep.NewContext(context.Background(), &scep.Authority{})
+		ctx = scep.NewProvisionerContext(ctx, p)
+		req := httptest.NewRequest(http.MethodPost, "http://scep:8080/scep/scep/challenge", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		IssueChallenge(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	res := issueChallenge(issuing, "token", `{"transactionID":"tx-1"}`)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var ch provisioner.SCEPIssuedChallenge
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&ch))
+	assert.Equal(t, "tx-1", ch.TransactionID)
+	assert.Equal(t, "issued-tx-1", ch.Challenge)
+	assert.False(t, ch.ExpiresAt.IsZero())
+
+	// The enrollment of the transaction must use the issued challenge.
+	assert.Error(t, issuing.ValidateChallenge(context.Background(), nil, "issued-tx-2", "tx-1"))
+
+	res = issueChallenge(issuing, "token", `{"transactionID":"tx-3"}`)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	for _, tt := range []struct {
+		name  string
+		p     *provisioner.SCEP
+		token string
+		body  string
+		want  int
+	}{
+		{"fail/no-token", issuing, "", `{"transactionID":"tx-2"}`, http.StatusUnauthorized},
+		{"fail/token", issuing, "other", `{"transactionID":"tx-2"}`, http.StatusUnauthorized},
+		{"fail/body", issuing, "token", `{"transactionID":`, http.StatusBadRequest},
+		{"fail/empty-transaction-id", issuing, "token", `{}`, http.StatusBadRequest},
+		{"fail/already-issued", issuing, "token", `{"transactionID":"tx-3"}`, http.StatusConflict},
+		{"fail/denied", issuing, "token", `{"transactionID":"denied"}`, http.StatusForbidden},
+		{"fail/disabled", static, "token", `{"transactionID":"tx-1"}`, http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := issueChallenge(tt.p, tt.token, tt.body)
+			res.Body.Close()
+			assert.Equal(t, tt.want, res.StatusCode)
+		})
+	}
+}
@@ -511,6 +511,13 @@ func (a *Authority) ValidateChallenge(ctx context.Context, csr *x509.Certificate
 	return p.ValidateChallenge(ctx, csr, challenge, transactionID)
 }
 
+// IssueChallenge issues a new one-time challenge for the given transaction if
+// the token authorizes the request.
+func (a *Authority) IssueChallenge(ctx context.Context, token, transactionID string) (*provisioner.SCEPIssuedChallenge, error) {
+	p := provisionerFromContext(ctx)
+	return p.IssueChallenge(ctx, token, transactionID)
+}
+
 func (a *Authority) NotifySuccess(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate, transactionID string) error {
 	p := provisionerFromContext(ctx)
 	return p.NotifySuccess(ctx, csr, cert, transactionID)
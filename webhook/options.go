@@ -2,6 +2,9 @@ package webhook
 
 import (
 	"crypto/x509"
+	"net"
+	"net/http"
+	"strings"
 
 	"go.step.sm/crypto/sshutil"
 	"go.step.sm/crypto/x509util"
@@ -122,3 +125,40 @@ func WithX5CCertificate(leaf *x509.Certificate) RequestBodyOption {
 		return nil
 	}
 }
+
+// WithACMEOrder sets the ACME order being finalized with the given
+// certificate request.
+func WithACMEOrder(order *ACMEOrder, cr *x509.CertificateRequest) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		o := *order
+		if cr != nil {
+			o.CSR = cr.Raw
+		}
+		rb.ACMEOrder = &o
+		return nil
+	}
+}
+
+// NewRequestMetadata returns the metadata of the given HTTP request. The remote
+// address does not include the port, and the addresses in X-Forwarded-For
+// headers are returned in order. Missing values are left empty.
+func NewRequestMetadata(r *http.Request) *RequestMetadata {
+	if r == nil {
+		return nil
+	}
+	md := &RequestMetadata{
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		md.RemoteAddr = host
+	}
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(h, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				md.ForwardedFor = append(md.ForwardedFor, addr)
+			}
+		}
+	}
+	return md
+}
@@ -3,6 +3,8 @@ package webhook
 import (
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -134,6 +136,23 @@ func TestNewRequestBody(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		"ACME Order": {
+			options: []RequestBodyOption{
+				WithACMEOrder(&ACMEOrder{
+					ID:          "orderID",
+					AccountID:   "accountID",
+					Identifiers: []ACMEIdentifier{{Type: "dns", Value: "example.com"}},
+				}, &x509.CertificateRequest{Raw: []byte("csr der")}),
+			},
+			want: &RequestBody{
+				ACMEOrder: &ACMEOrder{
+					ID:          "orderID",
+					AccountID:   "accountID",
+					Identifiers: []ACMEIdentifier{{Type: "dns", Value: "example.com"}},
+					CSR:         []byte("csr der"),
+				},
+			},
+		},
 		"fail/X5C Certificate": {
 			options: []RequestBodyOption{
 				WithX5CCertificate(&x509.Certificate{
@@ -158,3 +177,35 @@ func TestNewRequestBody(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRequestMetadata(t *testing.T) {
+	newRequest := func(remoteAddr string, headers map[string][]string) *http.Request {
+		r := httptest.NewRequest("POST", "/scep/provisioner", http.NoBody)
+		r.RemoteAddr = remoteAddr
+		r.Header = headers
+		return r
+	}
+	tests := []struct {
+		name string
+		req  *http.Request
+		want *RequestMetadata
+	}{
+		{"ok", newRequest("10.0.0.1:1234", map[string][]string{
+			"User-Agent":      {"scep-client/1.0"},
+			"X-Forwarded-For": {"192.168.0.1, 172.16.0.1", "172.16.0.2"},
+		}), &RequestMetadata{
+			RemoteAddr:   "10.0.0.1",
+			ForwardedFor: []string{"192.168.0.1", "172.16.0.1", "172.16.0.2"},
+			UserAgent:    "scep-client/1.0",
+		}},
+		{"ok/ipv6", newRequest("[::1]:1234", nil), &RequestMetadata{RemoteAddr: "::1"}},
+		{"ok/no-port", newRequest("10.0.0.1", nil), &RequestMetadata{RemoteAddr: "10.0.0.1"}},
+		{"ok/empty", newRequest("", map[string][]string{"X-Forwarded-For": {" , "}}), &RequestMetadata{}},
+		{"ok/nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, NewRequestMetadata(tt.req))
+		})
+	}
+}
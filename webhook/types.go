@@ -68,6 +68,36 @@ type X5CCertificate struct {
 	NotAfter           time.Time `json:"notAfter"`
 }
 
+// ACMEIdentifier is an identifier of an ACME order.
+type ACMEIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ACMEOrder is the ACME order sent to webhook servers when the order is
+// finalized. CSR is the DER encoded certificate request of the finalize
+// request.
+type ACMEOrder struct {
+	ID          string           `json:"id"`
+	AccountID   string           `json:"accountID"`
+	Identifiers []ACMEIdentifier `json:"identifiers"`
+	CSR         []byte           `json:"csr"`
+}
+
+// SCEPIssuedChallengeData is the data returned by the SCEPCHALLENGE webhook
+// servers that issue SCEP challenges.
+type SCEPIssuedChallengeData struct {
+	Challenge string `json:"challenge"`
+}
+
+// RequestMetadata is the metadata of the HTTP request received by the CA that
+// is sent to the webhook servers that include it.
+type RequestMetadata struct {
+	RemoteAddr   string   `json:"remoteAddr,omitempty"`
+	ForwardedFor []string `json:"forwardedFor,omitempty"`
+	UserAgent    string   `json:"userAgent,omitempty"`
+}
+
 // RequestBody is the body sent to webhook servers.
 type RequestBody struct {
 	Timestamp       time.Time `json:"timestamp"`
@@ -86,8 +116,16 @@ type RequestBody struct {
 	SCEPTransactionID    string `json:"scepTransactionID,omitempty"`
 	SCEPErrorCode        int    `json:"scepErrorCode,omitempty"`
 	SCEPErrorDescription string `json:"scepErrorDescription,omitempty"`
+	// Only set for SCEP challenge issuance requests
+	SCEPIssueChallenge bool `json:"scepIssueChallenge,omitempty"`
+	// Only set for SCEP challenge webhooks that include it
+	RequestMetadata *RequestMetadata `json:"requestMetadata,omitempty"`
 	// Only set for X5C provisioners
 	X5CCertificate *X5CCertificate `json:"x5cCertificate,omitempty"`
 	// Set for X5C, AWS, GCP, and Azure provisioners
 	AuthorizationPrincipal string `json:"authorizationPrincipal,omitempty"`
+	// Only set when finalizing ACME orders
+	ACMEOrder *ACMEOrder `json:"acmeOrder,omitempty"`
+	// Only set when validating the contacts of ACME accounts
+	ACMEContacts []string `json:"acmeContacts,omitempty"`
 }